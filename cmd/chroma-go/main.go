@@ -0,0 +1,212 @@
+// Command chroma-go manages offline bundles of the native artifacts used by
+// chroma-go, for hosts without network access:
+//
+//	chroma-go bundle create  --output DIR [--target os/arch]... [--model NAME]...
+//	chroma-go bundle verify  DIR
+//	chroma-go bundle install [--cache-dir DIR] [--target os/arch] [--print-env] DIR
+//
+// Install with:
+//
+//	go install github.com/amikos-tech/chroma-go/cmd/chroma-go@latest
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/bundle"
+)
+
+const usage = `Usage:
+  chroma-go bundle create  --output DIR [flags]   download artifacts into a new bundle
+  chroma-go bundle verify  DIR                    check checksums and signatures of a bundle
+  chroma-go bundle install [flags] DIR            verify a bundle and install it into the artifact cache
+
+Run "chroma-go bundle <command> --help" for the flags of a command.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "chroma-go:", err)
+		}
+		stop()
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) < 2 || args[0] != "bundle" {
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+	switch args[1] {
+	case "create":
+		return runCreate(ctx, args[2:], stdout, stderr)
+	case "verify":
+		return runVerify(args[2:], stdout, stderr)
+	case "install":
+		return runInstall(args[2:], stdout, stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return errors.Errorf("unknown bundle command %q", args[1])
+	}
+}
+
+// stringList is a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func runCreate(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("bundle create", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("output", "", "directory to create the bundle in (required)")
+	var targets, models stringList
+	fs.Var(&targets, "target", "platform to bundle, as os/arch or linux/arch-musl; repeatable (default: host)")
+	fs.Var(&models, "model", "Hugging Face ONNX model to bundle in addition to "+bundle.DefaultModel+", e.g. BAAI/bge-reranker-base; repeatable")
+	localShimVersion := fs.String("local-shim-version", bundle.DefaultLocalShimVersion, "chroma-go-local release")
+	tokenizersVersion := fs.String("tokenizers-version", bundle.DefaultTokenizersVersion, "pure-tokenizers release")
+	onnxRuntimeVersion := fs.String("onnx-runtime-version", bundle.DefaultOnnxRuntimeVersion, "ONNX Runtime release")
+	force := fs.Bool("force", false, "replace the contents of a non-empty output directory")
+	quiet := fs.Bool("quiet", false, "do not report download progress")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return errors.New("--output is required and no positional arguments are accepted")
+	}
+
+	opts := []bundle.Option{
+		bundle.WithLocalShimVersion(*localShimVersion),
+		bundle.WithTokenizersVersion(*tokenizersVersion),
+		bundle.WithOnnxRuntimeVersion(*onnxRuntimeVersion),
+	}
+	for _, t := range targets {
+		target, err := bundle.ParseTarget(t)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, bundle.WithTargets(target))
+	}
+	for _, m := range models {
+		opts = append(opts, bundle.WithModels(bundle.HuggingFaceModel(m)))
+	}
+	if *force {
+		opts = append(opts, bundle.WithForce())
+	}
+	if !*quiet {
+		opts = append(opts, bundle.WithProgress(progressPrinter(stderr)))
+	}
+	manifest, err := bundle.Create(ctx, *output, opts...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Created bundle with %d files in %s\n", len(manifest.Files), *output)
+	return nil
+}
+
+func runVerify(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("bundle verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected the bundle directory")
+	}
+	manifest, err := bundle.Verify(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	targets := make([]string, 0, len(manifest.Targets))
+	for _, t := range manifest.Targets {
+		targets = append(targets, t.String())
+	}
+	fmt.Fprintf(stdout, "Bundle OK: %d files, local shim %s, tokenizers %s, ONNX Runtime %s, targets %s\n",
+		len(manifest.Files), manifest.Versions.LocalShim, manifest.Versions.Tokenizers,
+		manifest.Versions.OnnxRuntime, strings.Join(targets, ", "))
+	return nil
+}
+
+func runInstall(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("bundle install", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cacheDir := fs.String("cache-dir", "", "artifact cache to install into (default: CHROMA_CACHE_DIR or ~/.cache/chroma)")
+	target := fs.String("target", "", "platform to install, as os/arch or linux/arch-musl (default: host)")
+	printEnv := fs.Bool("print-env", false, "print shell export statements that point the runtime at the installed artifacts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected the bundle directory")
+	}
+	var opts []bundle.InstallOption
+	if *cacheDir != "" {
+		opts = append(opts, bundle.WithCacheDir(*cacheDir))
+	}
+	if *target != "" {
+		t, err := bundle.ParseTarget(*target)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, bundle.WithInstallTarget(t))
+	}
+	inst, err := bundle.Install(fs.Arg(0), opts...)
+	if err != nil {
+		return err
+	}
+	if *printEnv {
+		for _, kv := range inst.Env() {
+			key, value, _ := strings.Cut(kv, "=")
+			fmt.Fprintf(stdout, "export %s=%s\n", key, shellQuote(value))
+		}
+		return nil
+	}
+	fmt.Fprintf(stdout, "Installed into %s\n  local shim:   %s\n  tokenizers:   %s\n  ONNX Runtime: %s\n",
+		inst.CacheDir, inst.LocalShimLibrary, inst.TokenizersLibrary, inst.OnnxRuntimeLibrary)
+	names := make([]string, 0, len(inst.Models))
+	for name := range inst.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stdout, "  model %s: %s\n", name, inst.Models[name])
+	}
+	return nil
+}
+
+// progressPrinter reports each download once when it starts and once when it
+// completes.
+func progressPrinter(w io.Writer) bundle.ProgressFunc {
+	var current string
+	return func(file string, downloaded, total int64) {
+		if file != current {
+			current = file
+			fmt.Fprintf(w, "Downloading %s\n", file)
+		}
+		if total > 0 && downloaded == total {
+			fmt.Fprintf(w, "Downloaded %s (%.1f MiB)\n", file, float64(total)/(1<<20))
+		}
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
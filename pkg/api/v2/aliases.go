@@ -0,0 +1,503 @@
+package v2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// AliasCollectionName is the name of the system collection holding the alias
+// mappings of a database. Each alias is a record whose ID is the alias name.
+const AliasCollectionName = "chroma_go_aliases"
+
+const aliasTargetKey = "collection"
+
+var (
+	// ErrAliasNotFound is returned for aliases that are not defined.
+	ErrAliasNotFound = errors.New("alias not found")
+	// ErrAliasConflict is returned by [AliasManager.SwapAlias] when the alias does not
+	// point to the expected collection, e.g. because another process swapped it.
+	ErrAliasConflict = errors.New("alias points to a different collection")
+)
+
+type aliasSettings struct {
+	cacheTTL time.Duration
+	database Database
+}
+
+// AliasOption configures an [AliasManager].
+type AliasOption func(s *aliasSettings) error
+
+// WithAliasCacheTTL caches resolved aliases, including names that are not aliases,
+// for ttl. Other processes see a swapped alias once their cache entries expire.
+// Aliases are not cached by default.
+func WithAliasCacheTTL(ttl time.Duration) AliasOption {
+	return func(s *aliasSettings) error {
+		if ttl < 0 {
+			return errors.New("alias cache TTL cannot be negative")
+		}
+		s.cacheTTL = ttl
+		return nil
+	}
+}
+
+// WithAliasDatabase manages the aliases of database instead of the client's current database.
+func WithAliasDatabase(database Database) AliasOption {
+	return func(s *aliasSettings) error {
+		if database == nil {
+			return errors.New("database cannot be nil")
+		}
+		if err := database.Validate(); err != nil {
+			return errors.Wrap(err, "error validating database")
+		}
+		s.database = database
+		return nil
+	}
+}
+
+// WithCollectionAliases makes GetCollection resolve collection aliases: when the
+// name passed to GetCollection is an alias, the collection it points to is returned.
+// See [AliasManager] for defining aliases.
+func WithCollectionAliases(opts ...AliasOption) ClientOption {
+	return func(c *BaseAPIClient) error {
+		settings := &aliasSettings{}
+		for _, opt := range opts {
+			if err := opt(settings); err != nil {
+				return err
+			}
+		}
+		c.aliases = settings
+		return nil
+	}
+}
+
+// withoutAliasResolution gets the collection by its name even if it is an alias.
+func withoutAliasResolution() GetCollectionOption {
+	return func(op *GetCollectionOp) error {
+		op.skipAliasResolution = true
+		return nil
+	}
+}
+
+type aliasCacheEntry struct {
+	target  string
+	found   bool
+	expires time.Time
+}
+
+// aliasCache holds resolved aliases by database. The alias managers of a client share the
+// client's cache, so that aliases changed through [NewAliasManager] are resolved by the
+// client's GetCollection right away.
+type aliasCache struct {
+	mu      sync.Mutex
+	entries map[string]aliasCacheEntry
+	// noCollection holds until when databases without an alias collection are not checked again
+	noCollection map[string]time.Time
+}
+
+func newAliasCache() *aliasCache {
+	return &aliasCache{entries: map[string]aliasCacheEntry{}, noCollection: map[string]time.Time{}}
+}
+
+func aliasCacheKey(db, alias string) string {
+	return db + "\x00" + alias
+}
+
+func (c *aliasCache) get(db, alias string) (aliasCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[aliasCacheKey(db, alias)]
+	return entry, ok && time.Now().Before(entry.expires)
+}
+
+func (c *aliasCache) put(db, alias string, entry aliasCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[aliasCacheKey(db, alias)] = entry
+}
+
+func (c *aliasCache) invalidate(db, alias string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, aliasCacheKey(db, alias))
+	delete(c.noCollection, db)
+}
+
+func (c *aliasCache) hasNoCollection(db string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.noCollection[db]
+	return ok && time.Now().Before(until)
+}
+
+func (c *aliasCache) setNoCollection(db string, until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noCollection[db] = until
+}
+
+// AliasManager maps alias names to collections, so that readers can be switched
+// from one collection to another, e.g. to a rebuilt index, without changing the
+// collection name they use.
+//
+// Chroma has no aliases, the mappings are stored in the [AliasCollectionName]
+// collection of the database. Swapping an alias writes a single record, so readers
+// resolve either the old or the new collection.
+//
+//	aliases, err := NewAliasManager(client, WithAliasCacheTTL(30*time.Second))
+//	err = aliases.SetAlias(ctx, "products", "products-v1")
+//	// rebuild into products-v2, then switch readers over
+//	err = aliases.SwapAlias(ctx, "products", "products-v1", "products-v2")
+//	col, err := aliases.GetCollectionByAlias(ctx, "products")
+type AliasManager struct {
+	client   Client
+	settings aliasSettings
+
+	mu sync.Mutex
+	// collection is the alias collection of the database collectionDB
+	collection   Collection
+	collectionDB string
+	cache        *aliasCache
+}
+
+// NewAliasManager returns an [AliasManager] storing aliases through client. When client
+// resolves aliases ([WithCollectionAliases]), aliases changed through the manager are
+// resolved by the client's GetCollection right away.
+func NewAliasManager(client Client, opts ...AliasOption) (*AliasManager, error) {
+	if isNilInterface(client) {
+		return nil, errors.New("client cannot be nil")
+	}
+	settings := &aliasSettings{}
+	for _, opt := range opts {
+		if err := opt(settings); err != nil {
+			return nil, err
+		}
+	}
+	m := newAliasManager(client, settings)
+	if resolver := clientAliasManager(client); resolver != nil {
+		m.cache = resolver.cache
+	}
+	return m, nil
+}
+
+func newAliasManager(client Client, settings *aliasSettings) *AliasManager {
+	return &AliasManager{client: client, settings: *settings, cache: newAliasCache()}
+}
+
+// clientAliasManager returns the manager client resolves aliases with, nil if it does not resolve aliases.
+func clientAliasManager(client Client) *AliasManager {
+	switch c := client.(type) {
+	case *APIClientV2:
+		return c.aliases
+	case *CloudAPIClient:
+		return c.aliases
+	case *embeddedLocalClient:
+		return c.aliases
+	case *PersistentClient:
+		return clientAliasManager(c.Client)
+	case *readOnlyClient:
+		return clientAliasManager(c.Client)
+	}
+	return nil
+}
+
+func (m *AliasManager) database() Database {
+	if m.settings.database != nil {
+		return m.settings.database
+	}
+	return m.client.CurrentDatabase()
+}
+
+// aliasCollection returns the system collection, creating it if create is set.
+// It returns nil without error if the collection does not exist. A missing
+// collection is cached like an alias.
+func (m *AliasManager) aliasCollection(ctx context.Context, create bool) (Collection, error) {
+	db := databaseKey(m.database())
+	m.mu.Lock()
+	col := m.collection
+	if m.collectionDB != db {
+		col = nil
+	}
+	m.mu.Unlock()
+	if col != nil {
+		return col, nil
+	}
+	if !create && m.cache.hasNoCollection(db) {
+		return nil, nil
+	}
+	var err error
+	if create {
+		// the placeholder embedding function is not stored in the collection configuration
+		col, err = m.client.CreateCollection(ctx, AliasCollectionName,
+			WithIfNotExistsCreate(),
+			WithEmbeddingFunctionCreate(aliasEmbeddingFunction{}),
+			WithDisableEFConfigStorage(),
+			WithDatabaseCreate(m.database()),
+		)
+	} else {
+		col, err = m.client.GetCollection(ctx, AliasCollectionName,
+			withoutAliasResolution(),
+			WithEmbeddingFunctionGet(aliasEmbeddingFunction{}),
+			WithEFCompatibilityGet(EFCompatibilityOverride),
+			WithDatabaseGet(m.database()),
+		)
+		if isCollectionNotFound(err) {
+			if m.settings.cacheTTL > 0 {
+				m.cache.setNoCollection(db, time.Now().Add(m.settings.cacheTTL))
+			}
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting alias collection")
+	}
+	m.mu.Lock()
+	m.collection, m.collectionDB = col, db
+	m.mu.Unlock()
+	return col, nil
+}
+
+func databaseKey(db Database) string {
+	if db == nil {
+		return ""
+	}
+	if db.Tenant() == nil {
+		return db.Name()
+	}
+	return db.Tenant().Name() + "/" + db.Name()
+}
+
+// ResolveAlias returns the name of the collection alias points to and true, or
+// false if alias is not defined.
+func (m *AliasManager) ResolveAlias(ctx context.Context, alias string) (string, bool, error) {
+	db := databaseKey(m.database())
+	if m.settings.cacheTTL > 0 {
+		if entry, ok := m.cache.get(db, alias); ok {
+			return entry.target, entry.found, nil
+		}
+	}
+	target, found, err := m.lookup(ctx, alias)
+	if err != nil {
+		return "", false, err
+	}
+	if m.settings.cacheTTL > 0 {
+		m.cache.put(db, alias, aliasCacheEntry{target: target, found: found, expires: time.Now().Add(m.settings.cacheTTL)})
+	}
+	return target, found, nil
+}
+
+func (m *AliasManager) lookup(ctx context.Context, alias string) (string, bool, error) {
+	col, err := m.aliasCollection(ctx, false)
+	if err != nil || col == nil {
+		return "", false, err
+	}
+	result, err := col.Get(ctx, WithIDs(DocumentID(alias)), WithInclude(IncludeMetadatas))
+	if err != nil {
+		return "", false, errors.Wrapf(err, "error resolving alias %s", alias)
+	}
+	rows, ok := result.(interface{ Rows() []ResultRow })
+	if !ok {
+		return "", false, errors.Errorf("unsupported get result type %T", result)
+	}
+	for _, row := range rows.Rows() {
+		if row.Metadata == nil {
+			continue
+		}
+		if target, ok := row.Metadata.GetString(aliasTargetKey); ok && target != "" {
+			return target, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// GetCollectionByAlias returns the collection alias points to, or an error wrapping
+// [ErrAliasNotFound].
+func (m *AliasManager) GetCollectionByAlias(ctx context.Context, alias string, opts ...GetCollectionOption) (Collection, error) {
+	target, found, err := m.ResolveAlias(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Wrap(ErrAliasNotFound, alias)
+	}
+	opts = append([]GetCollectionOption{WithDatabaseGet(m.database())}, opts...)
+	return m.client.GetCollection(ctx, target, append(opts, withoutAliasResolution())...)
+}
+
+// ListAliases returns the defined aliases and the names of their collections.
+func (m *AliasManager) ListAliases(ctx context.Context) (map[string]string, error) {
+	aliases := map[string]string{}
+	col, err := m.aliasCollection(ctx, false)
+	if err != nil || col == nil {
+		return aliases, err
+	}
+	err = col.GetStream(ctx, func(row ResultRow) error {
+		if row.Metadata != nil {
+			if target, ok := row.Metadata.GetString(aliasTargetKey); ok {
+				aliases[string(row.ID)] = target
+			}
+		}
+		return nil
+	}, WithInclude(IncludeMetadatas))
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing aliases")
+	}
+	return aliases, nil
+}
+
+// SetAlias points alias to the collection, replacing any previous mapping.
+// The collection must exist, and alias cannot be the name of an existing collection.
+func (m *AliasManager) SetAlias(ctx context.Context, alias, collection string) error {
+	if err := m.validate(ctx, alias, collection); err != nil {
+		return err
+	}
+	return m.write(ctx, alias, collection)
+}
+
+// SwapAlias points alias from the collection expected to the collection target.
+// It fails with [ErrAliasConflict] if the alias does not point to expected when it is
+// read. Chroma has no conditional writes, so the check and the write are separate
+// requests: a swap by another process between them is not detected, and two
+// concurrent swaps can both succeed. Swap an alias from a single process.
+//
+// The alias is swapped with a single write, readers resolve either collection.
+// Caches of other processes resolve the new collection once their entries expire.
+func (m *AliasManager) SwapAlias(ctx context.Context, alias, expected, target string) error {
+	if err := m.validate(ctx, alias, target); err != nil {
+		return err
+	}
+	current, found, err := m.lookup(ctx, alias)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Wrap(ErrAliasNotFound, alias)
+	}
+	if current != expected {
+		return errors.Wrapf(ErrAliasConflict, "alias %s points to %s, expected %s", alias, current, expected)
+	}
+	return m.write(ctx, alias, target)
+}
+
+// DeleteAlias removes alias. Deleting an undefined alias is not an error.
+func (m *AliasManager) DeleteAlias(ctx context.Context, alias string) error {
+	col, err := m.aliasCollection(ctx, false)
+	if err != nil || col == nil {
+		return err
+	}
+	if err := col.Delete(ctx, WithIDs(DocumentID(alias))); err != nil {
+		return errors.Wrapf(err, "error deleting alias %s", alias)
+	}
+	m.invalidate(alias)
+	return nil
+}
+
+func (m *AliasManager) validate(ctx context.Context, alias, collection string) error {
+	if alias == "" {
+		return errors.New("alias cannot be empty")
+	}
+	if collection == "" {
+		return errors.New("collection name cannot be empty")
+	}
+	if alias == AliasCollectionName || collection == AliasCollectionName {
+		return errors.Errorf("%s is reserved for alias mappings", AliasCollectionName)
+	}
+	if alias == collection {
+		return errors.New("alias cannot point to itself")
+	}
+	if _, err := m.client.GetCollection(ctx, collection, withoutAliasResolution(), WithDatabaseGet(m.database())); err != nil {
+		return errors.Wrapf(err, "error getting collection %s", collection)
+	}
+	_, err := m.client.GetCollection(ctx, alias, withoutAliasResolution(), WithDatabaseGet(m.database()))
+	switch {
+	case err == nil:
+		return errors.Errorf("alias %s is the name of an existing collection", alias)
+	case !isCollectionNotFound(err):
+		return errors.Wrapf(err, "error checking for a collection named %s", alias)
+	}
+	return nil
+}
+
+func (m *AliasManager) write(ctx context.Context, alias, collection string) error {
+	col, err := m.aliasCollection(ctx, true)
+	if err != nil {
+		return err
+	}
+	err = col.Upsert(ctx,
+		WithIDs(DocumentID(alias)),
+		WithEmbeddings(embeddings.NewEmbeddingFromFloat32([]float32{1})),
+		WithMetadatas(NewDocumentMetadata(
+			NewStringAttribute(aliasTargetKey, collection),
+			NewStringAttribute("updated_at", time.Now().UTC().Format(time.RFC3339)),
+		)),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "error writing alias %s", alias)
+	}
+	m.invalidate(alias)
+	return nil
+}
+
+func (m *AliasManager) invalidate(alias string) {
+	m.cache.invalidate(databaseKey(m.database()), alias)
+}
+
+// resolveCollectionName returns the collection name alias points to, or name itself.
+// Names in databases other than the one of the aliases are not resolved.
+func (m *AliasManager) resolveCollectionName(ctx context.Context, database Database, name string) (string, error) {
+	if name == AliasCollectionName || databaseKey(database) != databaseKey(m.database()) {
+		return name, nil
+	}
+	target, found, err := m.ResolveAlias(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return target, nil
+	}
+	return name, nil
+}
+
+func isCollectionNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	var chErr *chhttp.ChromaError
+	if errors.As(err, &chErr) && chErr.ErrorCode == 404 {
+		return true
+	}
+	return isEmbeddedCollectionNotFoundError(err)
+}
+
+// aliasEmbeddingFunction is the embedding function of the alias collection, whose
+// records only carry a placeholder embedding.
+type aliasEmbeddingFunction struct{}
+
+func (aliasEmbeddingFunction) EmbedDocuments(_ context.Context, texts []string) ([]embeddings.Embedding, error) {
+	result := make([]embeddings.Embedding, len(texts))
+	for i := range texts {
+		result[i] = embeddings.NewEmbeddingFromFloat32([]float32{1})
+	}
+	return result, nil
+}
+
+func (aliasEmbeddingFunction) EmbedQuery(_ context.Context, _ string) (embeddings.Embedding, error) {
+	return embeddings.NewEmbeddingFromFloat32([]float32{1}), nil
+}
+
+func (aliasEmbeddingFunction) Name() string { return "chroma_go_alias" }
+
+func (aliasEmbeddingFunction) GetConfig() embeddings.EmbeddingFunctionConfig {
+	return embeddings.EmbeddingFunctionConfig{}
+}
+
+func (aliasEmbeddingFunction) DefaultSpace() embeddings.DistanceMetric { return embeddings.L2 }
+
+func (aliasEmbeddingFunction) SupportedSpaces() []embeddings.DistanceMetric {
+	return []embeddings.DistanceMetric{embeddings.L2}
+}
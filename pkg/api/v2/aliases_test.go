@@ -0,0 +1,250 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// aliasTestServer serves the collection endpoints used by aliases from memory.
+type aliasTestServer struct {
+	mu          sync.Mutex
+	collections map[string]string                    // name -> id
+	records     map[string]map[string]map[string]any // collection id -> record id -> metadata
+	recordGets  atomic.Int32
+	gets        atomic.Int32
+}
+
+func newAliasTestServer(t *testing.T, collections ...string) *httptest.Server {
+	t.Helper()
+	s := &aliasTestServer{collections: map[string]string{}, records: map[string]map[string]map[string]any{}}
+	for _, name := range collections {
+		s.create(name)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (s *aliasTestServer) create(name string) string {
+	if id, ok := s.collections[name]; ok {
+		return id
+	}
+	id := fmt.Sprintf("00000000-0000-0000-0000-%012d", len(s.collections)+1)
+	s.collections[name] = id
+	s.records[id] = map[string]map[string]any{}
+	return id
+}
+
+func (s *aliasTestServer) writeCollection(w http.ResponseWriter, name, id string) {
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "name": name, "tenant": DefaultTenant, "database": DefaultDatabase})
+}
+
+func (s *aliasTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := r.URL.Path
+	var req struct {
+		Name      string           `json:"name"`
+		IDs       []string         `json:"ids"`
+		Metadatas []map[string]any `json:"metadatas"`
+	}
+	if r.Method == http.MethodPost {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &req)
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/api/v2/tenants/default_tenant/databases/default_database/collections"), "/")
+	switch {
+	case strings.HasSuffix(path, "pre-flight-checks"):
+		_ = json.NewEncoder(w).Encode(map[string]any{"max_batch_size": 100})
+	case r.Method == http.MethodPost && len(parts) == 1:
+		s.writeCollection(w, req.Name, s.create(req.Name))
+	case r.Method == http.MethodGet && len(parts) == 2:
+		s.gets.Add(1)
+		id, ok := s.collections[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":"NotFoundError","message":"Collection not found"}`)
+			return
+		}
+		s.writeCollection(w, parts[1], id)
+	case r.Method == http.MethodPost && len(parts) == 3:
+		records := s.records[parts[1]]
+		switch parts[2] {
+		case "upsert":
+			for i, id := range req.IDs {
+				records[id] = req.Metadatas[i]
+			}
+			_, _ = io.WriteString(w, `{}`)
+		case "delete":
+			for _, id := range req.IDs {
+				delete(records, id)
+			}
+			_, _ = io.WriteString(w, `{}`)
+		case "get":
+			s.recordGets.Add(1)
+			result := map[string]any{"ids": []string{}, "metadatas": []any{}}
+			if req.IDs == nil {
+				for id := range records {
+					req.IDs = append(req.IDs, id)
+				}
+			}
+			for _, id := range req.IDs {
+				if md, ok := records[id]; ok {
+					result["ids"] = append(result["ids"].([]string), id)
+					result["metadatas"] = append(result["metadatas"].([]any), md)
+				}
+			}
+			_ = json.NewEncoder(w).Encode(result)
+		}
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestAliasManager(t *testing.T) {
+	srv := newAliasTestServer(t, "products-v1", "products-v2")
+	client := newResilientClient(t, WithBaseURL(srv.URL))
+	aliases, err := NewAliasManager(client)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, found, err := aliases.ResolveAlias(ctx, "products")
+	require.NoError(t, err)
+	require.False(t, found, "no alias collection yet")
+	_, err = aliases.GetCollectionByAlias(ctx, "products")
+	require.ErrorIs(t, err, ErrAliasNotFound)
+
+	require.NoError(t, aliases.SetAlias(ctx, "products", "products-v1"))
+	target, found, err := aliases.ResolveAlias(ctx, "products")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "products-v1", target)
+	col, err := aliases.GetCollectionByAlias(ctx, "products")
+	require.NoError(t, err)
+	require.Equal(t, "products-v1", col.Name())
+
+	err = aliases.SwapAlias(ctx, "products", "products-v0", "products-v2")
+	require.ErrorIs(t, err, ErrAliasConflict)
+	require.NoError(t, aliases.SwapAlias(ctx, "products", "products-v1", "products-v2"))
+	target, _, err = aliases.ResolveAlias(ctx, "products")
+	require.NoError(t, err)
+	require.Equal(t, "products-v2", target)
+
+	list, err := aliases.ListAliases(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"products": "products-v2"}, list)
+
+	require.Error(t, aliases.SetAlias(ctx, "products", "missing"), "target must exist")
+	require.Error(t, aliases.SetAlias(ctx, "products-v1", "products-v2"), "alias cannot shadow a collection")
+	require.Error(t, aliases.SetAlias(ctx, AliasCollectionName, "products-v2"))
+
+	require.NoError(t, aliases.DeleteAlias(ctx, "products"))
+	_, found, err = aliases.ResolveAlias(ctx, "products")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestGetCollectionResolvesAliases(t *testing.T) {
+	srv := newAliasTestServer(t, "products-v1", "products-v2")
+	client := newResilientClient(t, WithBaseURL(srv.URL), WithCollectionAliases(WithAliasCacheTTL(time.Hour)))
+	ctx := context.Background()
+
+	aliases, err := NewAliasManager(client)
+	require.NoError(t, err)
+	require.NoError(t, aliases.SetAlias(ctx, "products", "products-v1"))
+
+	col, err := client.GetCollection(ctx, "products")
+	require.NoError(t, err)
+	require.Equal(t, "products-v1", col.Name())
+	col, err = client.GetCollection(ctx, "products-v2")
+	require.NoError(t, err)
+	require.Equal(t, "products-v2", col.Name(), "collection names resolve to themselves")
+
+	other := newResilientClient(t, WithBaseURL(srv.URL), WithCollectionAliases(WithAliasCacheTTL(time.Hour)))
+	col, err = other.GetCollection(ctx, "products")
+	require.NoError(t, err)
+	require.Equal(t, "products-v1", col.Name())
+
+	// a manager of the client shares its cache, other clients see the swap after the TTL
+	require.NoError(t, aliases.SwapAlias(ctx, "products", "products-v1", "products-v2"))
+	col, err = client.GetCollection(ctx, "products")
+	require.NoError(t, err)
+	require.Equal(t, "products-v2", col.Name())
+	col, err = other.GetCollection(ctx, "products")
+	require.NoError(t, err)
+	require.Equal(t, "products-v1", col.Name())
+
+	require.NoError(t, aliases.DeleteAlias(ctx, "products"))
+	_, err = client.GetCollection(ctx, "products")
+	require.Error(t, err)
+}
+
+func TestAliasCacheTTL(t *testing.T) {
+	s := &aliasTestServer{collections: map[string]string{}, records: map[string]map[string]map[string]any{}}
+	s.records[s.create(AliasCollectionName)]["products"] = map[string]any{aliasTargetKey: "products-v1"}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	client := newResilientClient(t, WithBaseURL(srv.URL))
+	aliases, err := NewAliasManager(client, WithAliasCacheTTL(time.Hour))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		target, found, err := aliases.ResolveAlias(context.Background(), "products")
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, "products-v1", target)
+		_, found, err = aliases.ResolveAlias(context.Background(), "orders")
+		require.NoError(t, err)
+		require.False(t, found)
+	}
+	require.Equal(t, int32(2), s.recordGets.Load())
+
+	// a missing alias collection is cached until an alias is set
+	srv = newAliasTestServer(t, "orders-v1")
+	client = newResilientClient(t, WithBaseURL(srv.URL))
+	s = srv.Config.Handler.(*aliasTestServer)
+	aliases, err = NewAliasManager(client, WithAliasCacheTTL(time.Hour))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, found, err := aliases.ResolveAlias(context.Background(), fmt.Sprint("orders", i))
+		require.NoError(t, err)
+		require.False(t, found)
+	}
+	require.Equal(t, int32(1), s.gets.Load())
+	require.NoError(t, aliases.SetAlias(context.Background(), "orders", "orders-v1"))
+	target, found, err := aliases.ResolveAlias(context.Background(), "orders")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "orders-v1", target)
+
+	_, err = NewAliasManager(client, WithAliasCacheTTL(-time.Second))
+	require.Error(t, err)
+	_, err = NewHTTPClient(WithCollectionAliases(WithAliasDatabase(nil)))
+	require.Error(t, err)
+}
+
+func TestIsCollectionNotFound(t *testing.T) {
+	require.False(t, isCollectionNotFound(nil))
+	require.False(t, isCollectionNotFound(errors.New("boom")))
+	require.True(t, isCollectionNotFound(errors.Wrap(ErrEmbeddedCollectionNotFound, "get")))
+	var ef embeddings.EmbeddingFunction = aliasEmbeddingFunction{}
+	emb, err := ef.EmbedQuery(context.Background(), "x")
+	require.NoError(t, err)
+	require.Equal(t, 1, emb.Len())
+}
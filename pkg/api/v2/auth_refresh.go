@@ -0,0 +1,690 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+)
+
+const (
+	// DefaultTokenRefreshSkew is how long before expiry a cached token is refreshed.
+	// The skew never exceeds half the lifetime of a token.
+	DefaultTokenRefreshSkew = 30 * time.Second
+	// DefaultTokenFetchTimeout bounds a single token fetch (HTTP call, file read or command).
+	DefaultTokenFetchTimeout = 30 * time.Second
+	// DefaultTokenRecheckInterval is how long a token without a known expiry is cached
+	// before it is fetched again, e.g. a file token without an exp claim.
+	DefaultTokenRecheckInterval = time.Minute
+)
+
+// RefreshableCredentialsProvider is a CredentialsProvider whose credentials expire.
+// Clients call AuthenticateContext for every request instead of resolving the
+// headers once, and call Invalidate followed by a single retry when the server
+// answers 401 Unauthorized.
+type RefreshableCredentialsProvider interface {
+	CredentialsProvider
+	AuthenticateContext(ctx context.Context) (map[string]string, error)
+	// Invalidate discards the cached credentials so the next call fetches new ones.
+	Invalidate()
+}
+
+// Token is a credential returned by a TokenSource.
+type Token struct {
+	AccessToken string
+	// Expiry is when the token stops being valid. The zero value means unknown.
+	Expiry time.Time
+}
+
+// TokenSource fetches a new token. Implementations need not cache; caching and
+// refreshing is done by RefreshingTokenCredentialsProvider.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+type tokenProviderConfig struct {
+	header          TokenTransportHeader
+	refreshSkew     time.Duration
+	fetchTimeout    time.Duration
+	recheckInterval time.Duration
+	httpClient      *http.Client
+	clientSecret    string
+	secretInBody    bool
+	scopes          []string
+	audience        string
+	params          url.Values
+	env             []string
+}
+
+// TokenProviderOption configures the refreshing credential providers. Options that
+// do not apply to a provider (e.g. WithOAuth2Scopes for a file token) are ignored.
+type TokenProviderOption func(c *tokenProviderConfig) error
+
+// WithTokenHeader sets the header the token is sent in. Defaults to AuthorizationTokenHeader (Bearer).
+func WithTokenHeader(header TokenTransportHeader) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		if header != AuthorizationTokenHeader && header != XChromaTokenHeader {
+			return errors.Errorf("unsupported token header: %v", header)
+		}
+		c.header = header
+		return nil
+	}
+}
+
+// WithTokenRefreshSkew sets how long before expiry a token is refreshed. Defaults to DefaultTokenRefreshSkew.
+func WithTokenRefreshSkew(skew time.Duration) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		if skew < 0 {
+			return errors.New("refresh skew cannot be negative")
+		}
+		c.refreshSkew = skew
+		return nil
+	}
+}
+
+// WithTokenFetchTimeout bounds a single token fetch. Defaults to DefaultTokenFetchTimeout.
+func WithTokenFetchTimeout(timeout time.Duration) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		if timeout <= 0 {
+			return errors.New("fetch timeout must be positive")
+		}
+		c.fetchTimeout = timeout
+		return nil
+	}
+}
+
+// WithTokenRecheckInterval sets how long a token without a known expiry is used
+// before it is fetched again. Defaults to DefaultTokenRecheckInterval.
+func WithTokenRecheckInterval(interval time.Duration) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		if interval <= 0 {
+			return errors.New("recheck interval must be positive")
+		}
+		c.recheckInterval = interval
+		return nil
+	}
+}
+
+// WithOAuth2HTTPClient sets the HTTP client used to call the token endpoint.
+func WithOAuth2HTTPClient(client *http.Client) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		if client == nil {
+			return errors.New("http client cannot be nil")
+		}
+		c.httpClient = client
+		return nil
+	}
+}
+
+// WithOAuth2ClientSecret sets the client secret of the refresh token flow. Public
+// clients do not need one.
+func WithOAuth2ClientSecret(secret string) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		c.clientSecret = secret
+		return nil
+	}
+}
+
+// WithOAuth2ClientSecretInBody sends the client credentials as form fields instead
+// of HTTP Basic authentication, for servers that only support client_secret_post.
+func WithOAuth2ClientSecretInBody() TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		c.secretInBody = true
+		return nil
+	}
+}
+
+// WithOAuth2Scopes sets the requested scopes.
+func WithOAuth2Scopes(scopes ...string) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		c.scopes = append(c.scopes, scopes...)
+		return nil
+	}
+}
+
+// WithOAuth2Audience sets the audience parameter required by some providers (Auth0, Okta).
+func WithOAuth2Audience(audience string) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		c.audience = audience
+		return nil
+	}
+}
+
+// WithOAuth2Param adds an extra form parameter to token requests.
+func WithOAuth2Param(key, value string) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		if key == "" {
+			return errors.New("param key cannot be empty")
+		}
+		if c.params == nil {
+			c.params = url.Values{}
+		}
+		c.params.Add(key, value)
+		return nil
+	}
+}
+
+// WithTokenCommandEnv adds KEY=value entries to the environment of the token command.
+func WithTokenCommandEnv(env ...string) TokenProviderOption {
+	return func(c *tokenProviderConfig) error {
+		c.env = append(c.env, env...)
+		return nil
+	}
+}
+
+func newTokenProviderConfig(opts []TokenProviderOption) (*tokenProviderConfig, error) {
+	cfg := &tokenProviderConfig{
+		header:          AuthorizationTokenHeader,
+		refreshSkew:     DefaultTokenRefreshSkew,
+		fetchTimeout:    DefaultTokenFetchTimeout,
+		recheckInterval: DefaultTokenRecheckInterval,
+		httpClient:      http.DefaultClient,
+	}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// RefreshingTokenCredentialsProvider caches the token of a TokenSource and fetches
+// a new one when it is about to expire or after Invalidate. Concurrent callers
+// share a single fetch.
+type RefreshingTokenCredentialsProvider struct {
+	name   string
+	source TokenSource
+	cfg    *tokenProviderConfig
+
+	mu    sync.Mutex
+	token *Token
+	// validUntil is when the cached token must be fetched again.
+	validUntil time.Time
+	// fetch is the fetch in flight, nil when there is none
+	fetch *tokenFetch
+	now   func() time.Time
+}
+
+// tokenFetch is a token fetch shared by concurrent callers. done is closed once
+// token or err is set.
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewRefreshingTokenCredentialsProvider wraps a custom TokenSource.
+func NewRefreshingTokenCredentialsProvider(source TokenSource, opts ...TokenProviderOption) (*RefreshingTokenCredentialsProvider, error) {
+	if source == nil {
+		return nil, errors.New("token source cannot be nil")
+	}
+	return newRefreshingProvider("RefreshingTokenCredentialsProvider", source, opts)
+}
+
+func newRefreshingProvider(name string, source TokenSource, opts []TokenProviderOption) (*RefreshingTokenCredentialsProvider, error) {
+	cfg, err := newTokenProviderConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshingTokenCredentialsProvider{name: name, source: source, cfg: cfg, now: time.Now}, nil
+}
+
+func (p *RefreshingTokenCredentialsProvider) Authenticate() (map[string]string, error) {
+	return p.AuthenticateContext(context.Background())
+}
+
+func (p *RefreshingTokenCredentialsProvider) AuthenticateContext(ctx context.Context) (map[string]string, error) {
+	token, err := p.currentToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.header == XChromaTokenHeader {
+		return map[string]string{string(XChromaTokenHeader): token}, nil
+	}
+	return map[string]string{string(AuthorizationTokenHeader): "Bearer " + token}, nil
+}
+
+func (p *RefreshingTokenCredentialsProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.token = nil
+}
+
+// currentToken returns the cached token, or waits for a fetch of a new one. The
+// lock is not held while fetching, so that callers can give up with ctx.
+func (p *RefreshingTokenCredentialsProvider) currentToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	if p.token != nil && p.now().Before(p.validUntil) {
+		token := p.token.AccessToken
+		p.mu.Unlock()
+		return token, nil
+	}
+	fetch := p.fetch
+	if fetch == nil {
+		fetch = &tokenFetch{done: make(chan struct{})}
+		p.fetch = fetch
+		// the fetch is shared, so it must not end with the context of the caller that started it
+		go p.runFetch(context.WithoutCancel(ctx), fetch)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.token, fetch.err
+	case <-ctx.Done():
+		return "", errors.Wrap(ctx.Err(), "error fetching auth token")
+	}
+}
+
+func (p *RefreshingTokenCredentialsProvider) runFetch(ctx context.Context, fetch *tokenFetch) {
+	token, err := p.fetchToken(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		now := p.now()
+		p.token = token
+		switch {
+		case token.Expiry.IsZero():
+			p.validUntil = now.Add(p.cfg.recheckInterval)
+		default:
+			skew := p.cfg.refreshSkew
+			if lifetime := token.Expiry.Sub(now); skew > lifetime/2 {
+				// short-lived tokens are used for half their lifetime rather than refreshed on every call
+				skew = max(lifetime/2, 0)
+			}
+			p.validUntil = token.Expiry.Add(-skew)
+		}
+		fetch.token = token.AccessToken
+	}
+	fetch.err = err
+	p.fetch = nil
+	close(fetch.done)
+}
+
+func (p *RefreshingTokenCredentialsProvider) fetchToken(ctx context.Context) (*Token, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, p.cfg.fetchTimeout)
+	defer cancel()
+	token, err := p.source.Token(fetchCtx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching auth token")
+	}
+	if token == nil || token.AccessToken == "" {
+		return nil, errors.New("error fetching auth token: empty token")
+	}
+	if strings.ContainsAny(token.AccessToken, "\r\n") {
+		return nil, errors.New("error fetching auth token: token contains line breaks")
+	}
+	return token, nil
+}
+
+func (p *RefreshingTokenCredentialsProvider) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token := ""
+	if p.token != nil {
+		token = _sanitizeToken(p.token.AccessToken)
+	}
+	return p.name + " {" + string(p.cfg.header) + ": " + token + "}"
+}
+
+// oauth2TokenResponse is the RFC 6749 section 5.1 token response.
+type oauth2TokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	RefreshToken     string      `json:"refresh_token"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+type oauth2Source struct {
+	cfg          *tokenProviderConfig
+	tokenURL     func(ctx context.Context) (string, error)
+	clientID     string
+	grantType    string
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func (s *oauth2Source) Token(ctx context.Context) (*Token, error) {
+	tokenURL, err := s.tokenURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	for k, v := range s.cfg.params {
+		form[k] = append([]string(nil), v...)
+	}
+	form.Set("grant_type", s.grantType)
+	if len(s.cfg.scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.scopes, " "))
+	}
+	if s.cfg.audience != "" {
+		form.Set("audience", s.cfg.audience)
+	}
+	s.mu.Lock()
+	refreshToken := s.refreshToken
+	s.mu.Unlock()
+	if s.grantType == "refresh_token" {
+		form.Set("refresh_token", refreshToken)
+	}
+	useBasic := s.cfg.clientSecret != "" && !s.cfg.secretInBody
+	if !useBasic {
+		form.Set("client_id", s.clientID)
+		if s.cfg.clientSecret != "" {
+			form.Set("client_secret", s.cfg.clientSecret)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.cfg.clientSecret))
+	}
+	resp, err := s.cfg.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error calling token endpoint")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := chhttp.ReadLimitedBody(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading token response")
+	}
+	var tr oauth2TokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("token endpoint returned %d: %s", resp.StatusCode, chhttp.SanitizeErrorBody(body))
+		}
+		return nil, errors.Wrap(err, "error decoding token response")
+	}
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		return nil, errors.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, tr.Error, sanitizeForLogging(tr.ErrorDescription))
+	}
+	if tr.TokenType != "" && !strings.EqualFold(tr.TokenType, "bearer") {
+		return nil, errors.Errorf("unsupported token type: %s", sanitizeForLogging(tr.TokenType))
+	}
+	token := &Token{AccessToken: tr.AccessToken}
+	if tr.ExpiresIn != "" {
+		seconds, err := tr.ExpiresIn.Float64()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid expires_in in token response")
+		}
+		token.Expiry = time.Now().Add(time.Duration(seconds * float64(time.Second)))
+	}
+	if tr.RefreshToken != "" && s.grantType == "refresh_token" {
+		// servers rotating refresh tokens invalidate the previous one
+		s.mu.Lock()
+		s.refreshToken = tr.RefreshToken
+		s.mu.Unlock()
+	}
+	return token, nil
+}
+
+func staticURL(tokenURL string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) { return tokenURL, nil }
+}
+
+// NewOAuth2ClientCredentialsProvider returns a provider that obtains tokens with the
+// OAuth2 client credentials grant and refreshes them before they expire.
+func NewOAuth2ClientCredentialsProvider(tokenURL, clientID, clientSecret string, opts ...TokenProviderOption) (*RefreshingTokenCredentialsProvider, error) {
+	if tokenURL == "" {
+		return nil, errors.New("token URL cannot be empty")
+	}
+	if clientID == "" || clientSecret == "" {
+		return nil, errors.New("client ID and client secret cannot be empty")
+	}
+	opts = append(opts, WithOAuth2ClientSecret(clientSecret))
+	p, err := newRefreshingProvider("OAuth2ClientCredentialsProvider", nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.source = &oauth2Source{cfg: p.cfg, tokenURL: staticURL(tokenURL), clientID: clientID, grantType: "client_credentials"}
+	return p, nil
+}
+
+// NewOIDCClientCredentialsProvider is like NewOAuth2ClientCredentialsProvider but
+// discovers the token endpoint from the issuer's /.well-known/openid-configuration.
+// Discovery runs on the first token fetch and is retried until it succeeds.
+func NewOIDCClientCredentialsProvider(issuerURL, clientID, clientSecret string, opts ...TokenProviderOption) (*RefreshingTokenCredentialsProvider, error) {
+	if issuerURL == "" {
+		return nil, errors.New("issuer URL cannot be empty")
+	}
+	p, err := NewOAuth2ClientCredentialsProvider(issuerURL, clientID, clientSecret, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.name = "OIDCClientCredentialsProvider"
+	var mu sync.Mutex
+	var discovered string
+	p.source.(*oauth2Source).tokenURL = func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if discovered != "" {
+			return discovered, nil
+		}
+		endpoint, err := discoverOIDCTokenEndpoint(ctx, p.cfg.httpClient, issuerURL)
+		if err != nil {
+			return "", err
+		}
+		discovered = endpoint
+		return discovered, nil
+	}
+	return p, nil
+}
+
+func discoverOIDCTokenEndpoint(ctx context.Context, client *http.Client, issuerURL string) (string, error) {
+	discoveryURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating OIDC discovery request")
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error calling OIDC discovery endpoint")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := chhttp.ReadLimitedBody(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading OIDC discovery response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("OIDC discovery returned %d: %s", resp.StatusCode, chhttp.SanitizeErrorBody(body))
+	}
+	var doc struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", errors.Wrap(err, "error decoding OIDC discovery response")
+	}
+	if doc.TokenEndpoint == "" {
+		return "", errors.New("OIDC discovery response has no token_endpoint")
+	}
+	return doc.TokenEndpoint, nil
+}
+
+// NewOAuth2RefreshTokenProvider returns a provider that exchanges a refresh token for
+// access tokens. Rotated refresh tokens returned by the server replace the initial one.
+// Confidential clients pass their secret with WithOAuth2ClientSecret.
+func NewOAuth2RefreshTokenProvider(tokenURL, clientID, refreshToken string, opts ...TokenProviderOption) (*RefreshingTokenCredentialsProvider, error) {
+	if tokenURL == "" {
+		return nil, errors.New("token URL cannot be empty")
+	}
+	if clientID == "" {
+		return nil, errors.New("client ID cannot be empty")
+	}
+	if refreshToken == "" {
+		return nil, errors.New("refresh token cannot be empty")
+	}
+	p, err := newRefreshingProvider("OAuth2RefreshTokenProvider", nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.source = &oauth2Source{cfg: p.cfg, tokenURL: staticURL(tokenURL), clientID: clientID, grantType: "refresh_token", refreshToken: refreshToken}
+	return p, nil
+}
+
+// NewFileTokenCredentialsProvider returns a provider that reads the token from a file,
+// such as a Kubernetes projected service account token. The file is read again when
+// the token's JWT exp claim is near, after WithTokenRecheckInterval, or after a 401,
+// so rotated tokens are picked up without restarting.
+func NewFileTokenCredentialsProvider(path string, opts ...TokenProviderOption) (*RefreshingTokenCredentialsProvider, error) {
+	if path == "" {
+		return nil, errors.New("token file path cannot be empty")
+	}
+	p, err := newRefreshingProvider("FileTokenCredentialsProvider", nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.source = TokenSourceFunc(func(context.Context) (*Token, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading token file")
+		}
+		return p.tokenWithRecheck(strings.TrimSpace(string(data))), nil
+	})
+	return p, nil
+}
+
+// tokenWithRecheck returns a token expiring at its JWT exp claim or at the recheck
+// interval, whichever comes first.
+func (p *RefreshingTokenCredentialsProvider) tokenWithRecheck(value string) *Token {
+	recheck := p.now().Add(p.cfg.recheckInterval + p.cfg.refreshSkew)
+	expiry := jwtExpiry(value)
+	if expiry.IsZero() || expiry.After(recheck) {
+		expiry = recheck
+	}
+	return &Token{AccessToken: value, Expiry: expiry}
+}
+
+// jwtExpiry returns the exp claim of a JWT without verifying it, or the zero time.
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == "" {
+		return time.Time{}
+	}
+	exp, err := claims.Exp.Int64()
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(exp, 0)
+}
+
+// execTokenOutput is the JSON a token command may print. Both the Kubernetes
+// ExecCredential (status.token, status.expirationTimestamp) and an OAuth2 style
+// token response are understood.
+type execTokenOutput struct {
+	Token       string      `json:"token"`
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+	Expiry      string      `json:"expiry"`
+	Status      *struct {
+		Token               string `json:"token"`
+		ExpirationTimestamp string `json:"expirationTimestamp"`
+	} `json:"status"`
+}
+
+// NewExecTokenCredentialsProvider returns a provider that runs an external command to
+// obtain a token, e.g. a cloud CLI. The command prints either the bare token or a JSON
+// object with token/access_token and expires_in (seconds) or expiry (RFC 3339); a
+// Kubernetes ExecCredential is accepted as well. The command runs again when the token
+// expires, after WithTokenRecheckInterval if no expiry is known, or after a 401.
+func NewExecTokenCredentialsProvider(command string, args []string, opts ...TokenProviderOption) (*RefreshingTokenCredentialsProvider, error) {
+	if command == "" {
+		return nil, errors.New("command cannot be empty")
+	}
+	p, err := newRefreshingProvider("ExecTokenCredentialsProvider", nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	args = append([]string(nil), args...)
+	p.source = TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		cmd := exec.CommandContext(ctx, command, args...)
+		if len(p.cfg.env) > 0 {
+			cmd.Env = append(os.Environ(), p.cfg.env...)
+		}
+		// children left behind by a killed command must not keep the pipes open
+		cmd.WaitDelay = time.Second
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			// stdout may hold a partial token, only stderr is reported
+			return nil, errors.Wrapf(err, "token command failed: %s", sanitizeForLogging(strings.TrimSpace(stderr.String())))
+		}
+		return p.parseExecOutput(bytes.TrimSpace(out))
+	})
+	return p, nil
+}
+
+func (p *RefreshingTokenCredentialsProvider) parseExecOutput(out []byte) (*Token, error) {
+	if len(out) == 0 || out[0] != '{' {
+		return p.tokenWithRecheck(string(out)), nil
+	}
+	var parsed execTokenOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, errors.Wrap(err, "error decoding token command output")
+	}
+	token := &Token{AccessToken: parsed.AccessToken}
+	if token.AccessToken == "" {
+		token.AccessToken = parsed.Token
+	}
+	expiry := parsed.Expiry
+	if parsed.Status != nil {
+		if token.AccessToken == "" {
+			token.AccessToken = parsed.Status.Token
+		}
+		if expiry == "" {
+			expiry = parsed.Status.ExpirationTimestamp
+		}
+	}
+	switch {
+	case parsed.ExpiresIn != "":
+		seconds, err := strconv.ParseFloat(parsed.ExpiresIn.String(), 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid expires_in in token command output")
+		}
+		token.Expiry = p.now().Add(time.Duration(seconds * float64(time.Second)))
+	case expiry != "":
+		t, err := time.Parse(time.RFC3339, expiry)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid expiry in token command output")
+		}
+		token.Expiry = t
+	default:
+		return p.tokenWithRecheck(token.AccessToken), nil
+	}
+	return token, nil
+}
@@ -0,0 +1,359 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOAuth2ClientCredentialsProvider(t *testing.T) {
+	var calls atomic.Int32
+	srv := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		require.Equal(t, "read write", r.PostForm.Get("scope"))
+		require.Equal(t, "chroma", r.PostForm.Get("audience"))
+		id, secret, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "client", id)
+		require.Equal(t, "s3cret", secret)
+		_, _ = fmt.Fprintf(w, `{"access_token":"access-token-%d","token_type":"Bearer","expires_in":60}`, n)
+	})
+	p, err := NewOAuth2ClientCredentialsProvider(srv.URL, "client", "s3cret",
+		WithOAuth2Scopes("read", "write"), WithOAuth2Audience("chroma"))
+	require.NoError(t, err)
+
+	headers, err := p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "Bearer access-token-1", headers["Authorization"])
+	_, err = p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, int32(1), calls.Load(), "token is cached")
+
+	// 45s later the token is within the refresh skew
+	p.now = func() time.Time { return time.Now().Add(45 * time.Second) }
+	headers, err = p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "Bearer access-token-2", headers["Authorization"])
+
+	p.Invalidate()
+	headers, err = p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "Bearer access-token-3", headers["Authorization"])
+	require.Equal(t, "OAuth2ClientCredentialsProvider {Authorization: acce...en-3}", p.String())
+	require.NotContains(t, p.String(), "access-token-3")
+}
+
+func TestOAuth2ProviderErrors(t *testing.T) {
+	srv := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"error":"invalid_client","error_description":"bad secret"}`)
+	})
+	p, err := NewOAuth2ClientCredentialsProvider(srv.URL, "client", "wrong", WithOAuth2ClientSecretInBody())
+	require.NoError(t, err)
+	_, err = p.Authenticate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid_client")
+	require.NotContains(t, err.Error(), "wrong")
+
+	_, err = NewOAuth2ClientCredentialsProvider("", "client", "secret")
+	require.Error(t, err)
+	_, err = NewOAuth2ClientCredentialsProvider(srv.URL, "client", "secret", WithTokenHeader("X-Other"))
+	require.Error(t, err)
+}
+
+func TestOIDCClientCredentialsProvider(t *testing.T) {
+	var discoveries atomic.Int32
+	var srv *httptest.Server
+	srv = newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/realms/chroma/.well-known/openid-configuration":
+			discoveries.Add(1)
+			_, _ = fmt.Fprintf(w, `{"issuer":"%s/realms/chroma","token_endpoint":"%s/realms/chroma/token"}`, srv.URL, srv.URL)
+		case "/realms/chroma/token":
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "client", r.PostForm.Get("client_id"))
+			require.Equal(t, "secret", r.PostForm.Get("client_secret"))
+			_, _ = io.WriteString(w, `{"access_token":"oidc-token","expires_in":300}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	p, err := NewOIDCClientCredentialsProvider(srv.URL+"/realms/chroma/", "client", "secret",
+		WithOAuth2ClientSecretInBody(), WithTokenHeader(XChromaTokenHeader))
+	require.NoError(t, err)
+	headers, err := p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "oidc-token", headers["X-Chroma-Token"])
+	p.Invalidate()
+	_, err = p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, int32(1), discoveries.Load())
+}
+
+func TestOAuth2RefreshTokenProvider(t *testing.T) {
+	var seen []string
+	srv := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		seen = append(seen, r.PostForm.Get("refresh_token"))
+		_, _ = fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"refresh-%d","expires_in":3600}`, len(seen), len(seen))
+	})
+	p, err := NewOAuth2RefreshTokenProvider(srv.URL, "public-client", "refresh-0")
+	require.NoError(t, err)
+	headers, err := p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "Bearer access-1", headers["Authorization"])
+	p.Invalidate()
+	_, err = p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, []string{"refresh-0", "refresh-1"}, seen, "rotated refresh token is used")
+}
+
+func testJWT(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"sa","exp":%d}`, exp.Unix())))
+	return "eyJhbGciOiJSUzI1NiJ9." + payload + ".c2lnbmF0dXJl"
+}
+
+func TestRefreshingTokenProviderCapsSkewToTokenLifetime(t *testing.T) {
+	var calls atomic.Int32
+	p, err := NewRefreshingTokenCredentialsProvider(TokenSourceFunc(func(context.Context) (*Token, error) {
+		n := calls.Add(1)
+		return &Token{AccessToken: fmt.Sprintf("token-%d", n), Expiry: time.Now().Add(20 * time.Second)}, nil
+	}))
+	require.NoError(t, err)
+
+	// a 20s token is within the default 30s skew as soon as it is fetched
+	_, err = p.Authenticate()
+	require.NoError(t, err)
+	_, err = p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, int32(1), calls.Load(), "short-lived tokens are cached for half their lifetime")
+
+	p.now = func() time.Time { return time.Now().Add(11 * time.Second) }
+	headers, err := p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "Bearer token-2", headers["Authorization"])
+}
+
+func TestRefreshingTokenProviderSharesFetch(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	p, err := NewRefreshingTokenCredentialsProvider(TokenSourceFunc(func(context.Context) (*Token, error) {
+		calls.Add(1)
+		<-release
+		return &Token{AccessToken: "shared"}, nil
+	}))
+	require.NoError(t, err)
+
+	// a caller giving up does not block or fail the fetch of the others
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := p.AuthenticateContext(ctx)
+		cancelled <- err
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-cancelled, context.Canceled)
+
+	results := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			headers, err := p.Authenticate()
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- headers["Authorization"]
+		}()
+	}
+	// Invalidate and String do not wait for the fetch
+	p.Invalidate()
+	require.Contains(t, p.String(), "RefreshingTokenCredentialsProvider")
+	close(release)
+	for i := 0; i < 5; i++ {
+		require.Equal(t, "Bearer shared", <-results)
+	}
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestFileTokenCredentialsProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	first := testJWT(time.Now().Add(10 * time.Minute))
+	require.NoError(t, os.WriteFile(path, []byte(first+"\n"), 0o600))
+
+	p, err := NewFileTokenCredentialsProvider(path, WithTokenRecheckInterval(time.Hour))
+	require.NoError(t, err)
+	headers, err := p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "Bearer "+first, headers["Authorization"])
+
+	second := testJWT(time.Now().Add(20 * time.Minute))
+	require.NoError(t, os.WriteFile(path, []byte(second), 0o600))
+	headers, err = p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "Bearer "+first, headers["Authorization"], "token is cached until exp")
+
+	// the first token's exp claim is within the refresh skew
+	p.now = func() time.Time { return time.Now().Add(10 * time.Minute) }
+	headers, err = p.Authenticate()
+	require.NoError(t, err)
+	require.Equal(t, "Bearer "+second, headers["Authorization"])
+
+	t.Run("plain token uses recheck interval", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(path, []byte("plain-token"), 0o600))
+		p, err := NewFileTokenCredentialsProvider(path, WithTokenRecheckInterval(time.Minute))
+		require.NoError(t, err)
+		_, err = p.Authenticate()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, []byte("rotated-token"), 0o600))
+		p.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		headers, err := p.Authenticate()
+		require.NoError(t, err)
+		require.Equal(t, "Bearer rotated-token", headers["Authorization"])
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		p, err := NewFileTokenCredentialsProvider(filepath.Join(t.TempDir(), "missing"))
+		require.NoError(t, err)
+		_, err = p.Authenticate()
+		require.Error(t, err)
+	})
+}
+
+func TestExecTokenCredentialsProvider(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("requires /bin/sh")
+	}
+	t.Run("plain output", func(t *testing.T) {
+		p, err := NewExecTokenCredentialsProvider("/bin/sh", []string{"-c", "echo $TOKEN_VALUE"}, WithTokenCommandEnv("TOKEN_VALUE=exec-token"))
+		require.NoError(t, err)
+		headers, err := p.Authenticate()
+		require.NoError(t, err)
+		require.Equal(t, "Bearer exec-token", headers["Authorization"])
+		require.Equal(t, "ExecTokenCredentialsProvider {Authorization: exec...oken}", p.String())
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		p, err := NewExecTokenCredentialsProvider("/bin/sh", []string{"-c", `echo '{"access_token":"json-token","expires_in":120}'`})
+		require.NoError(t, err)
+		headers, err := p.Authenticate()
+		require.NoError(t, err)
+		require.Equal(t, "Bearer json-token", headers["Authorization"])
+		require.WithinDuration(t, time.Now().Add(90*time.Second), p.validUntil, 5*time.Second)
+	})
+
+	t.Run("exec credential output", func(t *testing.T) {
+		expiry := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		script := fmt.Sprintf(`echo '{"kind":"ExecCredential","status":{"token":"k8s-token","expirationTimestamp":"%s"}}'`, expiry)
+		p, err := NewExecTokenCredentialsProvider("/bin/sh", []string{"-c", script})
+		require.NoError(t, err)
+		headers, err := p.Authenticate()
+		require.NoError(t, err)
+		require.Equal(t, "Bearer k8s-token", headers["Authorization"])
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		p, err := NewExecTokenCredentialsProvider("/bin/sh", []string{"-c", "echo partial-secret; echo denied >&2; exit 1"})
+		require.NoError(t, err)
+		_, err = p.Authenticate()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "denied")
+		require.NotContains(t, err.Error(), "partial-secret")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		p, err := NewExecTokenCredentialsProvider("/bin/sh", []string{"-c", "sleep 5"}, WithTokenFetchTimeout(50*time.Millisecond))
+		require.NoError(t, err)
+		_, err = p.Authenticate()
+		require.Error(t, err)
+	})
+}
+
+func TestClientRetriesOnceAfterUnauthorized(t *testing.T) {
+	var issued atomic.Int32
+	var current atomic.Value
+	current.Store("")
+	provider, err := NewRefreshingTokenCredentialsProvider(TokenSourceFunc(func(context.Context) (*Token, error) {
+		token := fmt.Sprintf("token-%d", issued.Add(1))
+		return &Token{AccessToken: token, Expiry: time.Now().Add(time.Hour)}, nil
+	}))
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") != "Bearer "+current.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `{"error":"Unauthorized","message":"expired"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	defer srv.Close()
+
+	client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithAuth(provider))
+	require.NoError(t, err)
+	require.NotContains(t, client.DefaultHeaders(), "Authorization", "refreshable credentials are resolved per request")
+
+	current.Store("token-1")
+	_, err = client.ExecuteRequest(context.Background(), http.MethodPost, "collections", map[string]string{"name": "a"})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), requests.Load())
+
+	// the server rotates its accepted token; the client refreshes and retries
+	current.Store("token-2")
+	_, err = client.ExecuteRequest(context.Background(), http.MethodPost, "collections", map[string]string{"name": "b"})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), requests.Load())
+	require.Equal(t, bodies[1], bodies[2], "request body is replayed")
+
+	current.Store("token-3")
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/x", strings.NewReader(`{"name":"c"}`))
+	require.NoError(t, err)
+	resp, err := client.SendRequest(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, int32(5), requests.Load())
+
+	// a token the server never accepts is retried only once
+	current.Store("never")
+	_, err = client.ExecuteRequest(context.Background(), http.MethodGet, "heartbeat", nil)
+	require.Error(t, err)
+	require.Equal(t, int32(7), requests.Load())
+
+	t.Run("static providers are not retried", func(t *testing.T) {
+		requests.Store(0)
+		client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithAuth(NewTokenAuthCredentialsProvider("static", AuthorizationTokenHeader)))
+		require.NoError(t, err)
+		_, err = client.ExecuteRequest(context.Background(), http.MethodGet, "heartbeat", nil)
+		require.Error(t, err)
+		require.Equal(t, int32(1), requests.Load())
+	})
+}
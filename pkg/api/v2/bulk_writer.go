@@ -0,0 +1,503 @@
+package v2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+const (
+	// DefaultBulkWriterBatchSize is the batch size of collections that do not report a max batch size.
+	DefaultBulkWriterBatchSize = 100
+	// DefaultBulkWriterConcurrency is the number of batches embedded at a time.
+	DefaultBulkWriterConcurrency = 4
+)
+
+// ErrBulkWriterClosed is returned for writes to a closed [BulkWriter].
+var ErrBulkWriterClosed = errors.New("bulk writer is closed")
+
+// BulkWriterStats reports the progress of a [BulkWriter].
+type BulkWriterStats struct {
+	// Records is the number of records accepted by Write.
+	Records int `json:"records"`
+	// Written is the number of records written to the collection.
+	Written int `json:"written"`
+	// Failed is the number of records of failed batches.
+	Failed        int `json:"failed"`
+	Batches       int `json:"batches"`
+	FailedBatches int `json:"failed_batches"`
+	// EmbeddingTime is the time spent embedding, summed over all batches.
+	EmbeddingTime time.Duration `json:"embedding_time"`
+	// WriteTime is the time spent writing to the collection.
+	WriteTime time.Duration `json:"write_time"`
+	// Elapsed is the time since the writer was created, until it was closed.
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// BulkWriter writes records to a collection one at a time, without building the
+// slices of [Collection.Add] up front.
+//
+// Records are buffered into batches of the max batch size reported by the server's
+// pre-flight checks. Full batches are embedded in the background, several at a time,
+// and written while the next batches are embedded. Batches are written in the order
+// their records were written. Write blocks while all embedding workers are busy, and
+// no more batches than the concurrency are embedded or waiting for an earlier batch.
+//
+// A failed batch does not stop the writer; its error is passed to the handler of
+// [WithBulkWriterErrorHandler] and counted in the stats returned by [BulkWriter.Close].
+type BulkWriter struct {
+	collection  Collection
+	ef          embeddings.EmbeddingFunction
+	batchSize   int
+	concurrency int
+	upsert      bool
+	onError     func(ids []DocumentID, err error)
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started time.Time
+
+	mu     sync.Mutex
+	buffer []Record
+	seen   map[DocumentID]struct{}
+	seq    uint64
+	closed bool
+
+	batches  chan *bulkWriterBatch
+	embedded chan *bulkWriterBatch
+	// window holds a slot for every batch that is embedded or waits to be written,
+	// so that a slow batch does not let the batches after it pile up
+	window chan struct{}
+	done   chan struct{}
+
+	statsMu  sync.Mutex
+	stats    BulkWriterStats
+	firstErr error
+}
+
+// BulkWriterOption configures [NewBulkWriter].
+type BulkWriterOption func(w *BulkWriter) error
+
+// WithBulkWriterBatchSize sets the number of records per batch. It is capped by the
+// max batch size of the collection.
+func WithBulkWriterBatchSize(size int) BulkWriterOption {
+	return func(w *BulkWriter) error {
+		if size < 1 {
+			return errors.New("batch size must be >= 1")
+		}
+		w.batchSize = size
+		return nil
+	}
+}
+
+// WithBulkWriterConcurrency sets the number of batches embedded at a time.
+// Defaults to [DefaultBulkWriterConcurrency].
+func WithBulkWriterConcurrency(concurrency int) BulkWriterOption {
+	return func(w *BulkWriter) error {
+		if concurrency < 1 {
+			return errors.New("concurrency must be >= 1")
+		}
+		w.concurrency = concurrency
+		return nil
+	}
+}
+
+// WithBulkWriterEmbeddingFunction sets the embedding function records without an
+// embedding are embedded with. Defaults to the embedding function of the collection.
+func WithBulkWriterEmbeddingFunction(ef embeddings.EmbeddingFunction) BulkWriterOption {
+	return func(w *BulkWriter) error {
+		if ef == nil {
+			return errors.New("embedding function cannot be nil")
+		}
+		w.ef = ef
+		return nil
+	}
+}
+
+// WithBulkWriterUpsert upserts the records instead of adding them.
+func WithBulkWriterUpsert() BulkWriterOption {
+	return func(w *BulkWriter) error {
+		w.upsert = true
+		return nil
+	}
+}
+
+// WithBulkWriterErrorHandler calls fn with the IDs of every batch that failed to embed
+// or write. fn is called from a single goroutine.
+func WithBulkWriterErrorHandler(fn func(ids []DocumentID, err error)) BulkWriterOption {
+	return func(w *BulkWriter) error {
+		if fn == nil {
+			return errors.New("error handler cannot be nil")
+		}
+		w.onError = fn
+		return nil
+	}
+}
+
+// NewBulkWriter creates a [BulkWriter] for collection. ctx bounds the embedding and
+// write requests of the writer.
+//
+//	writer, err := NewBulkWriter(ctx, collection, WithBulkWriterConcurrency(8))
+//	if err != nil {
+//	    return err
+//	}
+//	for row := range rows {
+//	    record, err := NewSimpleRecord(WithRecordID(row.ID), WithRecordDocument(row.Text))
+//	    ...
+//	    if err := writer.Write(ctx, record); err != nil {
+//	        return err
+//	    }
+//	}
+//	stats, err := writer.Close(ctx)
+func NewBulkWriter(ctx context.Context, collection Collection, opts ...BulkWriterOption) (*BulkWriter, error) {
+	if collection == nil {
+		return nil, errors.New("collection cannot be nil")
+	}
+	w := &BulkWriter{
+		collection:  collection,
+		ef:          collectionEmbeddingFunction(collection),
+		concurrency: DefaultBulkWriterConcurrency,
+		seen:        map[DocumentID]struct{}{},
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, err
+		}
+	}
+	maxBatchSize, err := collectionMaxBatchSize(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case w.batchSize == 0 && maxBatchSize > 0:
+		w.batchSize = maxBatchSize
+	case w.batchSize == 0:
+		w.batchSize = DefaultBulkWriterBatchSize
+	case maxBatchSize > 0 && w.batchSize > maxBatchSize:
+		w.batchSize = maxBatchSize
+	}
+
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	w.started = time.Now()
+	w.batches = make(chan *bulkWriterBatch, w.concurrency)
+	w.embedded = make(chan *bulkWriterBatch, w.concurrency)
+	w.window = make(chan struct{}, w.concurrency)
+	var workers sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			w.runEmbedding()
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(w.embedded)
+	}()
+	go w.runWrites()
+	return w, nil
+}
+
+// collectionMaxBatchSize returns the max batch size of the pre-flight checks of the
+// collections of this package, 0 for other collections.
+func collectionMaxBatchSize(ctx context.Context, collection Collection) (int, error) {
+	switch c := collection.(type) {
+	case *CollectionImpl:
+		if err := c.client.PreFlight(ctx); err != nil {
+			return 0, errors.Wrap(err, "preflight failed")
+		}
+		return c.client.preflightMaxBatchSize(), nil
+	case *embeddedCollection:
+		if err := c.client.PreFlight(ctx); err != nil {
+			return 0, errors.Wrap(err, "preflight failed")
+		}
+		return c.client.state.preflightMaxBatchSize(), nil
+	}
+	return 0, nil
+}
+
+// Write adds a record to the current batch, handing the batch to the embedding
+// workers once it is full. A record with the ID of a record already in the batch
+// starts a new batch.
+func (w *BulkWriter) Write(ctx context.Context, record Record) error {
+	if record == nil {
+		return errors.New("record cannot be nil")
+	}
+	if err := record.Validate(); err != nil {
+		return errors.Wrap(err, "record validation failed")
+	}
+	id, document, embedding, _ := record.Unwrap()
+	if id == "" {
+		return errors.New("record id is empty")
+	}
+	if embedding == nil && (document == nil || document.ContentString() == "") {
+		return errors.Errorf("record %s has neither an embedding nor a document", id)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrBulkWriterClosed
+	}
+	if _, ok := w.seen[id]; ok {
+		if err := w.submit(ctx); err != nil {
+			return err
+		}
+	}
+	w.buffer = append(w.buffer, record)
+	w.seen[id] = struct{}{}
+	w.statsMu.Lock()
+	w.stats.Records++
+	w.statsMu.Unlock()
+	if len(w.buffer) >= w.batchSize {
+		return w.submit(ctx)
+	}
+	return nil
+}
+
+// WriteFrom writes the records received from records until the channel is closed.
+func (w *BulkWriter) WriteFrom(ctx context.Context, records <-chan Record) error {
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				return nil
+			}
+			if err := w.Write(ctx, record); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// submit hands the buffered records to the embedding workers. Must be called with mu held.
+func (w *BulkWriter) submit(ctx context.Context) error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	batch := &bulkWriterBatch{seq: w.seq, records: w.buffer}
+	select {
+	case w.batches <- batch:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+	w.seq++
+	w.buffer = make([]Record, 0, w.batchSize)
+	w.seen = map[DocumentID]struct{}{}
+	return nil
+}
+
+// Stats returns the progress of the writer.
+func (w *BulkWriter) Stats() BulkWriterStats {
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+	stats := w.stats
+	if stats.Elapsed == 0 {
+		stats.Elapsed = time.Since(w.started)
+	}
+	return stats
+}
+
+// Close writes the remaining records and waits for all batches to be written. If ctx
+// is done first, pending batches are abandoned and, like the remaining records, counted
+// as failed. The returned error reports failed batches, including those passed to the
+// error handler.
+func (w *BulkWriter) Close(ctx context.Context) (BulkWriterStats, error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return w.Stats(), ErrBulkWriterClosed
+	}
+	w.closed = true
+	err := w.submit(ctx)
+	var dropped []DocumentID
+	if err != nil {
+		dropped = make([]DocumentID, 0, len(w.buffer))
+		for _, record := range w.buffer {
+			dropped = append(dropped, record.ID())
+		}
+		w.buffer = nil
+	}
+	close(w.batches)
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+		err = ctx.Err()
+	}
+	w.cancel()
+	if len(dropped) > 0 {
+		// reported after the writes finished, so that the error handler stays single-threaded
+		w.record(dropped, 0, err)
+	}
+
+	w.statsMu.Lock()
+	w.stats.Elapsed = time.Since(w.started)
+	stats := w.stats
+	firstErr := w.firstErr
+	w.statsMu.Unlock()
+	if err == nil && firstErr != nil {
+		err = errors.Wrapf(firstErr, "%d of %d batches failed", stats.FailedBatches, stats.Batches)
+	}
+	return stats, err
+}
+
+func (w *BulkWriter) runEmbedding() {
+	for {
+		w.window <- struct{}{}
+		batch, ok := <-w.batches
+		if !ok {
+			<-w.window
+			return
+		}
+		start := time.Now()
+		batch.err = batch.prepare(w.ctx, w.ef)
+		elapsed := time.Since(start)
+		w.statsMu.Lock()
+		w.stats.EmbeddingTime += elapsed
+		w.statsMu.Unlock()
+		w.embedded <- batch
+	}
+}
+
+// runWrites writes the embedded batches in order and frees their window slots.
+func (w *BulkWriter) runWrites() {
+	defer close(w.done)
+	pending := map[uint64]*bulkWriterBatch{}
+	var next uint64
+	for batch := range w.embedded {
+		pending[batch.seq] = batch
+		for b, ok := pending[next]; ok; b, ok = pending[next] {
+			delete(pending, next)
+			next++
+			w.write(b)
+			<-w.window
+		}
+	}
+}
+
+func (w *BulkWriter) write(b *bulkWriterBatch) {
+	err := b.err
+	var elapsed time.Duration
+	if err == nil {
+		start := time.Now()
+		if w.upsert {
+			err = w.collection.Upsert(w.ctx, b)
+		} else {
+			err = w.collection.Add(w.ctx, b)
+		}
+		elapsed = time.Since(start)
+	}
+	w.record(b.ids, elapsed, err)
+}
+
+// record counts a written or failed batch and passes failures to the error handler.
+func (w *BulkWriter) record(ids []DocumentID, elapsed time.Duration, err error) {
+	w.statsMu.Lock()
+	w.stats.Batches++
+	w.stats.WriteTime += elapsed
+	if err != nil {
+		w.stats.FailedBatches++
+		w.stats.Failed += len(ids)
+		if w.firstErr == nil {
+			w.firstErr = err
+		}
+	} else {
+		w.stats.Written += len(ids)
+	}
+	w.statsMu.Unlock()
+
+	if err != nil && w.onError != nil {
+		w.onError(ids, err)
+	}
+}
+
+// bulkWriterBatch is a batch of a [BulkWriter]. It is passed to Add and Upsert as an option.
+type bulkWriterBatch struct {
+	seq        uint64
+	records    []Record
+	ids        []DocumentID
+	documents  []Document
+	metadatas  []DocumentMetadata
+	embeddings []any
+	err        error
+}
+
+// prepare unwraps the records and embeds the documents of records without an embedding.
+func (b *bulkWriterBatch) prepare(ctx context.Context, ef embeddings.EmbeddingFunction) error {
+	b.ids = make([]DocumentID, len(b.records))
+	b.documents = make([]Document, len(b.records))
+	b.metadatas = make([]DocumentMetadata, len(b.records))
+	b.embeddings = make([]any, len(b.records))
+	var hasDocuments, hasMetadatas bool
+	var missing []int
+	var texts []string
+	for i, record := range b.records {
+		id, document, embedding, metadata := record.Unwrap()
+		b.ids[i] = id
+		if document != nil && document.ContentString() != "" {
+			b.documents[i] = document
+			hasDocuments = true
+		}
+		if metadata != nil {
+			b.metadatas[i] = metadata
+			hasMetadatas = true
+		}
+		if embedding != nil {
+			b.embeddings[i] = embedding
+		} else {
+			missing = append(missing, i)
+			texts = append(texts, document.ContentString())
+		}
+	}
+	b.records = nil
+	if !hasDocuments {
+		b.documents = nil
+	}
+	if !hasMetadatas {
+		b.metadatas = nil
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if ef == nil {
+		if len(missing) == len(b.ids) {
+			// leave the embedding to the collection
+			b.embeddings = nil
+			return nil
+		}
+		return errors.New("embedding function is required to embed records without an embedding")
+	}
+	vectors, err := ef.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return errors.Wrap(err, "embedding failed")
+	}
+	if len(vectors) != len(missing) {
+		return errors.Errorf("embedding function returned %d embeddings for %d documents", len(vectors), len(missing))
+	}
+	for i, at := range missing {
+		b.embeddings[at] = vectors[i]
+	}
+	return nil
+}
+
+// ApplyToAdd sets the records of the batch.
+func (b *bulkWriterBatch) ApplyToAdd(op *CollectionAddOp) error {
+	op.Ids = b.ids
+	op.Documents = b.documents
+	op.Metadatas = b.metadatas
+	op.Embeddings = b.embeddings
+	return nil
+}
@@ -0,0 +1,301 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// bulkTestEmbeddingFunction embeds slowly and records the most concurrent calls.
+type bulkTestEmbeddingFunction struct {
+	embeddings.EmbeddingFunction
+	active, maxActive atomic.Int32
+}
+
+func (ef *bulkTestEmbeddingFunction) EmbedDocuments(ctx context.Context, documents []string) ([]embeddings.Embedding, error) {
+	active := ef.active.Add(1)
+	defer ef.active.Add(-1)
+	for {
+		current := ef.maxActive.Load()
+		if active <= current || ef.maxActive.CompareAndSwap(current, active) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return ef.EmbeddingFunction.EmbedDocuments(ctx, documents)
+}
+
+func newBulkTestRecord(t *testing.T, id string, opts ...RecordOption) Record {
+	t.Helper()
+	record, err := NewSimpleRecord(append([]RecordOption{WithRecordID(id), WithRecordDocument("text of " + id)}, opts...)...)
+	require.NoError(t, err)
+	return record
+}
+
+func TestBulkWriterBatchesInOrder(t *testing.T) {
+	collection := &outboxTestCollection{}
+	ef := &bulkTestEmbeddingFunction{EmbeddingFunction: embeddings.NewConsistentHashEmbeddingFunction()}
+	ctx := context.Background()
+	writer, err := NewBulkWriter(ctx, collection,
+		WithBulkWriterEmbeddingFunction(ef),
+		WithBulkWriterBatchSize(10),
+		WithBulkWriterConcurrency(3),
+	)
+	require.NoError(t, err)
+
+	metadata := NewDocumentMetadata(NewStringAttribute("k", "v"))
+	for i := 0; i < 95; i++ {
+		var opts []RecordOption
+		if i == 0 {
+			opts = append(opts, WithRecordMetadatas(metadata))
+		}
+		require.NoError(t, writer.Write(ctx, newBulkTestRecord(t, fmt.Sprintf("%03d", i), opts...)))
+	}
+	stats, err := writer.Close(ctx)
+	require.NoError(t, err)
+
+	calls := collection.received()
+	require.Len(t, calls, 10)
+	for i, call := range calls {
+		require.Equal(t, OutboxAdd, call.op)
+		require.Equal(t, DocumentID(fmt.Sprintf("%03d", i*10)), call.ids[0], "batches must be written in order")
+		require.Len(t, call.ids, len(call.texts))
+		require.Equal(t, len(call.ids), call.embeddings)
+	}
+	require.Len(t, calls[9].ids, 5)
+	require.Equal(t, metadata, calls[0].metadatas[0])
+	require.Nil(t, calls[1].metadatas)
+	require.LessOrEqual(t, ef.maxActive.Load(), int32(3))
+	require.Greater(t, ef.maxActive.Load(), int32(1), "batches must be embedded concurrently")
+
+	require.Equal(t, 95, stats.Records)
+	require.Equal(t, 95, stats.Written)
+	require.Equal(t, 10, stats.Batches)
+	require.Zero(t, stats.FailedBatches)
+	require.NotZero(t, stats.EmbeddingTime)
+	require.NotZero(t, stats.Elapsed)
+
+	_, err = writer.Close(ctx)
+	require.ErrorIs(t, err, ErrBulkWriterClosed)
+	require.ErrorIs(t, writer.Write(ctx, newBulkTestRecord(t, "late")), ErrBulkWriterClosed)
+}
+
+func TestBulkWriterKeepsEmbeddings(t *testing.T) {
+	collection := &outboxTestCollection{}
+	ef := &bulkTestEmbeddingFunction{EmbeddingFunction: embeddings.NewConsistentHashEmbeddingFunction()}
+	ctx := context.Background()
+	writer, err := NewBulkWriter(ctx, collection, WithBulkWriterEmbeddingFunction(ef), WithBulkWriterUpsert())
+	require.NoError(t, err)
+
+	embedded, err := NewSimpleRecord(WithRecordID("1"), WithRecordEmbedding(embeddings.NewEmbeddingFromFloat32([]float32{1, 2})))
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(ctx, embedded))
+	require.NoError(t, writer.Write(ctx, newBulkTestRecord(t, "2")))
+	// a repeated ID starts a new batch
+	require.NoError(t, writer.Write(ctx, newBulkTestRecord(t, "2")))
+	empty, err := NewSimpleRecord(WithRecordID("3"))
+	require.NoError(t, err)
+	require.Error(t, writer.Write(ctx, empty))
+
+	_, err = writer.Close(ctx)
+	require.NoError(t, err)
+	calls := collection.received()
+	require.Len(t, calls, 2)
+	require.Equal(t, OutboxUpsert, calls[0].op)
+	require.Equal(t, []DocumentID{"1", "2"}, calls[0].ids)
+	require.Equal(t, 2, calls[0].embeddings)
+	require.Equal(t, []DocumentID{"2"}, calls[1].ids)
+}
+
+func TestBulkWriterReportsFailedBatches(t *testing.T) {
+	collection := &outboxTestCollection{}
+	collection.setFail(func(call outboxTestCall) error {
+		if call.ids[0] == "2" {
+			return errors.New("write failed")
+		}
+		return nil
+	})
+	ctx := context.Background()
+	var mu sync.Mutex
+	var failed []DocumentID
+	writer, err := NewBulkWriter(ctx, collection,
+		WithBulkWriterEmbeddingFunction(embeddings.NewConsistentHashEmbeddingFunction()),
+		WithBulkWriterBatchSize(2),
+		WithBulkWriterErrorHandler(func(ids []DocumentID, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			require.EqualError(t, err, "write failed")
+			failed = append(failed, ids...)
+		}),
+	)
+	require.NoError(t, err)
+
+	records := make(chan Record)
+	go func() {
+		defer close(records)
+		for i := 0; i < 6; i++ {
+			records <- newBulkTestRecord(t, fmt.Sprint(i))
+		}
+	}()
+	require.NoError(t, writer.WriteFrom(ctx, records))
+	stats, err := writer.Close(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 of 3 batches failed")
+
+	require.Equal(t, []DocumentID{"2", "3"}, failed)
+	require.Equal(t, 4, stats.Written)
+	require.Equal(t, 2, stats.Failed)
+	require.Equal(t, 1, stats.FailedBatches)
+	require.Len(t, collection.received(), 2)
+}
+
+func TestBulkWriterUsesPreflightBatchSize(t *testing.T) {
+	client := &APIClientV2{
+		preflightCompleted: true,
+		preflightLimits:    map[string]interface{}{fmt.Sprintf("%s#%s", ResourceCollection, OperationCreate): 50},
+	}
+	collection := &CollectionImpl{client: client}
+	ctx := context.Background()
+
+	writer, err := NewBulkWriter(ctx, collection, WithBulkWriterBatchSize(1000))
+	require.NoError(t, err)
+	require.Equal(t, 50, writer.batchSize)
+	_, err = writer.Close(ctx)
+	require.NoError(t, err)
+
+	writer, err = NewBulkWriter(ctx, &outboxTestCollection{})
+	require.NoError(t, err)
+	require.Equal(t, DefaultBulkWriterBatchSize, writer.batchSize)
+	_, err = writer.Close(ctx)
+	require.NoError(t, err)
+}
+
+// bulkBlockingEmbeddingFunction embeds nothing until the writer is cancelled.
+type bulkBlockingEmbeddingFunction struct {
+	embeddings.EmbeddingFunction
+}
+
+func (ef *bulkBlockingEmbeddingFunction) EmbedDocuments(ctx context.Context, _ []string) ([]embeddings.Embedding, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestBulkWriterWriteFromStopsOnCancel(t *testing.T) {
+	writer, err := NewBulkWriter(context.Background(), &outboxTestCollection{},
+		WithBulkWriterEmbeddingFunction(embeddings.NewConsistentHashEmbeddingFunction()),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	records := make(chan Record, 1)
+	records <- newBulkTestRecord(t, "1")
+	errCh := make(chan error, 1)
+	go func() { errCh <- writer.WriteFrom(ctx, records) }()
+	require.Eventually(t, func() bool { return writer.Stats().Records == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+
+	stats, err := writer.Close(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Written)
+}
+
+func TestBulkWriterCloseWithCancelledContext(t *testing.T) {
+	collection := &outboxTestCollection{}
+	var mu sync.Mutex
+	var failed []DocumentID
+	writer, err := NewBulkWriter(context.Background(), collection,
+		WithBulkWriterEmbeddingFunction(&bulkBlockingEmbeddingFunction{}),
+		WithBulkWriterBatchSize(2),
+		WithBulkWriterConcurrency(1),
+		WithBulkWriterErrorHandler(func(ids []DocumentID, _ error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, ids...)
+		}),
+	)
+	require.NoError(t, err)
+
+	// the first batch blocks the only worker and the second fills the queue
+	for i := 0; i < 5; i++ {
+		require.NoError(t, writer.Write(context.Background(), newBulkTestRecord(t, fmt.Sprint(i))))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err := writer.Close(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.Equal(t, 5, stats.Records)
+	require.Zero(t, stats.Written)
+	require.Equal(t, 5, stats.Failed, "records still buffered must be counted as failed")
+	require.Equal(t, 3, stats.FailedBatches)
+	require.ElementsMatch(t, []DocumentID{"0", "1", "2", "3", "4"}, failed)
+	require.Empty(t, collection.received())
+}
+
+// bulkStallingEmbeddingFunction blocks embedding the first batch until release is closed.
+type bulkStallingEmbeddingFunction struct {
+	embeddings.EmbeddingFunction
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (ef *bulkStallingEmbeddingFunction) EmbedDocuments(ctx context.Context, documents []string) ([]embeddings.Embedding, error) {
+	ef.calls.Add(1)
+	if documents[0] == "text of 00" {
+		<-ef.release
+	}
+	return ef.EmbeddingFunction.EmbedDocuments(ctx, documents)
+}
+
+func TestBulkWriterBoundsBatchesBehindStalledBatch(t *testing.T) {
+	collection := &outboxTestCollection{}
+	ef := &bulkStallingEmbeddingFunction{
+		EmbeddingFunction: embeddings.NewConsistentHashEmbeddingFunction(),
+		release:           make(chan struct{}),
+	}
+	ctx := context.Background()
+	writer, err := NewBulkWriter(ctx, collection,
+		WithBulkWriterEmbeddingFunction(ef),
+		WithBulkWriterBatchSize(1),
+		WithBulkWriterConcurrency(2),
+	)
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		for i := 0; i < 20; i++ {
+			if err := writer.Write(ctx, newBulkTestRecord(t, fmt.Sprintf("%02d", i))); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- nil
+	}()
+	// the stalled first batch and one batch behind it fill the window of two
+	require.Eventually(t, func() bool { return ef.calls.Load() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(2), ef.calls.Load(), "batches must not be embedded while the first batch stalls")
+	require.Empty(t, collection.received())
+
+	close(ef.release)
+	require.NoError(t, <-errCh)
+	stats, err := writer.Close(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 20, stats.Written)
+	calls := collection.received()
+	require.Len(t, calls, 20)
+	for i, call := range calls {
+		require.Equal(t, []DocumentID{DocumentID(fmt.Sprintf("%02d", i))}, call.ids)
+	}
+}
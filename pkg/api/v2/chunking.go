@@ -0,0 +1,212 @@
+package v2
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/chunking"
+)
+
+// Metadata keys written to every chunk stored through [WithChunking].
+const (
+	// ChunkParentIDKey holds the ID of the source document a chunk was cut from.
+	ChunkParentIDKey = "parent_id"
+	// ChunkIndexKey holds the zero-based position of the chunk within its source document.
+	ChunkIndexKey = "chunk_index"
+	// ChunkStartKey holds the byte offset of the chunk in the source document (inclusive).
+	ChunkStartKey = "chunk_start"
+	// ChunkEndKey holds the byte offset of the chunk in the source document (exclusive).
+	ChunkEndKey = "chunk_end"
+	// ChunkHeaderKeyPrefix prefixes the level of each enclosing Markdown header of a
+	// chunk, e.g. "chunk_header_h1" holds the enclosing level 1 header.
+	ChunkHeaderKeyPrefix = "chunk_header_"
+)
+
+// ChunkIDFunc derives the ID of a chunk from its source document ID and chunk index.
+type ChunkIDFunc func(parentID DocumentID, index int) DocumentID
+
+// DefaultChunkID produces chunk IDs of the form "<parentID>#<index>".
+func DefaultChunkID(parentID DocumentID, index int) DocumentID {
+	return DocumentID(fmt.Sprintf("%s#%d", parentID, index))
+}
+
+// ChunkingOptions configures add-time chunking. See [WithChunking].
+type ChunkingOptions struct {
+	// Splitter cuts each document into chunks.
+	Splitter chunking.Splitter
+	// IDFunc derives chunk IDs. Defaults to [DefaultChunkID].
+	IDFunc ChunkIDFunc
+	// KeepSingleChunkID keeps the source document ID for documents that produce a
+	// single chunk instead of deriving a chunk ID.
+	KeepSingleChunkID bool
+}
+
+// ChunkingOption configures [ChunkingOptions].
+type ChunkingOption func(*ChunkingOptions) error
+
+// WithChunkIDFunc sets how chunk IDs are derived from the source document ID.
+func WithChunkIDFunc(fn ChunkIDFunc) ChunkingOption {
+	return func(o *ChunkingOptions) error {
+		if fn == nil {
+			return errors.New("chunk ID function cannot be nil")
+		}
+		o.IDFunc = fn
+		return nil
+	}
+}
+
+// WithKeepSingleChunkID keeps the source document ID for documents short enough
+// to fit in one chunk.
+func WithKeepSingleChunkID() ChunkingOption {
+	return func(o *ChunkingOptions) error {
+		o.KeepSingleChunkID = true
+		return nil
+	}
+}
+
+// chunkingOption implements add-time chunking for Add and Upsert operations.
+// Use [WithChunking] to create this option.
+type chunkingOption struct {
+	options *ChunkingOptions
+	err     error
+}
+
+// WithChunking splits every document of a [Collection.Add] or [Collection.Upsert]
+// call into chunks before embedding. Each chunk is stored as its own record with
+// an ID derived from the source document ID (see [DefaultChunkID]) and a copy of
+// the source metadata extended with [ChunkParentIDKey], [ChunkIndexKey],
+// [ChunkStartKey], [ChunkEndKey] and, for Markdown headers, [ChunkHeaderKeyPrefix] keys.
+//
+// Chunking requires documents and cannot be combined with [WithEmbeddings].
+// When upserting, chunks left over from a previously longer version of a
+// document are not removed; delete them by [ChunkParentIDKey] first.
+//
+//	splitter, _ := chunking.NewRecursiveCharacterSplitter(chunking.WithChunkSize(512))
+//	err := collection.Add(ctx,
+//	    WithIDs("manual"),
+//	    WithTexts(longManual),
+//	    WithMetadatas(NewDocumentMetadata(NewStringAttribute("source", "manual.pdf"))),
+//	    WithChunking(splitter),
+//	)
+func WithChunking(splitter chunking.Splitter, opts ...ChunkingOption) *chunkingOption {
+	o := &ChunkingOptions{Splitter: splitter, IDFunc: DefaultChunkID}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(o); err != nil {
+			return &chunkingOption{err: err}
+		}
+	}
+	return &chunkingOption{options: o}
+}
+
+func (o *chunkingOption) ApplyToAdd(op *CollectionAddOp) error {
+	if o.err != nil {
+		return o.err
+	}
+	if o.options == nil || isNilInterface(o.options.Splitter) {
+		return errors.New("chunking splitter cannot be nil")
+	}
+	op.Chunking = o.options
+	return nil
+}
+
+// chunkDocuments replaces the op's documents with their chunks. It runs after IDs
+// are generated and records are unwrapped, so that every document has an ID.
+func (c *CollectionAddOp) chunkDocuments() error {
+	opts := c.Chunking
+	if len(c.Documents) == 0 {
+		return errors.New("chunking requires documents")
+	}
+	for _, e := range c.Embeddings {
+		if !isNilInterface(e) {
+			return errors.New("chunking cannot be combined with precomputed embeddings")
+		}
+	}
+	idFunc := opts.IDFunc
+	if idFunc == nil {
+		idFunc = DefaultChunkID
+	}
+	ids := make([]DocumentID, 0, len(c.Ids))
+	docs := make([]Document, 0, len(c.Documents))
+	metas := make([]DocumentMetadata, 0, len(c.Documents))
+	seen := make(map[DocumentID]struct{}, len(c.Ids))
+	for i, doc := range c.Documents {
+		parentID := c.Ids[i]
+		var text string
+		if !isNilInterface(doc) {
+			text = doc.ContentString()
+		}
+		chunks, err := opts.Splitter.Split(text)
+		if err != nil {
+			return errors.Wrapf(err, "error chunking document %s", parentID)
+		}
+		if len(chunks) == 0 {
+			// Keep empty documents addressable under their own ID.
+			chunks = []chunking.Chunk{{Text: text, End: len(text)}}
+		}
+		var parentMeta DocumentMetadata
+		if i < len(c.Metadatas) {
+			parentMeta = c.Metadatas[i]
+		}
+		for _, chunk := range chunks {
+			id := parentID
+			if len(chunks) > 1 || !opts.KeepSingleChunkID {
+				id = idFunc(parentID, chunk.Index)
+			}
+			if _, exists := seen[id]; exists {
+				return errors.Errorf("duplicate chunk id generated: %s", id)
+			}
+			seen[id] = struct{}{}
+			meta, err := copyDocumentMetadata(parentMeta)
+			if err != nil {
+				return errors.Wrapf(err, "error copying metadata of document %s", parentID)
+			}
+			meta.SetString(ChunkParentIDKey, string(parentID))
+			meta.SetInt(ChunkIndexKey, int64(chunk.Index))
+			meta.SetInt(ChunkStartKey, int64(chunk.Start))
+			meta.SetInt(ChunkEndKey, int64(chunk.End))
+			for level, header := range chunk.Headers {
+				meta.SetString(ChunkHeaderKeyPrefix+level, header)
+			}
+			ids = append(ids, id)
+			docs = append(docs, NewTextDocument(chunk.Text))
+			metas = append(metas, meta)
+		}
+	}
+	c.Ids = ids
+	c.Documents = docs
+	c.Metadatas = metas
+	c.Embeddings = nil
+	return nil
+}
+
+// copyDocumentMetadata returns a mutable copy of md. A nil md yields empty metadata.
+func copyDocumentMetadata(md DocumentMetadata) (DocumentMetadata, error) {
+	if isNilInterface(md) {
+		return NewDocumentMetadata(), nil
+	}
+	if impl, ok := md.(*DocumentMetadataImpl); ok {
+		cp := make(map[string]MetadataValue, len(impl.metadata))
+		for k, v := range impl.metadata {
+			cp[k] = v
+		}
+		return &DocumentMetadataImpl{metadata: cp}, nil
+	}
+	// Fall back to a JSON round trip for foreign implementations.
+	marshaler, ok := md.(interface{ MarshalJSON() ([]byte, error) })
+	if !ok {
+		return nil, errors.Errorf("unsupported metadata type %T", md)
+	}
+	b, err := marshaler.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	cp := &DocumentMetadataImpl{metadata: map[string]MetadataValue{}}
+	if err := cp.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
@@ -0,0 +1,142 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/chunking"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+func newTestSplitter(t *testing.T) chunking.Splitter {
+	t.Helper()
+	splitter, err := chunking.NewRecursiveCharacterSplitter(chunking.WithChunkSize(12), chunking.WithChunkOverlap(0))
+	require.NoError(t, err)
+	return splitter
+}
+
+func TestWithChunkingAdd(t *testing.T) {
+	op, err := NewCollectionAddOp(
+		WithIDs("long", "short"),
+		WithTexts("alpha beta gamma delta", "tiny"),
+		WithMetadatas(
+			NewDocumentMetadata(NewStringAttribute("source", "a.txt")),
+			NewDocumentMetadata(NewStringAttribute("source", "b.txt")),
+		),
+		WithChunking(newTestSplitter(t)),
+	)
+	require.NoError(t, err)
+	require.NoError(t, op.PrepareAndValidate())
+
+	require.Equal(t, []DocumentID{"long#0", "long#1", "short#0"}, op.Ids)
+	require.Len(t, op.Documents, 3)
+	require.Equal(t, "alpha beta", op.Documents[0].ContentString())
+	require.Equal(t, "gamma delta", op.Documents[1].ContentString())
+	require.Equal(t, "tiny", op.Documents[2].ContentString())
+
+	parent, ok := op.Metadatas[1].GetString(ChunkParentIDKey)
+	require.True(t, ok)
+	require.Equal(t, "long", parent)
+	index, ok := op.Metadatas[1].GetInt(ChunkIndexKey)
+	require.True(t, ok)
+	require.Equal(t, int64(1), index)
+	start, ok := op.Metadatas[1].GetInt(ChunkStartKey)
+	require.True(t, ok)
+	end, ok := op.Metadatas[1].GetInt(ChunkEndKey)
+	require.True(t, ok)
+	require.Equal(t, "gamma delta", "alpha beta gamma delta"[start:end])
+	source, ok := op.Metadatas[2].GetString("source")
+	require.True(t, ok)
+	require.Equal(t, "b.txt", source)
+
+	// parent metadata is not mutated
+	_, ok = op.Metadatas[0].GetString("source")
+	require.True(t, ok)
+}
+
+func TestWithChunkingOptions(t *testing.T) {
+	op, err := NewCollectionAddOp(
+		WithIDs("a", "b"),
+		WithTexts("alpha beta gamma delta", "tiny"),
+		WithChunking(newTestSplitter(t),
+			WithKeepSingleChunkID(),
+			WithChunkIDFunc(func(parentID DocumentID, index int) DocumentID {
+				return parentID + "-" + DocumentID(rune('a'+index))
+			}),
+		),
+	)
+	require.NoError(t, err)
+	require.NoError(t, op.PrepareAndValidate())
+	require.Equal(t, []DocumentID{"a-a", "a-b", "b"}, op.Ids)
+	require.Len(t, op.Metadatas, 3)
+}
+
+func TestWithChunkingMarkdownHeaders(t *testing.T) {
+	splitter, err := chunking.NewMarkdownHeaderSplitter()
+	require.NoError(t, err)
+	op, err := NewCollectionAddOp(
+		WithIDs("doc"),
+		WithTexts("# Guide\n\nintro\n\n## Setup\n\nsteps"),
+		WithMetadatas(NewDocumentMetadata(
+			NewStringAttribute("h1", "user value"),
+			NewStringAttribute("author", "ana"),
+		)),
+		WithChunking(splitter),
+	)
+	require.NoError(t, err)
+	require.NoError(t, op.PrepareAndValidate())
+	require.Len(t, op.Metadatas, 2)
+
+	last := op.Metadatas[1]
+	header, ok := last.GetString(ChunkHeaderKeyPrefix + "h1")
+	require.True(t, ok)
+	require.Equal(t, "Guide", header)
+	header, ok = last.GetString("chunk_header_h2")
+	require.True(t, ok)
+	require.Equal(t, "Setup", header)
+	// user metadata is kept
+	h1, ok := last.GetString("h1")
+	require.True(t, ok)
+	require.Equal(t, "user value", h1)
+	author, ok := last.GetString("author")
+	require.True(t, ok)
+	require.Equal(t, "ana", author)
+}
+
+func TestWithChunkingErrors(t *testing.T) {
+	_, err := NewCollectionAddOp(WithIDs("a"), WithTexts("x"), WithChunking(nil))
+	require.Error(t, err)
+
+	_, err = NewCollectionAddOp(WithIDs("a"), WithTexts("x"), WithChunking(newTestSplitter(t), WithChunkIDFunc(nil)))
+	require.Error(t, err)
+
+	op, err := NewCollectionAddOp(
+		WithIDs("a"),
+		WithTexts("alpha beta gamma delta"),
+		WithEmbeddings(embeddings.NewEmbeddingFromFloat32([]float32{0.1, 0.2})),
+		WithChunking(newTestSplitter(t)),
+	)
+	require.NoError(t, err)
+	err = op.PrepareAndValidate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "precomputed embeddings")
+
+	op, err = NewCollectionAddOp(WithIDs("a"), WithChunking(newTestSplitter(t)))
+	require.NoError(t, err)
+	err = op.PrepareAndValidate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requires documents")
+
+	op, err = NewCollectionAddOp(
+		WithIDs("a", "a#0"),
+		WithTexts("alpha beta gamma delta", "x"),
+		WithChunking(newTestSplitter(t), WithKeepSingleChunkID()),
+	)
+	require.NoError(t, err)
+	err = op.PrepareAndValidate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "duplicate chunk id")
+}
@@ -163,6 +163,8 @@ func NewListCollectionsOp(opts ...ListCollectionsOption) (*ListCollectionOp, err
 type GetCollectionOp struct {
 	embeddingFunction        embeddings.EmbeddingFunction
 	contentEmbeddingFunction embeddings.ContentEmbeddingFunction
+	efCompatibility          EFCompatibilityMode
+	skipAliasResolution      bool
 	name                     string
 	Database                 Database `json:"-"`
 }
@@ -769,16 +771,40 @@ type BaseAPIClient struct {
 	logger         logger.Logger
 	usesHTTPClient bool
 	usesTransport  bool
+	endpoints      *endpointPool
+	resilience     *readResilience
+	// maxResponseSize limits response bodies, chhttp.MaxResponseBodySize when 0
+	maxResponseSize int64
+	compression     *compressionSettings
+	aliases         *aliasSettings
+	// unixSocketPath is the socket of a unix:// base URL, requests are sent to baseURL over it
+	unixSocketPath string
+	// baseURLSet records WithBaseURL, which cannot be combined with WithEndpoints in any order
+	baseURLSet bool
 }
 
 type ClientOption func(client *BaseAPIClient) error
 
+// WithBaseURL sets the URL of the Chroma server. A unix:// URL, e.g. unix:///run/chroma.sock, connects to a
+// server listening on that Unix domain socket.
 func WithBaseURL(baseURL string) ClientOption {
 	return func(c *BaseAPIClient) error {
 		if baseURL == "" {
 			return errors.New("baseUrl cannot be empty")
 		}
+		socketPath, isUnix, err := parseUnixSocketURL(baseURL)
+		if err != nil {
+			return err
+		}
+		if isUnix {
+			c.unixSocketPath = socketPath
+			c.baseURL = unixSocketBaseURL
+			c.baseURLSet = true
+			return nil
+		}
+		c.unixSocketPath = ""
 		c.baseURL = baseURL
+		c.baseURLSet = true
 		return nil
 	}
 }
@@ -860,7 +886,7 @@ func WithHTTPClient(httpClient *http.Client) ClientOption {
 			return errors.New("httpClient cannot be nil")
 		}
 		if c.usesTransport {
-			return errors.New("WithHTTPClient cannot be combined with WithTransport, WithSSLCert, or WithInsecure")
+			return errors.New("WithHTTPClient cannot be combined with WithTransport, WithSSLCert, WithInsecure, or WithTLS")
 		}
 		c.httpClient = httpClient
 		if transport, ok := httpClient.Transport.(*http.Transport); ok {
@@ -891,6 +917,23 @@ func WithTimeout(timeout time.Duration) ClientOption {
 			return errors.New("timeout cannot be negative")
 		}
 		c.timeout = timeout
+		// a client passed with WithHTTPClient is used as is
+		if !c.usesHTTPClient {
+			c.httpClient.Timeout = timeout
+		}
+		return nil
+	}
+}
+
+// WithMaxResponseSize sets the maximum size in bytes of a response body. Larger responses
+// fail with an error wrapping chhttp.ErrResponseTooLarge. Defaults to chhttp.MaxResponseBodySize.
+// Prefer [Collection.GetStream] to raising the limit for exports.
+func WithMaxResponseSize(size int64) ClientOption {
+	return func(c *BaseAPIClient) error {
+		if size <= 0 {
+			return errors.New("max response size must be positive")
+		}
+		c.maxResponseSize = size
 		return nil
 	}
 }
@@ -904,6 +947,7 @@ func WithTransport(transport *http.Transport) ClientOption {
 			return errors.New("WithTransport cannot be combined with WithHTTPClient")
 		}
 		c.httpTransport = transport
+		c.httpClient.Transport = transport
 		c.usesTransport = true
 		return nil
 	}
@@ -1040,8 +1084,54 @@ func newBaseAPIClient(options ...ClientOption) (*BaseAPIClient, error) {
 		client.logger = logger.NewNoopLogger()
 	}
 
-	// Bake auth headers into defaultHeaders once so prepareRequest needs no lock.
-	if client.authProvider != nil {
+	if err := client.applyUnixSocket(); err != nil {
+		return nil, err
+	}
+
+	if client.compression != nil {
+		base := client.httpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		// copy so a client passed with WithHTTPClient is not modified
+		compressing := *client.httpClient
+		compressing.Transport = newCompressionTransport(base, client.compression, client.logger)
+		client.httpClient = &compressing
+	}
+
+	if client.resilience != nil && client.resilience.settings.breaker != nil {
+		base := client.httpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		// copy so a client passed with WithHTTPClient is not modified
+		breaking := *client.httpClient
+		breaking.Transport = newCircuitBreakerTransport(base, client.resilience.settings.breaker)
+		client.httpClient = &breaking
+	}
+
+	if client.endpoints != nil {
+		if client.baseURLSet {
+			return nil, errors.New("WithEndpoints cannot be combined with WithBaseURL")
+		}
+		client.endpoints.logger = client.logger
+		client.endpoints.base = client.httpClient.Transport
+		if client.endpoints.base == nil {
+			client.endpoints.base = http.DefaultTransport
+		}
+		// copy so a client passed with WithHTTPClient is not modified
+		pooled := *client.httpClient
+		pooled.Transport = client.endpoints
+		client.httpClient = &pooled
+	}
+
+	if client.resilience != nil {
+		client.resilience.init(client.httpClient)
+	}
+
+	// Bake static auth headers into defaultHeaders once so prepareRequest needs no lock.
+	// Refreshable providers are resolved per request in prepareRequest.
+	if _, refreshable := client.authProvider.(RefreshableCredentialsProvider); client.authProvider != nil && !refreshable {
 		headers, err := client.authProvider.Authenticate()
 		if err != nil {
 			return nil, errors.Wrap(err, "error applying auth credentials")
@@ -1060,12 +1150,21 @@ func (bc *BaseAPIClient) BaseURL() string {
 	return bc.baseURL
 }
 
-func (bc *BaseAPIClient) prepareRequest(httpReq *http.Request) {
+func (bc *BaseAPIClient) prepareRequest(httpReq *http.Request) error {
 	httpReq.Header.Set("Accept", "application/json")
 	httpReq.Header.Set("Content-Type", "application/json")
 	for k, v := range bc.defaultHeaders {
 		httpReq.Header.Set(k, v)
 	}
+	if refreshable, ok := bc.authProvider.(RefreshableCredentialsProvider); ok {
+		headers, err := refreshable.AuthenticateContext(httpReq.Context())
+		if err != nil {
+			return errors.Wrap(err, "error applying auth credentials")
+		}
+		for k, v := range headers {
+			httpReq.Header.Set(k, v)
+		}
+	}
 	if bc.logger.IsDebugEnabled() {
 		dump, err := httputil.DumpRequestOut(httpReq, true)
 		if err == nil {
@@ -1074,11 +1173,44 @@ func (bc *BaseAPIClient) prepareRequest(httpReq *http.Request) {
 			bc.logger.Debug("Failed to dump HTTP request", logger.ErrorField("error", err))
 		}
 	}
+	return nil
+}
+
+// doRequest sends the request and, when a refreshable auth provider is configured
+// and the server answers 401, invalidates the credentials and retries once.
+// Requests whose body cannot be replayed are not retried.
+func (bc *BaseAPIClient) doRequest(httpClient *http.Client, httpReq *http.Request) (*http.Response, error) {
+	if err := bc.prepareRequest(httpReq); err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	refreshable, ok := bc.authProvider.(RefreshableCredentialsProvider)
+	if !ok || (httpReq.Body != nil && httpReq.Body != http.NoBody && httpReq.GetBody == nil) {
+		return resp, nil
+	}
+	retryReq := httpReq.Clone(httpReq.Context())
+	if httpReq.GetBody != nil {
+		body, bodyErr := httpReq.GetBody()
+		if bodyErr != nil {
+			return resp, nil
+		}
+		retryReq.Body = body
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	refreshable.Invalidate()
+	bc.logger.Debug("Retrying request with refreshed credentials", logger.String("path", httpReq.URL.Path))
+	if err := bc.prepareRequest(retryReq); err != nil {
+		return nil, err
+	}
+	return httpClient.Do(retryReq)
 }
 
 func (bc *BaseAPIClient) SendRequest(httpReq *http.Request) (*http.Response, error) {
-	bc.prepareRequest(httpReq)
-	resp, err := bc.httpClient.Do(httpReq)
+	resp, err := bc.doRequest(bc.httpClient, httpReq)
 	if err != nil {
 		return nil, errors.Wrap(chhttp.ChromaErrorFromHTTPResponse(nil, err), "error sending request")
 	}
@@ -1106,29 +1238,57 @@ func (bc *BaseAPIClient) SendRequest(httpReq *http.Request) (*http.Response, err
 }
 
 func (bc *BaseAPIClient) ExecuteRequest(ctx context.Context, method string, path string, request interface{}) ([]byte, error) {
-	var err error
+	reqJSON, err := marshalRequestBody(method, request)
+	if err != nil {
+		return nil, err
+	}
+	return bc.executeRequest(ctx, bc.httpClient, method, path, reqJSON)
+}
+
+// marshalRequestBody returns the JSON body of a request, nil for GET and DELETE.
+func marshalRequestBody(method string, request interface{}) ([]byte, error) {
+	if method == http.MethodDelete || method == http.MethodGet {
+		return nil, nil
+	}
+	reqJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling request JSON")
+	}
+	return reqJSON, nil
+}
+
+func (bc *BaseAPIClient) executeRequest(ctx context.Context, httpClient *http.Client, method string, path string, reqJSON []byte) ([]byte, error) {
+	resp, err := bc.sendRequest(ctx, httpClient, method, path, reqJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := io.ReadAll(bc.limitResponseBody(resp.Body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading response body")
+	}
+	return respBody, nil
+}
+
+// sendRequest sends a request and returns the response if its status is not an error.
+// The caller must close the response body.
+func (bc *BaseAPIClient) sendRequest(ctx context.Context, httpClient *http.Client, method string, path string, reqJSON []byte) (*http.Response, error) {
 	reqURL := fmt.Sprintf("%s/%s", bc.BaseURL(), path)
-	var httpReq *http.Request
-	if method != http.MethodDelete && method != http.MethodGet {
-		reqJSON, err := json.Marshal(request)
-		if err != nil {
-			return nil, errors.Wrap(err, "error marshalling request JSON")
-		}
-		reader := bytes.NewReader(reqJSON)
-		httpReq, err = http.NewRequestWithContext(ctx, method, reqURL, reader)
-		if err != nil {
-			return nil, errors.Wrap(err, "error creating request")
-		}
-	} else {
-		httpReq, err = http.NewRequestWithContext(ctx, method, reqURL, nil)
-		if err != nil {
-			return nil, errors.Wrap(err, "error creating request")
-		}
+	var body io.Reader
+	if reqJSON != nil {
+		body = bytes.NewReader(reqJSON)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
 	}
 
-	bc.prepareRequest(httpReq)
-	resp, err := bc.httpClient.Do(httpReq)
+	resp, err := bc.doRequest(httpClient, httpReq)
 	if err != nil {
+		if errors.Is(err, ErrCircuitOpen) {
+			// ChromaError keeps only the message, keep the sentinel for callers
+			return nil, errors.Wrap(err, "error sending request")
+		}
 		return nil, errors.Wrap(chhttp.ChromaErrorFromHTTPResponse(nil, err), "error sending request")
 	}
 	if bc.logger.IsDebugEnabled() {
@@ -1143,9 +1303,17 @@ func (bc *BaseAPIClient) ExecuteRequest(ctx context.Context, method string, path
 		chErr := chhttp.ChromaErrorFromHTTPResponse(resp, err)
 		return nil, errors.Wrap(chErr, "error sending request")
 	}
-	defer func() { _ = resp.Body.Close() }()
-	respBody := chhttp.ReadRespBody(resp.Body)
-	return []byte(respBody), nil
+	return resp, nil
+}
+
+// limitResponseBody fails reads past the maximum response size with an error
+// wrapping chhttp.ErrResponseTooLarge instead of returning a truncated body.
+func (bc *BaseAPIClient) limitResponseBody(body io.Reader) io.Reader {
+	limit := bc.maxResponseSize
+	if limit <= 0 {
+		limit = chhttp.MaxResponseBodySize
+	}
+	return chhttp.NewLimitedReader(body, limit)
 }
 
 func (bc *BaseAPIClient) HTTPClient() *http.Client {
@@ -1253,6 +1421,7 @@ const (
 	OperationQuery     OperationType = "query"
 	OperationUpdate    OperationType = "update"
 	OperationDelete    OperationType = "delete"
+	OperationSearch    OperationType = "search"
 	ResourceTenant     Resource      = "tenant"
 	ResourceDatabase   Resource      = "database"
 	ResourceCollection Resource      = "collection"
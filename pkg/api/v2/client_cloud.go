@@ -40,6 +40,9 @@ func NewCloudClient(options ...ClientOption) (*CloudAPIClient, error) {
 			collectionCache:    map[string]Collection{},
 		},
 	}
+	if bc.aliases != nil {
+		c.aliases = newAliasManager(c, bc.aliases)
+	}
 
 	tenant, database := c.TenantAndDatabase()
 	if tenant == nil || tenant.Name() == DefaultTenant || database == nil || database.Name() == DefaultDatabase {
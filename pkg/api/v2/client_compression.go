@@ -0,0 +1,262 @@
+package v2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/logger"
+)
+
+// Compression is a content encoding for request and response bodies.
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+
+	// DefaultCompressionMinSize is the size in bytes below which request bodies are sent uncompressed.
+	DefaultCompressionMinSize = 1024
+)
+
+func (c Compression) validate() error {
+	switch c {
+	case CompressionGzip, CompressionZstd:
+		return nil
+	default:
+		return errors.Errorf("unsupported compression %q, must be %q or %q", c, CompressionGzip, CompressionZstd)
+	}
+}
+
+type compressionSettings struct {
+	request         Compression
+	minSize         int
+	acceptEncodings []Compression
+}
+
+func (c *BaseAPIClient) ensureCompression() *compressionSettings {
+	if c.compression == nil {
+		c.compression = &compressionSettings{}
+	}
+	return c.compression
+}
+
+// WithRequestCompression compresses request bodies of at least minSize bytes
+// (DefaultCompressionMinSize when 0) with gzip or zstd. If the server rejects a
+// compressed request with 415 Unsupported Media Type, the request is sent again
+// uncompressed and compression is disabled for that server.
+//
+// Compression mostly pays off for Add and Upsert of large batches of embeddings.
+func WithRequestCompression(compression Compression, minSize int) ClientOption {
+	return func(c *BaseAPIClient) error {
+		if err := compression.validate(); err != nil {
+			return err
+		}
+		if minSize < 0 {
+			return errors.New("compression min size cannot be negative")
+		}
+		if minSize == 0 {
+			minSize = DefaultCompressionMinSize
+		}
+		settings := c.ensureCompression()
+		settings.request, settings.minSize = compression, minSize
+		return nil
+	}
+}
+
+// WithResponseCompression advertises the given encodings, in order of preference,
+// in the Accept-Encoding header and decompresses the responses.
+// Without this option only gzip is requested, by the Go HTTP transport.
+func WithResponseCompression(encodings ...Compression) ClientOption {
+	return func(c *BaseAPIClient) error {
+		if len(encodings) == 0 {
+			return errors.New("at least one encoding is required")
+		}
+		for _, e := range encodings {
+			if err := e.validate(); err != nil {
+				return err
+			}
+		}
+		c.ensureCompression().acceptEncodings = encodings
+		return nil
+	}
+}
+
+// compressionTransport compresses request bodies and decompresses responses.
+type compressionTransport struct {
+	base     http.RoundTripper
+	settings *compressionSettings
+	logger   logger.Logger
+	// unsupported holds the hosts that rejected compressed requests
+	unsupported sync.Map
+	accept      string
+}
+
+func newCompressionTransport(base http.RoundTripper, settings *compressionSettings, log logger.Logger) *compressionTransport {
+	accept := make([]string, 0, len(settings.acceptEncodings))
+	for _, e := range settings.acceptEncodings {
+		accept = append(accept, string(e))
+	}
+	return &compressionTransport{base: base, settings: settings, logger: log, accept: strings.Join(accept, ", ")}
+}
+
+func (t *compressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req
+	if t.accept != "" && req.Header.Get("Accept-Encoding") == "" {
+		out = req.Clone(req.Context())
+		out.Header.Set("Accept-Encoding", t.accept)
+	}
+	var raw []byte
+	compressed := false
+	if t.shouldCompress(req) {
+		var err error
+		raw, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading request body")
+		}
+		if out == req {
+			out = req.Clone(req.Context())
+		}
+		if len(raw) >= t.settings.minSize {
+			body, err := compress(t.settings.request, raw)
+			if err != nil {
+				return nil, err
+			}
+			setBody(out, body)
+			out.Header.Set("Content-Encoding", string(t.settings.request))
+			compressed = true
+		} else {
+			setBody(out, raw)
+		}
+	}
+	resp, err := t.base.RoundTrip(out)
+	if err == nil && compressed && resp.StatusCode == http.StatusUnsupportedMediaType {
+		t.unsupported.Store(req.URL.Host, true)
+		t.logger.Warn("Server does not accept compressed requests, disabling request compression",
+			logger.String("host", req.URL.Host),
+			logger.String("encoding", string(t.settings.request)),
+		)
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		retry := out.Clone(out.Context())
+		retry.Header.Del("Content-Encoding")
+		setBody(retry, raw)
+		resp, err = t.base.RoundTrip(retry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.accept != "" {
+		return decompressResponse(resp)
+	}
+	return resp, nil
+}
+
+func (t *compressionTransport) shouldCompress(req *http.Request) bool {
+	if t.settings.request == "" || req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if req.ContentLength > 0 && req.ContentLength < int64(t.settings.minSize) {
+		return false
+	}
+	_, unsupported := t.unsupported.Load(req.URL.Host)
+	return !unsupported
+}
+
+func (t *compressionTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func setBody(req *http.Request, body []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+}
+
+var (
+	gzipWriterPool = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zstdEncoder    atomic.Pointer[zstd.Encoder]
+)
+
+func compress(compression Compression, raw []byte) ([]byte, error) {
+	switch compression {
+	case CompressionZstd:
+		enc := zstdEncoder.Load()
+		if enc == nil {
+			// EncodeAll is safe for concurrent use, a single encoder is shared
+			newEnc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				return nil, errors.Wrap(err, "error creating zstd encoder")
+			}
+			if !zstdEncoder.CompareAndSwap(nil, newEnc) {
+				_ = newEnc.Close()
+			}
+			enc = zstdEncoder.Load()
+		}
+		return enc.EncodeAll(raw, make([]byte, 0, len(raw)/4)), nil
+	default:
+		var buf bytes.Buffer
+		buf.Grow(len(raw) / 4)
+		w := gzipWriterPool.Get().(*gzip.Writer)
+		defer gzipWriterPool.Put(w)
+		w.Reset(&buf)
+		if _, err := w.Write(raw); err != nil {
+			return nil, errors.Wrap(err, "error compressing request body")
+		}
+		if err := w.Close(); err != nil {
+			return nil, errors.Wrap(err, "error compressing request body")
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+func decompressResponse(resp *http.Response) (*http.Response, error) {
+	var decoded io.ReadCloser
+	switch Compression(strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))) {
+	case CompressionGzip:
+		r, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			_ = resp.Body.Close()
+			return nil, errors.Wrap(err, "error decompressing gzip response")
+		}
+		decoded = &decompressedBody{Reader: r, closeDecoder: r.Close, body: resp.Body}
+	case CompressionZstd:
+		r, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			_ = resp.Body.Close()
+			return nil, errors.Wrap(err, "error decompressing zstd response")
+		}
+		decoded = &decompressedBody{Reader: r, closeDecoder: func() error { r.Close(); return nil }, body: resp.Body}
+	default:
+		return resp, nil
+	}
+	resp.Body = decoded
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+type decompressedBody struct {
+	io.Reader
+	closeDecoder func() error
+	body         io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	_ = b.closeDecoder()
+	return b.body.Close()
+}
@@ -0,0 +1,171 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+func decodeRequestBody(t *testing.T, r *http.Request) []byte {
+	t.Helper()
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body = gz
+	case "zstd":
+		dec, err := zstd.NewReader(r.Body)
+		require.NoError(t, err)
+		defer dec.Close()
+		body = dec
+	}
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	return data
+}
+
+func TestRequestCompression(t *testing.T) {
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			var encoding atomic.Value
+			var received atomic.Value
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoding.Store(r.Header.Get("Content-Encoding"))
+				received.Store(string(decodeRequestBody(t, r)))
+				_, _ = io.WriteString(w, `{}`)
+			}))
+			defer srv.Close()
+			client := newResilientClient(t, WithBaseURL(srv.URL), WithRequestCompression(compression, 64))
+
+			large := map[string]string{"data": strings.Repeat("embedding", 100)}
+			_, err := client.ExecuteRequest(context.Background(), http.MethodPost, "add", large)
+			require.NoError(t, err)
+			require.Equal(t, string(compression), encoding.Load())
+			expected, _ := json.Marshal(large)
+			require.Equal(t, string(expected), received.Load())
+
+			_, err = client.ExecuteRequest(context.Background(), http.MethodPost, "add", map[string]string{"a": "b"})
+			require.NoError(t, err)
+			require.Equal(t, "", encoding.Load(), "small bodies are not compressed")
+			require.Equal(t, `{"a":"b"}`, received.Load())
+		})
+	}
+}
+
+func TestRequestCompressionFallback(t *testing.T) {
+	var requests, compressed atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Content-Encoding") != "" {
+			compressed.Add(1)
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		_, _ = io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+	client := newResilientClient(t, WithBaseURL(srv.URL), WithRequestCompression(CompressionGzip, 1))
+
+	for i := 0; i < 2; i++ {
+		_, err := client.ExecuteRequest(context.Background(), http.MethodPost, "add", map[string]string{"a": "b"})
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(3), requests.Load())
+	require.Equal(t, int32(1), compressed.Load(), "compression is disabled after a 415")
+}
+
+func TestResponseCompression(t *testing.T) {
+	payload := `{"ids":["1"],"documents":["` + strings.Repeat("a", 2048) + `"]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept-Encoding")
+		switch {
+		case strings.HasPrefix(accept, "zstd"):
+			w.Header().Set("Content-Encoding", "zstd")
+			enc, err := zstd.NewWriter(w)
+			require.NoError(t, err)
+			_, _ = io.WriteString(enc, payload)
+			require.NoError(t, enc.Close())
+		case strings.HasPrefix(accept, "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, _ = io.WriteString(gz, payload)
+			require.NoError(t, gz.Close())
+		default:
+			_, _ = io.WriteString(w, payload)
+		}
+	}))
+	defer srv.Close()
+	for _, encodings := range [][]Compression{{CompressionZstd, CompressionGzip}, {CompressionGzip}} {
+		client := newResilientClient(t, WithBaseURL(srv.URL), WithResponseCompression(encodings...))
+		body, err := client.ExecuteRequest(context.Background(), http.MethodGet, "get", nil)
+		require.NoError(t, err)
+		require.Equal(t, payload, string(body))
+	}
+}
+
+func TestCompressionOptionsValidation(t *testing.T) {
+	_, err := NewHTTPClient(WithRequestCompression("br", 0))
+	require.Error(t, err)
+	_, err = NewHTTPClient(WithRequestCompression(CompressionGzip, -1))
+	require.Error(t, err)
+	_, err = NewHTTPClient(WithResponseCompression())
+	require.Error(t, err)
+}
+
+func TestAddPacksEmbeddingsWhenSupported(t *testing.T) {
+	for _, supported := range []bool{true, false} {
+		var added atomic.Value
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.HasSuffix(r.URL.Path, "pre-flight-checks"):
+				_ = json.NewEncoder(w).Encode(map[string]any{"max_batch_size": 100, "supports_base64_encoding": supported})
+			case strings.HasSuffix(r.URL.Path, "/add"):
+				var req struct {
+					Embeddings []json.RawMessage `json:"embeddings"`
+				}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				added.Store(req.Embeddings)
+				_, _ = io.WriteString(w, `{}`)
+			}
+		}))
+		client := newResilientClient(t, WithBaseURL(srv.URL))
+		col := &CollectionImpl{client: client, tenant: NewDefaultTenant(), database: NewDefaultDatabase(), id: "c1"}
+		err := col.Add(context.Background(), WithIDs("1"), WithEmbeddings(embeddings.NewEmbeddingFromFloat32([]float32{1.5, -2})))
+		require.NoError(t, err)
+		raw := added.Load().([]json.RawMessage)
+		require.Len(t, raw, 1)
+		if !supported {
+			require.JSONEq(t, `[1.5,-2]`, string(raw[0]), "JSON arrays without server support")
+			srv.Close()
+			continue
+		}
+		var packed string
+		require.NoError(t, json.Unmarshal(raw[0], &packed))
+		data, err := base64.StdEncoding.DecodeString(packed)
+		require.NoError(t, err)
+		floats := make([]float32, len(data)/4)
+		require.NoError(t, binary.Read(bytes.NewReader(data), binary.LittleEndian, floats))
+		require.Equal(t, []float32{1.5, -2}, floats)
+		require.Equal(t, math.Float32bits(1.5), binary.LittleEndian.Uint32(data[:4]))
+		srv.Close()
+	}
+}
@@ -0,0 +1,416 @@
+package v2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/logger"
+)
+
+// EndpointPolicy selects the endpoint of a request when the client has several base URLs.
+type EndpointPolicy string
+
+const (
+	// EndpointPolicyRoundRobin spreads requests over all healthy endpoints.
+	EndpointPolicyRoundRobin EndpointPolicy = "round_robin"
+	// EndpointPolicyLeastLatency sends requests to the healthy endpoint with the lowest
+	// recent latency. Endpoints without a measurement are tried first.
+	EndpointPolicyLeastLatency EndpointPolicy = "least_latency"
+	// EndpointPolicyPrimarySecondary sends requests to the first healthy endpoint in the
+	// configured order, i.e. the others are only used while the primary is ejected.
+	EndpointPolicyPrimarySecondary EndpointPolicy = "primary_secondary"
+)
+
+const (
+	DefaultHealthCheckInterval     = 10 * time.Second
+	DefaultHealthCheckTimeout      = 2 * time.Second
+	DefaultEndpointFailureLimit    = 3
+	DefaultEndpointEjectionTimeout = 30 * time.Second
+	// latencyEWMAWeight is the weight of a new latency sample.
+	latencyEWMAWeight = 0.3
+)
+
+type endpointSettings struct {
+	policy              EndpointPolicy
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	failureLimit        int
+	ejectionTimeout     time.Duration
+	// ticks replaces the health check ticker and checked is signalled after each
+	// round of health checks; only set by tests
+	ticks   <-chan time.Time
+	checked chan<- struct{}
+}
+
+// EndpointOption configures the endpoint selection of WithEndpoints.
+type EndpointOption func(s *endpointSettings) error
+
+// WithEndpointPolicy sets how endpoints are selected. Defaults to EndpointPolicyRoundRobin.
+func WithEndpointPolicy(policy EndpointPolicy) EndpointOption {
+	return func(s *endpointSettings) error {
+		switch policy {
+		case EndpointPolicyRoundRobin, EndpointPolicyLeastLatency, EndpointPolicyPrimarySecondary:
+			s.policy = policy
+			return nil
+		default:
+			return errors.Errorf("unsupported endpoint policy: %s", policy)
+		}
+	}
+}
+
+// WithHealthCheckInterval sets how often every endpoint is checked with Heartbeat.
+// Zero disables background health checks; endpoints are then only ejected and
+// restored based on request outcomes. Defaults to DefaultHealthCheckInterval.
+func WithHealthCheckInterval(interval time.Duration) EndpointOption {
+	return func(s *endpointSettings) error {
+		if interval < 0 {
+			return errors.New("health check interval cannot be negative")
+		}
+		s.healthCheckInterval = interval
+		return nil
+	}
+}
+
+// WithHealthCheckTimeout bounds a single health check. Defaults to DefaultHealthCheckTimeout.
+func WithHealthCheckTimeout(timeout time.Duration) EndpointOption {
+	return func(s *endpointSettings) error {
+		if timeout <= 0 {
+			return errors.New("health check timeout must be positive")
+		}
+		s.healthCheckTimeout = timeout
+		return nil
+	}
+}
+
+// WithEndpointEjection sets the circuit breaker of an endpoint: after failureLimit
+// consecutive failures (connection errors, 502, 503 and 504 responses or failed health
+// checks) the endpoint is ejected for ejectionTimeout. Afterwards it receives traffic
+// again and a single failure ejects it anew, while a success or a passing health check
+// restores it.
+func WithEndpointEjection(failureLimit int, ejectionTimeout time.Duration) EndpointOption {
+	return func(s *endpointSettings) error {
+		if failureLimit <= 0 {
+			return errors.New("failure limit must be a positive integer")
+		}
+		if ejectionTimeout <= 0 {
+			return errors.New("ejection timeout must be positive")
+		}
+		s.failureLimit = failureLimit
+		s.ejectionTimeout = ejectionTimeout
+		return nil
+	}
+}
+
+// WithEndpoints configures several base URLs of the same Chroma deployment, e.g. the
+// nodes behind a restarting ingress. The first URL is the client's BaseURL. Requests
+// are sent to an endpoint chosen by the policy, failing endpoints are ejected, and
+// idempotent requests (GET, PUT, DELETE and collection Get, Query, Search and Upsert)
+// that fail with a connection error, 502, 503 or 504 are retried on the next endpoint.
+// Every endpoint must serve the same data: the client keeps one collection cache and
+// one set of preflight limits. It replaces WithBaseURL and cannot be combined with it.
+func WithEndpoints(baseURLs []string, opts ...EndpointOption) ClientOption {
+	return func(c *BaseAPIClient) error {
+		if len(baseURLs) == 0 {
+			return errors.New("at least one endpoint is required")
+		}
+		settings := endpointSettings{
+			policy:              EndpointPolicyRoundRobin,
+			healthCheckInterval: DefaultHealthCheckInterval,
+			healthCheckTimeout:  DefaultHealthCheckTimeout,
+			failureLimit:        DefaultEndpointFailureLimit,
+			ejectionTimeout:     DefaultEndpointEjectionTimeout,
+		}
+		for _, opt := range opts {
+			if err := opt(&settings); err != nil {
+				return err
+			}
+		}
+		pool := &endpointPool{settings: settings, now: time.Now, stop: make(chan struct{})}
+		seen := map[string]bool{}
+		for _, raw := range baseURLs {
+			u, err := url.Parse(strings.TrimSpace(raw))
+			if err != nil {
+				return errors.Wrapf(err, "invalid endpoint %q", raw)
+			}
+			if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.Errorf("invalid endpoint %q: expected an http(s) URL", raw)
+			}
+			// endpoints are stored without the API prefix so paths can be swapped
+			u.Path = strings.TrimSuffix(strings.TrimRight(u.Path, "/"), "/api/v2")
+			u.RawPath = ""
+			if seen[u.String()] {
+				return errors.Errorf("duplicate endpoint %q", raw)
+			}
+			seen[u.String()] = true
+			pool.endpoints = append(pool.endpoints, &endpoint{url: u})
+		}
+		c.baseURL = pool.endpoints[0].url.String()
+		c.endpoints = pool
+		return nil
+	}
+}
+
+type endpoint struct {
+	url *url.URL
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+	latency      time.Duration
+}
+
+// endpointPool is the client transport when several endpoints are configured. It
+// rewrites requests built against the primary base URL to the selected endpoint.
+type endpointPool struct {
+	settings  endpointSettings
+	endpoints []*endpoint
+	base      http.RoundTripper
+	logger    logger.Logger
+	next      atomic.Uint64
+	now       func() time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type pinnedEndpointKey struct{}
+
+type idempotentRequestKey struct{}
+
+// withIdempotentRequest marks requests sent with ctx as safe to retry on another
+// endpoint, for POST requests that only read (Query, Get, Search) or upsert.
+func withIdempotentRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentRequestKey{}, true)
+}
+
+func isIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentRequestKey{}).(bool)
+	return marked
+}
+
+func (p *endpointPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !p.matchesPrimary(req.URL) {
+		return p.base.RoundTrip(req)
+	}
+	if i, ok := req.Context().Value(pinnedEndpointKey{}).(int); ok && i >= 0 && i < len(p.endpoints) {
+		return p.base.RoundTrip(p.rewrite(req, i))
+	}
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	retry := replayable && isIdempotentRequest(req)
+	tried := make([]bool, len(p.endpoints))
+	for attempt := 0; ; attempt++ {
+		i := p.pick(tried)
+		tried[i] = true
+		attemptReq := p.rewrite(req, i)
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "error replaying request body")
+			}
+			attemptReq.Body = body
+		}
+		resp, err := p.roundTripOn(i, attemptReq)
+		failed := err != nil || isEndpointFailureStatus(resp.StatusCode)
+		if !failed || !retry || req.Context().Err() != nil || attempt+1 >= len(p.endpoints) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+		}
+		p.logger.Warn("Retrying request on another endpoint",
+			logger.String("endpoint", p.endpoints[i].url.Host),
+			logger.String("path", req.URL.Path),
+		)
+	}
+}
+
+func (p *endpointPool) CloseIdleConnections() {
+	if closer, ok := p.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func isEndpointFailureStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+func (p *endpointPool) roundTripOn(i int, req *http.Request) (*http.Response, error) {
+	start := p.now()
+	resp, err := p.base.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// cancelled by the caller, says nothing about the endpoint
+	case errors.Is(err, ErrCircuitOpen):
+		// rejected before reaching the endpoint, the breaker tracks its health for reads
+	case err != nil:
+		p.report(i, err, 0)
+	case isEndpointFailureStatus(resp.StatusCode):
+		p.report(i, errors.Errorf("status %d", resp.StatusCode), 0)
+	default:
+		p.report(i, nil, p.now().Sub(start))
+	}
+	return resp, err
+}
+
+func (p *endpointPool) matchesPrimary(u *url.URL) bool {
+	primary := p.endpoints[0].url
+	return u.Scheme == primary.Scheme && u.Host == primary.Host && strings.HasPrefix(u.Path, primary.Path)
+}
+
+// rewrite returns a copy of req addressed to endpoint i.
+func (p *endpointPool) rewrite(req *http.Request, i int) *http.Request {
+	primary, target := p.endpoints[0].url, p.endpoints[i].url
+	out := req.Clone(req.Context())
+	if i == 0 {
+		return out
+	}
+	u := *req.URL
+	u.Scheme, u.Host = target.Scheme, target.Host
+	u.Path = target.Path + strings.TrimPrefix(req.URL.Path, primary.Path)
+	if req.URL.RawPath != "" {
+		u.RawPath = target.EscapedPath() + strings.TrimPrefix(req.URL.RawPath, primary.EscapedPath())
+	}
+	out.URL = &u
+	out.Host = ""
+	return out
+}
+
+// pick returns the endpoint for the next attempt among the endpoints not tried yet.
+// Ejected endpoints are skipped unless all of them are ejected, in which case the one
+// returning first is used rather than failing without a request.
+func (p *endpointPool) pick(tried []bool) int {
+	now := p.now()
+	available := make([]int, 0, len(p.endpoints))
+	fallback := -1
+	var fallbackUntil time.Time
+	for i, ep := range p.endpoints {
+		if tried[i] {
+			continue
+		}
+		ep.mu.Lock()
+		until := ep.ejectedUntil
+		ep.mu.Unlock()
+		if !now.Before(until) {
+			available = append(available, i)
+		} else if fallback < 0 || until.Before(fallbackUntil) {
+			fallback, fallbackUntil = i, until
+		}
+	}
+	if len(available) == 0 {
+		return fallback
+	}
+	switch p.settings.policy {
+	case EndpointPolicyPrimarySecondary:
+		return available[0]
+	case EndpointPolicyLeastLatency:
+		best, bestLatency := available[0], time.Duration(-1)
+		for _, i := range available {
+			ep := p.endpoints[i]
+			ep.mu.Lock()
+			latency := ep.latency
+			ep.mu.Unlock()
+			if bestLatency < 0 || latency < bestLatency {
+				best, bestLatency = i, latency
+			}
+		}
+		return best
+	default:
+		return available[int(p.next.Add(1)-1)%len(available)]
+	}
+}
+
+// report records the outcome of a request or health check on endpoint i.
+func (p *endpointPool) report(i int, err error, latency time.Duration) {
+	ep := p.endpoints[i]
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if err == nil {
+		if ep.failures >= p.settings.failureLimit {
+			p.logger.Info("Endpoint restored", logger.String("endpoint", ep.url.Host))
+		}
+		ep.failures = 0
+		ep.ejectedUntil = time.Time{}
+		if ep.latency == 0 {
+			ep.latency = latency
+		} else {
+			ep.latency = time.Duration(latencyEWMAWeight*float64(latency) + (1-latencyEWMAWeight)*float64(ep.latency))
+		}
+		return
+	}
+	ep.failures++
+	if ep.failures >= p.settings.failureLimit {
+		ep.ejectedUntil = p.now().Add(p.settings.ejectionTimeout)
+		p.logger.Warn("Endpoint ejected",
+			logger.String("endpoint", ep.url.Host),
+			logger.Int("failures", ep.failures),
+			logger.ErrorField("error", err),
+		)
+	}
+}
+
+// startHealthChecks runs check against every endpoint at the configured interval.
+func (p *endpointPool) startHealthChecks(check func(ctx context.Context) error) {
+	if p.settings.healthCheckInterval <= 0 {
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticks := p.settings.ticks
+		if ticks == nil {
+			ticker := time.NewTicker(p.settings.healthCheckInterval)
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticks:
+				p.checkAll(check)
+			}
+			if p.settings.checked != nil {
+				select {
+				case p.settings.checked <- struct{}{}:
+				case <-p.stop:
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (p *endpointPool) checkAll(check func(ctx context.Context) error) {
+	var wg sync.WaitGroup
+	for i := range p.endpoints {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), pinnedEndpointKey{}, i), p.settings.healthCheckTimeout)
+			defer cancel()
+			start := p.now()
+			err := check(ctx)
+			p.report(i, err, p.now().Sub(start))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (p *endpointPool) close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.wg.Wait()
+}
@@ -0,0 +1,229 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testEndpoint struct {
+	*httptest.Server
+	hits       atomic.Int32
+	heartbeats atomic.Int32
+	status     atomic.Int32
+	delay      atomic.Int64
+	lastPath   atomic.Value
+	lastBody   atomic.Value
+}
+
+// withHealthCheckTicks runs a round of health checks on every tick instead of at
+// the interval, and signals checked when it is done.
+func withHealthCheckTicks(ticks <-chan time.Time, checked chan<- struct{}) EndpointOption {
+	return func(s *endpointSettings) error {
+		s.ticks, s.checked = ticks, checked
+		return nil
+	}
+}
+
+func newTestEndpoint(t *testing.T) *testEndpoint {
+	t.Helper()
+	ep := &testEndpoint{}
+	ep.status.Store(http.StatusOK)
+	ep.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d := time.Duration(ep.delay.Load()); d > 0 {
+			time.Sleep(d)
+		}
+		if strings.HasSuffix(r.URL.Path, "/heartbeat") {
+			ep.heartbeats.Add(1)
+		} else {
+			ep.hits.Add(1)
+		}
+		body, _ := io.ReadAll(r.Body)
+		ep.lastPath.Store(r.URL.Path)
+		ep.lastBody.Store(string(body))
+		if status := int(ep.status.Load()); status != http.StatusOK {
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, `{"error":"unavailable"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"nanosecond heartbeat": 1}`)
+	}))
+	t.Cleanup(ep.Close)
+	return ep
+}
+
+func newEndpointsClient(t *testing.T, urls []string, opts ...EndpointOption) *APIClientV2 {
+	t.Helper()
+	c, err := NewHTTPClient(WithEndpoints(urls, opts...))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c.(*APIClientV2)
+}
+
+func TestEndpointsRoundRobin(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	client := newEndpointsClient(t, []string{a.URL, b.URL + "/api/v2"}, WithHealthCheckInterval(0))
+	require.Equal(t, a.URL+"/api/v2", client.BaseURL())
+	for i := 0; i < 4; i++ {
+		_, err := client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(2), a.hits.Load())
+	require.Equal(t, int32(2), b.hits.Load())
+	require.Equal(t, "/api/v2/collections", b.lastPath.Load())
+}
+
+func TestEndpointsFailover(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	client := newEndpointsClient(t, []string{a.URL, b.URL},
+		WithHealthCheckInterval(0),
+		WithEndpointPolicy(EndpointPolicyPrimarySecondary),
+		WithEndpointEjection(2, time.Hour),
+	)
+	ctx := context.Background()
+
+	a.status.Store(http.StatusServiceUnavailable)
+	_, err := client.ExecuteRequest(withIdempotentRequest(ctx), http.MethodPost, "query", map[string]int{"n": 1})
+	require.NoError(t, err, "read requests fail over")
+	require.Equal(t, int32(1), a.hits.Load())
+	require.Equal(t, int32(1), b.hits.Load())
+	require.Equal(t, `{"n":1}`, b.lastBody.Load(), "body is replayed")
+
+	_, err = client.ExecuteRequest(ctx, http.MethodPost, "collections", map[string]int{"n": 2})
+	require.Error(t, err, "non idempotent requests are not retried")
+	require.Equal(t, int32(2), a.hits.Load())
+	require.Equal(t, int32(1), b.hits.Load())
+
+	// two failures eject the primary
+	_, err = client.ExecuteRequest(ctx, http.MethodGet, "collections", nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), a.hits.Load())
+	require.Equal(t, int32(2), b.hits.Load())
+
+	t.Run("connection errors", func(t *testing.T) {
+		c, d := newTestEndpoint(t), newTestEndpoint(t)
+		client := newEndpointsClient(t, []string{c.URL, d.URL}, WithHealthCheckInterval(0), WithEndpointPolicy(EndpointPolicyPrimarySecondary))
+		c.Close()
+		_, err := client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+		require.NoError(t, err)
+		require.Equal(t, int32(1), d.hits.Load())
+	})
+
+	t.Run("all endpoints failing", func(t *testing.T) {
+		b.status.Store(http.StatusServiceUnavailable)
+		_, err := client.ExecuteRequest(ctx, http.MethodGet, "collections", nil)
+		require.Error(t, err)
+	})
+}
+
+func TestEndpointsEjectionAndRecovery(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	client := newEndpointsClient(t, []string{a.URL, b.URL},
+		WithHealthCheckInterval(0),
+		WithEndpointPolicy(EndpointPolicyPrimarySecondary),
+		WithEndpointEjection(1, time.Minute),
+	)
+	pool := client.endpoints
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+
+	a.status.Store(http.StatusBadGateway)
+	_, err := client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+	require.NoError(t, err)
+	a.status.Store(http.StatusOK)
+	_, err = client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), a.hits.Load(), "ejected endpoint receives no traffic")
+
+	now = now.Add(2 * time.Minute)
+	_, err = client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), a.hits.Load(), "primary is used again after the ejection timeout")
+}
+
+func TestEndpointsLeastLatency(t *testing.T) {
+	slow, fast := newTestEndpoint(t), newTestEndpoint(t)
+	slow.delay.Store(int64(30 * time.Millisecond))
+	client := newEndpointsClient(t, []string{slow.URL, fast.URL}, WithHealthCheckInterval(0), WithEndpointPolicy(EndpointPolicyLeastLatency))
+	for i := 0; i < 6; i++ {
+		_, err := client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(1), slow.hits.Load(), "only the first measurement goes to the slow endpoint")
+	require.Equal(t, int32(5), fast.hits.Load())
+}
+
+func TestEndpointsHealthChecks(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	a.status.Store(http.StatusInternalServerError)
+	ticks, checked := make(chan time.Time), make(chan struct{})
+	client := newEndpointsClient(t, []string{a.URL, b.URL},
+		WithHealthCheckInterval(time.Hour),
+		withHealthCheckTicks(ticks, checked),
+		WithEndpointPolicy(EndpointPolicyPrimarySecondary),
+		WithEndpointEjection(1, time.Hour),
+	)
+	checkNow := func() {
+		ticks <- time.Now()
+		<-checked
+	}
+
+	checkNow()
+	require.Equal(t, int32(1), a.heartbeats.Load())
+	require.Equal(t, int32(1), b.heartbeats.Load())
+	_, err := client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+	require.NoError(t, err)
+	require.Zero(t, a.hits.Load(), "the failing heartbeat ejects the primary")
+	require.Equal(t, int32(1), b.hits.Load())
+
+	a.status.Store(http.StatusOK)
+	checkNow()
+	_, err = client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), a.hits.Load(), "a passing heartbeat restores the primary")
+
+	require.NoError(t, client.Close())
+	select {
+	case ticks <- time.Now():
+		t.Fatal("health checks stop on Close")
+	default:
+	}
+}
+
+func TestEndpointsPathPrefixes(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	client := newEndpointsClient(t, []string{a.URL + "/chroma/", b.URL + "/other/api/v2"},
+		WithHealthCheckInterval(0), WithEndpointPolicy(EndpointPolicyRoundRobin))
+	for i := 0; i < 2; i++ {
+		_, err := client.ExecuteRequest(context.Background(), http.MethodGet, "collections", nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, "/chroma/api/v2/collections", a.lastPath.Load())
+	require.Equal(t, "/other/api/v2/collections", b.lastPath.Load())
+}
+
+func TestWithEndpointsValidation(t *testing.T) {
+	_, err := NewHTTPClient(WithEndpoints(nil))
+	require.Error(t, err)
+	_, err = NewHTTPClient(WithEndpoints([]string{"http://a:8000", "http://a:8000/api/v2"}))
+	require.Error(t, err, "duplicate")
+	_, err = NewHTTPClient(WithEndpoints([]string{"localhost:8000"}))
+	require.Error(t, err)
+	_, err = NewHTTPClient(WithEndpoints([]string{"http://a:8000"}, WithEndpointPolicy("random")))
+	require.Error(t, err)
+	_, err = NewHTTPClient(WithEndpoints([]string{"http://a:8000"}), WithBaseURL("http://b:8000"))
+	require.ErrorContains(t, err, "WithEndpoints cannot be combined with WithBaseURL")
+	_, err = NewHTTPClient(WithBaseURL("http://b:8000"), WithEndpoints([]string{"http://a:8000"}))
+	require.ErrorContains(t, err, "WithEndpoints cannot be combined with WithBaseURL")
+	_, err = NewHTTPClient(WithBaseURL("http://a:8000"), WithEndpoints([]string{"http://a:8000"}))
+	require.ErrorContains(t, err, "WithEndpoints cannot be combined with WithBaseURL", "even for the same URL")
+}
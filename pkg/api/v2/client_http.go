@@ -27,6 +27,9 @@ type APIClientV2 struct {
 	preflightMu            sync.RWMutex
 	collectionCache        map[string]Collection
 	collectionMu           sync.RWMutex
+	aliases                *AliasManager
+	// maxBatchSize caps the max_batch_size of the pre-flight checks; 0 means no cap.
+	maxBatchSize int
 }
 
 func NewHTTPClient(opts ...ClientOption) (Client, error) {
@@ -57,6 +60,12 @@ func NewHTTPClient(opts ...ClientOption) (Client, error) {
 		preflightCompleted: false,
 		collectionCache:    map[string]Collection{},
 	}
+	if bc.aliases != nil {
+		c.aliases = newAliasManager(c, bc.aliases)
+	}
+	if c.endpoints != nil {
+		c.endpoints.startHealthChecks(c.Heartbeat)
+	}
 	return c, nil
 }
 
@@ -87,12 +96,16 @@ func (client *APIClientV2) PreFlight(ctx context.Context) error {
 	}
 	client.preflightConditionsRaw = preflightLimits
 	if mbs, ok := preflightLimits["max_batch_size"]; ok {
-		if maxBatchSize, ok := mbs.(float64); ok {
-			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationCreate))] = int(maxBatchSize)
-			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationGet))] = int(maxBatchSize)
-			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationQuery))] = int(maxBatchSize)
-			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationUpdate))] = int(maxBatchSize)
-			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationDelete))] = int(maxBatchSize)
+		if mbsValue, ok := mbs.(float64); ok {
+			maxBatchSize := int(mbsValue)
+			if client.maxBatchSize > 0 && client.maxBatchSize < maxBatchSize {
+				maxBatchSize = client.maxBatchSize
+			}
+			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationCreate))] = maxBatchSize
+			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationGet))] = maxBatchSize
+			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationQuery))] = maxBatchSize
+			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationUpdate))] = maxBatchSize
+			client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationDelete))] = maxBatchSize
 		}
 	}
 	client.preflightCompleted = true
@@ -429,6 +442,12 @@ func (client *APIClientV2) GetCollection(ctx context.Context, name string, opts
 	if err != nil {
 		return nil, errors.Wrap(err, "error preparing collection get request")
 	}
+	if client.aliases != nil && !req.skipAliasResolution {
+		if name, err = client.aliases.resolveCollectionName(ctx, req.Database, name); err != nil {
+			return nil, err
+		}
+		req.name = name
+	}
 	reqURL, err := url.JoinPath(client.BaseURL(), "tenants", req.Database.Tenant().Name(), "databases", req.Database.Name(), "collections", name)
 	if err != nil {
 		return nil, errors.Wrap(err, "error composing request URL")
@@ -453,6 +472,14 @@ func (client *APIClientV2) GetCollection(ctx context.Context, name string, opts
 		return nil, errors.Wrap(err, "error decoding response")
 	}
 	configuration := NewCollectionConfigurationFromMap(cm.ConfigurationJSON)
+	err = req.checkEmbeddingFunction(cm.Name, configuration, cm.Schema, cm.Metadata, cm.Dimension, func(err error) {
+		client.logger.Warn("embedding function does not match the collection",
+			logger.String("collection", cm.Name),
+			logger.ErrorField("error", err))
+	})
+	if err != nil {
+		return nil, err
+	}
 	// Auto-wire content EF first to avoid double factory instantiation
 	contentEF := req.contentEmbeddingFunction
 	if contentEF == nil {
@@ -672,6 +699,31 @@ func (client *APIClientV2) getPreFlightConditionsRaw() map[string]interface{} {
 	return cp
 }
 
+// packEmbeddings returns the float32 embeddings as base64 encoded little-endian float32
+// when the pre-flight checks report supports_base64_encoding, which is about a third of
+// the size of JSON number arrays. Otherwise, or for other embedding types, the
+// embeddings are sent as JSON arrays.
+func (client *APIClientV2) packEmbeddings(embs []any) []any {
+	sbe, ok := client.getPreFlightConditionsRaw()["supports_base64_encoding"]
+	if supportsBase64, isBool := sbe.(bool); !ok || !isBool || !supportsBase64 {
+		return embs
+	}
+	packedEmbeddings := make([]any, 0, len(embs))
+	for _, e := range embs {
+		f32Emb, ok := e.(*embeddings.Float32Embedding)
+		if !ok {
+			// Fallback to JSON encoding for non-Float32 embeddings
+			if client.logger.IsDebugEnabled() {
+				client.logger.Debug("base64 encoding not supported for embedding type, falling back to JSON")
+			}
+			packedEmbeddings = append(packedEmbeddings, e)
+			continue
+		}
+		packedEmbeddings = append(packedEmbeddings, packEmbeddingSafely(f32Emb.ContentAsFloat32()))
+	}
+	return packedEmbeddings
+}
+
 func (client *APIClientV2) satisfies(resourceOperation ResourceOperation, metric interface{}, metricName string) error {
 	client.preflightMu.RLock()
 	m, ok := client.preflightLimits[fmt.Sprintf("%s#%s", string(resourceOperation.Resource()), string(resourceOperation.Operation()))]
@@ -732,6 +784,9 @@ func (client *APIClientV2) GetIdentity(ctx context.Context) (Identity, error) {
 }
 
 func (client *APIClientV2) Close() error {
+	if client.endpoints != nil {
+		client.endpoints.close()
+	}
 	if client.httpClient != nil {
 		client.httpClient.CloseIdleConnections()
 	}
@@ -769,6 +824,14 @@ func (client *APIClientV2) Close() error {
 	return nil
 }
 
+// preflightMaxBatchSize returns the max_batch_size of the pre-flight checks, 0 when it is unknown.
+func (client *APIClientV2) preflightMaxBatchSize() int {
+	client.preflightMu.RLock()
+	defer client.preflightMu.RUnlock()
+	limit, _ := client.preflightLimits[fmt.Sprintf("%s#%s", string(ResourceCollection), string(OperationCreate))].(int)
+	return limit
+}
+
 func (client *APIClientV2) localSetPreflightLimit(maxBatchSize int) {
 	if maxBatchSize <= 0 {
 		return
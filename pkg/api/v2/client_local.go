@@ -3,10 +3,13 @@ package v2
 import (
 	"context"
 	stderrors "errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 
 	localchroma "github.com/amikos-tech/chroma-go-local"
 	"github.com/amikos-tech/chroma-go/pkg/logger"
@@ -90,6 +93,14 @@ type PersistentClient struct {
 	Client
 	mode   PersistentRuntimeMode
 	server localServer
+	lock   *localPersistLock
+
+	collectionDefaults *LocalCollectionDefaults
+
+	// reported by Diagnostics
+	libraryPath   string
+	persistPath   string
+	runtimeConfig *LocalRuntimeConfig
 }
 
 // PersistentClientOption configures a [PersistentClient].
@@ -104,6 +115,9 @@ type localClientConfig struct {
 	autoDownloadLibrary bool
 	configPath          string
 	rawYAML             string
+	runtimeConfig       *LocalRuntimeConfig
+	readOnly            bool
+	connectExisting     bool
 
 	persistPath   string
 	listenAddress string
@@ -113,6 +127,9 @@ type localClientConfig struct {
 	clientOptions []ClientOption
 
 	logger logger.Logger
+
+	// resolvedLibraryPath is the runtime library loaded by initLocalRuntimeLibrary.
+	resolvedLibraryPath string
 }
 
 func defaultLocalClientConfig() *localClientConfig {
@@ -135,6 +152,26 @@ func defaultLocalClientConfig() *localClientConfig {
 // Embedded mode is used by default. Use [WithPersistentRuntimeMode] (or server-specific options such as [WithPersistentPort])
 // to run a local HTTP server mode instead.
 func NewPersistentClient(opts ...PersistentClientOption) (Client, error) {
+	cfg, err := newLocalClientConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := acquireLocalPersistLock(cfg)
+	if err != nil {
+		var lockedErr *PersistPathLockedError
+		if cfg.connectExisting && errors.As(err, &lockedErr) {
+			return connectExistingLocalRuntime(cfg, lockedErr)
+		}
+		return nil, err
+	}
+	if err := initLocalRuntimeLibrary(cfg); err != nil {
+		_ = lock.release()
+		return nil, err
+	}
+	return openPersistentClient(cfg, lock)
+}
+
+func newLocalClientConfig(opts []PersistentClientOption) (*localClientConfig, error) {
 	cfg := defaultLocalClientConfig()
 	for _, opt := range opts {
 		if opt == nil {
@@ -144,31 +181,76 @@ func NewPersistentClient(opts ...PersistentClientOption) (Client, error) {
 			return nil, err
 		}
 	}
-	if err := validateLocalConfigSource(cfg.configPath, cfg.rawYAML); err != nil {
+	if err := validateLocalConfigSource(cfg.configPath, cfg.rawYAML, cfg.runtimeConfig); err != nil {
 		return nil, err
 	}
+	if cfg.runtimeMode == PersistentRuntimeModeServer && cfg.runtimeConfig != nil && cfg.runtimeConfig.WAL != nil {
+		// pruning restarts a server-mode runtime, which may move it to another port
+		return nil, errors.New("LocalRuntimeConfig.WAL is only supported in embedded mode")
+	}
+	return cfg, nil
+}
 
+func initLocalRuntimeLibrary(cfg *localClientConfig) error {
 	libraryPath, err := localResolveLibraryPathFunc(cfg)
 	if err != nil {
-		return nil, errors.Wrap(err, "error resolving local chroma runtime library path")
+		return errors.Wrap(err, "error resolving local chroma runtime library path")
 	}
 
 	if err := localInitFunc(libraryPath); err != nil {
-		return nil, errors.Wrap(err, "error initializing local chroma runtime")
+		return errors.Wrap(err, "error initializing local chroma runtime")
 	}
+	cfg.resolvedLibraryPath = libraryPath
+	return nil
+}
 
+// openPersistentClient starts the runtime on a persist path locked by lock. The client owns the lock
+// and releases it on Close; it is released here if the runtime fails to start.
+func openPersistentClient(cfg *localClientConfig, lock *localPersistLock) (Client, error) {
+	client, err := startPersistentClient(cfg)
+	if err != nil {
+		_ = lock.release()
+		return nil, err
+	}
+	client.lock = lock
+	client.setDiagnosticsInfo(cfg)
+	if client.server != nil {
+		if err := lock.setURL(client.server.URL()); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+	}
+	if cfg.readOnly {
+		client.Client = newReadOnlyClient(client.Client)
+	}
+	return client, nil
+}
+
+// setDiagnosticsInfo records the library and configuration of the runtime for [PersistentClient.Diagnostics].
+func (client *PersistentClient) setDiagnosticsInfo(cfg *localClientConfig) {
+	persistPath, _ := cfg.resolvedPersistPath()
+	client.libraryPath = cfg.resolvedLibraryPath
+	client.persistPath = persistPath
+	client.runtimeConfig = cfg.effectiveRuntimeConfig(persistPath)
+}
+
+func startPersistentClient(cfg *localClientConfig) (*PersistentClient, error) {
 	switch cfg.runtimeMode {
 	case PersistentRuntimeModeEmbedded:
 		embedded, err := startLocalEmbedded(cfg)
 		if err != nil {
 			return nil, errors.Wrap(err, "error starting local chroma embedded runtime")
 		}
+		if err := pruneLocalWAL(embedded, cfg.walConfig()); err != nil {
+			_ = embedded.Close()
+			return nil, err
+		}
 		embeddedClient, err := newEmbeddedLocalClient(cfg, embedded)
 		if err != nil {
 			_ = embedded.Close()
 			return nil, errors.Wrap(err, "error creating embedded local client")
 		}
-		return &PersistentClient{Client: embeddedClient, mode: PersistentRuntimeModeEmbedded}, nil
+		return &PersistentClient{Client: embeddedClient, mode: PersistentRuntimeModeEmbedded, collectionDefaults: cfg.collectionDefaults()}, nil
 
 	case PersistentRuntimeModeServer:
 		server, err := startLocalServer(cfg)
@@ -176,37 +258,53 @@ func NewPersistentClient(opts ...PersistentClientOption) (Client, error) {
 			return nil, errors.Wrap(err, "error starting local chroma runtime")
 		}
 
-		clientOptions := make([]ClientOption, 0, len(cfg.clientOptions)+2)
-		clientOptions = append(clientOptions, WithDatabaseAndTenant(DefaultDatabase, DefaultTenant))
-		clientOptions = append(clientOptions, cfg.clientOptions...)
-		clientOptions = append(clientOptions, WithBaseURL(server.URL()))
-
-		httpClient, err := NewHTTPClient(clientOptions...)
+		apiClient, err := newLocalHTTPClient(cfg, server.URL())
 		if err != nil {
 			_ = server.Close()
-			return nil, errors.Wrap(err, "error creating wrapped HTTP client for local runtime")
-		}
-
-		apiClient, ok := httpClient.(*APIClientV2)
-		if !ok {
-			_ = httpClient.Close()
-			_ = server.Close()
-			return nil, errors.New("unexpected client type returned by NewHTTPClient")
-		}
-
-		if err := localWaitReadyFunc(apiClient); err != nil {
-			_ = apiClient.Close()
-			_ = server.Close()
-			return nil, errors.Wrap(err, "local runtime server failed readiness checks")
+			return nil, err
 		}
 
-		return &PersistentClient{Client: apiClient, mode: PersistentRuntimeModeServer, server: server}, nil
+		return &PersistentClient{Client: apiClient, mode: PersistentRuntimeModeServer, server: server, collectionDefaults: cfg.collectionDefaults()}, nil
 
 	default:
 		return nil, errors.Errorf("unsupported local runtime mode: %s", cfg.runtimeMode)
 	}
 }
 
+// newLocalHTTPClient creates the HTTP client of a local server-mode runtime at url and waits until it is ready.
+func newLocalHTTPClient(cfg *localClientConfig, url string) (*APIClientV2, error) {
+	clientOptions := make([]ClientOption, 0, len(cfg.clientOptions)+2)
+	clientOptions = append(clientOptions, WithDatabaseAndTenant(DefaultDatabase, DefaultTenant))
+	clientOptions = append(clientOptions, cfg.clientOptions...)
+	clientOptions = append(clientOptions, WithBaseURL(url))
+
+	httpClient, err := NewHTTPClient(clientOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating wrapped HTTP client for local runtime")
+	}
+
+	apiClient, ok := httpClient.(*APIClientV2)
+	if !ok {
+		_ = httpClient.Close()
+		return nil, errors.New("unexpected client type returned by NewHTTPClient")
+	}
+	apiClient.maxBatchSize = int(cfg.maxBatchSize())
+
+	if err := localWaitReadyFunc(apiClient); err != nil {
+		_ = apiClient.Close()
+		return nil, errors.Wrap(err, "local runtime server failed readiness checks")
+	}
+	return apiClient, nil
+}
+
+// localClient returns the client of the runtime, without the read-only wrapper of [WithPersistentReadOnly].
+func (client *PersistentClient) localClient() Client {
+	if readOnly, ok := client.Client.(*readOnlyClient); ok {
+		return readOnly.Client
+	}
+	return client.Client
+}
+
 // BaseURL returns the local server URL when running in server mode.
 // Embedded mode returns an empty string.
 func (client *PersistentClient) BaseURL() string {
@@ -216,12 +314,33 @@ func (client *PersistentClient) BaseURL() string {
 	type baseURLProvider interface {
 		BaseURL() string
 	}
-	if provider, ok := client.Client.(baseURLProvider); ok {
+	if provider, ok := client.localClient().(baseURLProvider); ok {
 		return provider.BaseURL()
 	}
 	return ""
 }
 
+// CreateCollection creates a collection, applying the collection defaults of [WithPersistentRuntimeConfig]
+// when the request has no index settings of its own.
+func (client *PersistentClient) CreateCollection(ctx context.Context, name string, options ...CreateCollectionOption) (Collection, error) {
+	return client.Client.CreateCollection(ctx, name, client.withCollectionDefaults(options)...)
+}
+
+// GetOrCreateCollection gets or creates a collection, applying the collection defaults of
+// [WithPersistentRuntimeConfig] when the request has no index settings of its own.
+func (client *PersistentClient) GetOrCreateCollection(ctx context.Context, name string, options ...CreateCollectionOption) (Collection, error) {
+	return client.Client.GetOrCreateCollection(ctx, name, client.withCollectionDefaults(options)...)
+}
+
+func (client *PersistentClient) withCollectionDefaults(options []CreateCollectionOption) []CreateCollectionOption {
+	if client.collectionDefaults == nil {
+		return options
+	}
+	updated := make([]CreateCollectionOption, 0, len(options)+1)
+	updated = append(updated, options...)
+	return append(updated, withLocalCollectionDefaultsCreate(client.collectionDefaults))
+}
+
 func pollUntilReady(timeout, interval time.Duration, check func(ctx context.Context) error) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -284,10 +403,69 @@ func waitForLocalEmbeddedReady(embedded localEmbeddedRuntime) error {
 	})
 }
 
-func validateLocalConfigSource(configPath, rawYAML string) error {
+func (cfg *localClientConfig) collectionDefaults() *LocalCollectionDefaults {
+	if cfg.runtimeConfig == nil {
+		return nil
+	}
+	return cfg.runtimeConfig.CollectionDefaults
+}
+
+func (cfg *localClientConfig) walConfig() *LocalWALConfig {
+	if cfg.runtimeConfig == nil {
+		return nil
+	}
+	return cfg.runtimeConfig.WAL
+}
+
+func (cfg *localClientConfig) maxBatchSize() uint32 {
+	if cfg.runtimeConfig == nil {
+		return 0
+	}
+	return cfg.runtimeConfig.MaxBatchSize
+}
+
+// resolvedPersistPath returns the absolute persist directory the runtime will open with this configuration.
+func (cfg *localClientConfig) resolvedPersistPath() (string, error) {
+	persistPath := cfg.persistPath
+	if cfg.runtimeConfig != nil && cfg.runtimeConfig.PersistPath != "" {
+		persistPath = cfg.runtimeConfig.PersistPath
+	}
+	if cfg.configPath != "" || cfg.rawYAML != "" {
+		data := []byte(cfg.rawYAML)
+		if cfg.configPath != "" {
+			var err error
+			if data, err = os.ReadFile(cfg.configPath); err != nil {
+				return "", errors.Wrap(err, "error reading local runtime config")
+			}
+		}
+		// Only persist_path is read; the runtime validates the rest of the file.
+		var fileConfig struct {
+			PersistPath string `yaml:"persist_path"`
+		}
+		if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+			return "", errors.Wrap(err, "error reading persist path from local runtime config")
+		}
+		if fileConfig.PersistPath != "" {
+			persistPath = fileConfig.PersistPath
+		}
+	}
+	if strings.TrimSpace(persistPath) == "" {
+		return "", errors.New("persist path cannot be empty")
+	}
+	absPath, err := filepath.Abs(persistPath)
+	if err != nil {
+		return "", errors.Wrap(err, "error resolving persist path")
+	}
+	return absPath, nil
+}
+
+func validateLocalConfigSource(configPath, rawYAML string, runtimeConfig *LocalRuntimeConfig) error {
 	if strings.TrimSpace(configPath) != "" && strings.TrimSpace(rawYAML) != "" {
 		return errors.New("WithPersistentConfigPath and WithPersistentRawYAML are mutually exclusive")
 	}
+	if runtimeConfig != nil && (strings.TrimSpace(configPath) != "" || strings.TrimSpace(rawYAML) != "") {
+		return errors.New("WithPersistentRuntimeConfig is mutually exclusive with WithPersistentConfigPath and WithPersistentRawYAML")
+	}
 	return nil
 }
 
@@ -301,6 +479,16 @@ func startLocalEmbedded(cfg *localClientConfig) (localEmbeddedRuntime, error) {
 	if cfg.rawYAML != "" {
 		return localStartEmbeddedFunc(localchroma.StartEmbeddedConfig{ConfigString: cfg.rawYAML})
 	}
+	if cfg.runtimeConfig != nil {
+		configYAML, err := cfg.runtimeConfig.runtimeYAML(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.runtimeConfig.setRuntimeEnv(); err != nil {
+			return nil, err
+		}
+		return localStartEmbeddedFunc(localchroma.StartEmbeddedConfig{ConfigString: configYAML})
+	}
 
 	opts := []localchroma.EmbeddedOption{
 		localchroma.WithEmbeddedPersistPath(cfg.persistPath),
@@ -319,6 +507,16 @@ func startLocalServer(cfg *localClientConfig) (localServer, error) {
 	if cfg.rawYAML != "" {
 		return localStartServerFunc(localchroma.StartServerConfig{ConfigString: cfg.rawYAML})
 	}
+	if cfg.runtimeConfig != nil {
+		configYAML, err := cfg.runtimeConfig.runtimeYAML(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.runtimeConfig.setRuntimeEnv(); err != nil {
+			return nil, err
+		}
+		return localStartServerFunc(localchroma.StartServerConfig{ConfigString: configYAML})
+	}
 
 	opts := []localchroma.ServerOption{
 		// Let the runtime bind port 0 directly to avoid TOCTOU between probing and binding.
@@ -348,6 +546,11 @@ func (client *PersistentClient) Close() error {
 			errs = append(errs, errors.Wrap(err, "error closing local runtime server"))
 		}
 	}
+	// The lock is released last, once the runtime no longer touches the persist path.
+	if err := client.lock.release(); err != nil {
+		errs = append(errs, err)
+	}
+	client.lock = nil
 	if len(errs) > 0 {
 		return stderrors.Join(errs...)
 	}
@@ -465,6 +668,50 @@ func WithPersistentRawYAML(yaml string) PersistentClientOption {
 	}
 }
 
+// WithPersistentRuntimeConfig starts the local runtime from a typed [LocalRuntimeConfig].
+//
+// The config is validated when the option is applied and rendered to YAML when the runtime starts.
+// Empty storage and network fields fall back to options such as [WithPersistentPath] and [WithPersistentPort].
+// Unlike the YAML options it keeps the selected runtime mode.
+// This option is mutually exclusive with [WithPersistentConfigPath] and [WithPersistentRawYAML].
+func WithPersistentRuntimeConfig(config *LocalRuntimeConfig) PersistentClientOption {
+	return func(cfg *localClientConfig) error {
+		if config == nil {
+			return errors.New("local runtime config cannot be nil")
+		}
+		if err := config.Validate(); err != nil {
+			return errors.Wrap(err, "invalid local runtime config")
+		}
+		cfg.runtimeConfig = config.clone()
+		return nil
+	}
+}
+
+// WithPersistentReadOnly opens the persistent client in read-only mode.
+//
+// Tenant, database, collection and record changes through the client fail with [ErrPersistentReadOnly], and
+// GetOrCreateCollection only gets existing collections. The persist path is still locked exclusively, because
+// the runtime maintains its files (for example compaction) even when the client does not write.
+func WithPersistentReadOnly(readOnly bool) PersistentClientOption {
+	return func(cfg *localClientConfig) error {
+		cfg.readOnly = readOnly
+		return nil
+	}
+}
+
+// WithPersistentConnectExisting connects to the runtime of another process when the persist path is in use.
+//
+// Only one client may open a persist path. With this option, when the path is held by a runtime started in
+// server mode, the client connects to its local server over HTTP instead of failing with
+// [*PersistPathLockedError]; the runtime keeps running in the owning process. Runtimes opened in embedded mode
+// cannot be shared. When the path is free, the client starts its own runtime as usual.
+func WithPersistentConnectExisting(connect bool) PersistentClientOption {
+	return func(cfg *localClientConfig) error {
+		cfg.connectExisting = connect
+		return nil
+	}
+}
+
 // WithPersistentPath sets the local persistence directory.
 func WithPersistentPath(path string) PersistentClientOption {
 	return func(cfg *localClientConfig) error {
@@ -477,6 +724,7 @@ func WithPersistentPath(path string) PersistentClientOption {
 }
 
 // WithPersistentListenAddress sets the local server listen address.
+// The local server only listens on TCP; Unix domain sockets are not supported by the local runtime.
 //
 // This option selects server runtime mode.
 func WithPersistentListenAddress(address string) PersistentClientOption {
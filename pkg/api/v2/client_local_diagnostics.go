@@ -0,0 +1,607 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	localchroma "github.com/amikos-tech/chroma-go-local"
+	"github.com/pkg/errors"
+)
+
+// localDiagnosticsPageSize is the page size used to list databases and collections for diagnostics.
+const localDiagnosticsPageSize = 100
+
+// LocalDiagnostics is a point-in-time report of the local runtime of a [PersistentClient].
+//
+// Collection and record counts cover the databases of the client's current tenant. Failures to collect
+// individual values are listed in Errors instead of failing the whole report.
+type LocalDiagnostics struct {
+	CollectedAt time.Time             `json:"collected_at"`
+	Mode        PersistentRuntimeMode `json:"mode"`
+	// Healthy reports the runtime health check in embedded mode and the server heartbeat in server mode.
+	Healthy bool `json:"healthy"`
+	// LibraryVersion and LibraryPath describe the native runtime library. They are empty for clients
+	// connected with [WithPersistentConnectExisting], which do not load the library.
+	LibraryVersion string `json:"library_version,omitempty"`
+	LibraryPath    string `json:"library_path,omitempty"`
+	// URL is the address of the local server in server mode.
+	URL         string                     `json:"url,omitempty"`
+	PersistPath string                     `json:"persist_path,omitempty"`
+	Disk        LocalDiskUsage             `json:"disk"`
+	Tenant      string                     `json:"tenant"`
+	Databases   []LocalDatabaseDiagnostics `json:"databases"`
+	// OpenCollectionHandles is the number of collections the client holds state, such as embedding
+	// functions, for.
+	OpenCollectionHandles int `json:"open_collection_handles"`
+	// OpenFileDescriptors is the number of file descriptors open in this process, 0 where it cannot be read.
+	OpenFileDescriptors int `json:"open_file_descriptors,omitempty"`
+	// RuntimeConfig is the effective runtime configuration, with storage and network fields filled from
+	// the persistent client options. Values of untyped keys (Extra) are redacted, they may hold secrets.
+	RuntimeConfig *LocalRuntimeConfig `json:"runtime_config,omitempty"`
+	Errors        []string            `json:"errors,omitempty"`
+}
+
+// LocalDiskUsage is the size of the files below the persist path.
+type LocalDiskUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int   `json:"files"`
+}
+
+// LocalDatabaseDiagnostics holds the collections of a database.
+type LocalDatabaseDiagnostics struct {
+	Name            string                       `json:"name"`
+	CollectionCount int                          `json:"collection_count"`
+	RecordCount     int64                        `json:"record_count"`
+	Collections     []LocalCollectionDiagnostics `json:"collections"`
+}
+
+// LocalCollectionDiagnostics holds the record count and indexing backlog of a collection.
+type LocalCollectionDiagnostics struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	RecordCount int64  `json:"record_count"`
+	// Indexing is nil when the runtime did not report the indexing status.
+	Indexing *IndexingStatus `json:"indexing,omitempty"`
+}
+
+// localDiagnosticsCollection identifies a collection listed for diagnostics.
+type localDiagnosticsCollection struct {
+	id, name string
+}
+
+// localDiagnosticsSource reads runtime statistics without building collection clients, so that listing
+// collections does not instantiate their embedding functions.
+type localDiagnosticsSource interface {
+	healthy(ctx context.Context) bool
+	listDatabases(ctx context.Context, tenant Tenant) ([]string, error)
+	listCollections(ctx context.Context, database Database) ([]localDiagnosticsCollection, error)
+	countRecords(ctx context.Context, database Database, collection localDiagnosticsCollection) (int, error)
+	indexingStatus(ctx context.Context, database Database, collection localDiagnosticsCollection) (*IndexingStatus, error)
+	openCollectionHandles() int
+}
+
+// Diagnostics reports the state of the local runtime: library, disk usage of the persist path,
+// collection and record counts, indexing backlog, open handles and runtime configuration.
+//
+// Counting walks every collection of the current tenant, so avoid calling it on a hot path.
+func (client *PersistentClient) Diagnostics(ctx context.Context) (*LocalDiagnostics, error) {
+	if client == nil || client.Client == nil {
+		return nil, errors.New("persistent client is not initialized")
+	}
+	source, err := client.diagnosticsSource()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &LocalDiagnostics{
+		CollectedAt:         time.Now().UTC(),
+		Mode:                client.mode,
+		LibraryPath:         client.libraryPath,
+		URL:                 client.BaseURL(),
+		PersistPath:         client.persistPath,
+		Tenant:              client.CurrentTenant().Name(),
+		Databases:           []LocalDatabaseDiagnostics{},
+		OpenFileDescriptors: localOpenFileDescriptors(),
+		RuntimeConfig:       client.runtimeConfig.redacted(),
+	}
+	d.Healthy = source.healthy(ctx)
+	d.OpenCollectionHandles = source.openCollectionHandles()
+	if client.libraryPath != "" {
+		if version, err := localVersionWithErrorFunc(); err != nil {
+			d.addError("library version", err)
+		} else {
+			d.LibraryVersion = version
+		}
+	}
+	if client.persistPath != "" {
+		usage, err := localDiskUsage(client.persistPath)
+		if err != nil {
+			d.addError("disk usage", err)
+		}
+		d.Disk = usage
+	}
+
+	tenant := client.CurrentTenant()
+	databases, err := source.listDatabases(ctx, tenant)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		d.addError("list databases", err)
+	}
+	for _, name := range databases {
+		database := NewDatabase(name, tenant)
+		dbDiagnostics := LocalDatabaseDiagnostics{Name: name, Collections: []LocalCollectionDiagnostics{}}
+		collections, err := source.listCollections(ctx, database)
+		if err != nil {
+			d.addError(fmt.Sprintf("database %s: list collections", name), err)
+		}
+		for _, collection := range collections {
+			colDiagnostics := LocalCollectionDiagnostics{ID: collection.id, Name: collection.name}
+			if count, err := source.countRecords(ctx, database, collection); err != nil {
+				d.addError(fmt.Sprintf("collection %s/%s: count", name, collection.name), err)
+			} else {
+				colDiagnostics.RecordCount = int64(count)
+			}
+			if status, err := source.indexingStatus(ctx, database, collection); err != nil {
+				d.addError(fmt.Sprintf("collection %s/%s: indexing status", name, collection.name), err)
+			} else {
+				colDiagnostics.Indexing = status
+			}
+			dbDiagnostics.RecordCount += colDiagnostics.RecordCount
+			dbDiagnostics.Collections = append(dbDiagnostics.Collections, colDiagnostics)
+		}
+		dbDiagnostics.CollectionCount = len(dbDiagnostics.Collections)
+		d.Databases = append(d.Databases, dbDiagnostics)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func (d *LocalDiagnostics) addError(what string, err error) {
+	d.Errors = append(d.Errors, fmt.Sprintf("%s: %v", what, err))
+}
+
+func (client *PersistentClient) diagnosticsSource() (localDiagnosticsSource, error) {
+	switch c := client.localClient().(type) {
+	case *embeddedLocalClient:
+		return embeddedDiagnosticsSource{client: c}, nil
+	case *APIClientV2:
+		return httpDiagnosticsSource{client: c}, nil
+	default:
+		return nil, errors.Errorf("diagnostics are not supported for client type %T", c)
+	}
+}
+
+// DiagnosticsHandler returns an http.Handler serving [PersistentClient.Diagnostics]. It responds with
+// JSON by default and with the Prometheus text format for ?format=prometheus or when the Accept header
+// asks for text/plain or OpenMetrics, as Prometheus scrapers do. JSON responses of an unhealthy runtime
+// have status 503; metrics are always served with status 200, health is reported by chroma_local_up.
+func (client *PersistentClient) DiagnosticsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		d, err := client.Diagnostics(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var buf bytes.Buffer
+		prometheus := wantsPrometheus(r)
+		if prometheus {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			err = d.WritePrometheus(&buf)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(&buf).Encode(d)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// scrapers drop every sample of a failed scrape
+		if !d.Healthy && !prometheus {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+func wantsPrometheus(r *http.Request) bool {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "prometheus":
+		return true
+	case "json":
+		return false
+	}
+	accept := strings.ToLower(r.Header.Get("Accept"))
+	return strings.Contains(accept, "text/plain") || strings.Contains(accept, "application/openmetrics-text")
+}
+
+// WritePrometheus writes the diagnostics in the Prometheus text exposition format.
+func (d *LocalDiagnostics) WritePrometheus(w io.Writer) error {
+	p := &prometheusWriter{}
+	p.metric("chroma_local_info", "gauge", "Local runtime information.")
+	p.sample("chroma_local_info", 1, "mode", string(d.Mode), "version", d.LibraryVersion)
+	p.metric("chroma_local_up", "gauge", "Whether the local runtime is healthy.")
+	p.sample("chroma_local_up", boolGauge(d.Healthy))
+	p.metric("chroma_local_persist_size_bytes", "gauge", "Size of the files below the persist path.")
+	p.sample("chroma_local_persist_size_bytes", float64(d.Disk.Bytes))
+	p.metric("chroma_local_persist_files", "gauge", "Number of files below the persist path.")
+	p.sample("chroma_local_persist_files", float64(d.Disk.Files))
+	p.metric("chroma_local_open_collection_handles", "gauge", "Collections the client holds state for.")
+	p.sample("chroma_local_open_collection_handles", float64(d.OpenCollectionHandles))
+	if d.OpenFileDescriptors > 0 {
+		p.metric("chroma_local_open_file_descriptors", "gauge", "File descriptors open in the process.")
+		p.sample("chroma_local_open_file_descriptors", float64(d.OpenFileDescriptors))
+	}
+	p.metric("chroma_local_diagnostics_errors", "gauge", "Values that could not be collected.")
+	p.sample("chroma_local_diagnostics_errors", float64(len(d.Errors)))
+
+	p.metric("chroma_local_database_collections", "gauge", "Number of collections per database.")
+	for _, db := range d.Databases {
+		p.sample("chroma_local_database_collections", float64(db.CollectionCount), "tenant", d.Tenant, "database", db.Name)
+	}
+	p.metric("chroma_local_database_records", "gauge", "Number of records per database.")
+	for _, db := range d.Databases {
+		p.sample("chroma_local_database_records", float64(db.RecordCount), "tenant", d.Tenant, "database", db.Name)
+	}
+	p.metric("chroma_local_collection_records", "gauge", "Number of records per collection.")
+	for _, db := range d.Databases {
+		for _, col := range db.Collections {
+			p.sample("chroma_local_collection_records", float64(col.RecordCount), "tenant", d.Tenant, "database", db.Name, "collection", col.Name)
+		}
+	}
+	p.metric("chroma_local_collection_unindexed_ops", "gauge", "Operations waiting to be indexed per collection.")
+	for _, db := range d.Databases {
+		for _, col := range db.Collections {
+			if col.Indexing != nil {
+				p.sample("chroma_local_collection_unindexed_ops", float64(col.Indexing.NumUnindexedOps), "tenant", d.Tenant, "database", db.Name, "collection", col.Name)
+			}
+		}
+	}
+	p.metric("chroma_local_collection_indexing_progress", "gauge", "Fraction of operations indexed per collection.")
+	for _, db := range d.Databases {
+		for _, col := range db.Collections {
+			if col.Indexing != nil {
+				p.sample("chroma_local_collection_indexing_progress", col.Indexing.OpIndexingProgress, "tenant", d.Tenant, "database", db.Name, "collection", col.Name)
+			}
+		}
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+type prometheusWriter struct {
+	buf bytes.Buffer
+}
+
+func (p *prometheusWriter) metric(name, metricType, help string) {
+	fmt.Fprintf(&p.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// sample writes a sample with labels given as name/value pairs.
+func (p *prometheusWriter) sample(name string, value float64, labels ...string) {
+	p.buf.WriteString(name)
+	if len(labels) > 0 {
+		p.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&p.buf, "%s=\"%s\"", labels[i], prometheusLabelReplacer.Replace(labels[i+1]))
+		}
+		p.buf.WriteByte('}')
+	}
+	p.buf.WriteByte(' ')
+	p.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	p.buf.WriteByte('\n')
+}
+
+var prometheusLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// localDiskUsage sums the sizes of the regular files below path. A path the runtime has not created yet
+// has no usage.
+func localDiskUsage(path string) (LocalDiskUsage, error) {
+	var usage LocalDiskUsage
+	err := filepath.WalkDir(path, func(walked string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if walked == path && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		usage.Bytes += info.Size()
+		usage.Files++
+		return nil
+	})
+	return usage, err
+}
+
+// localOpenFileDescriptors counts the open file descriptors of this process where /proc is available.
+func localOpenFileDescriptors() int {
+	if runtime.GOOS != "linux" {
+		return 0
+	}
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0
+	}
+	// ReadDir holds one descriptor for the directory itself.
+	return len(entries) - 1
+}
+
+// effectiveRuntimeConfig returns the runtime configuration reported by [PersistentClient.Diagnostics].
+func (cfg *localClientConfig) effectiveRuntimeConfig(persistPath string) *LocalRuntimeConfig {
+	resolved := &LocalRuntimeConfig{}
+	switch {
+	case cfg.runtimeConfig != nil:
+		resolved = cfg.runtimeConfig.clone()
+	case cfg.configPath != "":
+		if loaded, err := LoadLocalRuntimeConfig(cfg.configPath); err == nil {
+			resolved = loaded
+		}
+	case cfg.rawYAML != "":
+		if parsed, err := ParseLocalRuntimeConfig([]byte(cfg.rawYAML)); err == nil {
+			resolved = parsed
+		}
+	}
+	if persistPath != "" {
+		resolved.PersistPath = persistPath
+	}
+	if !resolved.AllowReset {
+		resolved.AllowReset = cfg.allowReset
+	}
+	if cfg.runtimeMode == PersistentRuntimeModeServer {
+		if resolved.ListenAddress == "" {
+			resolved.ListenAddress = cfg.listenAddress
+		}
+		if resolved.Port == 0 {
+			resolved.Port = cfg.port
+		}
+	}
+	return resolved
+}
+
+// redacted returns a copy of the configuration reported by diagnostics, with the values of Extra replaced.
+func (c *LocalRuntimeConfig) redacted() *LocalRuntimeConfig {
+	if c == nil {
+		return nil
+	}
+	copied := c.clone()
+	for k := range copied.Extra {
+		copied.Extra[k] = localRedactedValue
+	}
+	return copied
+}
+
+// localRedactedValue replaces configuration values that are not reported.
+const localRedactedValue = "[REDACTED]"
+
+// embeddedDiagnosticsSource reads statistics from the embedded runtime.
+type embeddedDiagnosticsSource struct {
+	client *embeddedLocalClient
+}
+
+func (s embeddedDiagnosticsSource) healthy(context.Context) bool {
+	health, err := s.client.embedded.Healthcheck()
+	return err == nil && health != nil && health.IsExecutorReady && health.IsLogClientReady
+}
+
+func (s embeddedDiagnosticsSource) listDatabases(ctx context.Context, tenant Tenant) ([]string, error) {
+	names := make([]string, 0)
+	for offset := uint32(0); ; offset += localDiagnosticsPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := s.client.embedded.ListDatabases(localchroma.EmbeddedListDatabasesRequest{
+			TenantID: tenant.Name(),
+			Limit:    localDiagnosticsPageSize,
+			Offset:   offset,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, db := range page {
+			names = append(names, db.Name)
+		}
+		if len(page) < localDiagnosticsPageSize {
+			return names, nil
+		}
+	}
+}
+
+func (s embeddedDiagnosticsSource) listCollections(ctx context.Context, database Database) ([]localDiagnosticsCollection, error) {
+	collections := make([]localDiagnosticsCollection, 0)
+	for offset := uint32(0); ; offset += localDiagnosticsPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := s.client.embedded.ListCollections(localchroma.EmbeddedListCollectionsRequest{
+			TenantID:     database.Tenant().Name(),
+			DatabaseName: database.Name(),
+			Limit:        localDiagnosticsPageSize,
+			Offset:       offset,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range page {
+			collections = append(collections, localDiagnosticsCollection{id: col.ID, name: col.Name})
+		}
+		if len(page) < localDiagnosticsPageSize {
+			sortLocalDiagnosticsCollections(collections)
+			return collections, nil
+		}
+	}
+}
+
+func (s embeddedDiagnosticsSource) countRecords(ctx context.Context, database Database, collection localDiagnosticsCollection) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	count, err := s.client.embedded.CountRecords(localchroma.EmbeddedCountRecordsRequest{
+		CollectionID: collection.id,
+		TenantID:     database.Tenant().Name(),
+		DatabaseName: database.Name(),
+	})
+	return int(count), err
+}
+
+func (s embeddedDiagnosticsSource) indexingStatus(ctx context.Context, database Database, collection localDiagnosticsCollection) (*IndexingStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	status, err := s.client.embedded.IndexingStatus(localchroma.EmbeddedIndexingStatusRequest{
+		CollectionID: collection.id,
+		DatabaseName: database.Name(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &IndexingStatus{
+		NumIndexedOps:      status.NumIndexedOps,
+		NumUnindexedOps:    status.NumUnindexedOps,
+		TotalOps:           status.TotalOps,
+		OpIndexingProgress: float64(status.OpIndexingProgress),
+	}, nil
+}
+
+func (s embeddedDiagnosticsSource) openCollectionHandles() int {
+	s.client.collectionStateMu.RLock()
+	defer s.client.collectionStateMu.RUnlock()
+	return len(s.client.collectionState)
+}
+
+// httpDiagnosticsSource reads statistics from the local server in server mode.
+type httpDiagnosticsSource struct {
+	client *APIClientV2
+}
+
+func (s httpDiagnosticsSource) healthy(ctx context.Context) bool {
+	return s.client.Heartbeat(ctx) == nil
+}
+
+func (s httpDiagnosticsSource) listDatabases(ctx context.Context, tenant Tenant) ([]string, error) {
+	basePath, err := url.JoinPath("tenants", tenant.Name(), "databases")
+	if err != nil {
+		return nil, errors.Wrap(err, "error composing request URL")
+	}
+	names := make([]string, 0)
+	for offset := 0; ; offset += localDiagnosticsPageSize {
+		query := url.Values{}
+		query.Set("limit", strconv.Itoa(localDiagnosticsPageSize))
+		query.Set("offset", strconv.Itoa(offset))
+		resp, err := s.client.ExecuteRequest(ctx, http.MethodGet, basePath+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		var page []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(resp, &page); err != nil {
+			return nil, errors.Wrap(err, "error decoding response")
+		}
+		for _, db := range page {
+			names = append(names, db.Name)
+		}
+		if len(page) < localDiagnosticsPageSize {
+			return names, nil
+		}
+	}
+}
+
+func (s httpDiagnosticsSource) listCollections(ctx context.Context, database Database) ([]localDiagnosticsCollection, error) {
+	basePath, err := url.JoinPath("tenants", database.Tenant().Name(), "databases", database.Name(), "collections")
+	if err != nil {
+		return nil, errors.Wrap(err, "error composing request URL")
+	}
+	collections := make([]localDiagnosticsCollection, 0)
+	for offset := 0; ; offset += localDiagnosticsPageSize {
+		query := url.Values{}
+		query.Set("limit", strconv.Itoa(localDiagnosticsPageSize))
+		query.Set("offset", strconv.Itoa(offset))
+		resp, err := s.client.ExecuteRequest(ctx, http.MethodGet, basePath+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		var page []CollectionModel
+		if err := json.Unmarshal(resp, &page); err != nil {
+			return nil, errors.Wrap(err, "error decoding response")
+		}
+		for _, col := range page {
+			collections = append(collections, localDiagnosticsCollection{id: col.ID, name: col.Name})
+		}
+		if len(page) < localDiagnosticsPageSize {
+			sortLocalDiagnosticsCollections(collections)
+			return collections, nil
+		}
+	}
+}
+
+// collection returns a collection client without embedding functions for count and indexing requests.
+func (s httpDiagnosticsSource) collection(database Database, collection localDiagnosticsCollection) *CollectionImpl {
+	return &CollectionImpl{
+		name:     collection.name,
+		id:       collection.id,
+		tenant:   database.Tenant(),
+		database: database,
+		client:   s.client,
+	}
+}
+
+func (s httpDiagnosticsSource) countRecords(ctx context.Context, database Database, collection localDiagnosticsCollection) (int, error) {
+	return s.collection(database, collection).Count(ctx)
+}
+
+func (s httpDiagnosticsSource) indexingStatus(ctx context.Context, database Database, collection localDiagnosticsCollection) (*IndexingStatus, error) {
+	return s.collection(database, collection).IndexingStatus(ctx)
+}
+
+func (s httpDiagnosticsSource) openCollectionHandles() int {
+	s.client.collectionMu.RLock()
+	defer s.client.collectionMu.RUnlock()
+	return len(s.client.collectionCache)
+}
+
+func sortLocalDiagnosticsCollections(collections []localDiagnosticsCollection) {
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].name < collections[j].name
+	})
+}
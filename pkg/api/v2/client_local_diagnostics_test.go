@@ -0,0 +1,206 @@
+//go:build basicv2 && !cloud
+// +build basicv2,!cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	localchroma "github.com/amikos-tech/chroma-go-local"
+	embeddingspkg "github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// diagnosticsEmbeddedRuntime lists the default database and reports a fixed indexing backlog.
+type diagnosticsEmbeddedRuntime struct {
+	*memoryEmbeddedRuntime
+}
+
+func (r *diagnosticsEmbeddedRuntime) ListDatabases(request localchroma.EmbeddedListDatabasesRequest) ([]localchroma.EmbeddedDatabase, error) {
+	if request.Offset > 0 {
+		return nil, nil
+	}
+	return []localchroma.EmbeddedDatabase{{Name: DefaultDatabase, Tenant: DefaultTenant}}, nil
+}
+
+func (r *diagnosticsEmbeddedRuntime) IndexingStatus(localchroma.EmbeddedIndexingStatusRequest) (*localchroma.EmbeddedIndexingStatusResponse, error) {
+	return &localchroma.EmbeddedIndexingStatusResponse{NumIndexedOps: 1, NumUnindexedOps: 2, TotalOps: 3, OpIndexingProgress: 0.25}, nil
+}
+
+func stubDiagnosticsRuntime(t *testing.T, server *stubLocalServer) {
+	t.Helper()
+	stubLocalServerRuntime(t, server)
+	origVersion := localVersionWithErrorFunc
+	origStartEmbedded := localStartEmbeddedFunc
+	t.Cleanup(func() {
+		localVersionWithErrorFunc = origVersion
+		localStartEmbeddedFunc = origStartEmbedded
+	})
+	localVersionWithErrorFunc = func() (string, error) { return "0.3.5", nil }
+	localStartEmbeddedFunc = func(localchroma.StartEmbeddedConfig) (localEmbeddedRuntime, error) {
+		return &diagnosticsEmbeddedRuntime{memoryEmbeddedRuntime: newMemoryEmbeddedRuntime()}, nil
+	}
+}
+
+func newDiagnosticsTestClient(t *testing.T) *PersistentClient {
+	t.Helper()
+	stubDiagnosticsRuntime(t, &stubLocalServer{})
+
+	persistPath := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.MkdirAll(persistPath, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(persistPath, "chroma.sqlite3"), make([]byte, 1024), 0o644))
+
+	client, err := NewPersistentClient(WithPersistentPath(persistPath), WithPersistentRuntimeConfig(&LocalRuntimeConfig{
+		MaxBatchSize: 64,
+		Extra:        map[string]any{"auth_token": "s3cret"},
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	ctx := context.Background()
+	ef := embeddingspkg.NewConsistentHashEmbeddingFunction()
+	docs, err := client.CreateCollection(ctx, "docs", WithEmbeddingFunctionCreate(ef))
+	require.NoError(t, err)
+	require.NoError(t, docs.Add(ctx, WithIDs("1", "2"), WithTexts("hello", "world")))
+	_, err = client.CreateCollection(ctx, "empty", WithEmbeddingFunctionCreate(ef))
+	require.NoError(t, err)
+	return client.(*PersistentClient)
+}
+
+func TestPersistentClientDiagnostics_Embedded(t *testing.T) {
+	client := newDiagnosticsTestClient(t)
+
+	d, err := client.Diagnostics(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, d.Errors)
+	require.Equal(t, PersistentRuntimeModeEmbedded, d.Mode)
+	require.True(t, d.Healthy)
+	require.Equal(t, "0.3.5", d.LibraryVersion)
+	require.Equal(t, "/tmp/libchroma_go_shim.so", d.LibraryPath)
+	require.Equal(t, client.persistPath, d.PersistPath)
+	require.Equal(t, LocalDiskUsage{Bytes: 1024, Files: 1}, d.Disk)
+	require.Equal(t, 2, d.OpenCollectionHandles)
+	require.Equal(t, uint32(64), d.RuntimeConfig.MaxBatchSize)
+	require.Equal(t, d.PersistPath, d.RuntimeConfig.PersistPath)
+	require.Equal(t, map[string]any{"auth_token": localRedactedValue}, d.RuntimeConfig.Extra)
+	require.Equal(t, "s3cret", client.runtimeConfig.Extra["auth_token"], "the client config is not modified")
+
+	require.Len(t, d.Databases, 1)
+	db := d.Databases[0]
+	require.Equal(t, DefaultDatabase, db.Name)
+	require.Equal(t, 2, db.CollectionCount)
+	require.Equal(t, int64(2), db.RecordCount)
+	require.Equal(t, "docs", db.Collections[0].Name)
+	require.Equal(t, int64(2), db.Collections[0].RecordCount)
+	require.Equal(t, uint64(2), db.Collections[0].Indexing.NumUnindexedOps)
+	require.Equal(t, "empty", db.Collections[1].Name)
+}
+
+func TestPersistentClientDiagnosticsHandler(t *testing.T) {
+	client := newDiagnosticsTestClient(t)
+	handler := client.DiagnosticsHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/diagnostics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var d LocalDiagnostics
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &d))
+	require.Equal(t, int64(2), d.Databases[0].RecordCount)
+	require.NotContains(t, rec.Body.String(), "s3cret")
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+	body := rec.Body.String()
+	require.Contains(t, body, "# TYPE chroma_local_up gauge\nchroma_local_up 1\n")
+	require.Contains(t, body, `chroma_local_info{mode="embedded",version="0.3.5"} 1`)
+	require.Contains(t, body, `chroma_local_persist_size_bytes 1024`)
+	require.Contains(t, body, `chroma_local_database_records{tenant="default_tenant",database="default_database"} 2`)
+	require.Contains(t, body, `chroma_local_collection_unindexed_ops{tenant="default_tenant",database="default_database",collection="docs"} 2`)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?format=json", nil))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestPersistentClientDiagnostics_Server(t *testing.T) {
+	var unhealthy atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/heartbeat", func(w http.ResponseWriter, _ *http.Request) {
+		if unhealthy.Load() {
+			http.Error(w, `{"error":"Unavailable"}`, http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"nanosecond heartbeat": 1}`))
+	})
+	var databasePages []string
+	mux.HandleFunc("/api/v2/tenants/default_tenant/databases", func(w http.ResponseWriter, r *http.Request) {
+		databasePages = append(databasePages, r.URL.RawQuery)
+		if r.URL.Query().Get("offset") != "0" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id":"db-1","name":"default_database","tenant":"default_tenant"}]`))
+	})
+	mux.HandleFunc("/api/v2/tenants/default_tenant/databases/default_database/collections", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("offset") != "0" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id":"c-1","name":"docs","tenant":"default_tenant","database":"default_database"}]`))
+	})
+	mux.HandleFunc("/api/v2/tenants/default_tenant/databases/default_database/collections/c-1/count", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`7`))
+	})
+	mux.HandleFunc("/api/v2/tenants/default_tenant/databases/default_database/collections/c-1/indexing_status", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"error":"NotFound"}`, http.StatusNotFound)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	stubDiagnosticsRuntime(t, &stubLocalServer{url: srv.URL})
+	client, err := NewPersistentClient(WithPersistentPath(filepath.Join(t.TempDir(), "data")), WithPersistentPort(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	d, err := client.(*PersistentClient).Diagnostics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, PersistentRuntimeModeServer, d.Mode)
+	require.True(t, d.Healthy)
+	require.Equal(t, srv.URL+"/api/v2", d.URL)
+	require.Len(t, d.Databases, 1)
+	require.Equal(t, int64(7), d.Databases[0].RecordCount)
+	require.Nil(t, d.Databases[0].Collections[0].Indexing)
+	require.Equal(t, LocalDiskUsage{}, d.Disk)
+	require.Len(t, d.Errors, 1)
+	require.Contains(t, d.Errors[0], "indexing status")
+	require.Equal(t, []string{"limit=100&offset=0"}, databasePages)
+
+	// an unhealthy runtime fails JSON requests, but metrics are still scraped
+	unhealthy.Store(true)
+	handler := client.(*PersistentClient).DiagnosticsHandler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/diagnostics", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?format=prometheus", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "chroma_local_up 0\n")
+}
@@ -36,6 +36,7 @@ type localClientState interface {
 	SetTenantAndDatabase(tenant Tenant, database Database)
 	satisfies(resourceOperation ResourceOperation, metric interface{}, metricName string) error
 	localSetPreflightLimit(maxBatchSize int)
+	preflightMaxBatchSize() int
 	localCollectionByName(name string) Collection
 	localAddCollectionToCache(collection Collection)
 	localDeleteCollectionFromCache(name string)
@@ -49,7 +50,11 @@ type embeddedLocalClient struct {
 	collectionStateMu sync.RWMutex
 	collectionState   map[string]*embeddedCollectionState
 
-	logger logger.Logger
+	logger  logger.Logger
+	aliases *AliasManager
+
+	// maxBatchSize caps the batch size reported by the runtime; 0 means no cap.
+	maxBatchSize uint32
 }
 
 func newEmbeddedLocalClient(cfg *localClientConfig, embedded localEmbeddedRuntime) (Client, error) {
@@ -75,12 +80,29 @@ func newEmbeddedLocalClient(cfg *localClientConfig, embedded localEmbeddedRuntim
 		clientLogger = logger.NewNoopLogger()
 	}
 
-	return &embeddedLocalClient{
+	runtime := newQuiescedEmbeddedRuntime(embedded)
+	runtime.reopen = func() (localEmbeddedRuntime, error) {
+		reopened, err := startLocalEmbedded(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := localWaitEmbeddedReadyFunc(reopened); err != nil {
+			_ = reopened.Close()
+			return nil, err
+		}
+		return reopened, nil
+	}
+	client := &embeddedLocalClient{
 		state:           stateClient,
-		embedded:        embedded,
+		embedded:        runtime,
 		collectionState: map[string]*embeddedCollectionState{},
 		logger:          clientLogger,
-	}, nil
+		maxBatchSize:    cfg.maxBatchSize(),
+	}
+	if state, ok := stateClient.(*APIClientV2); ok && state.BaseAPIClient.aliases != nil {
+		client.aliases = newAliasManager(client, state.BaseAPIClient.aliases)
+	}
+	return client, nil
 }
 
 func newEmbeddedLocalStateClient(options ...ClientOption) (localClientState, error) {
@@ -115,6 +137,9 @@ func (client *embeddedLocalClient) PreFlight(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "error retrieving embedded max batch size")
 	}
+	if client.maxBatchSize > 0 && client.maxBatchSize < maxBatchSize {
+		maxBatchSize = client.maxBatchSize
+	}
 	client.state.localSetPreflightLimit(int(maxBatchSize))
 	return nil
 }
@@ -450,7 +475,7 @@ func (client *embeddedLocalClient) CreateCollection(ctx context.Context, name st
 		!collectionModelMatchesCreateRequest(model, metadataMap, configurationMap, schemaMap)
 	if shouldReloadForReuse {
 		cleanupMessage = "error closing default embedding function for existing collection"
-		getOptions := []GetCollectionOption{WithDatabaseGet(req.Database)}
+		getOptions := []GetCollectionOption{WithDatabaseGet(req.Database), withoutAliasResolution()}
 		if req.embeddingFunction != nil && req.embeddingFunction != req.sdkOwnedDefaultDenseEF {
 			getOptions = append(getOptions, WithEmbeddingFunctionGet(req.embeddingFunction))
 		}
@@ -476,7 +501,7 @@ func (client *embeddedLocalClient) CreateCollection(ctx context.Context, name st
 		cached := client.cachedCollectionByName(req.Name)
 		hasCachedCollection := cached != nil && cached.ID() == model.ID
 		if !hasState && !hasCachedCollection {
-			getOptions := []GetCollectionOption{WithDatabaseGet(req.Database)}
+			getOptions := []GetCollectionOption{WithDatabaseGet(req.Database), withoutAliasResolution()}
 			if req.embeddingFunction != nil && req.embeddingFunction != req.sdkOwnedDefaultDenseEF {
 				getOptions = append(getOptions, WithEmbeddingFunctionGet(req.embeddingFunction))
 			}
@@ -570,7 +595,7 @@ func (client *embeddedLocalClient) GetOrCreateCollection(ctx context.Context, na
 		return nil, err
 	}
 
-	getOptions := []GetCollectionOption{WithDatabaseGet(req.Database)}
+	getOptions := []GetCollectionOption{WithDatabaseGet(req.Database), withoutAliasResolution()}
 	if req.embeddingFunction != nil {
 		getOptions = append(getOptions, WithEmbeddingFunctionGet(req.embeddingFunction))
 	}
@@ -655,6 +680,11 @@ func (client *embeddedLocalClient) GetCollection(ctx context.Context, name strin
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if client.aliases != nil && !req.skipAliasResolution {
+		if req.name, err = client.aliases.resolveCollectionName(ctx, req.Database, req.name); err != nil {
+			return nil, err
+		}
+	}
 
 	model, err := client.embedded.GetCollection(localchroma.EmbeddedGetCollectionRequest{
 		Name:         req.name,
@@ -666,6 +696,9 @@ func (client *embeddedLocalClient) GetCollection(ctx context.Context, name strin
 	}
 
 	configuration := NewCollectionConfigurationFromMap(model.ConfigurationJSON)
+	if err := client.checkEmbeddingFunction(req, *model, configuration); err != nil {
+		return nil, err
+	}
 
 	contentEF := req.contentEmbeddingFunction
 	ef := req.embeddingFunction
@@ -938,6 +971,11 @@ func comparableCollectionMap(left, right map[string]any) bool {
 // against the upstream type, and the substring fallback can be dropped.
 var ErrEmbeddedCollectionNotFound = stderrors.New("embedded collection not found")
 
+// ErrEmbeddedUnsupported is returned by collection operations that the local runtime
+// (chroma-go-local v0.3.5) does not expose, so embedded mode cannot perform them.
+// Server mode and Chroma Cloud support them.
+var ErrEmbeddedUnsupported = stderrors.New("not supported by the embedded local runtime")
+
 func isEmbeddedCollectionNotFoundError(err error) bool {
 	if err == nil {
 		return false
@@ -966,6 +1004,26 @@ func (client *embeddedLocalClient) logAutoWireError(collection, target string, e
 	}
 }
 
+// checkEmbeddingFunction checks the embedding function supplied to GetCollection
+// against the persisted collection, see [GetCollectionOp.checkEmbeddingFunction].
+func (client *embeddedLocalClient) checkEmbeddingFunction(req *GetCollectionOp, model localchroma.EmbeddedCollection, configuration *CollectionConfigurationImpl) error {
+	if req.suppliedDenseEF() == nil || req.efCompatibility == EFCompatibilityOverride {
+		return nil
+	}
+	// unparsable schema and metadata are reported when the collection is built
+	schema, _ := schemaFromMap(model.Schema)
+	metadata, _ := collectionMetadataFromMap(model.Metadata)
+	return req.checkEmbeddingFunction(model.Name, configuration, schema, metadata, client.collectionDimension(model.ID, 0), func(err error) {
+		if client.logger != nil {
+			client.logger.Warn("embedding function does not match the collection",
+				logger.String("collection", model.Name),
+				logger.ErrorField("error", err))
+		} else {
+			logEFMismatchToStderr(model.Name, err)
+		}
+	})
+}
+
 func (client *embeddedLocalClient) logCloseError(msg, collection string, err error) {
 	if client.logger != nil {
 		client.logger.Error(msg,
@@ -1245,6 +1303,7 @@ func (c *embeddedCollection) runtimeScopeSnapshot() (collectionID, tenantName, d
 type embeddedWriteOp interface {
 	ResourceOperation
 	EmbedData(ctx context.Context, ef embeddingspkg.EmbeddingFunction) error
+	ValidateRecords(constraints WriteConstraints) error
 }
 
 func (c *embeddedCollection) executeEmbeddedWrite(
@@ -1265,9 +1324,21 @@ func (c *embeddedCollection) executeEmbeddedWrite(
 	if err := c.client.state.satisfies(op, len(ids), "documents"); err != nil {
 		return errors.Wrap(err, "failed to satisfy operation")
 	}
-	if err := op.EmbedData(ctx, c.embeddingFunctionSnapshot()); err != nil {
+	ef := c.embeddingFunctionSnapshot()
+	constraints := WriteConstraints{
+		Dimension:                  c.Dimension(),
+		EmbeddingFunctionDimension: embeddingFunctionDimension(ef),
+		Schema:                     c.Schema(),
+	}
+	if err := op.ValidateRecords(constraints); err != nil {
+		return err
+	}
+	if err := op.EmbedData(ctx, ef); err != nil {
 		return errors.Wrap(err, "failed to embed data")
 	}
+	if err := op.ValidateRecords(constraints); err != nil {
+		return err
+	}
 
 	vectors, err := embeddingsAnyToFloat32Matrix(*embeddings)
 	if err != nil {
@@ -1469,14 +1540,23 @@ func (c *embeddedCollection) ModifyMetadata(ctx context.Context, newMetadata Col
 	return nil
 }
 
-func (c *embeddedCollection) ModifyConfiguration(_ context.Context, newConfig *UpdateCollectionConfiguration) error {
+// ModifyConfiguration validates newConfig and returns [ErrEmbeddedUnsupported].
+//
+// The local runtime's update call only carries a new name and metadata, so configuration
+// updates would be silently dropped; returning an error keeps the cached configuration
+// consistent with what the runtime stores. Persisting them needs a runtime release whose
+// update request accepts a new configuration.
+func (c *embeddedCollection) ModifyConfiguration(ctx context.Context, newConfig *UpdateCollectionConfiguration) error {
 	if newConfig == nil {
 		return errors.New("newConfig cannot be nil")
 	}
 	if err := newConfig.Validate(); err != nil {
 		return err
 	}
-	return errors.New("embedded local mode does not support persisting collection configuration updates")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.Wrap(ErrEmbeddedUnsupported, "embedded local mode does not support persisting collection configuration updates: the local runtime does not accept new_configuration")
 }
 
 func (c *embeddedCollection) Get(ctx context.Context, opts ...CollectionGetOption) (GetResult, error) {
@@ -1526,6 +1606,10 @@ func (c *embeddedCollection) Get(ctx context.Context, opts ...CollectionGetOptio
 	return embeddedGetRecordsToGetResult(response, getObject.Include)
 }
 
+func (c *embeddedCollection) GetStream(ctx context.Context, fn func(row ResultRow) error, opts ...CollectionGetOption) error {
+	return streamGetRows(ctx, c.Get, fn, opts...)
+}
+
 func (c *embeddedCollection) Query(ctx context.Context, opts ...CollectionQueryOption) (QueryResult, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -1534,6 +1618,9 @@ func (c *embeddedCollection) Query(ctx context.Context, opts ...CollectionQueryO
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating query operation")
 	}
+	if queryObject.MMR != nil {
+		return queryMMR(ctx, c, queryObject, opts)
+	}
 	if err := queryObject.PrepareAndValidate(); err != nil {
 		return nil, errors.Wrap(err, "error validating query operation")
 	}
@@ -1747,14 +1834,55 @@ func (c *embeddedCollection) Search(_ context.Context, _ ...SearchCollectionOpti
 	return nil, errors.New("search is not supported in embedded local mode")
 }
 
-// Fork is not supported in embedded local mode.
-func (c *embeddedCollection) Fork(_ context.Context, _ string) (Collection, error) {
-	return nil, errors.New("fork is not supported in embedded local mode")
+// Fork creates a copy of the collection named newName through the local runtime.
+//
+// The fork shares the embedding functions of the source collection and does not own them.
+// Local Chroma backends without fork support return the runtime error.
+func (c *embeddedCollection) Fork(ctx context.Context, newName string) (Collection, error) {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return nil, errors.New("newName cannot be empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	collectionID, tenantName, databaseName := c.runtimeScopeSnapshot()
+	model, err := c.client.embedded.ForkCollection(localchroma.EmbeddedForkCollectionRequest{
+		SourceCollectionID:   collectionID,
+		TargetCollectionName: newName,
+		TenantID:             tenantName,
+		DatabaseName:         databaseName,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error forking collection")
+	}
+	if model == nil {
+		return nil, errors.New("local runtime returned no forked collection")
+	}
+
+	c.mu.RLock()
+	database := c.database
+	ef := c.embeddingFunction
+	contentEF := c.contentEmbeddingFunction
+	c.mu.RUnlock()
+	if dimension := c.Dimension(); dimension > 0 {
+		c.client.setCollectionDimension(model.ID, dimension)
+	}
+	forked, err := c.client.buildEmbeddedCollection(*model, database, unwrapCloseOnceEF(ef), unwrapCloseOnceContentEF(contentEF), false, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building forked collection")
+	}
+	return forked, nil
+}
+
+func (c *embeddedCollection) QueryMMR(ctx context.Context, opts ...CollectionQueryOption) (QueryResult, error) {
+	return c.Query(ctx, append([]CollectionQueryOption{WithMMR()}, opts...)...)
 }
 
-// ForkCount is not supported in embedded local mode.
+// ForkCount returns [ErrEmbeddedUnsupported] because the local runtime does not expose
+// fork lineage.
 func (c *embeddedCollection) ForkCount(_ context.Context) (int, error) {
-	return 0, errors.New("fork count is not supported in embedded local mode")
+	return 0, errors.Wrap(ErrEmbeddedUnsupported, "fork count is not supported in embedded local mode: the local runtime does not expose fork lineage")
 }
 
 func (c *embeddedCollection) IndexingStatus(ctx context.Context) (*IndexingStatus, error) {
@@ -743,6 +743,42 @@ func (s *memoryEmbeddedRuntime) UpdateCollection(request localchroma.EmbeddedUpd
 	return nil
 }
 
+func (s *memoryEmbeddedRuntime) ForkCollection(request localchroma.EmbeddedForkCollectionRequest) (*localchroma.EmbeddedCollection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sourceKey, ok := s.collectionByID[request.SourceCollectionID]
+	if !ok {
+		return nil, errors.New("collection not found")
+	}
+	source := s.collections[sourceKey]
+	targetKey := collectionRuntimeKey(source.Tenant, source.Database, request.TargetCollectionName)
+	if _, exists := s.collections[targetKey]; exists {
+		return nil, errors.New("collection already exists")
+	}
+
+	s.nextCollectionID++
+	forked := localchroma.EmbeddedCollection{
+		ID:                fmt.Sprintf("mem-col-%d", s.nextCollectionID),
+		Name:              request.TargetCollectionName,
+		Tenant:            source.Tenant,
+		Database:          source.Database,
+		Metadata:          cloneMetadataMap(source.Metadata),
+		ConfigurationJSON: cloneMetadataMap(source.ConfigurationJSON),
+		Schema:            cloneMetadataMap(source.Schema),
+	}
+	s.collections[targetKey] = forked
+	s.collectionByID[forked.ID] = targetKey
+	s.records[forked.ID] = map[string]memoryEmbeddedRecord{}
+	for id, record := range s.records[source.ID] {
+		s.records[forked.ID][id] = record
+	}
+	s.recordOrder[forked.ID] = append([]string(nil), s.recordOrder[source.ID]...)
+
+	copyCol := forked
+	return &copyCol, nil
+}
+
 func (s *blockingRenameEmbeddedRuntime) UpdateCollection(request localchroma.EmbeddedUpdateCollectionRequest) error {
 	s.updateMu.Lock()
 	s.updateCalls++
@@ -4495,3 +4531,86 @@ func TestEmbeddedGetOrCreateCollection_ContentEF_VerifyViaSubsequentGetCollectio
 	require.NotNil(t, gotContentEF, "contentEF should be available from embedded state even without explicit option")
 	require.Same(t, contentEF, unwrapCloseOnceContentEF(gotContentEF), "should be the same contentEF stored in state")
 }
+
+func TestEmbeddedCollectionFork_CopiesRecordsAndSharesEmbeddingFunction(t *testing.T) {
+	runtime := newMemoryEmbeddedRuntime()
+	client := newEmbeddedClientForRuntime(t, runtime)
+	ctx := context.Background()
+
+	ef := embeddingspkg.NewConsistentHashEmbeddingFunction()
+	source, err := client.CreateCollection(ctx, "fork-source", WithEmbeddingFunctionCreate(ef))
+	require.NoError(t, err)
+	require.NoError(t, source.Add(ctx, WithIDs("1", "2"), WithTexts("alpha", "beta")))
+
+	forked, err := source.Fork(ctx, " fork-target ")
+	require.NoError(t, err)
+	require.Equal(t, "fork-target", forked.Name())
+	require.NotEqual(t, source.ID(), forked.ID())
+	require.Equal(t, source.Dimension(), forked.Dimension())
+
+	count, err := forked.Count(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	forkedCollection, ok := forked.(*embeddedCollection)
+	require.True(t, ok)
+	require.Same(t, ef, unwrapCloseOnceEF(forkedCollection.embeddingFunctionSnapshot()))
+	require.False(t, forkedCollection.ownsEF.Load(), "fork must not own the source embedding function")
+
+	cached := client.cachedCollectionByName("fork-target")
+	require.NotNil(t, cached)
+	require.Equal(t, forked.ID(), cached.ID())
+
+	require.NoError(t, forked.Add(ctx, WithIDs("3"), WithTexts("gamma")))
+	sourceCount, err := source.Count(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, sourceCount)
+}
+
+func TestEmbeddedCollectionFork_Errors(t *testing.T) {
+	runtime := newMemoryEmbeddedRuntime()
+	client := newEmbeddedClientForRuntime(t, runtime)
+	ctx := context.Background()
+
+	source, err := client.CreateCollection(ctx, "fork-errors", WithEmbeddingFunctionCreate(embeddingspkg.NewConsistentHashEmbeddingFunction()))
+	require.NoError(t, err)
+
+	_, err = source.Fork(ctx, " ")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "newName cannot be empty")
+
+	_, err = source.Fork(ctx, "fork-errors")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error forking collection")
+	require.Contains(t, err.Error(), "collection already exists")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = source.Fork(canceled, "fork-canceled")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestEmbeddedCollectionModifyConfiguration_ValidatesBeforeReportingUnsupported(t *testing.T) {
+	runtime := newMemoryEmbeddedRuntime()
+	client := newEmbeddedClientForRuntime(t, runtime)
+	ctx := context.Background()
+
+	collection, err := client.CreateCollection(ctx, "modify-config", WithEmbeddingFunctionCreate(embeddingspkg.NewConsistentHashEmbeddingFunction()))
+	require.NoError(t, err)
+
+	err = collection.ModifyConfiguration(ctx, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "newConfig cannot be nil")
+
+	err = collection.ModifyConfiguration(ctx, NewUpdateCollectionConfiguration(WithHNSWEfSearchModify(0)))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ef_search must be greater than 0")
+
+	err = collection.ModifyConfiguration(ctx, NewUpdateCollectionConfiguration(WithHNSWEfSearchModify(50)))
+	require.Error(t, err)
+	require.ErrorIs(t, err, ErrEmbeddedUnsupported)
+	require.Contains(t, err.Error(), "does not support persisting collection configuration updates")
+
+	_, err = collection.ForkCount(ctx)
+	require.ErrorIs(t, err, ErrEmbeddedUnsupported)
+}
@@ -2,58 +2,48 @@ package v2
 
 import (
 	"archive/tar"
-	"bufio"
 	"compress/gzip"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"crypto/x509"
 	stderrors "errors"
 	"fmt"
 	"io"
-	"net/url"
 	"os"
-	"path"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
-	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
 	"github.com/amikos-tech/chroma-go/pkg/internal/cosignutil"
 	downloadutil "github.com/amikos-tech/chroma-go/pkg/internal/downloadutil"
 )
 
 const (
 	defaultLocalLibraryVersion                = "v0.3.5"
-	defaultLocalLibraryReleaseBaseURL         = "https://releases.amikos.tech/chroma-go-local"
-	defaultLocalLibraryReleaseFallbackBaseURL = "https://github.com/amikos-tech/chroma-go-local/releases/download"
+	defaultLocalLibraryReleaseBaseURL         = artifacts.LocalShimReleaseBaseURL
+	defaultLocalLibraryReleaseFallbackBaseURL = artifacts.LocalShimFallbackReleaseBaseURL
 	localLibraryModulePath                    = "github.com/amikos-tech/chroma-go-local"
-	localLibraryChecksumsAsset                = "SHA256SUMS"
-	localLibraryChecksumsSignatureAsset       = "SHA256SUMS.sig"
-	localLibraryChecksumsCertificateAsset     = "SHA256SUMS.pem"
-	localLibraryChecksumsBundleAsset          = "SHA256SUMS.sigstore.json"
-	localLibraryArchivePrefixLegacy           = "chroma-go-local"
+	localLibraryChecksumsAsset                = artifacts.ChecksumsAsset
+	localLibraryChecksumsSignatureAsset       = artifacts.ChecksumsSignatureAsset
+	localLibraryChecksumsCertificateAsset     = artifacts.ChecksumsCertificateAsset
+	localLibraryChecksumsBundleAsset          = artifacts.ChecksumsBundleAsset
 	localLibraryArchivePrefixLocalChroma      = "local-chroma"
-	localLibraryCosignOIDCIssuer              = "https://token.actions.githubusercontent.com"
-	localLibraryCosignIdentityTemplate        = "https://github.com/amikos-tech/chroma-go-local/.github/workflows/release.yml@refs/tags/%s"
-	localLibraryCosignMainIdentity            = "https://github.com/amikos-tech/chroma-go-local/.github/workflows/release.yml@refs/heads/main"
-	localLibraryLockFileName                  = ".download.lock"
+	localLibraryCosignOIDCIssuer              = artifacts.GitHubActionsOIDCIssuer
+	localLibraryCosignIdentityTemplate        = artifacts.LocalShimIdentityTemplate
+	localLibraryLockFileName                  = artifacts.LockFileName
 	localLibraryCacheDirPerm                  = os.FileMode(0700)
-	localLibraryLockFilePerm                  = os.FileMode(0600)
 	localLibraryArtifactFilePerm              = os.FileMode(0700)
 )
 
-// localLibraryCosignMainIdentityVersions lists versions whose release artifacts were signed
-// by a workflow_dispatch run on main rather than by a tag push, so they carry
-// localLibraryCosignMainIdentity instead of the usual refs/tags/<version> identity. A function
-// (not a package-level var) so the allowance can't be widened by a stray same-package append.
-// Add a version here only after decoding the published bundle's Fulcio certificate and
-// confirming the signer; every entry widens what we trust.
+// localLibraryCosignMainIdentityVersions lists versions signed by a workflow_dispatch
+// run on main; see artifacts.LocalShimMainIdentityVersions.
 func localLibraryCosignMainIdentityVersions() []string {
-	return []string{"v0.3.4", "v0.3.5"}
+	return artifacts.LocalShimMainIdentityVersions()
 }
 
 var (
@@ -67,7 +57,6 @@ var (
 	localLibraryLockHeartbeatInterval           = 30 * time.Second
 	localLibraryMaxArtifactBytes          int64 = 500 * 1024 * 1024
 	localGetenvFunc                             = os.Getenv
-	localUserHomeDirFunc                        = os.UserHomeDir
 	localReadBuildInfoFunc                      = debug.ReadBuildInfo
 	localDownloadFileFunc                       = localDownloadFileWithRetry
 	localEnsureLibraryDownloadedFunc            = ensureLocalLibraryDownloaded
@@ -163,14 +152,7 @@ func detectLocalLibraryVersion() (string, error) {
 }
 
 func defaultLocalLibraryCacheDir() (string, error) {
-	homeDir, err := localUserHomeDirFunc()
-	if err != nil {
-		return "", errors.Wrap(err, "failed to resolve home directory")
-	}
-	if strings.TrimSpace(homeDir) == "" {
-		return "", errors.New("home directory is empty")
-	}
-	return filepath.Join(homeDir, ".cache", "chroma", "local_shim"), nil
+	return filepath.Join(artifacts.CacheRoot(), artifacts.LocalShim.Name), nil
 }
 
 func ensureLocalLibraryDownloaded(version, cacheDir string) (libPath string, retErr error) {
@@ -342,32 +324,18 @@ func ensureLocalLibraryDownloaded(version, cacheDir string) (libPath string, ret
 }
 
 func localLibraryAssetForRuntime(goos, goarch string) (localLibraryAsset, error) {
-	var platformOS, requiredArch, libraryFileName string
-	switch goos {
-	case "linux":
-		platformOS, requiredArch, libraryFileName = "linux", "amd64", "libchroma_shim.so"
-	case "darwin":
-		platformOS, requiredArch, libraryFileName = "darwin", "arm64", "libchroma_shim.dylib"
-	case "windows":
-		platformOS, requiredArch, libraryFileName = "windows", "amd64", "chroma_shim.dll"
-	default:
-		return localLibraryAsset{}, errors.Errorf("unsupported OS for local runtime download: %s", goos)
-	}
-	if goarch != requiredArch {
-		return localLibraryAsset{}, errors.Errorf("unsupported architecture for %s local runtime download: %s", goos, goarch)
-	}
-	platform := platformOS + "-" + goarch
+	asset, err := artifacts.LocalShimAsset("", goos, goarch)
+	if err != nil {
+		return localLibraryAsset{}, err
+	}
 	return localLibraryAsset{
-		platform:        platform,
-		libraryFileName: libraryFileName,
+		platform:        asset.Platform,
+		libraryFileName: asset.Library,
 	}, nil
 }
 
 func localLibraryArchiveNames(version, platform string) []string {
-	return []string{
-		fmt.Sprintf("%s-%s-%s.tar.gz", localLibraryArchivePrefixLegacy, version, platform),
-		fmt.Sprintf("%s-%s-%s.tar.gz", localLibraryArchivePrefixLocalChroma, version, platform),
-	}
+	return artifacts.LocalShimArchiveNames(version, platform)
 }
 
 func localRemoveCorruptedArchive(archivePath string) error {
@@ -411,134 +379,52 @@ func normalizeLocalLibraryTag(version string) (string, error) {
 	return version, nil
 }
 
-func localShouldEvictStaleLock(lockPath string, initialInfo os.FileInfo) (bool, error) {
-	if initialInfo == nil || time.Since(initialInfo.ModTime()) <= localLibraryLockStaleAfter {
-		return false, nil
-	}
-
-	currentInfo, err := os.Stat(lockPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, errors.Wrapf(err, "failed to stat stale lock file %s", lockPath)
-	}
-
-	if !os.SameFile(initialInfo, currentInfo) {
-		return false, nil
-	}
-	if !currentInfo.ModTime().Equal(initialInfo.ModTime()) || currentInfo.Size() != initialInfo.Size() {
-		return false, nil
+func localLibraryLockConfig() artifacts.LockConfig {
+	return artifacts.LockConfig{
+		WaitTimeout:       localLibraryLockWaitTimeout,
+		StaleAfter:        localLibraryLockStaleAfter,
+		HeartbeatInterval: localLibraryLockHeartbeatInterval,
+		DirPerm:           localLibraryCacheDirPerm,
 	}
-	if time.Since(currentInfo.ModTime()) <= localLibraryLockStaleAfter {
-		return false, nil
-	}
-	return true, nil
 }
 
 func localAcquireDownloadLock(lockPath string) (*os.File, error) {
-	lockDir := filepath.Dir(lockPath)
-	if err := os.MkdirAll(lockDir, localLibraryCacheDirPerm); err != nil {
-		return nil, errors.Wrap(err, "failed to create lock directory")
-	}
-
-	deadline := time.Now().Add(localLibraryLockWaitTimeout)
-	for {
-		lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, localLibraryLockFilePerm)
-		if err == nil {
-			_, _ = fmt.Fprintf(lockFile, "%d", os.Getpid())
-			_ = lockFile.Sync()
-			return lockFile, nil
-		}
-		if !os.IsExist(err) {
-			return nil, errors.Wrap(err, "failed to create lock file")
-		}
-
-		if info, statErr := os.Stat(lockPath); statErr == nil {
-			evictStale, staleErr := localShouldEvictStaleLock(lockPath, info)
-			if staleErr != nil {
-				return nil, staleErr
-			}
-			if evictStale {
-				if removeErr := os.Remove(lockPath); removeErr != nil && !os.IsNotExist(removeErr) {
-					return nil, errors.Wrapf(removeErr, "failed to remove stale lock file %s", lockPath)
-				}
-				continue
-			}
-		}
-
-		if time.Now().After(deadline) {
-			return nil, errors.Errorf("timeout waiting for lock: %s", lockPath)
-		}
-		time.Sleep(500 * time.Millisecond)
-	}
+	return artifacts.AcquireLock(lockPath, localLibraryLockConfig())
 }
 
 func localReleaseDownloadLock(lockFile *os.File) error {
-	if lockFile == nil {
-		return nil
-	}
-	lockPath := lockFile.Name()
-	var errs []error
-	if closeErr := lockFile.Close(); closeErr != nil {
-		errs = append(errs, errors.Wrap(closeErr, "failed to close download lock file"))
-	}
-	if removeErr := os.Remove(lockPath); removeErr != nil && !os.IsNotExist(removeErr) {
-		errs = append(errs, errors.Wrapf(removeErr, "failed to remove download lock file %s", lockPath))
-	}
-	if len(errs) > 0 {
-		return stderrors.Join(errs...)
-	}
-	return nil
+	return artifacts.ReleaseLock(lockFile)
 }
 
 func localStartDownloadLockHeartbeat(lockFile *os.File) func() error {
-	if lockFile == nil || localLibraryLockHeartbeatInterval <= 0 {
-		return func() error { return nil }
-	}
-
-	lockPath := lockFile.Name()
-	stopCh := make(chan struct{})
-	doneCh := make(chan error, 1)
-	var stopOnce sync.Once
-	var stopErr error
-	go func() {
-		ticker := time.NewTicker(localLibraryLockHeartbeatInterval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				now := time.Now()
-				if err := os.Chtimes(lockPath, now, now); err != nil {
-					if os.IsNotExist(err) {
-						doneCh <- nil
-					} else {
-						doneCh <- errors.Wrapf(err, "failed to refresh download lock file %s", lockPath)
-					}
-					return
-				}
-			case <-stopCh:
-				doneCh <- nil
-				return
-			}
-		}
-	}()
+	return artifacts.StartHeartbeat(lockFile, localLibraryLockHeartbeatInterval)
+}
 
-	return func() error {
-		stopOnce.Do(func() {
-			close(stopCh)
-			stopErr = <-doneCh
-		})
-		return stopErr
-	}
+// localArtifactManager returns the artifact manager used for the local shim,
+// wired to the package test hooks.
+func localArtifactManager() (*artifacts.Manager, error) {
+	return artifacts.New(
+		artifacts.WithDownloader(func(_ context.Context, dest, url string) error {
+			return localDownloadFileFunc(dest, url)
+		}),
+		artifacts.WithCertificateChainVerifier(func(certificate *x509.Certificate) error {
+			return localVerifyCosignCertificateChainFunc(certificate)
+		}),
+		artifacts.WithLockConfig(localLibraryLockConfig()),
+	)
 }
 
+// localReleaseBaseURLs returns the configured mirrors of the local shim
+// followed by the release base URLs.
 func localReleaseBaseURLs() []string {
-	candidates := []string{
+	var candidates []string
+	if manager, err := localArtifactManager(); err == nil {
+		candidates = manager.Mirrors(artifacts.LocalShim)
+	}
+	candidates = append(candidates,
 		strings.TrimSpace(localLibraryReleaseBaseURL),
 		strings.TrimSpace(localLibraryReleaseFallbackBaseURL),
-	}
+	)
 	seen := make(map[string]struct{}, len(candidates))
 	bases := make([]string, 0, len(candidates))
 	for _, base := range candidates {
@@ -556,42 +442,24 @@ func localReleaseBaseURLs() []string {
 }
 
 func localValidateReleaseBaseURL(baseURL string) (string, error) {
-	baseURL = strings.TrimSpace(strings.TrimRight(baseURL, "/"))
-	if baseURL == "" {
-		return "", errors.New("release base URL cannot be empty")
-	}
-	parsedURL, err := url.Parse(baseURL)
-	if err != nil {
-		return "", errors.Wrap(err, "invalid release base URL")
-	}
-	if !parsedURL.IsAbs() {
-		return "", errors.New("release base URL must be absolute")
-	}
-	if !strings.EqualFold(parsedURL.Scheme, "https") {
-		return "", errors.Errorf("release base URL must use https scheme: %s", parsedURL.Redacted())
-	}
-	if strings.TrimSpace(parsedURL.Host) == "" {
-		return "", errors.Errorf("release base URL host cannot be empty: %s", parsedURL.Redacted())
-	}
-	return baseURL, nil
+	return artifacts.ValidateBaseURL(baseURL)
 }
 
 func localPrepareSignedChecksumsFromBase(baseURL, version, targetDir string, archiveNames []string) (string, string, error) {
-	checksumsPath := filepath.Join(targetDir, localLibraryChecksumsAsset)
-
-	if err := localDownloadReleaseAssetFromBase(baseURL, version, localLibraryChecksumsAsset, checksumsPath); err != nil {
-		return "", "", errors.Wrap(err, "failed to download local library checksums")
+	normalizedBaseURL, err := localValidateReleaseBaseURLFunc(baseURL)
+	if err != nil {
+		return "", "", err
 	}
-
-	legacyErr := localPrepareLegacySignedChecksumsFromBase(baseURL, version, checksumsPath, targetDir)
-	if legacyErr != nil {
-		bundleErr := localPrepareSigstoreBundleChecksumsFromBase(baseURL, version, checksumsPath, targetDir)
-		if bundleErr != nil {
-			return "", "", errors.Wrap(stderrors.Join(
-				errors.Wrap(legacyErr, "legacy checksum signature metadata failed"),
-				errors.Wrap(bundleErr, "sigstore bundle metadata failed"),
-			), "failed to verify local library checksum metadata")
-		}
+	manager, err := localArtifactManager()
+	if err != nil {
+		return "", "", err
+	}
+	checksumsPath, err := manager.FetchSignedChecksums(context.Background(), normalizedBaseURL+"/"+version, targetDir, artifacts.Signer{
+		Identities: localAllowedChecksumSignerIdentities(version),
+		OIDCIssuer: localLibraryCosignOIDCIssuer,
+	})
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to verify local library checksum metadata")
 	}
 
 	resolvedArchiveName, expectedChecksum, err := localChecksumFromSumsFileAny(checksumsPath, archiveNames)
@@ -613,196 +481,18 @@ func localDownloadReleaseAssetFromBase(baseURL, version, assetName, destinationP
 	return nil
 }
 
-func localVerifySignedChecksums(version, checksumsPath, signaturePath, certificatePath string) error {
-	return localVerifyChecksumsWithAnyIdentity(version, func(expectedIdentity string) error {
-		return cosignutil.VerifySignedChecksums(
-			checksumsPath, signaturePath, certificatePath,
-			expectedIdentity, localLibraryCosignOIDCIssuer,
-			localVerifyCosignCertificateChainFunc,
-		)
-	})
-}
-
-func localPrepareLegacySignedChecksumsFromBase(baseURL, version, checksumsPath, targetDir string) error {
-	checksumsSignaturePath := filepath.Join(targetDir, localLibraryChecksumsSignatureAsset)
-	checksumsCertificatePath := filepath.Join(targetDir, localLibraryChecksumsCertificateAsset)
-
-	type metaDownload struct {
-		asset, dest, errMsg string
-	}
-	downloads := []metaDownload{
-		{localLibraryChecksumsSignatureAsset, checksumsSignaturePath, "failed to download local library checksums signature"},
-		{localLibraryChecksumsCertificateAsset, checksumsCertificatePath, "failed to download local library checksums certificate"},
-	}
-	errs := make([]error, len(downloads))
-	var wg sync.WaitGroup
-	for i, dl := range downloads {
-		wg.Add(1)
-		go func(index int, download metaDownload) {
-			defer wg.Done()
-			if err := localDownloadReleaseAssetFromBase(baseURL, version, download.asset, download.dest); err != nil {
-				errs[index] = errors.Wrap(err, download.errMsg)
-			}
-		}(i, dl)
-	}
-	wg.Wait()
-
-	downloadErrs := make([]error, 0, len(errs))
-	for _, err := range errs {
-		if err != nil {
-			downloadErrs = append(downloadErrs, err)
-		}
-	}
-	if len(downloadErrs) > 0 {
-		return errors.Wrap(stderrors.Join(downloadErrs...), "failed to download legacy checksum metadata")
-	}
-	if err := localVerifySignedChecksums(version, checksumsPath, checksumsSignaturePath, checksumsCertificatePath); err != nil {
-		return errors.Wrap(err, "failed to verify legacy checksum signature")
-	}
-	return nil
-}
-
-func localPrepareSigstoreBundleChecksumsFromBase(baseURL, version, checksumsPath, targetDir string) error {
-	checksumsBundlePath := filepath.Join(targetDir, localLibraryChecksumsBundleAsset)
-	if err := localDownloadReleaseAssetFromBase(baseURL, version, localLibraryChecksumsBundleAsset, checksumsBundlePath); err != nil {
-		return errors.Wrap(err, "failed to download sigstore bundle")
-	}
-	if err := localVerifyChecksumsWithAnyIdentity(version, func(expectedIdentity string) error {
-		return cosignutil.VerifySignedChecksumsBundle(
-			checksumsPath, checksumsBundlePath,
-			expectedIdentity, localLibraryCosignOIDCIssuer,
-			localVerifyCosignCertificateChainFunc,
-		)
-	}); err != nil {
-		return errors.Wrap(err, "failed to verify sigstore bundle")
-	}
-	return nil
-}
-
-func localVerifyChecksumsWithAnyIdentity(version string, verify func(expectedIdentity string) error) error {
-	identities := localAllowedChecksumSignerIdentities(version)
-	var errs []error
-	for _, identity := range identities {
-		if err := verify(identity); err == nil {
-			return nil
-		} else {
-			errs = append(errs, errors.Wrapf(err, "certificate identity %s", identity))
-		}
-	}
-	return stderrors.Join(errs...)
-}
-
 func localAllowedChecksumSignerIdentities(version string) []string {
-	identities := []string{fmt.Sprintf(localLibraryCosignIdentityTemplate, version)}
-	if slices.Contains(localLibraryCosignMainIdentityVersions(), strings.TrimSpace(version)) {
-		identities = append(identities, localLibraryCosignMainIdentity)
-	}
-	return identities
+	return artifacts.LocalShimSigner(version).Identities
 }
 
 // localChecksumFromSumsFileAny matches checksum entries in file order.
 // If multiple candidate asset names are present, the first matching line in the checksums file wins.
 func localChecksumFromSumsFileAny(sumsFilePath string, assetNames []string) (string, string, error) {
-	candidates := make(map[string]string, len(assetNames))
-	candidateList := make([]string, 0, len(assetNames))
-	for _, assetName := range assetNames {
-		original := strings.TrimSpace(assetName)
-		normalized := localNormalizedChecksumAssetName(original)
-		if normalized == "" {
-			continue
-		}
-		if _, ok := candidates[normalized]; ok {
-			continue
-		}
-		candidates[normalized] = original
-		candidateList = append(candidateList, original)
-	}
-	if len(candidates) == 0 {
-		return "", "", errors.New("asset names cannot be empty")
-	}
-
-	f, err := os.Open(sumsFilePath)
-	if err != nil {
-		return "", "", errors.Wrap(err, "failed to open checksum file")
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(strings.TrimRight(scanner.Text(), "\r"))
-		if line == "" {
-			continue
-		}
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
-		}
-		checksumAssetName := localNormalizedChecksumAssetName(fields[1])
-		if checksumAssetName == "" {
-			continue
-		}
-		if originalAssetName, ok := candidates[checksumAssetName]; ok {
-			checksum := strings.ToLower(fields[0])
-			if !localLooksLikeSHA256(checksum) {
-				return "", "", errors.Errorf("invalid checksum format for asset %s: %q", originalAssetName, fields[0])
-			}
-			return originalAssetName, checksum, nil
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return "", "", errors.Wrap(err, "failed to read checksum file")
-	}
-	return "", "", errors.Errorf("checksum entry not found for assets [%s]", strings.Join(candidateList, ", "))
-}
-
-func localNormalizedChecksumAssetName(assetName string) string {
-	normalized := strings.TrimPrefix(strings.TrimSpace(assetName), "*")
-	normalized = strings.ReplaceAll(normalized, "\\", "/")
-	normalized = path.Base(normalized)
-	if normalized == "." || normalized == "/" || normalized == ".." {
-		return ""
-	}
-	return strings.TrimSpace(normalized)
+	return artifacts.ChecksumFromSums(sumsFilePath, assetNames...)
 }
 
 func localVerifyFileChecksum(filePath, expectedChecksum string) error {
-	expectedChecksum = strings.TrimSpace(strings.ToLower(expectedChecksum))
-	if expectedChecksum == "" {
-		return errors.New("expected checksum cannot be empty")
-	}
-
-	f, err := os.Open(filePath)
-	if err != nil {
-		return errors.Wrap(err, "failed to open file for checksum verification")
-	}
-	defer f.Close()
-
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, f); err != nil {
-		return errors.Wrap(err, "failed to hash downloaded file")
-	}
-
-	actualChecksum := hex.EncodeToString(hasher.Sum(nil))
-	if actualChecksum != expectedChecksum {
-		return errors.Errorf("checksum mismatch for %s: expected %s, got %s", filePath, expectedChecksum, actualChecksum)
-	}
-	return nil
-}
-
-func localLooksLikeSHA256(v string) bool {
-	if len(v) != 64 {
-		return false
-	}
-	for _, r := range v {
-		switch {
-		case r >= '0' && r <= '9':
-		case r >= 'a' && r <= 'f':
-		case r >= 'A' && r <= 'F':
-		default:
-			return false
-		}
-	}
-	return true
+	return artifacts.VerifyFile(filePath, expectedChecksum)
 }
 
 func localDownloadFileWithRetry(filePath, url string) error {
@@ -813,6 +503,7 @@ func localDownloadFileWithRetry(filePath, url string) error {
 		downloadutil.Config{
 			MaxBytes: localLibraryMaxArtifactBytes,
 			DirPerm:  localLibraryCacheDirPerm,
+			Resume:   true,
 		},
 	))
 }
@@ -1211,26 +1211,6 @@ func TestLocalChecksumFromSumsFileAny_PrefersFirstMatchingFileLine(t *testing.T)
 	require.Equal(t, strings.Repeat("1", 64), checksum)
 }
 
-func TestLocalNormalizedChecksumAssetName(t *testing.T) {
-	tests := []struct {
-		name  string
-		input string
-		want  string
-	}{
-		{name: "bsd marker", input: "*local-chroma-v0.4.0-linux-amd64.tar.gz", want: "local-chroma-v0.4.0-linux-amd64.tar.gz"},
-		{name: "relative path", input: "./local-chroma-v0.4.0-linux-amd64.tar.gz", want: "local-chroma-v0.4.0-linux-amd64.tar.gz"},
-		{name: "windows path", input: `chroma-go-local\v0.4.0\local-chroma-v0.4.0-linux-amd64.tar.gz`, want: "local-chroma-v0.4.0-linux-amd64.tar.gz"},
-		{name: "deep path", input: "prefix/nested/path/chroma-go-local-v0.4.0-linux-amd64.tar.gz", want: "chroma-go-local-v0.4.0-linux-amd64.tar.gz"},
-		{name: "blank", input: "   ", want: ""},
-		{name: "parent directory", input: "..", want: ""},
-	}
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			require.Equal(t, tc.want, localNormalizedChecksumAssetName(tc.input))
-		})
-	}
-}
-
 func TestLocalLibraryArchiveNames_IncludeLegacyAndLocalChroma(t *testing.T) {
 	archiveNames := localLibraryArchiveNames("v9.9.9", "linux-amd64")
 	require.Equal(t, []string{
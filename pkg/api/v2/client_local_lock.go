@@ -0,0 +1,233 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// localPersistLockSuffix names the lock file kept next to the persist directory, so that snapshots never copy it.
+const localPersistLockSuffix = ".lock"
+
+// PersistPathLockedError is returned by [NewPersistentClient] when another client holds the persist path.
+//
+// Only one client may open a persist path at a time. A second process can share a runtime started in
+// server mode with [WithPersistentConnectExisting].
+type PersistPathLockedError struct {
+	// Path is the persist path.
+	Path string
+	// LockFile is the lock file recording the owner.
+	LockFile string
+	// PID is the process ID of the owner, 0 when the lock file could not be read.
+	PID int
+	// Mode is the runtime mode of the owner.
+	Mode PersistentRuntimeMode
+	// URL is the address of the owner's local server in server mode.
+	URL string
+}
+
+// Error implements error.
+func (e *PersistPathLockedError) Error() string {
+	owner := "another process"
+	if e.PID > 0 {
+		owner = fmt.Sprintf("process %d", e.PID)
+	}
+	if e.Mode != "" {
+		owner += fmt.Sprintf(" (%s mode)", e.Mode)
+	}
+	return fmt.Sprintf("persist path %q is in use by %s, which holds the lock on %s", e.Path, owner, e.LockFile)
+}
+
+// localPersistLockInfo is the content of a persist path lock file.
+type localPersistLockInfo struct {
+	PID       int                   `json:"pid"`
+	Hostname  string                `json:"hostname,omitempty"`
+	Mode      PersistentRuntimeMode `json:"mode"`
+	URL       string                `json:"url,omitempty"`
+	ReadOnly  bool                  `json:"read_only,omitempty"`
+	StartedAt time.Time             `json:"started_at"`
+}
+
+// localPersistLock is an OS file lock on a persist path held by this process. The lock is tied to the open
+// file, so the OS releases it when the process exits, however it exits.
+type localPersistLock struct {
+	file *os.File
+	info localPersistLockInfo
+}
+
+func localPersistLockPath(persistPath string) string {
+	return filepath.Clean(persistPath) + localPersistLockSuffix
+}
+
+// acquireLocalPersistLock locks the lock file of the persist path used by cfg and records this process in
+// it. A lock held by another client is reported as a [*PersistPathLockedError].
+func acquireLocalPersistLock(cfg *localClientConfig) (*localPersistLock, error) {
+	persistPath, err := cfg.resolvedPersistPath()
+	if err != nil {
+		return nil, err
+	}
+	lockPath := localPersistLockPath(persistPath)
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o755); err != nil {
+		return nil, errors.Wrap(err, "error creating persist path parent directory")
+	}
+
+	hostname, _ := os.Hostname()
+	info := localPersistLockInfo{
+		PID:       os.Getpid(),
+		Hostname:  hostname,
+		Mode:      cfg.runtimeMode,
+		ReadOnly:  cfg.readOnly,
+		StartedAt: time.Now().UTC(),
+	}
+	// The owner removes the lock file on release; a file locked after its removal is stale, so try again.
+	for attempt := 0; attempt < 3; attempt++ {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening persist path lock file")
+		}
+		locked, err := tryLockLocalPersistFile(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, errors.Wrap(err, "error locking persist path lock file")
+		}
+		if !locked {
+			_ = file.Close()
+			return nil, lockedLocalPersistPath(persistPath, lockPath)
+		}
+		if !localPersistLockCurrent(file, lockPath) {
+			_ = file.Close()
+			continue
+		}
+		lock := &localPersistLock{file: file, info: info}
+		if err := lock.write(); err != nil {
+			_ = lock.release()
+			return nil, err
+		}
+		return lock, nil
+	}
+	return nil, lockedLocalPersistPath(persistPath, lockPath)
+}
+
+// localPersistLockCurrent reports whether file is still the lock file at lockPath.
+func localPersistLockCurrent(file *os.File, lockPath string) bool {
+	held, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(lockPath)
+	return err == nil && os.SameFile(held, current)
+}
+
+// lockedLocalPersistPath describes the owner of a held lock. The owner may still be writing the lock file,
+// in which case it is reported without details.
+func lockedLocalPersistPath(persistPath, lockPath string) *PersistPathLockedError {
+	lockedErr := &PersistPathLockedError{Path: persistPath, LockFile: lockPath}
+	if info, err := readLocalPersistLock(lockPath); err == nil {
+		lockedErr.PID = info.PID
+		lockedErr.Mode = info.Mode
+		lockedErr.URL = info.URL
+	}
+	return lockedErr
+}
+
+func readLocalPersistLock(lockPath string) (*localPersistLockInfo, error) {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	var info localPersistLockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (lock *localPersistLock) write() error {
+	data, err := json.Marshal(lock.info)
+	if err != nil {
+		return errors.Wrap(err, "error encoding persist path lock file")
+	}
+	if err := lock.file.Truncate(0); err != nil {
+		return errors.Wrap(err, "error writing persist path lock file")
+	}
+	if _, err := lock.file.WriteAt(data, 0); err != nil {
+		return errors.Wrap(err, "error writing persist path lock file")
+	}
+	if err := lock.file.Sync(); err != nil {
+		return errors.Wrap(err, "error writing persist path lock file")
+	}
+	return nil
+}
+
+// setURL records the address of the local server, so that other processes can connect to it.
+func (lock *localPersistLock) setURL(url string) error {
+	if lock == nil {
+		return nil
+	}
+	lock.info.URL = url
+	return lock.write()
+}
+
+// release removes the lock file while the lock is still held, then closes it, which releases the lock.
+// Where open files cannot be removed the file is left behind; it is not locked, so it does not block
+// the next client.
+func (lock *localPersistLock) release() error {
+	if lock == nil || lock.file == nil {
+		return nil
+	}
+	lockPath := lock.file.Name()
+	removeErr := os.Remove(lockPath)
+	closeErr := lock.file.Close()
+	lock.file = nil
+	if removeErr != nil && !os.IsNotExist(removeErr) && localPersistLockRemovable {
+		return errors.Wrapf(removeErr, "error removing persist path lock file %s", lockPath)
+	}
+	if closeErr != nil {
+		return errors.Wrap(closeErr, "error closing persist path lock file")
+	}
+	return nil
+}
+
+// connectExistingLocalRuntime connects to the server-mode runtime of the process holding the persist path.
+// The owner records its URL once its server is ready, so a lock without a URL is polled until startup completes.
+func connectExistingLocalRuntime(cfg *localClientConfig, lockedErr *PersistPathLockedError) (Client, error) {
+	if lockedErr.Mode != "" && lockedErr.Mode != PersistentRuntimeModeServer {
+		return nil, errors.Wrapf(lockedErr, "cannot connect to the %s mode runtime of the owner, start it in server mode to share it", lockedErr.Mode)
+	}
+	url := lockedErr.URL
+	if url == "" {
+		err := pollUntilReady(localClientStartupTimeout, localClientStartupPollInterval, func(context.Context) error {
+			info, err := readLocalPersistLock(lockedErr.LockFile)
+			if err != nil {
+				return err
+			}
+			if info.Mode != PersistentRuntimeModeServer {
+				return errors.Errorf("owner runs in %s mode", info.Mode)
+			}
+			if info.URL == "" {
+				return errors.New("owner has not recorded its server URL yet")
+			}
+			url = info.URL
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(lockedErr, "error waiting for the owner's server URL: %v", err)
+		}
+	}
+
+	apiClient, err := newLocalHTTPClient(cfg, url)
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting to existing local runtime")
+	}
+	client := &PersistentClient{Client: apiClient, mode: PersistentRuntimeModeServer, collectionDefaults: cfg.collectionDefaults()}
+	client.persistPath = lockedErr.Path
+	if cfg.readOnly {
+		client.Client = newReadOnlyClient(apiClient)
+	}
+	return client, nil
+}
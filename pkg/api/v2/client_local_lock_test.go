@@ -0,0 +1,274 @@
+//go:build basicv2 && !cloud
+// +build basicv2,!cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	localchroma "github.com/amikos-tech/chroma-go-local"
+	embeddingspkg "github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+func newLockTestConfig(t *testing.T, persistPath string, mode PersistentRuntimeMode) *localClientConfig {
+	t.Helper()
+	cfg := defaultLocalClientConfig()
+	cfg.persistPath = persistPath
+	cfg.runtimeMode = mode
+	return cfg
+}
+
+func writeTestPersistLock(t *testing.T, persistPath string, info localPersistLockInfo) string {
+	t.Helper()
+	data, err := json.Marshal(info)
+	require.NoError(t, err)
+	lockPath := localPersistLockPath(persistPath)
+	require.NoError(t, os.WriteFile(lockPath, data, 0o644))
+	return lockPath
+}
+
+func TestAcquireLocalPersistLock_RejectsSecondOwner(t *testing.T) {
+	persistPath := filepath.Join(t.TempDir(), "data")
+	cfg := newLockTestConfig(t, persistPath, PersistentRuntimeModeEmbedded)
+
+	lock, err := acquireLocalPersistLock(cfg)
+	require.NoError(t, err)
+
+	_, err = acquireLocalPersistLock(cfg)
+	require.Error(t, err)
+	var lockedErr *PersistPathLockedError
+	require.True(t, errors.As(err, &lockedErr))
+	require.Equal(t, os.Getpid(), lockedErr.PID)
+	require.Equal(t, PersistentRuntimeModeEmbedded, lockedErr.Mode)
+	require.Equal(t, persistPath, lockedErr.Path)
+	require.Contains(t, err.Error(), "process")
+	require.Contains(t, err.Error(), persistPath+".lock")
+
+	require.NoError(t, lock.release())
+	require.NoFileExists(t, localPersistLockPath(persistPath))
+
+	lock, err = acquireLocalPersistLock(cfg)
+	require.NoError(t, err)
+	require.NoError(t, lock.release())
+}
+
+func TestAcquireLocalPersistLock_TakesOverUnheldLockFiles(t *testing.T) {
+	t.Run("left by an exited owner", func(t *testing.T) {
+		persistPath := filepath.Join(t.TempDir(), "data")
+		writeTestPersistLock(t, persistPath, localPersistLockInfo{PID: 4242, Mode: PersistentRuntimeModeServer, URL: "http://127.0.0.1:8000"})
+
+		lock, err := acquireLocalPersistLock(newLockTestConfig(t, persistPath, PersistentRuntimeModeEmbedded))
+		require.NoError(t, err)
+		info, err := readLocalPersistLock(localPersistLockPath(persistPath))
+		require.NoError(t, err)
+		require.Equal(t, os.Getpid(), info.PID)
+		require.Equal(t, PersistentRuntimeModeEmbedded, info.Mode)
+		require.Empty(t, info.URL)
+		require.NoError(t, lock.release())
+	})
+
+	t.Run("unreadable", func(t *testing.T) {
+		persistPath := filepath.Join(t.TempDir(), "data")
+		require.NoError(t, os.WriteFile(localPersistLockPath(persistPath), []byte("{"), 0o644))
+
+		lock, err := acquireLocalPersistLock(newLockTestConfig(t, persistPath, PersistentRuntimeModeEmbedded))
+		require.NoError(t, err)
+		info, err := readLocalPersistLock(localPersistLockPath(persistPath))
+		require.NoError(t, err)
+		require.Equal(t, os.Getpid(), info.PID)
+		require.NoError(t, lock.release())
+	})
+}
+
+func TestResolvedPersistPath(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "chroma.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("persist_path: "+filepath.Join(dir, "from-file")+"\nunknown_key: 1\n"), 0o644))
+
+	tests := []struct {
+		name string
+		cfg  *localClientConfig
+		want string
+	}{
+		{name: "option", cfg: &localClientConfig{persistPath: filepath.Join(dir, "option")}, want: filepath.Join(dir, "option")},
+		{name: "runtime config", cfg: &localClientConfig{persistPath: "./ignored", runtimeConfig: &LocalRuntimeConfig{PersistPath: filepath.Join(dir, "typed")}}, want: filepath.Join(dir, "typed")},
+		{name: "config file", cfg: &localClientConfig{persistPath: "./ignored", configPath: configPath}, want: filepath.Join(dir, "from-file")},
+		{name: "raw yaml without persist path", cfg: &localClientConfig{persistPath: filepath.Join(dir, "default"), rawYAML: "port: 8010\n"}, want: filepath.Join(dir, "default")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.resolvedPersistPath()
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func stubLocalServerRuntime(t *testing.T, server *stubLocalServer) {
+	t.Helper()
+	lockLocalTestHooks(t)
+
+	origInit := localInitFunc
+	origResolve := localResolveLibraryPathFunc
+	origNewServer := localNewServerFunc
+	origWait := localWaitReadyFunc
+	origNewEmbedded := localNewEmbeddedFunc
+	origWaitEmbedded := localWaitEmbeddedReadyFunc
+	t.Cleanup(func() {
+		localInitFunc = origInit
+		localResolveLibraryPathFunc = origResolve
+		localNewServerFunc = origNewServer
+		localWaitReadyFunc = origWait
+		localNewEmbeddedFunc = origNewEmbedded
+		localWaitEmbeddedReadyFunc = origWaitEmbedded
+	})
+
+	localResolveLibraryPathFunc = func(cfg *localClientConfig) (string, error) { return "/tmp/libchroma_go_shim.so", nil }
+	localInitFunc = func(string) error { return nil }
+	localNewServerFunc = func(...localchroma.ServerOption) (localServer, error) { return server, nil }
+	localWaitReadyFunc = func(*APIClientV2) error { return nil }
+	localNewEmbeddedFunc = func(...localchroma.EmbeddedOption) (localEmbeddedRuntime, error) {
+		return newMemoryEmbeddedRuntime(), nil
+	}
+	localWaitEmbeddedReadyFunc = func(localEmbeddedRuntime) error { return nil }
+}
+
+func TestNewPersistentClient_LocksPersistPath(t *testing.T) {
+	server := &stubLocalServer{url: "http://127.0.0.1:8011"}
+	stubLocalServerRuntime(t, server)
+	persistPath := filepath.Join(t.TempDir(), "data")
+
+	owner, err := NewPersistentClient(WithPersistentPath(persistPath), WithPersistentRuntimeMode(PersistentRuntimeModeServer))
+	require.NoError(t, err)
+	info, err := readLocalPersistLock(localPersistLockPath(persistPath))
+	require.NoError(t, err)
+	require.Equal(t, PersistentRuntimeModeServer, info.Mode)
+	require.Equal(t, "http://127.0.0.1:8011", info.URL)
+
+	_, err = NewPersistentClient(WithPersistentPath(persistPath))
+	var lockedErr *PersistPathLockedError
+	require.True(t, errors.As(err, &lockedErr))
+	require.Equal(t, os.Getpid(), lockedErr.PID)
+
+	require.NoError(t, owner.Close())
+	require.NoFileExists(t, localPersistLockPath(persistPath))
+
+	second, err := NewPersistentClient(WithPersistentPath(persistPath))
+	require.NoError(t, err)
+	require.NoError(t, second.Close())
+}
+
+func TestNewPersistentClient_ReleasesLockWhenRuntimeFailsToStart(t *testing.T) {
+	stubLocalServerRuntime(t, &stubLocalServer{})
+	localNewEmbeddedFunc = func(...localchroma.EmbeddedOption) (localEmbeddedRuntime, error) {
+		return nil, errors.New("boom")
+	}
+	persistPath := filepath.Join(t.TempDir(), "data")
+
+	_, err := NewPersistentClient(WithPersistentPath(persistPath))
+	require.Error(t, err)
+	require.NoFileExists(t, localPersistLockPath(persistPath))
+}
+
+func TestNewPersistentClient_ConnectExisting(t *testing.T) {
+	server := &stubLocalServer{url: "http://127.0.0.1:8012"}
+	stubLocalServerRuntime(t, server)
+	persistPath := filepath.Join(t.TempDir(), "data")
+
+	owner, err := NewPersistentClient(WithPersistentPath(persistPath), WithPersistentRuntimeMode(PersistentRuntimeModeServer))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, owner.Close())
+	}()
+
+	initCalls := 0
+	localInitFunc = func(string) error {
+		initCalls++
+		return nil
+	}
+	attached, err := NewPersistentClient(WithPersistentPath(persistPath), WithPersistentConnectExisting(true))
+	require.NoError(t, err)
+	attachedClient, ok := attached.(*PersistentClient)
+	require.True(t, ok)
+	require.Equal(t, PersistentRuntimeModeServer, attachedClient.mode)
+	require.Equal(t, "http://127.0.0.1:8012/api/v2", attachedClient.BaseURL())
+	require.Zero(t, initCalls, "connecting to an existing runtime must not load the native library")
+
+	require.NoError(t, attached.Close())
+	require.Equal(t, 0, server.closeCount, "closing an attached client must not stop the owner's runtime")
+	require.FileExists(t, localPersistLockPath(persistPath))
+}
+
+func TestNewPersistentClient_ConnectExistingRejectsEmbeddedOwner(t *testing.T) {
+	stubLocalServerRuntime(t, &stubLocalServer{})
+	persistPath := filepath.Join(t.TempDir(), "data")
+
+	owner, err := NewPersistentClient(WithPersistentPath(persistPath))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, owner.Close())
+	}()
+
+	_, err = NewPersistentClient(WithPersistentPath(persistPath), WithPersistentConnectExisting(true))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "start it in server mode")
+	var lockedErr *PersistPathLockedError
+	require.True(t, errors.As(err, &lockedErr))
+	require.Equal(t, PersistentRuntimeModeEmbedded, lockedErr.Mode)
+}
+
+func TestNewPersistentClient_ReadOnly(t *testing.T) {
+	stubLocalServerRuntime(t, &stubLocalServer{})
+	runtime := newMemoryEmbeddedRuntime()
+	localNewEmbeddedFunc = func(...localchroma.EmbeddedOption) (localEmbeddedRuntime, error) {
+		return runtime, nil
+	}
+	persistPath := filepath.Join(t.TempDir(), "data")
+	ctx := context.Background()
+	ef := embeddingspkg.NewConsistentHashEmbeddingFunction()
+
+	writer, err := NewPersistentClient(WithPersistentPath(persistPath))
+	require.NoError(t, err)
+	collection, err := writer.CreateCollection(ctx, "docs", WithEmbeddingFunctionCreate(ef))
+	require.NoError(t, err)
+	require.NoError(t, collection.Add(ctx, WithIDs("1"), WithTexts("hello")))
+	require.NoError(t, writer.Close())
+
+	reader, err := NewPersistentClient(WithPersistentPath(persistPath), WithPersistentReadOnly(true))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, reader.Close())
+	}()
+	info, err := readLocalPersistLock(localPersistLockPath(persistPath))
+	require.NoError(t, err)
+	require.True(t, info.ReadOnly)
+
+	_, err = reader.CreateCollection(ctx, "other", WithEmbeddingFunctionCreate(ef))
+	require.ErrorIs(t, err, ErrPersistentReadOnly)
+	require.ErrorIs(t, reader.DeleteCollection(ctx, "docs"), ErrPersistentReadOnly)
+	require.ErrorIs(t, reader.Reset(ctx), ErrPersistentReadOnly)
+
+	existing, err := reader.GetOrCreateCollection(ctx, "docs", WithEmbeddingFunctionCreate(ef))
+	require.NoError(t, err)
+	count, err := existing.Count(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.ErrorIs(t, existing.Add(ctx, WithIDs("2"), WithTexts("world")), ErrPersistentReadOnly)
+	require.ErrorIs(t, existing.Delete(ctx, WithIDs("1")), ErrPersistentReadOnly)
+	require.ErrorIs(t, existing.ModifyName(ctx, "renamed"), ErrPersistentReadOnly)
+
+	_, err = reader.GetOrCreateCollection(ctx, "missing", WithEmbeddingFunctionCreate(ef))
+	require.Error(t, err)
+
+	collections, err := reader.ListCollections(ctx)
+	require.NoError(t, err)
+	require.Len(t, collections, 1)
+	require.ErrorIs(t, collections[0].Upsert(ctx, WithIDs("1"), WithTexts("x")), ErrPersistentReadOnly)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package v2
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// localPersistLockRemovable reports whether a lock file can be removed while it is open.
+const localPersistLockRemovable = true
+
+// tryLockLocalPersistFile takes an exclusive flock on file without waiting. It reports false when
+// another open file holds the lock.
+func tryLockLocalPersistFile(file *os.File) (bool, error) {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package v2
+
+import (
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// localPersistLockRemovable reports whether a lock file can be removed while it is open.
+const localPersistLockRemovable = false
+
+// tryLockLocalPersistFile takes an exclusive LockFileEx lock on file without waiting. It reports false
+// when another handle holds the lock. The locked byte lies far past the content, which stays readable.
+func tryLockLocalPersistFile(file *os.File) (bool, error) {
+	overlapped := &windows.Overlapped{Offset: math.MaxUint32, OffsetHigh: math.MaxUint32}
+	err := windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, overlapped)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, windows.ERROR_LOCK_VIOLATION):
+		return false, nil
+	default:
+		return false, err
+	}
+}
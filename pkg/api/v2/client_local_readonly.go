@@ -0,0 +1,119 @@
+package v2
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPersistentReadOnly is returned for writes through a persistent client opened with [WithPersistentReadOnly].
+var ErrPersistentReadOnly = errors.New("persistent client is read-only")
+
+// readOnlyClient rejects tenant, database and collection changes and returns read-only collections.
+type readOnlyClient struct {
+	Client
+}
+
+func newReadOnlyClient(client Client) *readOnlyClient {
+	return &readOnlyClient{Client: client}
+}
+
+func (c *readOnlyClient) CreateTenant(context.Context, Tenant) (Tenant, error) {
+	return nil, errors.Wrap(ErrPersistentReadOnly, "cannot create tenant")
+}
+
+func (c *readOnlyClient) CreateDatabase(context.Context, Database) (Database, error) {
+	return nil, errors.Wrap(ErrPersistentReadOnly, "cannot create database")
+}
+
+func (c *readOnlyClient) DeleteDatabase(context.Context, Database) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot delete database")
+}
+
+func (c *readOnlyClient) Reset(context.Context) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot reset")
+}
+
+func (c *readOnlyClient) CreateCollection(context.Context, string, ...CreateCollectionOption) (Collection, error) {
+	return nil, errors.Wrap(ErrPersistentReadOnly, "cannot create collection")
+}
+
+// GetOrCreateCollection gets an existing collection, passing on the embedding functions and database of the
+// create options. Missing collections are not created.
+func (c *readOnlyClient) GetOrCreateCollection(ctx context.Context, name string, options ...CreateCollectionOption) (Collection, error) {
+	op, err := NewCreateCollectionOp(name, options...)
+	if err != nil {
+		return nil, err
+	}
+	getOptions := make([]GetCollectionOption, 0, 3)
+	if op.embeddingFunction != nil {
+		getOptions = append(getOptions, WithEmbeddingFunctionGet(op.embeddingFunction))
+	}
+	if op.contentEmbeddingFunction != nil {
+		getOptions = append(getOptions, WithContentEmbeddingFunctionGet(op.contentEmbeddingFunction))
+	}
+	if op.Database != nil {
+		getOptions = append(getOptions, WithDatabaseGet(op.Database))
+	}
+	return c.GetCollection(ctx, name, getOptions...)
+}
+
+func (c *readOnlyClient) DeleteCollection(context.Context, string, ...DeleteCollectionOption) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot delete collection")
+}
+
+func (c *readOnlyClient) GetCollection(ctx context.Context, name string, opts ...GetCollectionOption) (Collection, error) {
+	collection, err := c.Client.GetCollection(ctx, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyCollection{Collection: collection}, nil
+}
+
+func (c *readOnlyClient) ListCollections(ctx context.Context, opts ...ListCollectionsOption) ([]Collection, error) {
+	collections, err := c.Client.ListCollections(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for i, collection := range collections {
+		collections[i] = &readOnlyCollection{Collection: collection}
+	}
+	return collections, nil
+}
+
+// readOnlyCollection rejects record and collection changes.
+type readOnlyCollection struct {
+	Collection
+}
+
+func (c *readOnlyCollection) Add(context.Context, ...CollectionAddOption) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot add records")
+}
+
+func (c *readOnlyCollection) Upsert(context.Context, ...CollectionAddOption) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot upsert records")
+}
+
+func (c *readOnlyCollection) Update(context.Context, ...CollectionUpdateOption) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot update records")
+}
+
+func (c *readOnlyCollection) Delete(context.Context, ...CollectionDeleteOption) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot delete records")
+}
+
+func (c *readOnlyCollection) ModifyName(context.Context, string) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot rename collection")
+}
+
+func (c *readOnlyCollection) ModifyMetadata(context.Context, CollectionMetadata) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot modify collection metadata")
+}
+
+func (c *readOnlyCollection) ModifyConfiguration(context.Context, *UpdateCollectionConfiguration) error {
+	return errors.Wrap(ErrPersistentReadOnly, "cannot modify collection configuration")
+}
+
+func (c *readOnlyCollection) Fork(context.Context, string) (Collection, error) {
+	return nil, errors.Wrap(ErrPersistentReadOnly, "cannot fork collection")
+}
@@ -0,0 +1,606 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	localchroma "github.com/amikos-tech/chroma-go-local"
+)
+
+// LocalKnnIndex selects the vector index the local runtime builds for new collections.
+type LocalKnnIndex string
+
+const (
+	LocalKnnIndexHNSW  LocalKnnIndex = "hnsw"
+	LocalKnnIndexSPANN LocalKnnIndex = "spann"
+)
+
+// LocalRuntimeConfig is the typed configuration of the local Chroma runtime started by [NewPersistentClient].
+//
+// It is rendered to the YAML accepted by the chroma-go-local runtime with [LocalRuntimeConfig.YAML]
+// and can be read back from existing YAML files with [LoadLocalRuntimeConfig]. Keys of a YAML file that
+// have no typed field are kept in Extra and rendered back unchanged. Settings applied by the client
+// rather than the runtime (CollectionDefaults, MaxBatchSize, LogLevel and WAL) are rendered in a separate
+// client section, which is never passed to the runtime.
+//
+// Empty storage and network fields fall back to the values of the other persistent client options,
+// e.g. [WithPersistentPath] or [WithPersistentPort].
+type LocalRuntimeConfig struct {
+	// Storage
+	PersistPath    string                `json:"persist_path,omitempty"`
+	SQLiteFilename string                `json:"sqlite_filename,omitempty"`
+	AllowReset     bool                  `json:"allow_reset,omitempty"`
+	SQLiteDB       *LocalSQLiteDBConfig  `json:"sqlitedb,omitempty"`
+	Compactor      *LocalCompactorConfig `json:"compactor,omitempty"`
+
+	// Network (server mode only)
+	ListenAddress       string   `json:"listen_address,omitempty"`
+	Port                int      `json:"port,omitempty"`
+	MaxPayloadSizeBytes int      `json:"max_payload_size_bytes,omitempty"`
+	CORSAllowOrigins    []string `json:"cors_allow_origins,omitempty"`
+
+	// Indexing
+	DefaultKnnIndex LocalKnnIndex `json:"default_knn_index,omitempty"`
+	// CollectionDefaults are applied by the client to collections created without explicit index settings.
+	CollectionDefaults *LocalCollectionDefaults `json:"-"`
+	// MaxBatchSize caps the batch size the client accepts below the limit reported by the runtime.
+	MaxBatchSize uint32 `json:"-"`
+
+	// Logging
+	// LogLevel is the level of the runtime's trace output, one of trace, debug, info, warn, error or off.
+	// The runtime has no config key or init parameter for it and only reads the RUST_LOG environment
+	// variable, so when the runtime starts and RUST_LOG is unset, LogLevel is written to RUST_LOG of the
+	// whole process. It is not restored when the client closes and applies to every runtime, and any other
+	// code reading RUST_LOG, in the process. Set RUST_LOG before starting clients to avoid the side effect.
+	LogLevel string `json:"-"`
+	// WAL is the retention of the write-ahead log, applied when the embedded runtime starts.
+	WAL *LocalWALConfig `json:"-"`
+
+	// Telemetry
+	// AnonymizedTelemetry enables or disables Chroma's anonymized product telemetry; nil keeps the runtime default.
+	AnonymizedTelemetry *bool                     `json:"anonymized_telemetry,omitempty"`
+	OpenTelemetry       *LocalOpenTelemetryConfig `json:"open_telemetry,omitempty"`
+
+	// Extra holds runtime keys without a typed field. Typed fields take precedence.
+	Extra map[string]any `json:"-"`
+}
+
+// localClientConfigKey is the YAML key of the client section of a [LocalRuntimeConfig].
+const localClientConfigKey = "client"
+
+// localClientSection holds the settings of a [LocalRuntimeConfig] that the client applies itself.
+type localClientSection struct {
+	CollectionDefaults *LocalCollectionDefaults `json:"collection_defaults,omitempty"`
+	MaxBatchSize       uint32                   `json:"max_batch_size,omitempty"`
+	LogLevel           string                   `json:"log_level,omitempty"`
+	WAL                *LocalWALConfig          `json:"wal,omitempty"`
+}
+
+// LocalSQLiteDBConfig configures the SQLite database that stores metadata and the write-ahead log.
+type LocalSQLiteDBConfig struct {
+	// HashType is the migration hash, "md5" or "sha256".
+	HashType string `json:"hash_type,omitempty"`
+	// MigrationMode is "apply" to migrate the database on start or "validate" to only check it.
+	MigrationMode string `json:"migration_mode,omitempty"`
+}
+
+// LocalCompactorConfig configures background compaction of the write-ahead log into the vector and metadata segments.
+type LocalCompactorConfig struct {
+	CompactionIntervalSec      uint64   `json:"compaction_interval_sec,omitempty"`
+	CompactionManagerQueueSize uint     `json:"compaction_manager_queue_size,omitempty"`
+	MaxConcurrentJobs          uint     `json:"max_concurrent_jobs,omitempty"`
+	MinCompactionSize          uint     `json:"min_compaction_size,omitempty"`
+	MaxCompactionSize          uint     `json:"max_compaction_size,omitempty"`
+	MaxPartitionSize           uint     `json:"max_partition_size,omitempty"`
+	DisabledCollections        []string `json:"disabled_collections,omitempty"`
+}
+
+// LocalWALConfig is the retention of the write-ahead log. When the embedded runtime starts, log entries that are
+// already compacted and older than MaxAgeSec, or beyond the newest MaxBytes, are pruned.
+type LocalWALConfig struct {
+	MaxAgeSec uint64 `json:"max_age_sec,omitempty"`
+	MaxBytes  uint64 `json:"max_bytes,omitempty"`
+	// Vacuum shrinks the SQLite file after pruning.
+	Vacuum bool `json:"vacuum,omitempty"`
+}
+
+// LocalCollectionDefaults holds the index parameters of new collections. At most one of HNSW and SPANN may be set.
+type LocalCollectionDefaults struct {
+	HNSW  *HnswIndexConfig  `json:"hnsw,omitempty"`
+	SPANN *SpannIndexConfig `json:"spann,omitempty"`
+}
+
+// LocalOpenTelemetryConfig configures OpenTelemetry trace export of the local runtime.
+type LocalOpenTelemetryConfig struct {
+	Endpoint    string                     `json:"endpoint"`
+	ServiceName string                     `json:"service_name"`
+	Filters     []LocalOpenTelemetryFilter `json:"filters,omitempty"`
+}
+
+// LocalOpenTelemetryFilter sets the trace level exported for one crate of the runtime.
+type LocalOpenTelemetryFilter struct {
+	CrateName   string `json:"crate_name"`
+	FilterLevel string `json:"filter_level"`
+}
+
+var (
+	localSQLiteHashTypes      = []string{"md5", "sha256"}
+	localSQLiteMigrationModes = []string{"apply", "validate"}
+	localOpenTelemetryLevels  = []string{"trace", "debug", "info", "warn", "error"}
+	localLogLevels            = []string{"trace", "debug", "info", "warn", "error", "off"}
+)
+
+// Validate checks the configuration without starting the runtime.
+func (c *LocalRuntimeConfig) Validate() error {
+	if c == nil {
+		return errors.New("local runtime config cannot be nil")
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return errors.New("port must be between 0 and 65535")
+	}
+	if c.MaxPayloadSizeBytes < 0 {
+		return errors.New("max_payload_size_bytes cannot be negative")
+	}
+	if strings.ContainsAny(c.SQLiteFilename, `/\`) {
+		return errors.New("sqlite_filename must be a file name, not a path")
+	}
+	for i, origin := range c.CORSAllowOrigins {
+		if strings.TrimSpace(origin) == "" {
+			return errors.Errorf("cors_allow_origins[%d] cannot be empty", i)
+		}
+	}
+	switch c.DefaultKnnIndex {
+	case "", LocalKnnIndexHNSW, LocalKnnIndexSPANN:
+	default:
+		return errors.Errorf("unsupported default_knn_index %q, expected %q or %q", c.DefaultKnnIndex, LocalKnnIndexHNSW, LocalKnnIndexSPANN)
+	}
+	if c.SQLiteDB != nil {
+		if err := validateLocalConfigEnum("sqlitedb.hash_type", c.SQLiteDB.HashType, localSQLiteHashTypes); err != nil {
+			return err
+		}
+		if err := validateLocalConfigEnum("sqlitedb.migration_mode", c.SQLiteDB.MigrationMode, localSQLiteMigrationModes); err != nil {
+			return err
+		}
+	}
+	if err := validateLocalConfigEnum("log_level", c.LogLevel, localLogLevels); err != nil {
+		return err
+	}
+	if c.WAL != nil && c.WAL.MaxAgeSec == 0 && c.WAL.MaxBytes == 0 {
+		return errors.New("wal requires max_age_sec or max_bytes")
+	}
+	if c.Compactor != nil {
+		if c.Compactor.MinCompactionSize > 0 && c.Compactor.MaxCompactionSize > 0 &&
+			c.Compactor.MinCompactionSize > c.Compactor.MaxCompactionSize {
+			return errors.New("compactor.min_compaction_size cannot exceed compactor.max_compaction_size")
+		}
+	}
+	if c.CollectionDefaults != nil {
+		if err := c.CollectionDefaults.validate(); err != nil {
+			return err
+		}
+	}
+	if c.OpenTelemetry != nil {
+		if err := c.OpenTelemetry.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *LocalCollectionDefaults) validate() error {
+	if d.HNSW != nil && d.SPANN != nil {
+		return errors.New("collection_defaults cannot set both hnsw and spann")
+	}
+	// Unset parameters keep the runtime defaults, so validate them as if the defaults were applied.
+	validate := validator.New()
+	if d.HNSW != nil {
+		hnsw := *d.HNSW
+		if err := defaults.Set(&hnsw); err != nil {
+			return errors.Wrap(err, "failed to set defaults")
+		}
+		if err := validate.Struct(&hnsw); err != nil {
+			return errors.Wrap(err, "invalid collection_defaults.hnsw")
+		}
+		if hnsw.ResizeFactor < 0 {
+			return errors.New("collection_defaults.hnsw.resize_factor cannot be negative")
+		}
+	}
+	if d.SPANN != nil {
+		if err := validate.Struct(d.SPANN); err != nil {
+			return errors.Wrap(err, "invalid collection_defaults.spann")
+		}
+	}
+	return nil
+}
+
+func (o *LocalOpenTelemetryConfig) validate() error {
+	if strings.TrimSpace(o.Endpoint) == "" {
+		return errors.New("open_telemetry.endpoint cannot be empty")
+	}
+	endpoint, err := url.Parse(o.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return errors.Errorf("open_telemetry.endpoint %q must be an absolute URL", o.Endpoint)
+	}
+	if strings.TrimSpace(o.ServiceName) == "" {
+		return errors.New("open_telemetry.service_name cannot be empty")
+	}
+	for i, filter := range o.Filters {
+		if strings.TrimSpace(filter.CrateName) == "" {
+			return errors.Errorf("open_telemetry.filters[%d].crate_name cannot be empty", i)
+		}
+		if err := validateLocalConfigEnum("open_telemetry.filters.filter_level", filter.FilterLevel, localOpenTelemetryLevels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateLocalConfigEnum(field, value string, allowed []string) error {
+	if value == "" {
+		return nil
+	}
+	for _, v := range allowed {
+		if value == v {
+			return nil
+		}
+	}
+	return errors.Errorf("unsupported %s %q, expected one of %s", field, value, strings.Join(allowed, ", "))
+}
+
+// clone returns a deep copy of the configuration.
+func (c *LocalRuntimeConfig) clone() *LocalRuntimeConfig {
+	if c == nil {
+		return nil
+	}
+	copied := *c
+	copied.CORSAllowOrigins = cloneSlice(c.CORSAllowOrigins)
+	if c.SQLiteDB != nil {
+		sqliteDB := *c.SQLiteDB
+		copied.SQLiteDB = &sqliteDB
+	}
+	if c.Compactor != nil {
+		compactor := *c.Compactor
+		compactor.DisabledCollections = cloneSlice(c.Compactor.DisabledCollections)
+		copied.Compactor = &compactor
+	}
+	if c.CollectionDefaults != nil {
+		collectionDefaults := LocalCollectionDefaults{}
+		if c.CollectionDefaults.HNSW != nil {
+			hnsw := *c.CollectionDefaults.HNSW
+			collectionDefaults.HNSW = &hnsw
+		}
+		if c.CollectionDefaults.SPANN != nil {
+			spann := *c.CollectionDefaults.SPANN
+			collectionDefaults.SPANN = &spann
+		}
+		copied.CollectionDefaults = &collectionDefaults
+	}
+	if c.WAL != nil {
+		wal := *c.WAL
+		copied.WAL = &wal
+	}
+	if c.AnonymizedTelemetry != nil {
+		enabled := *c.AnonymizedTelemetry
+		copied.AnonymizedTelemetry = &enabled
+	}
+	if c.OpenTelemetry != nil {
+		openTelemetry := *c.OpenTelemetry
+		openTelemetry.Filters = cloneSlice(c.OpenTelemetry.Filters)
+		copied.OpenTelemetry = &openTelemetry
+	}
+	if c.Extra != nil {
+		copied.Extra = cloneLocalConfigValue(c.Extra).(map[string]any)
+	}
+	return &copied
+}
+
+func cloneSlice[T any](values []T) []T {
+	if values == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(values)), values...)
+}
+
+// cloneLocalConfigValue deep copies the maps and slices of a decoded YAML value.
+func cloneLocalConfigValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for k, item := range v {
+			copied[k] = cloneLocalConfigValue(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, item := range v {
+			copied[i] = cloneLocalConfigValue(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// YAML validates the configuration and renders it to the YAML accepted by the local runtime, including
+// the client section.
+func (c *LocalRuntimeConfig) YAML() (string, error) {
+	return c.render(nil, true)
+}
+
+// render renders the configuration with overrides applied on top of the typed fields, and with the
+// client section if withClient is set.
+func (c *LocalRuntimeConfig) render(overrides map[string]any, withClient bool) (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding local runtime config")
+	}
+	typed := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&typed); err != nil {
+		return "", errors.Wrap(err, "error encoding local runtime config")
+	}
+	typed = yamlNumbers(typed).(map[string]any)
+	if withClient {
+		client, err := c.clientSection()
+		if err != nil {
+			return "", err
+		}
+		if len(client) > 0 {
+			typed[localClientConfigKey] = client
+		}
+	}
+	doc := make(map[string]any, len(c.Extra)+len(typed))
+	for k, v := range c.Extra {
+		doc[k] = v
+	}
+	for k, v := range typed {
+		doc[k] = v
+	}
+	// allow_reset is always rendered so that a disabled reset is explicit in the file.
+	doc["allow_reset"] = c.AllowReset
+	for k, v := range overrides {
+		doc[k] = v
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return "", errors.Wrap(err, "error rendering local runtime config")
+	}
+	if err := encoder.Close(); err != nil {
+		return "", errors.Wrap(err, "error rendering local runtime config")
+	}
+	return buf.String(), nil
+}
+
+// clientSection returns the client section as a YAML document, empty if no client setting is set.
+func (c *LocalRuntimeConfig) clientSection() (map[string]any, error) {
+	payload, err := json.Marshal(localClientSection{
+		CollectionDefaults: c.CollectionDefaults,
+		MaxBatchSize:       c.MaxBatchSize,
+		LogLevel:           c.LogLevel,
+		WAL:                c.WAL,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding local runtime config")
+	}
+	section := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&section); err != nil {
+		return nil, errors.Wrap(err, "error encoding local runtime config")
+	}
+	return yamlNumbers(section).(map[string]any), nil
+}
+
+// yamlNumbers replaces the json.Number values of a decoded document with integers where possible, so that
+// large integers do not render as YAML floats the runtime rejects.
+func yamlNumbers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = yamlNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = yamlNumbers(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// ParseLocalRuntimeConfig reads a [LocalRuntimeConfig] from local runtime YAML and validates it.
+func ParseLocalRuntimeConfig(data []byte) (*LocalRuntimeConfig, error) {
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "error parsing local runtime YAML")
+	}
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding local runtime YAML")
+	}
+	cfg := &LocalRuntimeConfig{}
+	if err := json.Unmarshal(payload, cfg); err != nil {
+		return nil, errors.Wrap(err, "error decoding local runtime YAML")
+	}
+	if raw, ok := doc[localClientConfigKey]; ok {
+		payload, err := json.Marshal(raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding local runtime YAML")
+		}
+		client := localClientSection{}
+		if err := json.Unmarshal(payload, &client); err != nil {
+			return nil, errors.Wrap(err, "error decoding client section of local runtime YAML")
+		}
+		cfg.CollectionDefaults, cfg.MaxBatchSize, cfg.LogLevel, cfg.WAL = client.CollectionDefaults, client.MaxBatchSize, client.LogLevel, client.WAL
+	}
+	known := localRuntimeConfigKeys()
+	for k, v := range doc {
+		if known[k] {
+			continue
+		}
+		if cfg.Extra == nil {
+			cfg.Extra = map[string]any{}
+		}
+		cfg.Extra[k] = v
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadLocalRuntimeConfig reads a [LocalRuntimeConfig] from a local runtime YAML file.
+func LoadLocalRuntimeConfig(path string) (*LocalRuntimeConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading local runtime config")
+	}
+	return ParseLocalRuntimeConfig(data)
+}
+
+// localRuntimeConfigKeys returns the top-level YAML keys with a typed field in [LocalRuntimeConfig].
+func localRuntimeConfigKeys() map[string]bool {
+	keys := map[string]bool{localClientConfigKey: true}
+	t := reflect.TypeOf(LocalRuntimeConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+// localRuntimeEnvMu makes checking and setting the runtime environment atomic across clients.
+var localRuntimeEnvMu sync.Mutex
+
+// setRuntimeEnv sets the environment the runtime reads settings from that its YAML does not carry.
+// The environment is process-wide, see [LocalRuntimeConfig.LogLevel].
+func (c *LocalRuntimeConfig) setRuntimeEnv() error {
+	if c.LogLevel == "" {
+		return nil
+	}
+	localRuntimeEnvMu.Lock()
+	defer localRuntimeEnvMu.Unlock()
+	if localGetenvFunc("RUST_LOG") != "" {
+		return nil
+	}
+	return errors.Wrap(os.Setenv("RUST_LOG", c.LogLevel), "error setting local runtime log level")
+}
+
+// pruneLocalWAL applies the write-ahead log retention of wal to an embedded runtime.
+func pruneLocalWAL(embedded localEmbeddedRuntime, wal *LocalWALConfig) error {
+	if wal == nil {
+		return nil
+	}
+	pruner, ok := embedded.(interface {
+		PruneAllWAL(options ...localchroma.WALPruneOption) (*localchroma.WALPruneResult, error)
+	})
+	if !ok {
+		return errors.New("local runtime does not support pruning the write-ahead log")
+	}
+	var options []localchroma.WALPruneOption
+	if wal.MaxAgeSec > 0 {
+		options = append(options, localchroma.WithWALPruneMaxAge(time.Duration(wal.MaxAgeSec)*time.Second))
+	}
+	if wal.MaxBytes > 0 {
+		options = append(options, localchroma.WithWALPruneMaxBytes(wal.MaxBytes))
+	}
+	if wal.Vacuum {
+		options = append(options, localchroma.WithWALPruneVacuum())
+	}
+	if _, err := pruner.PruneAllWAL(options...); err != nil {
+		return errors.Wrap(err, "error pruning local write-ahead log")
+	}
+	return nil
+}
+
+// runtimeYAML renders the configuration for [NewPersistentClient], filling empty storage and
+// network fields from the persistent client options.
+func (c *LocalRuntimeConfig) runtimeYAML(cfg *localClientConfig) (string, error) {
+	resolved := *c
+	if resolved.PersistPath == "" {
+		resolved.PersistPath = cfg.persistPath
+	}
+	if !resolved.AllowReset {
+		resolved.AllowReset = cfg.allowReset
+	}
+	if cfg.runtimeMode != PersistentRuntimeModeServer {
+		return resolved.render(nil, false)
+	}
+	if resolved.ListenAddress == "" {
+		resolved.ListenAddress = cfg.listenAddress
+	}
+	if resolved.Port == 0 {
+		resolved.Port = cfg.port
+	}
+	// The port is always rendered so that port 0 selects a free port instead of the runtime default.
+	return resolved.render(map[string]any{"port": resolved.Port}, false)
+}
+
+// withLocalCollectionDefaultsCreate applies the collection defaults of a [LocalRuntimeConfig] to a create
+// request that has no index settings of its own in configuration, schema or hnsw:* metadata.
+func withLocalCollectionDefaultsCreate(collectionDefaults *LocalCollectionDefaults) CreateCollectionOption {
+	return func(op *CreateCollectionOp) error {
+		if collectionDefaults == nil || op.Schema != nil {
+			return nil
+		}
+		if op.Metadata != nil {
+			for _, key := range op.Metadata.Keys() {
+				if strings.HasPrefix(key, "hnsw:") {
+					return nil
+				}
+			}
+		}
+		if op.Configuration != nil {
+			if _, ok := op.Configuration.GetRaw("hnsw"); ok {
+				return nil
+			}
+			if _, ok := op.Configuration.GetRaw("spann"); ok {
+				return nil
+			}
+		}
+		var key string
+		var params any
+		switch {
+		case collectionDefaults.HNSW != nil:
+			key, params = "hnsw", collectionDefaults.HNSW
+		case collectionDefaults.SPANN != nil:
+			key, params = "spann", collectionDefaults.SPANN
+		default:
+			return nil
+		}
+		value, err := marshalToMap(params)
+		if err != nil {
+			return errors.Wrapf(err, "error encoding default %s configuration", key)
+		}
+		if op.Configuration == nil {
+			op.Configuration = NewCollectionConfiguration()
+		}
+		op.Configuration.SetRaw(key, value)
+		return nil
+	}
+}
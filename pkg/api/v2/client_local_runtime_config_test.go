@@ -0,0 +1,385 @@
+//go:build basicv2 && !cloud
+// +build basicv2,!cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	localchroma "github.com/amikos-tech/chroma-go-local"
+)
+
+func TestLocalRuntimeConfig_YAMLRoundTrip(t *testing.T) {
+	disabled := false
+	cfg := &LocalRuntimeConfig{
+		PersistPath:         "/var/lib/chroma",
+		SQLiteFilename:      "meta.sqlite3",
+		AllowReset:          true,
+		SQLiteDB:            &LocalSQLiteDBConfig{HashType: "sha256", MigrationMode: "apply"},
+		Compactor:           &LocalCompactorConfig{CompactionIntervalSec: 5, MinCompactionSize: 10, MaxCompactionSize: 1000},
+		ListenAddress:       "0.0.0.0",
+		Port:                8010,
+		MaxPayloadSizeBytes: 1 << 20,
+		CORSAllowOrigins:    []string{"http://localhost:3000"},
+		DefaultKnnIndex:     LocalKnnIndexHNSW,
+		CollectionDefaults:  &LocalCollectionDefaults{HNSW: &HnswIndexConfig{EfSearch: 50, MaxNeighbors: 32}},
+		MaxBatchSize:        500,
+		LogLevel:            "info",
+		WAL:                 &LocalWALConfig{MaxAgeSec: 3600, MaxBytes: 64 << 20, Vacuum: true},
+		AnonymizedTelemetry: &disabled,
+		OpenTelemetry: &LocalOpenTelemetryConfig{
+			Endpoint:    "http://otel-collector:4317",
+			ServiceName: "chroma-local",
+			Filters:     []LocalOpenTelemetryFilter{{CrateName: "chroma_frontend", FilterLevel: "debug"}},
+		},
+		Extra: map[string]any{"circuit_breaker": map[string]any{"requests": 100}},
+	}
+
+	rendered, err := cfg.YAML()
+	require.NoError(t, err)
+
+	var doc map[string]any
+	require.NoError(t, yaml.Unmarshal([]byte(rendered), &doc))
+	require.Equal(t, "/var/lib/chroma", doc["persist_path"])
+	require.Equal(t, 8010, doc["port"])
+	require.Equal(t, "hnsw", doc["default_knn_index"])
+	require.Equal(t, map[string]any{"hash_type": "sha256", "migration_mode": "apply"}, doc["sqlitedb"])
+	require.Equal(t, map[string]any{"requests": 100}, doc["circuit_breaker"])
+	require.Equal(t, false, doc["anonymized_telemetry"])
+	require.NotContains(t, doc, "wal")
+	require.NotContains(t, doc, "log_level")
+	client := doc["client"].(map[string]any)
+	require.Equal(t, map[string]any{"max_age_sec": 3600, "max_bytes": 64 << 20, "vacuum": true}, client["wal"])
+	require.Equal(t, "info", client["log_level"])
+	require.Equal(t, 500, client["max_batch_size"])
+	require.Contains(t, client, "collection_defaults")
+
+	parsed, err := ParseLocalRuntimeConfig([]byte(rendered))
+	require.NoError(t, err)
+	require.Equal(t, cfg, parsed)
+}
+
+func TestLocalRuntimeConfig_YAMLRendersAllowResetExplicitly(t *testing.T) {
+	rendered, err := (&LocalRuntimeConfig{PersistPath: "./chroma"}).YAML()
+	require.NoError(t, err)
+	require.Contains(t, rendered, "allow_reset: false")
+	require.NotContains(t, rendered, "port:")
+}
+
+func TestLoadLocalRuntimeConfig_ReadsExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chroma.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`port: 8000
+listen_address: "127.0.0.1"
+persist_path: "./chroma_data"
+allow_reset: true
+open_telemetry:
+  endpoint: "http://localhost:4317"
+  service_name: "chroma"
+scorecard_enabled: false
+`), 0o600))
+
+	cfg, err := LoadLocalRuntimeConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, 8000, cfg.Port)
+	require.Equal(t, "./chroma_data", cfg.PersistPath)
+	require.True(t, cfg.AllowReset)
+	require.Equal(t, "chroma", cfg.OpenTelemetry.ServiceName)
+	require.Equal(t, map[string]any{"scorecard_enabled": false}, cfg.Extra)
+
+	_, err = LoadLocalRuntimeConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error reading local runtime config")
+}
+
+func TestParseLocalRuntimeConfig_RejectsInvalidYAML(t *testing.T) {
+	_, err := ParseLocalRuntimeConfig([]byte("port: [8000"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error parsing local runtime YAML")
+
+	_, err = ParseLocalRuntimeConfig([]byte("port: \"eighty\""))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error decoding local runtime YAML")
+
+	_, err = ParseLocalRuntimeConfig([]byte("port: 70000"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "port must be between 0 and 65535")
+}
+
+func TestLocalRuntimeConfig_Validate_TableDriven(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *LocalRuntimeConfig
+		wantErr string
+	}{
+		{name: "nil", cfg: nil, wantErr: "local runtime config cannot be nil"},
+		{name: "negative port", cfg: &LocalRuntimeConfig{Port: -1}, wantErr: "port must be between 0 and 65535"},
+		{name: "negative payload", cfg: &LocalRuntimeConfig{MaxPayloadSizeBytes: -1}, wantErr: "max_payload_size_bytes cannot be negative"},
+		{name: "sqlite path", cfg: &LocalRuntimeConfig{SQLiteFilename: "../chroma.sqlite3"}, wantErr: "sqlite_filename must be a file name"},
+		{name: "empty cors origin", cfg: &LocalRuntimeConfig{CORSAllowOrigins: []string{" "}}, wantErr: "cors_allow_origins[0] cannot be empty"},
+		{name: "knn index", cfg: &LocalRuntimeConfig{DefaultKnnIndex: "flat"}, wantErr: "unsupported default_knn_index"},
+		{name: "hash type", cfg: &LocalRuntimeConfig{SQLiteDB: &LocalSQLiteDBConfig{HashType: "crc32"}}, wantErr: "unsupported sqlitedb.hash_type"},
+		{name: "migration mode", cfg: &LocalRuntimeConfig{SQLiteDB: &LocalSQLiteDBConfig{MigrationMode: "skip"}}, wantErr: "unsupported sqlitedb.migration_mode"},
+		{name: "log level", cfg: &LocalRuntimeConfig{LogLevel: "verbose"}, wantErr: "unsupported log_level"},
+		{name: "wal without limits", cfg: &LocalRuntimeConfig{WAL: &LocalWALConfig{Vacuum: true}}, wantErr: "wal requires max_age_sec or max_bytes"},
+		{
+			name:    "compaction bounds",
+			cfg:     &LocalRuntimeConfig{Compactor: &LocalCompactorConfig{MinCompactionSize: 100, MaxCompactionSize: 10}},
+			wantErr: "compactor.min_compaction_size cannot exceed compactor.max_compaction_size",
+		},
+		{
+			name:    "hnsw and spann",
+			cfg:     &LocalRuntimeConfig{CollectionDefaults: &LocalCollectionDefaults{HNSW: &HnswIndexConfig{}, SPANN: &SpannIndexConfig{}}},
+			wantErr: "collection_defaults cannot set both hnsw and spann",
+		},
+		{
+			name:    "hnsw batch size",
+			cfg:     &LocalRuntimeConfig{CollectionDefaults: &LocalCollectionDefaults{HNSW: &HnswIndexConfig{BatchSize: 1}}},
+			wantErr: "invalid collection_defaults.hnsw",
+		},
+		{
+			name:    "spann nprobe",
+			cfg:     &LocalRuntimeConfig{CollectionDefaults: &LocalCollectionDefaults{SPANN: &SpannIndexConfig{SearchNprobe: 500}}},
+			wantErr: "invalid collection_defaults.spann",
+		},
+		{
+			name:    "otel endpoint",
+			cfg:     &LocalRuntimeConfig{OpenTelemetry: &LocalOpenTelemetryConfig{Endpoint: "collector:4317", ServiceName: "chroma"}},
+			wantErr: "must be an absolute URL",
+		},
+		{
+			name:    "otel service name",
+			cfg:     &LocalRuntimeConfig{OpenTelemetry: &LocalOpenTelemetryConfig{Endpoint: "http://collector:4317"}},
+			wantErr: "open_telemetry.service_name cannot be empty",
+		},
+		{
+			name: "otel filter level",
+			cfg: &LocalRuntimeConfig{OpenTelemetry: &LocalOpenTelemetryConfig{
+				Endpoint:    "http://collector:4317",
+				ServiceName: "chroma",
+				Filters:     []LocalOpenTelemetryFilter{{CrateName: "chroma_frontend", FilterLevel: "verbose"}},
+			}},
+			wantErr: "unsupported open_telemetry.filters.filter_level",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	require.NoError(t, (&LocalRuntimeConfig{CollectionDefaults: &LocalCollectionDefaults{HNSW: &HnswIndexConfig{EfSearch: 10}}}).Validate())
+}
+
+func TestWithPersistentRuntimeConfig(t *testing.T) {
+	cfg := defaultLocalClientConfig()
+	require.Error(t, WithPersistentRuntimeConfig(nil)(cfg))
+
+	err := WithPersistentRuntimeConfig(&LocalRuntimeConfig{Port: 70000})(cfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid local runtime config")
+
+	runtimeConfig := &LocalRuntimeConfig{
+		MaxBatchSize:       10,
+		SQLiteDB:           &LocalSQLiteDBConfig{MigrationMode: "apply"},
+		CollectionDefaults: &LocalCollectionDefaults{HNSW: &HnswIndexConfig{EfSearch: 10}},
+		OpenTelemetry: &LocalOpenTelemetryConfig{
+			Endpoint:    "http://collector:4317",
+			ServiceName: "chroma",
+			Filters:     []LocalOpenTelemetryFilter{{CrateName: "chroma_frontend", FilterLevel: "info"}},
+		},
+		Extra: map[string]any{"circuit_breaker": map[string]any{"requests": 100}},
+	}
+	require.NoError(t, WithPersistentRuntimeConfig(runtimeConfig)(cfg))
+	runtimeConfig.MaxBatchSize = 20
+	runtimeConfig.SQLiteDB.MigrationMode = "validate"
+	runtimeConfig.CollectionDefaults.HNSW.EfSearch = 20
+	runtimeConfig.OpenTelemetry.Filters[0].FilterLevel = "trace"
+	runtimeConfig.Extra["circuit_breaker"].(map[string]any)["requests"] = 1
+	require.Equal(t, uint32(10), cfg.maxBatchSize())
+	require.Equal(t, "apply", cfg.runtimeConfig.SQLiteDB.MigrationMode)
+	require.Equal(t, uint(10), cfg.runtimeConfig.CollectionDefaults.HNSW.EfSearch)
+	require.Equal(t, "info", cfg.runtimeConfig.OpenTelemetry.Filters[0].FilterLevel)
+	require.Equal(t, map[string]any{"requests": 100}, cfg.runtimeConfig.Extra["circuit_breaker"])
+	require.Equal(t, PersistentRuntimeModeEmbedded, cfg.runtimeMode)
+}
+
+func TestLocalRuntimeConfig_SetRuntimeEnv(t *testing.T) {
+	t.Setenv("RUST_LOG", "")
+	require.NoError(t, (&LocalRuntimeConfig{LogLevel: "debug"}).setRuntimeEnv())
+	require.Equal(t, "debug", os.Getenv("RUST_LOG"))
+
+	t.Setenv("RUST_LOG", "warn")
+	require.NoError(t, (&LocalRuntimeConfig{LogLevel: "debug"}).setRuntimeEnv())
+	require.Equal(t, "warn", os.Getenv("RUST_LOG"), "an explicit RUST_LOG is kept")
+}
+
+type walEmbeddedRuntime struct {
+	*memoryEmbeddedRuntime
+	prunes int
+}
+
+func (r *walEmbeddedRuntime) PruneAllWAL(options ...localchroma.WALPruneOption) (*localchroma.WALPruneResult, error) {
+	r.prunes++
+	return &localchroma.WALPruneResult{}, nil
+}
+
+func TestNewLocalClient_PrunesWALOnStart(t *testing.T) {
+	stubLocalServerRuntime(t, &stubLocalServer{})
+	origStart := localStartEmbeddedFunc
+	t.Cleanup(func() { localStartEmbeddedFunc = origStart })
+	runtime := &walEmbeddedRuntime{memoryEmbeddedRuntime: newMemoryEmbeddedRuntime()}
+	localStartEmbeddedFunc = func(localchroma.StartEmbeddedConfig) (localEmbeddedRuntime, error) {
+		return runtime, nil
+	}
+
+	client, err := NewPersistentClient(
+		WithPersistentPath(filepath.Join(t.TempDir(), "data")),
+		WithPersistentRuntimeConfig(&LocalRuntimeConfig{WAL: &LocalWALConfig{MaxAgeSec: 60}}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 1, runtime.prunes)
+	require.NoError(t, client.Close())
+
+	_, err = NewPersistentClient(
+		WithPersistentPath(filepath.Join(t.TempDir(), "data")),
+		WithPersistentRuntimeMode(PersistentRuntimeModeServer),
+		WithPersistentRuntimeConfig(&LocalRuntimeConfig{WAL: &LocalWALConfig{MaxAgeSec: 60}}),
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only supported in embedded mode")
+}
+
+func TestNewLocalClient_ServerModeAppliesMaxBatchSize(t *testing.T) {
+	preflight := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/pre-flight-checks", r.URL.Path)
+		_, _ = w.Write([]byte(`{"max_batch_size": 100}`))
+	}))
+	t.Cleanup(preflight.Close)
+	server := &stubLocalServer{url: preflight.URL}
+	stubLocalServerRuntime(t, server)
+	origStart := localStartServerFunc
+	t.Cleanup(func() { localStartServerFunc = origStart })
+	localStartServerFunc = func(localchroma.StartServerConfig) (localServer, error) { return server, nil }
+
+	client, err := NewPersistentClient(
+		WithPersistentPath(filepath.Join(t.TempDir(), "data")),
+		WithPersistentRuntimeMode(PersistentRuntimeModeServer),
+		WithPersistentRuntimeConfig(&LocalRuntimeConfig{MaxBatchSize: 10}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	require.NoError(t, client.PreFlight(context.Background()))
+	apiClient, ok := client.(*PersistentClient).localClient().(*APIClientV2)
+	require.True(t, ok)
+	require.Equal(t, 10, apiClient.preflightMaxBatchSize())
+}
+
+func TestNewLocalClient_RejectsRuntimeConfigWithYAMLSources(t *testing.T) {
+	lockLocalTestHooks(t)
+
+	_, err := NewPersistentClient(
+		WithPersistentRawYAML("port: 8801"),
+		WithPersistentRuntimeConfig(&LocalRuntimeConfig{}),
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "WithPersistentRuntimeConfig is mutually exclusive")
+}
+
+func TestNewLocalClient_UsesRuntimeConfigStartPath(t *testing.T) {
+	lockLocalTestHooks(t)
+
+	origInit := localInitFunc
+	origNew := localNewServerFunc
+	origStart := localStartServerFunc
+	origWait := localWaitReadyFunc
+	origResolve := localResolveLibraryPathFunc
+	t.Cleanup(func() {
+		localInitFunc = origInit
+		localNewServerFunc = origNew
+		localStartServerFunc = origStart
+		localWaitReadyFunc = origWait
+		localResolveLibraryPathFunc = origResolve
+	})
+	localWaitReadyFunc = func(client *APIClientV2) error { return nil }
+	localResolveLibraryPathFunc = func(cfg *localClientConfig) (string, error) {
+		return cfg.libraryPath, nil
+	}
+	localInitFunc = func(path string) error { return nil }
+	localNewServerFunc = func(_ ...localchroma.ServerOption) (localServer, error) {
+		t.Fatal("did not expect NewServer builder path")
+		return nil, nil
+	}
+
+	server := &stubLocalServer{url: "http://127.0.0.1:43210"}
+	var capturedStartConfig localchroma.StartServerConfig
+	localStartServerFunc = func(config localchroma.StartServerConfig) (localServer, error) {
+		capturedStartConfig = config
+		return server, nil
+	}
+
+	client, err := NewPersistentClient(
+		WithPersistentRuntimeMode(PersistentRuntimeModeServer),
+		WithPersistentPath("/tmp/chroma-typed"),
+		WithPersistentPort(0),
+		WithPersistentRuntimeConfig(&LocalRuntimeConfig{
+			CORSAllowOrigins:   []string{"*"},
+			DefaultKnnIndex:    LocalKnnIndexHNSW,
+			CollectionDefaults: &LocalCollectionDefaults{HNSW: &HnswIndexConfig{EfSearch: 50}},
+			MaxBatchSize:       100,
+		}),
+	)
+	require.NoError(t, err)
+
+	var doc map[string]any
+	require.NoError(t, yaml.Unmarshal([]byte(capturedStartConfig.ConfigString), &doc))
+	require.Equal(t, "/tmp/chroma-typed", doc["persist_path"])
+	require.Equal(t, 0, doc["port"])
+	require.Equal(t, "127.0.0.1", doc["listen_address"])
+	require.Equal(t, []any{"*"}, doc["cors_allow_origins"])
+	require.Equal(t, "hnsw", doc["default_knn_index"])
+	require.NotContains(t, doc, "client", "client settings are not passed to the runtime")
+	require.NotContains(t, doc, "collection_defaults")
+	require.NotContains(t, doc, "max_batch_size")
+	require.NoError(t, client.Close())
+}
+
+func TestWithLocalCollectionDefaultsCreate(t *testing.T) {
+	defaults := &LocalCollectionDefaults{HNSW: &HnswIndexConfig{EfSearch: 42}}
+
+	t.Run("applies defaults without index settings", func(t *testing.T) {
+		op := &CreateCollectionOp{}
+		require.NoError(t, withLocalCollectionDefaultsCreate(defaults)(op))
+		hnsw, ok := op.Configuration.GetRaw("hnsw")
+		require.True(t, ok)
+		require.Equal(t, map[string]any{"ef_search": json.Number("42")}, hnsw)
+	})
+
+	t.Run("keeps explicit configuration", func(t *testing.T) {
+		config := NewCollectionConfiguration()
+		config.SetRaw("spann", map[string]any{"search_nprobe": 8})
+		op := &CreateCollectionOp{Configuration: config}
+		require.NoError(t, withLocalCollectionDefaultsCreate(defaults)(op))
+		_, ok := op.Configuration.GetRaw("hnsw")
+		require.False(t, ok)
+	})
+
+	t.Run("keeps hnsw metadata", func(t *testing.T) {
+		op := &CreateCollectionOp{}
+		require.NoError(t, WithHNSWSearchEfCreate(7)(op))
+		require.NoError(t, withLocalCollectionDefaultsCreate(defaults)(op))
+		require.Nil(t, op.Configuration)
+	})
+}
@@ -0,0 +1,693 @@
+package v2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	semver "github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+
+	localchroma "github.com/amikos-tech/chroma-go-local"
+	"github.com/amikos-tech/chroma-go/pkg/logger"
+)
+
+const (
+	// localSnapshotSchemaVersion, localSnapshotManifestFile and localSnapshotDataDir mirror the backup layout of chroma-go-local.
+	localSnapshotSchemaVersion = "v1"
+	localSnapshotManifestFile  = "backup_manifest.json"
+	localSnapshotDataDir       = "persist"
+	// localSnapshotFormatVersion is the version of the snapshots written by [PersistentClient.Snapshot], recorded in
+	// the manifest next to the fields of chroma-go-local. Restores reject other versions.
+	localSnapshotFormatVersion = 1
+)
+
+// localSnapshotManifest is the backup manifest of chroma-go-local with the snapshot format version.
+type localSnapshotManifest struct {
+	localchroma.BackupManifest
+	FormatVersion int `json:"snapshot_format_version"`
+}
+
+// LocalSnapshot describes a snapshot of a persistent local store written by [PersistentClient.Snapshot].
+//
+// A snapshot is a directory holding a copy of the persist directory under persist/ and a
+// backup_manifest.json with the version of the runtime that wrote it and the checksum of every file.
+type LocalSnapshot struct {
+	// Path is the snapshot directory.
+	Path string
+	// FormatVersion is the version of the snapshot format of this package.
+	FormatVersion int
+	// SchemaVersion is the version of the snapshot layout.
+	SchemaVersion string
+	// RuntimeVersion is the version of the local runtime library that wrote the snapshot.
+	RuntimeVersion string
+	CreatedAt      time.Time
+	FileCount      int
+	TotalBytes     int64
+	Files          []LocalSnapshotFile
+}
+
+// LocalSnapshotFile is a file of a [LocalSnapshot], relative to the persist directory.
+type LocalSnapshotFile struct {
+	Path      string
+	SizeBytes int64
+	SHA256    string
+}
+
+// LocalRuntimeReopenError is returned by [PersistentClient.Snapshot] when the snapshot was written but the
+// runtime could not be reopened afterwards. Calls through the client fail until it is closed and opened again.
+type LocalRuntimeReopenError struct {
+	// Snapshot is the snapshot that was written.
+	Snapshot *LocalSnapshot
+	Err      error
+}
+
+func (e *LocalRuntimeReopenError) Error() string {
+	return fmt.Sprintf("snapshot written to %q, but the local runtime could not be reopened: %v", e.Snapshot.Path, e.Err)
+}
+
+func (e *LocalRuntimeReopenError) Unwrap() error {
+	return e.Err
+}
+
+// localSnapshotRuntime is implemented by runtimes that can flush their write-ahead log and copy their persist directory.
+type localSnapshotRuntime interface {
+	CompactAll(request localchroma.CompactAllRequest) (*localchroma.CompactionResult, error)
+	Backup(options ...localchroma.BackupOption) (*localchroma.BackupManifest, error)
+}
+
+// Snapshot writes a consistent copy of the local store to dest, which must not exist or be an empty directory.
+//
+// Calls through the client wait while the runtime flushes its write-ahead log, closes and copies its
+// persist directory, and resume once the runtime is reopened. The snapshot is staged next to dest and
+// renamed into place, so dest never holds a partial snapshot. Use [RestorePersistentClient] to open a
+// client on a restored copy.
+//
+// Snapshots are only supported in embedded mode. When the runtime cannot be reopened after the copy,
+// the snapshot is still moved into place and a [*LocalRuntimeReopenError] is returned.
+func (client *PersistentClient) Snapshot(ctx context.Context, dest string) (*LocalSnapshot, error) {
+	if client == nil || client.Client == nil {
+		return nil, errors.New("persistent client is not initialized")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	embeddedClient, ok := client.localClient().(*embeddedLocalClient)
+	if !ok {
+		return nil, errors.Errorf("snapshots are not supported in %s runtime mode: other clients can write to the local server while it is copied", client.mode)
+	}
+	destPath, err := prepareLocalSnapshotDestination(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	stagingPath := filepath.Join(filepath.Dir(destPath), fmt.Sprintf(".%s.snapshot-%d", filepath.Base(destPath), time.Now().UnixNano()))
+	if err := os.Mkdir(stagingPath, 0o755); err != nil {
+		return nil, errors.Wrap(err, "error creating snapshot staging directory")
+	}
+	manifest, reopenErr, err := embeddedClient.snapshot(ctx, stagingPath)
+	if err != nil {
+		_ = os.RemoveAll(stagingPath)
+		return nil, err
+	}
+
+	manifest.DestinationPath = destPath
+	manifest.SnapshotPath = filepath.Join(destPath, localSnapshotDataDir)
+	manifest.ManifestPath = filepath.Join(destPath, localSnapshotManifestFile)
+	if err := writeLocalSnapshotManifest(stagingPath, manifest); err != nil {
+		_ = os.RemoveAll(stagingPath)
+		return nil, err
+	}
+	if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+		_ = os.RemoveAll(stagingPath)
+		return nil, errors.Wrap(err, "error replacing empty snapshot destination")
+	}
+	if err := os.Rename(stagingPath, destPath); err != nil {
+		_ = os.RemoveAll(stagingPath)
+		return nil, errors.Wrap(err, "error moving snapshot into place")
+	}
+	snapshot := localSnapshotFromManifest(destPath, &localSnapshotManifest{BackupManifest: *manifest, FormatVersion: localSnapshotFormatVersion})
+	if reopenErr != nil {
+		return nil, &LocalRuntimeReopenError{Snapshot: snapshot, Err: reopenErr}
+	}
+	return snapshot, nil
+}
+
+// snapshot copies the local store to stagingPath. reopenErr is set when the copy was written but the runtime
+// could not be reopened, neither by Backup nor explicitly.
+func (client *embeddedLocalClient) snapshot(ctx context.Context, stagingPath string) (manifest *localchroma.BackupManifest, reopenErr error, err error) {
+	runtime, ok := client.embedded.(*quiescedEmbeddedRuntime)
+	if !ok {
+		return nil, nil, errors.New("embedded runtime does not support snapshots")
+	}
+	err = runtime.quiesce(func(embedded localEmbeddedRuntime) error {
+		// Re-check after waiting for in-flight calls to drain.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		snapshotter, ok := embedded.(localSnapshotRuntime)
+		if !ok {
+			return errors.New("embedded runtime does not support snapshots")
+		}
+		compaction, err := snapshotter.CompactAll(localchroma.CompactAllRequest{})
+		if err != nil {
+			return errors.Wrap(err, "error flushing write-ahead log before snapshot")
+		}
+		// Records still in the write-ahead log live in the SQLite database and are copied with it.
+		for _, collection := range compaction.Collections {
+			if collection.Error != "" && client.logger != nil {
+				client.logger.Warn("failed to flush collection write-ahead log before snapshot",
+					logger.String("collection", collection.Name),
+					logger.String("error", collection.Error))
+			}
+		}
+		manifest, err = snapshotter.Backup(localchroma.WithDestination(stagingPath), localchroma.WithIncludeMetadata())
+		if err != nil && manifest == nil {
+			return errors.Wrap(err, "error copying local store")
+		}
+		if err != nil {
+			// The copy is complete but Backup could not reopen the runtime.
+			if client.logger != nil {
+				client.logger.Warn("failed to reopen local runtime after snapshot, reopening explicitly",
+					logger.String("error", err.Error()))
+			}
+			reopenErr = runtime.reopenLocked()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, reopenErr, nil
+}
+
+// RestorePersistentClient replaces the persist directory of a persistent client with the snapshot at
+// snapshotPath and opens the client on it.
+//
+// The options are the same as for [NewPersistentClient]. The snapshot is checked against the loaded runtime
+// library before anything is replaced: snapshots written by a newer runtime, or by a runtime with a different
+// major version (minor version before 1.0), are rejected. Files are verified against the manifest checksums
+// while they are copied. The previous persist directory is kept until the client opens and is put back if it
+// fails to open. The restore fails with [*PersistPathLockedError] while another client holds the persist path.
+func RestorePersistentClient(ctx context.Context, snapshotPath string, opts ...PersistentClientOption) (Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cfg, err := newLocalClientConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := ReadLocalSnapshot(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	persistPath, err := cfg.resolvedPersistPath()
+	if err != nil {
+		return nil, err
+	}
+	// The lock is held from here on and handed over to the restored client.
+	lock, err := acquireLocalPersistLock(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := initLocalRuntimeLibrary(cfg); err != nil {
+		_ = lock.release()
+		return nil, err
+	}
+	runtimeVersion, err := localVersionWithErrorFunc()
+	if err != nil {
+		_ = lock.release()
+		return nil, errors.Wrap(err, "error reading local runtime version")
+	}
+	if err := checkLocalSnapshotCompatibility(snapshot.RuntimeVersion, runtimeVersion); err != nil {
+		_ = lock.release()
+		return nil, err
+	}
+
+	rollback, commit, err := restoreLocalSnapshot(ctx, snapshot, persistPath)
+	if err != nil {
+		_ = lock.release()
+		return nil, err
+	}
+	client, err := openPersistentClient(cfg, lock)
+	if err != nil {
+		if rollbackErr := rollback(); rollbackErr != nil {
+			return nil, errors.Wrapf(err, "error restoring previous persist directory: %v", rollbackErr)
+		}
+		return nil, err
+	}
+	commit()
+	return client, nil
+}
+
+// ReadLocalSnapshot reads the manifest of the snapshot at path.
+func ReadLocalSnapshot(path string) (*LocalSnapshot, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, errors.New("snapshot path cannot be empty")
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving snapshot path")
+	}
+	data, err := os.ReadFile(filepath.Join(absPath, localSnapshotManifestFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading snapshot manifest")
+	}
+	var manifest localSnapshotManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrap(err, "error parsing snapshot manifest")
+	}
+	switch {
+	case manifest.FormatVersion == 0:
+		return nil, errors.New("snapshot manifest has no snapshot_format_version; it was not written by PersistentClient.Snapshot")
+	case manifest.FormatVersion != localSnapshotFormatVersion:
+		return nil, errors.Errorf("unsupported snapshot format version %d, expected %d", manifest.FormatVersion, localSnapshotFormatVersion)
+	case manifest.SchemaVersion != localSnapshotSchemaVersion:
+		return nil, errors.Errorf("unsupported snapshot schema version %q", manifest.SchemaVersion)
+	}
+	return localSnapshotFromManifest(absPath, &manifest), nil
+}
+
+func localSnapshotFromManifest(path string, manifest *localSnapshotManifest) *LocalSnapshot {
+	snapshot := &LocalSnapshot{
+		Path:           path,
+		FormatVersion:  manifest.FormatVersion,
+		SchemaVersion:  manifest.SchemaVersion,
+		RuntimeVersion: manifest.WrapperVersion,
+		CreatedAt:      manifest.CreatedAt,
+		FileCount:      manifest.FileCount,
+		TotalBytes:     manifest.TotalBytes,
+	}
+	for _, file := range manifest.Files {
+		snapshot.Files = append(snapshot.Files, LocalSnapshotFile{
+			Path:      file.Path,
+			SizeBytes: file.SizeBytes,
+			SHA256:    file.SHA256,
+		})
+	}
+	return snapshot
+}
+
+func writeLocalSnapshotManifest(dir string, manifest *localchroma.BackupManifest) error {
+	data, err := json.MarshalIndent(localSnapshotManifest{BackupManifest: *manifest, FormatVersion: localSnapshotFormatVersion}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding snapshot manifest")
+	}
+	if err := os.WriteFile(filepath.Join(dir, localSnapshotManifestFile), append(data, '\n'), 0o644); err != nil {
+		return errors.Wrap(err, "error writing snapshot manifest")
+	}
+	return nil
+}
+
+func prepareLocalSnapshotDestination(dest string) (string, error) {
+	dest = strings.TrimSpace(dest)
+	if dest == "" {
+		return "", errors.New("snapshot destination cannot be empty")
+	}
+	destPath, err := filepath.Abs(dest)
+	if err != nil {
+		return "", errors.Wrap(err, "error resolving snapshot destination")
+	}
+	info, err := os.Stat(destPath)
+	switch {
+	case os.IsNotExist(err):
+		return destPath, nil
+	case err != nil:
+		return "", errors.Wrap(err, "error inspecting snapshot destination")
+	case !info.IsDir():
+		return "", errors.Errorf("snapshot destination %q must be a directory", destPath)
+	}
+	entries, err := os.ReadDir(destPath)
+	if err != nil {
+		return "", errors.Wrap(err, "error inspecting snapshot destination")
+	}
+	if len(entries) > 0 {
+		return "", errors.Errorf("snapshot destination %q must be empty", destPath)
+	}
+	return destPath, nil
+}
+
+// checkLocalSnapshotCompatibility rejects snapshots the loaded runtime may not be able to open:
+// snapshots from a newer runtime, which may use a newer storage format, and snapshots from
+// a runtime with a different major version, or a different minor version before 1.0.
+func checkLocalSnapshotCompatibility(snapshotVersion, runtimeVersion string) error {
+	written, err := semver.NewVersion(strings.TrimSpace(snapshotVersion))
+	if err != nil {
+		return errors.Errorf("snapshot runtime version %q is not a valid semantic version", snapshotVersion)
+	}
+	loaded, err := semver.NewVersion(strings.TrimSpace(runtimeVersion))
+	if err != nil {
+		return errors.Errorf("local runtime version %q is not a valid semantic version", runtimeVersion)
+	}
+	if written.GreaterThan(loaded) {
+		return errors.Errorf("snapshot was written by local runtime %s, which is newer than the loaded runtime %s", written, loaded)
+	}
+	if written.Major() != loaded.Major() || (loaded.Major() == 0 && written.Minor() != loaded.Minor()) {
+		return errors.Errorf("snapshot written by local runtime %s is not compatible with the loaded runtime %s", written, loaded)
+	}
+	return nil
+}
+
+// restoreLocalSnapshot copies the snapshot next to persistPath, verifying every file against the manifest,
+// and swaps it into place. rollback puts the previous persist directory back; commit removes it.
+func restoreLocalSnapshot(ctx context.Context, snapshot *LocalSnapshot, persistPath string) (rollback func() error, commit func(), err error) {
+	suffix := time.Now().UnixNano()
+	stagingPath := fmt.Sprintf("%s.restore-%d", persistPath, suffix)
+	if err := os.MkdirAll(filepath.Dir(persistPath), 0o755); err != nil {
+		return nil, nil, errors.Wrap(err, "error creating persist path parent directory")
+	}
+	if err := copyLocalSnapshotData(ctx, snapshot, stagingPath); err != nil {
+		_ = os.RemoveAll(stagingPath)
+		return nil, nil, err
+	}
+
+	previousPath := ""
+	if _, err := os.Stat(persistPath); err == nil {
+		previousPath = fmt.Sprintf("%s.pre-restore-%d", persistPath, suffix)
+		if err := os.Rename(persistPath, previousPath); err != nil {
+			_ = os.RemoveAll(stagingPath)
+			return nil, nil, errors.Wrap(err, "error moving previous persist directory aside")
+		}
+	} else if !os.IsNotExist(err) {
+		_ = os.RemoveAll(stagingPath)
+		return nil, nil, errors.Wrap(err, "error inspecting persist path")
+	}
+	if err := os.Rename(stagingPath, persistPath); err != nil {
+		_ = os.RemoveAll(stagingPath)
+		if previousPath != "" {
+			_ = os.Rename(previousPath, persistPath)
+		}
+		return nil, nil, errors.Wrap(err, "error moving restored persist directory into place")
+	}
+
+	rollback = func() error {
+		if err := os.RemoveAll(persistPath); err != nil {
+			return err
+		}
+		if previousPath == "" {
+			return nil
+		}
+		return os.Rename(previousPath, persistPath)
+	}
+	commit = func() {
+		if previousPath != "" {
+			_ = os.RemoveAll(previousPath)
+		}
+	}
+	return rollback, commit, nil
+}
+
+func copyLocalSnapshotData(ctx context.Context, snapshot *LocalSnapshot, dest string) error {
+	if len(snapshot.Files) == 0 {
+		return errors.New("invalid snapshot: the manifest does not list any files")
+	}
+	if len(snapshot.Files) != snapshot.FileCount {
+		return errors.Errorf("invalid snapshot: the manifest lists %d files but counts %d", len(snapshot.Files), snapshot.FileCount)
+	}
+	expected := make(map[string]LocalSnapshotFile, len(snapshot.Files))
+	for _, file := range snapshot.Files {
+		expected[file.Path] = file
+	}
+	source := filepath.Join(snapshot.Path, localSnapshotDataDir)
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return errors.Wrap(err, "error creating restore directory")
+	}
+
+	copied := 0
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		target := filepath.Join(dest, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !entry.Type().IsRegular() {
+			return errors.Errorf("snapshot contains unsupported file %q", filepath.ToSlash(rel))
+		}
+		checksum, err := copyLocalSnapshotFile(path, target)
+		if err != nil {
+			return err
+		}
+		file, ok := expected[filepath.ToSlash(rel)]
+		if !ok {
+			return errors.Errorf("snapshot file %q is not listed in the manifest", filepath.ToSlash(rel))
+		}
+		if file.SHA256 != checksum {
+			return errors.Errorf("snapshot file %q does not match its manifest checksum", filepath.ToSlash(rel))
+		}
+		copied++
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error copying snapshot")
+	}
+	if copied != snapshot.FileCount {
+		return errors.Errorf("snapshot has %d files, manifest lists %d", copied, snapshot.FileCount)
+	}
+	return nil
+}
+
+func copyLocalSnapshotFile(source, target string) (checksum string, err error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := out.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), in); err != nil {
+		return "", err
+	}
+	if err := out.Sync(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// quiescedEmbeddedRuntime serializes runtime calls against [quiescedEmbeddedRuntime.quiesce], so that a
+// snapshot can close and reopen the runtime without calls through the client observing it closed.
+type quiescedEmbeddedRuntime struct {
+	mu      sync.RWMutex
+	runtime localEmbeddedRuntime
+	// reopen starts a new runtime on the same persist path, nil when the runtime cannot be reopened.
+	reopen func() (localEmbeddedRuntime, error)
+}
+
+func newQuiescedEmbeddedRuntime(runtime localEmbeddedRuntime) *quiescedEmbeddedRuntime {
+	if quiesced, ok := runtime.(*quiescedEmbeddedRuntime); ok {
+		return quiesced
+	}
+	return &quiescedEmbeddedRuntime{runtime: runtime}
+}
+
+// reopenLocked replaces a runtime that failed to reopen after a backup. The caller holds mu.
+func (r *quiescedEmbeddedRuntime) reopenLocked() error {
+	if r.reopen == nil {
+		return errors.New("embedded runtime cannot be reopened")
+	}
+	_ = r.runtime.Close()
+	reopened, err := r.reopen()
+	if err != nil {
+		return errors.Wrap(err, "error reopening local runtime")
+	}
+	r.runtime = reopened
+	return nil
+}
+
+// quiesce runs fn once in-flight calls have returned, holding back new calls until it returns.
+func (r *quiescedEmbeddedRuntime) quiesce(fn func(runtime localEmbeddedRuntime) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fn(r.runtime)
+}
+
+func (r *quiescedEmbeddedRuntime) Heartbeat() (uint64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.Heartbeat()
+}
+
+func (r *quiescedEmbeddedRuntime) Healthcheck() (*localchroma.EmbeddedHealthCheckResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.Healthcheck()
+}
+
+func (r *quiescedEmbeddedRuntime) MaxBatchSize() (uint32, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.MaxBatchSize()
+}
+
+func (r *quiescedEmbeddedRuntime) CreateTenant(request localchroma.EmbeddedCreateTenantRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.CreateTenant(request)
+}
+
+func (r *quiescedEmbeddedRuntime) GetTenant(request localchroma.EmbeddedGetTenantRequest) (*localchroma.EmbeddedTenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.GetTenant(request)
+}
+
+func (r *quiescedEmbeddedRuntime) UpdateTenant(request localchroma.EmbeddedUpdateTenantRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.UpdateTenant(request)
+}
+
+func (r *quiescedEmbeddedRuntime) CreateDatabase(request localchroma.EmbeddedCreateDatabaseRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.CreateDatabase(request)
+}
+
+func (r *quiescedEmbeddedRuntime) ListDatabases(request localchroma.EmbeddedListDatabasesRequest) ([]localchroma.EmbeddedDatabase, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.ListDatabases(request)
+}
+
+func (r *quiescedEmbeddedRuntime) GetDatabase(request localchroma.EmbeddedGetDatabaseRequest) (*localchroma.EmbeddedDatabase, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.GetDatabase(request)
+}
+
+func (r *quiescedEmbeddedRuntime) DeleteDatabase(request localchroma.EmbeddedDeleteDatabaseRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.DeleteDatabase(request)
+}
+
+func (r *quiescedEmbeddedRuntime) CreateCollection(request localchroma.EmbeddedCreateCollectionRequest) (*localchroma.EmbeddedCollection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.CreateCollection(request)
+}
+
+func (r *quiescedEmbeddedRuntime) GetCollection(request localchroma.EmbeddedGetCollectionRequest) (*localchroma.EmbeddedCollection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.GetCollection(request)
+}
+
+func (r *quiescedEmbeddedRuntime) DeleteCollection(request localchroma.EmbeddedDeleteCollectionRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.DeleteCollection(request)
+}
+
+func (r *quiescedEmbeddedRuntime) ListCollections(request localchroma.EmbeddedListCollectionsRequest) ([]localchroma.EmbeddedCollection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.ListCollections(request)
+}
+
+func (r *quiescedEmbeddedRuntime) CountCollections(request localchroma.EmbeddedCountCollectionsRequest) (uint32, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.CountCollections(request)
+}
+
+func (r *quiescedEmbeddedRuntime) UpdateCollection(request localchroma.EmbeddedUpdateCollectionRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.UpdateCollection(request)
+}
+
+func (r *quiescedEmbeddedRuntime) ForkCollection(request localchroma.EmbeddedForkCollectionRequest) (*localchroma.EmbeddedCollection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.ForkCollection(request)
+}
+
+func (r *quiescedEmbeddedRuntime) Add(request localchroma.EmbeddedAddRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.Add(request)
+}
+
+func (r *quiescedEmbeddedRuntime) UpsertRecords(request localchroma.EmbeddedUpsertRecordsRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.UpsertRecords(request)
+}
+
+func (r *quiescedEmbeddedRuntime) UpdateRecords(request localchroma.EmbeddedUpdateRecordsRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.UpdateRecords(request)
+}
+
+func (r *quiescedEmbeddedRuntime) DeleteRecords(request localchroma.EmbeddedDeleteRecordsRequest) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.DeleteRecords(request)
+}
+
+func (r *quiescedEmbeddedRuntime) GetRecords(request localchroma.EmbeddedGetRecordsRequest) (*localchroma.EmbeddedGetRecordsResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.GetRecords(request)
+}
+
+func (r *quiescedEmbeddedRuntime) CountRecords(request localchroma.EmbeddedCountRecordsRequest) (uint32, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.CountRecords(request)
+}
+
+func (r *quiescedEmbeddedRuntime) Query(request localchroma.EmbeddedQueryRequest) (*localchroma.EmbeddedQueryResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.Query(request)
+}
+
+func (r *quiescedEmbeddedRuntime) IndexingStatus(request localchroma.EmbeddedIndexingStatusRequest) (*localchroma.EmbeddedIndexingStatusResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.IndexingStatus(request)
+}
+
+func (r *quiescedEmbeddedRuntime) Reset() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runtime.Reset()
+}
+
+func (r *quiescedEmbeddedRuntime) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runtime.Close()
+}
@@ -0,0 +1,455 @@
+//go:build basicv2 && !cloud
+// +build basicv2,!cloud
+
+package v2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	localchroma "github.com/amikos-tech/chroma-go-local"
+)
+
+type snapshotEmbeddedRuntime struct {
+	*stubEmbeddedRuntime
+
+	// parent is the directory Snapshot stages into; Backup writes files to the staging directory found there.
+	parent       string
+	files        map[string]string
+	version      string
+	compactCalls int
+	backupErr    error
+	// reopenErr is returned by Backup with the manifest, as when the copy succeeds but the runtime does not reopen.
+	reopenErr error
+	// backupStarted and releaseBackup, when set, hold Backup until the test releases it.
+	backupStarted chan struct{}
+	releaseBackup chan struct{}
+}
+
+func (r *snapshotEmbeddedRuntime) CompactAll(localchroma.CompactAllRequest) (*localchroma.CompactionResult, error) {
+	r.compactCalls++
+	return &localchroma.CompactionResult{}, nil
+}
+
+func (r *snapshotEmbeddedRuntime) Backup(...localchroma.BackupOption) (*localchroma.BackupManifest, error) {
+	if r.backupStarted != nil {
+		close(r.backupStarted)
+		<-r.releaseBackup
+	}
+	if r.backupErr != nil {
+		return nil, r.backupErr
+	}
+	matches, err := filepath.Glob(filepath.Join(r.parent, ".*.snapshot-*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) != 1 {
+		return nil, errors.Errorf("expected one staging directory, found %d", len(matches))
+	}
+	manifest, err := writeLocalSnapshotFiles(matches[0], r.version, r.files)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, r.reopenErr
+}
+
+func writeLocalSnapshotFiles(dir, version string, files map[string]string) (*localchroma.BackupManifest, error) {
+	manifest := &localchroma.BackupManifest{
+		SchemaVersion:   localSnapshotSchemaVersion,
+		Mode:            localchroma.BackupModeEmbedded,
+		CreatedAt:       time.Now().UTC(),
+		WrapperVersion:  version,
+		DestinationPath: dir,
+		SnapshotPath:    filepath.Join(dir, localSnapshotDataDir),
+		ManifestPath:    filepath.Join(dir, localSnapshotManifestFile),
+		IncludeMetadata: true,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, localSnapshotDataDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(content))
+		manifest.Files = append(manifest.Files, localchroma.BackupFileMetadata{
+			Path:      name,
+			SizeBytes: int64(len(content)),
+			SHA256:    hex.EncodeToString(sum[:]),
+		})
+		manifest.FileCount++
+		manifest.TotalBytes += int64(len(content))
+	}
+	if err := writeLocalSnapshotManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeTestLocalSnapshot(t *testing.T, dir, version string, files map[string]string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	_, err := writeLocalSnapshotFiles(dir, version, files)
+	require.NoError(t, err)
+}
+
+func TestCheckLocalSnapshotCompatibility(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+		runtime  string
+		wantErr  string
+	}{
+		{name: "same version", snapshot: "0.3.5", runtime: "0.3.5"},
+		{name: "older patch", snapshot: "0.3.1", runtime: "0.3.5"},
+		{name: "v prefix", snapshot: "v1.2.0", runtime: "1.4.0"},
+		{name: "newer snapshot", snapshot: "0.3.6", runtime: "0.3.5", wantErr: "newer than the loaded runtime"},
+		{name: "different minor before 1.0", snapshot: "0.2.9", runtime: "0.3.5", wantErr: "not compatible"},
+		{name: "different major", snapshot: "1.9.0", runtime: "2.0.0", wantErr: "not compatible"},
+		{name: "unknown snapshot version", snapshot: "unknown", runtime: "0.3.5", wantErr: "snapshot runtime version"},
+		{name: "invalid runtime version", snapshot: "0.3.5", runtime: "", wantErr: "local runtime version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLocalSnapshotCompatibility(tt.snapshot, tt.runtime)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestReadLocalSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	writeTestLocalSnapshot(t, dir, "0.3.5", map[string]string{"chroma.sqlite3": "sqlite"})
+
+	snapshot, err := ReadLocalSnapshot(dir)
+	require.NoError(t, err)
+	require.Equal(t, dir, snapshot.Path)
+	require.Equal(t, "0.3.5", snapshot.RuntimeVersion)
+	require.Equal(t, 1, snapshot.FileCount)
+	require.Len(t, snapshot.Files, 1)
+	require.Equal(t, "chroma.sqlite3", snapshot.Files[0].Path)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, localSnapshotManifestFile), []byte(`{"snapshot_format_version":1,"schema_version":"v9"}`), 0o644))
+	_, err = ReadLocalSnapshot(dir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported snapshot schema version")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, localSnapshotManifestFile), []byte(`{"snapshot_format_version":2,"schema_version":"v1"}`), 0o644))
+	_, err = ReadLocalSnapshot(dir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported snapshot format version 2")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, localSnapshotManifestFile), []byte(`{"schema_version":"v1"}`), 0o644))
+	_, err = ReadLocalSnapshot(dir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no snapshot_format_version")
+
+	_, err = ReadLocalSnapshot(t.TempDir())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error reading snapshot manifest")
+}
+
+func newSnapshotTestClient(t *testing.T, runtime *snapshotEmbeddedRuntime) *PersistentClient {
+	t.Helper()
+	return &PersistentClient{
+		Client: newEmbeddedClientForRuntime(t, newQuiescedEmbeddedRuntime(runtime)),
+		mode:   PersistentRuntimeModeEmbedded,
+	}
+}
+
+func TestPersistentClientSnapshot_WritesSnapshotAtDestination(t *testing.T) {
+	parent := t.TempDir()
+	runtime := &snapshotEmbeddedRuntime{
+		stubEmbeddedRuntime: &stubEmbeddedRuntime{},
+		parent:              parent,
+		version:             "0.3.5",
+		files:               map[string]string{"chroma.sqlite3": "sqlite", "segments/hnsw/data.bin": "vectors"},
+	}
+	client := newSnapshotTestClient(t, runtime)
+	dest := filepath.Join(parent, "snapshot")
+
+	snapshot, err := client.Snapshot(context.Background(), dest)
+	require.NoError(t, err)
+	require.Equal(t, 1, runtime.compactCalls)
+	require.Equal(t, dest, snapshot.Path)
+	require.Equal(t, "0.3.5", snapshot.RuntimeVersion)
+	require.Equal(t, 2, snapshot.FileCount)
+	require.Equal(t, localSnapshotFormatVersion, snapshot.FormatVersion)
+
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "staging directory must be renamed into place")
+
+	data, err := os.ReadFile(filepath.Join(dest, localSnapshotManifestFile))
+	require.NoError(t, err)
+	var manifest localchroma.BackupManifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, dest, manifest.DestinationPath)
+	require.Equal(t, filepath.Join(dest, localSnapshotDataDir), manifest.SnapshotPath)
+
+	content, err := os.ReadFile(filepath.Join(dest, localSnapshotDataDir, "segments", "hnsw", "data.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "vectors", string(content))
+}
+
+func TestPersistentClientSnapshot_Errors(t *testing.T) {
+	t.Run("non-empty destination", func(t *testing.T) {
+		parent := t.TempDir()
+		runtime := &snapshotEmbeddedRuntime{stubEmbeddedRuntime: &stubEmbeddedRuntime{}, parent: parent, version: "0.3.5"}
+		client := newSnapshotTestClient(t, runtime)
+		dest := filepath.Join(parent, "snapshot")
+		require.NoError(t, os.MkdirAll(dest, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dest, "existing"), []byte("x"), 0o644))
+
+		_, err := client.Snapshot(context.Background(), dest)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "must be empty")
+		require.Equal(t, 0, runtime.compactCalls)
+	})
+
+	t.Run("backup failure removes staging", func(t *testing.T) {
+		parent := t.TempDir()
+		runtime := &snapshotEmbeddedRuntime{
+			stubEmbeddedRuntime: &stubEmbeddedRuntime{},
+			parent:              parent,
+			backupErr:           errors.New("disk full"),
+		}
+		client := newSnapshotTestClient(t, runtime)
+
+		_, err := client.Snapshot(context.Background(), filepath.Join(parent, "snapshot"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "disk full")
+		entries, readErr := os.ReadDir(parent)
+		require.NoError(t, readErr)
+		require.Empty(t, entries)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		parent := t.TempDir()
+		runtime := &snapshotEmbeddedRuntime{stubEmbeddedRuntime: &stubEmbeddedRuntime{}, parent: parent}
+		client := newSnapshotTestClient(t, runtime)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := client.Snapshot(ctx, filepath.Join(parent, "snapshot"))
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 0, runtime.compactCalls)
+	})
+
+	t.Run("server mode", func(t *testing.T) {
+		client := &PersistentClient{Client: &APIClientV2{}, mode: PersistentRuntimeModeServer}
+
+		_, err := client.Snapshot(context.Background(), filepath.Join(t.TempDir(), "snapshot"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not supported in server runtime mode")
+	})
+}
+
+func TestPersistentClientSnapshot_ReopensRuntimeExplicitly(t *testing.T) {
+	newClient := func(t *testing.T, reopen func() (localEmbeddedRuntime, error)) (*PersistentClient, *quiescedEmbeddedRuntime, string) {
+		parent := t.TempDir()
+		runtime := &snapshotEmbeddedRuntime{
+			stubEmbeddedRuntime: &stubEmbeddedRuntime{},
+			parent:              parent,
+			version:             "0.3.5",
+			files:               map[string]string{"chroma.sqlite3": "sqlite"},
+			reopenErr:           errors.New("reopen failed"),
+		}
+		quiesced := newQuiescedEmbeddedRuntime(runtime)
+		quiesced.reopen = reopen
+		client := &PersistentClient{Client: newEmbeddedClientForRuntime(t, quiesced), mode: PersistentRuntimeModeEmbedded}
+		return client, quiesced, filepath.Join(parent, "snapshot")
+	}
+
+	t.Run("explicit reopen succeeds", func(t *testing.T) {
+		reopened := &stubEmbeddedRuntime{}
+		client, quiesced, dest := newClient(t, func() (localEmbeddedRuntime, error) { return reopened, nil })
+
+		snapshot, err := client.Snapshot(context.Background(), dest)
+		require.NoError(t, err)
+		require.Equal(t, dest, snapshot.Path)
+		require.Same(t, reopened, quiesced.runtime)
+	})
+
+	t.Run("explicit reopen fails", func(t *testing.T) {
+		client, _, dest := newClient(t, func() (localEmbeddedRuntime, error) { return nil, errors.New("persist path busy") })
+
+		_, err := client.Snapshot(context.Background(), dest)
+		var reopenErr *LocalRuntimeReopenError
+		require.ErrorAs(t, err, &reopenErr)
+		require.Contains(t, err.Error(), "persist path busy")
+		require.Equal(t, dest, reopenErr.Snapshot.Path)
+		_, statErr := os.Stat(filepath.Join(dest, localSnapshotManifestFile))
+		require.NoError(t, statErr, "the written snapshot is kept")
+	})
+}
+
+func TestPersistentClientSnapshot_HoldsRuntimeCallsUntilReopened(t *testing.T) {
+	parent := t.TempDir()
+	runtime := &snapshotEmbeddedRuntime{
+		stubEmbeddedRuntime: &stubEmbeddedRuntime{},
+		parent:              parent,
+		version:             "0.3.5",
+		files:               map[string]string{"chroma.sqlite3": "sqlite"},
+		backupStarted:       make(chan struct{}),
+		releaseBackup:       make(chan struct{}),
+	}
+	client := newSnapshotTestClient(t, runtime)
+
+	snapshotDone := make(chan error, 1)
+	go func() {
+		_, err := client.Snapshot(context.Background(), filepath.Join(parent, "snapshot"))
+		snapshotDone <- err
+	}()
+	<-runtime.backupStarted
+
+	heartbeatDone := make(chan error, 1)
+	go func() {
+		heartbeatDone <- client.Heartbeat(context.Background())
+	}()
+	select {
+	case <-heartbeatDone:
+		t.Fatal("heartbeat reached the runtime while the snapshot was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(runtime.releaseBackup)
+	require.NoError(t, <-snapshotDone)
+	require.NoError(t, <-heartbeatDone)
+}
+
+func stubLocalRuntimeForRestore(t *testing.T, version string, openErr error) {
+	t.Helper()
+	lockLocalTestHooks(t)
+
+	origInit := localInitFunc
+	origResolve := localResolveLibraryPathFunc
+	origVersion := localVersionWithErrorFunc
+	origNewEmbedded := localNewEmbeddedFunc
+	origStartEmbedded := localStartEmbeddedFunc
+	origWaitEmbedded := localWaitEmbeddedReadyFunc
+	t.Cleanup(func() {
+		localInitFunc = origInit
+		localResolveLibraryPathFunc = origResolve
+		localVersionWithErrorFunc = origVersion
+		localNewEmbeddedFunc = origNewEmbedded
+		localStartEmbeddedFunc = origStartEmbedded
+		localWaitEmbeddedReadyFunc = origWaitEmbedded
+	})
+
+	localResolveLibraryPathFunc = func(cfg *localClientConfig) (string, error) { return "/tmp/libchroma_go_shim.so", nil }
+	localInitFunc = func(string) error { return nil }
+	localVersionWithErrorFunc = func() (string, error) { return version, nil }
+	localNewEmbeddedFunc = func(...localchroma.EmbeddedOption) (localEmbeddedRuntime, error) {
+		if openErr != nil {
+			return nil, openErr
+		}
+		return &stubEmbeddedRuntime{}, nil
+	}
+	localStartEmbeddedFunc = func(localchroma.StartEmbeddedConfig) (localEmbeddedRuntime, error) {
+		if openErr != nil {
+			return nil, openErr
+		}
+		return &stubEmbeddedRuntime{}, nil
+	}
+	localWaitEmbeddedReadyFunc = func(localEmbeddedRuntime) error { return nil }
+}
+
+func TestRestorePersistentClient_ReplacesPersistDirectory(t *testing.T) {
+	stubLocalRuntimeForRestore(t, "0.3.5", nil)
+	root := t.TempDir()
+	snapshotDir := filepath.Join(root, "snapshot")
+	writeTestLocalSnapshot(t, snapshotDir, "0.3.4", map[string]string{"chroma.sqlite3": "restored", "segments/a.bin": "segment"})
+	persistPath := filepath.Join(root, "data")
+	require.NoError(t, os.MkdirAll(persistPath, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(persistPath, "stale.bin"), []byte("stale"), 0o644))
+
+	client, err := RestorePersistentClient(context.Background(), snapshotDir, WithPersistentPath(persistPath))
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	content, err := os.ReadFile(filepath.Join(persistPath, "chroma.sqlite3"))
+	require.NoError(t, err)
+	require.Equal(t, "restored", string(content))
+	require.NoFileExists(t, filepath.Join(persistPath, "stale.bin"))
+	require.FileExists(t, filepath.Join(persistPath, "segments", "a.bin"))
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "restore must not leave staging or previous persist directories behind")
+}
+
+func TestRestorePersistentClient_UsesPersistPathFromRuntimeConfig(t *testing.T) {
+	stubLocalRuntimeForRestore(t, "0.3.5", nil)
+	root := t.TempDir()
+	snapshotDir := filepath.Join(root, "snapshot")
+	writeTestLocalSnapshot(t, snapshotDir, "0.3.5", map[string]string{"chroma.sqlite3": "restored"})
+	persistPath := filepath.Join(root, "configured")
+
+	client, err := RestorePersistentClient(context.Background(), snapshotDir,
+		WithPersistentRuntimeConfig(&LocalRuntimeConfig{PersistPath: persistPath}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+	require.FileExists(t, filepath.Join(persistPath, "chroma.sqlite3"))
+}
+
+func TestRestorePersistentClient_LeavesPersistDirectoryOnFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		runtime  string
+		openErr  error
+		tamper   bool
+		snapshot string
+		wantErr  string
+	}{
+		{name: "newer runtime", runtime: "0.3.5", snapshot: "0.4.0", wantErr: "newer than the loaded runtime"},
+		{name: "checksum mismatch", runtime: "0.3.5", snapshot: "0.3.5", tamper: true, wantErr: "does not match its manifest checksum"},
+		{name: "open failure", runtime: "0.3.5", snapshot: "0.3.5", openErr: errors.New("locked"), wantErr: "locked"},
+		{name: "no files", runtime: "0.3.5", snapshot: "0.3.5", wantErr: "does not list any files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubLocalRuntimeForRestore(t, tt.runtime, tt.openErr)
+			root := t.TempDir()
+			snapshotDir := filepath.Join(root, "snapshot")
+			files := map[string]string{"chroma.sqlite3": "restored"}
+			if tt.name == "no files" {
+				files = nil
+			}
+			writeTestLocalSnapshot(t, snapshotDir, tt.snapshot, files)
+			if tt.tamper {
+				require.NoError(t, os.WriteFile(filepath.Join(snapshotDir, localSnapshotDataDir, "chroma.sqlite3"), []byte("tampered"), 0o644))
+			}
+			persistPath := filepath.Join(root, "data")
+			require.NoError(t, os.MkdirAll(persistPath, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(persistPath, "chroma.sqlite3"), []byte("original"), 0o644))
+
+			_, err := RestorePersistentClient(context.Background(), snapshotDir, WithPersistentPath(persistPath))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.wantErr)
+
+			content, readErr := os.ReadFile(filepath.Join(persistPath, "chroma.sqlite3"))
+			require.NoError(t, readErr)
+			require.Equal(t, "original", string(content))
+			entries, readErr := os.ReadDir(root)
+			require.NoError(t, readErr)
+			require.Len(t, entries, 2)
+		})
+	}
+}
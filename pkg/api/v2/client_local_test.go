@@ -637,13 +637,6 @@ func TestWaitForLocalServerReady_PassesTimeoutContextToHeartbeat(t *testing.T) {
 	require.True(t, transport.sawDeadline)
 }
 
-func TestEmbeddedCollection_ForkNotSupported(t *testing.T) {
-	col := &embeddedCollection{}
-	_, err := col.Fork(nil, "any-name")
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "not supported in embedded local mode")
-}
-
 func TestEmbeddedCollection_ForkCountNotSupported(t *testing.T) {
 	col := &embeddedCollection{}
 	_, err := col.ForkCount(nil)
@@ -0,0 +1,562 @@
+package v2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned for reads sent to an endpoint whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	DefaultBreakerErrorRate    = 0.5
+	DefaultBreakerOpenDuration = 30 * time.Second
+	DefaultBreakerWindow       = 30 * time.Second
+	DefaultBreakerMinRequests  = 20
+	DefaultHedgingMinDelay     = 5 * time.Millisecond
+	DefaultHedgingMaxDelay     = time.Second
+
+	breakerBuckets = 10
+	// latencySamples is the number of recent latencies hedging delays are computed from;
+	// below minLatencySamples the maximum delay is used.
+	latencySamples    = 256
+	minLatencySamples = 20
+)
+
+type breakerSettings struct {
+	errorRate     float64
+	openDuration  time.Duration
+	window        time.Duration
+	minRequests   int
+	slowThreshold time.Duration
+	slowRate      float64
+}
+
+type hedgingSettings struct {
+	percentile float64
+	maxHedges  int
+	minDelay   time.Duration
+	maxDelay   time.Duration
+}
+
+type resilienceSettings struct {
+	breaker  *breakerSettings
+	hedging  *hedgingSettings
+	timeouts map[OperationType]time.Duration
+}
+
+// ResilienceOption configures WithReadResilience.
+type ResilienceOption func(s *resilienceSettings) error
+
+func (s *resilienceSettings) ensureBreaker() *breakerSettings {
+	if s.breaker == nil {
+		s.breaker = &breakerSettings{
+			errorRate:    DefaultBreakerErrorRate,
+			openDuration: DefaultBreakerOpenDuration,
+			window:       DefaultBreakerWindow,
+			minRequests:  DefaultBreakerMinRequests,
+		}
+	}
+	return s.breaker
+}
+
+// WithCircuitBreaker opens the circuit of an endpoint when at least errorRate of its
+// reads in the window fail (connection errors and 5xx responses). While open, reads
+// to the endpoint fail with ErrCircuitOpen, or go to another endpoint when several
+// are configured with WithEndpoints. After openDuration a single trial read decides
+// whether the circuit closes again.
+func WithCircuitBreaker(errorRate float64, openDuration time.Duration) ResilienceOption {
+	return func(s *resilienceSettings) error {
+		if errorRate <= 0 || errorRate > 1 {
+			return errors.New("error rate must be in (0, 1]")
+		}
+		if openDuration <= 0 {
+			return errors.New("open duration must be positive")
+		}
+		b := s.ensureBreaker()
+		b.errorRate, b.openDuration = errorRate, openDuration
+		return nil
+	}
+}
+
+// WithCircuitBreakerWindow sets the sliding window the breaker rates are computed over
+// and the number of reads required in the window before the circuit can open.
+// Defaults to DefaultBreakerWindow and DefaultBreakerMinRequests.
+func WithCircuitBreakerWindow(window time.Duration, minRequests int) ResilienceOption {
+	return func(s *resilienceSettings) error {
+		if window <= 0 {
+			return errors.New("window must be positive")
+		}
+		if minRequests <= 0 {
+			return errors.New("min requests must be a positive integer")
+		}
+		b := s.ensureBreaker()
+		b.window, b.minRequests = window, minRequests
+		return nil
+	}
+}
+
+// WithSlowCallCircuitBreaker also opens the circuit when at least slowRate of the reads
+// in the window take longer than threshold to respond.
+func WithSlowCallCircuitBreaker(threshold time.Duration, slowRate float64) ResilienceOption {
+	return func(s *resilienceSettings) error {
+		if threshold <= 0 {
+			return errors.New("slow call threshold must be positive")
+		}
+		if slowRate <= 0 || slowRate > 1 {
+			return errors.New("slow call rate must be in (0, 1]")
+		}
+		b := s.ensureBreaker()
+		b.slowThreshold, b.slowRate = threshold, slowRate
+		return nil
+	}
+}
+
+// WithHedging sends up to maxHedges duplicate reads when a read has not completed after
+// the given percentile (e.g. 0.95) of recent read latencies. The first successful
+// response is used and the other requests are cancelled.
+func WithHedging(percentile float64, maxHedges int) ResilienceOption {
+	return func(s *resilienceSettings) error {
+		if percentile <= 0 || percentile >= 1 {
+			return errors.New("percentile must be in (0, 1)")
+		}
+		if maxHedges <= 0 {
+			return errors.New("max hedges must be a positive integer")
+		}
+		if s.hedging == nil {
+			s.hedging = &hedgingSettings{minDelay: DefaultHedgingMinDelay, maxDelay: DefaultHedgingMaxDelay}
+		}
+		s.hedging.percentile, s.hedging.maxHedges = percentile, maxHedges
+		return nil
+	}
+}
+
+// WithHedgingDelay bounds the hedging delay. The maximum is also used until enough
+// latencies have been observed. Defaults to DefaultHedgingMinDelay and DefaultHedgingMaxDelay.
+func WithHedgingDelay(minDelay, maxDelay time.Duration) ResilienceOption {
+	return func(s *resilienceSettings) error {
+		if minDelay < 0 || maxDelay <= 0 || minDelay > maxDelay {
+			return errors.New("invalid hedging delay bounds")
+		}
+		if s.hedging == nil {
+			return errors.New("WithHedgingDelay requires WithHedging")
+		}
+		s.hedging.minDelay, s.hedging.maxDelay = minDelay, maxDelay
+		return nil
+	}
+}
+
+// WithOperationTimeout sets the timeout of OperationGet, OperationQuery or OperationSearch
+// reads, overriding the client timeout for that operation, including hedged requests.
+func WithOperationTimeout(operation OperationType, timeout time.Duration) ResilienceOption {
+	return func(s *resilienceSettings) error {
+		switch operation {
+		case OperationGet, OperationQuery, OperationSearch:
+		default:
+			return errors.Errorf("operation timeouts are only supported for reads, got %s", operation)
+		}
+		if timeout <= 0 {
+			return errors.New("timeout must be positive")
+		}
+		if s.timeouts == nil {
+			s.timeouts = map[OperationType]time.Duration{}
+		}
+		s.timeouts[operation] = timeout
+		return nil
+	}
+}
+
+// WithReadResilience enables circuit breaking, hedging and per-operation timeouts for
+// collection Get, Query and Search. Writes are never hedged.
+//
+//	client, err := NewHTTPClient(
+//		WithEndpoints([]string{"http://chroma-0:8000", "http://chroma-1:8000"}),
+//		WithReadResilience(
+//			WithCircuitBreaker(0.5, 30*time.Second),
+//			WithHedging(0.95, 1),
+//			WithOperationTimeout(OperationQuery, 2*time.Second),
+//		),
+//	)
+func WithReadResilience(opts ...ResilienceOption) ClientOption {
+	return func(c *BaseAPIClient) error {
+		s := &resilienceSettings{}
+		for _, opt := range opts {
+			if err := opt(s); err != nil {
+				return errors.Wrap(err, "invalid resilience option")
+			}
+		}
+		c.resilience = &readResilience{settings: s, latencies: map[OperationType]*latencyWindow{}}
+		return nil
+	}
+}
+
+type readResilience struct {
+	settings *resilienceSettings
+	// client is the client HTTP client without its timeout, reads use a context deadline
+	client *http.Client
+	// timeout is the client timeout applied to reads without an operation timeout
+	timeout time.Duration
+
+	mu        sync.Mutex
+	latencies map[OperationType]*latencyWindow
+}
+
+type resilientReadKey struct{}
+
+func isResilientRead(ctx context.Context) bool {
+	marked, _ := ctx.Value(resilientReadKey{}).(bool)
+	return marked
+}
+
+// init derives the read client from the fully configured client HTTP client.
+func (r *readResilience) init(httpClient *http.Client) {
+	readClient := *httpClient
+	r.timeout = readClient.Timeout
+	readClient.Timeout = 0
+	r.client = &readClient
+}
+
+// executeRead sends a collection read, applying the read resilience settings if enabled.
+// The returned body is limited to the maximum response size; closing it releases the request.
+func (bc *BaseAPIClient) executeRead(ctx context.Context, operation OperationType, path string, request interface{}) (io.ReadCloser, error) {
+	reqJSON, err := marshalRequestBody(http.MethodPost, request)
+	if err != nil {
+		return nil, err
+	}
+	ctx = withIdempotentRequest(ctx)
+	r := bc.resilience
+	if r == nil {
+		resp, err := bc.sendRequest(ctx, bc.httpClient, http.MethodPost, path, reqJSON)
+		if err != nil {
+			return nil, err
+		}
+		return bc.readBody(resp, nil), nil
+	}
+	timeout := r.timeout
+	if t, ok := r.settings.timeouts[operation]; ok {
+		timeout = t
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	ctx = context.WithValue(ctx, resilientReadKey{}, true)
+	if r.settings.hedging == nil {
+		start := time.Now()
+		resp, err := bc.sendRequest(ctx, r.client, http.MethodPost, path, reqJSON)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		r.observe(operation, time.Since(start))
+		// the timeout also covers reading the body
+		return bc.readBody(resp, cancel), nil
+	}
+	resp, release, err := bc.executeHedged(ctx, r, operation, path, reqJSON)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return bc.readBody(resp, func() {
+		release()
+		cancel()
+	}), nil
+}
+
+// readBody returns the limited body of resp; closing it calls release.
+func (bc *BaseAPIClient) readBody(resp *http.Response, release func()) io.ReadCloser {
+	return &responseBody{Reader: bc.limitResponseBody(resp.Body), body: resp.Body, release: release}
+}
+
+type responseBody struct {
+	io.Reader
+	body    io.Closer
+	release func()
+}
+
+func (b *responseBody) Close() error {
+	err := b.body.Close()
+	if b.release != nil {
+		b.release()
+	}
+	return err
+}
+
+type hedgedResult struct {
+	resp    *http.Response
+	err     error
+	latency time.Duration
+	attempt int
+}
+
+// executeHedged returns the first successful response. The losing requests are
+// cancelled; release cancels the winning request once its body has been read.
+func (bc *BaseAPIClient) executeHedged(ctx context.Context, r *readResilience, operation OperationType, path string, reqJSON []byte) (*http.Response, context.CancelFunc, error) {
+	hedging := r.settings.hedging
+	results := make(chan hedgedResult, hedging.maxHedges+1)
+	var cancels []context.CancelFunc
+	launch := func() {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			start := time.Now()
+			resp, err := bc.sendRequest(attemptCtx, r.client, http.MethodPost, path, reqJSON)
+			results <- hedgedResult{resp: resp, err: err, latency: time.Since(start), attempt: attempt}
+		}()
+	}
+	delay := r.hedgeDelay(operation)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	launch()
+	launched, inFlight := 1, 1
+	var firstErr error
+	for {
+		select {
+		case res := <-results:
+			inFlight--
+			if res.err == nil {
+				r.observe(operation, res.latency)
+				for i, cancel := range cancels {
+					if i != res.attempt {
+						cancel()
+					}
+				}
+				// responses of requests that completed before being cancelled are discarded
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if lost := <-results; lost.resp != nil {
+							_ = lost.resp.Body.Close()
+						}
+					}
+				}(inFlight)
+				return res.resp, cancels[res.attempt], nil
+			}
+			cancels[res.attempt]()
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			// hedging is not a retry: an error is returned once no request is left
+			if inFlight == 0 {
+				if ctx.Err() != nil {
+					return nil, nil, errors.Wrap(ctx.Err(), firstErr.Error())
+				}
+				return nil, nil, firstErr
+			}
+		case <-timer.C:
+			if launched <= hedging.maxHedges {
+				launch()
+				launched++
+				inFlight++
+				timer.Reset(delay)
+			}
+		}
+	}
+}
+
+// hedgeDelay returns the configured percentile of the recent latencies of operation.
+func (r *readResilience) hedgeDelay(operation OperationType) time.Duration {
+	hedging := r.settings.hedging
+	r.mu.Lock()
+	w := r.latencies[operation]
+	var delay time.Duration
+	if w != nil && w.count >= minLatencySamples {
+		delay = w.percentile(hedging.percentile)
+	} else {
+		delay = hedging.maxDelay
+	}
+	r.mu.Unlock()
+	return min(max(delay, hedging.minDelay), hedging.maxDelay)
+}
+
+func (r *readResilience) observe(operation OperationType, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := r.latencies[operation]
+	if w == nil {
+		w = &latencyWindow{}
+		r.latencies[operation] = w
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencySamples
+	if w.count < latencySamples {
+		w.count++
+	}
+}
+
+type latencyWindow struct {
+	samples [latencySamples]time.Duration
+	next    int
+	count   int
+}
+
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	sorted := make([]time.Duration, w.count)
+	copy(sorted, w.samples[:w.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[min(int(p*float64(len(sorted))), len(sorted)-1)]
+}
+
+// circuitBreakerTransport keeps a circuit breaker per endpoint host for reads sent by
+// executeRead. Other requests pass through unchanged.
+type circuitBreakerTransport struct {
+	base     http.RoundTripper
+	settings *breakerSettings
+	now      func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakerTransport(base http.RoundTripper, settings *breakerSettings) *circuitBreakerTransport {
+	return &circuitBreakerTransport{base: base, settings: settings, now: time.Now, breakers: map[string]*circuitBreaker{}}
+}
+
+func (t *circuitBreakerTransport) breaker(host string) *circuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &circuitBreaker{settings: t.settings}
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isResilientRead(req.Context()) {
+		return t.base.RoundTrip(req)
+	}
+	b := t.breaker(req.URL.Host)
+	if !b.allow(t.now()) {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, errors.Wrap(ErrCircuitOpen, req.URL.Host)
+	}
+	start := t.now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && req.Context().Err() != nil {
+		// cancelled, e.g. a hedged request that lost
+		b.release()
+		return resp, err
+	}
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	slow := t.settings.slowThreshold > 0 && t.now().Sub(start) > t.settings.slowThreshold
+	b.record(t.now(), failed, slow)
+	return resp, err
+}
+
+func (t *circuitBreakerTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breakerBucket struct {
+	id                  int64
+	total, failed, slow int
+}
+
+type circuitBreaker struct {
+	settings *breakerSettings
+
+	mu       sync.Mutex
+	state    breakerState
+	openedAt time.Time
+	probing  bool
+	buckets  [breakerBuckets]breakerBucket
+}
+
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.settings.openDuration {
+			return false
+		}
+		b.state, b.probing = breakerHalfOpen, true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// release frees the trial slot of a half-open breaker without an outcome.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *circuitBreaker) record(now time.Time, failed, slow bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerHalfOpen:
+		if failed || slow {
+			b.state, b.openedAt, b.probing = breakerOpen, now, false
+			return
+		}
+		b.state, b.probing = breakerClosed, false
+		b.buckets = [breakerBuckets]breakerBucket{}
+		return
+	case breakerOpen:
+		// a request allowed before the circuit opened
+		return
+	}
+	bucketSize := b.settings.window / breakerBuckets
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	id := now.UnixNano() / int64(bucketSize)
+	bucket := &b.buckets[id%breakerBuckets]
+	if bucket.id != id {
+		*bucket = breakerBucket{id: id}
+	}
+	bucket.total++
+	if failed {
+		bucket.failed++
+	}
+	if slow {
+		bucket.slow++
+	}
+	var total, failures, slowCalls int
+	for _, bk := range b.buckets {
+		if id-bk.id < breakerBuckets {
+			total += bk.total
+			failures += bk.failed
+			slowCalls += bk.slow
+		}
+	}
+	if total < b.settings.minRequests {
+		return
+	}
+	if float64(failures)/float64(total) >= b.settings.errorRate ||
+		(b.settings.slowThreshold > 0 && float64(slowCalls)/float64(total) >= b.settings.slowRate) {
+		b.state, b.openedAt = breakerOpen, now
+	}
+}
@@ -0,0 +1,195 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newResilientClient(t *testing.T, opts ...ClientOption) *APIClientV2 {
+	t.Helper()
+	c, err := NewHTTPClient(opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c.(*APIClientV2)
+}
+
+func TestReadHedging(t *testing.T) {
+	var hits, cancelled atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server notices a closed connection only once the body is consumed
+		_, _ = io.ReadAll(r.Body)
+		if hits.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+				cancelled.Add(1)
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	defer srv.Close()
+	client := newResilientClient(t, WithBaseURL(srv.URL), WithReadResilience(
+		WithHedging(0.9, 1),
+		WithHedgingDelay(time.Millisecond, 20*time.Millisecond),
+	))
+
+	start := time.Now()
+	body, err := client.executeRead(context.Background(), OperationQuery, "query", map[string]int{"n": 1})
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	require.JSONEq(t, `{"ok":true}`, string(data))
+	require.Less(t, time.Since(start), 2*time.Second, "the hedged request wins")
+	require.Equal(t, int32(2), hits.Load())
+	require.Eventually(t, func() bool { return cancelled.Load() == 1 }, 2*time.Second, 5*time.Millisecond, "the losing request is cancelled")
+}
+
+func TestWritesAreNotHedged(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+	client := newResilientClient(t, WithBaseURL(srv.URL), WithReadResilience(
+		WithHedging(0.9, 2),
+		WithHedgingDelay(time.Millisecond, time.Millisecond),
+	))
+	_, err := client.ExecuteRequest(context.Background(), http.MethodPost, "add", map[string]int{"n": 1})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), hits.Load())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits, status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(int(status.Load()))
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+	client := newResilientClient(t, WithBaseURL(srv.URL), WithReadResilience(
+		WithCircuitBreaker(0.5, time.Minute),
+		WithCircuitBreakerWindow(time.Minute, 4),
+	))
+	breakers := client.httpClient.Transport.(*circuitBreakerTransport)
+	now := time.Now()
+	breakers.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		_, err := client.executeRead(ctx, OperationGet, "get", nil)
+		require.Error(t, err)
+		require.False(t, errors.Is(err, ErrCircuitOpen))
+	}
+	_, err := client.executeRead(ctx, OperationGet, "get", nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(4), hits.Load(), "an open circuit rejects reads")
+
+	_, err = client.ExecuteRequest(ctx, http.MethodPost, "add", nil)
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrCircuitOpen), "writes are not subject to the breaker")
+
+	now = now.Add(2 * time.Minute)
+	status.Store(http.StatusOK)
+	body, err := client.executeRead(ctx, OperationGet, "get", nil)
+	require.NoError(t, err, "the trial read closes the circuit")
+	require.NoError(t, body.Close())
+	body, err = client.executeRead(ctx, OperationGet, "get", nil)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+}
+
+func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
+	b := &circuitBreaker{settings: &breakerSettings{errorRate: 0.5, openDuration: time.Second, window: time.Minute, minRequests: 1}}
+	now := time.Now()
+	require.True(t, b.allow(now))
+	b.record(now, true, false)
+	require.False(t, b.allow(now))
+
+	now = now.Add(2 * time.Second)
+	require.True(t, b.allow(now), "trial request")
+	require.False(t, b.allow(now), "only one trial request")
+	b.release()
+	require.True(t, b.allow(now), "a cancelled trial frees the slot")
+	b.record(now, true, false)
+	require.False(t, b.allow(now.Add(time.Millisecond)), "a failed trial opens the circuit again")
+}
+
+func TestSlowCallCircuitBreaker(t *testing.T) {
+	b := &circuitBreaker{settings: &breakerSettings{
+		errorRate: 1, openDuration: time.Minute, window: time.Minute, minRequests: 2,
+		slowThreshold: time.Second, slowRate: 0.5,
+	}}
+	now := time.Now()
+	b.record(now, false, false)
+	require.True(t, b.allow(now))
+	b.record(now, false, true)
+	require.False(t, b.allow(now), "half of the calls were slow")
+}
+
+func TestOperationTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+	client := newResilientClient(t, WithBaseURL(srv.URL), WithTimeout(time.Millisecond), WithReadResilience(
+		WithOperationTimeout(OperationQuery, 5*time.Second),
+		WithOperationTimeout(OperationSearch, 20*time.Millisecond),
+	))
+	body, err := client.executeRead(context.Background(), OperationQuery, "query", nil)
+	require.NoError(t, err, "the operation timeout overrides WithTimeout")
+	require.NoError(t, body.Close())
+	_, err = client.executeRead(context.Background(), OperationSearch, "search", nil)
+	require.Error(t, err)
+	_, err = client.executeRead(context.Background(), OperationGet, "get", nil)
+	require.Error(t, err, "reads without an operation timeout use WithTimeout")
+}
+
+func TestHedgeDelay(t *testing.T) {
+	r := &readResilience{
+		settings:  &resilienceSettings{hedging: &hedgingSettings{percentile: 0.9, maxHedges: 1, minDelay: time.Millisecond, maxDelay: time.Second}},
+		latencies: map[OperationType]*latencyWindow{},
+	}
+	require.Equal(t, time.Second, r.hedgeDelay(OperationQuery), "max delay until enough samples")
+	for i := 1; i <= 100; i++ {
+		r.observe(OperationQuery, time.Duration(i)*time.Millisecond)
+	}
+	require.Equal(t, 91*time.Millisecond, r.hedgeDelay(OperationQuery))
+	require.Equal(t, time.Second, r.hedgeDelay(OperationGet))
+}
+
+func TestWithReadResilienceValidation(t *testing.T) {
+	for _, opt := range []ResilienceOption{
+		WithCircuitBreaker(0, time.Second),
+		WithCircuitBreaker(0.5, 0),
+		WithCircuitBreakerWindow(0, 1),
+		WithSlowCallCircuitBreaker(time.Second, 2),
+		WithHedging(1, 1),
+		WithHedging(0.9, 0),
+		WithHedgingDelay(time.Millisecond, time.Second),
+		WithOperationTimeout(OperationCreate, time.Second),
+		WithOperationTimeout(OperationQuery, 0),
+	} {
+		_, err := NewHTTPClient(WithReadResilience(opt))
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,598 @@
+package v2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+type tlsSettings struct {
+	certFile       string
+	keyFile        string
+	certPEM        []byte
+	keyPEM         []byte
+	pkcs12File     string
+	pkcs12Data     []byte
+	pkcs12Password string
+	caPEM          [][]byte
+	caFiles        []string
+	caDirs         []string
+	serverName     string
+	minVersion     uint16
+	pins           [][]byte
+	reloadInterval time.Duration
+	// hosts returns the hosts the client dials, to verify reloaded chains of servers
+	// addressed by IP, for which crypto/tls reports no server name
+	hosts func() []string
+}
+
+// TLSOption configures the TLS settings applied by WithTLS.
+type TLSOption func(s *tlsSettings) error
+
+// WithClientCertificate presents the PEM encoded certificate and private key files to
+// servers that require mutual TLS. The certificate file may contain intermediates.
+func WithClientCertificate(certFile, keyFile string) TLSOption {
+	return func(s *tlsSettings) error {
+		if certFile == "" || keyFile == "" {
+			return errors.New("certificate and key file cannot be empty")
+		}
+		if s.hasClientCertificate() {
+			return errors.New("only one client certificate can be configured")
+		}
+		s.certFile, s.keyFile = certFile, keyFile
+		return nil
+	}
+}
+
+// WithClientCertificatePEM presents a PEM encoded certificate and private key.
+func WithClientCertificatePEM(certPEM, keyPEM []byte) TLSOption {
+	return func(s *tlsSettings) error {
+		if len(certPEM) == 0 || len(keyPEM) == 0 {
+			return errors.New("certificate and key cannot be empty")
+		}
+		if s.hasClientCertificate() {
+			return errors.New("only one client certificate can be configured")
+		}
+		s.certPEM, s.keyPEM = certPEM, keyPEM
+		return nil
+	}
+}
+
+// WithClientCertificatePKCS12 presents the certificate and private key of a PKCS#12
+// (.p12/.pfx) file. Chain certificates in the file are sent as intermediates.
+func WithClientCertificatePKCS12(file, password string) TLSOption {
+	return func(s *tlsSettings) error {
+		if file == "" {
+			return errors.New("PKCS#12 file cannot be empty")
+		}
+		if s.hasClientCertificate() {
+			return errors.New("only one client certificate can be configured")
+		}
+		s.pkcs12File, s.pkcs12Password = file, password
+		return nil
+	}
+}
+
+// WithClientCertificatePKCS12Data is like WithClientCertificatePKCS12 for in-memory data.
+func WithClientCertificatePKCS12Data(data []byte, password string) TLSOption {
+	return func(s *tlsSettings) error {
+		if len(data) == 0 {
+			return errors.New("PKCS#12 data cannot be empty")
+		}
+		if s.hasClientCertificate() {
+			return errors.New("only one client certificate can be configured")
+		}
+		s.pkcs12Data, s.pkcs12Password = data, password
+		return nil
+	}
+}
+
+// WithCACertificates trusts the PEM encoded CA certificates. Configured CAs replace
+// the system roots. The option can be added multiple times.
+func WithCACertificates(pemCerts []byte) TLSOption {
+	return func(s *tlsSettings) error {
+		if len(pemCerts) == 0 {
+			return errors.New("CA certificates cannot be empty")
+		}
+		s.caPEM = append(s.caPEM, pemCerts)
+		return nil
+	}
+}
+
+// WithCACertificateFile trusts the CA certificates of a PEM file (a bundle).
+func WithCACertificateFile(file string) TLSOption {
+	return func(s *tlsSettings) error {
+		if file == "" {
+			return errors.New("CA file cannot be empty")
+		}
+		s.caFiles = append(s.caFiles, file)
+		return nil
+	}
+}
+
+// WithCACertificateDir trusts every *.pem, *.crt and *.cer file of a directory, such
+// as a mounted Kubernetes secret or /etc/ssl/certs style directory.
+func WithCACertificateDir(dir string) TLSOption {
+	return func(s *tlsSettings) error {
+		if dir == "" {
+			return errors.New("CA directory cannot be empty")
+		}
+		s.caDirs = append(s.caDirs, dir)
+		return nil
+	}
+}
+
+// WithServerName overrides the server name sent in SNI and used to verify the server
+// certificate, e.g. when connecting to an ingress by IP address.
+func WithServerName(serverName string) TLSOption {
+	return func(s *tlsSettings) error {
+		if serverName == "" {
+			return errors.New("server name cannot be empty")
+		}
+		s.serverName = serverName
+		return nil
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version, e.g. tls.VersionTLS13. Go defaults to TLS 1.2.
+func WithMinTLSVersion(version uint16) TLSOption {
+	return func(s *tlsSettings) error {
+		switch version {
+		case tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+			s.minVersion = version
+			return nil
+		default:
+			return errors.Errorf("unsupported TLS version: %#x", version)
+		}
+	}
+}
+
+// WithPinnedCertificates requires the server chain to contain a certificate whose
+// public key (SPKI) SHA-256 hash matches one of the pins. Pins are base64 (optionally
+// prefixed with "sha256/", as printed by openssl and curl) or hex encoded. Pinning is
+// checked in addition to the regular certificate verification.
+func WithPinnedCertificates(pins ...string) TLSOption {
+	return func(s *tlsSettings) error {
+		if len(pins) == 0 {
+			return errors.New("at least one pin is required")
+		}
+		for _, pin := range pins {
+			hash, err := parseCertificatePin(pin)
+			if err != nil {
+				return err
+			}
+			s.pins = append(s.pins, hash)
+		}
+		return nil
+	}
+}
+
+// WithCertificateReload re-reads the certificate, key and CA files when they change,
+// checking at most once per interval, so rotated certificates (cert-manager, Vault,
+// Kubernetes secrets) are used by new connections without restarting the client.
+// A rotation that cannot be loaded, e.g. a key written after its certificate, keeps
+// the previous certificates until the next check.
+func WithCertificateReload(interval time.Duration) TLSOption {
+	return func(s *tlsSettings) error {
+		if interval <= 0 {
+			return errors.New("reload interval must be positive")
+		}
+		s.reloadInterval = interval
+		return nil
+	}
+}
+
+// WithTLS applies TLS settings to the client transport. It can be combined with
+// WithSSLCert, WithInsecure and WithTimeout but not with WithHTTPClient.
+//
+//	client, err := NewHTTPClient(
+//		WithBaseURL("https://chroma.example.com"),
+//		WithTLS(
+//			WithClientCertificate("client.crt", "client.key"),
+//			WithCACertificateFile("ca.pem"),
+//			WithCertificateReload(time.Minute),
+//		),
+//	)
+func WithTLS(opts ...TLSOption) ClientOption {
+	return func(c *BaseAPIClient) error {
+		if c.usesHTTPClient {
+			return errors.New("WithTLS cannot be combined with WithHTTPClient")
+		}
+		s := &tlsSettings{hosts: c.dialedHosts}
+		for _, opt := range opts {
+			if err := opt(s); err != nil {
+				return errors.Wrap(err, "invalid TLS option")
+			}
+		}
+		if c.httpTransport == nil {
+			c.httpTransport = &http.Transport{}
+		}
+		if c.httpTransport.TLSClientConfig == nil {
+			c.httpTransport.TLSClientConfig = &tls.Config{}
+		}
+		if err := s.apply(c.httpTransport.TLSClientConfig); err != nil {
+			return err
+		}
+		c.usesTransport = true
+		return nil
+	}
+}
+
+// dialedHosts returns the hosts of the base URL and of the endpoints.
+func (bc *BaseAPIClient) dialedHosts() []string {
+	var hosts []string
+	if bc.endpoints != nil {
+		for _, e := range bc.endpoints.endpoints {
+			hosts = append(hosts, e.url.Hostname())
+		}
+	} else if u, err := url.Parse(bc.baseURL); err == nil {
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
+}
+
+func (s *tlsSettings) hasClientCertificate() bool {
+	return s.certFile != "" || len(s.certPEM) > 0 || s.pkcs12File != "" || len(s.pkcs12Data) > 0
+}
+
+func (s *tlsSettings) apply(cfg *tls.Config) error {
+	if s.serverName != "" {
+		cfg.ServerName = s.serverName
+	}
+	if s.minVersion != 0 {
+		cfg.MinVersion = s.minVersion
+	}
+	if s.hasClientCertificate() {
+		certs := newFileReloader(s.certificateFiles(), s.reloadInterval, s.loadClientCertificate)
+		cert, err := certs.get()
+		if err != nil {
+			return err
+		}
+		if certs.reloads() {
+			cfg.Certificates = nil
+			cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return certs.get()
+			}
+		} else {
+			cfg.Certificates = []tls.Certificate{*cert}
+		}
+	}
+
+	// verifyChain verifies the chain itself when the CA pool is reloaded, since
+	// RootCAs cannot change per connection. Otherwise crypto/tls has verified it.
+	var verifyChain func(tls.ConnectionState) ([][]*x509.Certificate, error)
+	if len(s.caPEM) > 0 || len(s.caFiles) > 0 || len(s.caDirs) > 0 {
+		base := cfg.RootCAs
+		roots := newFileReloader(s.caPaths(), s.reloadInterval, func() (*x509.CertPool, error) {
+			return s.loadCAPool(base)
+		})
+		pool, err := roots.get()
+		if err != nil {
+			return err
+		}
+		switch {
+		case cfg.InsecureSkipVerify:
+			// WithInsecure was applied first, keep verification disabled
+		case roots.reloads():
+			// captured now, the base URL may only be set by a later option
+			serverName, hosts := cfg.ServerName, s.hosts
+			cfg.RootCAs = nil
+			cfg.InsecureSkipVerify = true //nolint:gosec // the chain is verified against the reloaded pool in VerifyConnection
+			verifyChain = func(cs tls.ConnectionState) ([][]*x509.Certificate, error) {
+				pool, err := roots.get()
+				if err != nil {
+					return nil, err
+				}
+				names := []string{cs.ServerName}
+				switch {
+				case cs.ServerName != "":
+				case serverName != "":
+					names = []string{serverName}
+				case hosts != nil:
+					names = hosts()
+				}
+				return verifyPeerChain(pool, cs, names)
+			}
+		default:
+			cfg.RootCAs = pool
+		}
+	}
+	if verifyChain == nil && len(s.pins) == 0 {
+		return nil
+	}
+	pins := s.pins
+	previous := cfg.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if previous != nil {
+			if err := previous(cs); err != nil {
+				return err
+			}
+		}
+		chains := cs.VerifiedChains
+		if verifyChain != nil {
+			var err error
+			if chains, err = verifyChain(cs); err != nil {
+				return err
+			}
+		}
+		if len(pins) > 0 {
+			return verifyCertificatePins(pins, cs.PeerCertificates, chains)
+		}
+		return nil
+	}
+	return nil
+}
+
+func (s *tlsSettings) certificateFiles() []string {
+	switch {
+	case s.certFile != "":
+		return []string{s.certFile, s.keyFile}
+	case s.pkcs12File != "":
+		return []string{s.pkcs12File}
+	default:
+		return nil
+	}
+}
+
+func (s *tlsSettings) caPaths() []string {
+	return append(append([]string(nil), s.caFiles...), s.caDirs...)
+}
+
+func (s *tlsSettings) loadClientCertificate() (*tls.Certificate, error) {
+	certPEM, keyPEM := s.certPEM, s.keyPEM
+	switch {
+	case s.certFile != "":
+		var err error
+		if certPEM, err = os.ReadFile(s.certFile); err != nil {
+			return nil, errors.Wrap(err, "error reading client certificate")
+		}
+		if keyPEM, err = os.ReadFile(s.keyFile); err != nil {
+			return nil, errors.Wrap(err, "error reading client key")
+		}
+	case s.pkcs12File != "" || len(s.pkcs12Data) > 0:
+		data := s.pkcs12Data
+		if s.pkcs12File != "" {
+			var err error
+			if data, err = os.ReadFile(s.pkcs12File); err != nil {
+				return nil, errors.Wrap(err, "error reading PKCS#12 file")
+			}
+		}
+		return decodePKCS12Certificate(data, s.pkcs12Password)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading client certificate")
+	}
+	return &cert, nil
+}
+
+// decodePKCS12Certificate decodes the certificate, chain and private key of PKCS#12 data,
+// including the AES encrypted files OpenSSL 3 writes by default.
+func decodePKCS12Certificate(data []byte, password string) (*tls.Certificate, error) {
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding PKCS#12 data")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("unsupported PKCS#12 private key type %T", key)
+	}
+	if public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !public.Equal(leaf.PublicKey) {
+		return nil, errors.New("PKCS#12 private key does not match the certificate")
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+	for _, ca := range chain {
+		cert.Certificate = append(cert.Certificate, ca.Raw)
+	}
+	return cert, nil
+}
+
+func (s *tlsSettings) loadCAPool(base *x509.CertPool) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if base != nil {
+		pool = base.Clone()
+	}
+	for _, data := range s.caPEM {
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no valid CA certificate found in PEM data")
+		}
+	}
+	for _, file := range s.caFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading CA file")
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no valid CA certificate found in %s", file)
+		}
+	}
+	for _, dir := range s.caDirs {
+		files, err := caDirFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		added := false
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, errors.Wrap(err, "error reading CA file")
+			}
+			added = pool.AppendCertsFromPEM(data) || added
+		}
+		if !added {
+			return nil, errors.Errorf("no valid CA certificate found in directory %s", dir)
+		}
+	}
+	return pool, nil
+}
+
+func caDirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading CA directory")
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".pem", ".crt", ".cer":
+		default:
+			continue
+		}
+		path := filepath.Join(dir, name)
+		// entries of Kubernetes secret mounts are symlinks, stat follows them
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// verifyPeerChain verifies the server chain against roots for one of names, the
+// server name or, for servers addressed by IP, the hosts the client dials.
+func verifyPeerChain(roots *x509.CertPool, cs tls.ConnectionState, names []string) ([][]*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("server presented no certificates")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	err := errors.New("cannot verify the server certificate without a server name")
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		opts.DNSName = name
+		var chains [][]*x509.Certificate
+		if chains, err = cs.PeerCertificates[0].Verify(opts); err == nil {
+			return chains, nil
+		}
+	}
+	return nil, err
+}
+
+func parseCertificatePin(pin string) ([]byte, error) {
+	value := strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+	if len(value) == hex.EncodedLen(sha256.Size) {
+		if hash, err := hex.DecodeString(value); err == nil {
+			return hash, nil
+		}
+	}
+	hash, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(hash) != sha256.Size {
+		return nil, errors.Errorf("invalid certificate pin %q: expected a base64 or hex SHA-256 hash", pin)
+	}
+	return hash, nil
+}
+
+// CertificatePin returns the pin of a certificate for WithPinnedCertificates.
+func CertificatePin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// verifyCertificatePins checks the presented certificates and the verified chains,
+// which also contain the trusted root the server does not send.
+func verifyCertificatePins(pins [][]byte, peer []*x509.Certificate, chains [][]*x509.Certificate) error {
+	for _, chain := range append([][]*x509.Certificate{peer}, chains...) {
+		for _, cert := range chain {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(hash[:], pin) {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("server certificate does not match any pinned certificate")
+}
+
+// fileReloader caches a value loaded from files and loads it again when the files'
+// modification times or sizes change. Without an interval or files it loads once.
+type fileReloader[T any] struct {
+	paths    []string
+	interval time.Duration
+	load     func() (T, error)
+
+	mu      sync.Mutex
+	value   T
+	loaded  bool
+	state   string
+	checked time.Time
+}
+
+func newFileReloader[T any](paths []string, interval time.Duration, load func() (T, error)) *fileReloader[T] {
+	return &fileReloader[T]{paths: paths, interval: interval, load: load}
+}
+
+func (r *fileReloader[T]) reloads() bool {
+	return r.interval > 0 && len(r.paths) > 0
+}
+
+func (r *fileReloader[T]) get() (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loaded && (!r.reloads() || time.Since(r.checked) < r.interval) {
+		return r.value, nil
+	}
+	r.checked = time.Now()
+	state := filesState(r.paths)
+	if r.loaded && state == r.state {
+		return r.value, nil
+	}
+	value, err := r.load()
+	if err != nil {
+		if r.loaded {
+			// keep serving the previous files while a rotation is in progress
+			return r.value, nil
+		}
+		var zero T
+		return zero, err
+	}
+	r.value, r.loaded, r.state = value, true, state
+	return value, nil
+}
+
+func filesState(paths []string) string {
+	var b strings.Builder
+	add := func(path string) {
+		if info, err := os.Stat(path); err == nil {
+			_, _ = fmt.Fprintf(&b, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		} else {
+			_, _ = fmt.Fprintf(&b, "%s:missing;", path)
+		}
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			files, _ := caDirFiles(path)
+			for _, file := range files {
+				add(file)
+			}
+			continue
+		}
+		add(path)
+	}
+	return b.String()
+}
@@ -0,0 +1,395 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	serial  atomic.Int64
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	ca := &testCA{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+	ca.serial.Store(1)
+	return ca
+}
+
+// issue returns a PEM certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, cn string, dnsNames []string, ips []net.IP, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial.Add(1)),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newMTLSServer starts a server requiring client certificates signed by clientCA and
+// answering with the common name of the client certificate.
+func newMTLSServer(t *testing.T, serverCA, clientCA *testCA, serverCfg func(*tls.Config), dnsNames []string, ips []net.IP) *httptest.Server {
+	t.Helper()
+	certPEM, keyPEM := serverCA.issue(t, "server", dnsNames, ips, x509.ExtKeyUsageServerAuth)
+	serverCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.cert)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`"` + r.TLS.PeerCertificates[0].Subject.CommonName + `"`))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	if serverCfg != nil {
+		serverCfg(srv.TLS)
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func tlsGet(t *testing.T, client *BaseAPIClient) (string, error) {
+	t.Helper()
+	client.httpTransport.CloseIdleConnections()
+	body, err := client.ExecuteRequest(context.Background(), http.MethodGet, "whoami", nil)
+	return string(body), err
+}
+
+func TestWithTLSMutualTLS(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	srv := newMTLSServer(t, serverCA, clientCA, nil, nil, []net.IP{net.ParseIP("127.0.0.1")})
+
+	dir := t.TempDir()
+	certPEM, keyPEM := clientCA.issue(t, "client-1", nil, nil, x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, filepath.Join(dir, "client.crt"), certPEM)
+	writeTestFile(t, filepath.Join(dir, "client.key"), keyPEM)
+	writeTestFile(t, filepath.Join(dir, "ca.pem"), serverCA.certPEM)
+
+	t.Run("files", func(t *testing.T) {
+		client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTimeout(5*time.Second), WithTLS(
+			WithClientCertificate(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")),
+			WithCACertificateFile(filepath.Join(dir, "ca.pem")),
+		))
+		require.NoError(t, err)
+		require.Equal(t, 5*time.Second, client.HTTPClient().Timeout)
+		body, err := tlsGet(t, client)
+		require.NoError(t, err)
+		require.Equal(t, `"client-1"`, body)
+	})
+
+	t.Run("pem bytes", func(t *testing.T) {
+		client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(
+			WithClientCertificatePEM(certPEM, keyPEM),
+			WithCACertificates(serverCA.certPEM),
+		))
+		require.NoError(t, err)
+		_, err = tlsGet(t, client)
+		require.NoError(t, err)
+	})
+
+	t.Run("combined with WithSSLCert", func(t *testing.T) {
+		client, err := newBaseAPIClient(WithBaseURL(srv.URL),
+			WithSSLCert(filepath.Join(dir, "ca.pem")),
+			WithTLS(WithClientCertificatePEM(certPEM, keyPEM)),
+		)
+		require.NoError(t, err)
+		_, err = tlsGet(t, client)
+		require.NoError(t, err)
+	})
+
+	t.Run("without client certificate", func(t *testing.T) {
+		client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(WithCACertificates(serverCA.certPEM)))
+		require.NoError(t, err)
+		_, err = tlsGet(t, client)
+		require.Error(t, err)
+	})
+
+	t.Run("unknown server CA", func(t *testing.T) {
+		client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(
+			WithClientCertificatePEM(certPEM, keyPEM),
+			WithCACertificates(clientCA.certPEM),
+		))
+		require.NoError(t, err)
+		_, err = tlsGet(t, client)
+		require.Error(t, err)
+	})
+}
+
+// testdata/tls holds a client certificate issued by client-ca.pem, exported by OpenSSL 3
+// with password "chroma": client.p12 with the default AES-256 encryption and the CA as
+// chain, client-legacy.p12 with -legacy (3DES/RC2).
+func TestWithTLSClientCertificatePKCS12(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	block, _ := pem.Decode(mustReadFile(t, filepath.Join("testdata", "tls", "client-ca.pem")))
+	require.NotNil(t, block)
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	srv := newMTLSServer(t, serverCA, &testCA{cert: caCert}, nil, nil, []net.IP{net.ParseIP("127.0.0.1")})
+
+	for _, file := range []string{"client.p12", "client-legacy.p12"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join("testdata", "tls", file)
+			client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(
+				WithClientCertificatePKCS12(path, "chroma"),
+				WithCACertificates(serverCA.certPEM),
+			))
+			require.NoError(t, err)
+			body, err := tlsGet(t, client)
+			require.NoError(t, err)
+			require.Equal(t, `"pkcs12-client"`, body)
+
+			client, err = newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(
+				WithClientCertificatePKCS12Data(mustReadFile(t, path), "chroma"),
+				WithCACertificates(serverCA.certPEM),
+			))
+			require.NoError(t, err)
+			_, err = tlsGet(t, client)
+			require.NoError(t, err)
+		})
+	}
+
+	cert, err := decodePKCS12Certificate(mustReadFile(t, filepath.Join("testdata", "tls", "client.p12")), "chroma")
+	require.NoError(t, err)
+	require.Len(t, cert.Certificate, 2, "the chain of the file is sent")
+
+	_, err = newBaseAPIClient(WithTLS(WithClientCertificatePKCS12(filepath.Join("testdata", "tls", "client.p12"), "wrong")))
+	require.ErrorContains(t, err, "error decoding PKCS#12 data")
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
+
+func TestWithTLSServerNameAndVersion(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	certPEM, keyPEM := clientCA.issue(t, "client", nil, nil, x509.ExtKeyUsageClientAuth)
+	srv := newMTLSServer(t, serverCA, clientCA, func(cfg *tls.Config) {
+		cfg.MaxVersion = tls.VersionTLS12
+	}, []string{"chroma.internal"}, nil)
+
+	base := []TLSOption{WithClientCertificatePEM(certPEM, keyPEM), WithCACertificates(serverCA.certPEM)}
+
+	client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(base...))
+	require.NoError(t, err)
+	_, err = tlsGet(t, client)
+	require.Error(t, err, "certificate is not valid for 127.0.0.1")
+
+	client, err = newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(append(base, WithServerName("chroma.internal"))...))
+	require.NoError(t, err)
+	_, err = tlsGet(t, client)
+	require.NoError(t, err)
+
+	client, err = newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(append(base, WithServerName("chroma.internal"), WithMinTLSVersion(tls.VersionTLS13))...))
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), client.httpTransport.TLSClientConfig.MinVersion)
+	_, err = tlsGet(t, client)
+	require.Error(t, err, "server only supports TLS 1.2")
+
+	_, err = newBaseAPIClient(WithTLS(WithMinTLSVersion(0x0999)))
+	require.Error(t, err)
+}
+
+func TestWithTLSPinning(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	certPEM, keyPEM := clientCA.issue(t, "client", nil, nil, x509.ExtKeyUsageClientAuth)
+	srv := newMTLSServer(t, serverCA, clientCA, nil, nil, []net.IP{net.ParseIP("127.0.0.1")})
+	base := []TLSOption{WithClientCertificatePEM(certPEM, keyPEM), WithCACertificates(serverCA.certPEM)}
+
+	caHash := sha256.Sum256(serverCA.cert.RawSubjectPublicKeyInfo)
+	for name, pin := range map[string]string{
+		"base64": CertificatePin(serverCA.cert),
+		"hex":    hex.EncodeToString(caHash[:]),
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(append(base, WithPinnedCertificates(pin))...))
+			require.NoError(t, err)
+			_, err = tlsGet(t, client)
+			require.NoError(t, err)
+		})
+	}
+
+	client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(append(base, WithPinnedCertificates(CertificatePin(clientCA.cert)))...))
+	require.NoError(t, err)
+	_, err = tlsGet(t, client)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pinned")
+
+	_, err = newBaseAPIClient(WithTLS(WithPinnedCertificates("sha256/not-a-hash")))
+	require.Error(t, err)
+}
+
+func TestWithTLSCertificateReload(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	otherCA := newTestCA(t, "other-ca")
+	srv := newMTLSServer(t, serverCA, clientCA, nil, nil, []net.IP{net.ParseIP("127.0.0.1")})
+
+	dir := t.TempDir()
+	caDir := filepath.Join(dir, "ca")
+	require.NoError(t, os.Mkdir(caDir, 0o700))
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certPEM, keyPEM := clientCA.issue(t, "client-1", nil, nil, x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, certFile, certPEM)
+	writeTestFile(t, keyFile, keyPEM)
+	// the CA directory starts with the wrong CA
+	writeTestFile(t, filepath.Join(caDir, "ca.crt"), otherCA.certPEM)
+	writeTestFile(t, filepath.Join(caDir, "README"), []byte("ignored"))
+
+	client, err := newBaseAPIClient(WithBaseURL(srv.URL), WithTLS(
+		WithClientCertificate(certFile, keyFile),
+		WithCACertificateDir(caDir),
+		WithCertificateReload(10*time.Millisecond),
+	))
+	require.NoError(t, err)
+	_, err = tlsGet(t, client)
+	require.Error(t, err)
+
+	writeTestFile(t, filepath.Join(caDir, "server-ca.pem"), serverCA.certPEM)
+	time.Sleep(20 * time.Millisecond)
+	body, err := tlsGet(t, client)
+	require.NoError(t, err)
+	require.Equal(t, `"client-1"`, body)
+
+	// a half-written rotation keeps the previous certificate
+	certPEM, keyPEM = clientCA.issue(t, "client-2", nil, nil, x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, certFile, certPEM)
+	time.Sleep(20 * time.Millisecond)
+	body, err = tlsGet(t, client)
+	require.NoError(t, err)
+	require.Equal(t, `"client-1"`, body)
+
+	writeTestFile(t, keyFile, keyPEM)
+	time.Sleep(20 * time.Millisecond)
+	body, err = tlsGet(t, client)
+	require.NoError(t, err)
+	require.Equal(t, `"client-2"`, body)
+}
+
+func TestWithTLSCertificateReloadVerifiesIPHost(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	// the server is dialed by IP but its certificate is only valid for another host
+	srv := newMTLSServer(t, serverCA, clientCA, nil, []string{"other.internal"}, nil)
+
+	dir := t.TempDir()
+	certPEM, keyPEM := clientCA.issue(t, "client-1", nil, nil, x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, filepath.Join(dir, "ca.pem"), serverCA.certPEM)
+	newClient := func(opts ...TLSOption) *BaseAPIClient {
+		opts = append(opts,
+			WithClientCertificatePEM(certPEM, keyPEM),
+			WithCACertificateDir(dir),
+			WithCertificateReload(10*time.Millisecond),
+		)
+		// WithTLS comes first, the host is taken from the later base URL
+		client, err := newBaseAPIClient(WithTLS(opts...), WithBaseURL(srv.URL))
+		require.NoError(t, err)
+		return client
+	}
+
+	_, err := tlsGet(t, newClient())
+	require.ErrorContains(t, err, "127.0.0.1")
+
+	body, err := tlsGet(t, newClient(WithServerName("other.internal")))
+	require.NoError(t, err)
+	require.Equal(t, `"client-1"`, body)
+}
+
+func TestWithTLSOptionErrors(t *testing.T) {
+	_, err := newBaseAPIClient(WithTLS(WithClientCertificate("missing.crt", "missing.key")))
+	require.Error(t, err)
+
+	_, err = newBaseAPIClient(WithTLS(WithClientCertificatePKCS12Data([]byte("not pkcs12"), "secret")))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "PKCS#12")
+
+	_, err = newBaseAPIClient(WithTLS(
+		WithClientCertificatePEM([]byte("a"), []byte("b")),
+		WithClientCertificatePKCS12("client.p12", ""),
+	))
+	require.Error(t, err)
+
+	_, err = newBaseAPIClient(WithTLS(WithCACertificateDir(t.TempDir())))
+	require.Error(t, err, "directory without certificates")
+
+	_, err = newBaseAPIClient(WithHTTPClient(&http.Client{}), WithTLS(WithServerName("chroma")))
+	require.Error(t, err)
+}
+
+func TestWithTransportIsUsed(t *testing.T) {
+	transport := &http.Transport{}
+	client, err := newBaseAPIClient(WithTransport(transport))
+	require.NoError(t, err)
+	require.Same(t, transport, client.HTTPClient().Transport)
+
+	custom := &http.Client{Timeout: time.Second}
+	client, err = newBaseAPIClient(WithHTTPClient(custom), WithTimeout(time.Minute))
+	require.NoError(t, err)
+	require.Same(t, custom, client.HTTPClient())
+	require.Equal(t, time.Second, custom.Timeout, "a custom client is not modified")
+}
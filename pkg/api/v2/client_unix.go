@@ -0,0 +1,63 @@
+package v2
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// unixSocketScheme prefixes base URLs of servers listening on a Unix domain socket, e.g. unix:///run/chroma.sock.
+	unixSocketScheme = "unix://"
+	// unixSocketBaseURL is the HTTP base URL of requests sent over a Unix domain socket. The host only fills
+	// the Host header; connections always go to the socket.
+	unixSocketBaseURL = "http://localhost"
+)
+
+// parseUnixSocketURL returns the socket path of a unix:// base URL. The whole path after the scheme is the
+// socket path; the API path is always /api/v2.
+func parseUnixSocketURL(baseURL string) (string, bool, error) {
+	if !strings.HasPrefix(strings.ToLower(baseURL), unixSocketScheme) {
+		return "", false, nil
+	}
+	socketPath := baseURL[len(unixSocketScheme):]
+	if socketPath == "" {
+		return "", true, errors.Errorf("invalid base URL %q: missing socket path, use unix:///path/to/chroma.sock", baseURL)
+	}
+	if strings.ContainsAny(socketPath, "?#") {
+		return "", true, errors.Errorf("invalid base URL %q: query and fragment are not supported for unix sockets", baseURL)
+	}
+	return socketPath, true, nil
+}
+
+// applyUnixSocket routes the requests of the client to its Unix domain socket. The transport is copied so
+// a transport passed with WithTransport is not modified; clients passed with WithHTTPClient must dial the
+// socket themselves.
+func (bc *BaseAPIClient) applyUnixSocket() error {
+	if bc.unixSocketPath == "" {
+		return nil
+	}
+	if bc.usesHTTPClient {
+		return errors.New("unix:// base URLs cannot be combined with WithHTTPClient, dial the socket from the client's transport instead")
+	}
+	if bc.endpoints != nil {
+		return errors.New("unix:// base URLs cannot be combined with WithEndpoints")
+	}
+	transport := &http.Transport{}
+	if bc.httpTransport != nil {
+		transport = bc.httpTransport.Clone()
+	}
+	// Requests must reach the socket, never an HTTP proxy from the environment.
+	transport.Proxy = nil
+	socketPath := bc.unixSocketPath
+	dialer := &net.Dialer{}
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socketPath)
+	}
+	bc.httpTransport = transport
+	bc.httpClient.Transport = transport
+	return nil
+}
@@ -0,0 +1,100 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newUnixSocketServer serves handler on a Unix domain socket only accessible to its owner.
+func newUnixSocketServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket permissions are not enforced on windows")
+	}
+	// t.TempDir paths can exceed the socket path limit of ~104 bytes
+	dir, err := os.MkdirTemp("", "chroma-sock")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "chroma.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Chmod(socketPath, 0o600))
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = listener
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return socketPath
+}
+
+func TestClientUnixSocketBaseURL(t *testing.T) {
+	var paths []string
+	socketPath := newUnixSocketServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		_, _ = w.Write([]byte(`{"nanosecond heartbeat": 1}`))
+	}))
+	t.Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+
+	c, err := NewHTTPClient(WithBaseURL("unix://" + socketPath))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	require.Equal(t, "http://localhost/api/v2", c.(*APIClientV2).BaseURL())
+	require.NoError(t, c.Heartbeat(context.Background()))
+	require.Equal(t, []string{"/api/v2/heartbeat"}, paths)
+}
+
+func TestClientUnixSocketKeepsTransportOptions(t *testing.T) {
+	socketPath := newUnixSocketServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"nanosecond heartbeat": 1}`))
+	}))
+	transport := &http.Transport{MaxIdleConns: 3}
+
+	c, err := NewHTTPClient(WithTransport(transport), WithBaseURL("unix://"+socketPath))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	require.NoError(t, c.Heartbeat(context.Background()))
+	require.Nil(t, transport.DialContext, "transport passed with WithTransport must not be modified")
+	used := c.(*APIClientV2).httpTransport
+	require.Equal(t, 3, used.MaxIdleConns)
+	require.NotNil(t, used.DialContext)
+}
+
+func TestClientUnixSocketBaseURLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []ClientOption
+		err     string
+	}{
+		{name: "missing path", options: []ClientOption{WithBaseURL("unix://")}, err: "missing socket path"},
+		{name: "query", options: []ClientOption{WithBaseURL("unix:///tmp/chroma.sock?x=1")}, err: "query and fragment"},
+		{name: "http client", options: []ClientOption{WithHTTPClient(&http.Client{}), WithBaseURL("unix:///tmp/chroma.sock")}, err: "cannot be combined with WithHTTPClient"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHTTPClient(tt.options...)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestClientBaseURLOverridesUnixSocket(t *testing.T) {
+	c, err := NewHTTPClient(WithBaseURL("unix:///tmp/chroma.sock"), WithBaseURL("http://example.com:8000"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	require.Equal(t, "http://example.com:8000/api/v2", c.(*APIClientV2).BaseURL())
+	require.Empty(t, c.(*APIClientV2).unixSocketPath)
+}
@@ -127,3 +127,15 @@ func logComparableCollectionMapMarshalErrorToStderr(err error) {
 		err,
 	)
 }
+
+func logEFMismatchToStderr(collectionName string, err error) {
+	if err == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(
+		os.Stderr,
+		"chroma-go: embedding function does not match the collection: collection=%s error=%v\n",
+		collectionName,
+		err,
+	)
+}
@@ -147,7 +147,8 @@ type Collection interface {
 	ModifyMetadata(ctx context.Context, newMetadata CollectionMetadata) error
 
 	// ModifyConfiguration updates the collection's configuration.
-	// Note: Not all configuration changes may be supported.
+	// Note: Not all configuration changes may be supported. Embedded local mode
+	// returns an error, as the local runtime cannot persist configuration updates.
 	ModifyConfiguration(ctx context.Context, newConfig *UpdateCollectionConfiguration) error
 
 	// Get retrieves documents from the collection by ID or filter.
@@ -170,6 +171,20 @@ type Collection interface {
 	//	)
 	Get(ctx context.Context, opts ...CollectionGetOption) (GetResult, error)
 
+	// GetStream calls fn for each record matching the options, for exports of
+	// collections too large to hold in memory.
+	//
+	// Records are fetched in pages of [DefaultGetStreamPageSize], see
+	// [WithGetStreamPageSize]; only one page is held in memory at a time.
+	// [WithLimit] and [WithOffset] bound the streamed records. Pages are fetched
+	// by offset, so records added or deleted during the stream may be missed or
+	// seen twice. An error returned by fn stops the stream and is returned.
+	//
+	//	err := collection.GetStream(ctx, func(row ResultRow) error {
+	//	    return encoder.Encode(row)
+	//	}, WithInclude(IncludeDocuments, IncludeMetadatas, IncludeEmbeddings))
+	GetStream(ctx context.Context, fn func(row ResultRow) error, opts ...CollectionGetOption) error
+
 	// Query performs semantic search using text or embeddings.
 	//
 	// Finds documents most similar to the query. Use [WithQueryTexts] for text
@@ -204,9 +219,24 @@ type Collection interface {
 	//	)
 	Search(ctx context.Context, opts ...SearchCollectionOption) (SearchResult, error)
 
+	// QueryMMR performs a [Collection.Query] and diversifies the results with
+	// Maximal Marginal Relevance (MMR).
+	//
+	// For each query, FetchK candidates (default 4*NResults) are fetched with their
+	// embeddings, and NResults of them are selected, trading relevance against
+	// similarity to the already selected results. Similarity is computed with the
+	// collection's distance metric. Tune the selection with [WithMMR].
+	//
+	//	results, _ := collection.QueryMMR(ctx,
+	//	    WithQueryTexts("machine learning"),
+	//	    WithNResults(5),
+	//	    WithMMR(WithMMRLambda(0.5), WithMMRFetchK(25)),
+	//	)
+	QueryMMR(ctx context.Context, opts ...CollectionQueryOption) (QueryResult, error)
+
 	// Fork creates a copy of this collection with a new name.
 	// The new collection contains all documents from the original.
-	// Requires Chroma Cloud; embedded local mode returns an error.
+	// Requires Chroma Cloud or a local runtime whose backend supports forking.
 	Fork(ctx context.Context, newName string) (Collection, error)
 
 	// ForkCount returns the total number of forks in this collection's lineage.
@@ -372,6 +402,8 @@ type CollectionGetOp struct {
 	LimitAndOffsetOp  // Pagination
 	SortOp            // Ordering (not yet supported)
 	ResourceOperation `json:"-"`
+	// StreamPageSize is the page size of [Collection.GetStream]
+	StreamPageSize int `json:"-"`
 }
 
 // NewCollectionGetOp creates a new Get operation with the given options.
@@ -483,6 +515,8 @@ type CollectionQueryOp struct {
 	LimitResultOp      // Number of results per query
 	ProjectOp          // Field projection (Include)
 	FilterIDOp         // Limit search to specific IDs
+	// MMR enables Maximal Marginal Relevance re-selection, see [WithMMR].
+	MMR *MMROptions `json:"-"`
 }
 
 // NewCollectionQueryOp creates a new Query operation with the given options.
@@ -624,6 +658,9 @@ type CollectionAddOp struct {
 
 	// IDGenerator automatically generates IDs if Ids is empty.
 	IDGenerator IDGenerator `json:"-"`
+
+	// Chunking splits documents into chunks before embedding. See [WithChunking].
+	Chunking *ChunkingOptions `json:"-"`
 }
 
 // NewCollectionAddOp creates a new Add operation with the given options.
@@ -756,6 +793,12 @@ func (c *CollectionAddOp) PrepareAndValidate() error {
 		}
 	}
 
+	if c.Chunking != nil {
+		if err := c.chunkDocuments(); err != nil {
+			return err
+		}
+	}
+
 	if len(c.Metadatas) > 0 {
 		if err := validateDocumentMetadatas(c.Metadatas); err != nil {
 			return err
@@ -93,6 +93,14 @@ func (c *CollectionImpl) Schema() *Schema {
 	return c.schema
 }
 
+func (c *CollectionImpl) writeConstraints() WriteConstraints {
+	return WriteConstraints{
+		Dimension:                  c.dimension,
+		EmbeddingFunctionDimension: embeddingFunctionDimension(c.embeddingFunction),
+		Schema:                     c.schema,
+	}
+}
+
 func (c *CollectionImpl) Add(ctx context.Context, opts ...CollectionAddOption) error {
 	err := c.client.PreFlight(ctx)
 	if err != nil {
@@ -110,29 +118,18 @@ func (c *CollectionImpl) Add(ctx context.Context, opts ...CollectionAddOption) e
 	if err != nil {
 		return errors.Wrap(err, "failed to satisfy collection update operation")
 	}
+	constraints := c.writeConstraints()
+	if err = addObject.ValidateRecords(constraints); err != nil {
+		return err
+	}
 	err = addObject.EmbedData(ctx, c.embeddingFunction)
 	if err != nil {
 		return errors.Wrap(err, "failed to embed data")
 	}
-	if sbe, ok := c.client.getPreFlightConditionsRaw()["supports_base64_encoding"]; ok {
-		if supportsBase64, ok := sbe.(bool); ok && supportsBase64 {
-			packedEmbeddings := make([]any, 0)
-			for _, e := range addObject.Embeddings {
-				f32Emb, ok := e.(*embeddings.Float32Embedding)
-				if !ok {
-					// Fallback to JSON encoding for non-Float32 embeddings
-					if c.client.logger.IsDebugEnabled() {
-						c.client.logger.Debug("base64 encoding not supported for embedding type, falling back to JSON")
-					}
-					packedEmbeddings = append(packedEmbeddings, e)
-					continue
-				}
-				packedE := packEmbeddingSafely(f32Emb.ContentAsFloat32())
-				packedEmbeddings = append(packedEmbeddings, packedE)
-			}
-			addObject.Embeddings = packedEmbeddings
-		}
+	if err = addObject.ValidateRecords(constraints); err != nil {
+		return err
 	}
+	addObject.Embeddings = c.client.packEmbeddings(addObject.Embeddings)
 	reqURL, err := url.JoinPath("tenants", c.Tenant().Name(), "databases", c.Database().Name(), "collections", c.ID(), "add")
 	if err != nil {
 		return errors.Wrap(err, "error composing request URL")
@@ -161,34 +158,23 @@ func (c *CollectionImpl) Upsert(ctx context.Context, opts ...CollectionAddOption
 	if err != nil {
 		return err
 	}
+	constraints := c.writeConstraints()
+	if err = upsertObject.ValidateRecords(constraints); err != nil {
+		return err
+	}
 	err = upsertObject.EmbedData(ctx, c.embeddingFunction)
 	if err != nil {
 		return errors.Wrap(err, "failed to embed data")
 	}
-	if sbe, ok := c.client.getPreFlightConditionsRaw()["supports_base64_encoding"]; ok {
-		if supportsBase64, ok := sbe.(bool); ok && supportsBase64 {
-			packedEmbeddings := make([]any, 0)
-			for _, e := range upsertObject.Embeddings {
-				f32Emb, ok := e.(*embeddings.Float32Embedding)
-				if !ok {
-					// Fallback to JSON encoding for non-Float32 embeddings
-					if c.client.logger.IsDebugEnabled() {
-						c.client.logger.Debug("base64 encoding not supported for embedding type, falling back to JSON")
-					}
-					packedEmbeddings = append(packedEmbeddings, e)
-					continue
-				}
-				packedE := packEmbeddingSafely(f32Emb.ContentAsFloat32())
-				packedEmbeddings = append(packedEmbeddings, packedE)
-			}
-			upsertObject.Embeddings = packedEmbeddings
-		}
+	if err = upsertObject.ValidateRecords(constraints); err != nil {
+		return err
 	}
+	upsertObject.Embeddings = c.client.packEmbeddings(upsertObject.Embeddings)
 	reqURL, err := url.JoinPath("tenants", c.Tenant().Name(), "databases", c.Database().Name(), "collections", c.ID(), "upsert")
 	if err != nil {
 		return err
 	}
-	_, err = c.client.ExecuteRequest(ctx, http.MethodPost, reqURL, upsertObject)
+	_, err = c.client.ExecuteRequest(withIdempotentRequest(ctx), http.MethodPost, reqURL, upsertObject)
 	if err != nil {
 		return err
 	}
@@ -211,29 +197,18 @@ func (c *CollectionImpl) Update(ctx context.Context, opts ...CollectionUpdateOpt
 	if err != nil {
 		return err
 	}
+	constraints := c.writeConstraints()
+	if err = updateObject.ValidateRecords(constraints); err != nil {
+		return err
+	}
 	err = updateObject.EmbedData(ctx, c.embeddingFunction)
 	if err != nil {
 		return errors.Wrap(err, "failed to embed data")
 	}
-	if sbe, ok := c.client.getPreFlightConditionsRaw()["supports_base64_encoding"]; ok {
-		if supportsBase64, ok := sbe.(bool); ok && supportsBase64 {
-			packedEmbeddings := make([]any, 0)
-			for _, e := range updateObject.Embeddings {
-				f32Emb, ok := e.(*embeddings.Float32Embedding)
-				if !ok {
-					// Fallback to JSON encoding for non-Float32 embeddings
-					if c.client.logger.IsDebugEnabled() {
-						c.client.logger.Debug("base64 encoding not supported for embedding type, falling back to JSON")
-					}
-					packedEmbeddings = append(packedEmbeddings, e)
-					continue
-				}
-				packedE := packEmbeddingSafely(f32Emb.ContentAsFloat32())
-				packedEmbeddings = append(packedEmbeddings, packedE)
-			}
-			updateObject.Embeddings = packedEmbeddings
-		}
+	if err = updateObject.ValidateRecords(constraints); err != nil {
+		return err
 	}
+	updateObject.Embeddings = c.client.packEmbeddings(updateObject.Embeddings)
 	reqURL, err := url.JoinPath("tenants", c.Tenant().Name(), "databases", c.Database().Name(), "collections", c.ID(), "update")
 	if err != nil {
 		return err
@@ -325,22 +300,30 @@ func (c *CollectionImpl) Get(ctx context.Context, opts ...CollectionGetOption) (
 	if err != nil {
 		return nil, err
 	}
-	respBody, err := c.client.ExecuteRequest(ctx, http.MethodPost, reqURL, getObject)
+	respBody, err := c.client.executeRead(ctx, OperationGet, reqURL, getObject)
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting collection")
 	}
-	getResult := &GetResultImpl{}
-	err = json.Unmarshal(respBody, getResult)
+	defer func() { _ = respBody.Close() }()
+	getResult, err := decodeGetResult(respBody)
 	if err != nil {
 		return nil, errors.Wrap(err, "error unmarshalling get result")
 	}
 	return getResult, nil
 }
+
+func (c *CollectionImpl) GetStream(ctx context.Context, fn func(row ResultRow) error, opts ...CollectionGetOption) error {
+	return streamGetRows(ctx, c.Get, fn, opts...)
+}
+
 func (c *CollectionImpl) Query(ctx context.Context, opts ...CollectionQueryOption) (QueryResult, error) {
 	querybject, err := NewCollectionQueryOp(opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating new collection query operation")
 	}
+	if querybject.MMR != nil {
+		return queryMMR(ctx, c, querybject, opts)
+	}
 	err = querybject.PrepareAndValidate()
 	if err != nil {
 		return nil, errors.Wrap(err, "error validating query object")
@@ -353,18 +336,22 @@ func (c *CollectionImpl) Query(ctx context.Context, opts ...CollectionQueryOptio
 	if err != nil {
 		return nil, errors.Wrap(err, "error building query url")
 	}
-	respBody, err := c.client.ExecuteRequest(ctx, http.MethodPost, reqURL, querybject)
+	respBody, err := c.client.executeRead(ctx, OperationQuery, reqURL, querybject)
 	if err != nil {
 		return nil, errors.Wrap(err, "error sending query request")
 	}
-	queryResult := &QueryResultImpl{}
-	err = json.Unmarshal(respBody, queryResult)
+	defer func() { _ = respBody.Close() }()
+	queryResult, err := decodeQueryResult(respBody)
 	if err != nil {
 		return nil, errors.Wrap(err, "error unmarshalling query result")
 	}
 	return queryResult, nil
 }
 
+func (c *CollectionImpl) QueryMMR(ctx context.Context, opts ...CollectionQueryOption) (QueryResult, error) {
+	return c.Query(ctx, append([]CollectionQueryOption{WithMMR()}, opts...)...)
+}
+
 func (c *CollectionImpl) ModifyConfiguration(ctx context.Context, newConfig *UpdateCollectionConfiguration) error {
 	if newConfig == nil {
 		return errors.New("newConfig cannot be nil")
@@ -443,13 +430,14 @@ func (c *CollectionImpl) Search(ctx context.Context, opts ...SearchCollectionOpt
 		return nil, errors.Wrap(err, "error composing request URL")
 	}
 
-	respBody, err := c.client.ExecuteRequest(ctx, http.MethodPost, reqURL, sq)
+	respBody, err := c.client.executeRead(ctx, OperationSearch, reqURL, sq)
 	if err != nil {
 		return nil, errors.Wrap(err, "error sending search request")
 	}
+	defer func() { _ = respBody.Close() }()
 
 	var result SearchResultImpl
-	if err := json.Unmarshal(respBody, &result); err != nil {
+	if err := json.NewDecoder(respBody).Decode(&result); err != nil {
 		return nil, errors.Wrap(err, "error unmarshalling search result")
 	}
 
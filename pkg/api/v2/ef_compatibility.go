@@ -0,0 +1,160 @@
+package v2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// EFCompatibilityMode controls what GetCollection does when the embedding function
+// passed with [WithEmbeddingFunctionGet] or [WithContentEmbeddingFunctionGet] does not
+// match the embedding function the collection was created with.
+type EFCompatibilityMode int
+
+const (
+	// EFCompatibilityWarn logs a warning and uses the supplied embedding function. This is the default.
+	EFCompatibilityWarn EFCompatibilityMode = iota
+	// EFCompatibilityStrict fails GetCollection with an [*EmbeddingFunctionMismatchError].
+	EFCompatibilityStrict
+	// EFCompatibilityOverride uses the supplied embedding function without checking it,
+	// e.g. when migrating a collection to a new embedding function.
+	EFCompatibilityOverride
+)
+
+// WithEFCompatibilityGet sets how an embedding function that does not match the
+// collection's persisted embedding function is handled. See [EFCompatibilityMode].
+func WithEFCompatibilityGet(mode EFCompatibilityMode) GetCollectionOption {
+	return func(op *GetCollectionOp) error {
+		switch mode {
+		case EFCompatibilityWarn, EFCompatibilityStrict, EFCompatibilityOverride:
+			op.efCompatibility = mode
+			return nil
+		default:
+			return errors.Errorf("invalid embedding function compatibility mode %d", mode)
+		}
+	}
+}
+
+// EmbeddingFunctionMismatchError describes how an embedding function differs from
+// the embedding function a collection was created with.
+type EmbeddingFunctionMismatchError struct {
+	Collection string
+	// Mismatches holds one description per differing property, e.g. the model.
+	Mismatches []string
+}
+
+// Error implements error.
+func (e *EmbeddingFunctionMismatchError) Error() string {
+	return fmt.Sprintf("embedding function is not compatible with collection %q: %s", e.Collection, strings.Join(e.Mismatches, "; "))
+}
+
+// CheckEmbeddingFunctionCompatibility compares ef with the embedding function persisted
+// in the collection configuration or schema: its name, model and dimensions, the
+// collection dimension and the distance metric of the collection's vector index.
+// It returns an [*EmbeddingFunctionMismatchError] listing the differences, or nil.
+// Properties that are not known on both sides are not compared.
+func CheckEmbeddingFunctionCompatibility(ef embeddings.EmbeddingFunction, c Collection) error {
+	if isNilInterface(c) {
+		return nil
+	}
+	var configuration *CollectionConfigurationImpl
+	if cfg, ok := c.Configuration().(*CollectionConfigurationImpl); ok {
+		configuration = cfg
+	}
+	return checkEFCompatibility(ef, c.Name(), configuration, c.Schema(), c.Metadata(), c.Dimension())
+}
+
+func checkEFCompatibility(ef embeddings.EmbeddingFunction, collection string, configuration *CollectionConfigurationImpl, schema *Schema, metadata CollectionMetadata, dimension int) error {
+	if isNilInterface(ef) {
+		return nil
+	}
+	var mismatches []string
+	supplied := embeddingFunctionDimension(ef)
+	if name, persisted, ok := persistedEFInfo(configuration, schema); ok {
+		if name != "" && ef.Name() != "" && name != ef.Name() {
+			mismatches = append(mismatches, fmt.Sprintf("provider %q, collection uses %q", ef.Name(), name))
+		}
+		efConfig := ef.GetConfig()
+		for _, key := range []string{"model_name", "model"} {
+			supplied, ok1 := efConfig[key].(string)
+			stored, ok2 := persisted[key].(string)
+			if ok1 && ok2 && supplied != stored {
+				mismatches = append(mismatches, fmt.Sprintf("model %q, collection uses %q", supplied, stored))
+				break
+			}
+		}
+		if stored := configDimension(persisted); supplied > 0 && stored > 0 && supplied != stored {
+			mismatches = append(mismatches, fmt.Sprintf("%d dimensions, collection embedding function uses %d", supplied, stored))
+		}
+	}
+	if supplied > 0 && dimension > 0 && supplied != dimension {
+		mismatches = append(mismatches, fmt.Sprintf("%d dimensions, collection has dimension %d", supplied, dimension))
+	}
+	if metric, ok := persistedDistanceMetric(schema, configuration, metadata); ok && !supportsSpace(ef, metric) {
+		mismatches = append(mismatches, fmt.Sprintf("distance metric %q is not supported, default is %q", metric, ef.DefaultSpace()))
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	return &EmbeddingFunctionMismatchError{Collection: collection, Mismatches: mismatches}
+}
+
+// persistedEFInfo returns the name and configuration of the embedding function
+// stored in the collection configuration or, failing that, in the schema.
+func persistedEFInfo(configuration *CollectionConfigurationImpl, schema *Schema) (string, embeddings.EmbeddingFunctionConfig, bool) {
+	if configuration != nil {
+		if info, ok := configuration.GetEmbeddingFunctionInfo(); ok && info.IsKnown() {
+			return info.Name, info.Config, true
+		}
+	}
+	if ef := schema.GetEmbeddingFunction(); !isNilInterface(ef) {
+		return ef.Name(), ef.GetConfig(), true
+	}
+	return "", nil, false
+}
+
+func supportsSpace(ef embeddings.EmbeddingFunction, metric embeddings.DistanceMetric) bool {
+	if ef.DefaultSpace() == metric {
+		return true
+	}
+	for _, space := range ef.SupportedSpaces() {
+		if space == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// suppliedDenseEF returns the dense embedding function of the GetCollection options.
+func (op *GetCollectionOp) suppliedDenseEF() embeddings.EmbeddingFunction {
+	if op.embeddingFunction != nil {
+		return op.embeddingFunction
+	}
+	if unwrapper, ok := op.contentEmbeddingFunction.(embeddings.EmbeddingFunctionUnwrapper); ok {
+		return unwrapper.UnwrapEmbeddingFunction()
+	}
+	if dense, ok := op.contentEmbeddingFunction.(embeddings.EmbeddingFunction); ok {
+		return dense
+	}
+	return nil
+}
+
+// checkEmbeddingFunction applies the compatibility mode to the supplied embedding function.
+// Mismatches are passed to warn in EFCompatibilityWarn mode and returned in EFCompatibilityStrict mode.
+func (op *GetCollectionOp) checkEmbeddingFunction(collection string, configuration *CollectionConfigurationImpl, schema *Schema, metadata CollectionMetadata, dimension int, warn func(err error)) error {
+	if op.efCompatibility == EFCompatibilityOverride {
+		return nil
+	}
+	err := checkEFCompatibility(op.suppliedDenseEF(), collection, configuration, schema, metadata, dimension)
+	if err == nil {
+		return nil
+	}
+	if op.efCompatibility == EFCompatibilityStrict {
+		return err
+	}
+	warn(err)
+	return nil
+}
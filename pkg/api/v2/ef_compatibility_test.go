@@ -0,0 +1,90 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+func newEFCompatibilityServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":        "8ecf0f7e-e806-47f8-96a1-4732ef42359e",
+			"name":      "docs",
+			"tenant":    DefaultTenant,
+			"database":  DefaultDatabase,
+			"dimension": 1536,
+			"configuration_json": map[string]any{
+				"hnsw": map[string]any{"space": "ip"},
+				"embedding_function": map[string]any{
+					"type":   "known",
+					"name":   "mock_provider",
+					"config": map[string]any{"model_name": "small", "dimensions": 1536},
+				},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetCollectionEFCompatibility(t *testing.T) {
+	srv := newEFCompatibilityServer(t)
+	log := &capturingLogger{}
+	client, err := NewHTTPClient(WithBaseURL(srv.URL), WithLogger(log))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	mismatched := &mockEmbeddingFunction{name: "other_provider", config: embeddings.EmbeddingFunctionConfig{"model_name": "large", "dimensions": 768}}
+
+	_, err = client.GetCollection(context.Background(), "docs", WithEmbeddingFunctionGet(mismatched))
+	require.NoError(t, err)
+	require.Equal(t, 1, log.warnCount)
+	require.Equal(t, "embedding function does not match the collection", log.lastMsg)
+
+	_, err = client.GetCollection(context.Background(), "docs", WithEmbeddingFunctionGet(mismatched), WithEFCompatibilityGet(EFCompatibilityStrict))
+	var mismatchErr *EmbeddingFunctionMismatchError
+	require.True(t, errors.As(err, &mismatchErr), "%v", err)
+	require.Equal(t, "docs", mismatchErr.Collection)
+	require.Equal(t, []string{
+		`provider "other_provider", collection uses "mock_provider"`,
+		`model "large", collection uses "small"`,
+		"768 dimensions, collection embedding function uses 1536",
+		"768 dimensions, collection has dimension 1536",
+		`distance metric "ip" is not supported, default is "l2"`,
+	}, mismatchErr.Mismatches)
+
+	_, err = client.GetCollection(context.Background(), "docs", WithEmbeddingFunctionGet(mismatched), WithEFCompatibilityGet(EFCompatibilityOverride))
+	require.NoError(t, err)
+	require.Equal(t, 1, log.warnCount)
+
+	_, err = client.GetCollection(context.Background(), "docs", WithEFCompatibilityGet(EFCompatibilityMode(42)))
+	require.Error(t, err)
+}
+
+func TestCheckEmbeddingFunctionCompatibility(t *testing.T) {
+	configuration := NewCollectionConfiguration()
+	configuration.SetEmbeddingFunction(&mockEmbeddingFunction{name: "mock_provider", config: embeddings.EmbeddingFunctionConfig{"model_name": "small"}})
+	col := &CollectionImpl{name: "docs", configuration: configuration, dimension: 3}
+
+	compatible := &mockEmbeddingFunction{name: "mock_provider", config: embeddings.EmbeddingFunctionConfig{"model_name": "small", "dimensions": 3}}
+	require.NoError(t, CheckEmbeddingFunctionCompatibility(compatible, col))
+
+	// properties only known on one side are not compared
+	unknown := &mockEmbeddingFunction{name: "mock_provider", config: embeddings.EmbeddingFunctionConfig{}}
+	require.NoError(t, CheckEmbeddingFunctionCompatibility(unknown, col))
+
+	other := &mockEmbeddingFunction{name: "mock_provider", config: embeddings.EmbeddingFunctionConfig{"model_name": "large"}}
+	err := CheckEmbeddingFunctionCompatibility(other, col)
+	require.EqualError(t, err, `embedding function is not compatible with collection "docs": model "large", collection uses "small"`)
+}
@@ -0,0 +1,471 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+const (
+	// DefaultMigrationBatchSize is the number of records read, embedded and written at a time.
+	DefaultMigrationBatchSize = 100
+	// DefaultMigrationMaxRetries is the number of times a failed embedding request is retried.
+	DefaultMigrationMaxRetries = 3
+	// DefaultMigrationRetryBackoff is the wait before the first retry, doubled for every further retry.
+	DefaultMigrationRetryBackoff = time.Second
+)
+
+// ErrMigrationCountMismatch is returned when the target collection does not hold
+// the expected number of records once a migration completed.
+var ErrMigrationCountMismatch = errors.New("migrated record count does not match")
+
+// MigrationCheckpoint records the progress of a migration. It is saved after
+// every batch written to the target collection.
+type MigrationCheckpoint struct {
+	// SourceID is the ID of the source collection.
+	SourceID string `json:"source_id"`
+	// Target is the name of the target collection.
+	Target string `json:"target"`
+	// Offset is the number of source records processed.
+	Offset int `json:"offset"`
+	// Migrated is the number of records written to the target collection.
+	Migrated int `json:"migrated"`
+	// Skipped is the number of records without a document, which cannot be re-embedded.
+	Skipped   int       `json:"skipped"`
+	Completed bool      `json:"completed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MigrationCheckpointStore persists migration checkpoints so that an interrupted
+// migration can resume.
+type MigrationCheckpointStore interface {
+	// Load returns the saved checkpoint, or nil if there is none.
+	Load(ctx context.Context) (*MigrationCheckpoint, error)
+	Save(ctx context.Context, checkpoint MigrationCheckpoint) error
+}
+
+type fileCheckpointStore struct {
+	path string
+}
+
+// NewFileCheckpointStore returns a [MigrationCheckpointStore] keeping the checkpoint
+// as JSON in the file at path. The file is replaced atomically on every save.
+func NewFileCheckpointStore(path string) MigrationCheckpointStore {
+	return &fileCheckpointStore{path: path}
+}
+
+func (s *fileCheckpointStore) Load(_ context.Context) (*MigrationCheckpoint, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading migration checkpoint")
+	}
+	var checkpoint MigrationCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, errors.Wrapf(err, "error decoding migration checkpoint %s", s.path)
+	}
+	return &checkpoint, nil
+}
+
+func (s *fileCheckpointStore) Save(_ context.Context, checkpoint MigrationCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "error encoding migration checkpoint")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "error creating migration checkpoint")
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "error writing migration checkpoint")
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "error saving migration checkpoint")
+	}
+	return nil
+}
+
+// MigrationResult summarizes a completed migration.
+type MigrationResult struct {
+	// Target is the collection the records were written to.
+	Target Collection
+	// Migrated is the number of records written to the target, including earlier runs.
+	Migrated int
+	// Skipped is the number of records without a document.
+	Skipped     int
+	SourceCount int
+	TargetCount int
+}
+
+type migration struct {
+	embeddingFunction        embeddings.EmbeddingFunction
+	contentEmbeddingFunction embeddings.ContentEmbeddingFunction
+	batchSize                int
+	requestInterval          time.Duration
+	maxRetries               int
+	retryBackoff             time.Duration
+	checkpoints              MigrationCheckpointStore
+	progress                 func(MigrationCheckpoint)
+	createOptions            []CreateCollectionOption
+}
+
+// MigrationOption configures [MigrateCollection].
+type MigrationOption func(m *migration) error
+
+// WithMigrationEmbeddingFunction sets the embedding function the documents are re-embedded with.
+// It is also the embedding function of the target collection.
+func WithMigrationEmbeddingFunction(ef embeddings.EmbeddingFunction) MigrationOption {
+	return func(m *migration) error {
+		if ef == nil {
+			return errors.New("embedding function cannot be nil")
+		}
+		m.embeddingFunction = ef
+		return nil
+	}
+}
+
+// WithMigrationContentEmbeddingFunction re-embeds the documents as text content with ef.
+// It is also the content embedding function of the target collection.
+func WithMigrationContentEmbeddingFunction(ef embeddings.ContentEmbeddingFunction) MigrationOption {
+	return func(m *migration) error {
+		if ef == nil {
+			return errors.New("content embedding function cannot be nil")
+		}
+		m.contentEmbeddingFunction = ef
+		return nil
+	}
+}
+
+// WithMigrationBatchSize sets the number of records per embedding request and write.
+// Defaults to [DefaultMigrationBatchSize].
+func WithMigrationBatchSize(size int) MigrationOption {
+	return func(m *migration) error {
+		if size < 1 {
+			return errors.New("batch size must be >= 1")
+		}
+		m.batchSize = size
+		return nil
+	}
+}
+
+// WithMigrationRateLimit caps the embedding requests per second, e.g. to stay within
+// the rate limits of the embedding provider. Retries count against the limit.
+func WithMigrationRateLimit(requestsPerSecond float64) MigrationOption {
+	return func(m *migration) error {
+		if requestsPerSecond <= 0 {
+			return errors.New("rate limit must be > 0")
+		}
+		m.requestInterval = time.Duration(float64(time.Second) / requestsPerSecond)
+		return nil
+	}
+}
+
+// WithMigrationRetry sets how often a failed embedding request is retried and the
+// backoff before the first retry, which doubles for every further retry. Defaults to
+// [DefaultMigrationMaxRetries] and [DefaultMigrationRetryBackoff].
+func WithMigrationRetry(maxRetries int, backoff time.Duration) MigrationOption {
+	return func(m *migration) error {
+		if maxRetries < 0 {
+			return errors.New("max retries cannot be negative")
+		}
+		if backoff < 0 {
+			return errors.New("retry backoff cannot be negative")
+		}
+		m.maxRetries, m.retryBackoff = maxRetries, backoff
+		return nil
+	}
+}
+
+// WithMigrationCheckpoints saves the progress after every batch and resumes from the
+// saved checkpoint, see [NewFileCheckpointStore]. Resuming requires the source
+// collection not to be modified in between, as records are read by offset.
+func WithMigrationCheckpoints(store MigrationCheckpointStore) MigrationOption {
+	return func(m *migration) error {
+		if store == nil {
+			return errors.New("checkpoint store cannot be nil")
+		}
+		m.checkpoints = store
+		return nil
+	}
+}
+
+// WithMigrationProgress calls fn after every batch written to the target collection.
+func WithMigrationProgress(fn func(MigrationCheckpoint)) MigrationOption {
+	return func(m *migration) error {
+		if fn == nil {
+			return errors.New("progress callback cannot be nil")
+		}
+		m.progress = fn
+		return nil
+	}
+}
+
+// WithMigrationCreateOptions adds options for creating the target collection, applied
+// after the ones copied from the source collection.
+func WithMigrationCreateOptions(opts ...CreateCollectionOption) MigrationOption {
+	return func(m *migration) error {
+		m.createOptions = append(m.createOptions, opts...)
+		return nil
+	}
+}
+
+// MigrateCollection copies the records of source into the collection target,
+// re-embedding their documents with a new embedding function.
+//
+// The target collection is created, unless it exists, with the metadata and schema
+// (or distance metric) of source and the new embedding function. Records are read in
+// batches, embedded under the configured rate limit and retries, and upserted, so a
+// migration can be repeated or resumed from a checkpoint without duplicating records.
+// Records without a document cannot be re-embedded and are skipped.
+// Once all records are written, the record count of the target is compared with the
+// source; a difference is reported as [ErrMigrationCountMismatch].
+//
+//	result, err := MigrateCollection(ctx, client, source, "docs-v2",
+//	    WithMigrationEmbeddingFunction(openaiEF),
+//	    WithMigrationRateLimit(5),
+//	    WithMigrationCheckpoints(NewFileCheckpointStore("docs-v2.checkpoint.json")),
+//	)
+func MigrateCollection(ctx context.Context, client Client, source Collection, target string, opts ...MigrationOption) (*MigrationResult, error) {
+	if client == nil {
+		return nil, errors.New("client cannot be nil")
+	}
+	if isNilInterface(source) {
+		return nil, errors.New("source collection cannot be nil")
+	}
+	if target == "" {
+		return nil, errors.New("target collection name cannot be empty")
+	}
+	m := &migration{
+		batchSize:    DefaultMigrationBatchSize,
+		maxRetries:   DefaultMigrationMaxRetries,
+		retryBackoff: DefaultMigrationRetryBackoff,
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	if m.embeddingFunction == nil && m.contentEmbeddingFunction == nil {
+		return nil, errors.New("an embedding function or content embedding function is required")
+	}
+	createOpts, err := m.targetCreateOptions(source)
+	if err != nil {
+		return nil, err
+	}
+	targetCollection, err := client.CreateCollection(ctx, target, createOpts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating target collection %s", target)
+	}
+	return m.run(ctx, source, targetCollection)
+}
+
+// targetCreateOptions copies the metadata and index settings of source.
+func (m *migration) targetCreateOptions(source Collection) ([]CreateCollectionOption, error) {
+	opts := []CreateCollectionOption{WithIfNotExistsCreate()}
+	if md := source.Metadata(); !isNilInterface(md) && len(md.Keys()) > 0 {
+		opts = append(opts, WithCollectionMetadataCreate(md))
+	}
+	if schema := source.Schema(); schema != nil {
+		// the schema is copied, CreateCollection replaces its embedding function
+		data, err := json.Marshal(schema)
+		if err != nil {
+			return nil, errors.Wrap(err, "error copying source schema")
+		}
+		copied := &Schema{}
+		if err := json.Unmarshal(data, copied); err != nil {
+			return nil, errors.Wrap(err, "error copying source schema")
+		}
+		opts = append(opts, WithSchemaCreate(copied))
+	} else if metric, ok := persistedDistanceMetric(nil, source.Configuration(), source.Metadata()); ok {
+		opts = append(opts, WithHNSWSpaceCreate(metric))
+	}
+	if m.embeddingFunction != nil {
+		opts = append(opts, WithEmbeddingFunctionCreate(m.embeddingFunction))
+	}
+	if m.contentEmbeddingFunction != nil {
+		opts = append(opts, WithContentEmbeddingFunctionCreate(m.contentEmbeddingFunction))
+	}
+	return append(opts, m.createOptions...), nil
+}
+
+func (m *migration) run(ctx context.Context, source, target Collection) (*MigrationResult, error) {
+	checkpoint := MigrationCheckpoint{SourceID: source.ID(), Target: target.Name()}
+	if m.checkpoints != nil {
+		saved, err := m.checkpoints.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if saved != nil {
+			if saved.SourceID != checkpoint.SourceID || saved.Target != checkpoint.Target {
+				return nil, errors.Errorf("checkpoint is for migrating collection %s to %s, not %s to %s",
+					saved.SourceID, saved.Target, checkpoint.SourceID, checkpoint.Target)
+			}
+			checkpoint = *saved
+		}
+	}
+	var lastRequest time.Time
+	for !checkpoint.Completed {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := source.Get(ctx,
+			WithInclude(IncludeDocuments, IncludeMetadatas),
+			WithLimit(m.batchSize),
+			WithOffset(checkpoint.Offset),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading source records at offset %d", checkpoint.Offset)
+		}
+		rows, ok := page.(interface{ Rows() []ResultRow })
+		if !ok {
+			return nil, errors.Errorf("unsupported get result type %T", page)
+		}
+		batch := make([]ResultRow, 0, page.Count())
+		for _, row := range rows.Rows() {
+			if row.Document == "" {
+				checkpoint.Skipped++
+				continue
+			}
+			batch = append(batch, row)
+		}
+		if len(batch) > 0 {
+			embs, err := m.embed(ctx, batch, &lastRequest)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error embedding records at offset %d", checkpoint.Offset)
+			}
+			if err := upsertMigrated(ctx, target, batch, embs); err != nil {
+				return nil, errors.Wrapf(err, "error writing records at offset %d", checkpoint.Offset)
+			}
+		}
+		checkpoint.Offset += page.Count()
+		checkpoint.Migrated += len(batch)
+		checkpoint.Completed = page.Count() < m.batchSize
+		checkpoint.UpdatedAt = time.Now().UTC()
+		if m.checkpoints != nil {
+			if err := m.checkpoints.Save(ctx, checkpoint); err != nil {
+				return nil, err
+			}
+		}
+		if m.progress != nil {
+			m.progress(checkpoint)
+		}
+	}
+
+	result := &MigrationResult{Target: target, Migrated: checkpoint.Migrated, Skipped: checkpoint.Skipped}
+	var err error
+	if result.SourceCount, err = source.Count(ctx); err != nil {
+		return nil, errors.Wrap(err, "error counting source records")
+	}
+	if result.TargetCount, err = target.Count(ctx); err != nil {
+		return nil, errors.Wrap(err, "error counting target records")
+	}
+	if expected := result.SourceCount - result.Skipped; result.TargetCount != expected {
+		return result, errors.Wrapf(ErrMigrationCountMismatch, "target %s has %d records, expected %d",
+			target.Name(), result.TargetCount, expected)
+	}
+	return result, nil
+}
+
+// embed embeds the documents of rows, waiting for the rate limit and retrying failed requests.
+func (m *migration) embed(ctx context.Context, rows []ResultRow, lastRequest *time.Time) ([]embeddings.Embedding, error) {
+	backoff := m.retryBackoff
+	for attempt := 0; ; attempt++ {
+		if wait := m.requestInterval - time.Since(*lastRequest); wait > 0 {
+			if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+		*lastRequest = time.Now()
+		embs, err := m.embedOnce(ctx, rows)
+		if err == nil {
+			if len(embs) != len(rows) {
+				return nil, errors.Errorf("embedding function returned %d embeddings for %d documents", len(embs), len(rows))
+			}
+			return embs, nil
+		}
+		if attempt >= m.maxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+		if err := sleepContext(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+func (m *migration) embedOnce(ctx context.Context, rows []ResultRow) ([]embeddings.Embedding, error) {
+	if m.embeddingFunction != nil {
+		docs := make([]string, len(rows))
+		for i, row := range rows {
+			docs[i] = row.Document
+		}
+		return m.embeddingFunction.EmbedDocuments(ctx, docs)
+	}
+	contents := make([]embeddings.Content, len(rows))
+	for i, row := range rows {
+		contents[i] = embeddings.NewTextContent(row.Document)
+	}
+	return m.contentEmbeddingFunction.EmbedContents(ctx, contents)
+}
+
+// upsertMigrated writes rows with their new embeddings. Records with and without
+// metadata are written separately as metadatas are set for all records of a write.
+func upsertMigrated(ctx context.Context, target Collection, rows []ResultRow, embs []embeddings.Embedding) error {
+	var withMetadata, withoutMetadata []int
+	for i, row := range rows {
+		if row.Metadata != nil {
+			withMetadata = append(withMetadata, i)
+		} else {
+			withoutMetadata = append(withoutMetadata, i)
+		}
+	}
+	for _, group := range [][]int{withMetadata, withoutMetadata} {
+		if len(group) == 0 {
+			continue
+		}
+		ids := make([]DocumentID, len(group))
+		docs := make([]string, len(group))
+		groupEmbs := make([]embeddings.Embedding, len(group))
+		var metadatas []DocumentMetadata
+		for j, i := range group {
+			ids[j], docs[j], groupEmbs[j] = rows[i].ID, rows[i].Document, embs[i]
+			if rows[i].Metadata != nil {
+				metadatas = append(metadatas, rows[i].Metadata)
+			}
+		}
+		opts := []CollectionAddOption{WithIDs(ids...), WithTexts(docs...), WithEmbeddings(groupEmbs...)}
+		if len(metadatas) > 0 {
+			opts = append(opts, WithMetadatas(metadatas...))
+		}
+		if err := target.Upsert(ctx, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,221 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	localchroma "github.com/amikos-tech/chroma-go-local"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// failingUpsertEmbeddedRuntime fails upserts while fail returns an error.
+type failingUpsertEmbeddedRuntime struct {
+	*memoryEmbeddedRuntime
+	fail func() error
+}
+
+func (s *failingUpsertEmbeddedRuntime) UpsertRecords(request localchroma.EmbeddedUpsertRecordsRequest) error {
+	if s.fail != nil {
+		if err := s.fail(); err != nil {
+			return err
+		}
+	}
+	return s.memoryEmbeddedRuntime.UpsertRecords(request)
+}
+
+// flakyEmbeddingFunction fails the first failures requests.
+type flakyEmbeddingFunction struct {
+	countingEmbeddingFunction
+	failures atomic.Int32
+}
+
+func (ef *flakyEmbeddingFunction) EmbedDocuments(ctx context.Context, texts []string) ([]embeddings.Embedding, error) {
+	if ef.failures.Add(-1) >= 0 {
+		ef.calls.Add(1)
+		return nil, errors.New("rate limited")
+	}
+	return ef.countingEmbeddingFunction.EmbedDocuments(ctx, texts)
+}
+
+func newMigrationTestEF() *countingEmbeddingFunction {
+	return &countingEmbeddingFunction{
+		mockEmbeddingFunction: mockEmbeddingFunction{name: "mock", config: embeddings.EmbeddingFunctionConfig{}},
+		dim:                   2,
+	}
+}
+
+// newMigrationSource creates a collection of n records; every fifth has no document,
+// every second has metadata.
+func newMigrationSource(t *testing.T, client Client, n int) Collection {
+	t.Helper()
+	ctx := context.Background()
+	source, err := client.CreateCollection(ctx, "source", WithEmbeddingFunctionCreate(newMigrationTestEF()))
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		opts := []CollectionAddOption{
+			WithIDs(DocumentID(fmt.Sprintf("id%02d", i))),
+			WithEmbeddings(embeddings.NewEmbeddingFromFloat32([]float32{0, 0, 0})),
+		}
+		if i%5 != 4 {
+			opts = append(opts, WithTexts(fmt.Sprintf("document %d", i)))
+		}
+		if i%2 == 0 {
+			opts = append(opts, WithMetadatas(NewDocumentMetadata(NewStringAttribute("n", fmt.Sprintf("%d", i)))))
+		}
+		require.NoError(t, source.Add(ctx, opts...))
+	}
+	return source
+}
+
+func TestMigrateCollection(t *testing.T) {
+	ctx := context.Background()
+	client := newEmbeddedClientForRuntime(t, newMemoryEmbeddedRuntime())
+	source := newMigrationSource(t, client, 23)
+	ef := &flakyEmbeddingFunction{countingEmbeddingFunction: *newMigrationTestEF()}
+	ef.failures.Store(1)
+	var progress []int
+
+	result, err := MigrateCollection(ctx, client, source, "target",
+		WithMigrationEmbeddingFunction(ef),
+		WithMigrationBatchSize(10),
+		WithMigrationRetry(1, 0),
+		WithMigrationProgress(func(c MigrationCheckpoint) { progress = append(progress, c.Offset) }),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 19, result.Migrated)
+	require.Equal(t, 4, result.Skipped)
+	require.Equal(t, 23, result.SourceCount)
+	require.Equal(t, 19, result.TargetCount)
+	require.Equal(t, []int{10, 20, 23}, progress)
+	require.Equal(t, int32(4), ef.calls.Load(), "one retry and one request per batch")
+
+	got, err := result.Target.Get(ctx, WithIDs("id10", "id11", "id14"), WithInclude(IncludeDocuments, IncludeMetadatas, IncludeEmbeddings))
+	require.NoError(t, err)
+	require.Equal(t, DocumentIDs{"id10", "id11"}, got.GetIDs(), "records without a document are skipped")
+	require.Equal(t, "document 10", got.GetDocuments()[0].ContentString())
+	require.Len(t, got.GetEmbeddings()[0].ContentAsFloat32(), 2, "records are re-embedded")
+	n, ok := got.GetMetadatas()[0].GetString("n")
+	require.True(t, ok)
+	require.Equal(t, "10", n)
+	require.Nil(t, got.GetMetadatas()[1])
+}
+
+func TestMigrateCollectionResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	writes := 0
+	runtime := &failingUpsertEmbeddedRuntime{memoryEmbeddedRuntime: newMemoryEmbeddedRuntime()}
+	client := newEmbeddedClientForRuntime(t, runtime)
+	source := newMigrationSource(t, client, 30)
+	runtime.fail = func() error {
+		writes++
+		if writes == 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	ef := newMigrationTestEF()
+	opts := []MigrationOption{WithMigrationEmbeddingFunction(ef), WithMigrationBatchSize(10), WithMigrationCheckpoints(store)}
+
+	_, err := MigrateCollection(ctx, client, source, "target", opts...)
+	require.ErrorContains(t, err, "error writing records at offset 10")
+	checkpoint, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 10, checkpoint.Offset)
+	require.False(t, checkpoint.Completed)
+
+	result, err := MigrateCollection(ctx, client, source, "target", opts...)
+	require.NoError(t, err)
+	require.Equal(t, 24, result.Migrated)
+	require.Equal(t, 24, result.TargetCount)
+	require.Equal(t, int32(4), ef.calls.Load(), "the first batch is not embedded again")
+	checkpoint, err = store.Load(ctx)
+	require.NoError(t, err)
+	require.True(t, checkpoint.Completed)
+
+	_, err = MigrateCollection(ctx, client, source, "other", opts...)
+	require.ErrorContains(t, err, "checkpoint is for migrating collection "+source.ID()+" to target")
+}
+
+func TestMigrationTargetCreateOptions(t *testing.T) {
+	schema, err := NewSchema(WithStringIndex("category"))
+	require.NoError(t, err)
+	sourceEF := &mockEmbeddingFunction{name: "old", config: embeddings.EmbeddingFunctionConfig{}}
+	schema.SetEmbeddingFunction(sourceEF)
+	source := &CollectionImpl{
+		name:     "source",
+		schema:   schema,
+		metadata: NewMetadata(NewStringAttribute("owner", "search")),
+	}
+	ef := &mockEmbeddingFunction{name: "new", config: embeddings.EmbeddingFunctionConfig{}}
+	m := &migration{embeddingFunction: ef}
+
+	opts, err := m.targetCreateOptions(source)
+	require.NoError(t, err)
+	op, err := NewCreateCollectionOp("target", opts...)
+	require.NoError(t, err)
+	require.NoError(t, op.PrepareAndValidateCollectionRequest())
+	require.True(t, op.CreateIfNotExists)
+	owner, ok := op.Metadata.GetString("owner")
+	require.True(t, ok)
+	require.Equal(t, "search", owner)
+	_, ok = op.Schema.GetKey("category")
+	require.True(t, ok)
+	require.Equal(t, "new", op.Schema.GetEmbeddingFunction().Name())
+	require.Equal(t, "old", schema.GetEmbeddingFunction().Name(), "the source schema is not modified")
+}
+
+func TestMigrateCollectionValidation(t *testing.T) {
+	client := newEmbeddedClientForRuntime(t, newMemoryEmbeddedRuntime())
+	source := newMigrationSource(t, client, 1)
+	_, err := MigrateCollection(context.Background(), nil, source, "target")
+	require.Error(t, err)
+	_, err = MigrateCollection(context.Background(), client, source, "target")
+	require.ErrorContains(t, err, "an embedding function or content embedding function is required")
+	for _, opt := range []MigrationOption{
+		WithMigrationBatchSize(0),
+		WithMigrationRateLimit(0),
+		WithMigrationRetry(-1, 0),
+		WithMigrationEmbeddingFunction(nil),
+	} {
+		require.Error(t, opt(&migration{}))
+	}
+}
+
+func TestMigrateCollectionCountMismatch(t *testing.T) {
+	ctx := context.Background()
+	client := newEmbeddedClientForRuntime(t, newMemoryEmbeddedRuntime())
+	source := newMigrationSource(t, client, 5)
+	target, err := client.CreateCollection(ctx, "target", WithEmbeddingFunctionCreate(newMigrationTestEF()))
+	require.NoError(t, err)
+	require.NoError(t, target.Add(ctx, WithIDs("stale"), WithTexts("left over"),
+		WithEmbeddings(embeddings.NewEmbeddingFromFloat32([]float32{0, 0}))))
+
+	result, err := MigrateCollection(ctx, client, source, "target", WithMigrationEmbeddingFunction(newMigrationTestEF()))
+	require.ErrorIs(t, err, ErrMigrationCountMismatch)
+	require.Equal(t, 5, result.TargetCount)
+	require.Equal(t, 4, result.Migrated)
+}
+
+func TestMigrateCollectionRateLimit(t *testing.T) {
+	client := newEmbeddedClientForRuntime(t, newMemoryEmbeddedRuntime())
+	source := newMigrationSource(t, client, 30)
+
+	start := time.Now()
+	_, err := MigrateCollection(context.Background(), client, source, "target",
+		WithMigrationEmbeddingFunction(newMigrationTestEF()),
+		WithMigrationBatchSize(10),
+		WithMigrationRateLimit(20),
+	)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "3 requests 50ms apart")
+}
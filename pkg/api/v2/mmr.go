@@ -0,0 +1,427 @@
+package v2
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// DefaultMMRLambda is the default trade-off between relevance and diversity.
+const DefaultMMRLambda = 0.5
+
+// MMROptions configures Maximal Marginal Relevance (MMR) re-selection.
+type MMROptions struct {
+	// Lambda trades relevance (1) against diversity (0). Defaults to [DefaultMMRLambda].
+	Lambda float64
+	// FetchK is the number of candidates MMR selects from. [Collection.QueryMMR]
+	// fetches FetchK results per query; it defaults to 4*K.
+	FetchK int
+	// K is the number of results to keep per query. [Collection.QueryMMR] uses
+	// the value of [WithNResults].
+	K int
+	// Metric is the distance metric used to compare embeddings. [Collection.QueryMMR]
+	// defaults to the metric of the collection's vector index, other helpers to L2.
+	Metric embeddings.DistanceMetric
+}
+
+// MMROption configures [MMROptions].
+type MMROption func(*MMROptions) error
+
+// WithMMRLambda sets the relevance/diversity trade-off, between 0 and 1.
+func WithMMRLambda(lambda float64) MMROption {
+	return func(o *MMROptions) error {
+		if lambda < 0 || lambda > 1 || math.IsNaN(lambda) {
+			return errors.New("lambda must be between 0 and 1")
+		}
+		o.Lambda = lambda
+		return nil
+	}
+}
+
+// WithMMRFetchK sets the number of candidates MMR selects from.
+func WithMMRFetchK(fetchK int) MMROption {
+	return func(o *MMROptions) error {
+		if fetchK <= 0 {
+			return errors.New("fetchK must be greater than 0")
+		}
+		o.FetchK = fetchK
+		return nil
+	}
+}
+
+// WithMMRK sets the number of results to keep per query.
+func WithMMRK(k int) MMROption {
+	return func(o *MMROptions) error {
+		if k <= 0 {
+			return errors.New("k must be greater than 0")
+		}
+		o.K = k
+		return nil
+	}
+}
+
+// WithMMRDistanceMetric sets the distance metric used to compare embeddings.
+func WithMMRDistanceMetric(metric embeddings.DistanceMetric) MMROption {
+	return func(o *MMROptions) error {
+		switch metric {
+		case embeddings.L2, embeddings.COSINE, embeddings.IP:
+			o.Metric = metric
+			return nil
+		default:
+			return errors.Errorf("unsupported distance metric %q", metric)
+		}
+	}
+}
+
+func newMMROptions(opts ...MMROption) (*MMROptions, error) {
+	o := &MMROptions{Lambda: DefaultMMRLambda}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// WithMMR enables MMR re-selection for [Collection.Query]. The query fetches
+// FetchK candidates per query, including their embeddings and distances, and
+// keeps the NResults candidates selected by MMR. Embeddings and distances are
+// only returned when requested with [WithInclude].
+//
+//	results, err := collection.Query(ctx,
+//	    WithQueryTexts("renewable energy"),
+//	    WithNResults(5),
+//	    WithMMR(WithMMRLambda(0.7), WithMMRFetchK(30)),
+//	)
+func WithMMR(opts ...MMROption) QueryOption {
+	return QueryOptionFunc(func(op *CollectionQueryOp) error {
+		mmr, err := newMMROptions(opts...)
+		if err != nil {
+			return err
+		}
+		op.MMR = mmr
+		return nil
+	})
+}
+
+// SelectMMR returns the indexes of the k candidates selected by MMR, in
+// selection order. distances holds the distance of each candidate to the query;
+// candidate similarity is derived from the distance between candidate
+// embeddings under metric, so both terms share the same scale.
+func SelectMMR(candidates [][]float32, distances []float64, k int, lambda float64, metric embeddings.DistanceMetric) ([]int, error) {
+	if len(candidates) != len(distances) {
+		return nil, errors.Errorf("candidates length (%d) does not match distances length (%d)", len(candidates), len(distances))
+	}
+	if k > len(candidates) {
+		k = len(candidates)
+	}
+	if k <= 0 {
+		return []int{}, nil
+	}
+	selected := make([]int, 0, k)
+	used := make([]bool, len(candidates))
+	// maxSim[i] is the highest similarity (negated distance) of candidate i to a selected candidate
+	maxSim := make([]float64, len(candidates))
+	for i := range maxSim {
+		maxSim[i] = math.Inf(-1)
+	}
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			score := -lambda * distances[i]
+			if len(selected) > 0 {
+				score -= (1 - lambda) * maxSim[i]
+			}
+			if best == -1 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		used[best] = true
+		selected = append(selected, best)
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			d, err := computeEmbeddedDistance(metric, candidates[best], candidates[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to compare candidates %d and %d", best, i)
+			}
+			maxSim[i] = math.Max(maxSim[i], -float64(d))
+		}
+	}
+	return selected, nil
+}
+
+// MMRQueryResult re-selects the results of every query with MMR. The result
+// must include embeddings and distances; the first FetchK rows of each group are
+// the candidates and K rows are kept (all candidates when K is not set).
+func MMRQueryResult(result *QueryResultImpl, opts ...MMROption) (*QueryResultImpl, error) {
+	if result == nil {
+		return nil, errors.New("query result cannot be nil")
+	}
+	o, err := newMMROptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	orders := make([][]int, len(result.IDLists))
+	for g, ids := range result.IDLists {
+		n := mmrCandidateCount(len(ids), o.FetchK)
+		if n == 0 {
+			orders[g] = []int{}
+			continue
+		}
+		if g >= len(result.EmbeddingsLists) || len(result.EmbeddingsLists[g]) < n {
+			return nil, errors.Errorf("query result group %d has no embeddings; include them with WithInclude(IncludeEmbeddings)", g)
+		}
+		if g >= len(result.DistancesLists) || len(result.DistancesLists[g]) < n {
+			return nil, errors.Errorf("query result group %d has no distances; include them with WithInclude(IncludeDistances)", g)
+		}
+		candidates := make([][]float32, n)
+		distances := make([]float64, n)
+		for i := 0; i < n; i++ {
+			if result.EmbeddingsLists[g][i] == nil {
+				return nil, errors.Errorf("query result group %d row %d has no embedding", g, i)
+			}
+			candidates[i] = result.EmbeddingsLists[g][i].ContentAsFloat32()
+			distances[i] = float64(result.DistancesLists[g][i])
+		}
+		orders[g], err = SelectMMR(candidates, distances, mmrK(o.K, n), o.Lambda, mmrMetric(o.Metric))
+		if err != nil {
+			return nil, errors.Wrapf(err, "query result group %d", g)
+		}
+	}
+	out := &QueryResultImpl{Include: result.Include}
+	out.IDLists = make([]DocumentIDs, len(orders))
+	if result.DocumentsLists != nil {
+		out.DocumentsLists = make([]Documents, len(orders))
+	}
+	if result.MetadatasLists != nil {
+		out.MetadatasLists = make([]DocumentMetadatas, len(orders))
+	}
+	if result.EmbeddingsLists != nil {
+		out.EmbeddingsLists = make([]embeddings.Embeddings, len(orders))
+	}
+	if result.DistancesLists != nil {
+		out.DistancesLists = make([]embeddings.Distances, len(orders))
+	}
+	for g, order := range orders {
+		out.IDLists[g] = pickRows(result.IDLists[g], order)
+		if g < len(result.DocumentsLists) {
+			out.DocumentsLists[g] = pickRows(result.DocumentsLists[g], order)
+		}
+		if g < len(result.MetadatasLists) {
+			out.MetadatasLists[g] = pickRows(result.MetadatasLists[g], order)
+		}
+		if g < len(result.EmbeddingsLists) {
+			out.EmbeddingsLists[g] = pickRows(result.EmbeddingsLists[g], order)
+		}
+		if g < len(result.DistancesLists) {
+			out.DistancesLists[g] = pickRows(result.DistancesLists[g], order)
+		}
+	}
+	return out, nil
+}
+
+// MMRSearchResult re-selects the rows of every search request with MMR.
+// Embeddings and scores must be selected ([KEmbedding], [KScore]). Scores are
+// treated as distances: lower is more relevant, as with KNN ranking.
+func MMRSearchResult(result *SearchResultImpl, opts ...MMROption) (*SearchResultImpl, error) {
+	if result == nil {
+		return nil, errors.New("search result cannot be nil")
+	}
+	o, err := newMMROptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	orders := make([][]int, len(result.IDs))
+	for g, ids := range result.IDs {
+		n := mmrCandidateCount(len(ids), o.FetchK)
+		if n == 0 {
+			orders[g] = []int{}
+			continue
+		}
+		if g >= len(result.Embeddings) || len(result.Embeddings[g]) < n {
+			return nil, errors.Errorf("search result group %d has no embeddings; select them with WithSelect(KEmbedding)", g)
+		}
+		if g >= len(result.Scores) || len(result.Scores[g]) < n {
+			return nil, errors.Errorf("search result group %d has no scores; select them with WithSelect(KScore)", g)
+		}
+		orders[g], err = SelectMMR(result.Embeddings[g][:n], result.Scores[g][:n], mmrK(o.K, n), o.Lambda, mmrMetric(o.Metric))
+		if err != nil {
+			return nil, errors.Wrapf(err, "search result group %d", g)
+		}
+	}
+	out := &SearchResultImpl{IDs: make([][]DocumentID, len(orders))}
+	if result.Documents != nil {
+		out.Documents = make([][]string, len(orders))
+	}
+	if result.Metadatas != nil {
+		out.Metadatas = make([][]DocumentMetadata, len(orders))
+	}
+	if result.Embeddings != nil {
+		out.Embeddings = make([][][]float32, len(orders))
+	}
+	if result.Scores != nil {
+		out.Scores = make([][]float64, len(orders))
+	}
+	for g, order := range orders {
+		out.IDs[g] = pickRows(result.IDs[g], order)
+		if g < len(result.Documents) {
+			out.Documents[g] = pickRows(result.Documents[g], order)
+		}
+		if g < len(result.Metadatas) {
+			out.Metadatas[g] = pickRows(result.Metadatas[g], order)
+		}
+		if g < len(result.Embeddings) {
+			out.Embeddings[g] = pickRows(result.Embeddings[g], order)
+		}
+		if g < len(result.Scores) {
+			out.Scores[g] = pickRows(result.Scores[g], order)
+		}
+	}
+	return out, nil
+}
+
+func mmrCandidateCount(rows, fetchK int) int {
+	if fetchK > 0 && fetchK < rows {
+		return fetchK
+	}
+	return rows
+}
+
+func mmrK(k, candidates int) int {
+	if k <= 0 || k > candidates {
+		return candidates
+	}
+	return k
+}
+
+func mmrMetric(metric embeddings.DistanceMetric) embeddings.DistanceMetric {
+	if metric == "" {
+		return embeddings.L2
+	}
+	return metric
+}
+
+// pickRows returns values reordered by order, skipping indexes past the end of
+// partially populated columns.
+func pickRows[T any](values []T, order []int) []T {
+	if values == nil {
+		return nil
+	}
+	out := make([]T, 0, len(order))
+	for _, i := range order {
+		if i < len(values) {
+			out = append(out, values[i])
+		}
+	}
+	return out
+}
+
+// queryMMR runs a query with MMR re-selection: it fetches FetchK candidates
+// with embeddings and distances, selects NResults of them and drops the columns
+// that were only fetched for MMR.
+func queryMMR(ctx context.Context, c Collection, op *CollectionQueryOp, opts []CollectionQueryOption) (QueryResult, error) {
+	mmr := *op.MMR
+	mmr.K = op.NResults
+	if mmr.FetchK == 0 {
+		mmr.FetchK = 4 * mmr.K
+	}
+	if mmr.FetchK < mmr.K {
+		return nil, errors.Errorf("fetchK (%d) must be greater than or equal to nResults (%d)", mmr.FetchK, mmr.K)
+	}
+	if mmr.Metric == "" {
+		mmr.Metric = collectionDistanceMetric(c)
+	}
+	requested := op.Include
+	if len(requested) == 0 {
+		requested = []Include{IncludeDocuments, IncludeMetadatas, IncludeDistances}
+	}
+	fetchOpts := append(append([]CollectionQueryOption{}, opts...), QueryOptionFunc(func(fetch *CollectionQueryOp) error {
+		fetch.MMR = nil
+		fetch.NResults = mmr.FetchK
+		fetch.Include = appendMissingIncludes(append([]Include{}, requested...), IncludeEmbeddings, IncludeDistances)
+		return nil
+	}))
+	res, err := c.Query(ctx, fetchOpts...)
+	if err != nil {
+		return nil, err
+	}
+	impl, ok := res.(*QueryResultImpl)
+	if !ok {
+		return nil, errors.Errorf("unexpected query result type %T", res)
+	}
+	selected, err := MMRQueryResult(impl, func(o *MMROptions) error {
+		*o = mmr
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	selected.Include = requested
+	wanted := includeSet(requested)
+	if !wanted[IncludeEmbeddings] {
+		selected.EmbeddingsLists = nil
+	}
+	if !wanted[IncludeDistances] {
+		selected.DistancesLists = nil
+	}
+	return selected, nil
+}
+
+// collectionDistanceMetric returns the distance metric of the collection's
+// dense vector index from its schema, configuration or metadata, defaulting to L2.
+func collectionDistanceMetric(c Collection) embeddings.DistanceMetric {
+	if ec, ok := c.(*embeddedCollection); ok {
+		return ec.queryDistanceMetric()
+	}
+	if metric, ok := persistedDistanceMetric(c.Schema(), c.Configuration(), c.Metadata()); ok {
+		return metric
+	}
+	return embeddings.L2
+}
+
+// persistedDistanceMetric returns the distance metric of the dense vector index
+// from the schema, configuration or metadata, whichever sets it first.
+func persistedDistanceMetric(schema *Schema, cfg CollectionConfiguration, md CollectionMetadata) (embeddings.DistanceMetric, bool) {
+	candidates := make([]string, 0, 4)
+	if schema != nil {
+		if vt, ok := schema.GetKey(EmbeddingKey); ok && vt != nil && vt.FloatList != nil &&
+			vt.FloatList.VectorIndex != nil && vt.FloatList.VectorIndex.Config != nil {
+			candidates = append(candidates, string(vt.FloatList.VectorIndex.Config.Space))
+		}
+	}
+	if !isNilInterface(cfg) {
+		for _, index := range []string{"hnsw", "spann"} {
+			if raw, ok := cfg.GetRaw(index); ok {
+				if m, ok := raw.(map[string]interface{}); ok {
+					if space, ok := m["space"].(string); ok {
+						candidates = append(candidates, space)
+					}
+				}
+			}
+		}
+	}
+	if !isNilInterface(md) {
+		if space, ok := md.GetString(HNSWSpace); ok {
+			candidates = append(candidates, space)
+		}
+	}
+	for _, candidate := range candidates {
+		switch metric := embeddings.DistanceMetric(strings.ToLower(strings.TrimSpace(candidate))); metric {
+		case embeddings.L2, embeddings.COSINE, embeddings.IP:
+			return metric, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,127 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+func TestSelectMMR(t *testing.T) {
+	candidates := [][]float32{{1, 0}, {0.99, 0.01}, {0, 1}, {0.7, 0.7}}
+	distances := []float64{0, 0.01, 0.5, 0.3}
+
+	t.Run("skips near duplicates", func(t *testing.T) {
+		selected, err := SelectMMR(candidates, distances, 2, 0.5, embeddings.COSINE)
+		require.NoError(t, err)
+		require.Equal(t, []int{0, 2}, selected)
+	})
+
+	t.Run("lambda 1 keeps relevance order", func(t *testing.T) {
+		selected, err := SelectMMR(candidates, distances, 4, 1, embeddings.COSINE)
+		require.NoError(t, err)
+		require.Equal(t, []int{0, 1, 3, 2}, selected)
+	})
+
+	t.Run("k larger than candidates", func(t *testing.T) {
+		selected, err := SelectMMR(candidates[:2], distances[:2], 5, 0.5, embeddings.L2)
+		require.NoError(t, err)
+		require.Len(t, selected, 2)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := SelectMMR(candidates, distances[:1], 2, 0.5, embeddings.L2)
+		require.Error(t, err)
+		_, err = SelectMMR([][]float32{{1, 0}, {1}}, []float64{0, 1}, 2, 0.5, embeddings.L2)
+		require.Error(t, err)
+	})
+}
+
+func TestMMRSearchResult(t *testing.T) {
+	result := &SearchResultImpl{
+		IDs:        [][]DocumentID{{"a", "a2", "b", "c"}},
+		Documents:  [][]string{{"a", "a2", "b", "c"}},
+		Embeddings: [][][]float32{{{1, 0}, {0.99, 0.01}, {0, 1}, {0.7, 0.7}}},
+		Scores:     [][]float64{{0, 0.01, 0.5, 0.3}},
+	}
+	selected, err := MMRSearchResult(result, WithMMRK(2), WithMMRDistanceMetric(embeddings.COSINE))
+	require.NoError(t, err)
+	require.Equal(t, [][]DocumentID{{"a", "b"}}, selected.IDs)
+	require.Equal(t, [][]string{{"a", "b"}}, selected.Documents)
+	require.Equal(t, [][]float64{{0, 0.5}}, selected.Scores)
+
+	// fetchK limits the candidates
+	selected, err = MMRSearchResult(result, WithMMRK(2), WithMMRFetchK(2), WithMMRDistanceMetric(embeddings.COSINE))
+	require.NoError(t, err)
+	require.Equal(t, [][]DocumentID{{"a", "a2"}}, selected.IDs)
+
+	_, err = MMRSearchResult(&SearchResultImpl{IDs: [][]DocumentID{{"a"}}, Scores: [][]float64{{0}}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "KEmbedding")
+
+	_, err = MMRSearchResult(result, WithMMRLambda(2))
+	require.Error(t, err)
+}
+
+func TestCollectionQueryMMR(t *testing.T) {
+	var queryBody map[string]any
+	collection := newParentRetrievalTestCollection(t, func(path string, body map[string]any) string {
+		if strings.HasSuffix(path, "/query") {
+			queryBody = body
+			return `{
+  "ids": [["a", "a2", "b", "c"]],
+  "documents": [["a", "a2", "b", "c"]],
+  "metadatas": [[null, null, null, null]],
+  "embeddings": [[[1, 0], [0.99, 0.01], [0, 1], [0.7, 0.7]]],
+  "distances": [[0, 0.01, 0.5, 0.3]]
+}`
+		}
+		return ""
+	})
+	collection.metadata = NewMetadata(NewStringAttribute(HNSWSpace, "cosine"))
+
+	res, err := collection.QueryMMR(context.Background(), WithQueryTexts("query"), WithNResults(2))
+	require.NoError(t, err)
+	require.Equal(t, float64(8), queryBody["n_results"])
+	require.ElementsMatch(t, []any{"documents", "metadatas", "distances", "embeddings"}, queryBody["include"])
+
+	impl := res.(*QueryResultImpl)
+	require.Equal(t, []DocumentIDs{{"a", "b"}}, impl.IDLists)
+	require.Nil(t, impl.EmbeddingsLists, "embeddings were only fetched for MMR")
+	require.Len(t, impl.DistancesLists[0], 2)
+
+	t.Run("with mmr options on Query", func(t *testing.T) {
+		res, err := collection.Query(context.Background(),
+			WithQueryTexts("query"),
+			WithNResults(2),
+			WithInclude(IncludeDocuments, IncludeEmbeddings),
+			WithMMR(WithMMRLambda(1), WithMMRFetchK(4)),
+		)
+		require.NoError(t, err)
+		require.Equal(t, float64(4), queryBody["n_results"])
+		impl := res.(*QueryResultImpl)
+		require.Equal(t, []DocumentIDs{{"a", "a2"}}, impl.IDLists)
+		require.Len(t, impl.EmbeddingsLists[0], 2)
+		require.Nil(t, impl.DistancesLists)
+	})
+
+	t.Run("fetchK below nResults", func(t *testing.T) {
+		_, err := collection.QueryMMR(context.Background(), WithQueryTexts("query"), WithNResults(5), WithMMR(WithMMRFetchK(2)))
+		require.Error(t, err)
+	})
+}
+
+func TestCollectionDistanceMetric(t *testing.T) {
+	require.Equal(t, embeddings.L2, collectionDistanceMetric(&CollectionImpl{}))
+	require.Equal(t, embeddings.IP, collectionDistanceMetric(&CollectionImpl{
+		metadata: NewMetadata(NewStringAttribute(HNSWSpace, "IP")),
+	}))
+	config := NewCollectionConfiguration()
+	config.SetRaw("hnsw", map[string]interface{}{"space": "cosine"})
+	require.Equal(t, embeddings.COSINE, collectionDistanceMetric(&CollectionImpl{configuration: config}))
+}
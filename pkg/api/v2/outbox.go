@@ -0,0 +1,1103 @@
+package v2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+const (
+	// DefaultOutboxBatchSize is the maximum number of records sent in one replayed request.
+	DefaultOutboxBatchSize = 100
+	// DefaultOutboxRetryBackoff is the wait before the first retry, doubled for every further retry.
+	DefaultOutboxRetryBackoff = time.Second
+	// DefaultOutboxMaxRetryBackoff caps the wait between retries.
+	DefaultOutboxMaxRetryBackoff = time.Minute
+
+	outboxLogFile        = "outbox.log"
+	outboxAckFile        = "outbox.ack"
+	outboxDeadLetterFile = "outbox.dead"
+	// outboxCompactBytes is the size of replayed entries at the head of the log above which the log is rewritten.
+	outboxCompactBytes = 64 << 20
+)
+
+var (
+	// ErrOutboxClosed is returned for writes and flushes of a closed [Outbox].
+	ErrOutboxClosed = errors.New("outbox is closed")
+	// ErrOutboxFull is returned for writes that would exceed the limit of [WithOutboxMaxPending].
+	ErrOutboxFull = errors.New("outbox is full")
+)
+
+// OutboxOperation is the kind of a write queued in an [Outbox].
+type OutboxOperation string
+
+const (
+	OutboxAdd    OutboxOperation = "add"
+	OutboxUpsert OutboxOperation = "upsert"
+	OutboxUpdate OutboxOperation = "update"
+	OutboxDelete OutboxOperation = "delete"
+)
+
+// OutboxStats reports the backlog and replay progress of an [Outbox].
+type OutboxStats struct {
+	// PendingOps is the number of queued writes not yet accepted by the collection.
+	PendingOps int `json:"pending_ops"`
+	// PendingRecords is the number of records of the pending writes. Deletes by filter count as one.
+	PendingRecords int `json:"pending_records"`
+	// OldestPending is the time the oldest pending write was queued, zero when nothing is pending.
+	OldestPending time.Time `json:"oldest_pending,omitempty"`
+	SentOps       uint64    `json:"sent_ops"`
+	SentRecords   uint64    `json:"sent_records"`
+	// CoalescedRecords is the number of queued upserts and deletes replaced by a later write of the
+	// same record in the same request.
+	CoalescedRecords uint64 `json:"coalesced_records"`
+	// Retries is the number of failed attempts that were retried.
+	Retries uint64 `json:"retries"`
+	// Failed is the number of writes rejected by the collection and moved to the dead-letter file.
+	Failed uint64 `json:"failed"`
+	// LogBytes is the size of the log file.
+	LogBytes    int64     `json:"log_bytes"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+}
+
+// Outbox is a [Collection] that queues Add, Upsert, Update and Delete in a durable log in a local
+// directory and replays them in order to the wrapped collection.
+//
+// A write returns once it is appended to the log. Texts are embedded before they are queued, so a
+// write is embedded once however often it is retried. Writes failing with connection errors,
+// timeouts, 5xx, 408 or 429 responses are retried with exponential backoff until the collection
+// accepts them. Writes failing with any other error, e.g. a 4xx response or a validation error of an
+// embedded collection, are moved to the outbox.dead file in the directory and reported to the
+// handler of [WithOutboxFailureHandler].
+//
+// Writes are delivered at least once: a write sent right before a crash is sent again on the next
+// [NewOutbox]. Reads go directly to the wrapped collection and do not see pending writes.
+// Only one Outbox may use a directory at a time.
+type Outbox struct {
+	Collection
+
+	dir               string
+	embeddingFunction embeddings.EmbeddingFunction
+	batchSize         int
+	maxPending        int
+	retryBackoff      time.Duration
+	maxRetryBackoff   time.Duration
+	sync              bool
+	retryable         func(error) bool
+	onFailure         func(op OutboxOperation, ids []DocumentID, err error)
+
+	mu       sync.Mutex
+	log      *os.File
+	pending  []*outboxEntry
+	nextSeq  uint64
+	records  int
+	idle     chan struct{}
+	closed   bool
+	isolate  uint64
+	logBytes int64
+	acked    int64
+	stats    OutboxStats
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wake   chan struct{}
+	kick   chan struct{}
+	done   chan struct{}
+}
+
+// OutboxOption configures [NewOutbox].
+type OutboxOption func(o *Outbox) error
+
+// WithOutboxEmbeddingFunction sets the embedding function texts are embedded with before they are
+// queued. Defaults to the embedding function of the wrapped collection. Without one, texts are queued
+// as is and embedded by the collection on every replay attempt.
+func WithOutboxEmbeddingFunction(ef embeddings.EmbeddingFunction) OutboxOption {
+	return func(o *Outbox) error {
+		if ef == nil {
+			return errors.New("embedding function cannot be nil")
+		}
+		o.embeddingFunction = ef
+		return nil
+	}
+}
+
+// WithOutboxBatchSize sets the maximum number of records per replayed request. Larger writes are
+// queued in several parts. Defaults to [DefaultOutboxBatchSize].
+func WithOutboxBatchSize(size int) OutboxOption {
+	return func(o *Outbox) error {
+		if size < 1 {
+			return errors.New("batch size must be >= 1")
+		}
+		o.batchSize = size
+		return nil
+	}
+}
+
+// WithOutboxMaxPending limits the number of pending records. Writes beyond the limit fail with
+// [ErrOutboxFull]. Pending writes are also held in memory; there is no limit by default.
+func WithOutboxMaxPending(records int) OutboxOption {
+	return func(o *Outbox) error {
+		if records < 1 {
+			return errors.New("max pending records must be >= 1")
+		}
+		o.maxPending = records
+		return nil
+	}
+}
+
+// WithOutboxRetry sets the backoff before the first retry, which doubles for every further retry up
+// to maxBackoff. Defaults to [DefaultOutboxRetryBackoff] and [DefaultOutboxMaxRetryBackoff].
+func WithOutboxRetry(backoff, maxBackoff time.Duration) OutboxOption {
+	return func(o *Outbox) error {
+		if backoff <= 0 || maxBackoff <= 0 {
+			return errors.New("retry backoff must be > 0")
+		}
+		if maxBackoff < backoff {
+			return errors.New("max retry backoff cannot be less than the retry backoff")
+		}
+		o.retryBackoff, o.maxRetryBackoff = backoff, maxBackoff
+		return nil
+	}
+}
+
+// WithOutboxRetryable replaces the check deciding whether a failed write is retried. By default,
+// connection errors, timeouts and 5xx, 408 and 429 responses are retried and all other errors are not.
+func WithOutboxRetryable(fn func(err error) bool) OutboxOption {
+	return func(o *Outbox) error {
+		if fn == nil {
+			return errors.New("retryable check cannot be nil")
+		}
+		o.retryable = fn
+		return nil
+	}
+}
+
+// WithOutboxFailureHandler calls fn for every write the collection rejected. The write is already in
+// the dead-letter file when fn is called.
+func WithOutboxFailureHandler(fn func(op OutboxOperation, ids []DocumentID, err error)) OutboxOption {
+	return func(o *Outbox) error {
+		if fn == nil {
+			return errors.New("failure handler cannot be nil")
+		}
+		o.onFailure = fn
+		return nil
+	}
+}
+
+// WithOutboxSync enables or disables syncing the log to disk after every write. Enabled by default;
+// without it, writes acknowledged shortly before a power loss may be lost.
+func WithOutboxSync(sync bool) OutboxOption {
+	return func(o *Outbox) error {
+		o.sync = sync
+		return nil
+	}
+}
+
+// NewOutbox opens the outbox log in dir, creating it if needed, and starts replaying pending writes
+// to collection.
+//
+//	outbox, err := NewOutbox(collection, "/var/lib/app/outbox")
+//	if err != nil {
+//	    return err
+//	}
+//	defer outbox.Close()
+//	err = outbox.Upsert(ctx, WithIDs("doc1"), WithTexts("hello"))
+//	err = outbox.Flush(ctx) // wait until the collection has accepted all writes
+func NewOutbox(collection Collection, dir string, opts ...OutboxOption) (*Outbox, error) {
+	if collection == nil {
+		return nil, errors.New("collection cannot be nil")
+	}
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New("outbox directory cannot be empty")
+	}
+	o := &Outbox{
+		Collection:        collection,
+		dir:               dir,
+		embeddingFunction: collectionEmbeddingFunction(collection),
+		batchSize:         DefaultOutboxBatchSize,
+		retryBackoff:      DefaultOutboxRetryBackoff,
+		maxRetryBackoff:   DefaultOutboxMaxRetryBackoff,
+		sync:              true,
+		retryable:         outboxRetryable,
+		nextSeq:           1,
+		wake:              make(chan struct{}, 1),
+		kick:              make(chan struct{}, 1),
+		done:              make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "error creating outbox directory")
+	}
+	if err := o.recover(); err != nil {
+		return nil, err
+	}
+	o.idle = make(chan struct{})
+	if len(o.pending) == 0 {
+		close(o.idle)
+	}
+	o.ctx, o.cancel = context.WithCancel(context.Background())
+	go o.run()
+	return o, nil
+}
+
+// collectionEmbeddingFunction returns the embedding function of the collections of this package.
+func collectionEmbeddingFunction(collection Collection) embeddings.EmbeddingFunction {
+	switch c := collection.(type) {
+	case *CollectionImpl:
+		return c.embeddingFunction
+	case *embeddedCollection:
+		return c.embeddingFunctionSnapshot()
+	}
+	return nil
+}
+
+// outboxRetryable retries connection errors, timeouts, open circuits and 5xx, 408 and 429 responses.
+// Other errors, such as 4xx responses, validation errors and errors of an embedded collection, are
+// not retried: sending the write again would fail the same way and block the writes queued after it.
+func outboxRetryable(err error) bool {
+	var chromaErr *chhttp.ChromaError
+	if errors.As(err, &chromaErr) {
+		// connection errors are reported without a status code
+		code := chromaErr.ErrorCode
+		return code == 0 || code >= http.StatusInternalServerError ||
+			code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, ErrCircuitOpen) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Add queues an add. See [Collection.Add].
+func (o *Outbox) Add(ctx context.Context, opts ...CollectionAddOption) error {
+	return o.enqueueAdd(ctx, OutboxAdd, opts)
+}
+
+// Upsert queues an upsert. See [Collection.Upsert].
+func (o *Outbox) Upsert(ctx context.Context, opts ...CollectionAddOption) error {
+	return o.enqueueAdd(ctx, OutboxUpsert, opts)
+}
+
+func (o *Outbox) enqueueAdd(ctx context.Context, op OutboxOperation, opts []CollectionAddOption) error {
+	addOp, err := NewCollectionAddOp(opts...)
+	if err != nil {
+		return errors.Wrapf(err, "error preparing %s", op)
+	}
+	if err := addOp.PrepareAndValidate(); err != nil {
+		return errors.Wrapf(err, "error validating %s", op)
+	}
+	addOp.Documents = outboxDocuments(addOp.Documents)
+	addOp.Embeddings = outboxEmbeddings(addOp.Embeddings)
+	if o.embeddingFunction != nil {
+		if err := addOp.EmbedData(ctx, o.embeddingFunction); err != nil {
+			return errors.Wrap(err, "failed to embed data")
+		}
+	}
+	entry, err := newOutboxRecordsEntry(op, addOp.Ids, addOp.Documents, addOp.Metadatas, addOp.Embeddings)
+	if err != nil {
+		return err
+	}
+	return o.enqueue(entry)
+}
+
+// Update queues an update. See [Collection.Update].
+func (o *Outbox) Update(ctx context.Context, opts ...CollectionUpdateOption) error {
+	updateOp, err := NewCollectionUpdateOp(opts...)
+	if err != nil {
+		return errors.Wrap(err, "error preparing update")
+	}
+	if err := updateOp.PrepareAndValidate(); err != nil {
+		return errors.Wrap(err, "error validating update")
+	}
+	updateOp.Documents = outboxDocuments(updateOp.Documents)
+	updateOp.Embeddings = outboxEmbeddings(updateOp.Embeddings)
+	if o.embeddingFunction != nil {
+		if err := updateOp.EmbedData(ctx, o.embeddingFunction); err != nil {
+			return errors.Wrap(err, "failed to embed data")
+		}
+	}
+	entry, err := newOutboxRecordsEntry(OutboxUpdate, updateOp.Ids, updateOp.Documents, updateOp.Metadatas, updateOp.Embeddings)
+	if err != nil {
+		return err
+	}
+	return o.enqueue(entry)
+}
+
+// Delete queues a delete. See [Collection.Delete].
+func (o *Outbox) Delete(_ context.Context, opts ...CollectionDeleteOption) error {
+	deleteOp, err := NewCollectionDeleteOp(opts...)
+	if err != nil {
+		return errors.Wrap(err, "error preparing delete")
+	}
+	if err := deleteOp.PrepareAndValidate(); err != nil {
+		return errors.Wrap(err, "error validating delete")
+	}
+	entry := &outboxEntry{Op: OutboxDelete, IDs: deleteOp.Ids, Limit: deleteOp.Limit}
+	if deleteOp.Where != nil {
+		if entry.Where, err = deleteOp.Where.MarshalJSON(); err != nil {
+			return errors.Wrap(err, "error encoding where filter")
+		}
+	}
+	if deleteOp.WhereDocument != nil {
+		if entry.WhereDocument, err = deleteOp.WhereDocument.MarshalJSON(); err != nil {
+			return errors.Wrap(err, "error encoding where document filter")
+		}
+	}
+	return o.enqueue(entry)
+}
+
+// Flush waits until the collection has accepted or rejected every pending write. A flush retries
+// a failed write right away instead of waiting for the backoff.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return ErrOutboxClosed
+	}
+	idle := o.idle
+	o.mu.Unlock()
+
+	select {
+	case o.kick <- struct{}{}:
+	default:
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-o.done:
+		return ErrOutboxClosed
+	}
+}
+
+// Stats returns the backlog and replay counters.
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := o.stats
+	stats.PendingOps = len(o.pending)
+	stats.PendingRecords = o.records
+	if len(o.pending) > 0 {
+		stats.OldestPending = o.pending[0].EnqueuedAt
+	}
+	stats.LogBytes = o.logBytes
+	return stats
+}
+
+// Close stops the replay and closes the log. Pending writes stay in the log and are replayed by the
+// next [NewOutbox] on the directory. The wrapped collection is not closed.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return nil
+	}
+	o.closed = true
+	o.mu.Unlock()
+
+	o.cancel()
+	<-o.done
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.log.Close(); err != nil {
+		return errors.Wrap(err, "error closing outbox log")
+	}
+	return nil
+}
+
+// outboxEntry is a write in the outbox log, one JSON document per line.
+type outboxEntry struct {
+	Seq           uint64                           `json:"seq"`
+	Op            OutboxOperation                  `json:"op"`
+	EnqueuedAt    time.Time                        `json:"enqueued_at"`
+	IDs           []DocumentID                     `json:"ids,omitempty"`
+	Documents     []string                         `json:"documents,omitempty"`
+	Metadatas     []map[string]outboxMetadataValue `json:"metadatas,omitempty"`
+	Embeddings    [][]float32                      `json:"embeddings,omitempty"`
+	Where         json.RawMessage                  `json:"where,omitempty"`
+	WhereDocument json.RawMessage                  `json:"where_document,omitempty"`
+	Limit         *int32                           `json:"limit,omitempty"`
+
+	// size is the length of the entry in the log.
+	size int64
+}
+
+// outboxMetadataValue keeps the type of a metadata value, which plain JSON loses for whole floats.
+type outboxMetadataValue struct {
+	Bool    *bool     `json:"b,omitempty"`
+	Int     *int64    `json:"i,omitempty"`
+	Float   *float64  `json:"f,omitempty"`
+	String  *string   `json:"s,omitempty"`
+	Nil     bool      `json:"n,omitempty"`
+	Strings []string  `json:"sa,omitempty"`
+	Ints    []int64   `json:"ia,omitempty"`
+	Floats  []float64 `json:"fa,omitempty"`
+	Bools   []bool    `json:"ba,omitempty"`
+}
+
+func (e *outboxEntry) hasFilter() bool {
+	return len(e.Where) > 0 || len(e.WhereDocument) > 0 || e.Limit != nil
+}
+
+// recordCount counts a delete by filter as one record.
+func (e *outboxEntry) recordCount() int {
+	if len(e.IDs) == 0 {
+		return 1
+	}
+	return len(e.IDs)
+}
+
+// sameShape reports whether the records of e and other can be sent in one request.
+func (e *outboxEntry) sameShape(other *outboxEntry) bool {
+	return e.Op == other.Op && !e.hasFilter() && !other.hasFilter() &&
+		(len(e.Documents) > 0) == (len(other.Documents) > 0) &&
+		(len(e.Metadatas) > 0) == (len(other.Metadatas) > 0) &&
+		(len(e.Embeddings) > 0) == (len(other.Embeddings) > 0)
+}
+
+// outboxDocuments drops the documents of records without one, as left by records without documents.
+func outboxDocuments(documents []Document) []Document {
+	for _, doc := range documents {
+		if doc != nil {
+			return documents
+		}
+	}
+	return nil
+}
+
+// outboxEmbeddings drops embeddings that are all nil, so that the records are embedded.
+func outboxEmbeddings(embs []any) []any {
+	for _, emb := range embs {
+		if emb != nil {
+			if e, ok := emb.(embeddings.Embedding); !ok || e != nil {
+				return embs
+			}
+		}
+	}
+	return nil
+}
+
+func newOutboxRecordsEntry(op OutboxOperation, ids []DocumentID, documents []Document, metadatas []DocumentMetadata, embs []any) (*outboxEntry, error) {
+	entry := &outboxEntry{Op: op, IDs: ids}
+	if len(documents) > 0 {
+		entry.Documents = make([]string, len(documents))
+		for i, doc := range documents {
+			if doc == nil {
+				return nil, errors.Errorf("outbox requires a document for all or none of the records, missing for %s", ids[i])
+			}
+			entry.Documents[i] = doc.ContentString()
+		}
+	}
+	if len(metadatas) > 0 {
+		present := 0
+		for _, metadata := range metadatas {
+			if metadata != nil {
+				present++
+			}
+		}
+		if present > 0 && present < len(metadatas) {
+			return nil, errors.New("outbox requires metadata for all or none of the records")
+		}
+		for i := 0; present > 0 && i < len(metadatas); i++ {
+			values, err := newOutboxMetadata(metadatas[i])
+			if err != nil {
+				return nil, err
+			}
+			entry.Metadatas = append(entry.Metadatas, values)
+		}
+	}
+	if len(embs) > 0 {
+		entry.Embeddings = make([][]float32, len(embs))
+		for i, emb := range embs {
+			e, ok := emb.(embeddings.Embedding)
+			if !ok || e == nil {
+				return nil, errors.Errorf("outbox requires an embedding for all or none of the records, missing for %s", ids[i])
+			}
+			entry.Embeddings[i] = e.ContentAsFloat32()
+		}
+	}
+	return entry, nil
+}
+
+func newOutboxMetadata(metadata DocumentMetadata) (map[string]outboxMetadataValue, error) {
+	impl, ok := metadata.(*DocumentMetadataImpl)
+	if !ok {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, errors.Wrap(err, "error encoding metadata")
+		}
+		impl = &DocumentMetadataImpl{}
+		if err := json.Unmarshal(data, impl); err != nil {
+			return nil, errors.Wrap(err, "error encoding metadata")
+		}
+	}
+	values := make(map[string]outboxMetadataValue, len(impl.metadata))
+	for k, v := range impl.metadata {
+		values[k] = outboxMetadataValue{
+			Bool: v.Bool, Int: v.Int, Float: v.Float64, String: v.StringValue, Nil: v.NilValue,
+			Strings: v.StringArray, Ints: v.IntArray, Floats: v.FloatArray, Bools: v.BoolArray,
+		}
+	}
+	return values, nil
+}
+
+func outboxDocumentMetadata(values map[string]outboxMetadataValue) DocumentMetadata {
+	metadata := make(map[string]MetadataValue, len(values))
+	for k, v := range values {
+		metadata[k] = MetadataValue{
+			Bool: v.Bool, Int: v.Int, Float64: v.Float, StringValue: v.String, NilValue: v.Nil,
+			StringArray: v.Strings, IntArray: v.Ints, FloatArray: v.Floats, BoolArray: v.Bools,
+		}
+	}
+	return &DocumentMetadataImpl{metadata: metadata}
+}
+
+// split divides the records of e into entries of at most size records.
+func (e *outboxEntry) split(size int) []*outboxEntry {
+	if e.hasFilter() || len(e.IDs) <= size {
+		return []*outboxEntry{e}
+	}
+	parts := make([]*outboxEntry, 0, (len(e.IDs)+size-1)/size)
+	for start := 0; start < len(e.IDs); start += size {
+		end := start + size
+		if end > len(e.IDs) {
+			end = len(e.IDs)
+		}
+		part := &outboxEntry{Op: e.Op, IDs: e.IDs[start:end]}
+		if len(e.Documents) > 0 {
+			part.Documents = e.Documents[start:end]
+		}
+		if len(e.Metadatas) > 0 {
+			part.Metadatas = e.Metadatas[start:end]
+		}
+		if len(e.Embeddings) > 0 {
+			part.Embeddings = e.Embeddings[start:end]
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// enqueue appends the parts of entry to the log in one write.
+func (o *Outbox) enqueue(entry *outboxEntry) error {
+	parts := entry.split(o.batchSize)
+	records := 0
+	for _, part := range parts {
+		records += part.recordCount()
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return ErrOutboxClosed
+	}
+	if o.maxPending > 0 && o.records+records > o.maxPending {
+		return errors.Wrapf(ErrOutboxFull, "%d records pending", o.records)
+	}
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+	for i, part := range parts {
+		part.Seq = o.nextSeq + uint64(i)
+		part.EnqueuedAt = now
+		start := buf.Len()
+		if err := json.NewEncoder(&buf).Encode(part); err != nil {
+			return errors.Wrap(err, "error encoding outbox entry")
+		}
+		part.size = int64(buf.Len() - start)
+	}
+	if _, err := o.log.Write(buf.Bytes()); err != nil {
+		// drop a partial write, so that the log stays readable
+		_ = o.log.Truncate(o.logBytes)
+		return errors.Wrap(err, "error writing outbox log")
+	}
+	if o.sync {
+		if err := o.log.Sync(); err != nil {
+			_ = o.log.Truncate(o.logBytes)
+			return errors.Wrap(err, "error syncing outbox log")
+		}
+	}
+	o.nextSeq += uint64(len(parts))
+	o.logBytes += int64(buf.Len())
+	if len(o.pending) == 0 {
+		o.idle = make(chan struct{})
+	}
+	o.pending = append(o.pending, parts...)
+	o.records += records
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// recover reads the pending writes of the log, dropping a partial last line left by a crash.
+func (o *Outbox) recover() error {
+	ackPath := filepath.Join(o.dir, outboxAckFile)
+	var acked uint64
+	if data, err := os.ReadFile(ackPath); err == nil {
+		// an ack file damaged by a crash replays the whole log, writes are delivered at least once anyway
+		acked, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "error reading outbox ack file")
+	}
+	o.nextSeq = acked + 1
+
+	logPath := filepath.Join(o.dir, outboxLogFile)
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "error opening outbox log")
+	}
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			_ = file.Close()
+			return errors.Wrap(readErr, "error reading outbox log")
+		}
+		if len(line) == 0 {
+			break
+		}
+		entry := &outboxEntry{}
+		if readErr == io.EOF || json.Unmarshal(line, entry) != nil {
+			if readErr != io.EOF {
+				if _, err := reader.Peek(1); err != io.EOF {
+					_ = file.Close()
+					return errors.Errorf("outbox log %s is corrupt at offset %d", logPath, offset)
+				}
+			}
+			if err := file.Truncate(offset); err != nil {
+				_ = file.Close()
+				return errors.Wrap(err, "error truncating partial outbox log entry")
+			}
+			break
+		}
+		entry.size = int64(len(line))
+		offset += entry.size
+		if entry.Seq >= o.nextSeq {
+			o.nextSeq = entry.Seq + 1
+		}
+		if entry.Seq <= acked {
+			o.acked += entry.size
+			continue
+		}
+		o.pending = append(o.pending, entry)
+		o.records += entry.recordCount()
+		if readErr == io.EOF {
+			break
+		}
+	}
+	o.log = file
+	o.logBytes = offset
+	if len(o.pending) == 0 && offset > 0 {
+		return o.truncateLog()
+	}
+	return nil
+}
+
+// run replays the pending writes in order until the outbox is closed.
+func (o *Outbox) run() {
+	defer close(o.done)
+	backoff := o.retryBackoff
+	for {
+		batch, consumed, coalesced := o.nextBatch()
+		if batch == nil {
+			select {
+			case <-o.wake:
+			case <-o.kick:
+			case <-o.ctx.Done():
+				return
+			}
+			continue
+		}
+		err := o.send(o.ctx, batch)
+		if o.ctx.Err() != nil {
+			return
+		}
+		switch {
+		case err == nil:
+			o.complete(consumed, batch.recordCount(), coalesced, nil)
+			backoff = o.retryBackoff
+		case o.retryable(err):
+			o.recordError(err, true)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-o.kick:
+				timer.Stop()
+			case <-o.ctx.Done():
+				timer.Stop()
+				return
+			}
+			backoff *= 2
+			if backoff > o.maxRetryBackoff {
+				backoff = o.maxRetryBackoff
+			}
+		case consumed > 1:
+			// send the merged writes one at a time to find the rejected one
+			o.mu.Lock()
+			o.isolate = o.pending[consumed-1].Seq
+			o.mu.Unlock()
+		default:
+			o.recordError(err, false)
+			o.complete(1, 0, 0, err)
+		}
+	}
+}
+
+// nextBatch merges the writes at the head of the backlog that can be sent in one request. Later
+// upserts and deletes of a record replace earlier ones; adds and updates of a record already in the
+// request end it.
+func (o *Outbox) nextBatch() (*outboxEntry, int, int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.pending) == 0 {
+		return nil, 0, 0
+	}
+	first := o.pending[0]
+	if first.hasFilter() || first.Seq <= o.isolate {
+		return first, 1, 0
+	}
+	batch := &outboxEntry{Op: first.Op}
+	index := map[DocumentID]int{}
+	consumed, coalesced := 0, 0
+	for _, entry := range o.pending {
+		if consumed > 0 && (!first.sameShape(entry) || len(batch.IDs)+len(entry.IDs) > o.batchSize || entry.Seq <= o.isolate) {
+			break
+		}
+		if consumed > 0 && (entry.Op == OutboxAdd || entry.Op == OutboxUpdate) && containsOutboxID(index, entry.IDs) {
+			break
+		}
+		for i, id := range entry.IDs {
+			if at, ok := index[id]; ok {
+				coalesced++
+				if entry.Op == OutboxUpsert {
+					batch.setRecord(at, entry, i)
+				}
+				continue
+			}
+			index[id] = len(batch.IDs)
+			batch.IDs = append(batch.IDs, id)
+			batch.appendRecord(entry, i)
+		}
+		consumed++
+	}
+	return batch, consumed, coalesced
+}
+
+func containsOutboxID(index map[DocumentID]int, ids []DocumentID) bool {
+	for _, id := range ids {
+		if _, ok := index[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *outboxEntry) appendRecord(from *outboxEntry, i int) {
+	if len(from.Documents) > 0 {
+		e.Documents = append(e.Documents, from.Documents[i])
+	}
+	if len(from.Metadatas) > 0 {
+		e.Metadatas = append(e.Metadatas, from.Metadatas[i])
+	}
+	if len(from.Embeddings) > 0 {
+		e.Embeddings = append(e.Embeddings, from.Embeddings[i])
+	}
+}
+
+func (e *outboxEntry) setRecord(at int, from *outboxEntry, i int) {
+	if len(from.Documents) > 0 {
+		e.Documents[at] = from.Documents[i]
+	}
+	if len(from.Metadatas) > 0 {
+		// an upsert merges its metadata keys into the record's metadata, keep the keys of the earlier upsert
+		merged := make(map[string]outboxMetadataValue, len(e.Metadatas[at])+len(from.Metadatas[i]))
+		for k, v := range e.Metadatas[at] {
+			merged[k] = v
+		}
+		for k, v := range from.Metadatas[i] {
+			merged[k] = v
+		}
+		e.Metadatas[at] = merged
+	}
+	if len(from.Embeddings) > 0 {
+		e.Embeddings[at] = from.Embeddings[i]
+	}
+}
+
+// send writes a batch to the wrapped collection.
+func (o *Outbox) send(ctx context.Context, e *outboxEntry) error {
+	ids := WithIDs(e.IDs...)
+	var texts *textsOption
+	if len(e.Documents) > 0 {
+		texts = WithTexts(e.Documents...)
+	}
+	var metadatas *metadatasOption
+	if len(e.Metadatas) > 0 {
+		values := make([]DocumentMetadata, len(e.Metadatas))
+		for i, m := range e.Metadatas {
+			values[i] = outboxDocumentMetadata(m)
+		}
+		metadatas = WithMetadatas(values...)
+	}
+	var embs *embeddingsOption
+	if len(e.Embeddings) > 0 {
+		values := make([]embeddings.Embedding, len(e.Embeddings))
+		for i, emb := range e.Embeddings {
+			values[i] = embeddings.NewEmbeddingFromFloat32(emb)
+		}
+		embs = WithEmbeddings(values...)
+	}
+
+	switch e.Op {
+	case OutboxAdd, OutboxUpsert:
+		opts := []CollectionAddOption{ids}
+		if texts != nil {
+			opts = append(opts, texts)
+		}
+		if metadatas != nil {
+			opts = append(opts, metadatas)
+		}
+		if embs != nil {
+			opts = append(opts, embs)
+		}
+		if e.Op == OutboxAdd {
+			return o.Collection.Add(ctx, opts...)
+		}
+		return o.Collection.Upsert(ctx, opts...)
+	case OutboxUpdate:
+		opts := []CollectionUpdateOption{ids}
+		if texts != nil {
+			opts = append(opts, texts)
+		}
+		if metadatas != nil {
+			opts = append(opts, metadatas)
+		}
+		if embs != nil {
+			opts = append(opts, embs)
+		}
+		return o.Collection.Update(ctx, opts...)
+	case OutboxDelete:
+		opts := make([]CollectionDeleteOption, 0, 4)
+		if len(e.IDs) > 0 {
+			opts = append(opts, ids)
+		}
+		if len(e.Where) > 0 {
+			opts = append(opts, WithWhere(rawWhereFilter(e.Where)))
+		}
+		if len(e.WhereDocument) > 0 {
+			opts = append(opts, WithWhereDocument(rawWhereDocumentFilter(e.WhereDocument)))
+		}
+		if e.Limit != nil {
+			opts = append(opts, WithLimit(int(*e.Limit)))
+		}
+		return o.Collection.Delete(ctx, opts...)
+	default:
+		return errors.Errorf("unknown outbox operation %q", e.Op)
+	}
+}
+
+func (o *Outbox) recordError(err error, retried bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stats.LastError = err.Error()
+	o.stats.LastErrorAt = time.Now().UTC()
+	if retried {
+		o.stats.Retries++
+	}
+}
+
+// complete removes the first consumed writes from the backlog, moving them to the dead-letter file
+// when failed is set.
+func (o *Outbox) complete(consumed, records, coalesced int, failed error) {
+	o.mu.Lock()
+	done := o.pending[:consumed]
+	if failed != nil {
+		if err := o.deadLetter(done); err != nil {
+			o.stats.LastError = err.Error()
+			o.stats.LastErrorAt = time.Now().UTC()
+		}
+		o.stats.Failed += uint64(consumed)
+	} else {
+		o.stats.SentOps += uint64(consumed)
+		o.stats.SentRecords += uint64(records)
+		o.stats.CoalescedRecords += uint64(coalesced)
+	}
+	if err := o.writeAck(done[len(done)-1].Seq); err != nil {
+		o.stats.LastError = err.Error()
+		o.stats.LastErrorAt = time.Now().UTC()
+	}
+	for _, entry := range done {
+		o.records -= entry.recordCount()
+		o.acked += entry.size
+	}
+	o.pending = o.pending[consumed:]
+	if len(o.pending) == 0 {
+		o.pending = nil
+		if err := o.truncateLog(); err != nil {
+			o.stats.LastError = err.Error()
+			o.stats.LastErrorAt = time.Now().UTC()
+		}
+		close(o.idle)
+	} else if o.acked > outboxCompactBytes && o.acked > o.logBytes/2 {
+		if err := o.compactLog(); err != nil {
+			o.stats.LastError = err.Error()
+			o.stats.LastErrorAt = time.Now().UTC()
+		}
+	}
+	o.mu.Unlock()
+
+	if failed != nil && o.onFailure != nil {
+		for _, entry := range done {
+			o.onFailure(entry.Op, entry.IDs, failed)
+		}
+	}
+}
+
+func (o *Outbox) deadLetter(entries []*outboxEntry) error {
+	file, err := os.OpenFile(filepath.Join(o.dir, outboxDeadLetterFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "error opening outbox dead-letter file")
+	}
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrap(err, "error writing outbox dead-letter file")
+}
+
+// writeAck records the last replayed write, replacing the ack file atomically.
+func (o *Outbox) writeAck(seq uint64) error {
+	path := filepath.Join(o.dir, outboxAckFile)
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "error writing outbox ack file")
+	}
+	_, err = file.WriteString(strconv.FormatUint(seq, 10))
+	if err == nil && o.sync {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "error writing outbox ack file")
+	}
+	return o.syncDir()
+}
+
+// syncDir persists renames in the outbox directory. Directories cannot be synced on Windows.
+func (o *Outbox) syncDir() error {
+	if !o.sync || runtime.GOOS == "windows" {
+		return nil
+	}
+	dir, err := os.Open(o.dir)
+	if err != nil {
+		return errors.Wrap(err, "error syncing outbox directory")
+	}
+	err = dir.Sync()
+	if closeErr := dir.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrap(err, "error syncing outbox directory")
+}
+
+func (o *Outbox) truncateLog() error {
+	if err := o.log.Truncate(0); err != nil {
+		return errors.Wrap(err, "error truncating outbox log")
+	}
+	o.logBytes, o.acked = 0, 0
+	return nil
+}
+
+// compactLog rewrites the log with the pending writes only.
+func (o *Outbox) compactLog() error {
+	path := filepath.Join(o.dir, outboxLogFile)
+	tmp, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "error compacting outbox log")
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range o.pending {
+		start := buf.Len()
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+		entry.size = int64(buf.Len() - start)
+	}
+	if err == nil {
+		_, err = tmp.Write(buf.Bytes())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return errors.Wrap(err, "error compacting outbox log")
+	}
+	_ = o.log.Close()
+	o.log = tmp
+	o.logBytes, o.acked = int64(buf.Len()), 0
+	return o.syncDir()
+}
+
+// rawWhereFilter replays a where filter as the JSON it was queued with.
+type rawWhereFilter json.RawMessage
+
+func (f rawWhereFilter) String() string               { return string(f) }
+func (f rawWhereFilter) Validate() error              { return nil }
+func (f rawWhereFilter) MarshalJSON() ([]byte, error) { return f, nil }
+func (f rawWhereFilter) UnmarshalJSON([]byte) error {
+	return errors.New("raw where filter is read-only")
+}
+
+// rawWhereDocumentFilter replays a where document filter as the JSON it was queued with.
+type rawWhereDocumentFilter json.RawMessage
+
+func (f rawWhereDocumentFilter) String() string                        { return string(f) }
+func (f rawWhereDocumentFilter) Validate() error                       { return nil }
+func (f rawWhereDocumentFilter) MarshalJSON() ([]byte, error)          { return f, nil }
+func (f rawWhereDocumentFilter) Operator() WhereDocumentFilterOperator { return "" }
+func (f rawWhereDocumentFilter) Operand() interface{}                  { return nil }
+func (f rawWhereDocumentFilter) UnmarshalJSON([]byte) error {
+	return errors.New("raw where document filter is read-only")
+}
@@ -0,0 +1,384 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// outboxTestCall is a write received by outboxTestCollection.
+type outboxTestCall struct {
+	op         OutboxOperation
+	ids        []DocumentID
+	texts      []string
+	metadatas  []DocumentMetadata
+	embeddings int
+	where      string
+}
+
+// outboxTestCollection records writes, failing them while fail returns an error.
+type outboxTestCollection struct {
+	Collection
+	mu    sync.Mutex
+	calls []outboxTestCall
+	fail  func(call outboxTestCall) error
+}
+
+func (c *outboxTestCollection) record(call outboxTestCall) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail != nil {
+		if err := c.fail(call); err != nil {
+			return err
+		}
+	}
+	c.calls = append(c.calls, call)
+	return nil
+}
+
+func (c *outboxTestCollection) setFail(fail func(call outboxTestCall) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fail = fail
+}
+
+func (c *outboxTestCollection) received() []outboxTestCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]outboxTestCall(nil), c.calls...)
+}
+
+func outboxTestAddCall(op OutboxOperation, ids []DocumentID, docs []Document, metadatas []DocumentMetadata, embs []any) outboxTestCall {
+	call := outboxTestCall{op: op, ids: ids, metadatas: metadatas, embeddings: len(embs)}
+	for _, doc := range docs {
+		if doc == nil {
+			call.texts = append(call.texts, "")
+			continue
+		}
+		call.texts = append(call.texts, doc.ContentString())
+	}
+	return call
+}
+
+func (c *outboxTestCollection) Add(_ context.Context, opts ...CollectionAddOption) error {
+	op, err := NewCollectionAddOp(opts...)
+	if err != nil {
+		return err
+	}
+	return c.record(outboxTestAddCall(OutboxAdd, op.Ids, op.Documents, op.Metadatas, op.Embeddings))
+}
+
+func (c *outboxTestCollection) Upsert(_ context.Context, opts ...CollectionAddOption) error {
+	op, err := NewCollectionAddOp(opts...)
+	if err != nil {
+		return err
+	}
+	return c.record(outboxTestAddCall(OutboxUpsert, op.Ids, op.Documents, op.Metadatas, op.Embeddings))
+}
+
+func (c *outboxTestCollection) Update(_ context.Context, opts ...CollectionUpdateOption) error {
+	op, err := NewCollectionUpdateOp(opts...)
+	if err != nil {
+		return err
+	}
+	return c.record(outboxTestAddCall(OutboxUpdate, op.Ids, op.Documents, op.Metadatas, op.Embeddings))
+}
+
+func (c *outboxTestCollection) Delete(_ context.Context, opts ...CollectionDeleteOption) error {
+	op, err := NewCollectionDeleteOp(opts...)
+	if err != nil {
+		return err
+	}
+	if err := op.PrepareAndValidate(); err != nil {
+		return err
+	}
+	call := outboxTestCall{op: OutboxDelete, ids: op.Ids}
+	if op.Where != nil {
+		where, err := json.Marshal(op.Where)
+		if err != nil {
+			return err
+		}
+		call.where = string(where)
+	}
+	return c.record(call)
+}
+
+// errOutboxTestOffline is the error of a request that did not reach the server.
+var errOutboxTestOffline = errors.Wrap(chhttp.ChromaErrorFromHTTPResponse(nil, errors.New("connection refused")), "error sending request")
+
+func newTestOutbox(t *testing.T, collection Collection, dir string, opts ...OutboxOption) *Outbox {
+	t.Helper()
+	opts = append([]OutboxOption{
+		WithOutboxEmbeddingFunction(embeddings.NewConsistentHashEmbeddingFunction()),
+		WithOutboxRetry(time.Millisecond, 5*time.Millisecond),
+	}, opts...)
+	outbox, err := NewOutbox(collection, dir, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = outbox.Close() })
+	return outbox
+}
+
+func flushOutbox(t *testing.T, outbox *Outbox) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, outbox.Flush(ctx))
+}
+
+func TestOutboxReplaysInOrder(t *testing.T) {
+	collection := &outboxTestCollection{}
+	outbox := newTestOutbox(t, collection, t.TempDir())
+	ctx := context.Background()
+
+	metadata := NewDocumentMetadata(NewFloatArrayAttribute("scores", []float64{1, 2}), NewIntAttribute("n", 1))
+	require.NoError(t, outbox.Add(ctx, WithIDs("1", "2"), WithTexts("a", "b"), WithMetadatas(metadata, metadata)))
+	require.NoError(t, outbox.Delete(ctx, WithWhere(EqString("k", "v"))))
+	require.NoError(t, outbox.Update(ctx, WithIDs("1"), WithTexts("c")))
+	flushOutbox(t, outbox)
+
+	calls := collection.received()
+	require.Len(t, calls, 3)
+	require.Equal(t, OutboxAdd, calls[0].op)
+	require.Equal(t, []DocumentID{"1", "2"}, calls[0].ids)
+	require.Equal(t, []string{"a", "b"}, calls[0].texts)
+	require.Equal(t, 2, calls[0].embeddings, "texts must be embedded before they are queued")
+	scores, ok := calls[0].metadatas[0].GetFloatArray("scores")
+	require.True(t, ok, "metadata types must survive the log")
+	require.Equal(t, []float64{1, 2}, scores)
+	require.Equal(t, OutboxDelete, calls[1].op)
+	require.JSONEq(t, `{"k":{"$eq":"v"}}`, calls[1].where)
+	require.Equal(t, OutboxUpdate, calls[2].op)
+
+	stats := outbox.Stats()
+	require.Zero(t, stats.PendingOps)
+	require.Equal(t, uint64(3), stats.SentOps)
+	require.Equal(t, uint64(4), stats.SentRecords)
+	require.Zero(t, stats.LogBytes)
+}
+
+func TestOutboxCoalescesUpserts(t *testing.T) {
+	collection := &outboxTestCollection{}
+	collection.setFail(func(outboxTestCall) error { return errOutboxTestOffline })
+	outbox := newTestOutbox(t, collection, t.TempDir(), WithOutboxRetry(time.Hour, time.Hour))
+	ctx := context.Background()
+
+	require.NoError(t, outbox.Upsert(ctx, WithIDs("1", "2"), WithTexts("a", "b")))
+	require.NoError(t, outbox.Upsert(ctx, WithIDs("2", "3"), WithTexts("b2", "c")))
+	require.NoError(t, outbox.Upsert(ctx, WithIDs("1"), WithTexts("a2")))
+	require.NoError(t, outbox.Add(ctx, WithIDs("4"), WithTexts("d")))
+	stats := outbox.Stats()
+	require.Equal(t, 4, stats.PendingOps)
+	require.Equal(t, 6, stats.PendingRecords)
+	require.False(t, stats.OldestPending.IsZero())
+	require.Eventually(t, func() bool { return outbox.Stats().Retries > 0 }, 5*time.Second, time.Millisecond)
+
+	collection.setFail(nil)
+	flushOutbox(t, outbox)
+
+	calls := collection.received()
+	require.Len(t, calls, 2)
+	require.Equal(t, OutboxUpsert, calls[0].op)
+	require.Equal(t, []DocumentID{"1", "2", "3"}, calls[0].ids)
+	require.Equal(t, []string{"a2", "b2", "c"}, calls[0].texts)
+	require.Equal(t, OutboxAdd, calls[1].op)
+
+	stats = outbox.Stats()
+	require.Equal(t, uint64(4), stats.SentOps)
+	require.Equal(t, uint64(2), stats.CoalescedRecords)
+	require.Contains(t, stats.LastError, "connection refused")
+}
+
+func TestOutboxMergesCoalescedUpsertMetadata(t *testing.T) {
+	collection := &outboxTestCollection{}
+	collection.setFail(func(outboxTestCall) error { return errOutboxTestOffline })
+	outbox := newTestOutbox(t, collection, t.TempDir(), WithOutboxRetry(time.Hour, time.Hour))
+	ctx := context.Background()
+
+	first := NewDocumentMetadata(NewIntAttribute("a", 1), NewIntAttribute("b", 1))
+	second := NewDocumentMetadata(NewIntAttribute("b", 2))
+	require.NoError(t, outbox.Upsert(ctx, WithIDs("1"), WithTexts("x"), WithMetadatas(first)))
+	require.NoError(t, outbox.Upsert(ctx, WithIDs("1"), WithTexts("y"), WithMetadatas(second)))
+	require.Eventually(t, func() bool { return outbox.Stats().Retries > 0 }, 5*time.Second, time.Millisecond)
+	collection.setFail(nil)
+	flushOutbox(t, outbox)
+
+	calls := collection.received()
+	require.Len(t, calls, 1)
+	require.Equal(t, []string{"y"}, calls[0].texts)
+	a, ok := calls[0].metadatas[0].GetInt("a")
+	require.True(t, ok, "keys of the earlier upsert must be kept")
+	require.Equal(t, int64(1), a)
+	b, ok := calls[0].metadatas[0].GetInt("b")
+	require.True(t, ok)
+	require.Equal(t, int64(2), b)
+}
+
+func TestOutboxReplaysAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	offline := &outboxTestCollection{}
+	offline.setFail(func(outboxTestCall) error { return errOutboxTestOffline })
+	outbox := newTestOutbox(t, offline, dir, WithOutboxBatchSize(2), WithOutboxRetry(time.Hour, time.Hour))
+	ctx := context.Background()
+	require.NoError(t, outbox.Add(ctx, WithIDs("1", "2", "3"), WithTexts("a", "b", "c")))
+	require.NoError(t, outbox.Delete(ctx, WithIDs("1")))
+	require.Equal(t, 3, outbox.Stats().PendingOps, "writes larger than the batch size are queued in parts")
+	require.NoError(t, outbox.Close())
+	require.ErrorIs(t, outbox.Add(ctx, WithIDs("4"), WithTexts("d")), ErrOutboxClosed)
+
+	// a partial entry written during a crash is dropped
+	logFile, err := os.OpenFile(filepath.Join(dir, outboxLogFile), os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = logFile.WriteString(`{"seq":4,"op":"add","ids":["5"`)
+	require.NoError(t, err)
+	require.NoError(t, logFile.Close())
+
+	collection := &outboxTestCollection{}
+	outbox = newTestOutbox(t, collection, dir, WithOutboxBatchSize(2))
+	flushOutbox(t, outbox)
+	calls := collection.received()
+	require.Len(t, calls, 3)
+	require.Equal(t, []DocumentID{"1", "2"}, calls[0].ids)
+	require.Equal(t, []DocumentID{"3"}, calls[1].ids)
+	require.Equal(t, OutboxDelete, calls[2].op)
+
+	require.NoError(t, outbox.Add(ctx, WithIDs("6"), WithTexts("f")))
+	flushOutbox(t, outbox)
+	require.NoError(t, outbox.Close())
+
+	// replayed writes are not sent again
+	collection = &outboxTestCollection{}
+	outbox = newTestOutbox(t, collection, dir)
+	flushOutbox(t, outbox)
+	require.Empty(t, collection.received())
+}
+
+func TestOutboxDeadLettersRejectedWrites(t *testing.T) {
+	dir := t.TempDir()
+	collection := &outboxTestCollection{}
+	collection.setFail(func(call outboxTestCall) error {
+		for _, id := range call.ids {
+			if id == "bad" {
+				return &chhttp.ChromaError{ErrorCode: http.StatusUnprocessableEntity, Message: "invalid record"}
+			}
+		}
+		return nil
+	})
+	var failed [][]DocumentID
+	outbox := newTestOutbox(t, collection, dir, WithOutboxFailureHandler(func(op OutboxOperation, ids []DocumentID, err error) {
+		require.Equal(t, OutboxUpsert, op)
+		failed = append(failed, ids)
+	}))
+	ctx := context.Background()
+	require.NoError(t, outbox.Upsert(ctx, WithIDs("1"), WithTexts("a")))
+	require.NoError(t, outbox.Upsert(ctx, WithIDs("bad"), WithTexts("b")))
+	require.NoError(t, outbox.Upsert(ctx, WithIDs("3"), WithTexts("c")))
+	flushOutbox(t, outbox)
+
+	calls := collection.received()
+	require.Len(t, calls, 2, "writes merged with a rejected write are sent on their own")
+	require.Equal(t, []DocumentID{"1"}, calls[0].ids)
+	require.Equal(t, []DocumentID{"3"}, calls[1].ids)
+	require.Equal(t, [][]DocumentID{{"bad"}}, failed)
+	stats := outbox.Stats()
+	require.Equal(t, uint64(1), stats.Failed)
+	require.Equal(t, uint64(0), stats.Retries)
+
+	dead, err := os.ReadFile(filepath.Join(dir, outboxDeadLetterFile))
+	require.NoError(t, err)
+	var entry outboxEntry
+	require.NoError(t, json.Unmarshal(dead, &entry))
+	require.Equal(t, []DocumentID{"bad"}, entry.IDs)
+}
+
+func TestOutboxDeadLettersLocalErrors(t *testing.T) {
+	collection := &outboxTestCollection{}
+	collection.setFail(func(call outboxTestCall) error {
+		if call.ids[0] == "1" {
+			return errors.New("embedding dimension mismatch")
+		}
+		return nil
+	})
+	var failed []DocumentID
+	outbox := newTestOutbox(t, collection, t.TempDir(), WithOutboxRetry(time.Hour, time.Hour),
+		WithOutboxFailureHandler(func(_ OutboxOperation, ids []DocumentID, _ error) {
+			failed = append(failed, ids...)
+		}))
+	ctx := context.Background()
+	require.NoError(t, outbox.Add(ctx, WithIDs("1"), WithTexts("a")))
+	require.NoError(t, outbox.Delete(ctx, WithIDs("2")))
+	flushOutbox(t, outbox)
+
+	require.Equal(t, []DocumentID{"1"}, failed)
+	calls := collection.received()
+	require.Len(t, calls, 1, "a rejected write must not block the writes queued after it")
+	require.Equal(t, OutboxDelete, calls[0].op)
+	stats := outbox.Stats()
+	require.Equal(t, uint64(1), stats.Failed)
+	require.Zero(t, stats.Retries)
+}
+
+func TestOutboxRecoversDamagedAck(t *testing.T) {
+	dir := t.TempDir()
+	offline := &outboxTestCollection{}
+	offline.setFail(func(outboxTestCall) error { return errOutboxTestOffline })
+	outbox := newTestOutbox(t, offline, dir, WithOutboxRetry(time.Hour, time.Hour))
+	require.NoError(t, outbox.Add(context.Background(), WithIDs("1"), WithTexts("a")))
+	require.NoError(t, outbox.Close())
+	// an ack file left empty by a power loss
+	require.NoError(t, os.WriteFile(filepath.Join(dir, outboxAckFile), nil, 0o600))
+
+	collection := &outboxTestCollection{}
+	outbox = newTestOutbox(t, collection, dir)
+	flushOutbox(t, outbox)
+	require.Len(t, collection.received(), 1)
+}
+
+func TestOutboxRetryable(t *testing.T) {
+	require.True(t, outboxRetryable(errOutboxTestOffline))
+	require.True(t, outboxRetryable(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	require.True(t, outboxRetryable(errors.Wrap(ErrCircuitOpen, "error sending request")))
+	require.True(t, outboxRetryable(errors.Wrap(&chhttp.ChromaError{ErrorCode: http.StatusTooManyRequests}, "error")))
+	require.True(t, outboxRetryable(&chhttp.ChromaError{ErrorCode: http.StatusServiceUnavailable}))
+	require.False(t, outboxRetryable(&chhttp.ChromaError{ErrorCode: http.StatusBadRequest}))
+	require.False(t, outboxRetryable(errors.New("invalid metadata")))
+}
+
+func TestOutboxMaxPending(t *testing.T) {
+	collection := &outboxTestCollection{}
+	collection.setFail(func(outboxTestCall) error { return errOutboxTestOffline })
+	outbox := newTestOutbox(t, collection, t.TempDir(), WithOutboxMaxPending(2), WithOutboxRetry(time.Hour, time.Hour))
+	ctx := context.Background()
+
+	require.NoError(t, outbox.Add(ctx, WithIDs("1", "2"), WithTexts("a", "b")))
+	require.ErrorIs(t, outbox.Add(ctx, WithIDs("3"), WithTexts("c")), ErrOutboxFull)
+
+	flushCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, outbox.Flush(flushCtx), context.DeadlineExceeded)
+}
+
+func TestOutboxOptionsValidation(t *testing.T) {
+	collection := &outboxTestCollection{}
+	_, err := NewOutbox(nil, t.TempDir())
+	require.Error(t, err)
+	_, err = NewOutbox(collection, " ")
+	require.Error(t, err)
+	_, err = NewOutbox(collection, t.TempDir(), WithOutboxBatchSize(0))
+	require.Error(t, err)
+	_, err = NewOutbox(collection, t.TempDir(), WithOutboxRetry(time.Minute, time.Second))
+	require.Error(t, err)
+}
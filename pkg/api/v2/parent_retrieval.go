@@ -0,0 +1,484 @@
+package v2
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+)
+
+// ParentScoreMode controls how the scores of the chunks matched for a parent
+// document are combined into the parent score.
+type ParentScoreMode string
+
+const (
+	// ParentScoreMax scores a parent by its best matching chunk.
+	ParentScoreMax ParentScoreMode = "max"
+	// ParentScoreSum scores a parent by the sum of its chunk relevances, favouring
+	// parents with many matching chunks.
+	ParentScoreSum ParentScoreMode = "sum"
+	// ParentScoreRRF scores a parent with Reciprocal Rank Fusion over the ranks of
+	// its chunks: sum(1 / (k + rank)).
+	ParentScoreRRF ParentScoreMode = "rrf"
+)
+
+// DefaultParentRRFK is the default RRF smoothing constant for [ParentScoreRRF].
+const DefaultParentRRFK = 60
+
+// ParentResult is a parent-level hit assembled from chunk-level results.
+type ParentResult struct {
+	// ParentID is the value of the parent key of the matched chunks. Records
+	// without the parent key are their own parent.
+	ParentID DocumentID
+	// Score is the combined parent score (higher is better).
+	Score float64
+	// Chunks are the matched chunks supporting this parent, best first. Their
+	// Score is the raw Query distance or Search score.
+	Chunks []ResultRow
+	// Siblings are all stored chunks of the parent ordered by [ChunkIndexKey].
+	// Only populated with [WithParentSiblings].
+	Siblings []ResultRow
+	// Parent is the parent record. Only populated with [WithParentRecords] and
+	// when the record exists.
+	Parent *ResultRow
+}
+
+// ParentRetriever runs Query or Search against a chunked collection and folds
+// chunk-level hits into parent-level results.
+//
+// Chunks are grouped by a parent key in their metadata ([ChunkParentIDKey] by
+// default, as written by [WithChunking]), duplicate chunk hits are dropped and
+// the chunk scores are combined with a [ParentScoreMode].
+//
+//	retriever, err := NewParentRetriever(collection,
+//	    WithParentScoreMode(ParentScoreRRF),
+//	    WithParentLimit(5),
+//	    WithParentSiblings(),
+//	)
+//	parents, err := retriever.Query(ctx, WithQueryTexts("how do I reset my password?"), WithNResults(50))
+//	for _, p := range parents[0] {
+//	    fmt.Println(p.ParentID, p.Score, len(p.Chunks))
+//	}
+type ParentRetriever struct {
+	collection        Collection
+	parentKey         string
+	scoreMode         ParentScoreMode
+	rrfK              int
+	limit             int
+	maxChunks         int
+	serverGroupBy     bool
+	fetchSiblings     bool
+	fetchParents      bool
+	parentsCollection Collection
+	// groupByRejected is set once the server rejected a pushed-down GroupBy
+	groupByRejected atomic.Bool
+}
+
+// ParentRetrieverOption configures a [ParentRetriever].
+type ParentRetrieverOption func(r *ParentRetriever) error
+
+// WithParentKey sets the metadata key holding the parent ID. Defaults to [ChunkParentIDKey].
+func WithParentKey(key string) ParentRetrieverOption {
+	return func(r *ParentRetriever) error {
+		if key == "" {
+			return errors.New("parent key cannot be empty")
+		}
+		r.parentKey = key
+		return nil
+	}
+}
+
+// WithParentScoreMode sets how chunk scores are combined. Defaults to [ParentScoreMax].
+func WithParentScoreMode(mode ParentScoreMode) ParentRetrieverOption {
+	return func(r *ParentRetriever) error {
+		switch mode {
+		case ParentScoreMax, ParentScoreSum, ParentScoreRRF:
+			r.scoreMode = mode
+			return nil
+		default:
+			return errors.Errorf("invalid parent score mode: %q", mode)
+		}
+	}
+}
+
+// WithParentRRFK sets the RRF smoothing constant used by [ParentScoreRRF].
+// Defaults to [DefaultParentRRFK].
+func WithParentRRFK(k int) ParentRetrieverOption {
+	return func(r *ParentRetriever) error {
+		if k < 1 {
+			return errors.New("rrf k must be >= 1")
+		}
+		r.rrfK = k
+		return nil
+	}
+}
+
+// WithParentLimit caps the number of parents returned per query. By default all
+// parents found in the chunk hits are returned.
+func WithParentLimit(limit int) ParentRetrieverOption {
+	return func(r *ParentRetriever) error {
+		if limit < 1 {
+			return errors.New("parent limit must be >= 1")
+		}
+		r.limit = limit
+		return nil
+	}
+}
+
+// WithMaxChunksPerParent caps the number of supporting chunks kept per parent.
+// With [ParentRetriever.Search] the cap is also pushed to the server as a
+// [GroupBy] on the parent key, unless [WithoutServerGroupBy] is set. Servers
+// that reject the GroupBy are detected, and the hits are grouped on the client.
+func WithMaxChunksPerParent(n int) ParentRetrieverOption {
+	return func(r *ParentRetriever) error {
+		if n < 1 {
+			return errors.New("max chunks per parent must be >= 1")
+		}
+		r.maxChunks = n
+		return nil
+	}
+}
+
+// WithoutServerGroupBy groups Search hits on the client only. Use it with
+// servers that do not support [GroupBy].
+func WithoutServerGroupBy() ParentRetrieverOption {
+	return func(r *ParentRetriever) error {
+		r.serverGroupBy = false
+		return nil
+	}
+}
+
+// WithParentSiblings fetches all chunks of every returned parent with an extra
+// [Collection.Get] and stores them in [ParentResult.Siblings].
+func WithParentSiblings() ParentRetrieverOption {
+	return func(r *ParentRetriever) error {
+		r.fetchSiblings = true
+		return nil
+	}
+}
+
+// WithParentRecords fetches the record whose ID equals the parent ID from
+// collection and stores it in [ParentResult.Parent]. A nil collection uses the
+// collection being searched.
+func WithParentRecords(collection Collection) ParentRetrieverOption {
+	return func(r *ParentRetriever) error {
+		r.fetchParents = true
+		r.parentsCollection = collection
+		return nil
+	}
+}
+
+// NewParentRetriever creates a [ParentRetriever] over a chunked collection.
+func NewParentRetriever(collection Collection, opts ...ParentRetrieverOption) (*ParentRetriever, error) {
+	if isNilInterface(collection) {
+		return nil, errors.New("collection cannot be nil")
+	}
+	r := &ParentRetriever{
+		collection:    collection,
+		parentKey:     ChunkParentIDKey,
+		scoreMode:     ParentScoreMax,
+		rrfK:          DefaultParentRRFK,
+		serverGroupBy: true,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	if isNilInterface(r.parentsCollection) {
+		r.parentsCollection = collection
+	}
+	return r, nil
+}
+
+// Query runs [Collection.Query] and returns parent results for each query, in
+// the order of the query texts or embeddings. Documents, metadatas and distances
+// are always included.
+func (r *ParentRetriever) Query(ctx context.Context, opts ...CollectionQueryOption) ([][]ParentResult, error) {
+	opts = append(opts, QueryOptionFunc(func(op *CollectionQueryOp) error {
+		op.Include = appendMissingIncludes(op.Include, IncludeDocuments, IncludeMetadatas, IncludeDistances)
+		return nil
+	}))
+	res, err := r.collection.Query(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	impl, ok := res.(*QueryResultImpl)
+	if !ok {
+		return nil, errors.Errorf("unexpected query result type %T", res)
+	}
+	return r.fold(ctx, impl.RowGroups())
+}
+
+// Search runs [Collection.Search] and returns parent results for each search
+// request. Documents, metadata and scores are always selected.
+//
+// If the server rejects the GroupBy pushed down by [WithMaxChunksPerParent], the
+// search is sent again without it and later searches of the retriever group on
+// the client only. Collections without Search, such as those of an embedded
+// local client, return an error; use [ParentRetriever.Query] with them.
+func (r *ParentRetriever) Search(ctx context.Context, opts ...SearchCollectionOption) ([][]ParentResult, error) {
+	if _, ok := r.collection.(*embeddedCollection); ok {
+		return nil, errors.New("search is not supported in embedded local mode, use ParentRetriever.Query")
+	}
+	pushGroupBy := r.serverGroupBy && r.maxChunks > 0 && !r.groupByRejected.Load()
+	res, err := r.collection.Search(ctx, r.searchOptions(opts, pushGroupBy)...)
+	if err != nil && pushGroupBy && isGroupByRejected(err) {
+		res, err = r.collection.Search(ctx, r.searchOptions(opts, false)...)
+		if err == nil {
+			r.groupByRejected.Store(true)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	impl, ok := res.(*SearchResultImpl)
+	if !ok {
+		return nil, errors.Errorf("unexpected search result type %T", res)
+	}
+	return r.fold(ctx, impl.RowGroups())
+}
+
+// searchOptions returns opts with the selected keys required for grouping and,
+// with pushGroupBy, a GroupBy on the parent key for searches without one.
+func (r *ParentRetriever) searchOptions(opts []SearchCollectionOption, pushGroupBy bool) []SearchCollectionOption {
+	return append(opts[:len(opts):len(opts)], func(query *SearchQuery) error {
+		for i := range query.Searches {
+			req := &query.Searches[i]
+			if req.Select == nil {
+				req.Select = &SearchSelect{}
+			}
+			req.Select.Keys = appendMissingKeys(req.Select.Keys, KDocument, KMetadata, KScore)
+			if pushGroupBy && req.GroupBy == nil {
+				req.GroupBy = NewGroupBy(NewMinK(r.maxChunks, KScore), K(r.parentKey))
+			}
+		}
+		return nil
+	})
+}
+
+// isGroupByRejected reports whether err is a response of a server that does not
+// understand a search with a GroupBy.
+func isGroupByRejected(err error) bool {
+	var chErr *chhttp.ChromaError
+	if !errors.As(err, &chErr) {
+		return false
+	}
+	switch chErr.ErrorCode {
+	case http.StatusBadRequest, http.StatusNotImplemented, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// Group folds chunk-level rows, best first, into parent results without calling
+// the server. Sibling and parent records are not fetched.
+func (r *ParentRetriever) Group(rows []ResultRow) []ParentResult {
+	type acc struct {
+		result *ParentResult
+		first  int
+	}
+	seen := make(map[DocumentID]struct{}, len(rows))
+	parents := make(map[DocumentID]*acc)
+	for rank, row := range rows {
+		if _, dup := seen[row.ID]; dup {
+			continue
+		}
+		seen[row.ID] = struct{}{}
+		parentID := r.parentID(row)
+		a, ok := parents[parentID]
+		if !ok {
+			a = &acc{result: &ParentResult{ParentID: parentID}, first: rank}
+			parents[parentID] = a
+		}
+		if r.maxChunks > 0 && len(a.result.Chunks) >= r.maxChunks {
+			continue
+		}
+		a.result.Chunks = append(a.result.Chunks, row)
+		switch r.scoreMode {
+		case ParentScoreSum:
+			a.result.Score += chunkRelevance(row.Score)
+		case ParentScoreRRF:
+			a.result.Score += 1 / float64(r.rrfK+rank+1)
+		default:
+			if s := chunkRelevance(row.Score); len(a.result.Chunks) == 1 || s > a.result.Score {
+				a.result.Score = s
+			}
+		}
+	}
+	accs := make([]*acc, 0, len(parents))
+	for _, a := range parents {
+		accs = append(accs, a)
+	}
+	sort.SliceStable(accs, func(i, j int) bool {
+		if accs[i].result.Score != accs[j].result.Score {
+			return accs[i].result.Score > accs[j].result.Score
+		}
+		return accs[i].first < accs[j].first
+	})
+	if r.limit > 0 && len(accs) > r.limit {
+		accs = accs[:r.limit]
+	}
+	results := make([]ParentResult, len(accs))
+	for i, a := range accs {
+		results[i] = *a.result
+	}
+	return results
+}
+
+func (r *ParentRetriever) fold(ctx context.Context, groups [][]ResultRow) ([][]ParentResult, error) {
+	results := make([][]ParentResult, len(groups))
+	parentIDs := make([]string, 0)
+	seen := make(map[DocumentID]struct{})
+	for i, rows := range groups {
+		results[i] = r.Group(rows)
+		for _, p := range results[i] {
+			if _, ok := seen[p.ParentID]; !ok {
+				seen[p.ParentID] = struct{}{}
+				parentIDs = append(parentIDs, string(p.ParentID))
+			}
+		}
+	}
+	if len(parentIDs) == 0 {
+		return results, nil
+	}
+	if r.fetchSiblings {
+		siblings, err := r.getSiblings(ctx, parentIDs)
+		if err != nil {
+			return nil, errors.Wrap(err, "error fetching sibling chunks")
+		}
+		for i := range results {
+			for j := range results[i] {
+				results[i][j].Siblings = siblings[results[i][j].ParentID]
+			}
+		}
+	}
+	if r.fetchParents {
+		parents, err := r.getParents(ctx, parentIDs)
+		if err != nil {
+			return nil, errors.Wrap(err, "error fetching parent records")
+		}
+		for i := range results {
+			for j := range results[i] {
+				if parent, ok := parents[results[i][j].ParentID]; ok {
+					parent := parent
+					results[i][j].Parent = &parent
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+func (r *ParentRetriever) getSiblings(ctx context.Context, parentIDs []string) (map[DocumentID][]ResultRow, error) {
+	res, err := r.collection.Get(ctx,
+		WithWhere(InString(K(r.parentKey), parentIDs...)),
+		WithInclude(IncludeDocuments, IncludeMetadatas),
+	)
+	if err != nil {
+		return nil, err
+	}
+	impl, ok := res.(*GetResultImpl)
+	if !ok {
+		return nil, errors.Errorf("unexpected get result type %T", res)
+	}
+	siblings := make(map[DocumentID][]ResultRow)
+	for _, row := range impl.Rows() {
+		parentID := r.parentID(row)
+		siblings[parentID] = append(siblings[parentID], row)
+	}
+	for _, rows := range siblings {
+		sort.SliceStable(rows, func(i, j int) bool {
+			return chunkIndex(rows[i]) < chunkIndex(rows[j])
+		})
+	}
+	return siblings, nil
+}
+
+func (r *ParentRetriever) getParents(ctx context.Context, parentIDs []string) (map[DocumentID]ResultRow, error) {
+	ids := make([]DocumentID, len(parentIDs))
+	for i, id := range parentIDs {
+		ids[i] = DocumentID(id)
+	}
+	res, err := r.parentsCollection.Get(ctx,
+		WithIDs(ids...),
+		WithInclude(IncludeDocuments, IncludeMetadatas),
+	)
+	if err != nil {
+		return nil, err
+	}
+	impl, ok := res.(*GetResultImpl)
+	if !ok {
+		return nil, errors.Errorf("unexpected get result type %T", res)
+	}
+	parents := make(map[DocumentID]ResultRow)
+	for _, row := range impl.Rows() {
+		parents[row.ID] = row
+	}
+	return parents, nil
+}
+
+func (r *ParentRetriever) parentID(row ResultRow) DocumentID {
+	if !isNilInterface(row.Metadata) {
+		if id, ok := row.Metadata.GetString(r.parentKey); ok && id != "" {
+			return DocumentID(id)
+		}
+	}
+	return row.ID
+}
+
+// chunkRelevance maps a distance-like chunk score (lower is better) to a
+// relevance in (0, 1] (higher is better).
+func chunkRelevance(score float64) float64 {
+	if score < 0 {
+		score = 0
+	}
+	return 1 / (1 + score)
+}
+
+func chunkIndex(row ResultRow) int64 {
+	if isNilInterface(row.Metadata) {
+		return 0
+	}
+	idx, _ := row.Metadata.GetInt(ChunkIndexKey)
+	return idx
+}
+
+func appendMissingIncludes(include []Include, required ...Include) []Include {
+	for _, req := range required {
+		found := false
+		for _, inc := range include {
+			if inc == req {
+				found = true
+				break
+			}
+		}
+		if !found {
+			include = append(include, req)
+		}
+	}
+	return include
+}
+
+func appendMissingKeys(keys []Key, required ...Key) []Key {
+	for _, req := range required {
+		found := false
+		for _, k := range keys {
+			if k == req {
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys = append(keys, req)
+		}
+	}
+	return keys
+}
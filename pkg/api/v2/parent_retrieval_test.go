@@ -0,0 +1,234 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+func chunkRow(id, parent string, score float64) ResultRow {
+	return ResultRow{
+		ID:       DocumentID(id),
+		Metadata: NewDocumentMetadata(NewStringAttribute(ChunkParentIDKey, parent)),
+		Score:    score,
+	}
+}
+
+func TestParentRetrieverGroup(t *testing.T) {
+	rows := []ResultRow{
+		chunkRow("a#0", "a", 0.1),
+		chunkRow("b#0", "b", 0.2),
+		chunkRow("b#1", "b", 0.3),
+		chunkRow("b#1", "b", 0.3), // duplicate hit
+		{ID: "standalone", Score: 0.4},
+		chunkRow("b#2", "b", 0.5),
+	}
+
+	t.Run("max", func(t *testing.T) {
+		r, err := NewParentRetriever(&CollectionImpl{})
+		require.NoError(t, err)
+		parents := r.Group(rows)
+		require.Len(t, parents, 3)
+		require.Equal(t, DocumentID("a"), parents[0].ParentID)
+		require.Equal(t, DocumentID("b"), parents[1].ParentID)
+		require.Len(t, parents[1].Chunks, 3)
+		require.Equal(t, DocumentID("standalone"), parents[2].ParentID)
+		require.InDelta(t, 1/1.1, parents[0].Score, 1e-9)
+	})
+
+	t.Run("sum favours parents with many chunks", func(t *testing.T) {
+		r, err := NewParentRetriever(&CollectionImpl{}, WithParentScoreMode(ParentScoreSum))
+		require.NoError(t, err)
+		parents := r.Group(rows)
+		require.Equal(t, DocumentID("b"), parents[0].ParentID)
+	})
+
+	t.Run("rrf", func(t *testing.T) {
+		r, err := NewParentRetriever(&CollectionImpl{}, WithParentScoreMode(ParentScoreRRF), WithParentRRFK(1))
+		require.NoError(t, err)
+		parents := r.Group(rows)
+		require.Equal(t, DocumentID("b"), parents[0].ParentID)
+		require.InDelta(t, 1.0/3+1.0/4+1.0/7, parents[0].Score, 1e-9)
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		r, err := NewParentRetriever(&CollectionImpl{}, WithParentLimit(2), WithMaxChunksPerParent(1))
+		require.NoError(t, err)
+		parents := r.Group(rows)
+		require.Len(t, parents, 2)
+		require.Len(t, parents[1].Chunks, 1)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewParentRetriever(nil)
+		require.Error(t, err)
+		_, err = NewParentRetriever(&CollectionImpl{}, WithParentScoreMode("avg"))
+		require.Error(t, err)
+		_, err = NewParentRetriever(&CollectionImpl{}, WithParentKey(""))
+		require.Error(t, err)
+		_, err = NewParentRetriever(&CollectionImpl{}, WithParentLimit(0))
+		require.Error(t, err)
+	})
+}
+
+// parentRetrievalBadRequest makes the handler of newParentRetrievalTestCollection respond with 400.
+const parentRetrievalBadRequest = "bad request"
+
+func newParentRetrievalTestCollection(t *testing.T, handler func(path string, body map[string]any) string) *CollectionImpl {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/pre-flight-checks" {
+			_, _ = w.Write([]byte(`{"max_batch_size":100}`))
+			return
+		}
+		var body map[string]any
+		require.NoError(t, json.Unmarshal([]byte(chhttp.ReadRespBody(r.Body)), &body))
+		resp := handler(r.URL.Path, body)
+		if resp == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if resp == parentRetrievalBadRequest {
+			http.Error(w, `{"error":"InvalidArgumentError","message":"unknown field group_by"}`, http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(resp))
+	}))
+	t.Cleanup(server.Close)
+	client, err := NewHTTPClient(WithBaseURL(server.URL), WithLogger(testLogger()))
+	require.NoError(t, err)
+	return &CollectionImpl{
+		name:              "test",
+		id:                "8ecf0f7e-e806-47f8-96a1-4732ef42359e",
+		tenant:            NewDefaultTenant(),
+		database:          NewDefaultDatabase(),
+		metadata:          NewMetadata(),
+		client:            client.(*APIClientV2),
+		embeddingFunction: embeddings.NewConsistentHashEmbeddingFunction(),
+	}
+}
+
+func TestParentRetrieverQuery(t *testing.T) {
+	var getBody map[string]any
+	collection := newParentRetrievalTestCollection(t, func(path string, body map[string]any) string {
+		switch {
+		case strings.HasSuffix(path, "/query"):
+			require.ElementsMatch(t, []any{"documents", "metadatas", "distances"}, body["include"])
+			return `{
+  "ids": [["a#1", "b#0", "a#0"]],
+  "documents": [["a one", "b zero", "a zero"]],
+  "metadatas": [[{"parent_id": "a", "chunk_index": 1}, {"parent_id": "b", "chunk_index": 0}, {"parent_id": "a", "chunk_index": 0}]],
+  "distances": [[0.1, 0.2, 0.3]]
+}`
+		case strings.HasSuffix(path, "/get"):
+			getBody = body
+			return `{
+  "ids": ["a#1", "a#0", "b#0"],
+  "documents": ["a one", "a zero", "b zero"],
+  "metadatas": [{"parent_id": "a", "chunk_index": 1}, {"parent_id": "a", "chunk_index": 0}, {"parent_id": "b", "chunk_index": 0}]
+}`
+		}
+		return ""
+	})
+
+	retriever, err := NewParentRetriever(collection, WithParentSiblings())
+	require.NoError(t, err)
+	results, err := retriever.Query(context.Background(), WithQueryTexts("query"), WithInclude(IncludeDocuments))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Len(t, results[0], 2)
+
+	a := results[0][0]
+	require.Equal(t, DocumentID("a"), a.ParentID)
+	require.Len(t, a.Chunks, 2)
+	require.Len(t, a.Siblings, 2)
+	require.Equal(t, DocumentID("a#0"), a.Siblings[0].ID)
+	require.Equal(t, DocumentID("a#1"), a.Siblings[1].ID)
+	require.Equal(t, DocumentID("b"), results[0][1].ParentID)
+
+	require.Equal(t, map[string]any{"parent_id": map[string]any{"$in": []any{"a", "b"}}}, getBody["where"])
+}
+
+func TestParentRetrieverSearchUsesServerGroupBy(t *testing.T) {
+	var searchBody map[string]any
+	collection := newParentRetrievalTestCollection(t, func(path string, body map[string]any) string {
+		switch {
+		case strings.HasSuffix(path, "/search"):
+			searchBody = body
+			return `{"ids": [["a#0", "b#0"]], "metadatas": [[{"parent_id": "a"}, {"parent_id": "b"}]], "scores": [[0.1, 0.2]]}`
+		case strings.HasSuffix(path, "/get"):
+			return `{"ids": ["a"], "documents": ["full document a"]}`
+		}
+		return ""
+	})
+
+	retriever, err := NewParentRetriever(collection, WithMaxChunksPerParent(2), WithParentRecords(nil))
+	require.NoError(t, err)
+	results, err := retriever.Search(context.Background(), NewSearchRequest(WithKnnRank(KnnQueryText("query"))))
+	require.NoError(t, err)
+	require.Len(t, results[0], 2)
+	require.NotNil(t, results[0][0].Parent)
+	require.Equal(t, "full document a", results[0][0].Parent.Document)
+	require.Nil(t, results[0][1].Parent)
+
+	searches := searchBody["searches"].([]any)
+	search := searches[0].(map[string]any)
+	require.Equal(t, map[string]any{
+		"keys":      []any{"parent_id"},
+		"aggregate": map[string]any{"$min_k": map[string]any{"keys": []any{"#score"}, "k": float64(2)}},
+	}, search["group_by"])
+	require.ElementsMatch(t, []any{"#document", "#metadata", "#score"}, search["select"].(map[string]any)["keys"])
+
+	t.Run("falls back to client grouping when the server rejects group by", func(t *testing.T) {
+		var searches []map[string]any
+		collection := newParentRetrievalTestCollection(t, func(path string, body map[string]any) string {
+			search := body["searches"].([]any)[0].(map[string]any)
+			searches = append(searches, search)
+			if _, ok := search["group_by"]; ok {
+				return parentRetrievalBadRequest
+			}
+			return `{"ids": [["a#0", "a#1", "b#0"]], "metadatas": [[{"parent_id": "a"}, {"parent_id": "a"}, {"parent_id": "b"}]], "scores": [[0.1, 0.2, 0.3]]}`
+		})
+		retriever, err := NewParentRetriever(collection, WithMaxChunksPerParent(1))
+		require.NoError(t, err)
+
+		results, err := retriever.Search(context.Background(), NewSearchRequest(WithKnnRank(KnnQueryText("query"))))
+		require.NoError(t, err)
+		require.Len(t, results[0], 2)
+		require.Len(t, results[0][0].Chunks, 1, "the chunk cap is applied on the client")
+		require.Len(t, searches, 2)
+		require.Contains(t, searches[0], "group_by")
+		require.NotContains(t, searches[1], "group_by")
+
+		_, err = retriever.Search(context.Background(), NewSearchRequest(WithKnnRank(KnnQueryText("query"))))
+		require.NoError(t, err)
+		require.Len(t, searches, 3, "the rejection is remembered")
+		require.NotContains(t, searches[2], "group_by")
+	})
+
+	t.Run("embedded collections have no search", func(t *testing.T) {
+		retriever, err := NewParentRetriever(&embeddedCollection{})
+		require.NoError(t, err)
+		_, err = retriever.Search(context.Background(), NewSearchRequest(WithKnnRank(KnnQueryText("query"))))
+		require.ErrorContains(t, err, "use ParentRetriever.Query")
+	})
+
+	t.Run("without server group by", func(t *testing.T) {
+		retriever, err := NewParentRetriever(collection, WithMaxChunksPerParent(2), WithoutServerGroupBy())
+		require.NoError(t, err)
+		_, err = retriever.Search(context.Background(), NewSearchRequest(WithKnnRank(KnnQueryText("query"))))
+		require.NoError(t, err)
+		search := searchBody["searches"].([]any)[0].(map[string]any)
+		require.NotContains(t, search, "group_by")
+	})
+}
@@ -41,6 +41,13 @@ func WithRecordEmbedding(embedding embeddings.Embedding) RecordOption {
 	}
 }
 
+func WithRecordDocument(document string) RecordOption {
+	return func(r *SimpleRecord) error {
+		r.document = document
+		return nil
+	}
+}
+
 func WithRecordMetadatas(metadata DocumentMetadata) RecordOption {
 	return func(r *SimpleRecord) error {
 		r.metadata = metadata
@@ -0,0 +1,224 @@
+package v2
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// Codes of [RecordValidationIssue].
+const (
+	RecordIssueDimensionMismatch = "dimension_mismatch"
+	RecordIssueReservedKey       = "reserved_key"
+	RecordIssueInvalidKey        = "invalid_key"
+	RecordIssueTypeMismatch      = "type_mismatch"
+)
+
+// RecordValidationIssue describes why a record failed validation before a write.
+type RecordValidationIssue struct {
+	// Index is the position of the record in the write.
+	Index int
+	ID    DocumentID
+	// Field is "embedding" or "metadata.<key>".
+	Field   string
+	Code    string
+	Message string
+}
+
+// RecordValidationError is returned by Add, Upsert and Update when records fail
+// client-side validation. Nothing is embedded or sent when it is returned for the
+// records as given; it is returned after embedding when computed embeddings do
+// not match the collection.
+type RecordValidationError struct {
+	Issues []RecordValidationIssue
+}
+
+// Error implements error.
+func (e *RecordValidationError) Error() string {
+	if e == nil || len(e.Issues) == 0 {
+		return "record validation failed"
+	}
+	first := e.Issues[0]
+	summary := fmt.Sprintf("record %d (id %q) %s: %s", first.Index, first.ID, first.Field, first.Message)
+	if len(e.Issues) == 1 {
+		return "record validation failed: " + summary
+	}
+	return fmt.Sprintf("record validation failed: %s (and %d more issue(s))", summary, len(e.Issues)-1)
+}
+
+func (e *RecordValidationError) addIssue(index int, id DocumentID, field, code, format string, args ...any) {
+	e.Issues = append(e.Issues, RecordValidationIssue{
+		Index:   index,
+		ID:      id,
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// WriteConstraints are the collection properties records are validated against
+// before they are written. Zero values disable the corresponding checks.
+type WriteConstraints struct {
+	// Dimension is the embedding dimension of the collection, 0 while unknown.
+	Dimension int
+	// EmbeddingFunctionDimension is the dimension of the embeddings the collection's
+	// embedding function computes, 0 if unknown.
+	EmbeddingFunctionDimension int
+	// Schema constrains the metadata value types of the keys it configures.
+	Schema *Schema
+}
+
+// embeddingFunctionDimension returns the output dimension of ef if it is known from
+// a Dimension method or its dimensions configuration, 0 otherwise.
+func embeddingFunctionDimension(ef embeddings.EmbeddingFunction) int {
+	if isNilInterface(ef) {
+		return 0
+	}
+	if d, ok := ef.(interface{ Dimension() int }); ok {
+		return d.Dimension()
+	}
+	return configDimension(ef.GetConfig())
+}
+
+// configDimension returns the dimensions of an embedding function configuration, 0 if unset.
+func configDimension(cfg embeddings.EmbeddingFunctionConfig) int {
+	for _, key := range []string{"dimensions", "dimension"} {
+		if dim, ok := embeddings.ConfigInt(cfg, key); ok && dim > 0 {
+			return dim
+		}
+	}
+	return 0
+}
+
+// validateRecords checks embedding dimensions and metadata of the records of a write.
+// embed reports whether documents will be embedded with the embedding function.
+func validateRecords(constraints WriteConstraints, ids []DocumentID, embs []any, metadatas []DocumentMetadata, embed bool) error {
+	if embed && constraints.Dimension > 0 && constraints.EmbeddingFunctionDimension > 0 &&
+		constraints.Dimension != constraints.EmbeddingFunctionDimension {
+		return errors.Errorf("embedding function produces %d-dimensional embeddings, the collection has dimension %d",
+			constraints.EmbeddingFunctionDimension, constraints.Dimension)
+	}
+	validationErr := &RecordValidationError{}
+	id := func(i int) DocumentID {
+		if i < len(ids) {
+			return ids[i]
+		}
+		return ""
+	}
+
+	expected, source := constraints.Dimension, "collection dimension"
+	for i, e := range embs {
+		emb, ok := e.(embeddings.Embedding)
+		if !ok || isNilInterface(emb) || !emb.IsDefined() {
+			continue
+		}
+		if expected == 0 {
+			// all embeddings of a write must have the same dimension
+			expected, source = emb.Len(), fmt.Sprintf("dimension of record %d", i)
+			continue
+		}
+		if emb.Len() != expected {
+			validationErr.addIssue(i, id(i), "embedding", RecordIssueDimensionMismatch,
+				"embedding has dimension %d, expected %d (%s)", emb.Len(), expected, source)
+		}
+	}
+
+	for i, md := range metadatas {
+		impl, ok := md.(*DocumentMetadataImpl)
+		if !ok || impl == nil {
+			continue
+		}
+		for key, value := range impl.metadata {
+			field := "metadata." + key
+			switch {
+			case key == "":
+				validationErr.addIssue(i, id(i), field, RecordIssueInvalidKey, "metadata keys cannot be empty")
+			case strings.HasPrefix(key, "#"):
+				validationErr.addIssue(i, id(i), field, RecordIssueReservedKey, "keys starting with '#' are reserved")
+			default:
+				if msg := constraints.Schema.checkMetadataValue(key, value); msg != "" {
+					validationErr.addIssue(i, id(i), field, RecordIssueTypeMismatch, "%s", msg)
+				}
+			}
+		}
+	}
+	if len(validationErr.Issues) > 0 {
+		return validationErr
+	}
+	return nil
+}
+
+// checkMetadataValue returns why value cannot be stored at key, or "" if it can.
+// Keys the schema does not configure accept any value type. A configured key
+// accepts the value types that have index settings for it, enabled or not; an
+// int is also accepted where floats are.
+func (s *Schema) checkMetadataValue(key string, value MetadataValue) string {
+	if s == nil || value.NilValue {
+		return ""
+	}
+	vt, ok := s.keys[key]
+	if !ok || vt == nil {
+		return ""
+	}
+	var got string
+	switch {
+	case value.StringValue != nil || value.StringArray != nil:
+		got = "string"
+		if vt.String != nil {
+			return ""
+		}
+	case value.Int != nil || value.IntArray != nil:
+		got = "int"
+		if vt.Int != nil || vt.Float != nil {
+			return ""
+		}
+	case value.Float64 != nil || value.FloatArray != nil:
+		got = "float"
+		if vt.Float != nil {
+			return ""
+		}
+	case value.Bool != nil || value.BoolArray != nil:
+		got = "bool"
+		if vt.Bool != nil {
+			return ""
+		}
+	default:
+		return ""
+	}
+	allowed := make([]string, 0, 4)
+	for name, configured := range map[string]bool{
+		"string":        vt.String != nil,
+		"int":           vt.Int != nil,
+		"float":         vt.Float != nil,
+		"bool":          vt.Bool != nil,
+		"sparse vector": vt.SparseVector != nil,
+		"float list":    vt.FloatList != nil,
+	} {
+		if configured {
+			allowed = append(allowed, name)
+		}
+	}
+	if len(allowed) == 0 {
+		return ""
+	}
+	sort.Strings(allowed)
+	return fmt.Sprintf("schema configures %s for this key, got %s", strings.Join(allowed, ", "), got)
+}
+
+// ValidateRecords checks the records against the collection constraints: embedding
+// dimensions, reserved metadata keys and the metadata value types configured in the
+// schema. Violations are returned as a [*RecordValidationError].
+// Call it after [CollectionAddOp.PrepareAndValidate].
+func (c *CollectionAddOp) ValidateRecords(constraints WriteConstraints) error {
+	return validateRecords(constraints, c.Ids, c.Embeddings, c.Metadatas, len(c.Documents) > 0 && len(c.Embeddings) == 0)
+}
+
+// ValidateRecords checks the records against the collection constraints, see
+// [CollectionAddOp.ValidateRecords]. Call it after [CollectionUpdateOp.PrepareAndValidate].
+func (c *CollectionUpdateOp) ValidateRecords(constraints WriteConstraints) error {
+	return validateRecords(constraints, c.Ids, c.Embeddings, c.Metadatas, len(c.Documents) > 0 && len(c.Embeddings) == 0)
+}
@@ -0,0 +1,139 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+type countingEmbeddingFunction struct {
+	mockEmbeddingFunction
+	dim   int
+	calls atomic.Int32
+}
+
+func (m *countingEmbeddingFunction) EmbedDocuments(_ context.Context, texts []string) ([]embeddings.Embedding, error) {
+	m.calls.Add(1)
+	result := make([]embeddings.Embedding, len(texts))
+	for i := range texts {
+		result[i] = embeddings.NewEmbeddingFromFloat32(make([]float32, m.dim))
+	}
+	return result, nil
+}
+
+func newValidationTestCollection(t *testing.T, writes *atomic.Int32) *CollectionImpl {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "pre-flight-checks") {
+			_ = json.NewEncoder(w).Encode(map[string]any{"max_batch_size": 100})
+			return
+		}
+		writes.Add(1)
+		_, _ = io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	t.Cleanup(srv.Close)
+	client := newResilientClient(t, WithBaseURL(srv.URL))
+	return &CollectionImpl{client: client, tenant: NewDefaultTenant(), database: NewDefaultDatabase(), id: "c1"}
+}
+
+func TestValidateRecordsDimension(t *testing.T) {
+	emb := func(values ...float32) embeddings.Embedding { return embeddings.NewEmbeddingFromFloat32(values) }
+	op, err := NewCollectionAddOp(WithIDs("1", "2", "3"), WithEmbeddings(emb(1, 2), emb(1, 2, 3), emb(1)))
+	require.NoError(t, err)
+	require.NoError(t, op.PrepareAndValidate())
+
+	err = op.ValidateRecords(WriteConstraints{Dimension: 2})
+	var validationErr *RecordValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Issues, 2)
+	require.Equal(t, RecordValidationIssue{
+		Index: 1, ID: "2", Field: "embedding", Code: RecordIssueDimensionMismatch,
+		Message: "embedding has dimension 3, expected 2 (collection dimension)",
+	}, validationErr.Issues[0])
+	require.Equal(t, 2, validationErr.Issues[1].Index)
+	require.Contains(t, err.Error(), `record 1 (id "2") embedding`)
+	require.Contains(t, err.Error(), "(and 1 more issue(s))")
+
+	// without a collection dimension the first embedding sets the expected dimension
+	err = op.ValidateRecords(WriteConstraints{})
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Issues, 2)
+	require.Contains(t, validationErr.Issues[0].Message, "dimension of record 0")
+}
+
+func TestValidateRecordsMetadata(t *testing.T) {
+	schema, err := NewSchema(WithStringIndex("category"), WithFloatIndex("price"))
+	require.NoError(t, err)
+	op, err := NewCollectionUpdateOp(
+		WithIDsUpdate("1", "2"),
+		WithMetadatasUpdate(
+			NewDocumentMetadata(NewStringAttribute("category", "a"), NewIntAttribute("price", 3), NewStringAttribute("free", "x")),
+			NewDocumentMetadata(NewIntAttribute("category", 1), NewStringAttribute("#document", "x")),
+		),
+	)
+	require.NoError(t, err)
+	require.NoError(t, op.PrepareAndValidate())
+
+	err = op.ValidateRecords(WriteConstraints{Schema: schema})
+	var validationErr *RecordValidationError
+	require.True(t, errors.As(err, &validationErr))
+	codes := map[string]string{}
+	for _, issue := range validationErr.Issues {
+		require.Equal(t, 1, issue.Index)
+		require.Equal(t, DocumentID("2"), issue.ID)
+		codes[issue.Field] = issue.Code
+	}
+	require.Equal(t, map[string]string{
+		"metadata.category":  RecordIssueTypeMismatch,
+		"metadata.#document": RecordIssueReservedKey,
+	}, codes)
+
+	op.Metadatas = op.Metadatas[:1]
+	require.NoError(t, op.ValidateRecords(WriteConstraints{Schema: schema}))
+}
+
+func TestAddValidatesBeforeEmbedding(t *testing.T) {
+	var writes atomic.Int32
+	col := newValidationTestCollection(t, &writes)
+	ef := &countingEmbeddingFunction{
+		mockEmbeddingFunction: mockEmbeddingFunction{name: "counting", config: embeddings.EmbeddingFunctionConfig{"dimensions": 3}},
+		dim:                   3,
+	}
+	col.embeddingFunction = ef
+	col.dimension = 4
+
+	err := col.Add(context.Background(), WithIDs("1"), WithTexts("hello"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "embedding function produces 3-dimensional embeddings, the collection has dimension 4")
+	require.Equal(t, int32(0), ef.calls.Load(), "documents are not embedded")
+	require.Equal(t, int32(0), writes.Load())
+
+	err = col.Upsert(context.Background(), WithIDs("1"), WithEmbeddings(embeddings.NewEmbeddingFromFloat32([]float32{1, 2})))
+	var validationErr *RecordValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, int32(0), writes.Load())
+
+	// computed embeddings are validated when the EF dimension is not known upfront
+	ef.config = embeddings.EmbeddingFunctionConfig{}
+	err = col.Add(context.Background(), WithIDs("1"), WithTexts("hello"))
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, int32(1), ef.calls.Load())
+	require.Equal(t, int32(0), writes.Load())
+
+	ef.dim = 4
+	require.NoError(t, col.Add(context.Background(), WithIDs("1"), WithTexts("hello")))
+	require.Equal(t, int32(1), writes.Load())
+}
@@ -0,0 +1,421 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+const (
+	// DefaultGetStreamPageSize is the number of records Collection.GetStream fetches per request.
+	DefaultGetStreamPageSize = 1000
+
+	// float32SlabVectors is the number of vectors decoded embeddings are carved from
+	// per allocation, up to maxFloat32Slab floats.
+	float32SlabVectors = 64
+	maxFloat32Slab     = 1 << 20
+)
+
+// float32BufferPool holds scratch buffers vectors are decoded into before their length is known.
+var float32BufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]float32, 0, 1536)
+		return &buf
+	},
+}
+
+// WithGetStreamPageSize sets the number of records [Collection.GetStream] fetches per
+// request. Defaults to [DefaultGetStreamPageSize]. It has no effect on [Collection.Get].
+func WithGetStreamPageSize(pageSize int) GetOption {
+	return GetOptionFunc(func(op *CollectionGetOp) error {
+		if pageSize <= 0 {
+			return errors.New("stream page size must be greater than 0")
+		}
+		op.StreamPageSize = pageSize
+		return nil
+	})
+}
+
+// streamGetRows pages through the records matching opts with get and calls fn for each row.
+func streamGetRows(ctx context.Context, get func(context.Context, ...CollectionGetOption) (GetResult, error), fn func(row ResultRow) error, opts ...CollectionGetOption) error {
+	if fn == nil {
+		return errors.New("row callback cannot be nil")
+	}
+	op, err := NewCollectionGetOp(opts...)
+	if err != nil {
+		return err
+	}
+	pageSize := op.StreamPageSize
+	if pageSize == 0 {
+		pageSize = DefaultGetStreamPageSize
+	}
+	offset, remaining := op.Offset, op.Limit
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		limit := pageSize
+		if op.Limit > 0 && remaining < limit {
+			limit = remaining
+		}
+		// later options take precedence
+		pageOpts := append(opts[:len(opts):len(opts)], WithLimit(limit), WithOffset(offset))
+		page, err := get(ctx, pageOpts...)
+		if err != nil {
+			return errors.Wrapf(err, "error getting records at offset %d", offset)
+		}
+		rows, ok := page.(interface{ Rows() []ResultRow })
+		if !ok {
+			return errors.Errorf("unsupported get result type %T", page)
+		}
+		for _, row := range rows.Rows() {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		n := page.Count()
+		offset += n
+		if op.Limit > 0 {
+			remaining -= n
+			if remaining <= 0 {
+				return nil
+			}
+		}
+		if n < limit {
+			return nil
+		}
+	}
+}
+
+// streamDecoder walks a JSON response token by token, so that large results are
+// decoded without holding the body or an intermediate map of it in memory.
+type streamDecoder struct {
+	dec     *json.Decoder
+	scratch *[]float32
+	slab    []float32
+}
+
+func newStreamDecoder(r io.Reader, useNumber bool) *streamDecoder {
+	dec := json.NewDecoder(r)
+	if useNumber {
+		dec.UseNumber()
+	}
+	return &streamDecoder{dec: dec, scratch: float32BufferPool.Get().(*[]float32)}
+}
+
+func (d *streamDecoder) release() {
+	*d.scratch = (*d.scratch)[:0]
+	float32BufferPool.Put(d.scratch)
+	d.scratch = nil
+}
+
+// open consumes the start of an object or array, it returns false for null.
+func (d *streamDecoder) open(delim json.Delim) (bool, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if tok == nil {
+		return false, nil
+	}
+	if got, ok := tok.(json.Delim); !ok || got != delim {
+		return false, errors.Errorf("expected %v, got %v", delim, tok)
+	}
+	return true, nil
+}
+
+// object calls field for each key of an object, it returns false for null.
+func (d *streamDecoder) object(field func(key string) error) (bool, error) {
+	ok, err := d.open('{')
+	if !ok || err != nil {
+		return ok, err
+	}
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return true, err
+		}
+		if err := field(tok.(string)); err != nil {
+			return true, err
+		}
+	}
+	_, err = d.dec.Token()
+	return true, err
+}
+
+// array calls elem for each element of an array, it returns false for null.
+func (d *streamDecoder) array(elem func() error) (bool, error) {
+	ok, err := d.open('[')
+	if !ok || err != nil {
+		return ok, err
+	}
+	for d.dec.More() {
+		if err := elem(); err != nil {
+			return true, err
+		}
+	}
+	_, err = d.dec.Token()
+	return true, err
+}
+
+func (d *streamDecoder) skip() error {
+	depth := 0
+	for {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func (d *streamDecoder) string(kind string) (string, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return "", err
+	}
+	s, ok := tok.(string)
+	if !ok {
+		return "", errors.Errorf("invalid %s type: %T for %v", kind, tok, tok)
+	}
+	return s, nil
+}
+
+func (d *streamDecoder) float() (float64, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	switch v := tok.(type) {
+	case float64:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	default:
+		return 0, errors.Errorf("invalid number type: %T for %v", tok, tok)
+	}
+}
+
+func (d *streamDecoder) strings(kind string) ([]string, bool, error) {
+	values := make([]string, 0)
+	ok, err := d.array(func() error {
+		s, err := d.string(kind)
+		values = append(values, s)
+		return err
+	})
+	return values, ok, err
+}
+
+func (d *streamDecoder) ids() (DocumentIDs, bool, error) {
+	ids := make(DocumentIDs, 0)
+	ok, err := d.array(func() error {
+		id, err := d.string("id")
+		ids = append(ids, DocumentID(id))
+		return err
+	})
+	return ids, ok, err
+}
+
+func (d *streamDecoder) documents() (Documents, bool, error) {
+	docs := make(Documents, 0)
+	ok, err := d.array(func() error {
+		text, err := d.string("document")
+		docs = append(docs, NewTextDocument(text))
+		return err
+	})
+	return docs, ok, err
+}
+
+func (d *streamDecoder) metadatas() (DocumentMetadatas, bool, error) {
+	metadatas := make(DocumentMetadatas, 0)
+	ok, err := d.array(func() error {
+		var m map[string]interface{}
+		if err := d.dec.Decode(&m); err != nil {
+			return err
+		}
+		if m == nil {
+			metadatas = append(metadatas, nil)
+			return nil
+		}
+		metadata, err := NewDocumentMetadataFromMap(m)
+		if err != nil {
+			return err
+		}
+		metadatas = append(metadatas, metadata)
+		return nil
+	})
+	return metadatas, ok, err
+}
+
+// vector decodes an array of numbers into the pooled scratch buffer and copies it
+// to a slab shared with the following vectors.
+func (d *streamDecoder) vector() ([]float32, error) {
+	buf := (*d.scratch)[:0]
+	ok, err := d.array(func() error {
+		v, err := d.float()
+		buf = append(buf, float32(v))
+		return err
+	})
+	*d.scratch = buf
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("invalid embedding: null")
+	}
+	n := len(buf)
+	if cap(d.slab)-len(d.slab) < n {
+		d.slab = make([]float32, 0, max(n, min(n*float32SlabVectors, maxFloat32Slab)))
+	}
+	start := len(d.slab)
+	d.slab = append(d.slab, buf...)
+	// cap the capacity so appending to one embedding never overwrites the next
+	return d.slab[start:len(d.slab):len(d.slab)], nil
+}
+
+func (d *streamDecoder) embeddings() (embeddings.Embeddings, bool, error) {
+	embs := make(embeddings.Embeddings, 0)
+	ok, err := d.array(func() error {
+		vec, err := d.vector()
+		if err != nil {
+			return err
+		}
+		embs = append(embs, embeddings.NewEmbeddingFromFloat32(vec))
+		return nil
+	})
+	return embs, ok, err
+}
+
+func (d *streamDecoder) include() ([]Include, error) {
+	values, _, err := d.strings("include")
+	include := make([]Include, 0, len(values))
+	for _, v := range values {
+		include = append(include, Include(v))
+	}
+	return include, err
+}
+
+// decodeGetResult decodes a get response from r incrementally.
+func decodeGetResult(r io.Reader) (*GetResultImpl, error) {
+	d := newStreamDecoder(r, true)
+	defer d.release()
+	result := &GetResultImpl{}
+	_, err := d.object(func(key string) error {
+		var err error
+		switch key {
+		case "ids":
+			result.Ids, _, err = d.ids()
+			return errors.Wrap(err, "invalid ids")
+		case "documents":
+			result.Documents, _, err = d.documents()
+			return errors.Wrap(err, "invalid documents")
+		case "metadatas":
+			result.Metadatas, _, err = d.metadatas()
+			return errors.Wrap(err, "invalid metadatas")
+		case "embeddings":
+			result.Embeddings, _, err = d.embeddings()
+			return errors.Wrap(err, "invalid embeddings")
+		case "include":
+			result.Include, err = d.include()
+			return errors.Wrap(err, "invalid include")
+		default:
+			return d.skip()
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode GetResult")
+	}
+	return result, nil
+}
+
+// decodeQueryResult decodes a query response from r incrementally.
+func decodeQueryResult(r io.Reader) (*QueryResultImpl, error) {
+	d := newStreamDecoder(r, false)
+	defer d.release()
+	result := &QueryResultImpl{}
+	// groups decodes an array of per-query lists; null lists are only allowed for embeddings
+	groups := func(kind string, nullable bool, group func() (bool, error)) error {
+		ok, err := d.array(func() error {
+			ok, err := group()
+			if err == nil && !ok && !nullable {
+				return errors.New("null group")
+			}
+			return err
+		})
+		if err == nil && !ok && kind == "ids" {
+			return errors.New("null ids")
+		}
+		return errors.Wrapf(err, "invalid %s", kind)
+	}
+	_, err := d.object(func(key string) error {
+		switch key {
+		case "ids":
+			result.IDLists = make([]DocumentIDs, 0)
+			return groups(key, false, func() (bool, error) {
+				ids, ok, err := d.ids()
+				result.IDLists = append(result.IDLists, ids)
+				return ok, err
+			})
+		case "documents":
+			result.DocumentsLists = make([]Documents, 0)
+			return groups(key, false, func() (bool, error) {
+				docs, ok, err := d.documents()
+				result.DocumentsLists = append(result.DocumentsLists, docs)
+				return ok, err
+			})
+		case "metadatas":
+			result.MetadatasLists = make([]DocumentMetadatas, 0)
+			return groups(key, false, func() (bool, error) {
+				metadatas, ok, err := d.metadatas()
+				result.MetadatasLists = append(result.MetadatasLists, metadatas)
+				return ok, err
+			})
+		case "embeddings":
+			result.EmbeddingsLists = make([]embeddings.Embeddings, 0)
+			return groups(key, true, func() (bool, error) {
+				embs, ok, err := d.embeddings()
+				if !ok {
+					embs = nil
+				}
+				result.EmbeddingsLists = append(result.EmbeddingsLists, embs)
+				return ok, err
+			})
+		case "distances":
+			result.DistancesLists = make([]embeddings.Distances, 0)
+			return groups(key, false, func() (bool, error) {
+				distances := make(embeddings.Distances, 0)
+				ok, err := d.array(func() error {
+					v, err := d.float()
+					distances = append(distances, embeddings.Distance(v))
+					return err
+				})
+				result.DistancesLists = append(result.DistancesLists, distances)
+				return ok, err
+			})
+		case "include":
+			var err error
+			result.Include, err = d.include()
+			return errors.Wrap(err, "invalid include")
+		default:
+			return d.skip()
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode QueryResult")
+	}
+	return result, nil
+}
@@ -0,0 +1,141 @@
+//go:build basicv2 && !cloud
+
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	chhttp "github.com/amikos-tech/chroma-go/pkg/commons/http"
+)
+
+func TestDecodeGetResultMatchesUnmarshal(t *testing.T) {
+	for _, body := range []string{
+		`{"ids":["1","2"],"documents":["a","b"],"metadatas":[{"k":1,"f":1.5,"s":"v","b":true},null],"embeddings":[[0.1,2],[3,-4e-2]],"include":["documents","metadatas","embeddings"],"uris":null,"data":null}`,
+		`{"ids":[],"documents":null,"metadatas":null,"embeddings":null}`,
+		`{"ids":["1"],"unknown":{"nested":[1,{"a":[]}]},"documents":["x"]}`,
+	} {
+		expected := &GetResultImpl{}
+		require.NoError(t, json.Unmarshal([]byte(body), expected))
+		actual, err := decodeGetResult(strings.NewReader(body))
+		require.NoError(t, err, body)
+		require.Equal(t, expected, actual, body)
+	}
+
+	for _, body := range []string{`{"ids":[1]}`, `{"documents":[1]}`, `{"embeddings":[["a"]]}`, `{"metadatas":[1]}`, `{"ids":["1"]`} {
+		_, err := decodeGetResult(strings.NewReader(body))
+		require.Error(t, err, body)
+	}
+}
+
+func TestDecodeQueryResultMatchesUnmarshal(t *testing.T) {
+	for _, body := range []string{
+		`{"ids":[["1","2"],["3"]],"documents":[["a","b"],["c"]],"metadatas":[[{"k":1},null],[{"s":"v"}]],"embeddings":[[[1,2],[3,4]],null],"distances":[[0.1,0.2],[0.3]],"include":["distances"]}`,
+		`{"ids":[[]],"documents":null,"metadatas":null,"embeddings":null,"distances":null}`,
+	} {
+		expected := &QueryResultImpl{}
+		require.NoError(t, json.Unmarshal([]byte(body), expected))
+		actual, err := decodeQueryResult(strings.NewReader(body))
+		require.NoError(t, err, body)
+		require.Equal(t, expected, actual, body)
+	}
+
+	for _, body := range []string{`{"ids":null}`, `{"ids":[null]}`, `{"distances":[["x"]]}`, `{"documents":[null]}`} {
+		_, err := decodeQueryResult(strings.NewReader(body))
+		require.Error(t, err, body)
+	}
+}
+
+func TestDecodedEmbeddingsDoNotShareCapacity(t *testing.T) {
+	result, err := decodeGetResult(strings.NewReader(`{"ids":["1","2"],"embeddings":[[1,2],[3,4]]}`))
+	require.NoError(t, err)
+	first := result.Embeddings[0].ContentAsFloat32()
+	_ = append(first, 99)
+	require.Equal(t, []float32{3, 4}, result.Embeddings[1].ContentAsFloat32())
+}
+
+func TestGetResponseSizeLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"ids":["`+strings.Repeat("x", 1024)+`"]}`)
+	}))
+	defer srv.Close()
+	client := newResilientClient(t, WithBaseURL(srv.URL), WithMaxResponseSize(512))
+	col := &CollectionImpl{client: client, tenant: NewDefaultTenant(), database: NewDefaultDatabase(), id: "c1"}
+
+	_, err := col.Get(context.Background())
+	require.Error(t, err)
+	require.True(t, errors.Is(err, chhttp.ErrResponseTooLarge), err.Error())
+	require.Contains(t, err.Error(), "exceeds maximum size of 512 bytes")
+
+	_, err = client.ExecuteRequest(context.Background(), http.MethodGet, "anything", nil)
+	require.ErrorIs(t, err, chhttp.ErrResponseTooLarge)
+
+	_, err = NewHTTPClient(WithMaxResponseSize(0))
+	require.Error(t, err)
+}
+
+func TestGetStream(t *testing.T) {
+	const total = 25
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var req struct {
+			Limit  int `json:"limit"`
+			Offset int `json:"offset"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		ids, docs := []string{}, []string{}
+		for i := req.Offset; i < min(req.Offset+req.Limit, total); i++ {
+			ids = append(ids, fmt.Sprintf("id%d", i))
+			docs = append(docs, fmt.Sprintf("doc%d", i))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"ids": ids, "documents": docs})
+	}))
+	defer srv.Close()
+	client := newResilientClient(t, WithBaseURL(srv.URL))
+	col := &CollectionImpl{client: client, tenant: NewDefaultTenant(), database: NewDefaultDatabase(), id: "c1"}
+
+	var rows []ResultRow
+	err := col.GetStream(context.Background(), func(row ResultRow) error {
+		rows = append(rows, row)
+		return nil
+	}, WithGetStreamPageSize(10))
+	require.NoError(t, err)
+	require.Len(t, rows, total)
+	require.Equal(t, DocumentID("id24"), rows[24].ID)
+	require.Equal(t, "doc24", rows[24].Document)
+	require.Equal(t, int32(3), requests.Load())
+
+	t.Run("limit and offset", func(t *testing.T) {
+		rows = nil
+		err := col.GetStream(context.Background(), func(row ResultRow) error {
+			rows = append(rows, row)
+			return nil
+		}, WithGetStreamPageSize(4), WithOffset(3), WithLimit(6))
+		require.NoError(t, err)
+		require.Len(t, rows, 6)
+		require.Equal(t, DocumentID("id3"), rows[0].ID)
+		require.Equal(t, DocumentID("id8"), rows[5].ID)
+	})
+
+	t.Run("callback error stops the stream", func(t *testing.T) {
+		stop := errors.New("stop")
+		requests.Store(0)
+		err := col.GetStream(context.Background(), func(row ResultRow) error { return stop }, WithGetStreamPageSize(10))
+		require.ErrorIs(t, err, stop)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	require.Error(t, col.GetStream(context.Background(), nil))
+	require.Error(t, col.GetStream(context.Background(), func(ResultRow) error { return nil }, WithGetStreamPageSize(0)))
+}
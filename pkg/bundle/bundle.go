@@ -0,0 +1,218 @@
+// Package bundle creates, verifies and installs offline bundles of the native
+// artifacts used by chroma-go: the local Chroma shim, libtokenizers, ONNX
+// Runtime and ONNX models. A bundle is created on a host with network access,
+// copied to an air-gapped host, verified there against its manifest and the
+// release signatures, and installed into the artifact cache that the runtime
+// already searches.
+//
+// Layout of a bundle directory:
+//
+//	manifest.json
+//	checksums.sha256
+//	local-shim/<version>/SHA256SUMS[.sig|.pem|.sigstore.json]
+//	local-shim/<version>/<release archive per target>
+//	tokenizers/<version>/SHA256SUMS[.sig|.pem|.sigstore.json]
+//	tokenizers/<version>/<release archive per target>
+//	onnx-runtime/<version>/<release archive per target>
+//	onnx-models/<model>/<files>
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ManifestFile describes the contents of a bundle.
+	ManifestFile = "manifest.json"
+	// ChecksumsFile lists the SHA-256 checksums of all files of a bundle.
+	ChecksumsFile = "checksums.sha256"
+	// SchemaVersion is the manifest schema written by [Create].
+	SchemaVersion = 2
+
+	DefaultLocalShimVersion   = "v0.3.5"
+	DefaultTokenizersVersion  = "v0.1.5"
+	DefaultOnnxRuntimeVersion = "1.23.1"
+	// DefaultModel is the model of the default embedding function, always bundled.
+	DefaultModel = "all-MiniLM-L6-v2"
+)
+
+// Kinds of bundled files.
+const (
+	KindLocalShim        = "local-shim"
+	KindTokenizers       = "tokenizers"
+	KindOnnxRuntime      = "onnx-runtime"
+	KindOnnxModel        = "onnx-model"
+	KindReleaseChecksums = "release-checksums"
+	KindManifest         = "manifest"
+)
+
+// Target is a platform to bundle native libraries for.
+type Target struct {
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+	// Musl selects the musl build of libtokenizers on Linux.
+	Musl bool `json:"musl,omitempty"`
+}
+
+// String returns the target as os/arch, with a -musl suffix for musl Linux.
+func (t Target) String() string {
+	s := t.GOOS + "/" + t.GOARCH
+	if t.Musl {
+		s += "-musl"
+	}
+	return s
+}
+
+// ParseTarget parses a target in the form os/arch or linux/arch-musl.
+func ParseTarget(s string) (Target, error) {
+	goos, goarch, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok || goos == "" || goarch == "" {
+		return Target{}, errors.Errorf("invalid target %q, expected os/arch", s)
+	}
+	t := Target{GOOS: goos, GOARCH: goarch}
+	if arch, musl := strings.CutSuffix(goarch, "-musl"); musl {
+		if goos != "linux" {
+			return Target{}, errors.Errorf("invalid target %q, musl is only supported on linux", s)
+		}
+		t.GOARCH, t.Musl = arch, true
+	}
+	return t, nil
+}
+
+// HostTarget returns the target of the running host.
+func HostTarget() Target {
+	return Target{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH, Musl: isMuslLinux()}
+}
+
+// Model is an ONNX model to bundle in addition to the default model. It is
+// installed into the onnx_models cache directory Name, where the reranking and
+// embedding functions look for it.
+type Model struct {
+	// Name is the model directory, e.g. BAAI/bge-reranker-base.
+	Name string `json:"name"`
+	// Files maps each file name to its download URL.
+	Files map[string]string `json:"-"`
+	// SHA256 optionally pins the checksums of the files by file name. Files
+	// without a pinned checksum are trusted on download.
+	SHA256 map[string]string `json:"-"`
+}
+
+// HuggingFaceModel returns a model with the files used by the cross-encoder
+// reranking function: onnx/model.onnx and tokenizer.json from the main branch
+// of the Hugging Face repository name.
+func HuggingFaceModel(name string) Model {
+	base := "https://huggingface.co/" + strings.Trim(name, "/") + "/resolve/main"
+	return Model{
+		Name: name,
+		Files: map[string]string{
+			"model.onnx":     base + "/onnx/model.onnx",
+			"tokenizer.json": base + "/tokenizer.json",
+		},
+	}
+}
+
+// Manifest describes a bundle.
+type Manifest struct {
+	SchemaVersion int      `json:"schema_version"`
+	GeneratedAt   string   `json:"generated_at"`
+	Targets       []Target `json:"targets"`
+	Versions      Versions `json:"versions"`
+	Files         []File   `json:"files"`
+}
+
+// Versions are the versions of the bundled artifacts.
+type Versions struct {
+	LocalShim   string   `json:"local_shim"`
+	Tokenizers  string   `json:"tokenizers"`
+	OnnxRuntime string   `json:"onnx_runtime"`
+	OnnxModels  []string `json:"onnx_models"`
+}
+
+// File is a file of a bundle.
+type File struct {
+	// Path is relative to the bundle directory, with forward slashes.
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Kind   string `json:"kind"`
+	// Platform is set for native libraries, as named in the artifact cache,
+	// e.g. linux-amd64 or linux-amd64-musl.
+	Platform string `json:"platform,omitempty"`
+	// Version is the release of a library or release checksums file.
+	Version string `json:"version,omitempty"`
+	// Model is set for model files.
+	Model string `json:"model,omitempty"`
+	// Library is the name of the shared library inside a release archive.
+	Library string `json:"library,omitempty"`
+}
+
+// ReadManifest reads the manifest of the bundle in dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read bundle manifest")
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to parse bundle manifest")
+	}
+	if manifest.SchemaVersion != SchemaVersion {
+		return nil, errors.Errorf("unsupported bundle schema version %d, recreate the bundle with this version of chroma-go", manifest.SchemaVersion)
+	}
+	return &manifest, nil
+}
+
+func writeManifest(dir string, manifest *Manifest) error {
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode bundle manifest")
+	}
+	manifestPath := filepath.Join(dir, ManifestFile)
+	if err := os.WriteFile(manifestPath, append(data, '\n'), 0o644); err != nil {
+		return errors.Wrap(err, "failed to write bundle manifest")
+	}
+	manifestFile, err := newFile(dir, manifestPath, KindManifest)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, f := range append(manifest.Files, manifestFile) {
+		fmt.Fprintf(&b, "%s  %s\n", f.SHA256, f.Path)
+	}
+	return errors.Wrap(os.WriteFile(filepath.Join(dir, ChecksumsFile), []byte(b.String()), 0o644), "failed to write bundle checksums")
+}
+
+// files returns the files of a kind, optionally for one platform.
+func (m *Manifest) files(kind, platform string) []File {
+	var files []File
+	for _, f := range m.Files {
+		if f.Kind == kind && (platform == "" || f.Platform == platform) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func isMuslLinux() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if _, err := os.Stat("/etc/alpine-release"); err == nil {
+		return true
+	}
+	for _, ldd := range []string{"/usr/bin/ldd", "/bin/ldd"} {
+		if content, err := os.ReadFile(ldd); err == nil {
+			return strings.Contains(strings.ToLower(string(content)), "musl")
+		}
+	}
+	return false
+}
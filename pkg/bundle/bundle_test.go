@@ -0,0 +1,408 @@
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
+	"github.com/amikos-tech/chroma-go/pkg/internal/cosignutil"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func tarGz(t *testing.T, files map[string]string, symlinks map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	for name, target := range symlinks {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Linkname: target, Typeflag: tar.TypeSymlink}))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// signChecksums signs checksums like the keyless cosign signature of a release
+// workflow with identity.
+func signChecksums(t *testing.T, checksums []byte, identity string) (signature, certificate []byte) {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	identityURI, err := url.Parse(identity)
+	require.NoError(t, err)
+	issuer, err := asn1.Marshal(artifacts.GitHubActionsOIDCIssuer)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{identityURI},
+		ExtraExtensions: []pkix.Extension{{Id: cosignutil.OIDCIssuerExtensionOID(), Value: issuer}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	digest := sha256.Sum256(checksums)
+	sig, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	require.NoError(t, err)
+	return []byte(base64.StdEncoding.EncodeToString(sig)), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// fakeReleases serves release files keyed by the last two segments of their URL.
+type fakeReleases map[string][]byte
+
+func (f fakeReleases) addRelease(t *testing.T, version, identity string, archives map[string][]byte) {
+	t.Helper()
+	var sums strings.Builder
+	for name, content := range archives {
+		f[version+"/"+name] = content
+		fmt.Fprintf(&sums, "%s  %s\n", sha256Hex(content), name)
+	}
+	checksums := []byte(sums.String())
+	signature, certificate := signChecksums(t, checksums, identity)
+	f[version+"/"+artifacts.ChecksumsAsset] = checksums
+	f[version+"/"+artifacts.ChecksumsSignatureAsset] = signature
+	f[version+"/"+artifacts.ChecksumsCertificateAsset] = certificate
+}
+
+func (f fakeReleases) download(_ context.Context, dest, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	key := path.Join(path.Base(path.Dir(u.Path)), path.Base(u.Path))
+	content, ok := f[key]
+	if !ok {
+		return errors.Errorf("not found: %s", rawURL)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, content, 0o644)
+}
+
+type testBundle struct {
+	dir      string
+	releases fakeReleases
+}
+
+func trustTestCertificates(t *testing.T) artifacts.Option {
+	t.Helper()
+	noChain := artifacts.WithCertificateChainVerifier(func(*x509.Certificate) error { return nil })
+	previous := newVerifyManager
+	newVerifyManager = func() (*artifacts.Manager, error) { return artifacts.New(noChain) }
+	t.Cleanup(func() { newVerifyManager = previous })
+	return noChain
+}
+
+func newTestBundle(t *testing.T, opts ...Option) *testBundle {
+	t.Helper()
+	noChain := trustTestCertificates(t)
+	releases := fakeReleases{}
+	releases.addRelease(t, DefaultLocalShimVersion, fmt.Sprintf(artifacts.LocalShimIdentityTemplate, DefaultLocalShimVersion), map[string][]byte{
+		"local-chroma-v0.3.5-linux-amd64.tar.gz":   tarGz(t, map[string]string{"lib/libchroma_shim.so": "shim-linux"}, nil),
+		"local-chroma-v0.3.5-windows-amd64.tar.gz": tarGz(t, map[string]string{"chroma_shim.dll": "shim-windows"}, nil),
+	})
+	releases.addRelease(t, "rust-v0.1.5", fmt.Sprintf(artifacts.TokenizersIdentityTemplate, "rust-v0.1.5"), map[string][]byte{
+		"libtokenizers-x86_64-unknown-linux-gnu.tar.gz":  tarGz(t, map[string]string{"libtokenizers.so": "tokenizers-linux"}, nil),
+		"libtokenizers-x86_64-unknown-linux-musl.tar.gz": tarGz(t, map[string]string{"libtokenizers.so": "tokenizers-musl"}, nil),
+		"libtokenizers-x86_64-pc-windows-msvc.tar.gz":    tarGz(t, map[string]string{"tokenizers.dll": "tokenizers-windows"}, nil),
+	})
+	ortChecksums := map[string]string{}
+	for name, content := range map[string][]byte{
+		"onnxruntime-linux-x64-1.23.1.tgz": tarGz(t, map[string]string{
+			"onnxruntime-linux-x64-1.23.1/lib/libonnxruntime.so.1.23.1": "ort-linux",
+			"onnxruntime-linux-x64-1.23.1/include/onnxruntime_c_api.h":  "header",
+		}, map[string]string{"onnxruntime-linux-x64-1.23.1/lib/libonnxruntime.so": "libonnxruntime.so.1.23.1"}),
+		"onnxruntime-win-x64-1.23.1.zip": zipArchive(t, map[string]string{"onnxruntime-win-x64-1.23.1/lib/onnxruntime.dll": "ort-windows"}),
+	} {
+		releases["v1.23.1/"+name] = content
+		ortChecksums[name] = sha256Hex(content)
+	}
+	model := tarGz(t, map[string]string{"onnx/model.onnx": "minilm", "onnx/tokenizer.json": "{}"}, nil)
+	releases[artifacts.DefaultModelArchivePath] = model
+	previousModelSHA := defaultModelArchiveSHA256
+	defaultModelArchiveSHA256 = sha256Hex(model)
+	t.Cleanup(func() { defaultModelArchiveSHA256 = previousModelSHA })
+	releases["main/tokenizer.json"] = []byte("reranker-tokenizer")
+	releases["onnx/model.onnx"] = []byte("reranker-model")
+
+	dir := filepath.Join(t.TempDir(), "bundle")
+	opts = append([]Option{
+		WithTargets(Target{GOOS: "linux", GOARCH: "amd64"}, Target{GOOS: "windows", GOARCH: "amd64"}),
+		WithModels(HuggingFaceModel("BAAI/bge-reranker-base")),
+		withArtifactOptions(artifacts.WithDownloader(releases.download), noChain),
+		withOnnxRuntimeChecksums(func(context.Context, string) (map[string]string, error) { return ortChecksums, nil }),
+	}, opts...)
+	_, err := Create(context.Background(), dir, opts...)
+	require.NoError(t, err)
+	return &testBundle{dir: dir, releases: releases}
+}
+
+func TestParseTarget(t *testing.T) {
+	for input, want := range map[string]Target{
+		"linux/amd64":      {GOOS: "linux", GOARCH: "amd64"},
+		"linux/arm64-musl": {GOOS: "linux", GOARCH: "arm64", Musl: true},
+		" darwin/arm64 ":   {GOOS: "darwin", GOARCH: "arm64"},
+	} {
+		got, err := ParseTarget(input)
+		require.NoError(t, err, input)
+		require.Equal(t, want, got)
+		require.Equal(t, strings.TrimSpace(input), got.String())
+	}
+	for _, input := range []string{"", "linux", "/amd64", "darwin/arm64-musl"} {
+		_, err := ParseTarget(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestNormalizeVersions(t *testing.T) {
+	v, err := normalizeLocalShimVersion("0.3.5")
+	require.NoError(t, err)
+	require.Equal(t, "v0.3.5", v)
+	_, err = normalizeLocalShimVersion("latest")
+	require.Error(t, err)
+
+	for _, input := range []string{"0.1.5", "v0.1.5", "rust-v0.1.5"} {
+		v, err = normalizeTokenizersVersion(input)
+		require.NoError(t, err, input)
+		require.Equal(t, "rust-v0.1.5", v)
+	}
+
+	v, err = normalizeOnnxRuntimeVersion("v1.23.1")
+	require.NoError(t, err)
+	require.Equal(t, "1.23.1", v)
+	for _, input := range []string{"1.23", "1.x.1", "1..1"} {
+		_, err = normalizeOnnxRuntimeVersion(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestCreateVerifyInstall(t *testing.T) {
+	b := newTestBundle(t)
+
+	manifest, err := Verify(b.dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{DefaultModel, "BAAI/bge-reranker-base"}, manifest.Versions.OnnxModels)
+	platforms := map[string][]string{}
+	for _, f := range manifest.Files {
+		if f.Platform != "" {
+			platforms[f.Kind] = append(platforms[f.Kind], f.Platform)
+		}
+	}
+	require.ElementsMatch(t, []string{"linux-amd64", "windows-amd64"}, platforms[KindLocalShim])
+	require.ElementsMatch(t, []string{"linux-amd64", "windows-amd64"}, platforms[KindTokenizers])
+	require.ElementsMatch(t, []string{"linux-x64", "win-x64"}, platforms[KindOnnxRuntime])
+
+	cacheDir := t.TempDir()
+	inst, err := Install(b.dir, WithCacheDir(cacheDir), WithInstallTarget(Target{GOOS: "linux", GOARCH: "amd64"}))
+	require.NoError(t, err)
+	expected := map[string]string{
+		filepath.Join(cacheDir, "local_shim", "v0.3.5", "linux-amd64", "libchroma_shim.so"):                                 "shim-linux",
+		filepath.Join(cacheDir, "pure_tokenizers", "rust-v0.1.5", "linux-amd64", "libtokenizers.so"):                        "tokenizers-linux",
+		filepath.Join(cacheDir, "shared", "onnxruntime", "onnxruntime-linux-x64-1.23.1", "lib", "libonnxruntime.so.1.23.1"): "ort-linux",
+		filepath.Join(cacheDir, "onnx_models", DefaultModel, "onnx", "model.onnx"):                                          "minilm",
+		filepath.Join(cacheDir, "onnx_models", "BAAI", "bge-reranker-base", "model.onnx"):                                   "reranker-model",
+		filepath.Join(cacheDir, "onnx_models", "BAAI", "bge-reranker-base", "tokenizer.json"):                               "reranker-tokenizer",
+	}
+	for p, content := range expected {
+		data, err := os.ReadFile(p)
+		require.NoError(t, err, p)
+		require.Equal(t, content, string(data), p)
+	}
+	require.Equal(t, filepath.Join(cacheDir, "local_shim", "v0.3.5", "linux-amd64", "libchroma_shim.so"), inst.LocalShimLibrary)
+	require.Contains(t, inst.Env(), "TOKENIZERS_VERSION=rust-v0.1.5")
+	require.Contains(t, inst.Env(), "CHROMAGO_ONNX_RUNTIME_VERSION=1.23.1")
+	_, err = os.Stat(filepath.Join(cacheDir, "shared", "onnxruntime", "onnxruntime-linux-x64-1.23.1", "include"))
+	require.True(t, os.IsNotExist(err), "only libraries are installed")
+
+	inst, err = Install(b.dir, WithCacheDir(cacheDir), WithInstallTarget(Target{GOOS: "windows", GOARCH: "amd64"}))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(cacheDir, "shared", "onnxruntime", "onnxruntime-win-x64-1.23.1", "lib", "onnxruntime.dll"), inst.OnnxRuntimeLibrary)
+
+	_, err = Install(b.dir, WithCacheDir(cacheDir), WithInstallTarget(Target{GOOS: "linux", GOARCH: "amd64", Musl: true}))
+	require.ErrorContains(t, err, "bundle has no tokenizers library for linux-amd64-musl")
+}
+
+func TestCreateRefusesNonEmptyOutput(t *testing.T) {
+	b := newTestBundle(t)
+	_, err := Create(context.Background(), b.dir)
+	require.ErrorContains(t, err, "output directory is not empty")
+}
+
+func TestCreateRejectsUnsupportedTargetsAndModels(t *testing.T) {
+	_, err := Create(context.Background(), t.TempDir(), WithTargets(Target{GOOS: "linux", GOARCH: "arm64"}))
+	require.ErrorContains(t, err, "unsupported architecture for linux local runtime download")
+	_, err = Create(context.Background(), t.TempDir(), WithModels(Model{Name: "../escape", Files: map[string]string{"model.onnx": "https://example.com/model.onnx"}}))
+	require.ErrorContains(t, err, "invalid model name")
+	_, err = Create(context.Background(), t.TempDir(), WithModels(Model{Name: "m", Files: map[string]string{"../model.onnx": "https://example.com/model.onnx"}}))
+	require.ErrorContains(t, err, "invalid file name")
+}
+
+func TestVerifyRejectsTamperedBundles(t *testing.T) {
+	rewriteManifest := func(t *testing.T, dir string, edit func(*Manifest)) {
+		t.Helper()
+		manifest, err := ReadManifest(dir)
+		require.NoError(t, err)
+		edit(manifest)
+		require.NoError(t, writeManifest(dir, manifest))
+	}
+
+	t.Run("modified archive", func(t *testing.T) {
+		b := newTestBundle(t)
+		p := filepath.Join(b.dir, KindLocalShim, "v0.3.5", "local-chroma-v0.3.5-linux-amd64.tar.gz")
+		require.NoError(t, os.WriteFile(p, []byte("tampered"), 0o644))
+		_, err := Verify(b.dir)
+		require.ErrorContains(t, err, "local-chroma-v0.3.5-linux-amd64.tar.gz")
+	})
+
+	t.Run("archive replaced together with its manifest entry", func(t *testing.T) {
+		b := newTestBundle(t)
+		p := filepath.Join(b.dir, KindTokenizers, "rust-v0.1.5", "libtokenizers-x86_64-unknown-linux-gnu.tar.gz")
+		tampered := tarGz(t, map[string]string{"libtokenizers.so": "evil"}, nil)
+		require.NoError(t, os.WriteFile(p, tampered, 0o644))
+		rewriteManifest(t, b.dir, func(m *Manifest) {
+			for i := range m.Files {
+				if strings.HasSuffix(m.Files[i].Path, "unknown-linux-gnu.tar.gz") {
+					m.Files[i].SHA256, m.Files[i].Size = sha256Hex(tampered), int64(len(tampered))
+				}
+			}
+		})
+		_, err := Verify(b.dir)
+		require.ErrorContains(t, err, "does not match the signed checksums")
+	})
+
+	t.Run("unsigned checksums", func(t *testing.T) {
+		b := newTestBundle(t)
+		sums := filepath.Join(b.dir, KindLocalShim, "v0.3.5", artifacts.ChecksumsAsset)
+		require.NoError(t, os.WriteFile(sums, append(b.releases["v0.3.5/"+artifacts.ChecksumsAsset], '\n'), 0o644))
+		rewriteManifest(t, b.dir, func(m *Manifest) {
+			for i := range m.Files {
+				if m.Files[i].Path == path.Join(KindLocalShim, "v0.3.5", artifacts.ChecksumsAsset) {
+					checksum, err := artifacts.FileSHA256(sums)
+					require.NoError(t, err)
+					info, err := os.Stat(sums)
+					require.NoError(t, err)
+					m.Files[i].SHA256, m.Files[i].Size = checksum, info.Size()
+				}
+			}
+		})
+		_, err := Verify(b.dir)
+		require.ErrorContains(t, err, "failed to verify checksums signature")
+	})
+
+	t.Run("path outside the bundle", func(t *testing.T) {
+		b := newTestBundle(t)
+		rewriteManifest(t, b.dir, func(m *Manifest) {
+			m.Files = append(m.Files, File{Path: "../outside", SHA256: strings.Repeat("0", 64), Kind: KindOnnxModel, Model: "m"})
+		})
+		_, err := Verify(b.dir)
+		require.ErrorContains(t, err, `invalid bundle path "../outside"`)
+	})
+
+	t.Run("manifest edited without checksums", func(t *testing.T) {
+		b := newTestBundle(t)
+		data, err := os.ReadFile(filepath.Join(b.dir, ManifestFile))
+		require.NoError(t, err)
+		var raw map[string]any
+		require.NoError(t, json.Unmarshal(data, &raw))
+		raw["generated_at"] = "2000-01-01T00:00:00Z"
+		data, err = json.Marshal(raw)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(b.dir, ManifestFile), data, 0o644))
+		_, err = Verify(b.dir)
+		require.ErrorContains(t, err, "manifest.json does not match checksums.sha256")
+	})
+}
+
+func TestInstallRejectsUnsafeArchiveMembers(t *testing.T) {
+	writeBundleFile := func(t *testing.T, dir string, f File, content []byte) *Manifest {
+		t.Helper()
+		p := filepath.Join(dir, filepath.FromSlash(f.Path))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, content, 0o644))
+		return &Manifest{Versions: Versions{OnnxRuntime: "1.23.1"}, Files: []File{f}}
+	}
+	linux := Target{GOOS: "linux", GOARCH: "amd64"}
+
+	t.Run("symlinked library", func(t *testing.T) {
+		dir, cacheDir := t.TempDir(), t.TempDir()
+		asset, err := artifacts.TokenizersAsset(linux.GOOS, linux.GOARCH, false)
+		require.NoError(t, err)
+		manifest := writeBundleFile(t, dir, File{Path: "tokenizers/libtokenizers.tar.gz", Kind: KindTokenizers, Platform: asset.Platform},
+			tarGz(t, nil, map[string]string{"libtokenizers.so": "/etc/passwd"}))
+		_, err = installLibrary(dir, manifest, KindTokenizers, asset, cacheDir)
+		require.ErrorContains(t, err, "does not contain libtokenizers.so")
+		require.NoFileExists(t, filepath.Join(cacheDir, "libtokenizers.so"))
+	})
+
+	t.Run("symlinked ONNX Runtime library", func(t *testing.T) {
+		dir, cacheDir := t.TempDir(), t.TempDir()
+		manifest := writeBundleFile(t, dir, File{Path: "onnx_runtime/onnxruntime-linux-x64-1.23.1.tgz", Kind: KindOnnxRuntime, Platform: "linux-x64"},
+			tarGz(t, nil, map[string]string{"onnxruntime-linux-x64-1.23.1/lib/libonnxruntime.so": "/etc/passwd"}))
+		_, err := installOnnxRuntime(dir, manifest, linux, cacheDir)
+		require.ErrorContains(t, err, "does not contain libonnxruntime.so*")
+		require.NoFileExists(t, filepath.Join(cacheDir, "onnxruntime-linux-x64-1.23.1", "lib", "libonnxruntime.so"))
+	})
+
+	t.Run("unsafe ONNX Runtime library file name", func(t *testing.T) {
+		dir, cacheDir := t.TempDir(), t.TempDir()
+		for _, name := range []string{"libonnxruntime.so.1$(whoami)", "libonnxruntime.so 1", "libonnxruntime.so.1'"} {
+			manifest := writeBundleFile(t, dir, File{Path: "onnx_runtime/onnxruntime-linux-x64-1.23.1.tgz", Kind: KindOnnxRuntime, Platform: "linux-x64"},
+				tarGz(t, map[string]string{"onnxruntime-linux-x64-1.23.1/lib/" + name: "ort"}, nil))
+			_, err := installOnnxRuntime(dir, manifest, linux, cacheDir)
+			require.ErrorContains(t, err, "unsafe library file name", name)
+			require.NoFileExists(t, filepath.Join(cacheDir, "onnxruntime-linux-x64-1.23.1", "lib", name))
+		}
+	})
+}
@@ -0,0 +1,504 @@
+package bundle
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	semver "github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
+)
+
+// defaultModelArchiveSHA256 pins the default model archive; tests replace it.
+var defaultModelArchiveSHA256 = artifacts.DefaultModelArchiveSHA256
+
+// ProgressFunc receives the progress of the download of a bundle file.
+// total is -1 when the size is unknown.
+type ProgressFunc func(file string, downloaded, total int64)
+
+type createOptions struct {
+	targets            []Target
+	localShimVersion   string
+	tokenizersVersion  string
+	onnxRuntimeVersion string
+	models             []Model
+	force              bool
+	progress           ProgressFunc
+	artifactOptions    []artifacts.Option
+	// onnxRuntimeChecksums returns the archive checksums of an ONNX Runtime release by asset name.
+	onnxRuntimeChecksums func(ctx context.Context, version string) (map[string]string, error)
+}
+
+// Option configures [Create].
+type Option func(*createOptions) error
+
+// WithTargets sets the platforms to bundle native libraries for. Defaults to
+// the host.
+func WithTargets(targets ...Target) Option {
+	return func(o *createOptions) error {
+		for _, t := range targets {
+			if _, err := platformsOf(t); err != nil {
+				return err
+			}
+		}
+		o.targets = append(o.targets, targets...)
+		return nil
+	}
+}
+
+// WithLocalShimVersion pins the local Chroma shim release, e.g. v0.3.5.
+func WithLocalShimVersion(version string) Option {
+	return func(o *createOptions) error {
+		v, err := normalizeLocalShimVersion(version)
+		if err != nil {
+			return err
+		}
+		o.localShimVersion = v
+		return nil
+	}
+}
+
+// WithTokenizersVersion pins the libtokenizers release, e.g. v0.1.5 or rust-v0.1.5.
+func WithTokenizersVersion(version string) Option {
+	return func(o *createOptions) error {
+		v, err := normalizeTokenizersVersion(version)
+		if err != nil {
+			return err
+		}
+		o.tokenizersVersion = v
+		return nil
+	}
+}
+
+// WithOnnxRuntimeVersion pins the ONNX Runtime release, e.g. 1.23.1.
+func WithOnnxRuntimeVersion(version string) Option {
+	return func(o *createOptions) error {
+		v, err := normalizeOnnxRuntimeVersion(version)
+		if err != nil {
+			return err
+		}
+		o.onnxRuntimeVersion = v
+		return nil
+	}
+}
+
+// WithModels bundles ONNX models in addition to the default model.
+func WithModels(models ...Model) Option {
+	return func(o *createOptions) error {
+		for _, m := range models {
+			if err := validateModel(m); err != nil {
+				return err
+			}
+		}
+		o.models = append(o.models, models...)
+		return nil
+	}
+}
+
+// WithForce replaces the contents of a non-empty output directory.
+func WithForce() Option {
+	return func(o *createOptions) error {
+		o.force = true
+		return nil
+	}
+}
+
+// WithProgress reports the progress of every download.
+func WithProgress(progress ProgressFunc) Option {
+	return func(o *createOptions) error {
+		o.progress = progress
+		return nil
+	}
+}
+
+func withOnnxRuntimeChecksums(checksums func(ctx context.Context, version string) (map[string]string, error)) Option {
+	return func(o *createOptions) error {
+		o.onnxRuntimeChecksums = checksums
+		return nil
+	}
+}
+
+func withArtifactOptions(opts ...artifacts.Option) Option {
+	return func(o *createOptions) error {
+		o.artifactOptions = append(o.artifactOptions, opts...)
+		return nil
+	}
+}
+
+// Create downloads the artifacts for the configured targets into the directory
+// output and writes the bundle manifest. Release archives are verified against
+// their signed checksums, the default model against its pinned checksum.
+func Create(ctx context.Context, output string, opts ...Option) (*Manifest, error) {
+	o := &createOptions{
+		localShimVersion:     DefaultLocalShimVersion,
+		onnxRuntimeVersion:   DefaultOnnxRuntimeVersion,
+		onnxRuntimeChecksums: artifacts.GitHubOnnxRuntimeChecksums,
+	}
+	o.tokenizersVersion, _ = normalizeTokenizersVersion(DefaultTokenizersVersion)
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if len(o.targets) == 0 {
+		o.targets = []Target{HostTarget()}
+	}
+	if strings.TrimSpace(output) == "" {
+		return nil, errors.New("output directory cannot be empty")
+	}
+	if err := prepareOutput(output, o.force); err != nil {
+		return nil, err
+	}
+
+	var current string
+	managerOpts := []artifacts.Option{artifacts.WithMaxBytes(2 * 1024 * 1024 * 1024)}
+	if o.progress != nil {
+		managerOpts = append(managerOpts, artifacts.WithProgress(func(downloaded, total int64) {
+			o.progress(current, downloaded, total)
+		}))
+	}
+	manager, err := artifacts.New(append(managerOpts, o.artifactOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+	c := &creator{ctx: ctx, dir: output, opts: o, manager: manager, current: &current}
+
+	manifest := &Manifest{
+		SchemaVersion: SchemaVersion,
+		GeneratedAt:   time.Now().UTC().Format(time.RFC3339),
+		Targets:       o.targets,
+		Versions: Versions{
+			LocalShim:   o.localShimVersion,
+			Tokenizers:  o.tokenizersVersion,
+			OnnxRuntime: o.onnxRuntimeVersion,
+			OnnxModels:  []string{DefaultModel},
+		},
+	}
+	steps := []func(*Manifest) error{c.addLocalShim, c.addTokenizers, c.addOnnxRuntime, c.addModels}
+	for _, step := range steps {
+		if err := step(manifest); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeManifest(output, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+type creator struct {
+	ctx     context.Context
+	dir     string
+	opts    *createOptions
+	manager *artifacts.Manager
+	current *string
+}
+
+func (c *creator) addLocalShim(manifest *Manifest) error {
+	version := c.opts.localShimVersion
+	bases := c.manager.BaseURLs(artifacts.LocalShim, artifacts.LocalShimReleaseBaseURL, artifacts.LocalShimFallbackReleaseBaseURL)
+	return c.addRelease(manifest, KindLocalShim, version, bases, artifacts.LocalShimSigner(version), func(t Target) (artifacts.ReleaseAsset, error) {
+		return artifacts.LocalShimAsset(version, t.GOOS, t.GOARCH)
+	})
+}
+
+func (c *creator) addTokenizers(manifest *Manifest) error {
+	version := c.opts.tokenizersVersion
+	bases := c.manager.BaseURLs(artifacts.Tokenizers, artifacts.TokenizersReleaseBaseURL, artifacts.TokenizersFallbackBaseURL)
+	return c.addRelease(manifest, KindTokenizers, version, bases, artifacts.TokenizersSigner(version), func(t Target) (artifacts.ReleaseAsset, error) {
+		return artifacts.TokenizersAsset(t.GOOS, t.GOARCH, t.Musl)
+	})
+}
+
+// addRelease fetches the signed checksums of a release and the archive of
+// every target listed in them.
+func (c *creator) addRelease(manifest *Manifest, kind, version string, bases []string, signer artifacts.Signer, assetOf func(Target) (artifacts.ReleaseAsset, error)) error {
+	relDir := path.Join(kind, version)
+	dir := filepath.Join(c.dir, filepath.FromSlash(relDir))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrapf(err, "failed to create %s", relDir)
+	}
+	var sumsPath string
+	var errs []error
+	for _, base := range bases {
+		c.setCurrent(relDir, artifacts.ChecksumsAsset)
+		p, err := c.manager.FetchSignedChecksums(c.ctx, strings.TrimRight(base, "/")+"/"+version, dir, signer)
+		if err == nil {
+			sumsPath = p
+			break
+		}
+		errs = append(errs, errors.Wrap(err, base))
+	}
+	if sumsPath == "" {
+		return errors.Wrapf(stderrors.Join(errs...), "failed to fetch signed checksums of %s %s", kind, version)
+	}
+	for _, name := range []string{artifacts.ChecksumsAsset, artifacts.ChecksumsSignatureAsset, artifacts.ChecksumsCertificateAsset, artifacts.ChecksumsBundleAsset} {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		f, err := newFile(c.dir, p, KindReleaseChecksums)
+		if err != nil {
+			return err
+		}
+		f.Version = version
+		manifest.Files = append(manifest.Files, f)
+	}
+
+	added := map[string]bool{}
+	for _, t := range c.opts.targets {
+		asset, err := assetOf(t)
+		if err != nil {
+			return errors.Wrapf(err, "target %s", t)
+		}
+		if added[asset.Platform] {
+			continue
+		}
+		added[asset.Platform] = true
+		name, checksum, err := artifacts.ChecksumFromSums(sumsPath, asset.ArchiveNames...)
+		if err != nil {
+			return errors.Wrapf(err, "%s %s has no archive for target %s", kind, version, t)
+		}
+		urls := make([]string, 0, len(bases))
+		for _, base := range bases {
+			urls = append(urls, strings.TrimRight(base, "/")+"/"+version+"/"+name)
+		}
+		dest := filepath.Join(dir, name)
+		c.setCurrent(relDir, name)
+		if err := c.manager.FetchVerified(c.ctx, dest, checksum, urls...); err != nil {
+			return err
+		}
+		f, err := newFile(c.dir, dest, kind)
+		if err != nil {
+			return err
+		}
+		f.Platform, f.Version, f.Library = asset.Platform, version, asset.Library
+		manifest.Files = append(manifest.Files, f)
+	}
+	return nil
+}
+
+func (c *creator) addOnnxRuntime(manifest *Manifest) error {
+	version := c.opts.onnxRuntimeVersion
+	relDir := path.Join(KindOnnxRuntime, version)
+	dir := filepath.Join(c.dir, filepath.FromSlash(relDir))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrapf(err, "failed to create %s", relDir)
+	}
+	checksums, err := c.opts.onnxRuntimeChecksums(c.ctx, version)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve checksums of ONNX Runtime %s", version)
+	}
+	added := map[string]bool{}
+	for _, t := range c.opts.targets {
+		asset, err := artifacts.OnnxRuntimeAssetFor(t.GOOS, t.GOARCH)
+		if err != nil {
+			return err
+		}
+		if added[asset.Platform] {
+			continue
+		}
+		added[asset.Platform] = true
+		name := asset.ArchiveFileName(version)
+		checksum, ok := checksums[name]
+		if !ok {
+			return errors.Errorf("ONNX Runtime %s has no checksum for %s", version, name)
+		}
+		dest := filepath.Join(dir, name)
+		c.setCurrent(relDir, name)
+		var urls []string
+		for _, base := range c.manager.BaseURLs(artifacts.OnnxRuntime, artifacts.OnnxRuntimeReleaseBaseURL) {
+			urls = append(urls, fmt.Sprintf("%s/v%s/%s", base, version, name))
+		}
+		if err := c.manager.FetchVerified(c.ctx, dest, checksum, urls...); err != nil {
+			return err
+		}
+		f, err := newFile(c.dir, dest, KindOnnxRuntime)
+		if err != nil {
+			return err
+		}
+		f.Platform, f.Version = asset.Platform, version
+		manifest.Files = append(manifest.Files, f)
+	}
+	return nil
+}
+
+func (c *creator) addModels(manifest *Manifest) error {
+	relPath := path.Join("onnx-models", artifacts.DefaultModelArchivePath)
+	dest := filepath.Join(c.dir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create default model directory")
+	}
+	var urls []string
+	for _, base := range c.manager.BaseURLs(artifacts.OnnxModels, artifacts.OnnxModelsBaseURL) {
+		urls = append(urls, strings.TrimRight(base, "/")+"/"+artifacts.DefaultModelArchivePath)
+	}
+	c.setCurrent(relPath)
+	if err := c.manager.FetchVerified(c.ctx, dest, defaultModelArchiveSHA256, urls...); err != nil {
+		return errors.Wrap(err, "failed to download default model")
+	}
+	f, err := newFile(c.dir, dest, KindOnnxModel)
+	if err != nil {
+		return err
+	}
+	f.Model = DefaultModel
+	manifest.Files = append(manifest.Files, f)
+
+	for _, model := range c.opts.models {
+		dir := filepath.Join(c.dir, "onnx-models", filepath.FromSlash(model.Name))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return errors.Wrapf(err, "failed to create directory of model %s", model.Name)
+		}
+		names := make([]string, 0, len(model.Files))
+		for name := range model.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			dest := filepath.Join(dir, name)
+			c.setCurrent("onnx-models", model.Name, name)
+			if checksum := model.SHA256[name]; checksum != "" {
+				err = c.manager.FetchVerified(c.ctx, dest, checksum, model.Files[name])
+			} else {
+				err = c.manager.Download(c.ctx, dest, model.Files[name])
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to download %s of model %s", name, model.Name)
+			}
+			f, err := newFile(c.dir, dest, KindOnnxModel)
+			if err != nil {
+				return err
+			}
+			f.Model = model.Name
+			manifest.Files = append(manifest.Files, f)
+		}
+		manifest.Versions.OnnxModels = append(manifest.Versions.OnnxModels, model.Name)
+	}
+	return nil
+}
+
+func (c *creator) setCurrent(elem ...string) {
+	*c.current = path.Join(elem...)
+}
+
+func prepareOutput(dir string, force bool) error {
+	if !force {
+		entries, err := os.ReadDir(dir)
+		if err == nil && len(entries) > 0 {
+			return errors.Errorf("output directory is not empty: %s", dir)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to read output directory")
+		}
+	} else if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "failed to clear output directory")
+	}
+	return errors.Wrap(os.MkdirAll(dir, 0o755), "failed to create output directory")
+}
+
+func newFile(root, filePath, kind string) (File, error) {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return File{}, errors.Wrapf(err, "failed to resolve bundle path of %s", filePath)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return File{}, errors.Wrapf(err, "failed to stat %s", filePath)
+	}
+	checksum, err := artifacts.FileSHA256(filePath)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Path: filepath.ToSlash(rel), SHA256: checksum, Size: info.Size(), Kind: kind}, nil
+}
+
+func normalizeLocalShimVersion(version string) (string, error) {
+	version = strings.TrimSpace(version)
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	parsed, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return "", errors.Errorf("local shim version %q must be a valid semantic version", version)
+	}
+	return "v" + parsed.String(), nil
+}
+
+func normalizeTokenizersVersion(version string) (string, error) {
+	semverPart := strings.TrimSpace(version)
+	semverPart = strings.TrimPrefix(semverPart, "rust-")
+	semverPart = strings.TrimPrefix(semverPart, "v")
+	parsed, err := semver.StrictNewVersion(semverPart)
+	if err != nil {
+		return "", errors.Errorf("tokenizers version %q must be a valid semantic version", version)
+	}
+	return "rust-v" + parsed.String(), nil
+}
+
+func normalizeOnnxRuntimeVersion(version string) (string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	parts := strings.Split(trimmed, ".")
+	if len(parts) != 3 {
+		return "", errors.Errorf("ONNX Runtime version must have format x.y.z, got %q", version)
+	}
+	for _, part := range parts {
+		if _, err := strconv.Atoi(part); err != nil || part == "" {
+			return "", errors.Errorf("ONNX Runtime version must have numeric segments, got %q", version)
+		}
+	}
+	return trimmed, nil
+}
+
+func platformsOf(t Target) ([]string, error) {
+	shim, err := artifacts.LocalShimAsset("", t.GOOS, t.GOARCH)
+	if err != nil {
+		return nil, errors.Wrapf(err, "target %s", t)
+	}
+	tokenizers, err := artifacts.TokenizersAsset(t.GOOS, t.GOARCH, t.Musl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "target %s", t)
+	}
+	ort, err := artifacts.OnnxRuntimeAssetFor(t.GOOS, t.GOARCH)
+	if err != nil {
+		return nil, errors.Wrapf(err, "target %s", t)
+	}
+	return []string{shim.Platform, tokenizers.Platform, ort.Platform}, nil
+}
+
+func validateModel(m Model) error {
+	if err := validateModelName(m.Name); err != nil {
+		return err
+	}
+	if m.Name == DefaultModel {
+		return errors.Errorf("model %s is always bundled", DefaultModel)
+	}
+	if len(m.Files) == 0 {
+		return errors.Errorf("model %s has no files", m.Name)
+	}
+	for fileName, url := range m.Files {
+		if fileName == "" || path.Base(fileName) != fileName || fileName == "." || fileName == ".." || strings.Contains(fileName, "\\") {
+			return errors.Errorf("invalid file name %q of model %s", fileName, m.Name)
+		}
+		if _, err := artifacts.ValidateBaseURL(url); err != nil {
+			return errors.Wrapf(err, "invalid URL of %s of model %s", fileName, m.Name)
+		}
+	}
+	return nil
+}
+
+// validateModelName rejects model names that would escape the models directory.
+func validateModelName(name string) error {
+	if name == "" || path.IsAbs(name) || strings.Contains(name, "\\") || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+		return errors.Errorf("invalid model name %q", name)
+	}
+	return nil
+}
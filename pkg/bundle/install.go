@@ -0,0 +1,194 @@
+package bundle
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
+)
+
+type installOptions struct {
+	cacheDir string
+	target   Target
+}
+
+// InstallOption configures [Install].
+type InstallOption func(*installOptions) error
+
+// WithCacheDir installs into dir instead of the default artifact cache, which
+// is CHROMA_CACHE_DIR or ~/.cache/chroma.
+func WithCacheDir(dir string) InstallOption {
+	return func(o *installOptions) error {
+		if strings.TrimSpace(dir) == "" {
+			return errors.New("cache dir cannot be empty")
+		}
+		o.cacheDir = dir
+		return nil
+	}
+}
+
+// WithInstallTarget installs the libraries of target instead of the host.
+func WithInstallTarget(target Target) InstallOption {
+	return func(o *installOptions) error {
+		if _, err := platformsOf(target); err != nil {
+			return err
+		}
+		o.target = target
+		return nil
+	}
+}
+
+// Installation lists the artifacts installed by [Install].
+type Installation struct {
+	CacheDir           string
+	LocalShimLibrary   string
+	TokenizersLibrary  string
+	TokenizersVersion  string
+	OnnxRuntimeLibrary string
+	OnnxRuntimeVersion string
+	// Models maps each installed model to its directory.
+	Models map[string]string
+}
+
+// Env returns the environment, as KEY=value, that points the runtime at the
+// installed artifacts. It is only needed when the bundle pins versions other
+// than the defaults of the running chroma-go or was installed outside the
+// default cache.
+func (i *Installation) Env() []string {
+	return []string{
+		artifacts.CacheDirEnv + "=" + i.CacheDir,
+		"CHROMA_LIB_PATH=" + i.LocalShimLibrary,
+		"TOKENIZERS_LIB_PATH=" + i.TokenizersLibrary,
+		"TOKENIZERS_VERSION=" + i.TokenizersVersion,
+		"CHROMAGO_ONNX_RUNTIME_PATH=" + i.OnnxRuntimeLibrary,
+		"CHROMAGO_ONNX_RUNTIME_VERSION=" + i.OnnxRuntimeVersion,
+	}
+}
+
+// Install verifies the bundle in dir with [Verify] and unpacks the libraries of
+// one target and all models into the artifact cache, in the layout the runtime
+// searches before downloading anything.
+func Install(dir string, opts ...InstallOption) (*Installation, error) {
+	o := &installOptions{cacheDir: artifacts.CacheRoot(), target: HostTarget()}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	manifest, err := Verify(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle verification failed")
+	}
+	inst := &Installation{
+		CacheDir:           o.cacheDir,
+		TokenizersVersion:  manifest.Versions.Tokenizers,
+		OnnxRuntimeVersion: manifest.Versions.OnnxRuntime,
+		Models:             map[string]string{},
+	}
+	t := o.target
+
+	shim, err := artifacts.LocalShimAsset(manifest.Versions.LocalShim, t.GOOS, t.GOARCH)
+	if err != nil {
+		return nil, err
+	}
+	inst.LocalShimLibrary, err = installLibrary(dir, manifest, KindLocalShim, shim,
+		filepath.Join(o.cacheDir, artifacts.LocalShim.Name, manifest.Versions.LocalShim, shim.Platform))
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizers, err := artifacts.TokenizersAsset(t.GOOS, t.GOARCH, t.Musl)
+	if err != nil {
+		return nil, err
+	}
+	inst.TokenizersLibrary, err = installLibrary(dir, manifest, KindTokenizers, tokenizers,
+		filepath.Join(o.cacheDir, artifacts.Tokenizers.Name, manifest.Versions.Tokenizers, tokenizers.Platform))
+	if err != nil {
+		return nil, err
+	}
+
+	inst.OnnxRuntimeLibrary, err = installOnnxRuntime(dir, manifest, t, filepath.Join(o.cacheDir, artifacts.OnnxRuntime.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	modelsDir := filepath.Join(o.cacheDir, artifacts.OnnxModels.Name)
+	for _, f := range manifest.files(KindOnnxModel, "") {
+		src := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if f.Model == DefaultModel {
+			modelDir := filepath.Join(modelsDir, DefaultModel, "onnx")
+			if err := artifacts.ExtractTarGz(src, func(name string) (string, bool) {
+				return filepath.Join(modelDir, path.Base(name)), true
+			}); err != nil {
+				return nil, errors.Wrap(err, "failed to install default model")
+			}
+			inst.Models[f.Model] = modelDir
+			continue
+		}
+		if err := validateModelName(f.Model); err != nil {
+			return nil, err
+		}
+		modelDir := filepath.Join(modelsDir, filepath.FromSlash(f.Model))
+		if err := copyFileAtomic(src, filepath.Join(modelDir, path.Base(f.Path))); err != nil {
+			return nil, errors.Wrapf(err, "failed to install model %s", f.Model)
+		}
+		inst.Models[f.Model] = modelDir
+	}
+	return inst, nil
+}
+
+// installLibrary extracts the shared library of a release archive into dir.
+func installLibrary(bundleDir string, manifest *Manifest, kind string, asset artifacts.ReleaseAsset, dir string) (string, error) {
+	files := manifest.files(kind, asset.Platform)
+	if len(files) == 0 {
+		return "", errors.Errorf("bundle has no %s library for %s", kind, asset.Platform)
+	}
+	dest := filepath.Join(dir, asset.Library)
+	found := false
+	err := artifacts.ExtractTarGz(filepath.Join(bundleDir, filepath.FromSlash(files[0].Path)), func(name string) (string, bool) {
+		if path.Base(name) != asset.Library {
+			return "", false
+		}
+		found = true
+		return dest, true
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to install %s library", kind)
+	}
+	if !found {
+		return "", errors.Errorf("%s archive %s does not contain %s", kind, files[0].Path, asset.Library)
+	}
+	return dest, nil
+}
+
+// installOnnxRuntime extracts the libraries of an ONNX Runtime release into the
+// directory the pure-onnx bootstrap installs it into below cacheDir.
+func installOnnxRuntime(bundleDir string, manifest *Manifest, t Target, cacheDir string) (string, error) {
+	asset, err := artifacts.OnnxRuntimeAssetFor(t.GOOS, t.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	files := manifest.files(KindOnnxRuntime, asset.Platform)
+	if len(files) == 0 {
+		return "", errors.Errorf("bundle has no ONNX Runtime for %s", asset.Platform)
+	}
+	src := filepath.Join(bundleDir, filepath.FromSlash(files[0].Path))
+	return artifacts.ExtractOnnxRuntime(src, cacheDir, manifest.Versions.OnnxRuntime, asset)
+}
+
+func copyFileAtomic(src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.Wrap(err, "failed to open bundle file")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat bundle file")
+	}
+	return artifacts.WriteFileAtomic(dest, f, info.Size())
+}
@@ -0,0 +1,187 @@
+package bundle
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
+)
+
+// newVerifyManager creates the manager that verifies release signatures; tests
+// replace it to trust their own certificates.
+var newVerifyManager = func() (*artifacts.Manager, error) {
+	return artifacts.New()
+}
+
+// Verify checks the bundle in dir without network access: every file listed in
+// the manifest must match its size and checksum, checksums.sha256 must agree
+// with the manifest, the release checksums must carry a valid signature of the
+// release workflow, and every release archive must be listed in its signed
+// checksums. The default model is checked against its pinned checksum.
+func Verify(dir string) (*Manifest, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksumsFile(dir, manifest); err != nil {
+		return nil, err
+	}
+	for _, f := range manifest.Files {
+		if err := verifyFile(dir, f); err != nil {
+			return nil, err
+		}
+	}
+	manager, err := newVerifyManager()
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyReleases(dir, manifest, manager, KindLocalShim, artifacts.LocalShimSigner); err != nil {
+		return nil, err
+	}
+	if err := verifyReleases(dir, manifest, manager, KindTokenizers, artifacts.TokenizersSigner); err != nil {
+		return nil, err
+	}
+	defaultArchive := path.Join("onnx-models", artifacts.DefaultModelArchivePath)
+	found := false
+	for _, f := range manifest.files(KindOnnxModel, "") {
+		if f.Path != defaultArchive {
+			continue
+		}
+		if f.SHA256 != defaultModelArchiveSHA256 {
+			return nil, errors.Errorf("default model archive %s does not match its pinned checksum", f.Path)
+		}
+		found = true
+	}
+	if !found {
+		return nil, errors.Errorf("bundle does not contain the default model archive %s", defaultArchive)
+	}
+	return manifest, nil
+}
+
+// verifyChecksumsFile checks that checksums.sha256 lists exactly the manifest
+// and the files of the manifest.
+func verifyChecksumsFile(dir string, manifest *Manifest) error {
+	f, err := os.Open(filepath.Join(dir, ChecksumsFile))
+	if err != nil {
+		return errors.Wrap(err, "failed to open bundle checksums")
+	}
+	defer f.Close()
+	listed := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || !artifacts.LooksLikeSHA256(fields[0]) {
+			return errors.Errorf("invalid bundle checksums line %q", scanner.Text())
+		}
+		listed[fields[1]] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read bundle checksums")
+	}
+
+	manifestChecksum, err := artifacts.FileSHA256(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return err
+	}
+	if listed[ManifestFile] != manifestChecksum {
+		return errors.Errorf("%s does not match %s", ManifestFile, ChecksumsFile)
+	}
+	delete(listed, ManifestFile)
+	for _, file := range manifest.Files {
+		checksum, ok := listed[file.Path]
+		if !ok {
+			return errors.Errorf("%s is missing from %s", file.Path, ChecksumsFile)
+		}
+		if checksum != strings.ToLower(file.SHA256) {
+			return errors.Errorf("checksum of %s differs between %s and %s", file.Path, ManifestFile, ChecksumsFile)
+		}
+		delete(listed, file.Path)
+	}
+	if len(listed) > 0 {
+		extra := make([]string, 0, len(listed))
+		for p := range listed {
+			extra = append(extra, p)
+		}
+		sort.Strings(extra)
+		return errors.Errorf("%s lists files that are not in %s: %s", ChecksumsFile, ManifestFile, strings.Join(extra, ", "))
+	}
+	return nil
+}
+
+func verifyFile(dir string, f File) error {
+	p, err := bundlePath(dir, f.Path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return errors.Wrapf(err, "bundle file %s", f.Path)
+	}
+	if !info.Mode().IsRegular() {
+		return errors.Errorf("bundle file %s is not a regular file", f.Path)
+	}
+	if info.Size() != f.Size {
+		return errors.Errorf("bundle file %s has size %d, expected %d", f.Path, info.Size(), f.Size)
+	}
+	return errors.Wrapf(artifacts.VerifyFile(p, f.SHA256), "bundle file %s", f.Path)
+}
+
+// verifyReleases verifies the signed checksums of each release of kind and the
+// archives against them.
+func verifyReleases(dir string, manifest *Manifest, manager *artifacts.Manager, kind string, signerOf func(version string) artifacts.Signer) error {
+	verified := map[string]string{}
+	for _, f := range manifest.files(kind, "") {
+		releaseDir := path.Join(kind, f.Version)
+		if f.Version == "" || path.Dir(f.Path) != releaseDir {
+			return errors.Errorf("bundle file %s is not in the release directory of %s %q", f.Path, kind, f.Version)
+		}
+		sumsPath, ok := verified[f.Version]
+		if !ok {
+			if !hasReleaseChecksums(manifest, releaseDir) {
+				return errors.Errorf("bundle has no signed checksums of %s %s", kind, f.Version)
+			}
+			localDir := filepath.Join(dir, filepath.FromSlash(releaseDir))
+			if err := manager.VerifySignedChecksums(localDir, signerOf(f.Version)); err != nil {
+				return errors.Wrapf(err, "%s %s", kind, f.Version)
+			}
+			sumsPath = filepath.Join(localDir, artifacts.ChecksumsAsset)
+			verified[f.Version] = sumsPath
+		}
+		_, checksum, err := artifacts.ChecksumFromSums(sumsPath, path.Base(f.Path))
+		if err != nil {
+			return errors.Wrapf(err, "%s %s", kind, f.Version)
+		}
+		if checksum != strings.ToLower(f.SHA256) {
+			return errors.Errorf("bundle file %s does not match the signed checksums of %s %s", f.Path, kind, f.Version)
+		}
+	}
+	return nil
+}
+
+// hasReleaseChecksums reports whether the manifest lists the SHA256SUMS of a
+// release directory, so its signature is covered by the bundle checksums.
+func hasReleaseChecksums(manifest *Manifest, releaseDir string) bool {
+	for _, f := range manifest.files(KindReleaseChecksums, "") {
+		if f.Path == path.Join(releaseDir, artifacts.ChecksumsAsset) {
+			return true
+		}
+	}
+	return false
+}
+
+// bundlePath resolves a manifest path below dir, rejecting paths that escape it.
+func bundlePath(dir, p string) (string, error) {
+	if p == "" || path.IsAbs(p) || strings.Contains(p, "\\") || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") {
+		return "", errors.Errorf("invalid bundle path %q", p)
+	}
+	return filepath.Join(dir, filepath.FromSlash(p)), nil
+}
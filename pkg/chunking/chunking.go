@@ -0,0 +1,187 @@
+// Package chunking splits long texts into smaller, optionally overlapping chunks
+// that fit the context window of an embedding model.
+//
+// Four splitters are provided:
+//   - [RecursiveCharacterSplitter] splits on a prioritized list of separators
+//     (paragraphs, lines, words, characters) until every chunk fits.
+//   - [SentenceSplitter] packs whole sentences into chunks.
+//   - [MarkdownHeaderSplitter] splits Markdown on headers and records the
+//     header path of every section.
+//   - [TokenSplitter] windows over the exact token sequence produced by a
+//     HuggingFace tokenizer.
+//
+// Chunk sizes are measured with a [LengthFunc]. The default counts Unicode code
+// points; use [TokenLength] to measure in tokens with a
+// [github.com/amikos-tech/chroma-go/pkg/tokenizers/libtokenizers.Tokenizer].
+//
+//	splitter, err := chunking.NewRecursiveCharacterSplitter(
+//	    chunking.WithChunkSize(512),
+//	    chunking.WithChunkOverlap(64),
+//	)
+//	chunks, err := splitter.Split(longText)
+package chunking
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultChunkSize is the default maximum chunk length as measured by the splitter's LengthFunc.
+	DefaultChunkSize = 1000
+	// DefaultChunkOverlap is the default overlap between consecutive chunks. It is
+	// reduced to a fifth of the chunk size for chunk sizes below 1000.
+	DefaultChunkOverlap = 200
+)
+
+// Chunk is a contiguous slice of the source text.
+type Chunk struct {
+	// Text is the chunk content, i.e. source[Start:End].
+	Text string
+	// Index is the zero-based position of the chunk in the split result.
+	Index int
+	// Start is the byte offset of the chunk in the source text (inclusive).
+	Start int
+	// End is the byte offset of the chunk in the source text (exclusive).
+	End int
+	// Headers holds the enclosing Markdown headers keyed by level name (e.g. "h1", "h2").
+	// Only populated by [MarkdownHeaderSplitter].
+	Headers map[string]string
+}
+
+// Splitter splits a text into chunks.
+type Splitter interface {
+	Split(text string) ([]Chunk, error)
+}
+
+// LengthFunc measures the length of a text, e.g. in characters or tokens.
+type LengthFunc func(text string) (int, error)
+
+// CharacterLength counts Unicode code points. It is the default LengthFunc.
+func CharacterLength(text string) (int, error) {
+	return utf8.RuneCountInString(text), nil
+}
+
+// span is a half-open byte range [start, end) of the source text.
+type span struct {
+	start int
+	end   int
+}
+
+// config holds settings shared by all splitters. Options that do not apply to
+// a given splitter are ignored by it.
+type config struct {
+	chunkSize    int
+	chunkOverlap int
+	// overlapSet records an explicit WithChunkOverlap
+	overlapSet   bool
+	lengthFunc   LengthFunc
+	separators   []string
+	headerLevels int
+	stripHeaders bool
+	trimSpace    bool
+}
+
+func defaultConfig() *config {
+	return &config{
+		chunkSize:    DefaultChunkSize,
+		chunkOverlap: DefaultChunkOverlap,
+		lengthFunc:   CharacterLength,
+		separators:   []string{"\n\n", "\n", " ", ""},
+		headerLevels: 6,
+		trimSpace:    true,
+	}
+}
+
+func (c *config) validate() error {
+	if c.chunkSize <= 0 {
+		return errors.New("chunk size must be greater than 0")
+	}
+	if !c.overlapSet && c.chunkOverlap > c.chunkSize/5 {
+		c.chunkOverlap = c.chunkSize / 5
+	}
+	if c.chunkOverlap < 0 {
+		return errors.New("chunk overlap cannot be negative")
+	}
+	if c.chunkOverlap >= c.chunkSize {
+		return errors.Errorf("chunk overlap (%d) must be smaller than chunk size (%d)", c.chunkOverlap, c.chunkSize)
+	}
+	if c.lengthFunc == nil {
+		return errors.New("length function cannot be nil")
+	}
+	return nil
+}
+
+func (c *config) length(text string) (int, error) {
+	n, err := c.lengthFunc(text)
+	if err != nil {
+		return 0, errors.Wrap(err, "error measuring text length")
+	}
+	return n, nil
+}
+
+// mergeSpans packs contiguous spans into chunks no longer than chunkSize, carrying
+// trailing spans of each chunk over into the next one up to chunkOverlap.
+// Spans must be ordered and individually no longer than chunkSize.
+func (c *config) mergeSpans(text string, spans []span) ([]span, error) {
+	lengths := make([]int, len(spans))
+	for i, s := range spans {
+		n, err := c.length(text[s.start:s.end])
+		if err != nil {
+			return nil, err
+		}
+		lengths[i] = n
+	}
+	merged := make([]span, 0)
+	windowStart := 0
+	total := 0
+	for i := range spans {
+		if total+lengths[i] > c.chunkSize && i > windowStart {
+			merged = append(merged, span{start: spans[windowStart].start, end: spans[i-1].end})
+			// Drop spans from the front until what is left fits the overlap budget
+			// and leaves room for the incoming span.
+			for windowStart < i && (total > c.chunkOverlap || total+lengths[i] > c.chunkSize) {
+				total -= lengths[windowStart]
+				windowStart++
+			}
+		}
+		total += lengths[i]
+	}
+	if windowStart < len(spans) {
+		merged = append(merged, span{start: spans[windowStart].start, end: spans[len(spans)-1].end})
+	}
+	return merged, nil
+}
+
+// toChunks converts spans into chunks, optionally trimming surrounding whitespace
+// (offsets are adjusted accordingly) and dropping empty chunks.
+func (c *config) toChunks(text string, spans []span) []Chunk {
+	chunks := make([]Chunk, 0, len(spans))
+	for _, s := range spans {
+		if c.trimSpace {
+			s = trimSpan(text, s)
+		}
+		if s.end <= s.start {
+			continue
+		}
+		chunks = append(chunks, Chunk{
+			Text:  text[s.start:s.end],
+			Index: len(chunks),
+			Start: s.start,
+			End:   s.end,
+		})
+	}
+	return chunks
+}
+
+func trimSpan(text string, s span) span {
+	segment := text[s.start:s.end]
+	trimmedLeft := strings.TrimLeftFunc(segment, unicode.IsSpace)
+	s.start += len(segment) - len(trimmedLeft)
+	trimmed := strings.TrimRightFunc(trimmedLeft, unicode.IsSpace)
+	s.end = s.start + len(trimmed)
+	return s
+}
@@ -0,0 +1,284 @@
+package chunking
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tokenizers "github.com/amikos-tech/chroma-go/pkg/tokenizers/libtokenizers"
+)
+
+func requireOffsetsMatch(t *testing.T, text string, chunks []Chunk) {
+	t.Helper()
+	for i, c := range chunks {
+		assert.Equal(t, i, c.Index)
+		assert.Equal(t, text[c.Start:c.End], c.Text, "chunk %d offsets do not match its text", i)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	_, err := NewRecursiveCharacterSplitter(WithChunkSize(10), WithChunkOverlap(10))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be smaller than chunk size")
+
+	_, err = NewRecursiveCharacterSplitter(WithChunkSize(0))
+	require.Error(t, err)
+
+	// the default overlap shrinks with small chunk sizes, an explicit one does not
+	cfg, err := newConfig(WithChunkSize(100))
+	require.NoError(t, err)
+	assert.Equal(t, 20, cfg.chunkOverlap)
+	cfg, err = newConfig(WithChunkSize(3))
+	require.NoError(t, err)
+	assert.Equal(t, 0, cfg.chunkOverlap)
+	cfg, err = newConfig(WithChunkSize(2000))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultChunkOverlap, cfg.chunkOverlap)
+	_, err = NewRecursiveCharacterSplitter(WithChunkOverlap(100), WithChunkSize(100))
+	require.Error(t, err)
+
+	_, err = NewSentenceSplitter(WithChunkOverlap(-1))
+	require.Error(t, err)
+
+	_, err = NewMarkdownHeaderSplitter(WithHeaderLevels(7))
+	require.Error(t, err)
+
+	_, err = NewTokenSplitter(nil)
+	require.Error(t, err)
+}
+
+func TestRecursiveCharacterSplitter(t *testing.T) {
+	t.Run("short text is a single chunk", func(t *testing.T) {
+		s, err := NewRecursiveCharacterSplitter(WithChunkSize(100), WithChunkOverlap(0))
+		require.NoError(t, err)
+		chunks, err := s.Split("  hello world  ")
+		require.NoError(t, err)
+		require.Len(t, chunks, 1)
+		assert.Equal(t, "hello world", chunks[0].Text)
+		requireOffsetsMatch(t, "  hello world  ", chunks)
+	})
+
+	t.Run("empty text", func(t *testing.T) {
+		s, err := NewRecursiveCharacterSplitter()
+		require.NoError(t, err)
+		chunks, err := s.Split("")
+		require.NoError(t, err)
+		assert.Empty(t, chunks)
+	})
+
+	t.Run("prefers paragraph boundaries", func(t *testing.T) {
+		text := "first paragraph here\n\nsecond paragraph here\n\nthird one"
+		s, err := NewRecursiveCharacterSplitter(WithChunkSize(25), WithChunkOverlap(0))
+		require.NoError(t, err)
+		chunks, err := s.Split(text)
+		require.NoError(t, err)
+		require.Len(t, chunks, 3)
+		assert.Equal(t, "first paragraph here", chunks[0].Text)
+		assert.Equal(t, "second paragraph here", chunks[1].Text)
+		assert.Equal(t, "third one", chunks[2].Text)
+		requireOffsetsMatch(t, text, chunks)
+	})
+
+	t.Run("respects chunk size and overlap on words", func(t *testing.T) {
+		text := "one two three four five six seven eight nine ten"
+		s, err := NewRecursiveCharacterSplitter(WithChunkSize(15), WithChunkOverlap(8))
+		require.NoError(t, err)
+		chunks, err := s.Split(text)
+		require.NoError(t, err)
+		require.Greater(t, len(chunks), 1)
+		for _, c := range chunks {
+			assert.LessOrEqual(t, utf8.RuneCountInString(c.Text), 15)
+		}
+		// consecutive chunks share words
+		for i := 1; i < len(chunks); i++ {
+			assert.Less(t, chunks[i].Start, chunks[i-1].End, "chunk %d should overlap the previous one", i)
+		}
+		requireOffsetsMatch(t, text, chunks)
+	})
+
+	t.Run("falls back to characters", func(t *testing.T) {
+		text := strings.Repeat("é", 25)
+		s, err := NewRecursiveCharacterSplitter(WithChunkSize(10), WithChunkOverlap(0))
+		require.NoError(t, err)
+		chunks, err := s.Split(text)
+		require.NoError(t, err)
+		require.Len(t, chunks, 3)
+		assert.Equal(t, strings.Repeat("é", 10), chunks[0].Text)
+		assert.Equal(t, strings.Repeat("é", 5), chunks[2].Text)
+		requireOffsetsMatch(t, text, chunks)
+	})
+
+	t.Run("custom separators without character fallback", func(t *testing.T) {
+		text := "aaaaaaaaaaaaaaaa|bb"
+		s, err := NewRecursiveCharacterSplitter(WithChunkSize(5), WithChunkOverlap(0), WithSeparators("|"))
+		require.NoError(t, err)
+		chunks, err := s.Split(text)
+		require.NoError(t, err)
+		require.Len(t, chunks, 2)
+		assert.Equal(t, "aaaaaaaaaaaaaaaa|", chunks[0].Text)
+		assert.Equal(t, "bb", chunks[1].Text)
+	})
+
+	t.Run("length function errors are returned", func(t *testing.T) {
+		s, err := NewRecursiveCharacterSplitter(WithLengthFunc(func(string) (int, error) {
+			return 0, errors.New("boom")
+		}))
+		require.NoError(t, err)
+		_, err = s.Split("text")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "boom")
+	})
+}
+
+func TestSentenceSplitter(t *testing.T) {
+	text := "The cat sat. The dog ran! Did the bird fly? \"Yes,\" it did.\n\nA new paragraph"
+	s, err := NewSentenceSplitter(WithChunkSize(30), WithChunkOverlap(0))
+	require.NoError(t, err)
+	chunks, err := s.Split(text)
+	require.NoError(t, err)
+	require.NotEmpty(t, chunks)
+	assert.Equal(t, "The cat sat. The dog ran!", chunks[0].Text)
+	for _, c := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(c.Text), 30)
+	}
+	assert.Equal(t, "A new paragraph", chunks[len(chunks)-1].Text)
+	requireOffsetsMatch(t, text, chunks)
+
+	t.Run("does not split decimals", func(t *testing.T) {
+		spans := sentenceSpans("Pi is 3.14 roughly. Next.")
+		require.Len(t, spans, 2)
+	})
+
+	t.Run("long sentences are split on words", func(t *testing.T) {
+		long := strings.Repeat("word ", 20) + "end."
+		s, err := NewSentenceSplitter(WithChunkSize(20), WithChunkOverlap(0))
+		require.NoError(t, err)
+		chunks, err := s.Split(long)
+		require.NoError(t, err)
+		require.Greater(t, len(chunks), 1)
+		for _, c := range chunks {
+			assert.LessOrEqual(t, utf8.RuneCountInString(c.Text), 20)
+		}
+		requireOffsetsMatch(t, long, chunks)
+	})
+
+	t.Run("overlap repeats whole sentences", func(t *testing.T) {
+		text := "One one. Two two. Three three. Four four."
+		s, err := NewSentenceSplitter(WithChunkSize(25), WithChunkOverlap(15))
+		require.NoError(t, err)
+		chunks, err := s.Split(text)
+		require.NoError(t, err)
+		require.Len(t, chunks, 3)
+		assert.Equal(t, "One one. Two two.", chunks[0].Text)
+		assert.Equal(t, "Two two. Three three.", chunks[1].Text)
+		assert.Equal(t, "Three three. Four four.", chunks[2].Text)
+	})
+}
+
+func TestMarkdownHeaderSplitter(t *testing.T) {
+	text := "Intro text\n# Title\nBody one\n## Section A\nBody A\n```\n# not a header\n```\n## Section B ##\nBody B\n# Other\nBody C"
+	s, err := NewMarkdownHeaderSplitter(WithChunkSize(200), WithChunkOverlap(0))
+	require.NoError(t, err)
+	chunks, err := s.Split(text)
+	require.NoError(t, err)
+	require.Len(t, chunks, 5)
+
+	assert.Equal(t, "Intro text", chunks[0].Text)
+	assert.Empty(t, chunks[0].Headers)
+
+	assert.Equal(t, map[string]string{"h1": "Title"}, chunks[1].Headers)
+	assert.Equal(t, map[string]string{"h1": "Title", "h2": "Section A"}, chunks[2].Headers)
+	assert.Contains(t, chunks[2].Text, "# not a header")
+	assert.Equal(t, map[string]string{"h1": "Title", "h2": "Section B"}, chunks[3].Headers)
+	assert.Equal(t, map[string]string{"h1": "Other"}, chunks[4].Headers)
+	requireOffsetsMatch(t, text, chunks)
+
+	t.Run("strip headers", func(t *testing.T) {
+		s, err := NewMarkdownHeaderSplitter(WithStripHeaders(), WithChunkOverlap(0))
+		require.NoError(t, err)
+		chunks, err := s.Split("# C#\nbody")
+		require.NoError(t, err)
+		require.Len(t, chunks, 1)
+		assert.Equal(t, "body", chunks[0].Text)
+		assert.Equal(t, map[string]string{"h1": "C#"}, chunks[0].Headers)
+	})
+
+	t.Run("header levels limit", func(t *testing.T) {
+		s, err := NewMarkdownHeaderSplitter(WithHeaderLevels(1), WithChunkOverlap(0))
+		require.NoError(t, err)
+		chunks, err := s.Split("# A\n## B\ntext")
+		require.NoError(t, err)
+		require.Len(t, chunks, 1)
+		assert.Equal(t, map[string]string{"h1": "A"}, chunks[0].Headers)
+	})
+
+	t.Run("long sections are split further", func(t *testing.T) {
+		body := strings.Repeat("lorem ipsum ", 10)
+		text := "# Big\n" + body
+		s, err := NewMarkdownHeaderSplitter(WithChunkSize(30), WithChunkOverlap(0))
+		require.NoError(t, err)
+		chunks, err := s.Split(text)
+		require.NoError(t, err)
+		require.Greater(t, len(chunks), 1)
+		for _, c := range chunks {
+			assert.Equal(t, "Big", c.Headers["h1"])
+		}
+		requireOffsetsMatch(t, text, chunks)
+	})
+}
+
+// wordEncoder is a whitespace tokenizer that reports byte offsets, standing in for
+// a HuggingFace tokenizer in tests.
+type wordEncoder struct{}
+
+func (wordEncoder) EncodeWithOptions(str string, _ bool, _ ...tokenizers.EncodeOption) (tokenizers.Encoding, error) {
+	enc := tokenizers.Encoding{}
+	inWord := false
+	start := 0
+	for i, r := range str + " " {
+		if r == ' ' || r == '\n' {
+			if inWord {
+				enc.IDs = append(enc.IDs, uint32(len(enc.IDs)))
+				enc.Offsets = append(enc.Offsets, tokenizers.Offset{uint(start), uint(i)})
+				inWord = false
+			}
+			continue
+		}
+		if !inWord {
+			inWord = true
+			start = i
+		}
+	}
+	return enc, nil
+}
+
+func TestTokenSplitter(t *testing.T) {
+	text := "a b c d e f g h i j"
+	s, err := NewTokenSplitter(wordEncoder{}, WithChunkSize(4), WithChunkOverlap(1))
+	require.NoError(t, err)
+	chunks, err := s.Split(text)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, "a b c d", chunks[0].Text)
+	assert.Equal(t, "d e f g", chunks[1].Text)
+	assert.Equal(t, "g h i j", chunks[2].Text)
+	requireOffsetsMatch(t, text, chunks)
+}
+
+func TestTokenLength(t *testing.T) {
+	n, err := TokenLength(wordEncoder{})("one two  three")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	s, err := NewRecursiveCharacterSplitter(WithLengthFunc(TokenLength(wordEncoder{})), WithChunkSize(3), WithChunkOverlap(0))
+	require.NoError(t, err)
+	chunks, err := s.Split("one two three four five six seven")
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, "one two three", chunks[0].Text)
+	assert.Equal(t, "seven", chunks[2].Text)
+}
@@ -0,0 +1,147 @@
+package chunking
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MarkdownHeaderSplitter splits Markdown into sections at ATX headers ("#" to
+// "######") and records the enclosing headers of each section in [Chunk.Headers]
+// under the keys "h1" to "h6". Headers inside fenced code blocks are ignored.
+//
+// Sections longer than the chunk size are further split with the recursive
+// character strategy; the resulting chunks inherit the section headers.
+type MarkdownHeaderSplitter struct {
+	cfg *config
+}
+
+var _ Splitter = (*MarkdownHeaderSplitter)(nil)
+
+// NewMarkdownHeaderSplitter creates a splitter with [WithHeaderLevels], [WithStripHeaders],
+// [WithChunkSize], [WithChunkOverlap], [WithLengthFunc], [WithSeparators] and
+// [WithKeepWhitespace] options.
+func NewMarkdownHeaderSplitter(opts ...Option) (*MarkdownHeaderSplitter, error) {
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &MarkdownHeaderSplitter{cfg: cfg}, nil
+}
+
+type markdownSection struct {
+	span
+	headers map[string]string
+}
+
+// Split splits text into chunks.
+func (s *MarkdownHeaderSplitter) Split(text string) ([]Chunk, error) {
+	if text == "" {
+		return []Chunk{}, nil
+	}
+	chunks := make([]Chunk, 0)
+	for _, section := range s.sections(text) {
+		spans, err := s.cfg.splitRecursive(text, section.span, s.cfg.separators)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range s.cfg.toChunks(text, spans) {
+			c.Index = len(chunks)
+			c.Headers = copyHeaders(section.headers)
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks, nil
+}
+
+func (s *MarkdownHeaderSplitter) sections(text string) []markdownSection {
+	sections := make([]markdownSection, 0)
+	active := make([]string, 7) // index 1..6 holds the current header text per level
+	current := markdownSection{span: span{start: 0}, headers: map[string]string{}}
+	fence := ""
+	for lineStart := 0; lineStart < len(text); {
+		lineEnd := strings.IndexByte(text[lineStart:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += lineStart + 1
+		}
+		line := strings.TrimRight(text[lineStart:lineEnd], "\r\n")
+		trimmed := strings.TrimLeft(line, " ")
+
+		if marker := fenceMarker(trimmed); marker != "" {
+			switch {
+			case fence == "":
+				fence = marker
+			case strings.HasPrefix(trimmed, fence):
+				fence = ""
+			}
+		} else if fence == "" {
+			if level, title, ok := parseATXHeader(trimmed); ok && level <= s.cfg.headerLevels {
+				current.end = lineStart
+				if current.end > current.start {
+					sections = append(sections, current)
+				}
+				active[level] = title
+				for l := level + 1; l < len(active); l++ {
+					active[l] = ""
+				}
+				headers := make(map[string]string)
+				for l := 1; l < len(active); l++ {
+					if active[l] != "" {
+						headers["h"+strconv.Itoa(l)] = active[l]
+					}
+				}
+				current = markdownSection{span: span{start: lineStart}, headers: headers}
+				if s.cfg.stripHeaders {
+					current.start = lineEnd
+				}
+			}
+		}
+		lineStart = lineEnd
+	}
+	current.end = len(text)
+	if current.end > current.start {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+func fenceMarker(line string) string {
+	switch {
+	case strings.HasPrefix(line, "```"):
+		return "```"
+	case strings.HasPrefix(line, "~~~"):
+		return "~~~"
+	default:
+		return ""
+	}
+}
+
+// parseATXHeader parses lines such as "## Title" or "## Title ##".
+func parseATXHeader(line string) (int, string, bool) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, "", false
+	}
+	if level < len(line) && line[level] != ' ' && line[level] != '\t' {
+		return 0, "", false
+	}
+	title := strings.TrimSpace(line[level:])
+	// A closing sequence of '#' is only stripped when separated by whitespace,
+	// so titles such as "C#" are kept intact.
+	if closed := strings.TrimRight(title, "#"); closed == "" || strings.HasSuffix(closed, " ") {
+		title = strings.TrimSpace(closed)
+	}
+	return level, title, true
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package chunking
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Option configures a splitter.
+type Option func(c *config) error
+
+// WithChunkSize sets the maximum chunk length as measured by the splitter's LengthFunc.
+// Defaults to [DefaultChunkSize].
+func WithChunkSize(size int) Option {
+	return func(c *config) error {
+		if size <= 0 {
+			return errors.New("chunk size must be greater than 0")
+		}
+		c.chunkSize = size
+		return nil
+	}
+}
+
+// WithChunkOverlap sets how much of the end of a chunk is repeated at the start of the next one.
+// Must be smaller than the chunk size. Defaults to [DefaultChunkOverlap], or a fifth of
+// smaller chunk sizes.
+func WithChunkOverlap(overlap int) Option {
+	return func(c *config) error {
+		if overlap < 0 {
+			return errors.New("chunk overlap cannot be negative")
+		}
+		c.chunkOverlap = overlap
+		c.overlapSet = true
+		return nil
+	}
+}
+
+// WithLengthFunc sets the function used to measure chunk length. Use [TokenLength]
+// to size chunks in tokens.
+func WithLengthFunc(fn LengthFunc) Option {
+	return func(c *config) error {
+		if fn == nil {
+			return errors.New("length function cannot be nil")
+		}
+		c.lengthFunc = fn
+		return nil
+	}
+}
+
+// WithSeparators sets the prioritized separator list of [RecursiveCharacterSplitter].
+// An empty string separator splits between individual characters and should come last.
+func WithSeparators(separators ...string) Option {
+	return func(c *config) error {
+		if len(separators) == 0 {
+			return errors.New("at least one separator is required")
+		}
+		c.separators = separators
+		return nil
+	}
+}
+
+// WithHeaderLevels limits [MarkdownHeaderSplitter] to headers up to the given level (1-6).
+// Deeper headers are treated as regular content.
+func WithHeaderLevels(levels int) Option {
+	return func(c *config) error {
+		if levels < 1 || levels > 6 {
+			return errors.New("header levels must be between 1 and 6")
+		}
+		c.headerLevels = levels
+		return nil
+	}
+}
+
+// WithStripHeaders removes header lines from [MarkdownHeaderSplitter] chunk text.
+// The headers remain available through [Chunk.Headers].
+func WithStripHeaders() Option {
+	return func(c *config) error {
+		c.stripHeaders = true
+		return nil
+	}
+}
+
+// WithKeepWhitespace disables trimming of leading and trailing whitespace from chunks.
+func WithKeepWhitespace() Option {
+	return func(c *config) error {
+		c.trimSpace = false
+		return nil
+	}
+}
+
+func newConfig(opts ...Option) (*config, error) {
+	c := defaultConfig()
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
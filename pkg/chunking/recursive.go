@@ -0,0 +1,141 @@
+package chunking
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// RecursiveCharacterSplitter splits text on the first separator from a prioritized
+// list that occurs in it, recursing into pieces that are still too long with the
+// remaining separators. Adjacent small pieces are merged back into chunks of up to
+// the configured size with the configured overlap.
+//
+// The default separators are paragraph breaks, line breaks, spaces and finally
+// individual characters.
+type RecursiveCharacterSplitter struct {
+	cfg *config
+}
+
+var _ Splitter = (*RecursiveCharacterSplitter)(nil)
+
+// NewRecursiveCharacterSplitter creates a splitter with [WithChunkSize], [WithChunkOverlap],
+// [WithLengthFunc], [WithSeparators] and [WithKeepWhitespace] options.
+func NewRecursiveCharacterSplitter(opts ...Option) (*RecursiveCharacterSplitter, error) {
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &RecursiveCharacterSplitter{cfg: cfg}, nil
+}
+
+// Split splits text into chunks.
+func (s *RecursiveCharacterSplitter) Split(text string) ([]Chunk, error) {
+	if text == "" {
+		return []Chunk{}, nil
+	}
+	spans, err := s.cfg.splitRecursive(text, span{start: 0, end: len(text)}, s.cfg.separators)
+	if err != nil {
+		return nil, err
+	}
+	return s.cfg.toChunks(text, spans), nil
+}
+
+// splitRecursive returns merged spans covering s, each within chunkSize unless it
+// cannot be split any further with the given separators.
+func (c *config) splitRecursive(text string, s span, separators []string) ([]span, error) {
+	n, err := c.length(text[s.start:s.end])
+	if err != nil {
+		return nil, err
+	}
+	if n <= c.chunkSize {
+		return []span{s}, nil
+	}
+	sepIdx := len(separators) - 1
+	for i, sep := range separators {
+		if sep == "" || strings.Contains(text[s.start:s.end], sep) {
+			sepIdx = i
+			break
+		}
+	}
+	var remaining []string
+	if sepIdx >= 0 && sepIdx+1 < len(separators) {
+		remaining = separators[sepIdx+1:]
+	}
+	var pieces []span
+	if sepIdx >= 0 {
+		pieces = splitKeepSeparator(text, s, separators[sepIdx])
+	} else {
+		pieces = []span{s}
+	}
+
+	out := make([]span, 0)
+	pending := make([]span, 0)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		merged, err := c.mergeSpans(text, pending)
+		if err != nil {
+			return err
+		}
+		out = append(out, merged...)
+		pending = pending[:0]
+		return nil
+	}
+	for _, p := range pieces {
+		pl, err := c.length(text[p.start:p.end])
+		if err != nil {
+			return nil, err
+		}
+		if pl <= c.chunkSize {
+			pending = append(pending, p)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if len(remaining) == 0 {
+			// Nothing left to split on; emit the oversized piece as is.
+			out = append(out, p)
+			continue
+		}
+		sub, err := c.splitRecursive(text, p, remaining)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sub...)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// splitKeepSeparator splits s on sep, attaching each separator occurrence to the
+// piece before it so that the pieces stay contiguous. An empty separator splits
+// between runes.
+func splitKeepSeparator(text string, s span, sep string) []span {
+	pieces := make([]span, 0)
+	if sep == "" {
+		for i := s.start; i < s.end; {
+			_, size := utf8.DecodeRuneInString(text[i:s.end])
+			pieces = append(pieces, span{start: i, end: i + size})
+			i += size
+		}
+		return pieces
+	}
+	start := s.start
+	for start < s.end {
+		idx := strings.Index(text[start:s.end], sep)
+		if idx < 0 {
+			break
+		}
+		end := start + idx + len(sep)
+		pieces = append(pieces, span{start: start, end: end})
+		start = end
+	}
+	if start < s.end {
+		pieces = append(pieces, span{start: start, end: s.end})
+	}
+	return pieces
+}
@@ -0,0 +1,103 @@
+package chunking
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SentenceSplitter packs whole sentences into chunks of up to the configured size.
+// Sentences end at '.', '!', '?' or '…' (optionally followed by closing quotes or
+// brackets) before whitespace, and at blank lines. A single sentence longer than
+// the chunk size is split on words.
+type SentenceSplitter struct {
+	cfg *config
+}
+
+var _ Splitter = (*SentenceSplitter)(nil)
+
+// NewSentenceSplitter creates a splitter with [WithChunkSize], [WithChunkOverlap],
+// [WithLengthFunc] and [WithKeepWhitespace] options. The overlap is applied in
+// whole sentences.
+func NewSentenceSplitter(opts ...Option) (*SentenceSplitter, error) {
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SentenceSplitter{cfg: cfg}, nil
+}
+
+// Split splits text into chunks.
+func (s *SentenceSplitter) Split(text string) ([]Chunk, error) {
+	if text == "" {
+		return []Chunk{}, nil
+	}
+	pieces := make([]span, 0)
+	for _, sentence := range sentenceSpans(text) {
+		n, err := s.cfg.length(text[sentence.start:sentence.end])
+		if err != nil {
+			return nil, err
+		}
+		if n <= s.cfg.chunkSize {
+			pieces = append(pieces, sentence)
+			continue
+		}
+		sub, err := s.cfg.splitRecursive(text, sentence, []string{" ", ""})
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, sub...)
+	}
+	merged, err := s.cfg.mergeSpans(text, pieces)
+	if err != nil {
+		return nil, err
+	}
+	return s.cfg.toChunks(text, merged), nil
+}
+
+// sentenceSpans splits text into contiguous sentence spans. Trailing whitespace
+// belongs to the sentence it follows.
+func sentenceSpans(text string) []span {
+	spans := make([]span, 0)
+	start := 0
+	i := 0
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next := i + size
+		boundary := false
+		switch {
+		case r == '.' || r == '!' || r == '?' || r == '…':
+			for next < len(text) {
+				c, csize := utf8.DecodeRuneInString(text[next:])
+				if !strings.ContainsRune(`.!?…"'”’)]`, c) {
+					break
+				}
+				next += csize
+			}
+			if next >= len(text) {
+				boundary = true
+			} else if c, _ := utf8.DecodeRuneInString(text[next:]); unicode.IsSpace(c) {
+				boundary = true
+			}
+		case r == '\n' && next < len(text) && text[next] == '\n':
+			boundary = true
+		}
+		if boundary {
+			// Absorb the whitespace run that follows the terminator.
+			for next < len(text) {
+				c, csize := utf8.DecodeRuneInString(text[next:])
+				if !unicode.IsSpace(c) {
+					break
+				}
+				next += csize
+			}
+			spans = append(spans, span{start: start, end: next})
+			start = next
+		}
+		i = next
+	}
+	if start < len(text) {
+		spans = append(spans, span{start: start, end: len(text)})
+	}
+	return spans
+}
@@ -0,0 +1,99 @@
+package chunking
+
+import (
+	"github.com/pkg/errors"
+
+	tokenizers "github.com/amikos-tech/chroma-go/pkg/tokenizers/libtokenizers"
+)
+
+// TokenEncoder is the subset of [tokenizers.Tokenizer] used for exact token counts.
+type TokenEncoder interface {
+	EncodeWithOptions(str string, addSpecialTokens bool, opts ...tokenizers.EncodeOption) (tokenizers.Encoding, error)
+}
+
+var _ TokenEncoder = (*tokenizers.Tokenizer)(nil)
+
+// TokenLength returns a LengthFunc that counts tokens produced by encoder, without
+// special tokens. Use it with [WithLengthFunc] to size character, sentence or
+// Markdown chunks in tokens.
+//
+//	tk, err := tokenizers.FromFile("tokenizer.json")
+//	splitter, err := chunking.NewRecursiveCharacterSplitter(
+//	    chunking.WithLengthFunc(chunking.TokenLength(tk)),
+//	    chunking.WithChunkSize(256),
+//	    chunking.WithChunkOverlap(32),
+//	)
+func TokenLength(encoder TokenEncoder) LengthFunc {
+	return func(text string) (int, error) {
+		if encoder == nil {
+			return 0, errors.New("token encoder cannot be nil")
+		}
+		enc, err := encoder.EncodeWithOptions(text, false)
+		if err != nil {
+			return 0, errors.Wrap(err, "error encoding text")
+		}
+		return len(enc.IDs), nil
+	}
+}
+
+// TokenSplitter slides a window of chunk-size tokens over the token sequence of
+// the text, stepping by chunk size minus overlap. Chunk boundaries come from the
+// tokenizer offsets, so every chunk is an exact substring of the source text.
+type TokenSplitter struct {
+	cfg     *config
+	encoder TokenEncoder
+}
+
+var _ Splitter = (*TokenSplitter)(nil)
+
+// NewTokenSplitter creates a splitter over encoder (typically a
+// [tokenizers.Tokenizer]) with [WithChunkSize], [WithChunkOverlap] and
+// [WithKeepWhitespace] options. Sizes are expressed in tokens.
+func NewTokenSplitter(encoder TokenEncoder, opts ...Option) (*TokenSplitter, error) {
+	if encoder == nil {
+		return nil, errors.New("token encoder cannot be nil")
+	}
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenSplitter{cfg: cfg, encoder: encoder}, nil
+}
+
+// Split splits text into chunks.
+func (s *TokenSplitter) Split(text string) ([]Chunk, error) {
+	if text == "" {
+		return []Chunk{}, nil
+	}
+	enc, err := s.encoder.EncodeWithOptions(text, false, tokenizers.WithReturnOffsets())
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding text")
+	}
+	if len(enc.Offsets) != len(enc.IDs) {
+		return nil, errors.Errorf("tokenizer returned %d offsets for %d tokens", len(enc.Offsets), len(enc.IDs))
+	}
+	step := s.cfg.chunkSize - s.cfg.chunkOverlap
+	spans := make([]span, 0)
+	for first := 0; first < len(enc.IDs); first += step {
+		last := min(first+s.cfg.chunkSize, len(enc.IDs)) - 1
+		start := clampOffset(int(enc.Offsets[first][0]), len(text))
+		end := clampOffset(int(enc.Offsets[last][1]), len(text))
+		if end > start {
+			spans = append(spans, span{start: start, end: end})
+		}
+		if last == len(enc.IDs)-1 {
+			break
+		}
+	}
+	return s.cfg.toChunks(text, spans), nil
+}
+
+func clampOffset(offset, limit int) int {
+	if offset < 0 {
+		return 0
+	}
+	if offset > limit {
+		return limit
+	}
+	return offset
+}
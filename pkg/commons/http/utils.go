@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -17,20 +18,53 @@ const (
 	panicErrorBodyFallback     = truncatedErrorBodySuffix
 )
 
+// ErrResponseTooLarge is returned when a response body exceeds its size limit.
+var ErrResponseTooLarge = errors.New("response body exceeds maximum size")
+
 // ReadLimitedBody reads up to MaxResponseBodySize bytes from r.
 // Returns an error if the response exceeds the limit.
 func ReadLimitedBody(r io.Reader) ([]byte, error) {
-	limitedReader := io.LimitReader(r, int64(MaxResponseBodySize)+1)
-	data, err := io.ReadAll(limitedReader)
+	return ReadLimitedBodyN(r, MaxResponseBodySize)
+}
+
+// ReadLimitedBodyN reads up to limit bytes from r.
+// Returns an error wrapping ErrResponseTooLarge if the response exceeds the limit.
+func ReadLimitedBodyN(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(NewLimitedReader(r, limit))
 	if err != nil {
 		return nil, err
 	}
-	if len(data) > MaxResponseBodySize {
-		return nil, fmt.Errorf("response body exceeds maximum size of %d bytes", MaxResponseBodySize)
-	}
 	return data, nil
 }
 
+// NewLimitedReader returns a reader that reads from r and fails with an error
+// wrapping ErrResponseTooLarge once more than limit bytes have been read.
+// Unlike io.LimitReader, an oversized body is never mistaken for a complete one.
+func NewLimitedReader(r io.Reader, limit int64) io.Reader {
+	return &limitedReader{r: r, limit: limit, remaining: limit + 1}
+}
+
+type limitedReader struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, fmt.Errorf("%w of %d bytes", ErrResponseTooLarge, l.limit)
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining <= 0 {
+		return n - 1, fmt.Errorf("%w of %d bytes", ErrResponseTooLarge, l.limit)
+	}
+	return n, err
+}
+
 func sanitizeErrorBody(body []byte) string {
 	trimmed := bytes.TrimSpace(body)
 	if len(trimmed) == 0 {
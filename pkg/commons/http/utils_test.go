@@ -3,6 +3,7 @@ package http
 import (
 	"bytes"
 	"errors"
+	"io"
 	"os"
 	"strings"
 	"testing"
@@ -49,9 +50,24 @@ func TestReadLimitedBody(t *testing.T) {
 		_, err := ReadLimitedBody(strings.NewReader(input))
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "response body exceeds maximum size")
+		assert.ErrorIs(t, err, ErrResponseTooLarge)
 	})
 }
 
+func TestNewLimitedReader(t *testing.T) {
+	data, err := io.ReadAll(NewLimitedReader(strings.NewReader("hello"), 5))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	data, err = io.ReadAll(NewLimitedReader(strings.NewReader("hello world"), 5))
+	require.ErrorIs(t, err, ErrResponseTooLarge)
+	assert.Equal(t, "hello", string(data), "no byte past the limit is returned")
+	assert.Contains(t, err.Error(), "of 5 bytes")
+
+	_, err = io.ReadAll(NewLimitedReader(errorReader{}, 5))
+	require.EqualError(t, err, "boom")
+}
+
 func TestSanitizeErrorBody(t *testing.T) {
 	testCases := []struct {
 		name   string
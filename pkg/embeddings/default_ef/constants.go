@@ -6,11 +6,14 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
 )
 
 const (
 	defaultLibOnnxRuntimeVersion = "1.23.1"
-	onnxModelDownloadEndpoint    = "https://chroma-onnx-models.s3.amazonaws.com/all-MiniLM-L6-v2/onnx.tar.gz"
+	onnxModelsBaseURL            = artifacts.OnnxModelsBaseURL
+	onnxModelArchivePath         = artifacts.DefaultModelArchivePath
 	ChromaCacheDir               = ".cache/chroma/"
 )
 
@@ -44,9 +47,8 @@ func getConfig() *Config {
 // initializeConfig creates a new Config by reading environment variables
 // and computing all derived paths
 func initializeConfig() *Config {
-	homeDir := resolveHomeDir()
-	libCacheDir := filepath.Join(homeDir, ChromaCacheDir)
-	onnxModelsCachePath := filepath.Join(libCacheDir, "onnx_models")
+	libCacheDir := artifacts.CacheRoot()
+	onnxModelsCachePath := filepath.Join(libCacheDir, artifacts.OnnxModels.Name)
 	onnxModelCachePath := filepath.Join(onnxModelsCachePath, "all-MiniLM-L6-v2/onnx")
 	onnxModelPath := filepath.Join(onnxModelCachePath, "model.onnx")
 	onnxModelTokenizerConfigPath := filepath.Join(onnxModelCachePath, "tokenizer.json")
@@ -78,7 +80,7 @@ func initializeConfig() *Config {
 	}
 
 	// Compute all paths based on the version
-	onnxCacheDir := filepath.Join(libCacheDir, "shared", "onnxruntime")
+	onnxCacheDir := filepath.Join(libCacheDir, artifacts.OnnxRuntime.Name)
 	onnxLibPath := filepath.Join(onnxCacheDir, "libonnxruntime."+getExtensionForOs())
 
 	return &Config{
@@ -102,15 +102,7 @@ func newDefaultEmbeddingFunctionWithDeps(cfg *Config, deps defaultEFDeps, opts .
 	initLock.Lock()
 	defer initLock.Unlock()
 
-	bootstrapOpts := []ort.BootstrapOption{
-		ort.WithBootstrapCacheDir(cfg.OnnxCacheDir),
-	}
-	if cfg.LibOnnxRuntimeVersion == "custom" {
-		bootstrapOpts = append(bootstrapOpts, ort.WithBootstrapLibraryPath(cfg.OnnxLibPath))
-	} else {
-		bootstrapOpts = append(bootstrapOpts, ort.WithBootstrapVersion(cfg.LibOnnxRuntimeVersion))
-	}
-	if err := deps.initializeEnvironmentWithBootstrap(bootstrapOpts...); err != nil {
+	if err := deps.initializeEnvironmentWithBootstrap(bootstrapOptions(cfg)...); err != nil {
 		return nil, nil, errors.Wrap(err, "failed to initialize onnx runtime environment")
 	}
 
@@ -0,0 +1,87 @@
+package defaultef
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ort "github.com/amikos-tech/pure-onnx/ort"
+	"github.com/pkg/errors"
+)
+
+// RuntimeBootstrapOptions returns the ONNX Runtime bootstrap options resolved from
+// CHROMAGO_ONNX_RUNTIME_PATH and CHROMAGO_ONNX_RUNTIME_VERSION. Other local ONNX
+// models use them so that they share the runtime library with the default
+// embedding function.
+func RuntimeBootstrapOptions() []ort.BootstrapOption {
+	return bootstrapOptions(getConfig())
+}
+
+func bootstrapOptions(cfg *Config) []ort.BootstrapOption {
+	opts := []ort.BootstrapOption{
+		ort.WithBootstrapCacheDir(cfg.OnnxCacheDir),
+	}
+	if cfg.LibOnnxRuntimeVersion == "custom" {
+		return append(opts, ort.WithBootstrapLibraryPath(cfg.OnnxLibPath))
+	}
+	// the runtime is downloaded by EnsureOnnxRuntimeSharedLibrary, never by the bootstrap
+	return append(opts, ort.WithBootstrapVersion(cfg.LibOnnxRuntimeVersion), ort.WithBootstrapDisableDownload(true))
+}
+
+// ModelCacheDir returns the cache directory of a named ONNX model
+// (~/.cache/chroma/onnx_models/<name>).
+func ModelCacheDir(name string) string {
+	return filepath.Join(getConfig().OnnxModelsCachePath, filepath.FromSlash(name))
+}
+
+// EnsureModelFiles downloads the missing files of a model into dir. files maps a
+// file name to its download URL, and checksums optionally pins the SHA-256 of
+// files by name. Pinned files are verified, including cached ones, and
+// downloaded again on mismatch; files without a pinned checksum are trusted on
+// download. Downloads are serialized across processes with the lock used for
+// the default model.
+func EnsureModelFiles(dir string, files map[string]string, checksums map[string]string) error {
+	if strings.TrimSpace(dir) == "" {
+		return errors.New("model directory cannot be empty")
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if name == "" || filepath.Base(name) != name {
+			return errors.Errorf("invalid model file name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manager, err := defaultEFArtifactManager()
+	if err != nil {
+		return err
+	}
+	lock, err := manager.Lock(getConfig().OnnxModelsCachePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire lock for onnx model download")
+	}
+	defer lock.Unlock()
+
+	for _, name := range names {
+		target := filepath.Join(dir, name)
+		if checksum := checksums[name]; checksum != "" {
+			if err := manager.FetchVerified(context.Background(), target, checksum, files[name]); err != nil {
+				return errors.Wrapf(err, "failed to download model file %s", name)
+			}
+			continue
+		}
+		exists, err := defaultEFFileExistsNonEmpty(target)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check model file %s", target)
+		}
+		if exists {
+			continue
+		}
+		if err := manager.Download(context.Background(), target, files[name]); err != nil {
+			return errors.Wrapf(err, "failed to download model file %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const maxExtractedFileBytes int64 = 2 * 1024 * 1024 * 1024
+
+// ExtractTarGz writes the regular files of a tar.gz archive for which
+// destOf returns a destination.
+func ExtractTarGz(archivePath string, destOf func(name string) (string, bool)) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open archive")
+	}
+	defer f.Close()
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrap(err, "failed to read gzip archive")
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read tar entry")
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		dest, ok := destOf(header.Name)
+		if !ok {
+			continue
+		}
+		if err := WriteFileAtomic(dest, tarReader, header.Size); err != nil {
+			return errors.Wrapf(err, "failed to extract %s", header.Name)
+		}
+	}
+}
+
+// ExtractZip writes the regular files of a zip archive for which destOf
+// returns a destination.
+func ExtractZip(archivePath string, destOf func(name string) (string, bool)) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open zip archive")
+	}
+	defer r.Close()
+	for _, entry := range r.File {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		dest, ok := destOf(entry.Name)
+		if !ok {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", entry.Name)
+		}
+		err = WriteFileAtomic(dest, rc, int64(entry.UncompressedSize64))
+		rc.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to extract %s", entry.Name)
+		}
+	}
+	return nil
+}
+
+// WriteFileAtomic writes size bytes of r to dest through a temporary file, so
+// the runtime never finds a partially written artifact.
+func WriteFileAtomic(dest string, r io.Reader, size int64) error {
+	if size < 0 || size > maxExtractedFileBytes {
+		return errors.Errorf("invalid file size %d", size)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), defaultCacheDirPerm); err != nil {
+		return errors.Wrap(err, "failed to create directory")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	written, copyErr := io.Copy(tmp, io.LimitReader(r, size+1))
+	syncErr := tmp.Sync()
+	closeErr := tmp.Close()
+	switch {
+	case copyErr != nil:
+		err = errors.Wrap(copyErr, "failed to write file")
+	case written != size:
+		err = errors.Errorf("size mismatch: expected %d bytes, got %d", size, written)
+	case syncErr != nil:
+		err = errors.Wrap(syncErr, "failed to sync file")
+	case closeErr != nil:
+		err = errors.Wrap(closeErr, "failed to close file")
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o700)
+	}
+	if err == nil {
+		err = errors.Wrap(os.Rename(tmp.Name(), dest), "failed to move file into place")
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
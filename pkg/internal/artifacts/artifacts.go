@@ -0,0 +1,402 @@
+// Package artifacts downloads, verifies and caches the native artifacts used by
+// chroma-go: the local Chroma shim, libtokenizers, ONNX models and the ONNX
+// Runtime. All of them share one cache root, one set of mirror settings, one
+// cross-process download lock and the same checksum and cosign verification.
+//
+// The cache root is ~/.cache/chroma unless CHROMA_CACHE_DIR is set. Mirrors are
+// tried before the upstream release URLs. CHROMA_ARTIFACT_MIRROR is a base URL
+// below which each artifact lives in its own directory (see [Artifact.MirrorPath]),
+// and the per-artifact variables (see [Artifact.MirrorEnv]) take a comma-separated
+// list of base URLs that replace the upstream URL of that artifact.
+package artifacts
+
+import (
+	"context"
+	"crypto/x509"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/cosignutil"
+	downloadutil "github.com/amikos-tech/chroma-go/pkg/internal/downloadutil"
+)
+
+const (
+	// CacheDirEnv overrides the cache root shared by all artifacts.
+	CacheDirEnv = "CHROMA_CACHE_DIR"
+	// MirrorEnv is a base URL mirroring all artifacts, e.g. an Artifactory
+	// generic remote repository.
+	MirrorEnv = "CHROMA_ARTIFACT_MIRROR"
+
+	defaultDownloadAttempts       = 3
+	defaultMaxArtifactBytes int64 = 500 * 1024 * 1024
+	defaultCacheDirPerm           = os.FileMode(0700)
+)
+
+// Artifact describes a family of cached artifacts.
+type Artifact struct {
+	// Name is the directory of the artifact below the cache root.
+	Name string
+	// MirrorEnv names the environment variable with comma-separated mirror base
+	// URLs of this artifact.
+	MirrorEnv string
+	// MirrorPath is the directory of the artifact below the CHROMA_ARTIFACT_MIRROR base URL.
+	MirrorPath string
+}
+
+var (
+	// LocalShim is the local Chroma runtime library, released as
+	// <base>/<version>/<archive> with signed SHA256SUMS.
+	LocalShim = Artifact{Name: "local_shim", MirrorEnv: "CHROMA_LOCAL_SHIM_MIRROR", MirrorPath: "chroma-go-local"}
+	// Tokenizers is the libtokenizers library, released as
+	// <base>/<version>/<archive> with signed SHA256SUMS.
+	Tokenizers = Artifact{Name: "pure_tokenizers", MirrorEnv: "CHROMA_TOKENIZERS_MIRROR", MirrorPath: "pure-tokenizers"}
+	// OnnxModels are the ONNX embedding and reranking models, verified against
+	// pinned checksums.
+	OnnxModels = Artifact{Name: "onnx_models", MirrorEnv: "CHROMA_ONNX_MODELS_MIRROR", MirrorPath: "onnx-models"}
+	// OnnxRuntime is the ONNX Runtime library, released as <base>/v<version>/<archive>
+	// and verified against the digests GitHub publishes for the release (see
+	// [Manager.FetchOnnxRuntime]). It is installed in the layout of the pure-onnx
+	// bootstrap, which loads it from this directory.
+	OnnxRuntime = Artifact{Name: filepath.Join("shared", "onnxruntime"), MirrorEnv: "CHROMA_ONNX_RUNTIME_MIRROR", MirrorPath: "onnxruntime"}
+)
+
+// Known returns all artifacts stored in the cache.
+func Known() []Artifact {
+	return []Artifact{LocalShim, Tokenizers, OnnxModels, OnnxRuntime}
+}
+
+// DownloadFunc downloads url to dest.
+type DownloadFunc func(ctx context.Context, dest, url string) error
+
+// Manager downloads and verifies artifacts into the cache.
+type Manager struct {
+	root             string
+	getenv           func(string) string
+	mirrors          map[string][]string
+	progress         downloadutil.ProgressFunc
+	attempts         int
+	maxBytes         int64
+	allowHTTP        bool
+	lock             LockConfig
+	download         DownloadFunc
+	downloadMetadata DownloadFunc
+	chainVerifier    func(*x509.Certificate) error
+	// onnxRuntimeChecksums resolves the checksums of ONNX Runtime releases
+	onnxRuntimeChecksums OnnxRuntimeChecksumsFunc
+}
+
+// Option configures a [Manager].
+type Option func(*Manager) error
+
+// WithCacheRoot sets the cache root, taking precedence over CHROMA_CACHE_DIR.
+func WithCacheRoot(dir string) Option {
+	return func(m *Manager) error {
+		if strings.TrimSpace(dir) == "" {
+			return errors.New("cache root cannot be empty")
+		}
+		m.root = dir
+		return nil
+	}
+}
+
+// WithMirrors sets the mirror base URLs of an artifact, taking precedence over
+// the environment.
+func WithMirrors(artifact Artifact, baseURLs ...string) Option {
+	return func(m *Manager) error {
+		m.mirrors[artifact.Name] = append(m.mirrors[artifact.Name], baseURLs...)
+		return nil
+	}
+}
+
+// WithProgress reports the progress of every download.
+func WithProgress(progress downloadutil.ProgressFunc) Option {
+	return func(m *Manager) error {
+		m.progress = progress
+		return nil
+	}
+}
+
+// WithDownloadAttempts sets how often a download is attempted before the next mirror is tried.
+func WithDownloadAttempts(attempts int) Option {
+	return func(m *Manager) error {
+		if attempts < 1 {
+			return errors.New("download attempts must be at least 1")
+		}
+		m.attempts = attempts
+		return nil
+	}
+}
+
+// WithMaxBytes limits the size of downloaded files.
+func WithMaxBytes(maxBytes int64) Option {
+	return func(m *Manager) error {
+		if maxBytes <= 0 {
+			return errors.New("max bytes must be greater than zero")
+		}
+		m.maxBytes = maxBytes
+		return nil
+	}
+}
+
+// WithLockConfig overrides [DefaultLockConfig].
+func WithLockConfig(cfg LockConfig) Option {
+	return func(m *Manager) error {
+		m.lock = cfg
+		return nil
+	}
+}
+
+// WithDownloader replaces the HTTP download of artifacts and, unless
+// [WithMetadataDownloader] is set, of checksum and signature files.
+func WithDownloader(download DownloadFunc) Option {
+	return func(m *Manager) error {
+		if download == nil {
+			return errors.New("downloader cannot be nil")
+		}
+		m.download = download
+		return nil
+	}
+}
+
+// WithMetadataDownloader replaces the download of checksum and signature files.
+func WithMetadataDownloader(download DownloadFunc) Option {
+	return func(m *Manager) error {
+		if download == nil {
+			return errors.New("metadata downloader cannot be nil")
+		}
+		m.downloadMetadata = download
+		return nil
+	}
+}
+
+// WithCertificateChainVerifier replaces the check of signing certificates
+// against the pinned Fulcio chain.
+func WithCertificateChainVerifier(verify func(*x509.Certificate) error) Option {
+	return func(m *Manager) error {
+		if verify == nil {
+			return errors.New("certificate chain verifier cannot be nil")
+		}
+		m.chainVerifier = verify
+		return nil
+	}
+}
+
+// WithAllowHTTP permits plain HTTP mirrors, for tests.
+func WithAllowHTTP() Option {
+	return func(m *Manager) error {
+		m.allowHTTP = true
+		return nil
+	}
+}
+
+func withGetenv(getenv func(string) string) Option {
+	return func(m *Manager) error {
+		m.getenv = getenv
+		return nil
+	}
+}
+
+// New returns a Manager configured from the environment and opts.
+func New(opts ...Option) (*Manager, error) {
+	m := &Manager{
+		getenv:        os.Getenv,
+		mirrors:       map[string][]string{},
+		attempts:      defaultDownloadAttempts,
+		maxBytes:      defaultMaxArtifactBytes,
+		lock:          DefaultLockConfig(),
+		chainVerifier: cosignutil.VerifyFulcioCertificateChain,
+
+		onnxRuntimeChecksums: GitHubOnnxRuntimeChecksums,
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	for name, baseURLs := range m.mirrors {
+		for _, baseURL := range baseURLs {
+			if _, err := normalizeBaseURL(baseURL, m.allowHTTP); err != nil {
+				return nil, errors.Wrapf(err, "invalid mirror for %s", name)
+			}
+		}
+	}
+	if m.root == "" {
+		m.root = defaultCacheRoot(m.getenv)
+	}
+	if m.download == nil {
+		m.download = m.httpDownload
+	}
+	if m.downloadMetadata == nil {
+		m.downloadMetadata = m.download
+	}
+	return m, nil
+}
+
+// CacheRoot returns the cache root configured by CHROMA_CACHE_DIR, or
+// ~/.cache/chroma. Without a home directory the temp directory is used.
+func CacheRoot() string {
+	return defaultCacheRoot(os.Getenv)
+}
+
+func defaultCacheRoot(getenv func(string) string) string {
+	if dir := strings.TrimSpace(getenv(CacheDirEnv)); dir != "" {
+		return dir
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil || strings.TrimSpace(homeDir) == "" {
+		homeDir = strings.TrimSpace(getenv("HOME"))
+	}
+	if homeDir == "" {
+		homeDir = os.TempDir()
+	}
+	return filepath.Join(homeDir, ".cache", "chroma")
+}
+
+// Root returns the cache root.
+func (m *Manager) Root() string {
+	return m.root
+}
+
+// Dir returns the cache directory of artifact, joined with elem.
+func (m *Manager) Dir(artifact Artifact, elem ...string) string {
+	return filepath.Join(append([]string{m.root, artifact.Name}, elem...)...)
+}
+
+// BaseURLs returns the base URLs to download artifact from, in order: the
+// mirrors set with [WithMirrors], those in the artifact's mirror variable, the
+// artifact below CHROMA_ARTIFACT_MIRROR and finally defaults. Invalid and
+// duplicate URLs are dropped.
+func (m *Manager) BaseURLs(artifact Artifact, defaults ...string) []string {
+	candidates := append(m.Mirrors(artifact), defaults...)
+	seen := make(map[string]struct{}, len(candidates))
+	bases := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		normalized, err := normalizeBaseURL(candidate, m.allowHTTP)
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[normalized]; ok {
+			continue
+		}
+		seen[normalized] = struct{}{}
+		bases = append(bases, normalized)
+	}
+	return bases
+}
+
+// Mirrors returns the configured mirror base URLs of artifact, unvalidated, in
+// the order of [Manager.BaseURLs].
+func (m *Manager) Mirrors(artifact Artifact) []string {
+	mirrors := append([]string{}, m.mirrors[artifact.Name]...)
+	if artifact.MirrorEnv != "" {
+		for _, mirror := range strings.Split(m.getenv(artifact.MirrorEnv), ",") {
+			if mirror = strings.TrimSpace(mirror); mirror != "" {
+				mirrors = append(mirrors, mirror)
+			}
+		}
+	}
+	if base := strings.TrimSpace(m.getenv(MirrorEnv)); base != "" && artifact.MirrorPath != "" {
+		mirrors = append(mirrors, strings.TrimRight(base, "/")+"/"+artifact.MirrorPath)
+	}
+	return mirrors
+}
+
+// ValidateBaseURL trims trailing slashes from baseURL and checks that it is an
+// absolute HTTPS URL.
+func ValidateBaseURL(baseURL string) (string, error) {
+	return normalizeBaseURL(baseURL, false)
+}
+
+func normalizeBaseURL(baseURL string, allowHTTP bool) (string, error) {
+	baseURL = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(baseURL), "/"))
+	if baseURL == "" {
+		return "", errors.New("release base URL cannot be empty")
+	}
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid release base URL")
+	}
+	if !parsedURL.IsAbs() {
+		return "", errors.New("release base URL must be absolute")
+	}
+	if !strings.EqualFold(parsedURL.Scheme, "https") && !(allowHTTP && strings.EqualFold(parsedURL.Scheme, "http")) {
+		return "", errors.Errorf("release base URL must use https scheme: %s", parsedURL.Redacted())
+	}
+	if strings.TrimSpace(parsedURL.Host) == "" {
+		return "", errors.Errorf("release base URL host cannot be empty: %s", parsedURL.Redacted())
+	}
+	return baseURL, nil
+}
+
+// Lock acquires the download lock of dir.
+func (m *Manager) Lock(dir string) (*Lock, error) {
+	lockFile, err := AcquireLock(filepath.Join(dir, LockFileName), m.lock)
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{file: lockFile, stopHeartbeat: StartHeartbeat(lockFile, m.lock.HeartbeatInterval)}, nil
+}
+
+// Download downloads url to dest. Interrupted downloads are resumed from
+// dest + ".partial" by later attempts and calls.
+func (m *Manager) Download(ctx context.Context, dest, url string) error {
+	return m.download(ctx, dest, url)
+}
+
+func (m *Manager) httpDownload(ctx context.Context, dest, url string) error {
+	return errors.WithStack(downloadutil.DownloadFileWithRetryContext(ctx, dest, url, m.attempts, downloadutil.Config{
+		MaxBytes:  m.maxBytes,
+		DirPerm:   defaultCacheDirPerm,
+		AllowHTTP: m.allowHTTP,
+		Resume:    true,
+		Progress:  m.progress,
+	}))
+}
+
+// FetchVerified makes dest a file with the SHA-256 checksum, downloading it from
+// the first of urls that serves the expected content. A cached dest with the
+// right checksum is not downloaded again.
+func (m *Manager) FetchVerified(ctx context.Context, dest, checksum string, urls ...string) error {
+	if ok, err := fileExistsNonEmpty(dest); err != nil {
+		return errors.Wrapf(err, "failed to stat %s", dest)
+	} else if ok {
+		if VerifyFile(dest, checksum) == nil {
+			return nil
+		}
+		if err := os.Remove(dest); err != nil {
+			return errors.Wrapf(err, "failed to remove corrupted file %s", dest)
+		}
+	}
+	if len(urls) == 0 {
+		return errors.New("no download URL available")
+	}
+	var errs []error
+	for _, u := range urls {
+		if err := m.download(ctx, dest, u); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := VerifyFile(dest, checksum); err != nil {
+			_ = os.Remove(dest)
+			errs = append(errs, err)
+			continue
+		}
+		return nil
+	}
+	return errors.Wrapf(joinErrors(errs), "failed to download %s", filepath.Base(dest))
+}
+
+func fileExistsNonEmpty(filePath string) (bool, error) {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir() && info.Size() > 0, nil
+}
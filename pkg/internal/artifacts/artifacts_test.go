@@ -0,0 +1,383 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/cosignutil"
+)
+
+const (
+	testIdentity = "https://github.com/amikos-tech/example/.github/workflows/release.yml@refs/tags/v1.0.0"
+	testIssuer   = "https://token.actions.githubusercontent.com"
+)
+
+func newTestManager(t *testing.T, env map[string]string, opts ...Option) *Manager {
+	t.Helper()
+	opts = append([]Option{
+		WithCacheRoot(t.TempDir()),
+		WithAllowHTTP(),
+		withGetenv(func(key string) string { return env[key] }),
+		WithCertificateChainVerifier(func(*x509.Certificate) error { return nil }),
+	}, opts...)
+	m, err := New(opts...)
+	require.NoError(t, err)
+	return m
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCacheRootFromEnvironment(t *testing.T) {
+	m, err := New(withGetenv(func(key string) string {
+		if key == CacheDirEnv {
+			return "/data/chroma-cache"
+		}
+		return ""
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "/data/chroma-cache", m.Root())
+	require.Equal(t, filepath.Join("/data/chroma-cache", "local_shim", "v1.0.0"), m.Dir(LocalShim, "v1.0.0"))
+}
+
+func TestBaseURLsOrder(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"CHROMA_TOKENIZERS_MIRROR": " https://mirror-a.example.com/tok/ ,,https://upstream.example.com",
+		MirrorEnv:                  "https://artifactory.example.com/chroma/",
+	}, WithMirrors(Tokenizers, "https://configured.example.com"))
+
+	require.Equal(t, []string{
+		"https://configured.example.com",
+		"https://mirror-a.example.com/tok",
+		"https://upstream.example.com",
+		"https://artifactory.example.com/chroma/pure-tokenizers",
+	}, m.BaseURLs(Tokenizers, "https://upstream.example.com/", "ftp://invalid.example.com"))
+	require.Equal(t, []string{"https://artifactory.example.com/chroma/onnx-models"}, m.BaseURLs(OnnxModels))
+
+	_, err := New(WithMirrors(LocalShim, "http://insecure.example.com"))
+	require.ErrorContains(t, err, "invalid mirror for local_shim")
+}
+
+func TestFetchVerifiedFallsBackToNextMirror(t *testing.T) {
+	payload := []byte("model-bytes")
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/corrupted/model.tar.gz":
+			_, _ = w.Write([]byte("tampered"))
+		case "/good/model.tar.gz":
+			_, _ = w.Write(payload)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	m := newTestManager(t, nil, WithDownloadAttempts(1))
+	dest := m.Dir(OnnxModels, "model.tar.gz")
+	err := m.FetchVerified(context.Background(), dest, sha256Hex(payload),
+		server.URL+"/missing/model.tar.gz",
+		server.URL+"/corrupted/model.tar.gz",
+		server.URL+"/good/model.tar.gz",
+	)
+	require.NoError(t, err)
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, payload, data)
+	require.EqualValues(t, 3, requests.Load())
+
+	// cached and valid, nothing is downloaded
+	require.NoError(t, m.FetchVerified(context.Background(), dest, sha256Hex(payload), server.URL+"/good/model.tar.gz"))
+	require.EqualValues(t, 3, requests.Load())
+
+	err = m.FetchVerified(context.Background(), dest, sha256Hex([]byte("other")), server.URL+"/corrupted/model.tar.gz")
+	require.ErrorContains(t, err, "checksum mismatch")
+	_, statErr := os.Stat(dest)
+	require.True(t, os.IsNotExist(statErr))
+}
+
+func TestDownloadReportsProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("payload"))
+	}))
+	defer server.Close()
+
+	var last int64
+	m := newTestManager(t, nil, WithProgress(func(downloaded, total int64) { last = downloaded }))
+	require.NoError(t, m.Download(context.Background(), filepath.Join(m.Root(), "file"), server.URL))
+	require.EqualValues(t, 7, last)
+}
+
+func newSignedChecksums(t *testing.T, checksums []byte) (signature, certificate []byte) {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	identityURI, err := url.Parse(testIdentity)
+	require.NoError(t, err)
+	issuer, err := asn1.Marshal(testIssuer)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{identityURI},
+		ExtraExtensions: []pkix.Extension{{Id: cosignutil.OIDCIssuerExtensionOID(), Value: issuer}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	digest := sha256.Sum256(checksums)
+	sig, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	require.NoError(t, err)
+	return []byte(base64.StdEncoding.EncodeToString(sig)), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestFetchSignedChecksums(t *testing.T) {
+	archive := []byte("archive-bytes")
+	checksums := []byte(sha256Hex(archive) + "  *dist/lib-v1.0.0.tar.gz\n")
+	signature, certificate := newSignedChecksums(t, checksums)
+	files := map[string][]byte{
+		"/v1.0.0/" + ChecksumsAsset:            checksums,
+		"/v1.0.0/" + ChecksumsSignatureAsset:   signature,
+		"/v1.0.0/" + ChecksumsCertificateAsset: certificate,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	m := newTestManager(t, nil, WithDownloadAttempts(1))
+	dir := m.Dir(Tokenizers, "v1.0.0")
+	signer := Signer{Identities: []string{"https://example.com/other-identity", testIdentity}, OIDCIssuer: testIssuer}
+	sumsPath, err := m.FetchSignedChecksums(context.Background(), server.URL+"/v1.0.0", dir, signer)
+	require.NoError(t, err)
+	name, checksum, err := ChecksumFromSums(sumsPath, "other.tar.gz", "lib-v1.0.0.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, "lib-v1.0.0.tar.gz", name)
+	require.Equal(t, sha256Hex(archive), checksum)
+
+	_, err = m.FetchSignedChecksums(context.Background(), server.URL+"/v1.0.0", dir,
+		Signer{Identities: []string{"https://example.com/other-identity"}, OIDCIssuer: testIssuer})
+	require.ErrorContains(t, err, "failed to verify checksums signature")
+
+	files["/v1.0.0/"+ChecksumsAsset] = []byte(strings.Repeat("0", 64) + "  lib-v1.0.0.tar.gz\n")
+	_, err = m.FetchSignedChecksums(context.Background(), server.URL+"/v1.0.0", dir, signer)
+	require.Error(t, err, "checksums that don't match the signature are rejected")
+}
+
+func TestFetchOnnxRuntime(t *testing.T) {
+	asset, err := OnnxRuntimeAssetFor(runtime.GOOS, runtime.GOARCH)
+	if err != nil || asset.Extension != "tgz" {
+		t.Skip("no tar.gz ONNX Runtime release for this platform")
+	}
+	const version = "1.2.3"
+	library := strings.Replace(asset.LibraryGlob, "*", "", 1)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range map[string]string{
+		asset.InstallDirName(version) + "/lib/" + library: "runtime",
+		asset.InstallDirName(version) + "/README.md":      "readme",
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	archive := buf.Bytes()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/ort/v"+version+"/"+asset.ArchiveFileName(version) {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+
+	checksum := sha256Hex(archive)
+	m := newTestManager(t, map[string]string{"CHROMA_ONNX_RUNTIME_MIRROR": server.URL + "/ort"},
+		WithDownloadAttempts(1),
+		WithOnnxRuntimeChecksums(func(_ context.Context, v string) (map[string]string, error) {
+			return map[string]string{asset.ArchiveFileName(v): checksum}, nil
+		}),
+	)
+	dir := m.Dir(OnnxRuntime)
+	path, err := m.FetchOnnxRuntime(context.Background(), dir, version, "")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, asset.InstallDirName(version), "lib", library), path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "runtime", string(data))
+	_, err = os.Stat(filepath.Join(dir, asset.ArchiveFileName(version)))
+	require.True(t, os.IsNotExist(err), "the archive is removed after installation")
+
+	// installed, nothing is downloaded
+	_, err = m.FetchOnnxRuntime(context.Background(), dir, version, "")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, requests.Load())
+
+	_, err = m.FetchOnnxRuntime(context.Background(), m.Dir(OnnxRuntime, "other"), version, sha256Hex([]byte("other")))
+	require.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestGitHubOnnxRuntimeChecksumsAuthorization(t *testing.T) {
+	digest := strings.Repeat("a", 64)
+	var authorization atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		if r.URL.Path != "/v1.2.3" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"assets":[{"name":"onnxruntime-linux-x64-1.2.3.tgz","digest":"sha256:` + digest + `"},{"name":"unsigned.tgz"}]}`))
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "github token", env: map[string]string{"GITHUB_TOKEN": "token-a", "GH_TOKEN": "token-b"}, want: "Bearer token-a"},
+		{name: "falls back to gh token", env: map[string]string{"GITHUB_TOKEN": " ", "GH_TOKEN": "token-b"}, want: "Bearer token-b"},
+		{name: "no token", env: map[string]string{}, want: ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			checksums, err := githubOnnxRuntimeChecksums(context.Background(), server.URL, "1.2.3", func(key string) string { return tt.env[key] })
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"onnxruntime-linux-x64-1.2.3.tgz": digest}, checksums)
+			require.Equal(t, tt.want, authorization.Load())
+		})
+	}
+}
+
+func TestAcquireLockWaitsAndEvictsStaleLocks(t *testing.T) {
+	cfg := LockConfig{WaitTimeout: 600 * time.Millisecond, StaleAfter: time.Minute}
+	lockPath := filepath.Join(t.TempDir(), LockFileName)
+	first, err := AcquireLock(lockPath, cfg)
+	require.NoError(t, err)
+
+	_, err = AcquireLock(lockPath, cfg)
+	require.ErrorContains(t, err, "timeout waiting for lock")
+
+	old := time.Now().Add(-2 * time.Minute)
+	require.NoError(t, os.Chtimes(lockPath, old, old))
+	second, err := AcquireLock(lockPath, cfg)
+	require.NoError(t, err, "stale locks are evicted")
+	require.NoError(t, ReleaseLock(second))
+	require.NoError(t, ReleaseLock(first), "releasing an evicted lock is not an error")
+}
+
+func TestLockHeartbeatKeepsLockActive(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, nil, WithLockConfig(LockConfig{
+		WaitTimeout:       300 * time.Millisecond,
+		StaleAfter:        time.Second,
+		HeartbeatInterval: 50 * time.Millisecond,
+	}))
+	lock, err := m.Lock(dir)
+	require.NoError(t, err)
+	old := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, LockFileName), old, old))
+	time.Sleep(200 * time.Millisecond)
+
+	_, err = m.Lock(dir)
+	require.ErrorContains(t, err, "timeout waiting for lock")
+	require.NoError(t, lock.Unlock())
+	_, err = os.Stat(filepath.Join(dir, LockFileName))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestListAndPrune(t *testing.T) {
+	m := newTestManager(t, nil)
+	write := func(path string, size int, modTime time.Time) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	write(m.Dir(LocalShim, "v0.3.4", "linux-amd64", "libchroma_shim.so"), 10, old)
+	write(m.Dir(LocalShim, "v0.3.5", "linux-amd64", "libchroma_shim.so"), 20, time.Now())
+	write(m.Dir(OnnxModels, "all-MiniLM-L6-v2", "onnx", "model.onnx"), 5, old)
+	write(m.Dir(OnnxModels, "onnx.tar.gz"), 5, old)
+	write(m.Dir(Tokenizers, "v0.1.4", "linux-amd64", "libtokenizers.so"), 7, old)
+	write(m.Dir(Tokenizers, "v0.1.4", "linux-amd64", LockFileName), 1, time.Now())
+
+	entries, err := m.List()
+	require.NoError(t, err)
+	var listed []string
+	for _, e := range entries {
+		listed = append(listed, e.Artifact+"/"+e.Version)
+	}
+	require.Equal(t, []string{
+		"local_shim/v0.3.4", "local_shim/v0.3.5", "onnx_models/all-MiniLM-L6-v2", "pure_tokenizers/v0.1.4",
+	}, listed)
+	require.EqualValues(t, 20, entries[1].Size)
+
+	removed, err := m.Prune(OlderThan(7 * 24 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, removed, 2, "the tokenizers download in progress is kept")
+	entries, err = m.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "v0.3.5", entries[0].Version)
+	require.Equal(t, "pure_tokenizers", entries[1].Artifact)
+}
+
+func TestNormalizedChecksumAssetName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "bsd marker", input: "*local-chroma-v0.4.0-linux-amd64.tar.gz", want: "local-chroma-v0.4.0-linux-amd64.tar.gz"},
+		{name: "relative path", input: "./local-chroma-v0.4.0-linux-amd64.tar.gz", want: "local-chroma-v0.4.0-linux-amd64.tar.gz"},
+		{name: "windows path", input: `chroma-go-local\v0.4.0\local-chroma-v0.4.0-linux-amd64.tar.gz`, want: "local-chroma-v0.4.0-linux-amd64.tar.gz"},
+		{name: "deep path", input: "prefix/nested/path/chroma-go-local-v0.4.0-linux-amd64.tar.gz", want: "chroma-go-local-v0.4.0-linux-amd64.tar.gz"},
+		{name: "blank", input: "   ", want: ""},
+		{name: "parent directory", input: "..", want: ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, normalizedChecksumAssetName(tc.input))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package artifacts
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Entry is a cached version of an artifact: a release version of the native
+// libraries, a model, or an ONNX Runtime version.
+type Entry struct {
+	Artifact string
+	Version  string
+	Path     string
+	// Size is the total size of the files of the entry in bytes.
+	Size int64
+	// ModTime is the most recent modification time of its files.
+	ModTime time.Time
+}
+
+// List returns the cached entries of all known artifacts, sorted by artifact and version.
+func (m *Manager) List() ([]Entry, error) {
+	var entries []Entry
+	for _, artifact := range Known() {
+		dir := m.Dir(artifact)
+		children, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read cache dir %s", dir)
+		}
+		for _, child := range children {
+			if !child.IsDir() || strings.HasPrefix(child.Name(), ".") {
+				continue
+			}
+			entry := Entry{Artifact: artifact.Name, Version: child.Name(), Path: filepath.Join(dir, child.Name())}
+			if err := filepath.WalkDir(entry.Path, func(_ string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				entry.Size += info.Size()
+				if info.ModTime().After(entry.ModTime) {
+					entry.ModTime = info.ModTime()
+				}
+				return nil
+			}); err != nil {
+				return nil, errors.Wrapf(err, "failed to read cache entry %s", entry.Path)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Artifact != entries[j].Artifact {
+			return entries[i].Artifact < entries[j].Artifact
+		}
+		return entries[i].Version < entries[j].Version
+	})
+	return entries, nil
+}
+
+// Prune removes the cached entries for which keep returns false and returns
+// them. Entries with a download in progress are kept.
+func (m *Manager) Prune(keep func(Entry) bool) ([]Entry, error) {
+	entries, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []Entry
+	for _, entry := range entries {
+		if keep(entry) || m.downloadInProgress(entry) {
+			continue
+		}
+		if err := os.RemoveAll(entry.Path); err != nil {
+			return removed, errors.Wrapf(err, "failed to remove cache entry %s", entry.Path)
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
+
+// OlderThan returns a [Manager.Prune] filter keeping entries modified within age.
+func OlderThan(age time.Duration) func(Entry) bool {
+	cutoff := time.Now().Add(-age)
+	return func(e Entry) bool { return e.ModTime.After(cutoff) }
+}
+
+func (m *Manager) downloadInProgress(entry Entry) bool {
+	// locks live in the entry, or in the artifact directory for models
+	if isLockActive(filepath.Join(filepath.Dir(entry.Path), LockFileName), m.lock.StaleAfter) {
+		return true
+	}
+	active := false
+	_ = filepath.WalkDir(entry.Path, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.Name() == LockFileName && isLockActive(p, m.lock.StaleAfter) {
+			active = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return active
+}
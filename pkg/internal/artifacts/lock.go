@@ -0,0 +1,196 @@
+package artifacts
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LockFileName is the name of the lock file guarding downloads into a cache directory.
+const LockFileName = ".download.lock"
+
+// LockConfig controls how download locks are acquired and kept alive.
+type LockConfig struct {
+	// WaitTimeout is how long to wait for a lock held by another process.
+	WaitTimeout time.Duration
+	// StaleAfter is the age after which a lock that is not refreshed is evicted.
+	StaleAfter time.Duration
+	// HeartbeatInterval is how often a held lock is refreshed, disabled when zero or negative.
+	HeartbeatInterval time.Duration
+	// DirPerm is used when the lock directory is created; defaults to 0700 when zero.
+	DirPerm os.FileMode
+}
+
+// DefaultLockConfig returns the lock settings shared by all artifacts.
+func DefaultLockConfig() LockConfig {
+	return LockConfig{
+		WaitTimeout:       2 * time.Minute,
+		StaleAfter:        10 * time.Minute,
+		HeartbeatInterval: 30 * time.Second,
+		DirPerm:           0700,
+	}
+}
+
+// Lock is a cross-process download lock with a running heartbeat.
+type Lock struct {
+	file          *os.File
+	stopHeartbeat func() error
+}
+
+// Unlock stops the heartbeat and removes the lock file.
+func (l *Lock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	if err := l.stopHeartbeat(); err != nil {
+		errs = append(errs, errors.Wrapf(err, "failed to stop download lock heartbeat for %s", l.file.Name()))
+	}
+	if err := ReleaseLock(l.file); err != nil {
+		errs = append(errs, errors.Wrapf(err, "failed to release download lock %s", l.file.Name()))
+	}
+	return stderrors.Join(errs...)
+}
+
+// AcquireLock creates lockPath exclusively, waiting for other holders and
+// evicting locks that have not been refreshed for cfg.StaleAfter.
+func AcquireLock(lockPath string, cfg LockConfig) (*os.File, error) {
+	if cfg.DirPerm == 0 {
+		cfg.DirPerm = 0700
+	}
+	lockDir := filepath.Dir(lockPath)
+	if err := os.MkdirAll(lockDir, cfg.DirPerm); err != nil {
+		return nil, errors.Wrap(err, "failed to create lock directory")
+	}
+
+	deadline := time.Now().Add(cfg.WaitTimeout)
+	for {
+		lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, _ = fmt.Fprintf(lockFile, "%d", os.Getpid())
+			_ = lockFile.Sync()
+			return lockFile, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrap(err, "failed to create lock file")
+		}
+
+		if info, statErr := os.Stat(lockPath); statErr == nil {
+			evictStale, staleErr := shouldEvictStaleLock(lockPath, info, cfg.StaleAfter)
+			if staleErr != nil {
+				return nil, staleErr
+			}
+			if evictStale {
+				if removeErr := os.Remove(lockPath); removeErr != nil && !os.IsNotExist(removeErr) {
+					return nil, errors.Wrapf(removeErr, "failed to remove stale lock file %s", lockPath)
+				}
+				continue
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("timeout waiting for lock: %s", lockPath)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// ReleaseLock closes and removes a lock file returned by [AcquireLock].
+func ReleaseLock(lockFile *os.File) error {
+	if lockFile == nil {
+		return nil
+	}
+	lockPath := lockFile.Name()
+	var errs []error
+	if closeErr := lockFile.Close(); closeErr != nil {
+		errs = append(errs, errors.Wrap(closeErr, "failed to close download lock file"))
+	}
+	if removeErr := os.Remove(lockPath); removeErr != nil && !os.IsNotExist(removeErr) {
+		errs = append(errs, errors.Wrapf(removeErr, "failed to remove download lock file %s", lockPath))
+	}
+	if len(errs) > 0 {
+		return stderrors.Join(errs...)
+	}
+	return nil
+}
+
+// StartHeartbeat refreshes the modification time of lockFile every interval so
+// that other processes don't consider it stale. The returned function stops the
+// heartbeat and is safe to call more than once.
+func StartHeartbeat(lockFile *os.File, interval time.Duration) func() error {
+	if lockFile == nil || interval <= 0 {
+		return func() error { return nil }
+	}
+
+	lockPath := lockFile.Name()
+	stopCh := make(chan struct{})
+	doneCh := make(chan error, 1)
+	var stopOnce sync.Once
+	var stopErr error
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				now := time.Now()
+				if err := os.Chtimes(lockPath, now, now); err != nil {
+					if os.IsNotExist(err) {
+						doneCh <- nil
+					} else {
+						doneCh <- errors.Wrapf(err, "failed to refresh download lock file %s", lockPath)
+					}
+					return
+				}
+			case <-stopCh:
+				doneCh <- nil
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		stopOnce.Do(func() {
+			close(stopCh)
+			stopErr = <-doneCh
+		})
+		return stopErr
+	}
+}
+
+// isLockActive reports whether lockPath exists and has been refreshed within staleAfter.
+func isLockActive(lockPath string, staleAfter time.Duration) bool {
+	info, err := os.Stat(lockPath)
+	return err == nil && time.Since(info.ModTime()) <= staleAfter
+}
+
+func shouldEvictStaleLock(lockPath string, initialInfo os.FileInfo, staleAfter time.Duration) (bool, error) {
+	if initialInfo == nil || time.Since(initialInfo.ModTime()) <= staleAfter {
+		return false, nil
+	}
+
+	currentInfo, err := os.Stat(lockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to stat stale lock file %s", lockPath)
+	}
+
+	if !os.SameFile(initialInfo, currentInfo) {
+		return false, nil
+	}
+	if !currentInfo.ModTime().Equal(initialInfo.ModTime()) || currentInfo.Size() != initialInfo.Size() {
+		return false, nil
+	}
+	if time.Since(currentInfo.ModTime()) <= staleAfter {
+		return false, nil
+	}
+	return true, nil
+}
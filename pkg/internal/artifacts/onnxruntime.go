@@ -0,0 +1,266 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// OnnxRuntimeReleaseBaseURL hosts the ONNX Runtime release archives as
+	// <base>/v<version>/<archive>. Mirrors use the same layout.
+	OnnxRuntimeReleaseBaseURL = "https://github.com/microsoft/onnxruntime/releases/download"
+	// OnnxRuntimeReleaseAPIURL serves the metadata of ONNX Runtime releases,
+	// including the SHA-256 digests of their assets.
+	OnnxRuntimeReleaseAPIURL = "https://api.github.com/repos/microsoft/onnxruntime/releases/tags"
+
+	maxReleaseMetadataBytes = 10 * 1024 * 1024
+)
+
+var onnxRuntimeVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
+
+// OnnxRuntimeChecksumsFunc returns the archive checksums of an ONNX Runtime
+// release by asset name.
+type OnnxRuntimeChecksumsFunc func(ctx context.Context, version string) (map[string]string, error)
+
+// WithOnnxRuntimeChecksums replaces [GitHubOnnxRuntimeChecksums] as the source
+// of ONNX Runtime checksums.
+func WithOnnxRuntimeChecksums(checksums OnnxRuntimeChecksumsFunc) Option {
+	return func(m *Manager) error {
+		if checksums == nil {
+			return errors.New("ONNX Runtime checksums cannot be nil")
+		}
+		m.onnxRuntimeChecksums = checksums
+		return nil
+	}
+}
+
+// OnnxRuntimeAsset is the release archive of ONNX Runtime for one platform,
+// named like the pure-onnx bootstrap names it.
+type OnnxRuntimeAsset struct {
+	Platform    string
+	Extension   string
+	LibraryGlob string
+}
+
+// OnnxRuntimeAssetFor returns the ONNX Runtime release archive for a platform.
+func OnnxRuntimeAssetFor(goos, goarch string) (OnnxRuntimeAsset, error) {
+	switch goos + "/" + goarch {
+	case "darwin/arm64":
+		return OnnxRuntimeAsset{Platform: "osx-arm64", Extension: "tgz", LibraryGlob: "libonnxruntime*.dylib"}, nil
+	case "darwin/amd64":
+		return OnnxRuntimeAsset{Platform: "osx-x86_64", Extension: "tgz", LibraryGlob: "libonnxruntime*.dylib"}, nil
+	case "linux/arm64":
+		return OnnxRuntimeAsset{Platform: "linux-aarch64", Extension: "tgz", LibraryGlob: "libonnxruntime.so*"}, nil
+	case "linux/amd64":
+		return OnnxRuntimeAsset{Platform: "linux-x64", Extension: "tgz", LibraryGlob: "libonnxruntime.so*"}, nil
+	case "windows/amd64":
+		return OnnxRuntimeAsset{Platform: "win-x64", Extension: "zip", LibraryGlob: "onnxruntime*.dll"}, nil
+	case "windows/arm64":
+		return OnnxRuntimeAsset{Platform: "win-arm64", Extension: "zip", LibraryGlob: "onnxruntime*.dll"}, nil
+	}
+	return OnnxRuntimeAsset{}, errors.Errorf("unsupported platform for ONNX Runtime: %s/%s", goos, goarch)
+}
+
+// InstallDirName is the directory the pure-onnx bootstrap installs a release into.
+func (a OnnxRuntimeAsset) InstallDirName(version string) string {
+	return fmt.Sprintf("onnxruntime-%s-%s", a.Platform, version)
+}
+
+// ArchiveFileName is the name of the release archive.
+func (a OnnxRuntimeAsset) ArchiveFileName(version string) string {
+	return a.InstallDirName(version) + "." + a.Extension
+}
+
+// GitHubOnnxRuntimeChecksums reads the archive digests GitHub publishes for the
+// assets of an ONNX Runtime release. Microsoft does not sign release checksums,
+// so the digests are always read from GitHub, never from a mirror.
+func GitHubOnnxRuntimeChecksums(ctx context.Context, version string) (map[string]string, error) {
+	return githubOnnxRuntimeChecksums(ctx, OnnxRuntimeReleaseAPIURL, version, os.Getenv)
+}
+
+func githubOnnxRuntimeChecksums(ctx context.Context, apiURL, version string, getenv func(string) string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(apiURL, "/")+"/v"+version, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create release metadata request")
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	for _, env := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := strings.TrimSpace(getenv(env)); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+			break
+		}
+	}
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch release metadata")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("release metadata request returned %s", resp.Status)
+	}
+	var release struct {
+		Assets []struct {
+			Name   string `json:"name"`
+			Digest string `json:"digest"`
+		} `json:"assets"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxReleaseMetadataBytes)).Decode(&release); err != nil {
+		return nil, errors.Wrap(err, "failed to decode release metadata")
+	}
+	checksums := make(map[string]string, len(release.Assets))
+	for _, asset := range release.Assets {
+		if digest, ok := strings.CutPrefix(strings.ToLower(asset.Digest), "sha256:"); ok && LooksLikeSHA256(digest) {
+			checksums[asset.Name] = digest
+		}
+	}
+	return checksums, nil
+}
+
+// FetchOnnxRuntime installs the ONNX Runtime release version for the host into
+// dir, in the layout of the pure-onnx bootstrap, and returns the path of its
+// library. The archive is downloaded from the mirrors of [OnnxRuntime], then
+// from GitHub, and verified against checksum or, when it is empty, against the
+// release checksums (see [WithOnnxRuntimeChecksums]). An installed release is
+// not downloaded again.
+func (m *Manager) FetchOnnxRuntime(ctx context.Context, dir, version, checksum string) (string, error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if !onnxRuntimeVersionPattern.MatchString(version) {
+		return "", errors.Errorf("ONNX Runtime version must have format x.y.z, got %q", version)
+	}
+	asset, err := OnnxRuntimeAssetFor(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	installDir := filepath.Join(dir, asset.InstallDirName(version))
+	if library, ok := findOnnxRuntimeLibrary(installDir, asset); ok {
+		return library, nil
+	}
+	lock, err := m.Lock(dir)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to acquire lock for ONNX Runtime download")
+	}
+	defer lock.Unlock()
+	if library, ok := findOnnxRuntimeLibrary(installDir, asset); ok {
+		return library, nil
+	}
+
+	name := asset.ArchiveFileName(version)
+	if checksum == "" {
+		checksums, err := m.onnxRuntimeChecksums(ctx, version)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve checksums of ONNX Runtime %s", version)
+		}
+		var ok bool
+		if checksum, ok = checksums[name]; !ok {
+			return "", errors.Errorf("ONNX Runtime %s has no checksum for %s", version, name)
+		}
+	}
+	var urls []string
+	for _, base := range m.BaseURLs(OnnxRuntime, OnnxRuntimeReleaseBaseURL) {
+		urls = append(urls, fmt.Sprintf("%s/v%s/%s", base, version, name))
+	}
+	archive := filepath.Join(dir, name)
+	if err := m.FetchVerified(ctx, archive, checksum, urls...); err != nil {
+		return "", err
+	}
+	defer os.Remove(archive)
+	return ExtractOnnxRuntime(archive, dir, version, asset)
+}
+
+// ExtractOnnxRuntime extracts the libraries of an ONNX Runtime release archive
+// into the directory the pure-onnx bootstrap installs the release into below
+// dir, and returns the path of the library.
+func ExtractOnnxRuntime(archive, dir, version string, asset OnnxRuntimeAsset) (string, error) {
+	installDir := asset.InstallDirName(version)
+	libDir := filepath.Join(dir, installDir, "lib")
+	var libraries []string
+	var unsafe string
+	selectLibrary := func(name string) (string, bool) {
+		dir, base := path.Split(strings.TrimPrefix(path.Clean(name), "./"))
+		if dir != installDir+"/lib/" {
+			return "", false
+		}
+		if ok, _ := path.Match(asset.LibraryGlob, base); !ok {
+			return "", false
+		}
+		if !isSafeLibraryFileName(base) {
+			unsafe = base
+			return "", false
+		}
+		dest := filepath.Join(libDir, base)
+		libraries = append(libraries, dest)
+		return dest, true
+	}
+	var err error
+	if asset.Extension == "zip" {
+		err = ExtractZip(archive, selectLibrary)
+	} else {
+		err = ExtractTarGz(archive, selectLibrary)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to install ONNX Runtime")
+	}
+	if unsafe != "" {
+		return "", errors.Errorf("ONNX Runtime archive %s contains unsafe library file name %q", filepath.Base(archive), unsafe)
+	}
+	if len(libraries) == 0 {
+		return "", errors.Errorf("ONNX Runtime archive %s does not contain %s", filepath.Base(archive), asset.LibraryGlob)
+	}
+	return shortestPath(libraries), nil
+}
+
+// isSafeLibraryFileName reports whether name only contains characters of
+// library file names, as the library path ends up in environment variables and
+// shell export statements.
+func isSafeLibraryFileName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.' || r == '_' || r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func findOnnxRuntimeLibrary(installDir string, asset OnnxRuntimeAsset) (string, bool) {
+	matches, _ := filepath.Glob(filepath.Join(installDir, "lib", asset.LibraryGlob))
+	var libraries []string
+	for _, match := range matches {
+		if ok, _ := fileExistsNonEmpty(match); ok {
+			libraries = append(libraries, match)
+		}
+	}
+	if len(libraries) == 0 {
+		return "", false
+	}
+	return shortestPath(libraries), true
+}
+
+// shortestPath returns the unversioned library when there is one.
+func shortestPath(paths []string) string {
+	shortest := paths[0]
+	for _, p := range paths[1:] {
+		if len(p) < len(shortest) {
+			shortest = p
+		}
+	}
+	return shortest
+}
@@ -0,0 +1,136 @@
+package artifacts
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Upstream release locations and the cosign signers trusted for them.
+const (
+	LocalShimReleaseBaseURL         = "https://releases.amikos.tech/chroma-go-local"
+	LocalShimFallbackReleaseBaseURL = "https://github.com/amikos-tech/chroma-go-local/releases/download"
+	TokenizersReleaseBaseURL        = "https://releases.amikos.tech/pure-tokenizers"
+	TokenizersFallbackBaseURL       = "https://github.com/amikos-tech/pure-tokenizers/releases/download"
+	// OnnxModelsBaseURL hosts the ONNX model archives.
+	OnnxModelsBaseURL = "https://chroma-onnx-models.s3.amazonaws.com"
+
+	// DefaultModelArchivePath is the archive of the default embedding model
+	// all-MiniLM-L6-v2 below an ONNX models base URL.
+	DefaultModelArchivePath = "all-MiniLM-L6-v2/onnx.tar.gz"
+	// DefaultModelArchiveSHA256 pins the default model archive, which is not signed.
+	// To update: download the file and run `shasum -a 256 onnx.tar.gz`
+	DefaultModelArchiveSHA256 = "913d7300ceae3b2dbc2c50d1de4baacab4be7b9380491c27fab7418616a16ec3"
+
+	// GitHubActionsOIDCIssuer issues the identities of release workflows.
+	GitHubActionsOIDCIssuer    = "https://token.actions.githubusercontent.com"
+	LocalShimIdentityTemplate  = "https://github.com/amikos-tech/chroma-go-local/.github/workflows/release.yml@refs/tags/%s"
+	LocalShimMainIdentity      = "https://github.com/amikos-tech/chroma-go-local/.github/workflows/release.yml@refs/heads/main"
+	TokenizersIdentityTemplate = "https://github.com/amikos-tech/pure-tokenizers/.github/workflows/rust-release.yml@refs/tags/%s"
+)
+
+// LocalShimMainIdentityVersions lists versions whose release artifacts were signed
+// by a workflow_dispatch run on main rather than by a tag push, so they carry
+// LocalShimMainIdentity instead of the usual refs/tags/<version> identity. A function
+// (not a package-level var) so the allowance can't be widened by a stray append.
+// Add a version here only after decoding the published bundle's Fulcio certificate and
+// confirming the signer; every entry widens what we trust.
+func LocalShimMainIdentityVersions() []string {
+	return []string{"v0.3.4", "v0.3.5"}
+}
+
+// LocalShimSigner returns the signer trusted for a local shim release.
+func LocalShimSigner(version string) Signer {
+	identities := []string{fmt.Sprintf(LocalShimIdentityTemplate, version)}
+	if slices.Contains(LocalShimMainIdentityVersions(), strings.TrimSpace(version)) {
+		identities = append(identities, LocalShimMainIdentity)
+	}
+	return Signer{Identities: identities, OIDCIssuer: GitHubActionsOIDCIssuer}
+}
+
+// TokenizersSigner returns the signer trusted for a libtokenizers release.
+func TokenizersSigner(version string) Signer {
+	return Signer{
+		Identities: []string{fmt.Sprintf(TokenizersIdentityTemplate, version)},
+		OIDCIssuer: GitHubActionsOIDCIssuer,
+	}
+}
+
+// ReleaseAsset is the release archive of a native library for one platform.
+type ReleaseAsset struct {
+	// Platform is the cache directory of the library below its version.
+	Platform string
+	// ArchiveNames are the candidate archive names, in order of preference.
+	ArchiveNames []string
+	// Library is the shared library inside the archive.
+	Library string
+}
+
+// LocalShimAsset returns the local shim release archive of version for a platform.
+func LocalShimAsset(version, goos, goarch string) (ReleaseAsset, error) {
+	var platformOS, requiredArch, library string
+	switch goos {
+	case "linux":
+		platformOS, requiredArch, library = "linux", "amd64", "libchroma_shim.so"
+	case "darwin":
+		platformOS, requiredArch, library = "darwin", "arm64", "libchroma_shim.dylib"
+	case "windows":
+		platformOS, requiredArch, library = "windows", "amd64", "chroma_shim.dll"
+	default:
+		return ReleaseAsset{}, errors.Errorf("unsupported OS for local runtime download: %s", goos)
+	}
+	if goarch != requiredArch {
+		return ReleaseAsset{}, errors.Errorf("unsupported architecture for %s local runtime download: %s", goos, goarch)
+	}
+	platform := platformOS + "-" + goarch
+	return ReleaseAsset{
+		Platform:     platform,
+		ArchiveNames: LocalShimArchiveNames(version, platform),
+		Library:      library,
+	}, nil
+}
+
+// LocalShimArchiveNames returns the archive names a local shim release may use
+// for a platform; releases were renamed from chroma-go-local to local-chroma.
+func LocalShimArchiveNames(version, platform string) []string {
+	return []string{
+		fmt.Sprintf("chroma-go-local-%s-%s.tar.gz", version, platform),
+		fmt.Sprintf("local-chroma-%s-%s.tar.gz", version, platform),
+	}
+}
+
+// TokenizersAsset returns the libtokenizers release archive for a platform.
+// musl selects the musl build on Linux.
+func TokenizersAsset(goos, goarch string, musl bool) (ReleaseAsset, error) {
+	var arch string
+	switch goarch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = "aarch64"
+	default:
+		return ReleaseAsset{}, errors.Errorf("unsupported architecture for tokenizers download: %s", goarch)
+	}
+
+	var targetTriple, platform, library string
+	switch goos {
+	case "darwin":
+		targetTriple, platform, library = "apple-darwin", "darwin-"+goarch, "libtokenizers.dylib"
+	case "linux":
+		targetTriple, platform, library = "unknown-linux-gnu", "linux-"+goarch, "libtokenizers.so"
+		if musl {
+			targetTriple, platform = "unknown-linux-musl", "linux-"+goarch+"-musl"
+		}
+	case "windows":
+		targetTriple, platform, library = "pc-windows-msvc", "windows-"+goarch, "tokenizers.dll"
+	default:
+		return ReleaseAsset{}, errors.Errorf("unsupported OS for tokenizers download: %s", goos)
+	}
+	return ReleaseAsset{
+		Platform:     platform,
+		ArchiveNames: []string{fmt.Sprintf("libtokenizers-%s-%s.tar.gz", arch, targetTriple)},
+		Library:      library,
+	}, nil
+}
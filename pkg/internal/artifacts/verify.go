@@ -0,0 +1,256 @@
+package artifacts
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/cosignutil"
+)
+
+// Names of the checksum files published with signed releases.
+const (
+	ChecksumsAsset            = "SHA256SUMS"
+	ChecksumsSignatureAsset   = "SHA256SUMS.sig"
+	ChecksumsCertificateAsset = "SHA256SUMS.pem"
+	ChecksumsBundleAsset      = "SHA256SUMS.sigstore.json"
+)
+
+// Signer is the keyless cosign signer trusted for a release: the certificate
+// identity (a GitHub workflow ref) and its OIDC issuer. Any of the identities
+// is accepted.
+type Signer struct {
+	Identities []string
+	OIDCIssuer string
+}
+
+// FetchSignedChecksums downloads SHA256SUMS from releaseURL into dir and
+// verifies its signature, published either as SHA256SUMS.sig with the
+// certificate SHA256SUMS.pem or as a sigstore bundle. It returns the path of
+// the verified checksums file.
+func (m *Manager) FetchSignedChecksums(ctx context.Context, releaseURL, dir string, signer Signer) (string, error) {
+	if err := validateSigner(signer); err != nil {
+		return "", err
+	}
+	releaseURL = strings.TrimRight(releaseURL, "/")
+	checksumsPath := filepath.Join(dir, ChecksumsAsset)
+	if err := m.downloadMetadata(ctx, checksumsPath, releaseURL+"/"+ChecksumsAsset); err != nil {
+		return "", errors.Wrap(err, "failed to download checksums")
+	}
+
+	legacyErr := m.downloadLegacySignature(ctx, releaseURL, dir)
+	if legacyErr == nil {
+		legacyErr = m.verifyLegacySignature(dir, signer)
+	}
+	if legacyErr == nil {
+		return checksumsPath, nil
+	}
+	bundleErr := m.downloadMetadata(ctx, filepath.Join(dir, ChecksumsBundleAsset), releaseURL+"/"+ChecksumsBundleAsset)
+	if bundleErr != nil {
+		bundleErr = errors.Wrap(bundleErr, "failed to download sigstore bundle")
+	} else {
+		bundleErr = m.verifyBundleSignature(dir, signer)
+	}
+	if bundleErr == nil {
+		return checksumsPath, nil
+	}
+	return "", errors.Wrap(stderrors.Join(
+		errors.Wrap(legacyErr, "legacy checksum signature metadata failed"),
+		errors.Wrap(bundleErr, "sigstore bundle metadata failed"),
+	), "failed to verify checksums signature")
+}
+
+// VerifySignedChecksums verifies the signature of a SHA256SUMS previously
+// fetched into dir with [Manager.FetchSignedChecksums], without network access.
+func (m *Manager) VerifySignedChecksums(dir string, signer Signer) error {
+	if err := validateSigner(signer); err != nil {
+		return err
+	}
+	legacyErr := m.verifyLegacySignature(dir, signer)
+	if legacyErr == nil {
+		return nil
+	}
+	bundleErr := m.verifyBundleSignature(dir, signer)
+	if bundleErr == nil {
+		return nil
+	}
+	return errors.Wrap(stderrors.Join(legacyErr, bundleErr), "failed to verify checksums signature")
+}
+
+func validateSigner(signer Signer) error {
+	if len(signer.Identities) == 0 || strings.TrimSpace(signer.OIDCIssuer) == "" {
+		return errors.New("signer identity and OIDC issuer are required")
+	}
+	return nil
+}
+
+func (m *Manager) downloadLegacySignature(ctx context.Context, releaseURL, dir string) error {
+	assets := []string{ChecksumsSignatureAsset, ChecksumsCertificateAsset}
+	errs := make([]error, len(assets))
+	var wg sync.WaitGroup
+	for i, asset := range assets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.downloadMetadata(ctx, filepath.Join(dir, asset), releaseURL+"/"+asset); err != nil {
+				errs[i] = errors.Wrapf(err, "failed to download %s", asset)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Wrap(joinErrors(errs), "failed to download legacy checksum metadata")
+}
+
+func (m *Manager) verifyLegacySignature(dir string, signer Signer) error {
+	return errors.Wrap(verifyWithAnyIdentity(signer, func(identity string) error {
+		return cosignutil.VerifySignedChecksums(
+			filepath.Join(dir, ChecksumsAsset),
+			filepath.Join(dir, ChecksumsSignatureAsset),
+			filepath.Join(dir, ChecksumsCertificateAsset),
+			identity, signer.OIDCIssuer, m.chainVerifier,
+		)
+	}), "failed to verify legacy checksum signature")
+}
+
+func (m *Manager) verifyBundleSignature(dir string, signer Signer) error {
+	return errors.Wrap(verifyWithAnyIdentity(signer, func(identity string) error {
+		return cosignutil.VerifySignedChecksumsBundle(
+			filepath.Join(dir, ChecksumsAsset),
+			filepath.Join(dir, ChecksumsBundleAsset),
+			identity, signer.OIDCIssuer, m.chainVerifier,
+		)
+	}), "failed to verify sigstore bundle")
+}
+
+func verifyWithAnyIdentity(signer Signer, verify func(identity string) error) error {
+	var errs []error
+	for _, identity := range signer.Identities {
+		err := verify(identity)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, errors.Wrapf(err, "certificate identity %s", identity))
+	}
+	return stderrors.Join(errs...)
+}
+
+// ChecksumFromSums returns the first of assetNames listed in the checksums file
+// sumsPath, and its checksum. Entries are matched in file order.
+func ChecksumFromSums(sumsPath string, assetNames ...string) (string, string, error) {
+	candidates := make(map[string]string, len(assetNames))
+	candidateList := make([]string, 0, len(assetNames))
+	for _, assetName := range assetNames {
+		original := strings.TrimSpace(assetName)
+		normalized := normalizedChecksumAssetName(original)
+		if normalized == "" {
+			continue
+		}
+		if _, ok := candidates[normalized]; ok {
+			continue
+		}
+		candidates[normalized] = original
+		candidateList = append(candidateList, original)
+	}
+	if len(candidates) == 0 {
+		return "", "", errors.New("asset names cannot be empty")
+	}
+
+	f, err := os.Open(sumsPath)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to open checksum file")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.TrimRight(scanner.Text(), "\r"))
+		if len(fields) < 2 {
+			continue
+		}
+		checksumAssetName := normalizedChecksumAssetName(fields[1])
+		if checksumAssetName == "" {
+			continue
+		}
+		if originalAssetName, ok := candidates[checksumAssetName]; ok {
+			checksum := strings.ToLower(fields[0])
+			if !LooksLikeSHA256(checksum) {
+				return "", "", errors.Errorf("invalid checksum format for asset %s: %q", originalAssetName, fields[0])
+			}
+			return originalAssetName, checksum, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", errors.Wrap(err, "failed to read checksum file")
+	}
+	return "", "", errors.Errorf("checksum entry not found for assets [%s]", strings.Join(candidateList, ", "))
+}
+
+func normalizedChecksumAssetName(assetName string) string {
+	normalized := strings.TrimPrefix(strings.TrimSpace(assetName), "*")
+	normalized = strings.ReplaceAll(normalized, "\\", "/")
+	normalized = path.Base(normalized)
+	if normalized == "." || normalized == "/" || normalized == ".." {
+		return ""
+	}
+	return strings.TrimSpace(normalized)
+}
+
+// LooksLikeSHA256 reports whether v is a hex encoded SHA-256 digest.
+func LooksLikeSHA256(v string) bool {
+	if len(v) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(v)
+	return err == nil
+}
+
+// FileSHA256 returns the hex encoded SHA-256 digest of a file.
+func FileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open file for checksum verification")
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", errors.Wrap(err, "failed to hash downloaded file")
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// VerifyFile checks the SHA-256 digest of a file.
+func VerifyFile(filePath, expectedChecksum string) error {
+	expectedChecksum = strings.TrimSpace(strings.ToLower(expectedChecksum))
+	if expectedChecksum == "" {
+		return errors.New("expected checksum cannot be empty")
+	}
+	actualChecksum, err := FileSHA256(filePath)
+	if err != nil {
+		return err
+	}
+	if actualChecksum != expectedChecksum {
+		return errors.Errorf("checksum mismatch for %s: expected %s, got %s", filePath, expectedChecksum, actualChecksum)
+	}
+	return nil
+}
+
+func joinErrors(errs []error) error {
+	nonNil := errs[:0:0]
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+	return stderrors.Join(nonNil...)
+}
@@ -1,6 +1,7 @@
 package downloadutil
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -39,12 +40,30 @@ type Config struct {
 	Accept string
 	// UserAgent sets the User-Agent request header when non-empty.
 	UserAgent string
+	// Resume keeps the data of an interrupted download in <filePath>.partial and
+	// continues from it with a range request on the next attempt or call.
+	Resume bool
+	// Progress is called while the file is written with the number of bytes
+	// downloaded so far and the total size, or -1 when the size is unknown.
+	Progress ProgressFunc
 }
 
+// ProgressFunc receives download progress, see [Config.Progress].
+type ProgressFunc func(downloaded, total int64)
+
+// PartialSuffix is appended to the destination path of resumable downloads.
+const PartialSuffix = ".partial"
+
 var newHTTPClientFunc = newHTTPClient
 
 // DownloadFileWithRetry downloads a file with linear retry backoff.
 func DownloadFileWithRetry(filePath, sourceURL string, attempts int, cfg Config) error {
+	return DownloadFileWithRetryContext(context.Background(), filePath, sourceURL, attempts, cfg)
+}
+
+// DownloadFileWithRetryContext is [DownloadFileWithRetry] with a context that
+// cancels the request and the wait between attempts.
+func DownloadFileWithRetryContext(ctx context.Context, filePath, sourceURL string, attempts int, cfg Config) error {
 	cfg = withDefaults(cfg)
 	if cfg.MaxBytes <= 0 {
 		return errors.New("max download bytes must be greater than zero")
@@ -62,10 +81,16 @@ func DownloadFileWithRetry(filePath, sourceURL string, attempts int, cfg Config)
 
 	var lastErr error
 	for attempt := 1; attempt <= attempts; attempt++ {
-		if err := downloadFileWithClient(filePath, parsedURL, cfg, client); err != nil {
+		if err := downloadFileWithClientContext(ctx, filePath, parsedURL, cfg, client); err != nil {
 			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
 			if attempt < attempts {
-				time.Sleep(time.Duration(attempt) * time.Second)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Duration(attempt) * time.Second):
+				}
 			}
 			continue
 		}
@@ -83,15 +108,16 @@ func DownloadFile(filePath, sourceURL string, cfg Config) error {
 }
 
 func downloadFileWithClient(filePath string, parsedURL *url.URL, cfg Config, client *http.Client) error {
-	req, err := http.NewRequest(http.MethodGet, parsedURL.String(), nil)
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-	if cfg.Accept != "" {
-		req.Header.Set("Accept", cfg.Accept)
+	return downloadFileWithClientContext(context.Background(), filePath, parsedURL, cfg, client)
+}
+
+func downloadFileWithClientContext(ctx context.Context, filePath string, parsedURL *url.URL, cfg Config, client *http.Client) error {
+	if cfg.Resume {
+		return resumeFileWithClient(ctx, filePath, parsedURL, cfg, client)
 	}
-	if cfg.UserAgent != "" {
-		req.Header.Set("User-Agent", cfg.UserAgent)
+	req, err := newRequest(ctx, parsedURL, cfg)
+	if err != nil {
+		return err
 	}
 
 	resp, err := client.Do(req)
@@ -122,7 +148,7 @@ func downloadFileWithClient(filePath string, parsedURL *url.URL, cfg Config, cli
 	tempPath := out.Name()
 
 	limitedBody := io.LimitReader(resp.Body, cfg.MaxBytes+1)
-	written, copyErr := io.Copy(out, limitedBody)
+	written, copyErr := io.Copy(newProgressWriter(out, 0, resp.ContentLength, cfg.Progress), limitedBody)
 	closeErr := out.Close()
 	if copyErr != nil {
 		_ = os.Remove(tempPath)
@@ -153,6 +179,149 @@ func downloadFileWithClient(filePath string, parsedURL *url.URL, cfg Config, cli
 	return nil
 }
 
+// resumeFileWithClient downloads into <filePath>.partial, asking the server only
+// for the bytes that are missing. The partial file is kept when the transfer
+// fails and moved to filePath once it is complete.
+func resumeFileWithClient(ctx context.Context, filePath string, parsedURL *url.URL, cfg Config, client *http.Client) error {
+	partialPath := filePath + PartialSuffix
+	var offset int64
+	if info, err := os.Stat(partialPath); err == nil && info.Mode().IsRegular() {
+		offset = info.Size()
+	}
+	if offset > cfg.MaxBytes {
+		_ = os.Remove(partialPath)
+		offset = 0
+	}
+
+	req, err := newRequest(ctx, parsedURL, cfg)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			_ = os.Remove(partialPath)
+			return fmt.Errorf("unexpected content range %q for URL %s", resp.Header.Get("Content-Range"), parsedURL.Redacted())
+		}
+	case resp.StatusCode == http.StatusOK:
+		// the server ignored the range request, start over
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		_ = os.Remove(partialPath)
+		return fmt.Errorf("partial download of %s is no longer valid", parsedURL.Redacted())
+	default:
+		return fmt.Errorf("unexpected response %s for URL %s", resp.Status, parsedURL.Redacted())
+	}
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	if total > cfg.MaxBytes {
+		return fmt.Errorf(
+			"downloaded artifact is too large: %d bytes exceeds max %d bytes",
+			total,
+			cfg.MaxBytes,
+		)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), cfg.DirPerm); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	out, err := os.OpenFile(partialPath, flags, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open partial download: %w", err)
+	}
+	limitedBody := io.LimitReader(resp.Body, cfg.MaxBytes-offset+1)
+	written, copyErr := io.Copy(newProgressWriter(out, offset, total, cfg.Progress), limitedBody)
+	closeErr := out.Close()
+	size := offset + written
+	if size > cfg.MaxBytes {
+		_ = os.Remove(partialPath)
+		return fmt.Errorf(
+			"downloaded artifact exceeds max allowed size: got %d bytes, max %d bytes",
+			size,
+			cfg.MaxBytes,
+		)
+	}
+	if copyErr != nil {
+		return fmt.Errorf("failed to copy HTTP response: %w", copyErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close partial download: %w", closeErr)
+	}
+	if total >= 0 && size != total {
+		return fmt.Errorf("download incomplete: expected %d bytes, got %d bytes", total, size)
+	}
+
+	_ = os.Remove(filePath)
+	if err := os.Rename(partialPath, filePath); err != nil {
+		return fmt.Errorf("failed to finalize downloaded file: %w", err)
+	}
+	return nil
+}
+
+func newRequest(ctx context.Context, parsedURL *url.URL, cfg Config) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsedURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	if cfg.Accept != "" {
+		req.Header.Set("Accept", cfg.Accept)
+	}
+	if cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", cfg.UserAgent)
+	}
+	return req, nil
+}
+
+// contentRangeStart returns the first byte position of a "bytes start-end/size" header.
+func contentRangeStart(header string) (int64, error) {
+	var start, end int64
+	var size string
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return 0, fmt.Errorf("invalid content range %q: %w", header, err)
+	}
+	return start, nil
+}
+
+type progressWriter struct {
+	w          io.Writer
+	downloaded int64
+	total      int64
+	progress   ProgressFunc
+}
+
+func newProgressWriter(w io.Writer, offset, total int64, progress ProgressFunc) io.Writer {
+	if progress == nil {
+		return w
+	}
+	if total <= 0 {
+		total = -1
+	}
+	return &progressWriter{w: w, downloaded: offset, total: total, progress: progress}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.downloaded += int64(n)
+	p.progress(p.downloaded, p.total)
+	return n, err
+}
+
 // RejectHTTPSDowngradeRedirect blocks HTTPS->HTTP redirects and too many redirect hops.
 func RejectHTTPSDowngradeRedirect(req *http.Request, via []*http.Request) error {
 	if len(via) >= defaultMaxRedirects {
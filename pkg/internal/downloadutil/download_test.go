@@ -10,6 +10,7 @@ import (
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -148,3 +149,72 @@ type roundTripFunc func(*http.Request) (*http.Response, error)
 func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 	return f(req)
 }
+
+func TestDownloadFile_ResumesPartialDownload(t *testing.T) {
+	payload := "0123456789abcdefghij"
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "artifact.bin", time.Time{}, strings.NewReader(payload))
+	}))
+	defer server.Close()
+
+	targetPath := filepath.Join(t.TempDir(), "artifact.bin")
+	require.NoError(t, os.WriteFile(targetPath+PartialSuffix, []byte(payload[:8]), 0600))
+	var progress [][2]int64
+	err := DownloadFile(targetPath, server.URL, Config{
+		MaxBytes:  1024,
+		AllowHTTP: true,
+		Resume:    true,
+		Progress: func(downloaded, total int64) {
+			progress = append(progress, [2]int64{downloaded, total})
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"bytes=8-"}, ranges)
+	data, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	require.Equal(t, payload, string(data))
+	require.Equal(t, [2]int64{20, 20}, progress[len(progress)-1])
+	_, err = os.Stat(targetPath + PartialSuffix)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadFile_ResumeKeepsPartialOnFailure(t *testing.T) {
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Status:        "200 OK",
+				Header:        make(http.Header),
+				Body:          io.NopCloser(strings.NewReader("abc")),
+				ContentLength: 10,
+				Request:       req,
+			}, nil
+		}),
+	}
+	targetPath := filepath.Join(t.TempDir(), "artifact.bin")
+	parsedURL, err := url.Parse("https://example.com/artifact.bin")
+	require.NoError(t, err)
+
+	err = downloadFileWithClient(targetPath, parsedURL, withDefaults(Config{MaxBytes: 1024, Resume: true}), client)
+	require.ErrorContains(t, err, "download incomplete")
+	data, err := os.ReadFile(targetPath + PartialSuffix)
+	require.NoError(t, err)
+	require.Equal(t, "abc", string(data))
+}
+
+func TestDownloadFile_ResumeRestartsWhenRangeIsIgnored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("payload"))
+	}))
+	defer server.Close()
+
+	targetPath := filepath.Join(t.TempDir(), "artifact.bin")
+	require.NoError(t, os.WriteFile(targetPath+PartialSuffix, []byte("stale"), 0600))
+	err := DownloadFile(targetPath, server.URL, Config{MaxBytes: 1024, AllowHTTP: true, Resume: true})
+	require.NoError(t, err)
+	data, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	require.Equal(t, "payload", string(data))
+}
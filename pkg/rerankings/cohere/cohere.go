@@ -55,12 +55,13 @@ type CohereRerankingFunction struct {
 	RerankEndpoint  string
 }
 
-var _ rerankings.RerankingFunction = &CohereRerankingFunction{}
+var _ rerankings.ConfigurableRerankingFunction = &CohereRerankingFunction{}
 
 func NewCohereRerankingFunction(opts ...Option) (*CohereRerankingFunction, error) {
 	rf := &CohereRerankingFunction{}
 	ccOpts := make([]ccommons.Option, 0)
-	opts = append(opts, WithDefaultModel(DefaultModel))
+	// the default model goes first so that a caller-provided model takes precedence
+	opts = append([]Option{WithDefaultModel(DefaultModel)}, opts...)
 	// stagger the options to pass to the cohere client
 	for _, opt := range opts {
 		ccOpts = append(ccOpts, opt(rf))
@@ -221,3 +222,75 @@ func (c CohereRerankingFunction) RerankResults(ctx context.Context, queryTexts [
 	}
 	return rerankedResults, nil
 }
+
+// Name returns the registry name of the reranking function.
+func (c CohereRerankingFunction) Name() string {
+	return "cohere"
+}
+
+// GetConfig returns the persistable configuration of the reranking function.
+// The API key is referenced by its environment variable name.
+func (c CohereRerankingFunction) GetConfig() rerankings.RerankingFunctionConfig {
+	envVar := c.APIKeyEnvVar
+	if envVar == "" {
+		envVar = ccommons.APIKeyEnv
+	}
+	cfg := rerankings.RerankingFunctionConfig{
+		"model_name":      string(c.DefaultModel),
+		"api_key_env_var": envVar,
+	}
+	if c.BaseURL != "" && c.BaseURL != ccommons.DefaultBaseURL {
+		cfg["base_url"] = c.BaseURL
+	}
+	if c.TopN > 0 {
+		cfg["top_n"] = c.TopN
+	}
+	if len(c.RerankFields) > 0 {
+		cfg["rerank_fields"] = c.RerankFields
+	}
+	if c.ReturnDocuments {
+		cfg["return_documents"] = true
+	}
+	if c.MaxChunksPerDoc > 0 {
+		cfg["max_chunks_per_doc"] = c.MaxChunksPerDoc
+	}
+	return cfg
+}
+
+// NewCohereRerankingFunctionFromConfig creates a Cohere reranking function from a config map.
+// Supported fields: api_key_env_var, model_name, base_url, top_n, rerank_fields,
+// return_documents, max_chunks_per_doc.
+func NewCohereRerankingFunctionFromConfig(cfg rerankings.RerankingFunctionConfig) (*CohereRerankingFunction, error) {
+	envVar, ok := rerankings.ConfigString(cfg, "api_key_env_var")
+	if !ok {
+		envVar = ccommons.APIKeyEnv
+	}
+	opts := []Option{WithAPIKeyFromEnvVar(envVar)}
+	if model, ok := rerankings.ConfigString(cfg, "model_name"); ok {
+		opts = append(opts, WithDefaultModel(rerankings.RerankingModel(model)))
+	}
+	if baseURL, ok := rerankings.ConfigString(cfg, "base_url"); ok {
+		opts = append(opts, WithBaseURL(baseURL))
+	}
+	if topN, ok := rerankings.ConfigInt(cfg, "top_n"); ok {
+		opts = append(opts, WithTopN(topN))
+	}
+	if fields, ok := rerankings.ConfigStrings(cfg, "rerank_fields"); ok {
+		opts = append(opts, WithRerankFields(fields))
+	}
+	if returnDocuments, ok := rerankings.ConfigBool(cfg, "return_documents"); ok && returnDocuments {
+		opts = append(opts, WithReturnDocuments())
+	}
+	if maxChunks, ok := rerankings.ConfigInt(cfg, "max_chunks_per_doc"); ok {
+		opts = append(opts, WithMaxChunksPerDoc(maxChunks))
+	}
+	return NewCohereRerankingFunction(opts...)
+}
+
+func init() {
+	if err := rerankings.RegisterReranker("cohere", func(cfg rerankings.RerankingFunctionConfig) (rerankings.RerankingFunction, error) {
+		return NewCohereRerankingFunctionFromConfig(cfg)
+	}); err != nil {
+		panic(err)
+	}
+}
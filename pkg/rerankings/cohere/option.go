@@ -70,3 +70,10 @@ func WithRetryStrategy(retryStrategy httpc.RetryStrategy) Option {
 		return ccommons.WithRetryStrategy(retryStrategy)
 	}
 }
+
+// WithAPIKeyFromEnvVar configures the client to read the API key from the specified environment variable
+func WithAPIKeyFromEnvVar(envVar string) Option {
+	return func(p *CohereRerankingFunction) ccommons.Option {
+		return ccommons.WithAPIKeyFromEnvVar(envVar)
+	}
+}
@@ -0,0 +1,443 @@
+// Package crossencoder provides an offline reranking function that scores
+// (query, document) pairs with a cross-encoder ONNX model such as
+// cross-encoder/ms-marco-MiniLM-L-6-v2 or BAAI/bge-reranker-base.
+//
+// The model runs in-process on the same ONNX Runtime as the default embedding
+// function; the runtime library and model files are downloaded to
+// ~/.cache/chroma on first use.
+package crossencoder
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	ort "github.com/amikos-tech/pure-onnx/ort"
+	"github.com/pkg/errors"
+
+	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
+	defaultef "github.com/amikos-tech/chroma-go/pkg/embeddings/default_ef" //nolint:staticcheck
+	"github.com/amikos-tech/chroma-go/pkg/rerankings"
+)
+
+const (
+	DefaultModel      rerankings.RerankingModel = "cross-encoder/ms-marco-MiniLM-L-6-v2"
+	DefaultMaxLength                            = 512
+	DefaultBatchSize                            = 32
+	DefaultOutputName                           = "logits"
+	// DefaultModelBaseURL is the base URL models are downloaded from; files are
+	// fetched from <base>/<model>/resolve/<revision>/{onnx/model.onnx,tokenizer.json}.
+	DefaultModelBaseURL = "https://huggingface.co"
+	// DefaultModelRevision is the revision downloaded unless WithModelRevision pins one.
+	DefaultModelRevision = "main"
+
+	modelFileName     = "model.onnx"
+	tokenizerFileName = "tokenizer.json"
+)
+
+// Normalization selects how model logits are turned into relevance scores.
+type Normalization string
+
+const (
+	// NormalizationAuto applies sigmoid to single-logit models and softmax to
+	// multi-label models.
+	NormalizationAuto Normalization = "auto"
+	// NormalizationSigmoid maps the relevance logit to (0, 1).
+	NormalizationSigmoid Normalization = "sigmoid"
+	// NormalizationSoftmax returns the probability of the last (relevant) label.
+	NormalizationSoftmax Normalization = "softmax"
+	// NormalizationNone returns the raw relevance logit.
+	NormalizationNone Normalization = "none"
+)
+
+var _ rerankings.ConfigurableRerankingFunction = (*CrossEncoderRerankingFunction)(nil)
+
+// CrossEncoderRerankingFunction reranks documents locally with a cross-encoder
+// ONNX model. It holds native resources; call Close when done.
+type CrossEncoderRerankingFunction struct {
+	model           rerankings.RerankingModel
+	modelBaseURL    string
+	modelRevision   string
+	modelChecksums  map[string]string
+	modelPath       string
+	tokenizerPath   string
+	maxLength       int
+	batchSize       int
+	numLabels       int
+	outputName      string
+	useTokenTypeIDs bool
+	normalization   Normalization
+	topN            *int
+
+	mu                 sync.Mutex
+	scorer             pairScorer
+	destroyEnvironment func() error
+	closed             bool
+}
+
+type crossEncoderDeps struct {
+	ensureOnnxRuntimeSharedLibrary     func() error
+	ensureModelFiles                   func(dir string, files, checksums map[string]string) error
+	initializeEnvironmentWithBootstrap func(...ort.BootstrapOption) error
+	destroyEnvironment                 func() error
+	newScorer                          func(cfg scorerConfig) (pairScorer, error)
+}
+
+func realCrossEncoderDeps() crossEncoderDeps {
+	return crossEncoderDeps{
+		ensureOnnxRuntimeSharedLibrary:     defaultef.EnsureOnnxRuntimeSharedLibrary,
+		ensureModelFiles:                   defaultef.EnsureModelFiles,
+		initializeEnvironmentWithBootstrap: ort.InitializeEnvironmentWithBootstrap,
+		destroyEnvironment:                 ort.DestroyEnvironment,
+		newScorer:                          newONNXScorer,
+	}
+}
+
+func getDefaults() *CrossEncoderRerankingFunction {
+	return &CrossEncoderRerankingFunction{
+		model:           DefaultModel,
+		modelBaseURL:    DefaultModelBaseURL,
+		modelRevision:   DefaultModelRevision,
+		maxLength:       DefaultMaxLength,
+		batchSize:       DefaultBatchSize,
+		numLabels:       1,
+		outputName:      DefaultOutputName,
+		useTokenTypeIDs: true,
+		normalization:   NormalizationAuto,
+	}
+}
+
+// NewCrossEncoderRerankingFunction creates a cross-encoder reranking function.
+// Unless local files are set with WithModelPath, the model and its tokenizer are
+// downloaded to ~/.cache/chroma/onnx_models/<model> on first use.
+func NewCrossEncoderRerankingFunction(opts ...Option) (*CrossEncoderRerankingFunction, error) {
+	return newCrossEncoderRerankingFunctionWithDeps(realCrossEncoderDeps(), opts...)
+}
+
+func newCrossEncoderRerankingFunctionWithDeps(deps crossEncoderDeps, opts ...Option) (*CrossEncoderRerankingFunction, error) {
+	rf := getDefaults()
+	for _, opt := range opts {
+		if err := opt(rf); err != nil {
+			return nil, err
+		}
+	}
+	if err := rf.validate(); err != nil {
+		return nil, err
+	}
+
+	modelPath, tokenizerPath := rf.modelPath, rf.tokenizerPath
+	if modelPath == "" {
+		dir := defaultef.ModelCacheDir(string(rf.model))
+		base := fmt.Sprintf("%s/%s/resolve/%s", rf.modelBaseURL, rf.model, url.PathEscape(rf.modelRevision))
+		if err := deps.ensureModelFiles(dir, map[string]string{
+			modelFileName:     base + "/onnx/" + modelFileName,
+			tokenizerFileName: base + "/" + tokenizerFileName,
+		}, rf.modelChecksums); err != nil {
+			return nil, errors.Wrapf(err, "failed to ensure cross-encoder model %s", rf.model)
+		}
+		modelPath = filepath.Join(dir, modelFileName)
+		tokenizerPath = filepath.Join(dir, tokenizerFileName)
+	}
+
+	if err := deps.ensureOnnxRuntimeSharedLibrary(); err != nil {
+		return nil, errors.Wrap(err, "failed to ensure onnx runtime shared library")
+	}
+	if err := deps.initializeEnvironmentWithBootstrap(defaultef.RuntimeBootstrapOptions()...); err != nil {
+		return nil, errors.Wrap(err, "failed to initialize onnx runtime environment")
+	}
+	scorer, err := deps.newScorer(scorerConfig{
+		modelPath:       modelPath,
+		tokenizerPath:   tokenizerPath,
+		maxLength:       rf.maxLength,
+		batchSize:       rf.batchSize,
+		numLabels:       rf.numLabels,
+		outputName:      rf.outputName,
+		useTokenTypeIDs: rf.useTokenTypeIDs,
+	})
+	if err != nil {
+		scorerErr := errors.Wrap(err, "failed to create cross-encoder")
+		if cleanupErr := deps.destroyEnvironment(); cleanupErr != nil {
+			return nil, stderrors.Join(scorerErr, errors.Wrap(cleanupErr, "failed to destroy onnx runtime environment after setup error"))
+		}
+		return nil, scorerErr
+	}
+	rf.scorer = scorer
+	rf.destroyEnvironment = deps.destroyEnvironment
+	return rf, nil
+}
+
+func (r *CrossEncoderRerankingFunction) validate() error {
+	if (r.modelPath == "") != (r.tokenizerPath == "") {
+		return errors.New("model path and tokenizer path must be set together")
+	}
+	if r.modelPath == "" && r.model == "" {
+		return errors.New("model cannot be empty")
+	}
+	switch r.normalization {
+	case NormalizationAuto, NormalizationSigmoid, NormalizationNone:
+	case NormalizationSoftmax:
+		if r.numLabels < 2 {
+			return errors.New("softmax normalization requires a model with at least 2 labels")
+		}
+	default:
+		return errors.Errorf("unsupported normalization %q", r.normalization)
+	}
+	return nil
+}
+
+// Score returns the normalized relevance score of each document for query, in input order.
+func (r *CrossEncoderRerankingFunction) Score(ctx context.Context, query string, documents []string) ([]float32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, errors.New("cross-encoder reranking function is closed")
+	}
+	scores := make([]float32, 0, len(documents))
+	for start := 0; start < len(documents); start += r.batchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := start + r.batchSize
+		if end > len(documents) {
+			end = len(documents)
+		}
+		queries := make([]string, end-start)
+		for i := range queries {
+			queries[i] = query
+		}
+		logits, err := r.scorer.Score(queries, documents[start:end])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to score documents %d-%d", start, end-1)
+		}
+		if len(logits) != len(queries)*r.numLabels {
+			return nil, errors.Errorf("unexpected logits size %d for %d pairs with %d labels", len(logits), len(queries), r.numLabels)
+		}
+		for i := range queries {
+			scores = append(scores, normalize(logits[i*r.numLabels:(i+1)*r.numLabels], r.normalization))
+		}
+	}
+	return scores, nil
+}
+
+// normalize converts the logits of one pair into a relevance score. The last
+// label is the relevant class for multi-label models.
+func normalize(logits []float32, mode Normalization) float32 {
+	last := float64(logits[len(logits)-1])
+	if mode == NormalizationAuto {
+		mode = NormalizationSigmoid
+		if len(logits) > 1 {
+			mode = NormalizationSoftmax
+		}
+	}
+	switch mode {
+	case NormalizationSigmoid:
+		return float32(1 / (1 + math.Exp(-last)))
+	case NormalizationSoftmax:
+		maxLogit := math.Inf(-1)
+		for _, l := range logits {
+			maxLogit = math.Max(maxLogit, float64(l))
+		}
+		var sum float64
+		for _, l := range logits {
+			sum += math.Exp(float64(l) - maxLogit)
+		}
+		return float32(math.Exp(last-maxLogit) / sum)
+	default:
+		return float32(last)
+	}
+}
+
+func (r *CrossEncoderRerankingFunction) Rerank(ctx context.Context, query string, results []rerankings.Result) (map[string][]rerankings.RankedResult, error) {
+	docs := make([]string, 0, len(results))
+	for _, result := range results {
+		d, err := result.ToText()
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+	}
+	scores, err := r.Score(ctx, query, docs)
+	if err != nil {
+		return nil, err
+	}
+	ranked := make([]rerankings.RankedResult, len(docs))
+	for i, doc := range docs {
+		ranked[i] = rerankings.RankedResult{Index: i, String: doc, Rank: scores[i]}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Rank > ranked[j].Rank })
+	if r.topN != nil && len(ranked) > *r.topN {
+		ranked = ranked[:*r.topN]
+	}
+	return map[string][]rerankings.RankedResult{r.ID(): ranked}, nil
+}
+
+// ID returns the ID of the reranking function. We use `onnx-` prefix with the model name
+func (r *CrossEncoderRerankingFunction) ID() string {
+	return fmt.Sprintf("onnx-%s", r.model)
+}
+
+func (r *CrossEncoderRerankingFunction) RerankResults(ctx context.Context, queryTexts []string, queryResults *chromago.QueryResultImpl) (*rerankings.RerankedChromaResults, error) {
+	if queryResults == nil {
+		return nil, errors.New("query results cannot be nil")
+	}
+	if len(queryTexts) != len(queryResults.IDLists) {
+		return nil, fmt.Errorf("queryTexts length (%d) does not match IDLists length (%d)", len(queryTexts), len(queryResults.IDLists))
+	}
+	if len(queryResults.DocumentsLists) != len(queryResults.IDLists) {
+		return nil, fmt.Errorf("DocumentsLists length (%d) does not match IDLists length (%d)", len(queryResults.DocumentsLists), len(queryResults.IDLists))
+	}
+	rerankedResults := &rerankings.RerankedChromaResults{
+		QueryResultImpl: queryResults,
+		QueryTexts:      queryTexts,
+		Ranks:           map[string][][]float32{r.ID(): make([][]float32, len(queryResults.IDLists))},
+	}
+	for i := range queryResults.IDLists {
+		docs := make([]string, 0, len(queryResults.DocumentsLists[i]))
+		for _, doc := range queryResults.DocumentsLists[i] {
+			docs = append(docs, doc.ContentString())
+		}
+		scores, err := r.Score(ctx, queryTexts[i], docs)
+		if err != nil {
+			return nil, err
+		}
+		rerankedResults.Ranks[r.ID()][i] = scores
+	}
+	return rerankedResults, nil
+}
+
+// Close releases the model session, the tokenizer and the reference held on
+// the ONNX Runtime environment. It is safe to call Close more than once.
+func (r *CrossEncoderRerankingFunction) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	var errs []error
+	if r.scorer != nil {
+		if err := r.scorer.Close(); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to close cross-encoder"))
+		}
+		r.scorer = nil
+	}
+	if r.destroyEnvironment != nil {
+		if err := r.destroyEnvironment(); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to destroy onnx runtime environment"))
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// Name returns the registry name of the reranking function.
+func (r *CrossEncoderRerankingFunction) Name() string {
+	return "onnx_cross_encoder"
+}
+
+// GetConfig returns the persistable configuration of the reranking function.
+func (r *CrossEncoderRerankingFunction) GetConfig() rerankings.RerankingFunctionConfig {
+	cfg := rerankings.RerankingFunctionConfig{
+		"max_length":    r.maxLength,
+		"batch_size":    r.batchSize,
+		"normalization": string(r.normalization),
+		"model_name":    string(r.model),
+	}
+	if r.modelPath != "" {
+		cfg["model_path"] = r.modelPath
+		cfg["tokenizer_path"] = r.tokenizerPath
+	} else {
+		if r.modelBaseURL != DefaultModelBaseURL {
+			cfg["base_url"] = r.modelBaseURL
+		}
+		if r.modelRevision != DefaultModelRevision {
+			cfg["revision"] = r.modelRevision
+		}
+		if r.modelChecksums != nil {
+			cfg["model_sha256"] = r.modelChecksums[modelFileName]
+			cfg["tokenizer_sha256"] = r.modelChecksums[tokenizerFileName]
+		}
+	}
+	if r.numLabels != 1 {
+		cfg["num_labels"] = r.numLabels
+	}
+	if r.outputName != DefaultOutputName {
+		cfg["output_name"] = r.outputName
+	}
+	if !r.useTokenTypeIDs {
+		cfg["token_type_ids"] = false
+	}
+	if r.topN != nil {
+		cfg["top_n"] = *r.topN
+	}
+	return cfg
+}
+
+// NewCrossEncoderRerankingFunctionFromConfig creates a cross-encoder reranking function from a config map.
+// Supported fields: model_name, base_url, revision, model_sha256, tokenizer_sha256, model_path,
+// tokenizer_path, max_length, batch_size, num_labels, output_name, token_type_ids, normalization, top_n.
+// The caller owns cleanup via Close().
+func NewCrossEncoderRerankingFunctionFromConfig(cfg rerankings.RerankingFunctionConfig) (*CrossEncoderRerankingFunction, error) {
+	opts, err := optionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewCrossEncoderRerankingFunction(opts...)
+}
+
+func optionsFromConfig(cfg rerankings.RerankingFunctionConfig) ([]Option, error) {
+	var opts []Option
+	if model, ok := rerankings.ConfigString(cfg, "model_name"); ok {
+		opts = append(opts, WithModel(rerankings.RerankingModel(model)))
+	}
+	if baseURL, ok := rerankings.ConfigString(cfg, "base_url"); ok {
+		opts = append(opts, WithModelBaseURL(baseURL))
+	}
+	if revision, ok := rerankings.ConfigString(cfg, "revision"); ok {
+		opts = append(opts, WithModelRevision(revision))
+	}
+	modelSHA256, hasModelSHA256 := rerankings.ConfigString(cfg, "model_sha256")
+	tokenizerSHA256, hasTokenizerSHA256 := rerankings.ConfigString(cfg, "tokenizer_sha256")
+	if hasModelSHA256 || hasTokenizerSHA256 {
+		opts = append(opts, WithModelChecksums(modelSHA256, tokenizerSHA256))
+	}
+	modelPath, hasModel := rerankings.ConfigString(cfg, "model_path")
+	tokenizerPath, hasTokenizer := rerankings.ConfigString(cfg, "tokenizer_path")
+	if hasModel || hasTokenizer {
+		opts = append(opts, WithModelPath(modelPath, tokenizerPath))
+	}
+	if maxLength, ok := rerankings.ConfigInt(cfg, "max_length"); ok {
+		opts = append(opts, WithMaxLength(maxLength))
+	}
+	if batchSize, ok := rerankings.ConfigInt(cfg, "batch_size"); ok {
+		opts = append(opts, WithBatchSize(batchSize))
+	}
+	if numLabels, ok := rerankings.ConfigInt(cfg, "num_labels"); ok {
+		opts = append(opts, WithNumLabels(numLabels))
+	}
+	if outputName, ok := rerankings.ConfigString(cfg, "output_name"); ok {
+		opts = append(opts, WithOutputName(outputName))
+	}
+	if useTokenTypeIDs, ok := rerankings.ConfigBool(cfg, "token_type_ids"); ok && !useTokenTypeIDs {
+		opts = append(opts, WithoutTokenTypeIDs())
+	}
+	if normalization, ok := rerankings.ConfigString(cfg, "normalization"); ok {
+		opts = append(opts, WithNormalization(Normalization(normalization)))
+	}
+	if topN, ok := rerankings.ConfigInt(cfg, "top_n"); ok {
+		opts = append(opts, WithTopN(topN))
+	}
+	return opts, nil
+}
+
+func init() {
+	if err := rerankings.RegisterReranker("onnx_cross_encoder", func(cfg rerankings.RerankingFunctionConfig) (rerankings.RerankingFunction, error) {
+		return NewCrossEncoderRerankingFunctionFromConfig(cfg)
+	}); err != nil {
+		panic(err)
+	}
+}
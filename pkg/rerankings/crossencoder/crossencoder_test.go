@@ -0,0 +1,264 @@
+//go:build rf
+
+package crossencoder
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	ort "github.com/amikos-tech/pure-onnx/ort"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
+	"github.com/amikos-tech/chroma-go/pkg/rerankings"
+)
+
+// fakeScorer returns the number of query words found in the document as the
+// last logit and records the size of every batch.
+type fakeScorer struct {
+	numLabels int
+	batches   []int
+	closed    bool
+}
+
+func (f *fakeScorer) Score(queries, documents []string) ([]float32, error) {
+	f.batches = append(f.batches, len(queries))
+	out := make([]float32, 0, len(queries)*f.numLabels)
+	for i, q := range queries {
+		var hits float32
+		for _, w := range strings.Fields(q) {
+			if strings.Contains(documents[i], w) {
+				hits++
+			}
+		}
+		for l := 0; l < f.numLabels-1; l++ {
+			out = append(out, 0)
+		}
+		out = append(out, hits)
+	}
+	return out, nil
+}
+
+func (f *fakeScorer) Close() error {
+	f.closed = true
+	return nil
+}
+
+type fakeEnv struct {
+	refs      int
+	modelDir  string
+	files     map[string]string
+	checksums map[string]string
+	scorerCfg scorerConfig
+	scorer    *fakeScorer
+}
+
+func (e *fakeEnv) deps() crossEncoderDeps {
+	return crossEncoderDeps{
+		ensureOnnxRuntimeSharedLibrary: func() error { return nil },
+		ensureModelFiles: func(dir string, files, checksums map[string]string) error {
+			e.modelDir, e.files, e.checksums = dir, files, checksums
+			return nil
+		},
+		initializeEnvironmentWithBootstrap: func(...ort.BootstrapOption) error {
+			e.refs++
+			return nil
+		},
+		destroyEnvironment: func() error {
+			e.refs--
+			return nil
+		},
+		newScorer: func(cfg scorerConfig) (pairScorer, error) {
+			e.scorerCfg = cfg
+			e.scorer = &fakeScorer{numLabels: cfg.numLabels}
+			return e.scorer, nil
+		},
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	require.InDelta(t, 0.5, normalize([]float32{0}, NormalizationAuto), 1e-6)
+	require.InDelta(t, 1/(1+math.Exp(-2)), normalize([]float32{2}, NormalizationSigmoid), 1e-6)
+	require.InDelta(t, math.Exp(3)/(math.Exp(1)+math.Exp(3)), normalize([]float32{1, 3}, NormalizationAuto), 1e-6)
+	require.InDelta(t, math.Exp(3)/(math.Exp(1)+math.Exp(3)), normalize([]float32{1, 3}, NormalizationSoftmax), 1e-6)
+	require.InDelta(t, 1/(1+math.Exp(-3)), normalize([]float32{1, 3}, NormalizationSigmoid), 1e-6)
+	require.Equal(t, float32(-4), normalize([]float32{-4}, NormalizationNone))
+	// large logits must not overflow
+	require.InDelta(t, 1, normalize([]float32{0, 1000}, NormalizationSoftmax), 1e-6)
+}
+
+func TestCrossEncoderRerank(t *testing.T) {
+	env := &fakeEnv{}
+	rf, err := newCrossEncoderRerankingFunctionWithDeps(env.deps(), WithBatchSize(2), WithMaxLength(128))
+	require.NoError(t, err)
+	require.Equal(t, 1, env.refs)
+	require.Contains(t, env.modelDir, "ms-marco-MiniLM-L-6-v2")
+	require.Equal(t, "https://huggingface.co/cross-encoder/ms-marco-MiniLM-L-6-v2/resolve/main/onnx/model.onnx", env.files["model.onnx"])
+	require.Equal(t, 128, env.scorerCfg.maxLength)
+	require.True(t, env.scorerCfg.useTokenTypeIDs)
+
+	docs := []string{"cats", "dogs and cats", "birds", "dogs", "fish"}
+	ranked, err := rf.Rerank(context.Background(), "dogs cats", rerankings.FromTexts(docs))
+	require.NoError(t, err)
+	results := ranked[rf.ID()]
+	require.Len(t, results, len(docs))
+	require.Equal(t, 1, results[0].Index)
+	require.Equal(t, "dogs and cats", results[0].String)
+	require.InDelta(t, 1/(1+math.Exp(-2)), results[0].Rank, 1e-6)
+	require.Equal(t, []int{2, 2, 1}, env.scorer.batches)
+
+	t.Run("rerank results keeps scores aligned", func(t *testing.T) {
+		qr := &chromago.QueryResultImpl{
+			IDLists: []chromago.DocumentIDs{{"1", "2"}, {}},
+			DocumentsLists: []chromago.Documents{
+				{chromago.NewTextDocument("birds"), chromago.NewTextDocument("cats")},
+				{},
+			},
+		}
+		reranked, err := rf.RerankResults(context.Background(), []string{"cats", "cats"}, qr)
+		require.NoError(t, err)
+		scores := reranked.Ranks[rf.ID()]
+		require.Len(t, scores, 2)
+		require.Greater(t, scores[0][1], scores[0][0])
+		require.Empty(t, scores[1])
+	})
+
+	require.NoError(t, rf.Close())
+	require.NoError(t, rf.Close())
+	require.Equal(t, 0, env.refs)
+	require.True(t, env.scorer.closed)
+	_, err = rf.Rerank(context.Background(), "q", rerankings.FromTexts(docs))
+	require.Error(t, err)
+}
+
+func TestCrossEncoderOptions(t *testing.T) {
+	t.Run("top n and softmax", func(t *testing.T) {
+		env := &fakeEnv{}
+		rf, err := newCrossEncoderRerankingFunctionWithDeps(env.deps(),
+			WithModel("BAAI/bge-reranker-base"),
+			WithNumLabels(2),
+			WithNormalization(NormalizationSoftmax),
+			WithoutTokenTypeIDs(),
+			WithTopN(1),
+		)
+		require.NoError(t, err)
+		defer rf.Close()
+		require.False(t, env.scorerCfg.useTokenTypeIDs)
+		require.Equal(t, "onnx-BAAI/bge-reranker-base", rf.ID())
+		ranked, err := rf.Rerank(context.Background(), "fish", rerankings.FromTexts([]string{"cats", "fish"}))
+		require.NoError(t, err)
+		require.Len(t, ranked[rf.ID()], 1)
+		require.Equal(t, 1, ranked[rf.ID()][0].Index)
+		require.InDelta(t, math.E/(1+math.E), ranked[rf.ID()][0].Rank, 1e-6)
+	})
+
+	t.Run("pinned revision and checksums", func(t *testing.T) {
+		env := &fakeEnv{}
+		modelSum, tokenizerSum := strings.Repeat("a", 64), strings.Repeat("B", 64)
+		rf, err := newCrossEncoderRerankingFunctionWithDeps(env.deps(),
+			WithModelRevision("c5ee24cb16019beea0893ab7796b1df96625c6b8"),
+			WithModelChecksums(modelSum, tokenizerSum),
+		)
+		require.NoError(t, err)
+		defer rf.Close()
+		require.Equal(t, "https://huggingface.co/cross-encoder/ms-marco-MiniLM-L-6-v2/resolve/c5ee24cb16019beea0893ab7796b1df96625c6b8/onnx/model.onnx", env.files["model.onnx"])
+		require.Equal(t, map[string]string{"model.onnx": modelSum, "tokenizer.json": strings.ToLower(tokenizerSum)}, env.checksums)
+
+		_, err = newCrossEncoderRerankingFunctionWithDeps(env.deps(), WithModelChecksums("abc", tokenizerSum))
+		require.Error(t, err)
+		_, err = newCrossEncoderRerankingFunctionWithDeps(env.deps(), WithModelRevision(" "))
+		require.Error(t, err)
+	})
+
+	t.Run("local model skips download", func(t *testing.T) {
+		env := &fakeEnv{}
+		rf, err := newCrossEncoderRerankingFunctionWithDeps(env.deps(), WithModelPath("/models/model.onnx", "/models/tokenizer.json"))
+		require.NoError(t, err)
+		defer rf.Close()
+		require.Empty(t, env.modelDir)
+		require.Equal(t, "/models/model.onnx", env.scorerCfg.modelPath)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		env := &fakeEnv{}
+		_, err := newCrossEncoderRerankingFunctionWithDeps(env.deps(), WithNormalization(NormalizationSoftmax))
+		require.Error(t, err)
+		_, err = newCrossEncoderRerankingFunctionWithDeps(env.deps(), WithNormalization("tanh"))
+		require.Error(t, err)
+		_, err = newCrossEncoderRerankingFunctionWithDeps(env.deps(), WithBatchSize(0))
+		require.Error(t, err)
+		require.Equal(t, 0, env.refs)
+	})
+
+	t.Run("scorer error releases environment", func(t *testing.T) {
+		env := &fakeEnv{}
+		deps := env.deps()
+		deps.newScorer = func(scorerConfig) (pairScorer, error) { return nil, errors.New("boom") }
+		_, err := newCrossEncoderRerankingFunctionWithDeps(deps)
+		require.Error(t, err)
+		require.Equal(t, 0, env.refs)
+	})
+}
+
+func TestCrossEncoderConfigRoundTrip(t *testing.T) {
+	env := &fakeEnv{}
+	rf, err := newCrossEncoderRerankingFunctionWithDeps(env.deps(),
+		WithModel("BAAI/bge-reranker-base"),
+		WithModelRevision("v1.0"),
+		WithModelChecksums(strings.Repeat("a", 64), strings.Repeat("b", 64)),
+		WithoutTokenTypeIDs(),
+		WithBatchSize(8),
+		WithTopN(3),
+	)
+	require.NoError(t, err)
+	defer rf.Close()
+	require.True(t, rerankings.HasReranker(rf.Name()))
+
+	data, err := json.Marshal(rf.GetConfig())
+	require.NoError(t, err)
+	var cfg rerankings.RerankingFunctionConfig
+	require.NoError(t, json.Unmarshal(data, &cfg))
+
+	// rebuild with the options the registry factory uses
+	env2 := &fakeEnv{}
+	opts, err := optionsFromConfig(cfg)
+	require.NoError(t, err)
+	rf2, err := newCrossEncoderRerankingFunctionWithDeps(env2.deps(), opts...)
+	require.NoError(t, err)
+	defer rf2.Close()
+	require.Equal(t, rf.ID(), rf2.ID())
+	data2, err := json.Marshal(rf2.GetConfig())
+	require.NoError(t, err)
+	require.JSONEq(t, string(data), string(data2))
+	require.Equal(t, env.files, env2.files)
+	require.Equal(t, env.checksums, env2.checksums)
+}
+
+func TestCrossEncoderModel(t *testing.T) {
+	rf, err := NewCrossEncoderRerankingFunction(WithMaxLength(256), WithBatchSize(4))
+	if err != nil {
+		t.Skipf("cross-encoder model unavailable in this environment: %v", err)
+	}
+	defer func() {
+		require.NoError(t, rf.Close())
+	}()
+	docs := []string{
+		"The capital of France is Paris.",
+		"Berlin is the capital of Germany.",
+		"Cats are small domesticated carnivores.",
+		"Paris is known for the Eiffel Tower.",
+		"Madrid is in Spain.",
+	}
+	ranked, err := rf.Rerank(context.Background(), "What is the capital of France?", rerankings.FromTexts(docs))
+	require.NoError(t, err)
+	results := ranked[rf.ID()]
+	require.Len(t, results, len(docs))
+	require.Equal(t, 0, results[0].Index)
+	for _, r := range results {
+		require.True(t, r.Rank >= 0 && r.Rank <= 1)
+	}
+}
@@ -0,0 +1,148 @@
+package crossencoder
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
+	"github.com/amikos-tech/chroma-go/pkg/rerankings"
+)
+
+type Option func(c *CrossEncoderRerankingFunction) error
+
+// WithModel sets the HuggingFace model to download, e.g. BAAI/bge-reranker-base.
+// The repository must contain onnx/model.onnx and tokenizer.json. With
+// WithModelPath the model name is only used in the reranker ID.
+func WithModel(model rerankings.RerankingModel) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if model == "" {
+			return errors.New("model cannot be empty")
+		}
+		c.model = model
+		return nil
+	}
+}
+
+// WithModelBaseURL sets the base URL models are downloaded from, for example a HuggingFace mirror.
+func WithModelBaseURL(baseURL string) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if baseURL == "" {
+			return errors.New("base URL cannot be empty")
+		}
+		c.modelBaseURL = baseURL
+		return nil
+	}
+}
+
+// WithModelRevision pins the HuggingFace revision the model is downloaded from,
+// preferably a commit hash. Defaults to [DefaultModelRevision].
+func WithModelRevision(revision string) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if strings.TrimSpace(revision) == "" {
+			return errors.New("model revision cannot be empty")
+		}
+		c.modelRevision = revision
+		return nil
+	}
+}
+
+// WithModelChecksums pins the SHA-256 checksums of onnx/model.onnx and
+// tokenizer.json. Downloaded and cached files are verified against them, and
+// files that do not match are downloaded again.
+func WithModelChecksums(modelSHA256, tokenizerSHA256 string) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		modelSHA256 = strings.ToLower(strings.TrimSpace(modelSHA256))
+		tokenizerSHA256 = strings.ToLower(strings.TrimSpace(tokenizerSHA256))
+		if !artifacts.LooksLikeSHA256(modelSHA256) || !artifacts.LooksLikeSHA256(tokenizerSHA256) {
+			return errors.New("model checksums must be hex encoded SHA-256 digests")
+		}
+		c.modelChecksums = map[string]string{modelFileName: modelSHA256, tokenizerFileName: tokenizerSHA256}
+		return nil
+	}
+}
+
+// WithModelPath uses local model and tokenizer files instead of downloading a model.
+func WithModelPath(modelPath, tokenizerPath string) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if modelPath == "" || tokenizerPath == "" {
+			return errors.New("model path and tokenizer path cannot be empty")
+		}
+		c.modelPath = modelPath
+		c.tokenizerPath = tokenizerPath
+		return nil
+	}
+}
+
+// WithMaxLength sets the maximum number of tokens of a (query, document) pair.
+// Longer pairs are truncated. Defaults to 512.
+func WithMaxLength(maxLength int) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if maxLength <= 0 {
+			return errors.New("max length must be a positive integer")
+		}
+		c.maxLength = maxLength
+		return nil
+	}
+}
+
+// WithBatchSize sets the number of pairs scored per model run. Defaults to 32.
+func WithBatchSize(batchSize int) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if batchSize <= 0 {
+			return errors.New("batch size must be a positive integer")
+		}
+		c.batchSize = batchSize
+		return nil
+	}
+}
+
+// WithNumLabels sets the number of logits the model returns per pair. Defaults to 1.
+func WithNumLabels(numLabels int) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if numLabels <= 0 {
+			return errors.New("number of labels must be a positive integer")
+		}
+		c.numLabels = numLabels
+		return nil
+	}
+}
+
+// WithOutputName sets the name of the model output holding the logits. Defaults to "logits".
+func WithOutputName(name string) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if name == "" {
+			return errors.New("output name cannot be empty")
+		}
+		c.outputName = name
+		return nil
+	}
+}
+
+// WithoutTokenTypeIDs omits the token_type_ids input, for models without it such
+// as XLM-RoBERTa based rerankers (bge-reranker).
+func WithoutTokenTypeIDs() Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		c.useTokenTypeIDs = false
+		return nil
+	}
+}
+
+// WithNormalization sets how logits are converted to scores. Defaults to [NormalizationAuto].
+func WithNormalization(normalization Normalization) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		c.normalization = normalization
+		return nil
+	}
+}
+
+// WithTopN limits the number of results returned by Rerank.
+func WithTopN(topN int) Option {
+	return func(c *CrossEncoderRerankingFunction) error {
+		if topN <= 0 {
+			return errors.New("topN must be a positive integer")
+		}
+		c.topN = &topN
+		return nil
+	}
+}
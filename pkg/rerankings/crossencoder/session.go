@@ -0,0 +1,189 @@
+package crossencoder
+
+import (
+	stderrors "errors"
+
+	ort "github.com/amikos-tech/pure-onnx/ort"
+	tokenizers "github.com/amikos-tech/pure-tokenizers"
+	"github.com/pkg/errors"
+)
+
+// pairScorer returns the raw model logits of (query, document) pairs, numLabels
+// values per pair.
+type pairScorer interface {
+	Score(queries, documents []string) ([]float32, error)
+	Close() error
+}
+
+type scorerConfig struct {
+	modelPath       string
+	tokenizerPath   string
+	maxLength       int
+	batchSize       int
+	numLabels       int
+	outputName      string
+	useTokenTypeIDs bool
+}
+
+// onnxScorer runs a cross-encoder ONNX model over fixed-size batches. A single
+// session is created for batchSize pairs; shorter batches are padded by
+// repeating their first pair and the padding rows are discarded.
+type onnxScorer struct {
+	cfg       scorerConfig
+	tokenizer *tokenizers.Tokenizer
+
+	inputIDs      []int64
+	attentionMask []int64
+	tokenTypeIDs  []int64
+	inputTensors  []*ort.Tensor[int64]
+	outputTensor  *ort.Tensor[float32]
+	session       *ort.AdvancedSession
+}
+
+func newONNXScorer(cfg scorerConfig) (_ pairScorer, err error) {
+	tokenizer, err := tokenizers.FromFile(cfg.tokenizerPath,
+		tokenizers.WithTruncation(uintptr(cfg.maxLength), tokenizers.TruncationDirectionRight, tokenizers.TruncationStrategyLongestFirst),
+		tokenizers.WithPadding(true, tokenizers.PaddingStrategy{Tag: tokenizers.PaddingStrategyFixed, FixedSize: uintptr(cfg.maxLength)}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load tokenizer")
+	}
+	s := &onnxScorer{cfg: cfg, tokenizer: tokenizer}
+	defer func() {
+		if err != nil {
+			if closeErr := s.Close(); closeErr != nil {
+				err = stderrors.Join(err, errors.Wrap(closeErr, "failed to clean up cross-encoder session"))
+			}
+		}
+	}()
+
+	total := cfg.batchSize * cfg.maxLength
+	shape := ort.Shape{int64(cfg.batchSize), int64(cfg.maxLength)}
+	inputNames := []string{"input_ids", "attention_mask"}
+	s.inputIDs = make([]int64, total)
+	s.attentionMask = make([]int64, total)
+	buffers := [][]int64{s.inputIDs, s.attentionMask}
+	if cfg.useTokenTypeIDs {
+		s.tokenTypeIDs = make([]int64, total)
+		buffers = append(buffers, s.tokenTypeIDs)
+		inputNames = append(inputNames, "token_type_ids")
+	}
+	inputValues := make([]ort.Value, 0, len(buffers))
+	for i, buf := range buffers {
+		tensor, err := ort.NewTensor[int64](shape, buf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create %s tensor", inputNames[i])
+		}
+		s.inputTensors = append(s.inputTensors, tensor)
+		inputValues = append(inputValues, tensor)
+	}
+	s.outputTensor, err = ort.NewEmptyTensor[float32](ort.Shape{int64(cfg.batchSize), int64(cfg.numLabels)})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create output tensor")
+	}
+	s.session, err = ort.NewAdvancedSession(cfg.modelPath, inputNames, []string{cfg.outputName}, inputValues, []ort.Value{s.outputTensor}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cross-encoder session")
+	}
+	return s, nil
+}
+
+func (s *onnxScorer) Score(queries, documents []string) ([]float32, error) {
+	n := len(queries)
+	if n == 0 {
+		return []float32{}, nil
+	}
+	if n > s.cfg.batchSize {
+		return nil, errors.Errorf("batch of %d pairs exceeds the session batch size %d", n, s.cfg.batchSize)
+	}
+	// pad the batch to the session size with copies of the first pair
+	padded := make([]string, s.cfg.batchSize)
+	paddedDocs := make([]string, s.cfg.batchSize)
+	for i := range padded {
+		src := i
+		if i >= n {
+			src = 0
+		}
+		padded[i] = queries[src]
+		paddedDocs[i] = documents[src]
+	}
+	encodings, err := s.tokenizer.EncodePairs(padded, paddedDocs,
+		tokenizers.WithAddSpecialTokens(),
+		tokenizers.WithReturnAttentionMask(),
+		tokenizers.WithReturnTypeIDs(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to tokenize pairs")
+	}
+	if len(encodings) != len(padded) {
+		return nil, errors.Errorf("tokenizer returned %d encodings for %d pairs", len(encodings), len(padded))
+	}
+	clear(s.inputIDs)
+	clear(s.attentionMask)
+	clear(s.tokenTypeIDs)
+	seqLen := s.cfg.maxLength
+	for i, enc := range encodings {
+		if enc == nil {
+			return nil, errors.Errorf("empty tokenizer result for pair %d", i)
+		}
+		row := i * seqLen
+		fillInt64(s.inputIDs[row:row+seqLen], enc.IDs)
+		if len(enc.AttentionMask) > 0 {
+			fillInt64(s.attentionMask[row:row+seqLen], enc.AttentionMask)
+		} else {
+			for j, id := range s.inputIDs[row : row+seqLen] {
+				if id != 0 {
+					s.attentionMask[row+j] = 1
+				}
+			}
+		}
+		if s.tokenTypeIDs != nil {
+			fillInt64(s.tokenTypeIDs[row:row+seqLen], enc.TypeIDs)
+		}
+	}
+	if err := s.session.Run(); err != nil {
+		return nil, errors.Wrap(err, "failed to run cross-encoder session")
+	}
+	logits := s.outputTensor.GetData()
+	if len(logits) < n*s.cfg.numLabels {
+		return nil, errors.Errorf("unexpected output size %d for %d pairs with %d labels", len(logits), n, s.cfg.numLabels)
+	}
+	out := make([]float32, n*s.cfg.numLabels)
+	copy(out, logits)
+	return out, nil
+}
+
+func (s *onnxScorer) Close() error {
+	var errs []error
+	if s.session != nil {
+		if err := s.session.Destroy(); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to destroy session"))
+		}
+		s.session = nil
+	}
+	if s.outputTensor != nil {
+		if err := s.outputTensor.Destroy(); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to destroy output tensor"))
+		}
+		s.outputTensor = nil
+	}
+	for _, t := range s.inputTensors {
+		if err := t.Destroy(); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to destroy input tensor"))
+		}
+	}
+	s.inputTensors = nil
+	if s.tokenizer != nil {
+		if err := s.tokenizer.Close(); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to close tokenizer"))
+		}
+		s.tokenizer = nil
+	}
+	return stderrors.Join(errs...)
+}
+
+func fillInt64(dst []int64, src []uint32) {
+	for i := 0; i < len(dst) && i < len(src); i++ {
+		dst[i] = int64(src[i])
+	}
+}
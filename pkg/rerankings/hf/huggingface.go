@@ -13,6 +13,8 @@ import (
 )
 
 const (
+	// APIKeyEnvVar is the default environment variable holding the API key.
+	APIKeyEnvVar           = "HF_API_KEY"
 	DefaultBaseAPIEndpoint = "http://127.0.0.1:8080/rerank"
 )
 
@@ -27,7 +29,7 @@ type RerankingResponse []struct {
 	Score float32 `json:"score"`
 }
 
-var _ rerankings.RerankingFunction = (*HFRerankingFunction)(nil)
+var _ rerankings.ConfigurableRerankingFunction = (*HFRerankingFunction)(nil)
 
 func getDefaults() *HFRerankingFunction {
 	return &HFRerankingFunction{
@@ -39,6 +41,7 @@ func getDefaults() *HFRerankingFunction {
 type HFRerankingFunction struct {
 	httpClient        *http.Client
 	apiKey            string
+	apiKeyEnvVar      string
 	defaultModel      *rerankings.RerankingModel
 	rerankingEndpoint string
 }
@@ -180,3 +183,50 @@ func (r *HFRerankingFunction) RerankResults(ctx context.Context, queryTexts []st
 	}
 	return rerankedResults, nil
 }
+
+// Name returns the registry name of the reranking function.
+func (r *HFRerankingFunction) Name() string {
+	return "hf"
+}
+
+// GetConfig returns the persistable configuration of the reranking function.
+// The API key, if any, is referenced by its environment variable name.
+func (r *HFRerankingFunction) GetConfig() rerankings.RerankingFunctionConfig {
+	cfg := rerankings.RerankingFunctionConfig{
+		"base_url": r.rerankingEndpoint,
+	}
+	if r.defaultModel != nil {
+		cfg["model_name"] = string(*r.defaultModel)
+	}
+	if r.apiKeyEnvVar != "" {
+		cfg["api_key_env_var"] = r.apiKeyEnvVar
+	} else if r.apiKey != "" {
+		cfg["api_key_env_var"] = APIKeyEnvVar
+	}
+	return cfg
+}
+
+// NewHFRerankingFunctionFromConfig creates a HuggingFace Text Embeddings Inference
+// reranking function from a config map. Supported fields: base_url, model_name,
+// api_key_env_var. The API key is optional.
+func NewHFRerankingFunctionFromConfig(cfg rerankings.RerankingFunctionConfig) (*HFRerankingFunction, error) {
+	opts := make([]Option, 0)
+	if envVar, ok := rerankings.ConfigString(cfg, "api_key_env_var"); ok {
+		opts = append(opts, WithAPIKeyFromEnvVar(envVar))
+	}
+	if model, ok := rerankings.ConfigString(cfg, "model_name"); ok {
+		opts = append(opts, WithModel(rerankings.RerankingModel(model)))
+	}
+	if baseURL, ok := rerankings.ConfigString(cfg, "base_url"); ok {
+		opts = append(opts, WithRerankingEndpoint(baseURL))
+	}
+	return NewHFRerankingFunction(opts...)
+}
+
+func init() {
+	if err := rerankings.RegisterReranker("hf", func(cfg rerankings.RerankingFunctionConfig) (rerankings.RerankingFunction, error) {
+		return NewHFRerankingFunctionFromConfig(cfg)
+	}); err != nil {
+		panic(err)
+	}
+}
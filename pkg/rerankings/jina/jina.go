@@ -13,6 +13,8 @@ import (
 )
 
 const (
+	// APIKeyEnvVar is the default environment variable holding the API key.
+	APIKeyEnvVar                                     = "JINA_API_KEY"
 	DefaultBaseAPIEndpoint                           = "https://api.jina.ai/v1/rerank"
 	DefaultRerankingModel  rerankings.RerankingModel = "jina-reranker-v2-base-multilingual"
 )
@@ -39,7 +41,7 @@ type RerankingResponse struct {
 	} `json:"results"`
 }
 
-var _ rerankings.RerankingFunction = (*JinaRerankingFunction)(nil)
+var _ rerankings.ConfigurableRerankingFunction = (*JinaRerankingFunction)(nil)
 
 func getDefaults() *JinaRerankingFunction {
 	var returnDocuments = true
@@ -55,6 +57,7 @@ func getDefaults() *JinaRerankingFunction {
 type JinaRerankingFunction struct {
 	httpClient        *http.Client
 	apiKey            string
+	apiKeyEnvVar      string
 	defaultModel      rerankings.RerankingModel
 	rerankingEndpoint string
 	returnDocuments   *bool
@@ -205,3 +208,62 @@ func (r *JinaRerankingFunction) RerankResults(ctx context.Context, queryTexts []
 	}
 	return rerankedResults, nil
 }
+
+// Name returns the registry name of the reranking function.
+func (r *JinaRerankingFunction) Name() string {
+	return "jina"
+}
+
+// GetConfig returns the persistable configuration of the reranking function.
+// The API key is referenced by its environment variable name.
+func (r *JinaRerankingFunction) GetConfig() rerankings.RerankingFunctionConfig {
+	envVar := r.apiKeyEnvVar
+	if envVar == "" {
+		envVar = APIKeyEnvVar
+	}
+	cfg := rerankings.RerankingFunctionConfig{
+		"model_name":      string(r.defaultModel),
+		"api_key_env_var": envVar,
+	}
+	if r.rerankingEndpoint != "" && r.rerankingEndpoint != DefaultBaseAPIEndpoint {
+		cfg["base_url"] = r.rerankingEndpoint
+	}
+	if r.topN != nil {
+		cfg["top_n"] = *r.topN
+	}
+	if r.returnDocuments != nil && !*r.returnDocuments {
+		cfg["return_documents"] = false
+	}
+	return cfg
+}
+
+// NewJinaRerankingFunctionFromConfig creates a Jina reranking function from a config map.
+// Supported fields: api_key_env_var, model_name, base_url, top_n, return_documents.
+func NewJinaRerankingFunctionFromConfig(cfg rerankings.RerankingFunctionConfig) (*JinaRerankingFunction, error) {
+	envVar, ok := rerankings.ConfigString(cfg, "api_key_env_var")
+	if !ok {
+		envVar = APIKeyEnvVar
+	}
+	opts := []Option{WithAPIKeyFromEnvVar(envVar)}
+	if model, ok := rerankings.ConfigString(cfg, "model_name"); ok {
+		opts = append(opts, WithModel(rerankings.RerankingModel(model)))
+	}
+	if baseURL, ok := rerankings.ConfigString(cfg, "base_url"); ok {
+		opts = append(opts, WithRerankingEndpoint(baseURL))
+	}
+	if topN, ok := rerankings.ConfigInt(cfg, "top_n"); ok {
+		opts = append(opts, WithTopN(topN))
+	}
+	if returnDocuments, ok := rerankings.ConfigBool(cfg, "return_documents"); ok {
+		opts = append(opts, WithReturnDocuments(returnDocuments))
+	}
+	return NewJinaRerankingFunction(opts...)
+}
+
+func init() {
+	if err := rerankings.RegisterReranker("jina", func(cfg rerankings.RerankingFunctionConfig) (rerankings.RerankingFunction, error) {
+		return NewJinaRerankingFunctionFromConfig(cfg)
+	}); err != nil {
+		panic(err)
+	}
+}
@@ -20,10 +20,23 @@ func WithAPIKey(apiKey string) Option {
 
 func WithEnvAPIKey() Option {
 	return func(c *JinaRerankingFunction) error {
-		if os.Getenv("JINA_API_KEY") == "" {
-			return fmt.Errorf("JINA_API_KEY not set")
+		if os.Getenv(APIKeyEnvVar) == "" {
+			return fmt.Errorf("%s not set", APIKeyEnvVar)
 		}
-		c.apiKey = os.Getenv("JINA_API_KEY")
+		c.apiKey = os.Getenv(APIKeyEnvVar)
+		c.apiKeyEnvVar = APIKeyEnvVar
+		return nil
+	}
+}
+
+// WithAPIKeyFromEnvVar reads the API key from the specified environment variable
+func WithAPIKeyFromEnvVar(envVar string) Option {
+	return func(c *JinaRerankingFunction) error {
+		if os.Getenv(envVar) == "" {
+			return fmt.Errorf("%s not set", envVar)
+		}
+		c.apiKey = os.Getenv(envVar)
+		c.apiKeyEnvVar = envVar
 		return nil
 	}
 }
@@ -0,0 +1,114 @@
+//go:build rf
+
+package rerankings_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/amikos-tech/chroma-go/pkg/rerankings"
+	"github.com/amikos-tech/chroma-go/pkg/rerankings/cohere"
+	huggingface "github.com/amikos-tech/chroma-go/pkg/rerankings/hf"
+	"github.com/amikos-tech/chroma-go/pkg/rerankings/jina"
+	"github.com/amikos-tech/chroma-go/pkg/rerankings/together"
+)
+
+// TestRerankingFunctionPersistence verifies that the built-in reranking functions
+// can be serialized via Name() and GetConfig() and rebuilt via BuildReranker().
+func TestRerankingFunctionPersistence(t *testing.T) {
+	t.Setenv("COHERE_API_KEY", "test-cohere")
+	t.Setenv("JINA_API_KEY", "test-jina")
+	t.Setenv("TOGETHER_API_KEY", "test-together")
+	t.Setenv("MY_HF_KEY", "test-hf")
+
+	newCohere := func() (rerankings.ConfigurableRerankingFunction, error) {
+		return cohere.NewCohereRerankingFunction(
+			cohere.WithEnvAPIKey(),
+			cohere.WithDefaultModel(cohere.ModelRerankMultilingualV30),
+			cohere.WithTopN(3),
+			cohere.WithRerankFields([]string{"title"}),
+		)
+	}
+	newJina := func() (rerankings.ConfigurableRerankingFunction, error) {
+		return jina.NewJinaRerankingFunction(jina.WithEnvAPIKey(), jina.WithTopN(5), jina.WithReturnDocuments(false))
+	}
+	newTogether := func() (rerankings.ConfigurableRerankingFunction, error) {
+		return together.NewTogetherRerankingFunction(together.WithEnvAPIKey(), together.WithRerankingEndpoint("http://localhost:1234/rerank"))
+	}
+	newHF := func() (rerankings.ConfigurableRerankingFunction, error) {
+		return huggingface.NewHFRerankingFunction(
+			huggingface.WithAPIKeyFromEnvVar("MY_HF_KEY"),
+			huggingface.WithModel("BAAI/bge-reranker-base"),
+			huggingface.WithRerankingEndpoint("http://localhost:8080/rerank"),
+		)
+	}
+
+	tests := []struct {
+		name    string
+		newRF   func() (rerankings.ConfigurableRerankingFunction, error)
+		checkFn func(t *testing.T, cfg rerankings.RerankingFunctionConfig)
+	}{
+		{"cohere", newCohere, func(t *testing.T, cfg rerankings.RerankingFunctionConfig) {
+			assert.Equal(t, string(cohere.ModelRerankMultilingualV30), cfg["model_name"])
+			assert.Equal(t, "COHERE_API_KEY", cfg["api_key_env_var"])
+		}},
+		{"jina", newJina, func(t *testing.T, cfg rerankings.RerankingFunctionConfig) {
+			assert.Equal(t, false, cfg["return_documents"])
+		}},
+		{"together", newTogether, func(t *testing.T, cfg rerankings.RerankingFunctionConfig) {
+			assert.Equal(t, "http://localhost:1234/rerank", cfg["base_url"])
+		}},
+		{"hf", newHF, func(t *testing.T, cfg rerankings.RerankingFunctionConfig) {
+			assert.Equal(t, "MY_HF_KEY", cfg["api_key_env_var"])
+			assert.Equal(t, "BAAI/bge-reranker-base", cfg["model_name"])
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rf, err := tt.newRF()
+			require.NoError(t, err)
+			require.Equal(t, tt.name, rf.Name())
+			require.True(t, rerankings.HasReranker(rf.Name()))
+			cfg := rf.GetConfig()
+			tt.checkFn(t, cfg)
+			serialized, err := json.Marshal(cfg)
+			require.NoError(t, err)
+			assert.NotContains(t, string(serialized), "test-", "config must not contain API keys")
+
+			// round trip through JSON, as a stored stage would
+			stage, err := rerankings.NewRerankStage(rf, 10)
+			require.NoError(t, err)
+			data, err := json.Marshal(stage)
+			require.NoError(t, err)
+			var decoded rerankings.RerankStage
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			require.Equal(t, 10, decoded.TopN)
+
+			rebuilt, err := decoded.Reranker.Build()
+			require.NoError(t, err)
+			require.Equal(t, rf.ID(), rebuilt.ID())
+			rebuiltCfg := rebuilt.(rerankings.ConfigurableRerankingFunction).GetConfig()
+			expected, err := json.Marshal(cfg)
+			require.NoError(t, err)
+			actual, err := json.Marshal(rebuiltCfg)
+			require.NoError(t, err)
+			require.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestRerankerRegistry(t *testing.T) {
+	require.Contains(t, rerankings.ListRerankers(), "cohere")
+
+	_, err := rerankings.BuildReranker("does-not-exist", nil)
+	require.Error(t, err)
+
+	err = rerankings.RegisterReranker("cohere", func(rerankings.RerankingFunctionConfig) (rerankings.RerankingFunction, error) {
+		return nil, nil
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "already registered")
+}
@@ -0,0 +1,152 @@
+package rerankings
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RerankingFunctionConfig represents serializable configuration for a reranking function.
+type RerankingFunctionConfig map[string]interface{}
+
+// ConfigurableRerankingFunction is a reranking function that can be persisted and
+// rebuilt by name with [BuildReranker].
+type ConfigurableRerankingFunction interface {
+	RerankingFunction
+	// Name returns the registry name of the reranking function.
+	Name() string
+	// GetConfig returns the configuration needed to rebuild the reranking function.
+	// Secrets are never included; API keys are referenced by environment variable name.
+	GetConfig() RerankingFunctionConfig
+}
+
+// RerankingFunctionFactory creates a RerankingFunction from config.
+type RerankingFunctionFactory func(config RerankingFunctionConfig) (RerankingFunction, error)
+
+var (
+	rerankerFactories = make(map[string]RerankingFunctionFactory)
+	mu                sync.RWMutex
+)
+
+// RegisterReranker registers a reranking function factory by name.
+// Returns an error if a factory with the same name is already registered.
+func RegisterReranker(name string, factory RerankingFunctionFactory) error {
+	if name == "" {
+		return errors.New("reranking function name cannot be empty")
+	}
+	if factory == nil {
+		return errors.New("reranking function factory cannot be nil")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := rerankerFactories[name]; exists {
+		return errors.Errorf("reranking function %q already registered", name)
+	}
+	rerankerFactories[name] = factory
+	return nil
+}
+
+// BuildReranker creates a RerankingFunction from name and config.
+func BuildReranker(name string, config RerankingFunctionConfig) (RerankingFunction, error) {
+	mu.RLock()
+	factory, ok := rerankerFactories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown reranking function: %s", name)
+	}
+	if config == nil {
+		config = RerankingFunctionConfig{}
+	}
+	return factory(config)
+}
+
+// HasReranker reports whether a reranking function is registered under name.
+func HasReranker(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := rerankerFactories[name]
+	return ok
+}
+
+// ListRerankers returns all registered reranking function names in sorted order.
+func ListRerankers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(rerankerFactories))
+	for name := range rerankerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RerankerSpec is the declarative form of a reranking function: a registry name
+// and its config. It round-trips through JSON so that a rerank stage can be
+// stored alongside other pipeline settings.
+//
+//	{"name": "cohere", "config": {"model_name": "rerank-english-v3.0", "api_key_env_var": "COHERE_API_KEY"}}
+type RerankerSpec struct {
+	Name   string                  `json:"name"`
+	Config RerankingFunctionConfig `json:"config,omitempty"`
+}
+
+// Build creates the reranking function described by the spec.
+func (s RerankerSpec) Build() (RerankingFunction, error) {
+	return BuildReranker(s.Name, s.Config)
+}
+
+// SpecFor returns the declarative spec of a configurable reranking function.
+func SpecFor(rf RerankingFunction) (RerankerSpec, error) {
+	c, ok := rf.(ConfigurableRerankingFunction)
+	if !ok {
+		return RerankerSpec{}, errors.Errorf("reranking function %T does not support configuration persistence", rf)
+	}
+	return RerankerSpec{Name: c.Name(), Config: c.GetConfig()}, nil
+}
+
+// ConfigString returns a non-empty string value from config.
+func ConfigString(cfg RerankingFunctionConfig, key string) (string, bool) {
+	v, ok := cfg[key].(string)
+	return v, ok && v != ""
+}
+
+// ConfigInt returns an integer value from config. JSON numbers (float64) are accepted.
+func ConfigInt(cfg RerankingFunctionConfig, key string) (int, bool) {
+	switch v := cfg[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), true
+		}
+	}
+	return 0, false
+}
+
+// ConfigBool returns a boolean value from config.
+func ConfigBool(cfg RerankingFunctionConfig, key string) (bool, bool) {
+	v, ok := cfg[key].(bool)
+	return v, ok
+}
+
+// ConfigStrings returns a string slice value from config. JSON arrays ([]any) are accepted.
+func ConfigStrings(cfg RerankingFunctionConfig, key string) ([]string, bool) {
+	switch v := cfg[key].(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, s)
+		}
+		return out, true
+	}
+	return nil, false
+}
@@ -0,0 +1,287 @@
+package rerankings
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// RerankedSearchResults holds Search results reordered by a reranking function.
+//
+// The embedded [chromago.SearchResultImpl] contains every result group reordered
+// best first, so Rows, RowGroups and At work as usual. The original Search
+// scores are kept in Scores; reranker scores are in Ranks.
+type RerankedSearchResults struct {
+	*chromago.SearchResultImpl
+	QueryTexts []string               // Query text used for each result group
+	Ranks      map[string][][]float32 // reranker ID -> group -> score, aligned with the reordered rows
+	// OriginalIndexes maps each reordered row to its position in the original group.
+	OriginalIndexes [][]int
+}
+
+// SearchRerankOption configures [RerankSearchResult].
+type SearchRerankOption func(c *searchRerankConfig) error
+
+type searchRerankConfig struct {
+	topN int
+}
+
+// WithSearchRerankTopN keeps only the n best reranked rows of each result group.
+func WithSearchRerankTopN(n int) SearchRerankOption {
+	return func(c *searchRerankConfig) error {
+		if n < 1 {
+			return errors.New("topN must be a positive integer")
+		}
+		c.topN = n
+		return nil
+	}
+}
+
+// RerankSearchResult reranks the documents of every result group of a Search
+// response. queryTexts holds either one text per result group (one per search
+// request in the batch) or a single text used for all groups.
+//
+// Documents must be selected in the search request ([chromago.KDocument]).
+// Rows the reranker does not score (for example when the reranker applies its
+// own top-N) are kept after the scored rows in their original order, unless
+// [WithSearchRerankTopN] drops them. Results grouped server-side with
+// [chromago.WithGroupBy] are reranked as a flat list per search request.
+func RerankSearchResult(ctx context.Context, rf RerankingFunction, queryTexts []string, result *chromago.SearchResultImpl, opts ...SearchRerankOption) (*RerankedSearchResults, error) {
+	if rf == nil {
+		return nil, errors.New("reranking function cannot be nil")
+	}
+	if result == nil {
+		return nil, errors.New("search result cannot be nil")
+	}
+	cfg := &searchRerankConfig{}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+	groups := len(result.IDs)
+	switch {
+	case len(queryTexts) == 1 && groups > 1:
+		texts := make([]string, groups)
+		for i := range texts {
+			texts[i] = queryTexts[0]
+		}
+		queryTexts = texts
+	case len(queryTexts) != groups:
+		return nil, errors.Errorf("queryTexts length (%d) does not match the number of result groups (%d)", len(queryTexts), groups)
+	}
+
+	reranked := &RerankedSearchResults{
+		SearchResultImpl: &chromago.SearchResultImpl{},
+		QueryTexts:       queryTexts,
+		Ranks:            map[string][][]float32{rf.ID(): make([][]float32, groups)},
+		OriginalIndexes:  make([][]int, groups),
+	}
+	for g := 0; g < groups; g++ {
+		if len(result.IDs[g]) == 0 {
+			reranked.OriginalIndexes[g] = []int{}
+			reranked.Ranks[rf.ID()][g] = []float32{}
+			continue
+		}
+		if g >= len(result.Documents) || len(result.Documents[g]) != len(result.IDs[g]) {
+			return nil, errors.Errorf("result group %d has no documents to rerank; select documents with WithSelect(KDocument)", g)
+		}
+		ranked, err := rf.Rerank(ctx, queryTexts[g], FromTexts(result.Documents[g]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reranking result group %d", g)
+		}
+		order, scores, err := searchRerankOrder(rf.ID(), ranked, len(result.IDs[g]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reranking result group %d", g)
+		}
+		if cfg.topN > 0 && len(order) > cfg.topN {
+			order = order[:cfg.topN]
+			scores = scores[:cfg.topN]
+		}
+		reranked.OriginalIndexes[g] = order
+		reranked.Ranks[rf.ID()][g] = scores
+	}
+	permuteSearchResult(result, reranked.SearchResultImpl, reranked.OriginalIndexes)
+	return reranked, nil
+}
+
+// searchRerankOrder returns the original indexes ordered by descending reranker
+// score, followed by unscored indexes, and the matching scores.
+func searchRerankOrder(id string, ranked map[string][]RankedResult, n int) ([]int, []float32, error) {
+	results, ok := ranked[id]
+	if !ok && len(ranked) == 1 {
+		for _, r := range ranked {
+			results = r
+		}
+	}
+	sorted := make([]RankedResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Rank > sorted[j].Rank })
+
+	order := make([]int, 0, n)
+	scores := make([]float32, 0, n)
+	seen := make([]bool, n)
+	for _, r := range sorted {
+		if r.Index < 0 || r.Index >= n {
+			return nil, nil, errors.Errorf("invalid index %d from reranker (valid range: 0-%d)", r.Index, n-1)
+		}
+		if seen[r.Index] {
+			continue
+		}
+		seen[r.Index] = true
+		order = append(order, r.Index)
+		scores = append(scores, r.Rank)
+	}
+	for i := 0; i < n; i++ {
+		if !seen[i] {
+			order = append(order, i)
+			scores = append(scores, 0)
+		}
+	}
+	return order, scores, nil
+}
+
+func permuteSearchResult(src, dst *chromago.SearchResultImpl, orders [][]int) {
+	dst.IDs = make([][]chromago.DocumentID, len(orders))
+	if src.Documents != nil {
+		dst.Documents = make([][]string, len(orders))
+	}
+	if src.Metadatas != nil {
+		dst.Metadatas = make([][]chromago.DocumentMetadata, len(orders))
+	}
+	if src.Embeddings != nil {
+		dst.Embeddings = make([][][]float32, len(orders))
+	}
+	if src.Scores != nil {
+		dst.Scores = make([][]float64, len(orders))
+	}
+	for g, order := range orders {
+		dst.IDs[g] = permute(src.IDs[g], order)
+		if g < len(src.Documents) {
+			dst.Documents[g] = permute(src.Documents[g], order)
+		}
+		if g < len(src.Metadatas) {
+			dst.Metadatas[g] = permute(src.Metadatas[g], order)
+		}
+		if g < len(src.Embeddings) {
+			dst.Embeddings[g] = permute(src.Embeddings[g], order)
+		}
+		if g < len(src.Scores) {
+			dst.Scores[g] = permute(src.Scores[g], order)
+		}
+	}
+}
+
+// permute returns values reordered by order. Indexes past the end of values are
+// skipped so partially populated columns stay partially populated.
+func permute[T any](values []T, order []int) []T {
+	if values == nil {
+		return nil
+	}
+	out := make([]T, 0, len(order))
+	for _, i := range order {
+		if i < len(values) {
+			out = append(out, values[i])
+		}
+	}
+	return out
+}
+
+// SearchAndRerank runs [chromago.Collection.Search] and reranks the results with
+// rf. Documents are always selected so that they can be reranked.
+//
+//	rf, _ := cohere.NewCohereRerankingFunction(cohere.WithEnvAPIKey())
+//	results, err := rerankings.SearchAndRerank(ctx, collection, rf, []string{"query"},
+//	    []chromago.SearchCollectionOption{
+//	        chromago.NewSearchRequest(chromago.WithKnnRank(chromago.KnnQueryText("query")), chromago.WithPage(chromago.WithLimit(50))),
+//	    },
+//	    rerankings.WithSearchRerankTopN(10),
+//	)
+func SearchAndRerank(ctx context.Context, collection chromago.Collection, rf RerankingFunction, queryTexts []string, searchOpts []chromago.SearchCollectionOption, opts ...SearchRerankOption) (*RerankedSearchResults, error) {
+	if collection == nil {
+		return nil, errors.New("collection cannot be nil")
+	}
+	searchOpts = append(searchOpts, selectDocuments)
+	res, err := collection.Search(ctx, searchOpts...)
+	if err != nil {
+		return nil, err
+	}
+	impl, ok := res.(*chromago.SearchResultImpl)
+	if !ok {
+		return nil, errors.Errorf("unexpected search result type %T", res)
+	}
+	return RerankSearchResult(ctx, rf, queryTexts, impl, opts...)
+}
+
+func selectDocuments(query *chromago.SearchQuery) error {
+	for i := range query.Searches {
+		req := &query.Searches[i]
+		if req.Select == nil {
+			req.Select = &chromago.SearchSelect{}
+		}
+		found := false
+		for _, k := range req.Select.Keys {
+			if k == chromago.KDocument {
+				found = true
+				break
+			}
+		}
+		if !found {
+			req.Select.Keys = append(req.Select.Keys, chromago.KDocument)
+		}
+	}
+	return nil
+}
+
+// RerankStage is a declarative post-search rerank step. It is JSON serializable
+// so that it can be stored with other pipeline settings and attached to a search
+// at runtime:
+//
+//	{"reranker": {"name": "jina", "config": {"api_key_env_var": "JINA_API_KEY"}}, "top_n": 10}
+type RerankStage struct {
+	Reranker RerankerSpec `json:"reranker"`
+	TopN     int          `json:"top_n,omitempty"`
+}
+
+// NewRerankStage creates a stage from a configurable reranking function.
+func NewRerankStage(rf RerankingFunction, topN int) (*RerankStage, error) {
+	spec, err := SpecFor(rf)
+	if err != nil {
+		return nil, err
+	}
+	if topN < 0 {
+		return nil, errors.New("topN cannot be negative")
+	}
+	return &RerankStage{Reranker: spec, TopN: topN}, nil
+}
+
+// Apply builds the stage reranker and reranks result.
+func (s *RerankStage) Apply(ctx context.Context, queryTexts []string, result *chromago.SearchResultImpl) (*RerankedSearchResults, error) {
+	rf, err := s.Reranker.Build()
+	if err != nil {
+		return nil, err
+	}
+	return RerankSearchResult(ctx, rf, queryTexts, result, s.options()...)
+}
+
+// Search runs the search and applies the stage to its results.
+func (s *RerankStage) Search(ctx context.Context, collection chromago.Collection, queryTexts []string, searchOpts ...chromago.SearchCollectionOption) (*RerankedSearchResults, error) {
+	rf, err := s.Reranker.Build()
+	if err != nil {
+		return nil, err
+	}
+	return SearchAndRerank(ctx, collection, rf, queryTexts, searchOpts, s.options()...)
+}
+
+func (s *RerankStage) options() []SearchRerankOption {
+	if s.TopN > 0 {
+		return []SearchRerankOption{WithSearchRerankTopN(s.TopN)}
+	}
+	return nil
+}
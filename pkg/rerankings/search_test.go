@@ -0,0 +1,86 @@
+//go:build rf
+
+package rerankings
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// lengthRerankingFunction scores documents by length and only scores the first
+// maxScored inputs when maxScored > 0.
+type lengthRerankingFunction struct {
+	DummyRerankingFunction
+	maxScored int
+}
+
+func (l *lengthRerankingFunction) ID() string { return "length" }
+
+func (l *lengthRerankingFunction) Rerank(_ context.Context, _ string, results []Result) (map[string][]RankedResult, error) {
+	ranked := make([]RankedResult, 0, len(results))
+	for i, r := range results {
+		if l.maxScored > 0 && i >= l.maxScored {
+			break
+		}
+		text, err := r.ToText()
+		if err != nil {
+			return nil, err
+		}
+		ranked = append(ranked, RankedResult{Index: i, String: text, Rank: float32(len(text))})
+	}
+	return map[string][]RankedResult{l.ID(): ranked}, nil
+}
+
+func TestRerankSearchResult(t *testing.T) {
+	result := &chromago.SearchResultImpl{
+		IDs:       [][]chromago.DocumentID{{"a", "b", "c"}, {"d", "e"}},
+		Documents: [][]string{{"x", "xxx", "xx"}, {"yy", "yyyy"}},
+		Metadatas: [][]chromago.DocumentMetadata{
+			{chromago.NewDocumentMetadata(chromago.NewIntAttribute("n", 0)), chromago.NewDocumentMetadata(chromago.NewIntAttribute("n", 1)), chromago.NewDocumentMetadata(chromago.NewIntAttribute("n", 2))},
+			{nil, nil},
+		},
+		Scores: [][]float64{{0.1, 0.2, 0.3}, {0.4, 0.5}},
+	}
+
+	t.Run("reorders every group", func(t *testing.T) {
+		reranked, err := RerankSearchResult(context.Background(), &lengthRerankingFunction{}, []string{"q"}, result)
+		require.NoError(t, err)
+		require.Equal(t, [][]chromago.DocumentID{{"b", "c", "a"}, {"e", "d"}}, reranked.IDs)
+		require.Equal(t, [][]string{{"xxx", "xx", "x"}, {"yyyy", "yy"}}, reranked.Documents)
+		require.Equal(t, [][]float64{{0.2, 0.3, 0.1}, {0.5, 0.4}}, reranked.Scores)
+		require.Equal(t, [][]int{{1, 2, 0}, {1, 0}}, reranked.OriginalIndexes)
+		require.Equal(t, [][]float32{{3, 2, 1}, {4, 2}}, reranked.Ranks["length"])
+		n, ok := reranked.Rows()[0].Metadata.GetInt("n")
+		require.True(t, ok)
+		require.Equal(t, int64(1), n)
+		require.Equal(t, []string{"q", "q"}, reranked.QueryTexts)
+		// the input is not modified
+		require.Equal(t, chromago.DocumentID("a"), result.IDs[0][0])
+	})
+
+	t.Run("unscored rows are kept after scored rows", func(t *testing.T) {
+		reranked, err := RerankSearchResult(context.Background(), &lengthRerankingFunction{maxScored: 1}, []string{"q1", "q2"}, result)
+		require.NoError(t, err)
+		require.Equal(t, []chromago.DocumentID{"a", "b", "c"}, reranked.IDs[0])
+	})
+
+	t.Run("top n", func(t *testing.T) {
+		reranked, err := RerankSearchResult(context.Background(), &lengthRerankingFunction{}, []string{"q"}, result, WithSearchRerankTopN(1))
+		require.NoError(t, err)
+		require.Equal(t, [][]chromago.DocumentID{{"b"}, {"e"}}, reranked.IDs)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := RerankSearchResult(context.Background(), &lengthRerankingFunction{}, []string{"q1", "q2", "q3"}, result)
+		require.Error(t, err)
+		_, err = RerankSearchResult(context.Background(), &lengthRerankingFunction{}, []string{"q"}, &chromago.SearchResultImpl{
+			IDs: [][]chromago.DocumentID{{"a"}},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "KDocument")
+	})
+}
@@ -13,6 +13,8 @@ import (
 )
 
 const (
+	// APIKeyEnvVar is the default environment variable holding the API key.
+	APIKeyEnvVar                                     = "TOGETHER_API_KEY"
 	DefaultBaseAPIEndpoint                           = "https://api.together.xyz/v1/rerank"
 	DefaultRerankingModel  rerankings.RerankingModel = "Salesforce/Llama-Rank-V1"
 )
@@ -37,7 +39,7 @@ type RerankingResponse struct {
 	} `json:"results"`
 }
 
-var _ rerankings.RerankingFunction = (*TogetherRerankingFunction)(nil)
+var _ rerankings.ConfigurableRerankingFunction = (*TogetherRerankingFunction)(nil)
 
 func getDefaults() *TogetherRerankingFunction {
 	var returnDocuments = true
@@ -53,6 +55,7 @@ func getDefaults() *TogetherRerankingFunction {
 type TogetherRerankingFunction struct {
 	httpClient        *http.Client
 	apiKey            string
+	apiKeyEnvVar      string
 	defaultModel      rerankings.RerankingModel
 	rerankingEndpoint string
 	returnDocuments   *bool
@@ -201,3 +204,62 @@ func (r *TogetherRerankingFunction) RerankResults(ctx context.Context, queryText
 	}
 	return rerankedResults, nil
 }
+
+// Name returns the registry name of the reranking function.
+func (r *TogetherRerankingFunction) Name() string {
+	return "together"
+}
+
+// GetConfig returns the persistable configuration of the reranking function.
+// The API key is referenced by its environment variable name.
+func (r *TogetherRerankingFunction) GetConfig() rerankings.RerankingFunctionConfig {
+	envVar := r.apiKeyEnvVar
+	if envVar == "" {
+		envVar = APIKeyEnvVar
+	}
+	cfg := rerankings.RerankingFunctionConfig{
+		"model_name":      string(r.defaultModel),
+		"api_key_env_var": envVar,
+	}
+	if r.rerankingEndpoint != "" && r.rerankingEndpoint != DefaultBaseAPIEndpoint {
+		cfg["base_url"] = r.rerankingEndpoint
+	}
+	if r.topN != nil {
+		cfg["top_n"] = *r.topN
+	}
+	if r.returnDocuments != nil && !*r.returnDocuments {
+		cfg["return_documents"] = false
+	}
+	return cfg
+}
+
+// NewTogetherRerankingFunctionFromConfig creates a Together AI reranking function from a config map.
+// Supported fields: api_key_env_var, model_name, base_url, top_n, return_documents.
+func NewTogetherRerankingFunctionFromConfig(cfg rerankings.RerankingFunctionConfig) (*TogetherRerankingFunction, error) {
+	envVar, ok := rerankings.ConfigString(cfg, "api_key_env_var")
+	if !ok {
+		envVar = APIKeyEnvVar
+	}
+	opts := []Option{WithAPIKeyFromEnvVar(envVar)}
+	if model, ok := rerankings.ConfigString(cfg, "model_name"); ok {
+		opts = append(opts, WithModel(rerankings.RerankingModel(model)))
+	}
+	if baseURL, ok := rerankings.ConfigString(cfg, "base_url"); ok {
+		opts = append(opts, WithRerankingEndpoint(baseURL))
+	}
+	if topN, ok := rerankings.ConfigInt(cfg, "top_n"); ok {
+		opts = append(opts, WithTopN(topN))
+	}
+	if returnDocuments, ok := rerankings.ConfigBool(cfg, "return_documents"); ok {
+		opts = append(opts, WithReturnDocuments(returnDocuments))
+	}
+	return NewTogetherRerankingFunction(opts...)
+}
+
+func init() {
+	if err := rerankings.RegisterReranker("together", func(cfg rerankings.RerankingFunctionConfig) (rerankings.RerankingFunction, error) {
+		return NewTogetherRerankingFunctionFromConfig(cfg)
+	}); err != nil {
+		panic(err)
+	}
+}
@@ -2,19 +2,16 @@ package tokenizers
 
 import (
 	"archive/tar"
-	"bufio"
 	"compress/gzip"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"crypto/x509"
 	"encoding/json"
 	stderrors "errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
-	"path"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
@@ -25,25 +22,26 @@ import (
 	semver "github.com/Masterminds/semver/v3"
 	"github.com/pkg/errors"
 
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
 	"github.com/amikos-tech/chroma-go/pkg/internal/cosignutil"
 	downloadutil "github.com/amikos-tech/chroma-go/pkg/internal/downloadutil"
 )
 
 const (
 	defaultTokenizerLibraryVersion               = "v0.1.4"
-	defaultTokenizerReleaseBaseURL               = "https://releases.amikos.tech/pure-tokenizers"
-	defaultTokenizerFallbackReleaseBaseURL       = "https://github.com/amikos-tech/pure-tokenizers/releases/download"
+	defaultTokenizerReleaseBaseURL               = artifacts.TokenizersReleaseBaseURL
+	defaultTokenizerFallbackReleaseBaseURL       = artifacts.TokenizersFallbackBaseURL
 	tokenizerModulePath                          = "github.com/amikos-tech/pure-tokenizers"
 	tokenizerLatestTag                           = "latest"
-	tokenizerChecksumsAsset                      = "SHA256SUMS"
-	tokenizerChecksumsSignatureAsset             = "SHA256SUMS.sig"
-	tokenizerChecksumsCertificateAsset           = "SHA256SUMS.pem"
+	tokenizerChecksumsAsset                      = artifacts.ChecksumsAsset
+	tokenizerChecksumsSignatureAsset             = artifacts.ChecksumsSignatureAsset
+	tokenizerChecksumsCertificateAsset           = artifacts.ChecksumsCertificateAsset
 	tokenizerGitHubReleasesAPI                   = "https://api.github.com/repos/amikos-tech/pure-tokenizers/releases?per_page=100&page=1"
 	tokenizerGitHubAPIVersion                    = "2022-11-28"
 	tokenizerCacheDirPerm                        = os.FileMode(0700)
 	tokenizerArtifactFilePerm                    = os.FileMode(0700)
-	tokenizerCosignOIDCIssuer                    = "https://token.actions.githubusercontent.com"
-	tokenizerCosignIdentityTemplate              = "https://github.com/amikos-tech/pure-tokenizers/.github/workflows/rust-release.yml@refs/tags/%s"
+	tokenizerCosignOIDCIssuer                    = artifacts.GitHubActionsOIDCIssuer
+	tokenizerCosignIdentityTemplate              = artifacts.TokenizersIdentityTemplate
 	tokenizerDownloaderUserAgent                 = "chroma-go-tokenizers-downloader"
 	tokenizerMaxVersionTagLength                 = 128
 	tokenizerMaxLibraryBytes               int64 = 200 * 1024 * 1024
@@ -59,7 +57,6 @@ var (
 	tokenizerDownloadArtifactFileFunc         = tokenizerDownloadArtifactFileWithRetry
 	tokenizerDownloadMetadataFileFunc         = tokenizerDownloadMetadataFileWithRetry
 	tokenizerReadBuildInfoFunc                = debug.ReadBuildInfo
-	tokenizerUserHomeDirFunc                  = os.UserHomeDir
 	tokenizerGetMetadataHTTPClientFunc        = tokenizerGetMetadataHTTPClient
 	tokenizerVerifyCosignCertificateChainFunc = cosignutil.VerifyFulcioCertificateChain
 
@@ -108,10 +105,7 @@ func ensureTokenizerLibraryDownloaded() (string, error) {
 		return "", errors.Errorf("failed to resolve concrete tokenizers version from %q", version)
 	}
 
-	cacheDir, err := defaultTokenizerLibraryCacheDir()
-	if err != nil {
-		return "", errors.Wrap(err, "failed to determine tokenizer cache dir")
-	}
+	cacheDir := defaultTokenizerLibraryCacheDir()
 
 	asset, err := tokenizerLibraryAssetForRuntime(runtime.GOOS, runtime.GOARCH)
 	if err != nil {
@@ -144,6 +138,24 @@ func ensureTokenizerLibraryDownloaded() (string, error) {
 		return "", errors.Wrap(err, "failed to create tokenizers cache dir")
 	}
 
+	manager, err := tokenizerArtifactManager()
+	if err != nil {
+		return "", err
+	}
+	lock, err := manager.Lock(targetDir)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to acquire tokenizers download lock")
+	}
+	defer lock.Unlock()
+
+	exists, err = tokenizerFileExistsNonEmpty(targetLibraryPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to stat tokenizers shared library at %s", targetLibraryPath)
+	}
+	if exists {
+		return targetLibraryPath, nil
+	}
+
 	releaseBases := tokenizerReleaseBaseURLs()
 	if len(releaseBases) == 0 {
 		return "", errors.New("no tokenizers release base URL configured")
@@ -279,57 +291,19 @@ func detectTokenizerLibraryVersion() (string, error) {
 	return defaultVersion, nil
 }
 
-func defaultTokenizerLibraryCacheDir() (string, error) {
-	homeDir, err := tokenizerUserHomeDirFunc()
-	if err != nil {
-		return "", errors.Wrap(err, "failed to resolve home directory")
-	}
-	if strings.TrimSpace(homeDir) == "" {
-		return "", errors.New("home directory is empty")
-	}
-	return filepath.Join(homeDir, ".cache", "chroma", "pure_tokenizers"), nil
+func defaultTokenizerLibraryCacheDir() string {
+	return filepath.Join(artifacts.CacheRoot(), artifacts.Tokenizers.Name)
 }
 
 func tokenizerLibraryAssetForRuntime(goos, goarch string) (tokenizerLibraryAsset, error) {
-	var arch string
-	switch goarch {
-	case "amd64":
-		arch = "x86_64"
-	case "arm64":
-		arch = "aarch64"
-	default:
-		return tokenizerLibraryAsset{}, errors.Errorf("unsupported architecture for tokenizers download: %s", goarch)
-	}
-
-	var targetTriple string
-	var libraryFileName string
-	var platform string
-	switch goos {
-	case "darwin":
-		targetTriple = "apple-darwin"
-		platform = "darwin-" + goarch
-		libraryFileName = "libtokenizers.dylib"
-	case "linux":
-		if tokenizerIsMuslLinux() {
-			targetTriple = "unknown-linux-musl"
-			platform = "linux-" + goarch + "-musl"
-		} else {
-			targetTriple = "unknown-linux-gnu"
-			platform = "linux-" + goarch
-		}
-		libraryFileName = "libtokenizers.so"
-	case "windows":
-		targetTriple = "pc-windows-msvc"
-		platform = "windows-" + goarch
-		libraryFileName = "tokenizers.dll"
-	default:
-		return tokenizerLibraryAsset{}, errors.Errorf("unsupported OS for tokenizers download: %s", goos)
+	asset, err := artifacts.TokenizersAsset(goos, goarch, goos == "linux" && tokenizerIsMuslLinux())
+	if err != nil {
+		return tokenizerLibraryAsset{}, err
 	}
-
 	return tokenizerLibraryAsset{
-		platform:        platform,
-		archiveFileName: fmt.Sprintf("libtokenizers-%s-%s.tar.gz", arch, targetTriple),
-		libraryFileName: libraryFileName,
+		platform:        asset.Platform,
+		archiveFileName: asset.ArchiveNames[0],
+		libraryFileName: asset.Library,
 	}, nil
 }
 
@@ -353,11 +327,33 @@ func tokenizerIsMuslLinux() bool {
 	return strings.Contains(strings.ToLower(string(lddContents)), "musl")
 }
 
+// tokenizerArtifactManager returns the artifact manager used for
+// libtokenizers, wired to the package test hooks.
+func tokenizerArtifactManager() (*artifacts.Manager, error) {
+	return artifacts.New(
+		artifacts.WithDownloader(func(_ context.Context, dest, url string) error {
+			return tokenizerDownloadArtifactFileFunc(dest, url)
+		}),
+		artifacts.WithMetadataDownloader(func(_ context.Context, dest, url string) error {
+			return tokenizerDownloadMetadataFileFunc(dest, url)
+		}),
+		artifacts.WithCertificateChainVerifier(func(certificate *x509.Certificate) error {
+			return tokenizerVerifyCosignCertificateChainFunc(certificate)
+		}),
+	)
+}
+
+// tokenizerReleaseBaseURLs returns the configured mirrors of libtokenizers
+// followed by the release base URLs.
 func tokenizerReleaseBaseURLs() []string {
-	candidates := []string{
+	var candidates []string
+	if manager, err := tokenizerArtifactManager(); err == nil {
+		candidates = manager.Mirrors(artifacts.Tokenizers)
+	}
+	candidates = append(candidates,
 		strings.TrimSpace(tokenizerReleaseBaseURL),
 		strings.TrimSpace(tokenizerFallbackReleaseBaseURL),
-	}
+	)
 	seen := make(map[string]struct{}, len(candidates))
 	bases := make([]string, 0, len(candidates))
 	for _, base := range candidates {
@@ -375,63 +371,21 @@ func tokenizerReleaseBaseURLs() []string {
 }
 
 func tokenizerValidateReleaseBaseURL(baseURL string) (string, error) {
-	baseURL = strings.TrimSpace(strings.TrimRight(baseURL, "/"))
-	if baseURL == "" {
-		return "", errors.New("release base URL cannot be empty")
-	}
-	parsedURL, err := url.Parse(baseURL)
-	if err != nil {
-		return "", errors.Wrap(err, "invalid release base URL")
-	}
-	if !parsedURL.IsAbs() {
-		return "", errors.New("release base URL must be absolute")
-	}
-	if !strings.EqualFold(parsedURL.Scheme, "https") {
-		return "", errors.Errorf("release base URL must use https scheme: %s", baseURL)
-	}
-	if strings.TrimSpace(parsedURL.Host) == "" {
-		return "", errors.Errorf("release base URL host cannot be empty: %s", baseURL)
-	}
-	return baseURL, nil
+	return artifacts.ValidateBaseURL(baseURL)
 }
 
 func tokenizerPrepareChecksumFromBase(baseURL, version, archiveName, targetDir string) (string, error) {
-	checksumsPath := filepath.Join(targetDir, tokenizerChecksumsAsset)
-	checksumsSignaturePath := filepath.Join(targetDir, tokenizerChecksumsSignatureAsset)
-	checksumsCertificatePath := filepath.Join(targetDir, tokenizerChecksumsCertificateAsset)
-
-	type metaDownload struct {
-		asset, dest, errMsg string
-	}
-	downloads := []metaDownload{
-		{tokenizerChecksumsAsset, checksumsPath, "failed to download tokenizers checksums"},
-		{tokenizerChecksumsSignatureAsset, checksumsSignaturePath, "failed to download tokenizers checksums signature"},
-		{tokenizerChecksumsCertificateAsset, checksumsCertificatePath, "failed to download tokenizers checksums certificate"},
-	}
-	errs := make([]error, len(downloads))
-	var wg sync.WaitGroup
-	for i, dl := range downloads {
-		wg.Add(1)
-		go func(index int, download metaDownload) {
-			defer wg.Done()
-			if err := tokenizerDownloadMetadataAssetFromBase(baseURL, version, download.asset, download.dest); err != nil {
-				errs[index] = errors.Wrap(err, download.errMsg)
-			}
-		}(i, dl)
-	}
-	wg.Wait()
-	downloadErrs := make([]error, 0, len(errs))
-	for _, err := range errs {
-		if err != nil {
-			downloadErrs = append(downloadErrs, err)
-		}
+	normalizedBaseURL, err := tokenizerValidateReleaseBaseURL(baseURL)
+	if err != nil {
+		return "", err
 	}
-	if len(downloadErrs) > 0 {
-		return "", errors.Wrap(stderrors.Join(downloadErrs...), "failed to download tokenizers checksum metadata")
+	manager, err := tokenizerArtifactManager()
+	if err != nil {
+		return "", err
 	}
-
-	if err := tokenizerVerifySignedChecksums(version, checksumsPath, checksumsSignaturePath, checksumsCertificatePath); err != nil {
-		return "", errors.Wrap(err, "failed to verify tokenizers checksums signature")
+	checksumsPath, err := manager.FetchSignedChecksums(context.Background(), normalizedBaseURL+"/"+version, targetDir, artifacts.TokenizersSigner(version))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to verify tokenizers checksum metadata")
 	}
 
 	checksum, err := tokenizerChecksumFromSumsFile(checksumsPath, archiveName)
@@ -453,27 +407,6 @@ func tokenizerDownloadReleaseAssetFromBase(baseURL, version, assetName, destinat
 	return nil
 }
 
-func tokenizerDownloadMetadataAssetFromBase(baseURL, version, assetName, destinationPath string) error {
-	normalizedBaseURL, err := tokenizerValidateReleaseBaseURL(baseURL)
-	if err != nil {
-		return err
-	}
-	url := fmt.Sprintf("%s/%s/%s", normalizedBaseURL, version, assetName)
-	if err := tokenizerDownloadMetadataFileFunc(destinationPath, url); err != nil {
-		return errors.Wrapf(err, "download from %s failed", normalizedBaseURL)
-	}
-	return nil
-}
-
-func tokenizerVerifySignedChecksums(version, checksumsPath, signaturePath, certificatePath string) error {
-	expectedIdentity := fmt.Sprintf(tokenizerCosignIdentityTemplate, version)
-	return cosignutil.VerifySignedChecksums(
-		checksumsPath, signaturePath, certificatePath,
-		expectedIdentity, tokenizerCosignOIDCIssuer,
-		tokenizerVerifyCosignCertificateChainFunc,
-	)
-}
-
 func tokenizerResolveLatestVersion() (string, error) {
 	var errs []error
 
@@ -648,92 +581,13 @@ func normalizeTokenizerTag(version string) (string, error) {
 	return normalizedVersion, nil
 }
 
-func tokenizerNormalizedChecksumAssetName(assetName string) string {
-	normalized := strings.TrimPrefix(strings.TrimSpace(assetName), "*")
-	normalized = strings.ReplaceAll(normalized, "\\", "/")
-	normalized = path.Base(normalized)
-	if normalized == "." || normalized == "/" || normalized == ".." {
-		return ""
-	}
-	return strings.TrimSpace(normalized)
-}
-
 func tokenizerChecksumFromSumsFile(sumsFilePath, assetName string) (string, error) {
-	assetName = tokenizerNormalizedChecksumAssetName(assetName)
-	if assetName == "" {
-		return "", errors.New("asset name cannot be empty")
-	}
-
-	f, err := os.Open(sumsFilePath)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to open checksum file")
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(strings.TrimRight(scanner.Text(), "\r"))
-		if line == "" {
-			continue
-		}
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
-		}
-		checksumAssetName := tokenizerNormalizedChecksumAssetName(fields[1])
-		if checksumAssetName == "" || checksumAssetName != assetName {
-			continue
-		}
-		checksum := strings.ToLower(fields[0])
-		if !tokenizerLooksLikeSHA256(checksum) {
-			return "", errors.Errorf("invalid checksum format for asset %s: %q", assetName, fields[0])
-		}
-		return checksum, nil
-	}
-	if err := scanner.Err(); err != nil {
-		return "", errors.Wrap(err, "failed to read checksum file")
-	}
-	return "", errors.Errorf("checksum entry not found for asset %s", assetName)
-}
-
-func tokenizerLooksLikeSHA256(v string) bool {
-	if len(v) != 64 {
-		return false
-	}
-	for _, r := range v {
-		switch {
-		case r >= '0' && r <= '9':
-		case r >= 'a' && r <= 'f':
-		case r >= 'A' && r <= 'F':
-		default:
-			return false
-		}
-	}
-	return true
+	_, checksum, err := artifacts.ChecksumFromSums(sumsFilePath, assetName)
+	return checksum, err
 }
 
 func tokenizerVerifyFileChecksum(filePath, expectedChecksum string) error {
-	expectedChecksum = strings.TrimSpace(strings.ToLower(expectedChecksum))
-	if expectedChecksum == "" {
-		return errors.New("expected checksum cannot be empty")
-	}
-
-	f, err := os.Open(filePath)
-	if err != nil {
-		return errors.Wrap(err, "failed to open file for checksum verification")
-	}
-	defer f.Close()
-
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, f); err != nil {
-		return errors.Wrap(err, "failed to hash downloaded file")
-	}
-
-	actualChecksum := hex.EncodeToString(hasher.Sum(nil))
-	if actualChecksum != expectedChecksum {
-		return errors.Errorf("checksum mismatch for %s: expected %s, got %s", filePath, expectedChecksum, actualChecksum)
-	}
-	return nil
+	return artifacts.VerifyFile(filePath, expectedChecksum)
 }
 
 func tokenizerDownloadArtifactFileWithRetry(filePath, url string) error {
@@ -744,6 +598,7 @@ func tokenizerDownloadArtifactFileWithRetry(filePath, url string) error {
 		downloadutil.Config{
 			MaxBytes:  tokenizerMaxArtifactBytes,
 			DirPerm:   tokenizerCacheDirPerm,
+			Resume:    true,
 			Accept:    "*/*",
 			UserAgent: tokenizerDownloaderUserAgent,
 		},
@@ -30,6 +30,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/amikos-tech/chroma-go/pkg/internal/artifacts"
 	"github.com/amikos-tech/chroma-go/pkg/internal/cosignutil"
 )
 
@@ -107,6 +108,28 @@ func TestTokenizerReleaseBaseURLsRejectsHTTP(t *testing.T) {
 	require.Equal(t, []string{"https://releases.amikos.tech/pure-tokenizers"}, urls)
 }
 
+func TestTokenizerReleaseBaseURLsPrefersMirrors(t *testing.T) {
+	lockTokenizerTestHooks(t)
+
+	originalPrimary := tokenizerReleaseBaseURL
+	originalFallback := tokenizerFallbackReleaseBaseURL
+	t.Cleanup(func() {
+		tokenizerReleaseBaseURL = originalPrimary
+		tokenizerFallbackReleaseBaseURL = originalFallback
+	})
+
+	tokenizerReleaseBaseURL = "https://releases.amikos.tech/pure-tokenizers"
+	tokenizerFallbackReleaseBaseURL = ""
+	t.Setenv("CHROMA_TOKENIZERS_MIRROR", "https://mirror-a.example.com/tokenizers")
+	t.Setenv("CHROMA_ARTIFACT_MIRROR", "https://artifactory.example.com/generic/")
+
+	require.Equal(t, []string{
+		"https://mirror-a.example.com/tokenizers",
+		"https://artifactory.example.com/generic/pure-tokenizers",
+		"https://releases.amikos.tech/pure-tokenizers",
+	}, tokenizerReleaseBaseURLs())
+}
+
 func TestTokenizerChecksumFromSumsFile(t *testing.T) {
 	t.Run("find checksum", func(t *testing.T) {
 		dir := t.TempDir()
@@ -251,55 +274,11 @@ func TestTokenizerResolveLatestVersion_FallsBackToGitHub(t *testing.T) {
 	require.Equal(t, 1, githubRequests)
 }
 
-func TestTokenizerVerifySignedChecksums(t *testing.T) {
-	lockTokenizerTestHooks(t)
-
-	bypassTokenizerCosignChainVerification(t)
-
-	version := "rust-v0.1.4"
-	checksumBody := []byte("1111111111111111111111111111111111111111111111111111111111111111  artifact.tar.gz\n")
-	signatureBody, certificateBody := newTokenizerSignedChecksumArtifacts(t, version, checksumBody)
-
-	dir := t.TempDir()
-	checksumPath := filepath.Join(dir, tokenizerChecksumsAsset)
-	signaturePath := filepath.Join(dir, tokenizerChecksumsSignatureAsset)
-	certificatePath := filepath.Join(dir, tokenizerChecksumsCertificateAsset)
-	require.NoError(t, os.WriteFile(checksumPath, checksumBody, 0600))
-	require.NoError(t, os.WriteFile(signaturePath, signatureBody, 0600))
-	require.NoError(t, os.WriteFile(certificatePath, certificateBody, 0600))
-
-	require.NoError(t, tokenizerVerifySignedChecksums(version, checksumPath, signaturePath, certificatePath))
-}
-
-func TestTokenizerVerifySignedChecksums_RejectsInvalidSignature(t *testing.T) {
-	lockTokenizerTestHooks(t)
-
-	bypassTokenizerCosignChainVerification(t)
-
-	version := "rust-v0.1.4"
-	checksumBody := []byte("1111111111111111111111111111111111111111111111111111111111111111  artifact.tar.gz\n")
-	_, certificateBody := newTokenizerSignedChecksumArtifacts(t, version, checksumBody)
-	invalidSignature := []byte(base64.StdEncoding.EncodeToString([]byte("definitely-invalid-signature")))
-
-	dir := t.TempDir()
-	checksumPath := filepath.Join(dir, tokenizerChecksumsAsset)
-	signaturePath := filepath.Join(dir, tokenizerChecksumsSignatureAsset)
-	certificatePath := filepath.Join(dir, tokenizerChecksumsCertificateAsset)
-	require.NoError(t, os.WriteFile(checksumPath, checksumBody, 0600))
-	require.NoError(t, os.WriteFile(signaturePath, invalidSignature, 0600))
-	require.NoError(t, os.WriteFile(certificatePath, certificateBody, 0600))
-
-	err := tokenizerVerifySignedChecksums(version, checksumPath, signaturePath, certificatePath)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "invalid checksum signature")
-}
-
 func TestEnsureTokenizerLibraryDownloadedRetriesAcrossMirrors(t *testing.T) {
 	lockTokenizerTestHooks(t)
 
 	originalPrimary := tokenizerReleaseBaseURL
 	originalFallback := tokenizerFallbackReleaseBaseURL
-	originalHomeDir := tokenizerUserHomeDirFunc
 	originalArtifactDownloadFunc := tokenizerDownloadArtifactFileFunc
 	originalMetadataDownloadFunc := tokenizerDownloadMetadataFileFunc
 	originalBuildInfo := tokenizerReadBuildInfoFunc
@@ -307,7 +286,6 @@ func TestEnsureTokenizerLibraryDownloadedRetriesAcrossMirrors(t *testing.T) {
 	t.Cleanup(func() {
 		tokenizerReleaseBaseURL = originalPrimary
 		tokenizerFallbackReleaseBaseURL = originalFallback
-		tokenizerUserHomeDirFunc = originalHomeDir
 		tokenizerDownloadArtifactFileFunc = originalArtifactDownloadFunc
 		tokenizerDownloadMetadataFileFunc = originalMetadataDownloadFunc
 		tokenizerReadBuildInfoFunc = originalBuildInfo
@@ -315,7 +293,8 @@ func TestEnsureTokenizerLibraryDownloadedRetriesAcrossMirrors(t *testing.T) {
 	})
 
 	tempHome := t.TempDir()
-	tokenizerUserHomeDirFunc = func() (string, error) { return tempHome, nil }
+	t.Setenv("HOME", tempHome)
+	t.Setenv(artifacts.CacheDirEnv, "")
 	tokenizerReadBuildInfoFunc = func() (*debug.BuildInfo, bool) { return nil, false }
 	tokenizerVerifyCosignCertificateChainFunc = func(*x509.Certificate) error { return nil }
 	tokenizerReleaseBaseURL = "https://mirror-a.invalid/pure-tokenizers"
@@ -370,21 +349,20 @@ func TestEnsureTokenizerLibraryDownloaded_FailsOnChecksumMismatchAfterDownload(t
 
 	originalPrimary := tokenizerReleaseBaseURL
 	originalFallback := tokenizerFallbackReleaseBaseURL
-	originalHomeDir := tokenizerUserHomeDirFunc
 	originalArtifactDownloadFunc := tokenizerDownloadArtifactFileFunc
 	originalMetadataDownloadFunc := tokenizerDownloadMetadataFileFunc
 	originalBuildInfo := tokenizerReadBuildInfoFunc
 	t.Cleanup(func() {
 		tokenizerReleaseBaseURL = originalPrimary
 		tokenizerFallbackReleaseBaseURL = originalFallback
-		tokenizerUserHomeDirFunc = originalHomeDir
 		tokenizerDownloadArtifactFileFunc = originalArtifactDownloadFunc
 		tokenizerDownloadMetadataFileFunc = originalMetadataDownloadFunc
 		tokenizerReadBuildInfoFunc = originalBuildInfo
 	})
 
 	tempHome := t.TempDir()
-	tokenizerUserHomeDirFunc = func() (string, error) { return tempHome, nil }
+	t.Setenv("HOME", tempHome)
+	t.Setenv(artifacts.CacheDirEnv, "")
 	tokenizerReadBuildInfoFunc = func() (*debug.BuildInfo, bool) { return nil, false }
 	tokenizerReleaseBaseURL = "https://mirror.invalid/pure-tokenizers"
 	tokenizerFallbackReleaseBaseURL = ""
@@ -436,21 +414,20 @@ func TestEnsureTokenizerLibraryDownloadedFromPrimaryWhenFallbackUnavailable(t *t
 
 	originalPrimary := tokenizerReleaseBaseURL
 	originalFallback := tokenizerFallbackReleaseBaseURL
-	originalHomeDir := tokenizerUserHomeDirFunc
 	originalArtifactDownloadFunc := tokenizerDownloadArtifactFileFunc
 	originalMetadataDownloadFunc := tokenizerDownloadMetadataFileFunc
 	originalBuildInfo := tokenizerReadBuildInfoFunc
 	t.Cleanup(func() {
 		tokenizerReleaseBaseURL = originalPrimary
 		tokenizerFallbackReleaseBaseURL = originalFallback
-		tokenizerUserHomeDirFunc = originalHomeDir
 		tokenizerDownloadArtifactFileFunc = originalArtifactDownloadFunc
 		tokenizerDownloadMetadataFileFunc = originalMetadataDownloadFunc
 		tokenizerReadBuildInfoFunc = originalBuildInfo
 	})
 
 	tempHome := t.TempDir()
-	tokenizerUserHomeDirFunc = func() (string, error) { return tempHome, nil }
+	t.Setenv("HOME", tempHome)
+	t.Setenv(artifacts.CacheDirEnv, "")
 	tokenizerDownloadArtifactFileFunc = tokenizerDownloadArtifactFileWithRetry
 	tokenizerDownloadMetadataFileFunc = tokenizerDownloadMetadataFileWithRetry
 	tokenizerReadBuildInfoFunc = func() (*debug.BuildInfo, bool) { return nil, false }
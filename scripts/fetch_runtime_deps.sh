@@ -18,8 +18,8 @@ Usage:
 
 Options:
   --output-dir DIR              Download artifacts into DIR (default: ./artifacts/runtime-deps)
-  --goos GOOS                   Target OS (host platform only; no cross-platform bundling yet)
-  --goarch GOARCH               Target architecture (host platform only; no cross-platform bundling yet)
+  --goos GOOS                   Target OS (default: host)
+  --goarch GOARCH               Target architecture (default: host)
   --local-shim-version VERSION  Version of chroma-go-local to download
   --tokenizers-version VERSION  Version of pure-tokenizers to download
   --onnx-runtime-version VERSION Version of ONNX Runtime shared library to download
@@ -82,58 +82,26 @@ trap cleanup_on_failure EXIT
 mkdir -p "${OUTPUT_DIR}"
 echo "Downloading runtime dependencies into ${OUTPUT_DIR}..."
 
-echo "Step 1/3: Fetching native artifacts via offline bundle generator..."
-go run "${SCRIPT_DIR}/offline_bundle" \
+BUNDLE_DIR="${OUTPUT_DIR}/bundle"
+CACHE_DIR="${OUTPUT_DIR}/cache"
+
+echo "Step 1/2: Creating offline bundle in ${BUNDLE_DIR}..."
+(cd "${REPO_ROOT}" && go run ./cmd/chroma-go bundle create \
 	--force \
-	--output "${OUTPUT_DIR}" \
-	--goos "${GOOS}" \
-	--goarch "${GOARCH}" \
+	--output "${BUNDLE_DIR}" \
+	--target "${GOOS}/${GOARCH}" \
 	--local-shim-version "${LOCAL_SHIM_VERSION}" \
 	--tokenizers-version "${TOKENIZERS_VERSION}" \
-	--onnx-runtime-version "${ONNX_RUNTIME_VERSION}"
-
-if [ ! -f "${OUTPUT_DIR}/offline-env.sh" ]; then
-	echo "expected ${OUTPUT_DIR}/offline-env.sh after dependency generation" >&2
-	exit 1
-fi
-
-. "${OUTPUT_DIR}/offline-env.sh"
-echo "Step 2/3: Exporting runtime environment from generated offline env..."
-
-MODEL_SOURCE="${OUTPUT_DIR}/onnx-models/all-MiniLM-L6-v2/onnx"
-RUNTIME_HOME="${CHROMA_OFFLINE_BUNDLE_HOME:-${OUTPUT_DIR}}"
-HOME_DIR="${HOME:-${USERPROFILE:-/tmp}}"
-MODEL_TARGET="${HOME_DIR}/.cache/chroma/onnx_models/all-MiniLM-L6-v2/onnx"
-
-: "${CHROMA_LIB_PATH:?missing CHROMA_LIB_PATH in ${OUTPUT_DIR}/offline-env.sh}"
-: "${TOKENIZERS_LIB_PATH:?missing TOKENIZERS_LIB_PATH in ${OUTPUT_DIR}/offline-env.sh}"
-: "${CHROMAGO_ONNX_RUNTIME_PATH:?missing CHROMAGO_ONNX_RUNTIME_PATH in ${OUTPUT_DIR}/offline-env.sh}"
-: "${TOKENIZERS_VERSION:?missing TOKENIZERS_VERSION in ${OUTPUT_DIR}/offline-env.sh}"
-: "${CHROMAGO_ONNX_RUNTIME_VERSION:?missing CHROMAGO_ONNX_RUNTIME_VERSION in ${OUTPUT_DIR}/offline-env.sh}"
-
-mkdir -p "${MODEL_TARGET}"
-if [ -d "${MODEL_SOURCE}" ]; then
-	cp -R "${MODEL_SOURCE}/." "${MODEL_TARGET}/"
-	echo "Step 3/3: Copied default model cache to ${MODEL_TARGET}"
-else
-	echo "Model source missing at ${MODEL_SOURCE}" >&2
-	exit 1
-fi
-
-quote_for_shell() {
-	printf "'"
-	printf '%s' "$1" | sed "s/'/'\"\\'\"'/g"
-	printf "'"
-}
+	--onnx-runtime-version "${ONNX_RUNTIME_VERSION}")
 
+echo "Step 2/2: Verifying and installing the bundle into ${CACHE_DIR}..."
 {
 	echo "# Load these variables before running bootstrap-dependent tests."
-	printf "export CHROMA_OFFLINE_BUNDLE_HOME=%s\n" "$(quote_for_shell "${RUNTIME_HOME}")"
-	printf "export CHROMA_LIB_PATH=%s\n" "$(quote_for_shell "${CHROMA_LIB_PATH}")"
-	printf "export TOKENIZERS_LIB_PATH=%s\n" "$(quote_for_shell "${TOKENIZERS_LIB_PATH}")"
-	printf "export CHROMAGO_ONNX_RUNTIME_PATH=%s\n" "$(quote_for_shell "${CHROMAGO_ONNX_RUNTIME_PATH}")"
-	printf "export TOKENIZERS_VERSION=%s\n" "$(quote_for_shell "${TOKENIZERS_VERSION}")"
-	printf "export CHROMAGO_ONNX_RUNTIME_VERSION=%s\n" "$(quote_for_shell "${CHROMAGO_ONNX_RUNTIME_VERSION}")"
+	(cd "${REPO_ROOT}" && go run ./cmd/chroma-go bundle install \
+		--cache-dir "${CACHE_DIR}" \
+		--target "${GOOS}/${GOARCH}" \
+		--print-env \
+		"${BUNDLE_DIR}")
 } > "${OUTPUT_DIR}/runtime-env.sh"
 
 _fetch_ok=1